@@ -0,0 +1,57 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// debugdap is a Debug Adapter Protocol server for the target binary.  By
+// default it speaks the protocol on standard input and output; with -listen
+// it accepts a single client connection on the given TCP address.
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"os"
+
+	"golang.org/x/debug/dap"
+	"golang.org/x/debug/local"
+)
+
+var (
+	textFlag   = flag.String("text", "", "file name of binary being debugged")
+	listenFlag = flag.String("listen", "", "TCP address to listen on instead of using standard input and output")
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("debugdap: ")
+	flag.Parse()
+	if *textFlag == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	prog, err := local.New(*textFlag)
+	if err != nil {
+		log.Fatalf("local.New: %v", err)
+	}
+	if *listenFlag == "" {
+		if err := dap.NewSession(os.Stdin, os.Stdout, prog).Serve(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	l, err := net.Listen("tcp", *listenFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("listening on %s", l.Addr())
+	conn, err := l.Accept()
+	if err != nil {
+		log.Fatal(err)
+	}
+	l.Close()
+	defer conn.Close()
+	if err := dap.NewSession(conn, conn, prog).Serve(); err != nil {
+		log.Fatal(err)
+	}
+}
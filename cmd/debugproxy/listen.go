@@ -0,0 +1,201 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Serving clients that connect over TCP, as remote.Dial and remote.DialTLS
+// do.
+
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/debug/server"
+)
+
+// handshakeTimeout is how long a client has to send its token.
+var handshakeTimeout = 10 * time.Second
+
+// maxTokenLen is the longest token line a client can send.
+const maxTokenLen = 4096
+
+// listen listens on addr, and passes the connections of clients which
+// authenticate as the controller to sess, while it has none.  Clients
+// authenticating with the observer token are served by s as observers, until
+// the program exits.  Other clients are refused.
+func listen(addr string, s *server.Server, sess *session) error {
+	token, err := readToken(*tokenFileFlag)
+	if err != nil {
+		return err
+	}
+	observerToken, err := readToken(*observerFlag)
+	if err != nil {
+		return err
+	}
+	config, err := tlsConfig()
+	if err != nil {
+		return err
+	}
+	if token == nil && (config == nil || config.ClientCAs == nil) {
+		return errors.New("-listen needs -token-file or -tls-client-ca, to authenticate clients")
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	if config != nil {
+		l = tls.NewListener(l, config)
+	} else if host, _, _ := net.SplitHostPort(l.Addr().String()); !net.ParseIP(host).IsLoopback() {
+		log.Print("warning: without -tls-cert, the process's memory and the client's token are sent unencrypted")
+	}
+	log.Printf("listening on %s", l.Addr())
+	go accept(l, s, sess, token, observerToken)
+	return nil
+}
+
+// accept accepts clients on l, as described for listen, until l is closed.
+// Each client is authenticated in a goroutine of its own, so that one slow to
+// send its token doesn't hold up the others.
+func accept(l net.Listener, s *server.Server, sess *session, token, observerToken []byte) {
+	var closeOnce sync.Once
+	closed := make(chan struct{})
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			select {
+			case <-closed:
+			default:
+				log.Printf("accepting clients: %v", err)
+			}
+			return
+		}
+		go func() {
+			observer, err := authenticate(conn, token, observerToken, sess.busy)
+			if err != nil {
+				log.Printf("refused %s: %v", conn.RemoteAddr(), err)
+				conn.Close()
+				return
+			}
+			if observer {
+				log.Printf("serving observer %s", conn.RemoteAddr())
+				serve(s, conn, true)
+				log.Printf("observer %s disconnected", conn.RemoteAddr())
+				return
+			}
+			log.Printf("serving %s", conn.RemoteAddr())
+			sess.conns <- conn
+			if observerToken == nil && *graceFlag <= 0 {
+				// No one else can connect.
+				closeOnce.Do(func() {
+					close(closed)
+					l.Close()
+				})
+			}
+		}()
+	}
+}
+
+// readToken returns the token in the named file, or nil if the name is empty.
+func readToken(name string) ([]byte, error) {
+	if name == "" {
+		return nil, nil
+	}
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	token := bytes.TrimSpace(b)
+	if len(token) == 0 {
+		return nil, fmt.Errorf("token file %s is empty", name)
+	}
+	return token, nil
+}
+
+// tlsConfig returns the TLS configuration the flags give, or nil if they
+// don't ask for TLS.
+func tlsConfig() (*tls.Config, error) {
+	if *certFlag == "" {
+		if *keyFlag != "" || *clientCAFlag != "" {
+			return nil, errors.New("-tls-key and -tls-client-ca need -tls-cert")
+		}
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(*certFlag, *keyFlag)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if *clientCAFlag != "" {
+		pem, err := ioutil.ReadFile(*clientCAFlag)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", *clientCAFlag)
+		}
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// authenticate reads the token line the client sends first, and replies
+// "OK" if the client can be served, reporting whether it is an observer.  A
+// client sending observerToken is an observer.  Otherwise the client is the
+// controller, if it sends token, or token is nil, and there isn't one yet,
+// which haveController is called to check once the token is accepted.  A TLS
+// client's certificate is checked during the TLS handshake, when the line is
+// read.
+func authenticate(conn net.Conn, token, observerToken []byte, haveController func() bool) (observer bool, err error) {
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	line, err := readLine(conn)
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case observerToken != nil && subtle.ConstantTimeCompare(line, observerToken) == 1:
+		observer = true
+	case token != nil && subtle.ConstantTimeCompare(line, token) != 1:
+		io.WriteString(conn, "authentication failed\n")
+		return false, errors.New("wrong token")
+	case haveController():
+		io.WriteString(conn, "another client is controlling the process\n")
+		return false, errors.New("already serving a controlling client")
+	}
+	if _, err := io.WriteString(conn, "OK\n"); err != nil {
+		return false, err
+	}
+	return observer, conn.SetDeadline(time.Time{})
+}
+
+// readLine reads one line of text from r, without buffering, and returns it
+// without its trailing newline.
+func readLine(r io.Reader) ([]byte, error) {
+	var b []byte
+	var c [1]byte
+	for len(b) <= maxTokenLen {
+		if _, err := io.ReadFull(r, c[:]); err != nil {
+			return nil, err
+		}
+		if c[0] == '\n' {
+			return b, nil
+		}
+		b = append(b, c[0])
+	}
+	return nil, errors.New("token too long")
+}
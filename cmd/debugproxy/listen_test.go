@@ -0,0 +1,378 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sendToken writes line to conn, and returns what conn sends back until it
+// is closed, or, if hangUp is set, closes conn without reading anything.
+func sendToken(conn net.Conn, line string, hangUp bool) <-chan string {
+	reply := make(chan string, 1)
+	go func() {
+		io.WriteString(conn, line)
+		if hangUp {
+			conn.Close()
+			reply <- ""
+			return
+		}
+		b, _ := ioutil.ReadAll(conn)
+		reply <- string(b)
+	}()
+	return reply
+}
+
+func TestAuthenticate(t *testing.T) {
+	token, observerToken := []byte("secret"), []byte("watch")
+	tests := []struct {
+		name           string
+		token          []byte
+		haveController bool
+		line           string
+		reply          string
+		hangUp         bool
+		observer       bool
+		err            string
+	}{
+		{name: "controller", token: token, line: "secret\n", reply: "OK\n"},
+		{name: "observer", token: token, line: "watch\n", reply: "OK\n", observer: true},
+		{name: "observer with controller", token: token, haveController: true, line: "watch\n", reply: "OK\n", observer: true},
+		{name: "wrong token", token: token, line: "secrets\n", reply: "authentication failed\n", err: "wrong token"},
+		{name: "empty token", token: token, line: "\n", reply: "authentication failed\n", err: "wrong token"},
+		{name: "second controller", token: token, haveController: true, line: "secret\n", reply: "another client is controlling the process\n", err: "already serving a controlling client"},
+		{name: "no token needed", line: "anything\n", reply: "OK\n"},
+		{name: "token too long", token: token, line: strings.Repeat("s", maxTokenLen+1) + "\n", err: "token too long"},
+		{name: "no newline", token: token, line: "secret", hangUp: true, err: "EOF"},
+	}
+	for _, tt := range tests {
+		client, server := net.Pipe()
+		reply := sendToken(client, tt.line, tt.hangUp)
+		observer, err := authenticate(server, tt.token, observerToken, func() bool { return tt.haveController })
+		server.Close()
+		got := <-reply
+		client.Close()
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if observer != tt.observer {
+			t.Errorf("%s: observer = %t, want %t", tt.name, observer, tt.observer)
+		}
+		if got != tt.reply {
+			t.Errorf("%s: client got %q, want %q", tt.name, got, tt.reply)
+		}
+	}
+}
+
+func TestAuthenticateTimeout(t *testing.T) {
+	defer func(d time.Duration) { handshakeTimeout = d }(handshakeTimeout)
+	handshakeTimeout = 50 * time.Millisecond
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	done := make(chan error, 1)
+	go func() {
+		_, err := authenticate(server, []byte("secret"), nil, noController)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+			t.Errorf("client sending nothing: got error %v, want a timeout", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("authenticate didn't time out")
+	}
+}
+
+// noController is the haveController function for authenticate when there
+// is no controlling client.
+func noController() bool { return false }
+
+// readReply returns the line conn sends, failing the test if it doesn't send
+// one within a few seconds.
+func readReply(t *testing.T, conn net.Conn) string {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("reading reply: %v", err)
+	}
+	return line
+}
+
+func TestAcceptConcurrently(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	sess := newSession()
+	// With an observer token, the listener stays open for more clients.
+	go accept(l, nil, sess, []byte("secret"), []byte("watch"))
+
+	// A client that hasn't sent its token doesn't hold up another.
+	slow, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slow.Close()
+	fast, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fast.Close()
+	io.WriteString(fast, "secret\n")
+	if got := readReply(t, fast); got != "OK\n" {
+		t.Errorf("client got %q while another was connecting, want OK", got)
+	}
+	select {
+	case <-sess.conns:
+	case <-time.After(5 * time.Second):
+		t.Fatal("accepted controller not passed to the session")
+	}
+
+	// Whether there is a controller is checked once the token is accepted,
+	// not when the client connects.
+	sess.mu.Lock()
+	sess.current = fast
+	sess.mu.Unlock()
+	io.WriteString(slow, "secret\n")
+	if got, want := readReply(t, slow), "another client is controlling the process\n"; got != want {
+		t.Errorf("client connected before the controller was served got %q, want %q", got, want)
+	}
+}
+
+// setFlags sets the string flags to the values given, restoring them when
+// the function it returns is called.
+func setFlags(values map[*string]string) func() {
+	old := make(map[*string]string)
+	for f, v := range values {
+		old[f] = *f
+		*f = v
+	}
+	return func() {
+		for f, v := range old {
+			*f = v
+		}
+	}
+}
+
+func TestListenNeedsAuthentication(t *testing.T) {
+	dir, err := ioutil.TempDir("", "debugproxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pki := newTestPKI(t, dir)
+
+	tests := []struct {
+		name  string
+		flags map[*string]string
+		err   string
+	}{
+		{
+			name:  "no token or client CA",
+			flags: map[*string]string{},
+			err:   "-listen needs -token-file or -tls-client-ca",
+		},
+		{
+			name:  "TLS without client CA",
+			flags: map[*string]string{certFlag: pki.serverCert, keyFlag: pki.serverKey},
+			err:   "-listen needs -token-file or -tls-client-ca",
+		},
+		{
+			name:  "client CA without TLS",
+			flags: map[*string]string{clientCAFlag: pki.caCert},
+			err:   "need -tls-cert",
+		},
+		{
+			name:  "only an observer token",
+			flags: map[*string]string{observerFlag: pki.token},
+			err:   "-listen needs -token-file or -tls-client-ca",
+		},
+	}
+	for _, tt := range tests {
+		flags := map[*string]string{tokenFileFlag: "", observerFlag: "", certFlag: "", keyFlag: "", clientCAFlag: ""}
+		for f, v := range tt.flags {
+			flags[f] = v
+		}
+		restore := setFlags(flags)
+		err := listen("127.0.0.1:0", nil, newSession())
+		restore()
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestTLSClientCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "debugproxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pki := newTestPKI(t, dir)
+	defer setFlags(map[*string]string{certFlag: pki.serverCert, keyFlag: pki.serverKey, clientCAFlag: pki.caCert})()
+	config, err := tlsConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	results := make(chan error)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			_, err = authenticate(conn, nil, nil, noController)
+			conn.Close()
+			results <- err
+		}
+	}()
+
+	tests := []struct {
+		name       string
+		cert       *tls.Certificate
+		maxVersion uint16
+		ok         bool
+	}{
+		{"signed by the client CA", &pki.goodClient, 0, true},
+		{"signed by another CA", &pki.badClient, 0, false},
+		{"no certificate", nil, 0, false},
+		{"TLS 1.1", &pki.goodClient, tls.VersionTLS11, false},
+	}
+	for _, tt := range tests {
+		clientConfig := &tls.Config{RootCAs: pki.roots, ServerName: "127.0.0.1"}
+		if tt.maxVersion != 0 {
+			clientConfig.MinVersion = tls.VersionTLS10
+			clientConfig.MaxVersion = tt.maxVersion
+		}
+		if tt.cert != nil {
+			clientConfig.Certificates = []tls.Certificate{*tt.cert}
+		}
+		var reply string
+		conn, err := tls.Dial("tcp", l.Addr().String(), clientConfig)
+		if err == nil {
+			io.WriteString(conn, "\n")
+			reply, _ = bufio.NewReader(conn).ReadString('\n')
+			conn.Close()
+		}
+		serverErr := <-results
+		if tt.ok {
+			if err != nil || serverErr != nil || reply != "OK\n" {
+				t.Errorf("%s: got dial error %v, server error %v, reply %q; want OK", tt.name, err, serverErr, reply)
+			}
+		} else if serverErr == nil || reply == "OK\n" {
+			t.Errorf("%s: client accepted, with reply %q", tt.name, reply)
+		}
+	}
+}
+
+// A testPKI is the files and certificates for testing TLS connections: a
+// client CA, which also signs the server's certificate, a client certificate
+// it signed, and one signed by another authority.
+type testPKI struct {
+	caCert, serverCert, serverKey string // Names of PEM files.
+	token                         string // Name of a token file.
+	roots                         *x509.CertPool
+	goodClient, badClient         tls.Certificate
+}
+
+func newTestPKI(t *testing.T, dir string) *testPKI {
+	p := &testPKI{roots: x509.NewCertPool()}
+	ca, caKey := newTestCert(t, "client CA", nil, nil)
+	other, otherKey := newTestCert(t, "other CA", nil, nil)
+	p.roots.AddCert(ca)
+	server, serverKey := newTestCert(t, "127.0.0.1", ca, caKey)
+	good, goodKey := newTestCert(t, "good client", ca, caKey)
+	bad, badKey := newTestCert(t, "bad client", other, otherKey)
+	p.goodClient = tls.Certificate{Certificate: [][]byte{good.Raw}, PrivateKey: goodKey}
+	p.badClient = tls.Certificate{Certificate: [][]byte{bad.Raw}, PrivateKey: badKey}
+
+	write := func(name, typ string, der []byte) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	p.caCert = write("ca.pem", "CERTIFICATE", ca.Raw)
+	p.serverCert = write("server.pem", "CERTIFICATE", server.Raw)
+	der, err := x509.MarshalECPrivateKey(serverKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.serverKey = write("server-key.pem", "EC PRIVATE KEY", der)
+	p.token = filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(p.token, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// newTestCert returns a certificate for name signed by parent, or a
+// self-signed CA certificate if parent is nil, and its key.
+func newTestCert(t *testing.T, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if ip := net.ParseIP(name); ip != nil {
+		tmpl.IPAddresses = []net.IP{ip}
+	}
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
@@ -9,44 +9,120 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"log"
-	"net/rpc"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"golang.org/x/debug"
 	"golang.org/x/debug/server"
+	"golang.org/x/debug/server/protocol"
 )
 
 var (
 	textFlag = flag.String("text", "", "file name of binary being debugged")
+	logFlag  = flag.String("log", "", "log the server's operations at this level (debug, info, warn or error) and above to standard error")
+
+	debugDirFlag = flag.String("debug-file-directory", server.DebugFileDirectory, "look for separate debug files of executables without DWARF data in this directory")
+
+	cacheFlag       = flag.Int64("max-cache-bytes", 0, "limit the memory used for the process's unread output and recorded values to this many bytes (0 for no limit, keeping only the last 4MB of each output stream)")
+	readFlag        = flag.Int64("max-read-bytes", 0, "limit the client to reading this many bytes of the process's memory per minute (0 for no limit)")
+	breakpointsFlag = flag.Int("max-breakpoints", 0, "limit the client to this many breakpoints (0 for no limit)")
+
+	listenFlag    = flag.String("listen", "", "serve a client connecting to this TCP address, such as :8000, instead of standard input and output")
+	tokenFileFlag = flag.String("token-file", "", "with -listen, require clients to send the token in this file")
+	certFlag      = flag.String("tls-cert", "", "with -listen, use TLS, with the certificate in this PEM file")
+	keyFlag       = flag.String("tls-key", "", "the PEM file holding the private key for -tls-cert")
+	clientCAFlag  = flag.String("tls-client-ca", "", "with -tls-cert, require clients to present a certificate signed by an authority in this PEM file")
+	jsonFlag      = flag.Bool("jsonrpc", false, "serve clients with JSON-RPC 2.0, as described by server.Server.ServeJSONConn, rather than net/rpc's gob encoding")
+	observerFlag  = flag.String("observer-token-file", "", "with -listen, also serve clients sending the token in this file as observers, which can read the process but not control it")
+
+	graceFlag     = flag.Duration("grace", 0, "if the controlling client disconnects, keep the process this long for it to reconnect, with remote.Reconnect or by connecting to -listen again")
+	reconnectFlag = flag.String("reconnect", "", "connect standard input and output to the debugproxy with this session ID, for remote.Reconnect")
 )
 
 func main() {
 	log.SetFlags(0)
 	log.SetPrefix("debugproxy: ")
 	flag.Parse()
+	if *reconnectFlag != "" {
+		relay(*reconnectFlag)
+		return
+	}
 	if *textFlag == "" {
 		flag.Usage()
 		os.Exit(2)
 	}
+	if *logFlag != "" {
+		level, ok := parseLevel(*logFlag)
+		if !ok {
+			log.Printf("unknown log level %q", *logFlag)
+			flag.Usage()
+			os.Exit(2)
+		}
+		debug.SetLogger(debug.NewTextLogger(os.Stderr, level))
+	}
+	server.DebugFileDirectory = *debugDirFlag
 	s, err := server.New(*textFlag)
 	if err != nil {
 		fmt.Printf("server.New: %v\n", err)
 		os.Exit(2)
 	}
-	err = rpc.Register(s)
-	if err != nil {
-		fmt.Printf("rpc.Register: %v\n", err)
-		os.Exit(2)
-	}
-	fmt.Println("OK")
-	log.Print("starting server")
-	rpc.ServeConn(&rwc{
-		os.Stdin,
-		os.Stdout,
+	s.SetQuotas(server.Quotas{
+		CacheBytes:         *cacheFlag,
+		ReadBytesPerMinute: *readFlag,
+		Breakpoints:        *breakpointsFlag,
 	})
+	sess := newSession()
+	if *graceFlag > 0 {
+		// Outlive the connection's closing, rather than being killed by it.
+		signal.Ignore(syscall.SIGHUP, syscall.SIGPIPE)
+		l, err := sess.listenReconnect(s.SessionID())
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer l.Close()
+	}
+	if *listenFlag != "" {
+		if err := listen(*listenFlag, s, sess); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		fmt.Println("OK")
+		log.Print("starting server")
+		sess.conns <- &rwc{
+			os.Stdin,
+			os.Stdout,
+		}
+	}
+	sess.run(s)
+	// Kill the process or leave it running, as the client asked.
+	if err := s.Detach(&protocol.DetachRequest{}, &protocol.DetachResponse{}); err != nil {
+		log.Printf("detaching: %v", err)
+	}
 	log.Print("server finished")
 }
 
+// serve serves a client, with the encoding -jsonrpc chooses.
+func serve(s *server.Server, conn io.ReadWriteCloser, observer bool) {
+	if *jsonFlag {
+		s.ServeJSONConn(conn, observer)
+	} else {
+		s.ServeConn(conn, observer)
+	}
+}
+
+// parseLevel returns the log level with the given name.
+func parseLevel(name string) (debug.Level, bool) {
+	for l := debug.LevelDebug; l <= debug.LevelError; l++ {
+		if l.String() == name {
+			return l, true
+		}
+	}
+	return 0, false
+}
+
 // rwc creates a single io.ReadWriteCloser from a read side and a write side.
 // It allows us to do RPC using standard in and standard out.
 type rwc struct {
@@ -0,0 +1,162 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Serving the controlling client, and letting it reconnect if it loses its
+// connection.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/debug/server"
+)
+
+// A session passes the connections of controlling clients to run, which
+// serves them one at a time.
+type session struct {
+	conns chan io.ReadWriteCloser // Connections of new controlling clients.
+
+	mu      sync.Mutex
+	current io.ReadWriteCloser // The controlling client's connection, while it is served.
+}
+
+func newSession() *session {
+	return &session{conns: make(chan io.ReadWriteCloser, 1)}
+}
+
+// busy reports whether a controlling client is being served.
+func (ss *session) busy() bool {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	return ss.current != nil
+}
+
+// shutdownWait is how long run waits, after a client calls Shutdown, for the
+// client to receive the reply and close its connection.
+const shutdownWait = time.Second
+
+// run serves the controlling clients until one disconnects, and then, if
+// -grace is set and the process is still alive, waits that long for another
+// to connect.  After a client calls Shutdown, it returns once the client
+// disconnects, or shutdownWait later if it doesn't.
+func (ss *session) run(s *server.Server) {
+	ended := make(chan io.ReadWriteCloser, 1)
+	done := s.Done()
+	shutdown := false
+	var timeout <-chan time.Time
+	for {
+		select {
+		case <-done:
+			log.Print("client shut the server down")
+			done = nil
+			shutdown = true
+			timeout = time.After(shutdownWait)
+		case conn := <-ss.conns:
+			ss.mu.Lock()
+			busy := ss.current != nil || shutdown
+			if !busy {
+				ss.current = conn
+			}
+			ss.mu.Unlock()
+			if busy {
+				conn.Close()
+				continue
+			}
+			timeout = nil
+			go func() {
+				serve(s, conn, false)
+				ended <- conn
+			}()
+		case conn := <-ended:
+			ss.mu.Lock()
+			current := ss.current == conn
+			if current {
+				ss.current = nil
+			}
+			ss.mu.Unlock()
+			if !current {
+				// A connection replaced by a reconnecting client.
+				continue
+			}
+			if shutdown || *graceFlag <= 0 || !s.HasProcess() {
+				return
+			}
+			log.Printf("client disconnected; keeping the process for %v for it to reconnect", *graceFlag)
+			timeout = time.After(*graceFlag)
+		case <-timeout:
+			if !shutdown {
+				log.Print("no client reconnected")
+			}
+			return
+		}
+	}
+}
+
+// listenReconnect accepts reconnecting clients on a Unix socket named after
+// the session ID, which only the user running the debugproxy can use.  A
+// reconnecting client replaces the current one, whose connection is likely to
+// be dead without the debugproxy knowing it yet.
+func (ss *session) listenReconnect(id string) (net.Listener, error) {
+	mask := umask(0077)
+	l, err := net.Listen("unix", reconnectPath(id))
+	umask(mask)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("session %s", id)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			log.Print("client reconnected")
+			ss.mu.Lock()
+			old := ss.current
+			ss.current = nil
+			ss.mu.Unlock()
+			if old != nil {
+				old.Close()
+			}
+			ss.conns <- conn
+		}
+	}()
+	return l, nil
+}
+
+// reconnectPath returns the name of the socket on which the debugproxy with
+// the given session ID accepts reconnecting clients.
+func reconnectPath(id string) string {
+	return filepath.Join(os.TempDir(), "debugproxy-"+id)
+}
+
+// relay connects standard input and output to the debugproxy with the given
+// session ID, for a client reconnecting over SSH.  Like a debugproxy, it
+// prints "OK" once it is ready.
+func relay(id string) {
+	if id == "" || strings.Trim(id, "0123456789abcdef") != "" {
+		fmt.Printf("invalid session ID %q\n", id)
+		os.Exit(2)
+	}
+	conn, err := net.Dial("unix", reconnectPath(id))
+	if err != nil {
+		fmt.Printf("session %s: %v\n", id, err)
+		os.Exit(1)
+	}
+	fmt.Println("OK")
+	go func() {
+		io.Copy(conn, os.Stdin)
+		conn.Close()
+	}()
+	io.Copy(os.Stdout, conn)
+}
@@ -0,0 +1,188 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"net/rpc"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/debug/server"
+	"golang.org/x/debug/server/protocol"
+)
+
+// buildSessionTestProgram builds a program which does nothing, in dir,
+// returning the name of the executable.
+func buildSessionTestProgram(t *testing.T, dir string) string {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+	src := filepath.Join(dir, "main.go")
+	if err := ioutil.WriteFile(src, []byte("package main\n\nfunc main() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	exe := filepath.Join(dir, "nothing")
+	cmd := exec.Command("go", "build", "-o", exe, src)
+	cmd.Env = append(os.Environ(), "GO111MODULE=off")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("building test program: %v\n%s", err, out)
+	}
+	return exe
+}
+
+func TestReconnect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "debugproxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := server.New(buildSessionTestProgram(t, dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Kill(&protocol.KillRequest{}, &protocol.KillResponse{})
+	defer func(d time.Duration) { *graceFlag = d }(*graceFlag)
+	*graceFlag = time.Second
+
+	sess := newSession()
+	l, err := sess.listenReconnect(s.SessionID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	client, conn := net.Pipe()
+	sess.conns <- conn
+	ran := make(chan bool)
+	go func() {
+		sess.run(s)
+		close(ran)
+	}()
+
+	c := rpc.NewClient(client)
+	if err := c.Call("Server.Run", &protocol.RunRequest{}, &protocol.RunResponse{}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	var bp protocol.BreakpointResponse
+	if err := c.Call("Server.BreakpointAtFunction", &protocol.BreakpointAtFunctionRequest{Function: "main.main"}, &bp); err != nil {
+		t.Fatalf("BreakpointAtFunction: %v", err)
+	}
+
+	// reconnect connects to the session's socket, and checks that the
+	// process and its breakpoint are still there.
+	reconnect := func(name string) *rpc.Client {
+		conn, err := net.Dial("unix", reconnectPath(s.SessionID()))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		c := rpc.NewClient(conn)
+		var list protocol.ListBreakpointsResponse
+		if err := c.Call("Server.ListBreakpoints", &protocol.ListBreakpointsRequest{}, &list); err != nil {
+			t.Fatalf("%s: ListBreakpoints: %v", name, err)
+		}
+		if len(list.Breakpoints) != 1 || list.Breakpoints[0].ID != bp.Breakpoint.ID {
+			t.Errorf("%s: got breakpoints %+v, want breakpoint %d", name, list.Breakpoints, bp.Breakpoint.ID)
+		}
+		if !s.HasProcess() {
+			t.Errorf("%s: the server has no process", name)
+		}
+		return c
+	}
+
+	// A client reconnecting after losing its connection.
+	c.Close()
+	time.Sleep(100 * time.Millisecond)
+	c = reconnect("reconnecting after disconnecting")
+
+	// A client reconnecting while its old connection is still served
+	// replaces it.
+	c2 := reconnect("reconnecting over the old connection")
+	if err := c.Call("Server.ListBreakpoints", &protocol.ListBreakpointsRequest{}, &protocol.ListBreakpointsResponse{}); err == nil {
+		t.Errorf("the replaced connection is still served")
+	}
+	c.Close()
+
+	// Once the grace period passes without a client reconnecting, run
+	// returns.
+	start := time.Now()
+	c2.Close()
+	select {
+	case <-ran:
+		if d := time.Since(start); d < *graceFlag/2 {
+			t.Errorf("run returned %v after the client disconnected, want about %v", d, *graceFlag)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("run didn't return after the grace period")
+	}
+	if !s.HasProcess() {
+		t.Errorf("the process didn't outlive the session")
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	dir, err := ioutil.TempDir("", "debugproxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	exe := buildSessionTestProgram(t, dir)
+	s, err := server.New(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Kill(&protocol.KillRequest{}, &protocol.KillResponse{})
+	defer func(d time.Duration) { *graceFlag = d }(*graceFlag)
+	*graceFlag = time.Minute
+
+	sess := newSession()
+	client, conn := net.Pipe()
+	sess.conns <- conn
+	ran := make(chan bool)
+	go func() {
+		sess.run(s)
+		close(ran)
+	}()
+	c := rpc.NewClient(client)
+	defer c.Close()
+	if err := c.Call("Server.Run", &protocol.RunRequest{}, &protocol.RunResponse{}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	var open protocol.OpenResponse
+	if err := c.Call("Server.Open", &protocol.OpenRequest{Name: exe, Mode: "r"}, &open); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if err := c.Call("Server.Shutdown", &protocol.ShutdownRequest{Kill: true}, &protocol.ShutdownResponse{}); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	select {
+	case <-s.Done():
+	default:
+		t.Error("the server isn't done after Shutdown")
+	}
+	if s.HasProcess() {
+		t.Error("the process outlived Shutdown")
+	}
+	if err := s.ReadAt(&protocol.ReadAtRequest{FD: open.FD, Len: 4}, &protocol.ReadAtResponse{}); err == nil {
+		t.Error("the file opened before Shutdown can still be read")
+	}
+
+	// Another client isn't served, and despite -grace, run returns as soon
+	// as the client disconnects.
+	other, conn := net.Pipe()
+	sess.conns <- conn
+	if _, err := other.Read(make([]byte, 1)); err == nil {
+		t.Error("a client connecting after Shutdown was served")
+	}
+	c.Close()
+	select {
+	case <-ran:
+	case <-time.After(10 * time.Second):
+		t.Fatal("run didn't return after Shutdown")
+	}
+}
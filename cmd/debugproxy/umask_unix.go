@@ -0,0 +1,15 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build unix
+
+package main
+
+import "syscall"
+
+// umask sets the mask of permissions withheld from the files the process
+// creates, and returns the previous one.
+func umask(mask int) int {
+	return syscall.Umask(mask)
+}
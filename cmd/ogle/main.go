@@ -0,0 +1,734 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// ogle is an interactive debugger for the target binary.  It debugs the
+// binary locally, or with -remote runs debugproxy on another host using SSH,
+// or with -addr connects to a debugproxy started with -listen.
+//
+// It reads commands from standard input:
+//
+//	run [args...]         start the program, stopping at the first breakpoint
+//	break func|file:line|*addr
+//	                      set a breakpoint
+//	delete id...          delete breakpoints
+//	breakpoints           list breakpoints
+//	commands id [cmd; ...]
+//	                      set expressions to print when breakpoint id is
+//	                      reached, optionally ending with continue
+//	continue              resume the program
+//	step                  run to the next source line, entering calls
+//	stepi                 execute one machine instruction
+//	print expr            evaluate an expression
+//	list [file:line]      print the source around a line, or where the
+//	                      program stopped
+//	bt [n]                print the stack
+//	frame n               select a frame for print
+//	locals [n]            print the local variables of a frame
+//	goroutines            list the goroutines
+//	kill                  kill the program
+//	quit                  exit, killing the program
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/local"
+	"golang.org/x/debug/remote"
+)
+
+var (
+	textFlag      = flag.String("text", "", "file name of binary being debugged")
+	remoteFlag    = flag.String("remote", "", "debug the binary on this host, running debugproxy there using SSH")
+	addrFlag      = flag.String("addr", "", "connect to the debugproxy listening on this TCP address")
+	tokenFileFlag = flag.String("token-file", "", "with -addr, authenticate with the token in this file")
+)
+
+// maxStepInstructions limits how many instructions step executes looking for
+// the next line.
+const maxStepInstructions = 100000
+
+// listContext is how many lines list shows on each side of the line.
+const listContext = 5
+
+// printDepth is how deeply print and locals show values nested in others.
+const printDepth = 3
+
+// maxPrintElements is how many elements of arrays, slices and maps are
+// shown.
+const maxPrintElements = 10
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("ogle: ")
+	flag.Parse()
+	if *textFlag == "" && *addrFlag == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	var (
+		prog debug.Program
+		err  error
+	)
+	switch {
+	case *addrFlag != "":
+		var token []byte
+		if *tokenFileFlag != "" {
+			if token, err = ioutil.ReadFile(*tokenFileFlag); err != nil {
+				log.Fatal(err)
+			}
+		}
+		prog, err = remote.Dial(*addrFlag, strings.TrimSpace(string(token)))
+	case *remoteFlag != "":
+		prog, err = remote.New(*remoteFlag, *textFlag)
+	default:
+		prog, err = local.New(*textFlag)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	d := &debugger{prog: prog, out: os.Stdout}
+	d.repl(os.Stdin)
+	prog.Kill()
+}
+
+// A debugger runs the commands it reads against a program.
+type debugger struct {
+	prog    debug.Program
+	out     io.Writer
+	started bool // Whether the program's output is being copied.
+	running bool // Whether the program has been run.
+	// pending holds the locations of breakpoints set before the program was
+	// run, which are set when it starts.
+	pending []string
+}
+
+// commands are the debugger's commands, with their abbreviations.
+var commands = map[string]func(d *debugger, args []string, line string) error{
+	"run":         (*debugger).run,
+	"r":           (*debugger).run,
+	"break":       (*debugger).setBreakpoint,
+	"b":           (*debugger).setBreakpoint,
+	"delete":      (*debugger).deleteBreakpoints,
+	"breakpoints": (*debugger).listBreakpoints,
+	"commands":    (*debugger).setCommands,
+	"continue":    (*debugger).resume,
+	"c":           (*debugger).resume,
+	"step":        (*debugger).step,
+	"s":           (*debugger).step,
+	"stepi":       (*debugger).stepInstruction,
+	"si":          (*debugger).stepInstruction,
+	"print":       (*debugger).print,
+	"p":           (*debugger).print,
+	"list":        (*debugger).list,
+	"l":           (*debugger).list,
+	"bt":          (*debugger).backtrace,
+	"frame":       (*debugger).frame,
+	"locals":      (*debugger).locals,
+	"goroutines":  (*debugger).goroutines,
+	"threads":     (*debugger).threads,
+	"thread":      (*debugger).thread,
+	"libs":        (*debugger).libs,
+	"kill":        (*debugger).kill,
+	"help":        (*debugger).help,
+}
+
+// repl reads and runs commands from r until it ends or the quit command.
+func (d *debugger) repl(r io.Reader) {
+	in := bufio.NewScanner(r)
+	for {
+		fmt.Fprint(d.out, "(ogle) ")
+		if !in.Scan() {
+			fmt.Fprintln(d.out)
+			return
+		}
+		line := strings.TrimSpace(in.Text())
+		args := strings.Fields(line)
+		if len(args) == 0 {
+			continue
+		}
+		if args[0] == "quit" || args[0] == "q" {
+			return
+		}
+		cmd, ok := commands[args[0]]
+		if !ok {
+			fmt.Fprintf(d.out, "unknown command %q; try help\n", args[0])
+			continue
+		}
+		rest := strings.TrimSpace(strings.TrimPrefix(line, args[0]))
+		if err := cmd(d, args[1:], rest); err != nil {
+			fmt.Fprintln(d.out, err)
+		}
+	}
+}
+
+func (d *debugger) help(args []string, line string) error {
+	fmt.Fprintln(d.out, `commands:
+  run [args...], break func|file:line|*addr, delete id..., breakpoints,
+  commands id [cmd; ...], continue, step, stepi, print expr, list [file:line],
+  bt [n], frame n, locals [n], goroutines, threads, thread id, libs, kill, quit`)
+	return nil
+}
+
+func (d *debugger) run(args []string, line string) error {
+	if !d.started {
+		// The output readers last across runs.
+		d.started = true
+		go io.Copy(os.Stdout, d.prog.Stdout())
+		go io.Copy(os.Stderr, d.prog.Stderr())
+		go d.printEvents()
+	}
+	status, err := d.prog.Run(args...)
+	if err != nil {
+		return err
+	}
+	d.running = true
+	if len(status.Unresolved) > 0 {
+		d.reportUnresolved(status.Unresolved)
+	}
+	for _, where := range d.pending {
+		if err := d.breakpoint(where); err != nil {
+			fmt.Fprintln(d.out, err)
+		}
+	}
+	d.pending = nil
+	return d.stopped(d.prog.Resume())
+}
+
+func (d *debugger) resume(args []string, line string) error {
+	return d.stopped(d.prog.Resume())
+}
+
+func (d *debugger) stepInstruction(args []string, line string) error {
+	return d.stopped(d.prog.StepInstruction())
+}
+
+// step executes instructions until the program reaches a different source
+// line outside the runtime, or stops for another reason.
+func (d *debugger) step(args []string, line string) error {
+	start, err := d.prog.Frames(1)
+	if err != nil {
+		return err
+	}
+	if len(start) == 0 {
+		return fmt.Errorf("step: no stack")
+	}
+	for i := 0; i < maxStepInstructions; i++ {
+		status, err := d.prog.StepInstruction()
+		if err != nil || status.Reason != "step" {
+			return d.stopped(status, err)
+		}
+		frames, err := d.prog.Frames(1)
+		if err != nil || len(frames) == 0 {
+			continue
+		}
+		f := frames[0]
+		if f.Line != 0 && f.Kind != "runtime" && (f.File != start[0].File || f.Line != start[0].Line) {
+			return d.stopped(status, nil)
+		}
+	}
+	return fmt.Errorf("step: no new line after %d instructions", maxStepInstructions)
+}
+
+// stopped reports where the program stopped, or why it didn't.
+func (d *debugger) stopped(status debug.Status, err error) error {
+	if e, ok := err.(*debug.ProcessExited); ok {
+		if e.Signal != "" {
+			fmt.Fprintf(d.out, "process killed by %s\n", e.Signal)
+		} else {
+			fmt.Fprintf(d.out, "process exited with status %d\n", e.ExitStatus)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	reason := status.Reason
+	if status.Signal != "" {
+		reason += " " + status.Signal
+	}
+	for _, id := range status.Breakpoints {
+		reason += fmt.Sprintf(" %d", id)
+	}
+	for _, id := range status.Watchpoints {
+		reason += fmt.Sprintf(" %d", id)
+	}
+	if status.NewThread != 0 {
+		reason += fmt.Sprintf(" %d", status.NewThread)
+	}
+	if status.Goroutine != 0 {
+		reason += fmt.Sprintf(", goroutine %d", status.Goroutine)
+	}
+	where := fmt.Sprintf("%#x", status.PC)
+	if frames, err := d.prog.Frames(1); err == nil && len(frames) > 0 {
+		where = frameLocation(frames[0])
+	}
+	fmt.Fprintf(d.out, "stopped (%s) in %s\n", reason, where)
+	if status.Fatal != "" {
+		fmt.Fprintln(d.out, status.Fatal)
+	}
+	for _, r := range status.Commands {
+		d.printCommandResults(r)
+	}
+	return nil
+}
+
+// printEvents prints the results of the commands of breakpoints at which the
+// program carried on, and the pending breakpoints that are found.
+func (d *debugger) printEvents() {
+	for e := range d.prog.Events() {
+		switch e.Kind {
+		case "commands":
+			d.printCommandResults(*e.Commands)
+		case "resolved":
+			fmt.Fprintf(d.out, "breakpoint %d resolved at %s\n", e.Breakpoint.ID, breakpointLocation(*e.Breakpoint))
+		}
+	}
+}
+
+func (d *debugger) printCommandResults(r debug.CommandResults) {
+	for _, v := range r.Values {
+		if v.Err != "" {
+			fmt.Fprintf(d.out, "[%d] %s: %s\n", r.Breakpoint, v.Expression, v.Err)
+		} else {
+			fmt.Fprintf(d.out, "[%d] %s = %s\n", r.Breakpoint, v.Expression, d.format(v.Value, printDepth))
+		}
+	}
+}
+
+func (d *debugger) setBreakpoint(args []string, line string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: break func|file:line|*addr")
+	}
+	if !d.running {
+		d.pending = append(d.pending, args[0])
+		fmt.Fprintf(d.out, "breakpoint at %s will be set when the program runs\n", args[0])
+		return nil
+	}
+	return d.breakpoint(args[0])
+}
+
+// breakpoint sets a breakpoint at where, a function, file:line or *address.
+func (d *debugger) breakpoint(where string) error {
+	var (
+		bp  debug.Breakpoint
+		err error
+	)
+	if strings.HasPrefix(where, "*") {
+		addr, perr := strconv.ParseUint(where[1:], 0, 64)
+		if perr != nil {
+			return fmt.Errorf("invalid address %q", where[1:])
+		}
+		bp, err = d.prog.Breakpoint(addr)
+	} else if i := strings.LastIndex(where, ":"); i >= 0 {
+		n, perr := strconv.ParseUint(where[i+1:], 10, 64)
+		if perr != nil {
+			return fmt.Errorf("invalid line %q", where[i+1:])
+		}
+		bp, err = d.prog.BreakpointAtLine(where[:i], n)
+	} else {
+		// A function that isn't found may be in a shared object the
+		// program hasn't loaded yet.
+		bp, err = d.prog.PendingBreakpointAtFunction(where)
+	}
+	if err != nil {
+		return err
+	}
+	if bp.Pending {
+		fmt.Fprintf(d.out, "breakpoint %d at %s is pending: %s\n", bp.ID, where, bp.Err)
+		return nil
+	}
+	fmt.Fprintf(d.out, "breakpoint %d at %s\n", bp.ID, breakpointLocation(bp))
+	d.printBreakpointLocations(bp)
+	return nil
+}
+
+func (d *debugger) deleteBreakpoints(args []string, line string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: delete id...")
+	}
+	var ids []uint64
+	for _, a := range args {
+		id, err := strconv.ParseUint(a, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid breakpoint ID %q", a)
+		}
+		ids = append(ids, id)
+	}
+	return d.prog.DeleteBreakpoints(ids)
+}
+
+func (d *debugger) listBreakpoints(args []string, line string) error {
+	bps, err := d.prog.ListBreakpoints()
+	if err != nil {
+		return err
+	}
+	for _, bp := range bps {
+		state := ""
+		if !bp.Enabled {
+			state = " (disabled)"
+		}
+		if bp.Err != "" {
+			state += " (pending: " + bp.Err + ")"
+		}
+		fmt.Fprintf(d.out, "%d\t%s%s\n", bp.ID, breakpointLocation(bp), state)
+		d.printBreakpointLocations(bp)
+	}
+	return nil
+}
+
+// reportUnresolved says which of the breakpoints with the given IDs
+// couldn't be found in the process just started, and so are pending, and
+// why.
+func (d *debugger) reportUnresolved(ids []uint64) {
+	bps, err := d.prog.ListBreakpoints()
+	if err != nil {
+		fmt.Fprintln(d.out, err)
+		return
+	}
+	for _, id := range ids {
+		for _, bp := range bps {
+			if bp.ID == id {
+				fmt.Fprintf(d.out, "breakpoint %d is pending: %s\n", id, bp.Err)
+			}
+		}
+	}
+}
+
+func (d *debugger) setCommands(args []string, line string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: commands id [cmd; ...]")
+	}
+	id, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid breakpoint ID %q", args[0])
+	}
+	var cmds []string
+	for _, c := range strings.Split(strings.TrimPrefix(line, args[0]), ";") {
+		if c = strings.TrimSpace(c); c != "" {
+			cmds = append(cmds, c)
+		}
+	}
+	return d.prog.SetBreakpointCommands(id, cmds)
+}
+
+func (d *debugger) print(args []string, line string) error {
+	if line == "" {
+		return fmt.Errorf("usage: print expr")
+	}
+	v, _, err := d.prog.Evaluate(line)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(d.out, d.format(v, printDepth))
+	return nil
+}
+
+func (d *debugger) list(args []string, line string) error {
+	var (
+		file string
+		n    uint64
+	)
+	switch len(args) {
+	case 0:
+		frames, err := d.prog.Frames(1)
+		if err != nil {
+			return err
+		}
+		if len(frames) == 0 || frames[0].File == "" {
+			return fmt.Errorf("list: no source for the current location")
+		}
+		file, n = frames[0].File, frames[0].Line
+	case 1:
+		i := strings.LastIndex(args[0], ":")
+		if i < 0 {
+			return fmt.Errorf("usage: list [file:line]")
+		}
+		var err error
+		if n, err = strconv.ParseUint(args[0][i+1:], 10, 64); err != nil {
+			return fmt.Errorf("invalid line %q", args[0][i+1:])
+		}
+		file = args[0][:i]
+	default:
+		return fmt.Errorf("usage: list [file:line]")
+	}
+	start := uint64(1)
+	if n > listContext {
+		start = n - listContext
+	}
+	src, err := d.prog.Source(file, start, n+listContext)
+	if err != nil {
+		return err
+	}
+	for _, l := range src.Lines {
+		mark := "  "
+		if l.Line == n {
+			mark = "=>"
+		}
+		fmt.Fprintf(d.out, "%s %4d\t%s\n", mark, l.Line, l.Text)
+	}
+	return nil
+}
+
+func (d *debugger) backtrace(args []string, line string) error {
+	n := 50
+	if len(args) > 0 {
+		var err error
+		if n, err = strconv.Atoi(args[0]); err != nil || n <= 0 {
+			return fmt.Errorf("invalid frame count %q", args[0])
+		}
+	}
+	frames, err := d.prog.Frames(n)
+	if err != nil {
+		return err
+	}
+	for i, f := range frames {
+		var params []string
+		for _, p := range f.Params {
+			params = append(params, p.Name+"="+d.formatVar(p.Var, 2))
+		}
+		loc := fmt.Sprintf("at %s:%d", f.File, f.Line)
+		if f.File == "" {
+			// Foreign code without debugging information.
+			loc = fmt.Sprintf("(%#x)", f.PC)
+		}
+		fmt.Fprintf(d.out, "#%d %s(%s) %s\n", i, f.Function, strings.Join(params, ", "), loc)
+	}
+	return nil
+}
+
+func (d *debugger) frame(args []string, line string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: frame n")
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid frame %q", args[0])
+	}
+	return d.prog.SelectFrame(n)
+}
+
+func (d *debugger) locals(args []string, line string) error {
+	n := 0
+	if len(args) > 0 {
+		var err error
+		if n, err = strconv.Atoi(args[0]); err != nil {
+			return fmt.Errorf("invalid frame %q", args[0])
+		}
+	}
+	vars, err := d.prog.LocalVariables(n)
+	if err != nil {
+		return err
+	}
+	for _, v := range vars {
+		fmt.Fprintf(d.out, "%s = %s\n", v.Name, d.formatVar(v.Var, printDepth))
+	}
+	return nil
+}
+
+func (d *debugger) goroutines(args []string, line string) error {
+	gs, err := d.prog.Goroutines()
+	if err != nil {
+		return err
+	}
+	for _, g := range gs {
+		fmt.Fprintf(d.out, "%d\t%s\t%s", g.ID, g.StatusString, g.Function)
+		if len(g.Labels) > 0 {
+			var labels []string
+			for k, v := range g.Labels {
+				labels = append(labels, k+"="+v)
+			}
+			sort.Strings(labels)
+			fmt.Fprintf(d.out, "\t{%s}", strings.Join(labels, ", "))
+		}
+		fmt.Fprintln(d.out)
+	}
+	return nil
+}
+
+func (d *debugger) threads(args []string, line string) error {
+	ts, err := d.prog.Threads()
+	if err != nil {
+		return err
+	}
+	for _, t := range ts {
+		mark := " "
+		if t.Selected {
+			mark = "*"
+		}
+		fmt.Fprintf(d.out, "%s %d\t%s\t%#x\t%s\n", mark, t.ID, t.State, t.PC, t.Function)
+	}
+	return nil
+}
+
+func (d *debugger) thread(args []string, line string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: thread id")
+	}
+	tid, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid thread %q", args[0])
+	}
+	return d.prog.SelectThread(tid)
+}
+
+func (d *debugger) libs(args []string, line string) error {
+	objs, err := d.prog.SharedObjects()
+	if err != nil {
+		return err
+	}
+	for _, o := range objs {
+		info := ""
+		if !o.DWARF {
+			info = " (no debugging information)"
+		}
+		fmt.Fprintf(d.out, "%#x-%#x\t%s%s\n", o.Start, o.End, o.Path, info)
+	}
+	return nil
+}
+
+func (d *debugger) kill(args []string, line string) error {
+	_, err := d.prog.Kill()
+	return err
+}
+
+// formatVar formats the value of v, showing values nested in it to the
+// given depth.
+func (d *debugger) formatVar(v debug.Var, depth int) string {
+	if depth <= 0 {
+		return "..."
+	}
+	val, err := d.prog.Value(v)
+	if err != nil {
+		return "<" + err.Error() + ">"
+	}
+	return d.format(val, depth)
+}
+
+// format formats v, showing values nested in it to the given depth.
+func (d *debugger) format(v debug.Value, depth int) string {
+	elements := func(a debug.Array) string {
+		var elems []string
+		for i := uint64(0); i < a.Len() && i < maxPrintElements; i++ {
+			elems = append(elems, d.formatVar(a.Element(i), depth-1))
+		}
+		if a.Len() > maxPrintElements {
+			elems = append(elems, "...")
+		}
+		return "[" + strings.Join(elems, ", ") + "]"
+	}
+	fields := func(s debug.Struct) string {
+		var fs []string
+		for _, f := range s.Fields {
+			fs = append(fs, f.Name+": "+d.formatVar(f.Var, depth-1))
+		}
+		return "{" + strings.Join(fs, ", ") + "}"
+	}
+	switch v := v.(type) {
+	case debug.String:
+		s := strconv.Quote(v.String)
+		if uint64(len(v.String)) < v.Length {
+			s += "..."
+		}
+		return s
+	case debug.Pointer:
+		if v.Address == 0 {
+			return "nil"
+		}
+		return fmt.Sprintf("%#x", v.Address)
+	case debug.Array:
+		return elements(v)
+	case debug.Slice:
+		return fmt.Sprintf("len=%d cap=%d %s", v.Length, v.Capacity, elements(v.Array))
+	case debug.Struct:
+		return fields(v)
+	case debug.Map:
+		entries, err := d.prog.MapElements(v, 0, maxPrintElements)
+		if err != nil {
+			return fmt.Sprintf("map[len=%d]", v.Length)
+		}
+		var es []string
+		for _, e := range entries {
+			es = append(es, d.formatVar(e.Key, depth-1)+": "+d.formatVar(e.Value, depth-1))
+		}
+		if v.Length > maxPrintElements {
+			es = append(es, "...")
+		}
+		return "map[" + strings.Join(es, ", ") + "]"
+	case debug.Channel:
+		return fmt.Sprintf("chan len=%d cap=%d", v.Length, v.Capacity)
+	case debug.Func:
+		switch {
+		case v.Address == 0:
+			return "nil"
+		case v.Name != "":
+			return v.Name
+		}
+		return fmt.Sprintf("func @%#x", v.Entry)
+	case debug.Interface:
+		switch {
+		case v.Data == 0 && v.TypeName == "":
+			return "nil"
+		case v.TypeID == 0:
+			return fmt.Sprintf("%s(%#x)", v.TypeName, v.Data)
+		}
+		return v.TypeName + "(" + d.formatVar(v.Value, depth) + ")"
+	case debug.Mutex:
+		state := "unlocked"
+		if v.Locked {
+			state = fmt.Sprintf("locked, waiters %v", v.Waiters)
+		}
+		return "sync.Mutex(" + state + ")"
+	case debug.RWMutex:
+		return fmt.Sprintf("sync.RWMutex(readers %d, writer %v, waiters %v %v %v)", v.Readers, v.Writer, v.W.Waiters, v.WriterWaiters, v.ReaderWaiters)
+	case debug.WaitGroup:
+		return fmt.Sprintf("sync.WaitGroup(counter %d, waiters %v)", v.Counter, v.Waiters)
+	}
+	return fmt.Sprint(v)
+}
+
+// frameLocation describes where a frame is executing.
+func frameLocation(f debug.Frame) string {
+	if f.File == "" {
+		return fmt.Sprintf("%s (%#x)", f.Function, f.PC)
+	}
+	return fmt.Sprintf("%s at %s:%d", f.Function, f.File, f.Line)
+}
+
+// printBreakpointLocations prints where each address of bp is, if it has
+// more than one.
+func (d *debugger) printBreakpointLocations(bp debug.Breakpoint) {
+	if len(bp.Locations) < 2 {
+		return
+	}
+	for _, loc := range bp.Locations {
+		fmt.Fprintf(d.out, "\t%#x in %s", loc.PC, loc.Function)
+		if loc.InlinedInto != "" {
+			fmt.Fprintf(d.out, " (inlined into %s)", loc.InlinedInto)
+		}
+		fmt.Fprintln(d.out)
+	}
+}
+
+// breakpointLocation describes where a breakpoint is set.
+func breakpointLocation(bp debug.Breakpoint) string {
+	switch {
+	case bp.File != "":
+		return fmt.Sprintf("%s at %s:%d", bp.Function, bp.File, bp.Line)
+	case len(bp.PCs) > 0:
+		return fmt.Sprintf("%#x", bp.PCs[0])
+	case bp.Function != "":
+		return bp.Function
+	}
+	return "?"
+}
@@ -0,0 +1,104 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/debug/local"
+)
+
+// testProgram is debugged by TestREPL.
+const testProgram = `package main
+
+type point struct{ X, Y int }
+
+//go:noinline
+func scale(p point, k int) point {
+	q := point{p.X * k, p.Y * k}
+	return q
+}
+
+func main() {
+	p := scale(point{1, 2}, 3)
+	println(p.X, p.Y)
+}
+`
+
+func TestREPL(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+	dir, err := ioutil.TempDir("", "ogle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "main.go")
+	if err := ioutil.WriteFile(src, []byte(testProgram), 0644); err != nil {
+		t.Fatal(err)
+	}
+	exe := filepath.Join(dir, "scale")
+	cmd := exec.Command("go", "build", "-gcflags=-N -l", "-o", exe, src)
+	cmd.Env = append(os.Environ(), "GO111MODULE=off")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("building test program: %v\n%s", err, out)
+	}
+	prog, err := local.New(exe)
+	if err != nil {
+		t.Fatal("local.New:", err)
+	}
+	defer prog.Kill()
+
+	var out bytes.Buffer
+	d := &debugger{prog: prog, out: &out}
+	d.repl(strings.NewReader(`break main.scale
+run
+bt 2
+print k
+print p.Y + 1
+step
+step
+print q
+list
+nosuchcommand
+frame 1
+print k
+continue
+`))
+
+	// Each command's output contains these, in order.
+	want := []string{
+		"breakpoint at main.scale will be set when the program runs",
+		"breakpoint 1 at main.scale at " + src + ":6",
+		"stopped (breakpoint 1, goroutine 1) in main.scale at " + src + ":6",
+		"#0 main.scale(p={X: 1, Y: 2}, k=3) at " + src + ":6",
+		"#1 main.main() at " + src + ":12",
+		"(ogle) 3\n",
+		"(ogle) 3\n",
+		"stopped (step, goroutine 1) in main.scale at " + src + ":7",
+		"stopped (step, goroutine 1) in main.scale at " + src + ":8",
+		"(ogle) {X: 3, Y: 6}\n",
+		"=>    8\t\treturn q",
+		`unknown command "nosuchcommand"`,
+		// k isn't in main's frame.
+		"(ogle) (ogle) unknown identifier",
+		"process exited with status 0",
+	}
+	got := out.String()
+	for _, w := range want {
+		i := strings.Index(got, w)
+		if i < 0 {
+			t.Fatalf("got output\n%s\nwant %q next", out.String(), w)
+		}
+		got = got[i+len(w):]
+	}
+}
@@ -0,0 +1,589 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package dap implements a Debug Adapter Protocol front end for a program
+// being debugged.  Editors that speak the protocol, such as VS Code, can use
+// it to drive a debug.Program without a custom client.
+//
+// The protocol is described at https://microsoft.github.io/debug-adapter-protocol/.
+package dap // import "golang.org/x/debug/dap"
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/debug"
+)
+
+// threadID is the ID reported for the single thread of execution the adapter
+// exposes.  The debug.Program interface reports the stopped state of the
+// program as a whole, not per thread.
+const threadID = 1
+
+// maxFrames is the number of frames requested from the program when the client
+// doesn't limit the size of a stack trace.
+const maxFrames = 100
+
+// Session is a debug adapter session connecting a client to a program.
+type Session struct {
+	prog debug.Program
+	r    *bufio.Reader
+
+	mu  sync.Mutex // Protects w and seq.
+	w   io.Writer
+	seq int
+
+	// lineBreakpoints holds the IDs of the breakpoints set for each source file,
+	// since the client always sends the complete set for a file.
+	lineBreakpoints map[string][]uint64
+	// funcBreakpoints holds the IDs of the function breakpoints.
+	funcBreakpoints []uint64
+	// frames holds the stack at the most recent stop.  Scope and variable
+	// references are indexes into it.
+	frames []debug.Frame
+}
+
+// NewSession returns a session that reads requests from r and writes
+// responses and events to w, controlling prog.
+func NewSession(r io.Reader, w io.Writer, prog debug.Program) *Session {
+	return &Session{
+		prog:            prog,
+		r:               bufio.NewReader(r),
+		w:               w,
+		lineBreakpoints: make(map[string][]uint64),
+	}
+}
+
+// Serve handles requests until the client disconnects or the connection fails.
+// It returns nil if the client disconnected cleanly.
+func (s *Session) Serve() error {
+	for {
+		data, err := readMessage(s.r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var req request
+		if err := json.Unmarshal(data, &req); err != nil {
+			return fmt.Errorf("decoding message: %v", err)
+		}
+		if req.Type != "request" {
+			continue
+		}
+		body, err := s.handle(&req)
+		if err != nil {
+			s.respond(&req, false, err.Error(), nil)
+		} else {
+			s.respond(&req, true, "", body)
+		}
+		switch req.Command {
+		case "initialize":
+			// The client sends its configuration once it sees this event, which
+			// must follow the response to the initialize request.
+			s.sendEvent("initialized", nil)
+		case "disconnect":
+			return nil
+		}
+	}
+}
+
+// request is a message sent by the client.
+type request struct {
+	Seq       int             `json:"seq"`
+	Type      string          `json:"type"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// response is a message answering a request.
+type response struct {
+	Seq        int         `json:"seq"`
+	Type       string      `json:"type"`
+	RequestSeq int         `json:"request_seq"`
+	Command    string      `json:"command"`
+	Success    bool        `json:"success"`
+	Message    string      `json:"message,omitempty"`
+	Body       interface{} `json:"body,omitempty"`
+}
+
+// event is a message sent to the client without a corresponding request.
+type event struct {
+	Seq   int         `json:"seq"`
+	Type  string      `json:"type"`
+	Event string      `json:"event"`
+	Body  interface{} `json:"body,omitempty"`
+}
+
+type source struct {
+	Name string `json:"name,omitempty"`
+	Path string `json:"path,omitempty"`
+}
+
+type breakpoint struct {
+	ID       uint64  `json:"id,omitempty"`
+	Verified bool    `json:"verified"`
+	Message  string  `json:"message,omitempty"`
+	Source   *source `json:"source,omitempty"`
+	Line     uint64  `json:"line,omitempty"`
+}
+
+type stackFrame struct {
+	ID               int     `json:"id"`
+	Name             string  `json:"name"`
+	Source           *source `json:"source,omitempty"`
+	Line             uint64  `json:"line"`
+	Column           int     `json:"column"`
+	PresentationHint string  `json:"presentationHint,omitempty"`
+}
+
+type scope struct {
+	Name               string `json:"name"`
+	VariablesReference int    `json:"variablesReference"`
+	Expensive          bool   `json:"expensive"`
+}
+
+type variable struct {
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+	VariablesReference int    `json:"variablesReference"`
+}
+
+// handle dispatches a request, returning the body of the response.
+func (s *Session) handle(req *request) (interface{}, error) {
+	switch req.Command {
+	case "initialize":
+		return map[string]interface{}{
+			"supportsConfigurationDoneRequest": true,
+			"supportsFunctionBreakpoints":      true,
+		}, nil
+
+	case "launch":
+		var args struct {
+			Args []string `json:"args"`
+		}
+		if err := unmarshalArguments(req, &args); err != nil {
+			return nil, err
+		}
+		if _, err := s.prog.Run(args.Args...); err != nil {
+			return nil, err
+		}
+		go s.forwardOutput(s.prog.Stdout(), "stdout")
+		go s.forwardOutput(s.prog.Stderr(), "stderr")
+		return nil, nil
+
+	case "setBreakpoints":
+		var args struct {
+			Source      source `json:"source"`
+			Breakpoints []struct {
+				Line uint64 `json:"line"`
+			} `json:"breakpoints"`
+		}
+		if err := unmarshalArguments(req, &args); err != nil {
+			return nil, err
+		}
+		lines := make([]uint64, len(args.Breakpoints))
+		for i, b := range args.Breakpoints {
+			lines[i] = b.Line
+		}
+		return s.setBreakpoints(args.Source, lines)
+
+	case "setFunctionBreakpoints":
+		var args struct {
+			Breakpoints []struct {
+				Name string `json:"name"`
+			} `json:"breakpoints"`
+		}
+		if err := unmarshalArguments(req, &args); err != nil {
+			return nil, err
+		}
+		if err := s.prog.DeleteBreakpoints(s.funcBreakpoints); err != nil {
+			return nil, err
+		}
+		s.funcBreakpoints = nil
+		var bps []breakpoint
+		for _, b := range args.Breakpoints {
+			bp, err := s.prog.BreakpointAtFunction(b.Name)
+			bps = append(bps, s.breakpoint(bp, err))
+			if err == nil {
+				s.funcBreakpoints = append(s.funcBreakpoints, bp.ID)
+			}
+		}
+		return map[string]interface{}{"breakpoints": bps}, nil
+
+	case "configurationDone", "continue":
+		s.frames = nil
+		go s.resume()
+		if req.Command == "continue" {
+			return map[string]interface{}{"allThreadsContinued": true}, nil
+		}
+		return nil, nil
+
+	case "pause":
+		return nil, s.prog.Interrupt()
+
+	case "threads":
+		return map[string]interface{}{
+			"threads": []map[string]interface{}{{"id": threadID, "name": "main"}},
+		}, nil
+
+	case "stackTrace":
+		var args struct {
+			StartFrame int `json:"startFrame"`
+			Levels     int `json:"levels"`
+		}
+		if err := unmarshalArguments(req, &args); err != nil {
+			return nil, err
+		}
+		if err := s.loadFrames(); err != nil {
+			return nil, err
+		}
+		frames := s.frames
+		if args.StartFrame > len(frames) {
+			args.StartFrame = len(frames)
+		}
+		frames = frames[args.StartFrame:]
+		if args.Levels > 0 && args.Levels < len(frames) {
+			frames = frames[:args.Levels]
+		}
+		sf := make([]stackFrame, 0, len(frames))
+		for i, f := range frames {
+			hint := ""
+			if f.Kind != "" {
+				// Runtime, testing and cgo frames are collapsed by default.
+				hint = "subtle"
+			}
+			sf = append(sf, stackFrame{
+				ID:               args.StartFrame + i,
+				Name:             f.Function,
+				Source:           newSource(f.File),
+				Line:             f.Line,
+				Column:           1,
+				PresentationHint: hint,
+			})
+		}
+		return map[string]interface{}{
+			"stackFrames": sf,
+			"totalFrames": len(s.frames),
+		}, nil
+
+	case "scopes":
+		var args struct {
+			FrameID int `json:"frameId"`
+		}
+		if err := unmarshalArguments(req, &args); err != nil {
+			return nil, err
+		}
+		// Variable references must be non-zero, so frame i is referred to as i+1.
+		return map[string]interface{}{
+			"scopes": []scope{{Name: "Locals", VariablesReference: args.FrameID + 1}},
+		}, nil
+
+	case "variables":
+		var args struct {
+			VariablesReference int `json:"variablesReference"`
+		}
+		if err := unmarshalArguments(req, &args); err != nil {
+			return nil, err
+		}
+		i := args.VariablesReference - 1
+		if i < 0 || i >= len(s.frames) {
+			return nil, fmt.Errorf("invalid variables reference %d", args.VariablesReference)
+		}
+		f := s.frames[i]
+		vars := make([]variable, 0, len(f.Params)+len(f.Vars))
+		for _, p := range f.Params {
+			vars = append(vars, s.variable(p.Name, p.Var))
+		}
+		for _, v := range f.Vars {
+			vars = append(vars, s.variable(v.Name, v.Var))
+		}
+		return map[string]interface{}{"variables": vars}, nil
+
+	case "evaluate":
+		var args struct {
+			Expression string `json:"expression"`
+		}
+		if err := unmarshalArguments(req, &args); err != nil {
+			return nil, err
+		}
+		v, typ, err := s.prog.Evaluate(args.Expression)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"result":             formatValue(v),
+			"type":               typ.Name,
+			"variablesReference": 0,
+		}, nil
+
+	case "disconnect":
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unsupported request %q", req.Command)
+}
+
+// setBreakpoints replaces the breakpoints in the given source file with
+// breakpoints at the given lines.
+func (s *Session) setBreakpoints(src source, lines []uint64) (interface{}, error) {
+	if src.Path == "" {
+		return nil, errors.New("setBreakpoints: missing source path")
+	}
+	if err := s.prog.DeleteBreakpoints(s.lineBreakpoints[src.Path]); err != nil {
+		return nil, err
+	}
+	var (
+		ids []uint64
+		bps []breakpoint
+	)
+	for _, line := range lines {
+		bp, err := s.prog.BreakpointAtLine(src.Path, line)
+		b := s.breakpoint(bp, err)
+		if err == nil {
+			ids = append(ids, bp.ID)
+		} else {
+			b.Source, b.Line = newSource(src.Path), line
+		}
+		bps = append(bps, b)
+	}
+	s.lineBreakpoints[src.Path] = ids
+	return map[string]interface{}{"breakpoints": bps}, nil
+}
+
+// breakpoint converts the result of setting a breakpoint to its protocol form.
+func (s *Session) breakpoint(bp debug.Breakpoint, err error) breakpoint {
+	if err != nil {
+		return breakpoint{Verified: false, Message: err.Error()}
+	}
+	return breakpoint{
+		ID:       bp.ID,
+		Verified: true,
+		Source:   newSource(bp.File),
+		Line:     bp.Line,
+	}
+}
+
+// resume resumes the program and reports the next stop to the client.
+func (s *Session) resume() {
+	status, err := s.prog.Resume()
+	if e, ok := err.(*debug.ProcessExited); ok {
+		s.sendEvent("exited", map[string]interface{}{"exitCode": e.ExitStatus})
+		s.sendEvent("terminated", nil)
+		return
+	}
+	if err != nil {
+		s.sendEvent("output", map[string]interface{}{
+			"category": "stderr",
+			"output":   fmt.Sprintf("resume: %v\n", err),
+		})
+		s.sendEvent("terminated", nil)
+		return
+	}
+	body := map[string]interface{}{
+		"reason":            "breakpoint",
+		"threadId":          threadID,
+		"allThreadsStopped": true,
+	}
+	switch {
+	case status.Fatal != "":
+		body["reason"] = "exception"
+		body["text"] = status.Fatal
+	case status.Reason == "interrupt":
+		body["reason"] = "pause"
+	}
+	s.sendEvent("stopped", body)
+}
+
+// forwardOutput sends the program's output from r to the client, until the
+// program closes the stream.
+func (s *Session) forwardOutput(r io.Reader, category string) {
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			s.sendEvent("output", map[string]interface{}{
+				"category": category,
+				"output":   string(buf[:n]),
+			})
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// loadFrames reads the stack of the stopped program, if it hasn't been read
+// since the last stop.
+func (s *Session) loadFrames() error {
+	if s.frames != nil {
+		return nil
+	}
+	frames, err := s.prog.Frames(maxFrames)
+	if err != nil && len(frames) == 0 {
+		return err
+	}
+	s.frames = frames
+	return nil
+}
+
+func (s *Session) variable(name string, v debug.Var) variable {
+	val, err := s.prog.Value(v)
+	if err != nil {
+		return variable{Name: name, Value: fmt.Sprintf("<%v>", err)}
+	}
+	return variable{Name: name, Value: formatValue(val)}
+}
+
+// formatValue returns a short string form of a value.
+func formatValue(v debug.Value) string {
+	switch v := v.(type) {
+	case debug.String:
+		if uint64(len(v.String)) < v.Length {
+			return strconv.Quote(v.String) + "..."
+		}
+		return strconv.Quote(v.String)
+	case debug.Pointer:
+		return fmt.Sprintf("(%#x)", v.Address)
+	case debug.Slice:
+		return fmt.Sprintf("len=%d cap=%d", v.Length, v.Capacity)
+	case debug.Array:
+		return fmt.Sprintf("len=%d", v.Length)
+	case debug.Map:
+		return fmt.Sprintf("len=%d", v.Length)
+	case debug.Channel:
+		return fmt.Sprintf("len=%d cap=%d", v.Length, v.Capacity)
+	case debug.Func:
+		switch {
+		case v.Address == 0:
+			return "nil"
+		case v.Name != "":
+			return fmt.Sprintf("%s (%#x)", v.Name, v.Entry)
+		}
+		return fmt.Sprintf("func @%#x", v.Entry)
+	case debug.Struct:
+		return fmt.Sprintf("struct{%d fields}", len(v.Fields))
+	case debug.Mutex:
+		if !v.Locked {
+			return "unlocked"
+		}
+		return fmt.Sprintf("locked, %d waiting", len(v.Waiters))
+	case debug.RWMutex:
+		waiting := len(v.W.Waiters) + len(v.ReaderWaiters) + len(v.WriterWaiters)
+		switch {
+		case v.Locked:
+			return fmt.Sprintf("write-locked, %d waiting", waiting)
+		case v.Readers > 0:
+			return fmt.Sprintf("read-locked by %d, %d waiting", v.Readers, waiting)
+		}
+		return "unlocked"
+	case debug.WaitGroup:
+		return fmt.Sprintf("counter=%d, %d waiting", v.Counter, len(v.Waiters))
+	case debug.Interface:
+		switch {
+		case v.TypeName == "" && v.Data == 0:
+			return "nil"
+		case v.TypeName == "":
+			return fmt.Sprintf("interface{} (%#x)", v.Data)
+		}
+		return fmt.Sprintf("%s (%#x)", v.TypeName, v.Data)
+	}
+	return fmt.Sprint(v)
+}
+
+func newSource(path string) *source {
+	if path == "" {
+		return nil
+	}
+	name := path
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		name = path[i+1:]
+	}
+	return &source{Name: name, Path: path}
+}
+
+func unmarshalArguments(req *request, v interface{}) error {
+	if len(req.Arguments) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(req.Arguments, v); err != nil {
+		return fmt.Errorf("%s: bad arguments: %v", req.Command, err)
+	}
+	return nil
+}
+
+func (s *Session) respond(req *request, success bool, message string, body interface{}) {
+	s.send(&response{
+		Type:       "response",
+		RequestSeq: req.Seq,
+		Command:    req.Command,
+		Success:    success,
+		Message:    message,
+		Body:       body,
+	})
+}
+
+func (s *Session) sendEvent(name string, body interface{}) {
+	s.send(&event{
+		Type:  "event",
+		Event: name,
+		Body:  body,
+	})
+}
+
+// send assigns the next sequence number to msg and writes it to the client.
+// Errors are ignored: they will also be seen by the reading side.
+func (s *Session) send(msg interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	switch m := msg.(type) {
+	case *response:
+		m.Seq = s.seq
+	case *event:
+		m.Seq = s.seq
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	writeMessage(s.w, data)
+}
+
+// readMessage reads one message, which is a set of headers followed by a
+// body whose length is given by the Content-Length header.
+func readMessage(r *bufio.Reader) ([]byte, error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		if err == io.EOF && len(header) == 0 {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("reading message header: %v", err)
+	}
+	n, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("bad Content-Length %q", header.Get("Content-Length"))
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("reading message body: %v", err)
+	}
+	return data, nil
+}
+
+// writeMessage writes data as one message.
+func writeMessage(w io.Writer, data []byte) error {
+	if _, err := fmt.Fprintf(w, "Content-Length: %d\r\n\r\n", len(data)); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
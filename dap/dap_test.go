@@ -0,0 +1,260 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"golang.org/x/debug"
+)
+
+// fakeProgram implements the parts of debug.Program used by the tests.
+type fakeProgram struct {
+	debug.Program
+	nextID      uint64
+	deleted     []uint64
+	interrupted bool
+	status      debug.Status // Returned by Resume.
+	resumeErr   error        // Returned by Resume.
+}
+
+func (p *fakeProgram) BreakpointAtLine(file string, line uint64) (debug.Breakpoint, error) {
+	if line == 0 {
+		return debug.Breakpoint{}, fmt.Errorf("no code at %s:%d", file, line)
+	}
+	p.nextID++
+	return debug.Breakpoint{ID: p.nextID, PCs: []uint64{0x1000 + line}, File: file, Line: line, Enabled: true}, nil
+}
+
+func (p *fakeProgram) DeleteBreakpoints(ids []uint64) error {
+	p.deleted = append(p.deleted, ids...)
+	return nil
+}
+
+func (p *fakeProgram) Frames(count int) ([]debug.Frame, error) {
+	return []debug.Frame{
+		{Function: "main.f", File: "/src/main.go", Line: 10},
+		{Function: "runtime.main", File: "/goroot/src/runtime/proc.go", Line: 250, Kind: "runtime"},
+	}, nil
+}
+
+func (p *fakeProgram) Interrupt() error {
+	p.interrupted = true
+	return nil
+}
+
+func (p *fakeProgram) Resume() (debug.Status, error) {
+	return p.status, p.resumeErr
+}
+
+func (p *fakeProgram) Evaluate(e string) (debug.Value, debug.Type, error) {
+	return debug.String{Length: 2, String: "hi"}, debug.Type{Name: "string"}, nil
+}
+
+func encode(t *testing.T, msgs ...string) io.Reader {
+	var b bytes.Buffer
+	for _, m := range msgs {
+		if err := writeMessage(&b, []byte(m)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &b
+}
+
+func decode(t *testing.T, r io.Reader) []map[string]interface{} {
+	br := bufio.NewReader(r)
+	var msgs []map[string]interface{}
+	for {
+		data, err := readMessage(br)
+		if err == io.EOF {
+			return msgs
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var m map[string]interface{}
+		if err := json.Unmarshal(data, &m); err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, m)
+	}
+}
+
+func TestSession(t *testing.T) {
+	in := encode(t,
+		`{"seq":1,"type":"request","command":"initialize","arguments":{"adapterID":"go"}}`,
+		`{"seq":2,"type":"request","command":"setBreakpoints","arguments":{"source":{"path":"/src/main.go"},"breakpoints":[{"line":10},{"line":0}]}}`,
+		`{"seq":3,"type":"request","command":"setBreakpoints","arguments":{"source":{"path":"/src/main.go"},"breakpoints":[]}}`,
+		`{"seq":4,"type":"request","command":"evaluate","arguments":{"expression":"s"}}`,
+		`{"seq":5,"type":"request","command":"bogus"}`,
+		`{"seq":6,"type":"request","command":"disconnect"}`,
+	)
+	var out bytes.Buffer
+	prog := &fakeProgram{}
+	if err := NewSession(in, &out, prog).Serve(); err != nil {
+		t.Fatal(err)
+	}
+	msgs := decode(t, &out)
+
+	var kinds []string
+	for _, m := range msgs {
+		if m["type"] == "event" {
+			kinds = append(kinds, "event:"+m["event"].(string))
+		} else {
+			kinds = append(kinds, fmt.Sprintf("%s:%v", m["command"], m["success"]))
+		}
+	}
+	want := "initialize:true event:initialized setBreakpoints:true setBreakpoints:true evaluate:true bogus:false disconnect:true"
+	if got := strings.Join(kinds, " "); got != want {
+		t.Fatalf("got messages %s, want %s", got, want)
+	}
+	for i, m := range msgs {
+		if seq := m["seq"].(float64); seq != float64(i+1) {
+			t.Errorf("message %d has seq %v", i, seq)
+		}
+	}
+
+	bps := msgs[2]["body"].(map[string]interface{})["breakpoints"].([]interface{})
+	if len(bps) != 2 {
+		t.Fatalf("got %d breakpoints, want 2", len(bps))
+	}
+	if b := bps[0].(map[string]interface{}); b["verified"] != true || b["line"] != float64(10) {
+		t.Errorf("first breakpoint: got %v, want verified at line 10", b)
+	}
+	if b := bps[1].(map[string]interface{}); b["verified"] != false || b["message"] == nil {
+		t.Errorf("second breakpoint: got %v, want unverified with a message", b)
+	}
+	if len(prog.deleted) != 1 || prog.deleted[0] != 1 {
+		t.Errorf("deleted breakpoints: got %v, want [1]", prog.deleted)
+	}
+	if r := msgs[4]["body"].(map[string]interface{})["result"]; r != `"hi"` {
+		t.Errorf("evaluate result: got %v, want %q", r, `"hi"`)
+	}
+	if typ := msgs[4]["body"].(map[string]interface{})["type"]; typ != "string" {
+		t.Errorf("evaluate type: got %v, want %q", typ, "string")
+	}
+}
+
+func TestStackTraceHints(t *testing.T) {
+	in := encode(t,
+		`{"seq":1,"type":"request","command":"stackTrace","arguments":{"threadId":1}}`,
+	)
+	var out bytes.Buffer
+	if err := NewSession(in, &out, &fakeProgram{}).Serve(); err != nil {
+		t.Fatal(err)
+	}
+	msgs := decode(t, &out)
+	if len(msgs) != 1 || msgs[0]["success"] != true {
+		t.Fatalf("got messages %v, want a successful stackTrace response", msgs)
+	}
+	frames := msgs[0]["body"].(map[string]interface{})["stackFrames"].([]interface{})
+	if len(frames) != 2 {
+		t.Fatalf("got %d frames, want 2", len(frames))
+	}
+	for i, want := range []interface{}{nil, "subtle"} {
+		if got := frames[i].(map[string]interface{})["presentationHint"]; got != want {
+			t.Errorf("frame %d: got presentation hint %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestPause(t *testing.T) {
+	in := encode(t,
+		`{"seq":1,"type":"request","command":"pause","arguments":{"threadId":1}}`,
+	)
+	var out bytes.Buffer
+	prog := &fakeProgram{}
+	if err := NewSession(in, &out, prog).Serve(); err != nil {
+		t.Fatal(err)
+	}
+	msgs := decode(t, &out)
+	if len(msgs) != 1 || msgs[0]["success"] != true {
+		t.Fatalf("got messages %v, want a successful pause response", msgs)
+	}
+	if !prog.interrupted {
+		t.Error("pause didn't interrupt the program")
+	}
+}
+
+func TestFormatFunc(t *testing.T) {
+	for _, tc := range []struct {
+		f    debug.Func
+		want string
+	}{
+		{debug.Func{}, "nil"},
+		{debug.Func{Address: 0x5000, Entry: 0x1234, Name: "main.bar"}, "main.bar (0x1234)"},
+		{debug.Func{Address: 0x5000, Entry: 0x1234}, "func @0x1234"},
+	} {
+		if got := formatValue(tc.f); got != tc.want {
+			t.Errorf("formatValue(%+v) = %q, want %q", tc.f, got, tc.want)
+		}
+	}
+}
+
+func TestFormatInterface(t *testing.T) {
+	for _, tc := range []struct {
+		i    debug.Interface
+		want string
+	}{
+		{debug.Interface{}, "nil"},
+		{debug.Interface{TypeID: 1, TypeName: "*main.T", Data: 0x5000}, "*main.T (0x5000)"},
+		{debug.Interface{Data: 0x5000}, "interface{} (0x5000)"},
+	} {
+		if got := formatValue(tc.i); got != tc.want {
+			t.Errorf("formatValue(%+v) = %q, want %q", tc.i, got, tc.want)
+		}
+	}
+}
+
+func TestStoppedAtFatalError(t *testing.T) {
+	var out bytes.Buffer
+	prog := &fakeProgram{status: debug.Status{Reason: "breakpoint", Fatal: "fatal error: concurrent map writes"}}
+	NewSession(encode(t), &out, prog).resume()
+	msgs := decode(t, &out)
+	if len(msgs) != 1 || msgs[0]["event"] != "stopped" {
+		t.Fatalf("got messages %v, want a stopped event", msgs)
+	}
+	body := msgs[0]["body"].(map[string]interface{})
+	if body["reason"] != "exception" || body["text"] != "fatal error: concurrent map writes" {
+		t.Errorf("got stopped event %v, want an exception with the fatal error", body)
+	}
+}
+
+func TestExited(t *testing.T) {
+	var out bytes.Buffer
+	prog := &fakeProgram{resumeErr: &debug.ProcessExited{ExitStatus: 3}}
+	NewSession(encode(t), &out, prog).resume()
+	msgs := decode(t, &out)
+	if len(msgs) != 2 || msgs[0]["event"] != "exited" || msgs[1]["event"] != "terminated" {
+		t.Fatalf("got messages %v, want exited and terminated events", msgs)
+	}
+	if code := msgs[0]["body"].(map[string]interface{})["exitCode"]; code != float64(3) {
+		t.Errorf("got exit code %v, want 3", code)
+	}
+}
+
+func TestFormatSync(t *testing.T) {
+	for _, tc := range []struct {
+		v    debug.Value
+		want string
+	}{
+		{debug.Mutex{}, "unlocked"},
+		{debug.Mutex{Locked: true, Waiters: []int64{5, 6}}, "locked, 2 waiting"},
+		{debug.RWMutex{}, "unlocked"},
+		{debug.RWMutex{Readers: 3, WriterWaiters: []int64{7}}, "read-locked by 3, 1 waiting"},
+		{debug.RWMutex{Writer: true, Locked: true, ReaderWaiters: []int64{8, 9}}, "write-locked, 2 waiting"},
+		{debug.WaitGroup{Counter: 2, Waiters: []int64{1}}, "counter=2, 1 waiting"},
+	} {
+		if got := formatValue(tc.v); got != tc.want {
+			t.Errorf("formatValue(%+v) = %q, want %q", tc.v, got, tc.want)
+		}
+	}
+}
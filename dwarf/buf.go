@@ -110,6 +110,17 @@ func (b *buf) uint16() uint16 {
 	return b.order.Uint16(a)
 }
 
+func (b *buf) uint24() uint32 {
+	a := b.bytes(3)
+	if a == nil {
+		return 0
+	}
+	if b.order == binary.BigEndian {
+		return uint32(a[0])<<16 | uint32(a[1])<<8 | uint32(a[2])
+	}
+	return uint32(a[2])<<16 | uint32(a[1])<<8 | uint32(a[0])
+}
+
 func (b *buf) uint32() uint32 {
 	a := b.bytes(4)
 	if a == nil {
@@ -174,6 +185,20 @@ func (b *buf) addr() uint64 {
 	return 0
 }
 
+// Section offset, 4 or 8 bytes depending on whether the format is 64-bit
+// DWARF.
+func (b *buf) unitOffset() uint64 {
+	is64, known := b.format.dwarf64()
+	switch {
+	case !known:
+		b.error("unknown size for section offset")
+		return 0
+	case is64:
+		return b.uint64()
+	}
+	return uint64(b.uint32())
+}
+
 // assertEmpty checks that everything has been read from b.
 func (b *buf) assertEmpty() {
 	if len(b.data) == 0 {
@@ -6,6 +6,8 @@ package dwarf
 
 import (
 	"sort"
+
+	"golang.org/x/debug"
 )
 
 // pcToFuncEntries maps PC ranges to function entries.
@@ -38,10 +40,16 @@ type nameCacheEntry struct {
 	link  *nameCacheEntry
 }
 
+// runtimeTypes maps the value of each type entry's DW_AT_go_runtime_type
+// attribute, which identifies the type's runtime type descriptor, to the
+// entry's offset.
+type runtimeTypes map[uint64]Offset
+
 // pcToLineEntries maps PCs to line numbers.
 //
 // It is a slice of (PC, line, file number) triples, sorted by PC.  The file
-// number is an index into the source files slice.
+// number is an index into the source files slice.  Each also records whether
+// its PC is a recommended breakpoint location, the start of a statement.
 // If (PC1, line1, file1) and (PC2, line2, file2) are two consecutive elements,
 // then the span of addresses [PC1, PC2) belongs to (line1, file1).  If an
 // element's file number is zero, it only marks the end of a span.
@@ -53,6 +61,7 @@ type pcToLineEntry struct {
 	pc   uint64
 	line uint64
 	file uint64
+	stmt bool
 }
 
 func (p pcToLineEntries) Len() int      { return len(p) }
@@ -79,15 +88,16 @@ func (b byFileLine) Less(i, j int) bool {
 // lineToPCEntries maps line numbers to breakpoint addresses.
 //
 // The slice contains, for each source file in Data, a slice of (line, PC)
-// pairs, sorted by line.  Note that there may be more than one PC for a line.
+// pairs, sorted by line.  Note that there may be more than one PC for a line,
+// and that not every PC starts a statement.
 type lineToPCEntries [][]lineToPCEntry
 type lineToPCEntry struct {
 	line uint64
 	pc   uint64
+	stmt bool
 }
 
 func (d *Data) buildLineToPCCache(pclfs pcToLineEntries) {
-	// TODO: only include lines where is_stmt is true
 	sort.Sort(byFileLine(pclfs))
 	// Make a slice of (line, PC) pairs for each (non-zero) file.
 	var (
@@ -99,7 +109,7 @@ func (d *Data) buildLineToPCCache(pclfs pcToLineEntries) {
 			// This entry indicated the end of an instruction sequence, not a breakpoint.
 			continue
 		}
-		curSlice = append(curSlice, lineToPCEntry{line: pclf.line, pc: pclf.pc})
+		curSlice = append(curSlice, lineToPCEntry{line: pclf.line, pc: pclf.pc, stmt: pclf.stmt})
 		if i+1 == len(pclfs) || pclf.file != pclfs[i+1].file {
 			// curSlice now contains all of the entries for pclf.file.
 			if pclf.file > 0 && pclf.file < uint64(len(c)) {
@@ -136,21 +146,23 @@ func (d *Data) buildLineCaches() {
 	if len(d.line) == 0 {
 		return
 	}
-	var m lineMachine
-	// Assume the address_size in the first unit applies to the whole program.
+	// Assume the address_size in the first unit applies to the whole program,
+	// for line tables older than DWARF 5, whose headers don't give it.
 	// TODO: we could handle executables containing code for multiple address
 	// sizes using DW_AT_stmt_list attributes.
 	if len(d.unit) == 0 {
 		return
 	}
 	buf := makeBuf(d, &d.unit[0], "line", 0, d.line)
-	if err := m.parseHeader(&buf); err != nil {
-		return
-	}
-	for _, f := range m.header.file {
-		d.sourceFiles = append(d.sourceFiles, f.name)
-	}
+
+	// There is a line number program for each compilation unit, with its
+	// own file numbers.  They are mapped to indexes in d.sourceFiles, where
+	// each name appears once.  Index zero is left empty, since the caches
+	// use file number zero to mark the end of a sequence.
+	d.sourceFiles = []string{""}
+	fileIndex := make(map[string]uint64)
 	var cache pcToLineEntries
+	var files []uint64
 	fn := func(m *lineMachine) bool {
 		if m.endSequence {
 			cache = append(cache, pcToLineEntry{
@@ -159,32 +171,70 @@ func (d *Data) buildLineCaches() {
 				file: 0,
 			})
 		} else {
+			file := ^uint64(0) // An invalid file number.
+			if m.file < uint64(len(files)) {
+				file = files[m.file]
+			}
 			cache = append(cache, pcToLineEntry{
 				pc:   m.address,
 				line: m.line,
-				file: m.file,
+				file: file,
+				stmt: m.isStmt,
 			})
 		}
 		return true
 	}
-	m.evalCompilationUnit(&buf, fn)
+	d.lineFiles = make(map[Offset][]uint64)
+	for len(buf.data) > 0 {
+		var m lineMachine
+		progOff := buf.off
+		prog, err := m.parseHeader(&buf)
+		if err != nil {
+			debug.Log(debug.LevelWarn, "DWARF line table header unreadable", debug.Field{Key: "err", Value: err})
+			break
+		}
+		files = make([]uint64, len(m.header.file))
+		for i, f := range m.header.file {
+			name := m.fileName(f)
+			if name == "" {
+				files[i] = ^uint64(0)
+				continue
+			}
+			n, ok := fileIndex[name]
+			if !ok {
+				n = uint64(len(d.sourceFiles))
+				fileIndex[name] = n
+				d.sourceFiles = append(d.sourceFiles, name)
+			}
+			files[i] = n
+		}
+		d.lineFiles[progOff] = files
+		if err := m.evalCompilationUnit(&prog, fn); err != nil {
+			debug.Log(debug.LevelWarn, "DWARF line table unreadable", debug.Field{Key: "err", Value: err})
+		}
+	}
 	d.buildLineToPCCache(cache)
 	d.buildPCToLineCache(cache)
 }
 
-// buildInfoCaches initializes nameCache and pcToFuncEntries by walking the
-// top-level entries under each compile unit. It swallows any errors in parsing.
+// buildInfoCaches initializes nameCache, runtimeTypes, instantiations and
+// pcToFuncEntries by walking the top-level entries under each compile unit.
+// It logs and otherwise swallows any errors in parsing.
 func (d *Data) buildInfoCaches() {
-	// TODO: record errors somewhere?
 	d.nameCache = make(map[string]*nameCacheEntry)
+	d.runtimeTypes = make(runtimeTypes)
 
 	var pcToFuncEntries pcToFuncEntries
+	// Out-of-line copies of functions the compiler also inlined have only a
+	// reference to an abstract entry with their name, which may come later.
+	var copies []*Entry
 
 	r := d.Reader()
 loop:
 	for {
 		entry, err := r.Next()
 		if entry == nil || err != nil {
+			logInfoError(err)
 			break loop
 		}
 		if entry.Tag != TagCompileUnit /* DW_TAG_compile_unit */ {
@@ -194,6 +244,7 @@ loop:
 		for {
 			entry, err := r.Next()
 			if entry == nil || err != nil {
+				logInfoError(err)
 				break loop
 			}
 			if entry.Tag == 0 {
@@ -205,11 +256,20 @@ loop:
 			if name, ok := entry.Val(AttrName).(string); ok {
 				d.nameCache[name] = &nameCacheEntry{entry: entry, link: d.nameCache[name]}
 			}
+			// Update runtime-type-to-entry cache.
+			if rtype, ok := entry.Val(AttrGoRuntimeType).(uint64); ok && rtype != 0 {
+				if _, dup := d.runtimeTypes[rtype]; !dup {
+					d.runtimeTypes[rtype] = entry.Offset
+				}
+			}
 
 			// If this entry is a function, update PC-to-containing-function cache.
 			if entry.Tag != TagSubprogram /* DW_TAG_subprogram */ {
 				continue
 			}
+			if entry.Val(AttrName) == nil && entry.Val(AttrAbstractOrigin) != nil {
+				copies = append(copies, entry)
+			}
 
 			// DW_AT_low_pc, if present, is the address of the first instruction of
 			// the function.
@@ -219,15 +279,30 @@ loop:
 			}
 			pcToFuncEntries = append(pcToFuncEntries, pcToFuncEntry{lowpc, entry})
 
-			// DW_AT_high_pc, if present (TODO: and of class address) is the address
-			// one past the last instruction of the function.
-			highpc, ok := entry.Val(AttrHighpc).(uint64)
-			if !ok {
-				continue
+			// DW_AT_high_pc, if present, is the address one past the last
+			// instruction of the function, or since DWARF 4 may be its
+			// offset from DW_AT_low_pc.
+			switch highpc := entry.Val(AttrHighpc).(type) {
+			case uint64:
+				pcToFuncEntries = append(pcToFuncEntries, pcToFuncEntry{highpc, nil})
+			case int64:
+				pcToFuncEntries = append(pcToFuncEntries, pcToFuncEntry{lowpc + uint64(highpc), nil})
 			}
-			pcToFuncEntries = append(pcToFuncEntries, pcToFuncEntry{highpc, nil})
 		}
 	}
+	for _, entry := range copies {
+		resolved, err := d.ResolveOrigin(entry)
+		if err != nil {
+			continue
+		}
+		entry.Field = resolved.Field
+		if name, ok := entry.Val(AttrName).(string); ok {
+			d.nameCache[name] = &nameCacheEntry{entry: entry, link: d.nameCache[name]}
+		}
+	}
+
+	d.buildInstantiations()
+
 	// Sort elements by PC.  If there are multiple elements with the same PC,
 	// those with non-nil *Entry are placed earlier.
 	sort.Sort(pcToFuncEntries)
@@ -247,3 +322,10 @@ loop:
 	}
 	d.pcToFuncEntries = out
 }
+
+// logInfoError logs an error that stopped buildInfoCaches reading .debug_info.
+func logInfoError(err error) {
+	if err != nil {
+		debug.Log(debug.LevelWarn, "DWARF info unreadable; later names and functions are missing", debug.Field{Key: "err", Value: err})
+	}
+}
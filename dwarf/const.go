@@ -85,11 +85,21 @@ const (
 	AttrCallLine       Attr = 0x59
 	AttrDescription    Attr = 0x5A
 
+	// New in DWARF 5.
+	AttrStrOffsetsBase Attr = 0x72
+	AttrAddrBase       Attr = 0x73
+	AttrRnglistsBase   Attr = 0x74
+	AttrLoclistsBase   Attr = 0x8C
+
 	// Go-specific attributes.
 	AttrGoKind          Attr = 0x2900
 	AttrGoKey           Attr = 0x2901
 	AttrGoElem          Attr = 0x2902
 	AttrGoEmbeddedField Attr = 0x2903
+	AttrGoRuntimeType   Attr = 0x2904
+	AttrGoPackageName   Attr = 0x2905
+	AttrGoDictIndex     Attr = 0x2906
+	AttrGoClosureOffset Attr = 0x2907
 )
 
 var attrNames = [...]string{
@@ -165,6 +175,10 @@ var attrNames = [...]string{
 	AttrCallFile:       "CallFile",
 	AttrCallLine:       "CallLine",
 	AttrDescription:    "Description",
+	AttrStrOffsetsBase: "StrOffsetsBase",
+	AttrAddrBase:       "AddrBase",
+	AttrRnglistsBase:   "RnglistsBase",
+	AttrLoclistsBase:   "LoclistsBase",
 }
 
 func (a Attr) String() string {
@@ -183,6 +197,14 @@ func (a Attr) String() string {
 		return "GoElem"
 	case AttrGoEmbeddedField:
 		return "GoEmbeddedField"
+	case AttrGoRuntimeType:
+		return "GoRuntimeType"
+	case AttrGoPackageName:
+		return "GoPackageName"
+	case AttrGoDictIndex:
+		return "GoDictIndex"
+	case AttrGoClosureOffset:
+		return "GoClosureOffset"
 	}
 	return strconv.Itoa(int(a))
 }
@@ -228,6 +250,25 @@ const (
 	formExprloc     format = 0x18
 	formFlagPresent format = 0x19
 	formRefSig8     format = 0x20
+	// The following are new in DWARF 5.
+	formStrx          format = 0x1A
+	formAddrx         format = 0x1B
+	formRefSup4       format = 0x1C
+	formStrpSup       format = 0x1D
+	formData16        format = 0x1E
+	formLineStrp      format = 0x1F
+	formImplicitConst format = 0x21
+	formLoclistx      format = 0x22
+	formRnglistx      format = 0x23
+	formRefSup8       format = 0x24
+	formStrx1         format = 0x25
+	formStrx2         format = 0x26
+	formStrx3         format = 0x27
+	formStrx4         format = 0x28
+	formAddrx1        format = 0x29
+	formAddrx2        format = 0x2A
+	formAddrx3        format = 0x2B
+	formAddrx4        format = 0x2C
 	// Extensions for multi-file compression (.dwz)
 	// http://www.dwarfstd.org/ShowIssue.php?issue=120604.1
 	formGnuRefAlt  format = 0x1f20
@@ -468,3 +509,48 @@ const (
 	encUnsignedChar   = 0x08
 	encImaginaryFloat = 0x09
 )
+
+// Unit header unit types, new in DWARF 5.
+const (
+	utCompile      = 0x01
+	utType         = 0x02
+	utPartial      = 0x03
+	utSkeleton     = 0x04
+	utSplitCompile = 0x05
+	utSplitType    = 0x06
+)
+
+// Range list entry kinds in .debug_rnglists, new in DWARF 5.
+const (
+	rleEndOfList    = 0x00
+	rleBaseAddressx = 0x01
+	rleStartxEndx   = 0x02
+	rleStartxLength = 0x03
+	rleOffsetPair   = 0x04
+	rleBaseAddress  = 0x05
+	rleStartEnd     = 0x06
+	rleStartLength  = 0x07
+)
+
+// Location list entry kinds in .debug_loclists, new in DWARF 5.
+const (
+	lleEndOfList       = 0x00
+	lleBaseAddressx    = 0x01
+	lleStartxEndx      = 0x02
+	lleStartxLength    = 0x03
+	lleOffsetPair      = 0x04
+	lleDefaultLocation = 0x05
+	lleBaseAddress     = 0x06
+	lleStartEnd        = 0x07
+	lleStartLength     = 0x08
+)
+
+// Content types of the directory and file name entries in a line table
+// header, new in DWARF 5.
+const (
+	lnctPath           = 0x1
+	lnctDirectoryIndex = 0x2
+	lnctTimestamp      = 0x3
+	lnctSize           = 0x4
+	lnctMD5            = 0x5
+)
@@ -0,0 +1,180 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dwarf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// uleb appends x to b in unsigned LEB128.
+func uleb(b *bytes.Buffer, x uint64) {
+	for {
+		c := byte(x & 0x7f)
+		x >>= 7
+		if x != 0 {
+			c |= 0x80
+		}
+		b.WriteByte(c)
+		if x == 0 {
+			return
+		}
+	}
+}
+
+// dwarf5Data returns Data with one DWARF 5 unit whose .debug_addr
+// contribution holds addrs.
+func dwarf5Data(addrs ...uint64) *Data {
+	var addr bytes.Buffer
+	addr.Write(make([]byte, 8)) // header
+	for _, a := range addrs {
+		binary.Write(&addr, binary.LittleEndian, a)
+	}
+	return &Data{
+		order: binary.LittleEndian,
+		addr:  addr.Bytes(),
+		unit:  []unit{{asize: 8, vers: 5, addrBase: 8, basesKnown: true}},
+	}
+}
+
+func TestRangeListV5(t *testing.T) {
+	d := dwarf5Data(0x1000, 0x3000)
+	var b bytes.Buffer
+	b.WriteByte(rleOffsetPair) // Relative to the unit's base, 0x500.
+	uleb(&b, 0x10)
+	uleb(&b, 0x20)
+	b.WriteByte(rleBaseAddressx)
+	uleb(&b, 0)
+	b.WriteByte(rleOffsetPair)
+	uleb(&b, 0x4)
+	uleb(&b, 0x8)
+	b.WriteByte(rleStartxLength)
+	uleb(&b, 1)
+	uleb(&b, 0x100)
+	b.WriteByte(rleStartEnd)
+	binary.Write(&b, binary.LittleEndian, uint64(0x5000))
+	binary.Write(&b, binary.LittleEndian, uint64(0x5010))
+	b.WriteByte(rleEndOfList)
+	d.rnglists = b.Bytes()
+
+	got, err := d.rangeList(&d.unit[0], 0x500, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][2]uint64{{0x510, 0x520}, {0x1004, 0x1008}, {0x3000, 0x3100}, {0x5000, 0x5010}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#x, want %#x", got, want)
+	}
+
+	d.rnglists = []byte{rleBaseAddressx, 2}
+	if _, err := d.rangeList(&d.unit[0], 0, 0); err == nil {
+		t.Errorf("address index out of range: got no error")
+	}
+}
+
+func TestLocationListV5(t *testing.T) {
+	d := dwarf5Data(0x2000)
+	var b bytes.Buffer
+	expr := func(e ...byte) {
+		uleb(&b, uint64(len(e)))
+		b.Write(e)
+	}
+	b.WriteByte(lleDefaultLocation)
+	expr(0x9c) // DW_OP_call_frame_cfa
+	b.WriteByte(lleBaseAddressx)
+	uleb(&b, 0)
+	b.WriteByte(lleOffsetPair)
+	uleb(&b, 0)
+	uleb(&b, 0x10)
+	expr(0x50) // DW_OP_reg0
+	b.WriteByte(lleStartLength)
+	binary.Write(&b, binary.LittleEndian, uint64(0x3000))
+	uleb(&b, 0x20)
+	expr(0x91, 0x08) // DW_OP_fbreg 8
+	b.WriteByte(lleEndOfList)
+	d.loclists = b.Bytes()
+
+	tests := []struct {
+		pc   uint64
+		want []byte
+	}{
+		{0x2000, []byte{0x50}},
+		{0x200f, []byte{0x50}},
+		{0x2010, []byte{0x9c}},
+		{0x301f, []byte{0x91, 0x08}},
+		{0x3020, []byte{0x9c}},
+	}
+	for _, test := range tests {
+		got, err := d.locationListAtV5(&d.unit[0], 0, test.pc)
+		if err != nil {
+			t.Errorf("pc %#x: %v", test.pc, err)
+			continue
+		}
+		if !bytes.Equal(got, test.want) {
+			t.Errorf("pc %#x: got %x, want %x", test.pc, got, test.want)
+		}
+	}
+}
+
+func TestLineHeaderV5(t *testing.T) {
+	d := &Data{
+		order:   binary.LittleEndian,
+		lineStr: []byte("/src\x00main.go\x00"),
+	}
+	var h bytes.Buffer
+	h.Write([]byte{1, 1, 1, 0xfc, 10, 11})        // min inst length, max ops, default is_stmt, line base, line range, opcode base
+	h.Write([]byte{0, 1, 1, 1, 1, 0, 0, 0, 1, 0}) // standard opcode lengths
+	h.Write([]byte{1, lnctPath, byte(formString)})
+	uleb(&h, 2)
+	h.WriteString(".\x00/src\x00")
+	h.Write([]byte{2, lnctPath, byte(formLineStrp), lnctDirectoryIndex, byte(formUdata)})
+	uleb(&h, 2)
+	h.Write([]byte{0, 0, 0, 0, 0}) // "/src" in directory 0
+	h.Write([]byte{5, 0, 0, 0, 1}) // "main.go" in directory 1
+	var prog bytes.Buffer
+	prog.Write([]byte{lineStartExtendedOpcode, 9, lineExtSetAddress})
+	binary.Write(&prog, binary.LittleEndian, uint64(0x1000))
+	prog.Write([]byte{lineStdCopy})
+	prog.Write([]byte{lineStartExtendedOpcode, 1, lineExtEndSequence})
+
+	var b bytes.Buffer
+	body := 2 + 1 + 1 + 4 + h.Len() + prog.Len()
+	binary.Write(&b, binary.LittleEndian, uint32(body))
+	binary.Write(&b, binary.LittleEndian, uint16(5))
+	b.Write([]byte{8, 0}) // address size, segment selector size
+	binary.Write(&b, binary.LittleEndian, uint32(h.Len()))
+	b.Write(h.Bytes())
+	b.Write(prog.Bytes())
+
+	var m lineMachine
+	buf := makeBuf(d, unknownFormat{}, "line", 0, b.Bytes())
+	p, err := m.parseHeader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buf.data) != 0 {
+		t.Errorf("%d bytes left after the line number program", len(buf.data))
+	}
+	var names []string
+	for _, f := range m.header.file {
+		names = append(names, m.fileName(f))
+	}
+	if want := []string{"/src", "/src/main.go"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("files: got %q, want %q", names, want)
+	}
+	var pcs []uint64
+	err = m.evalCompilationUnit(&p, func(m *lineMachine) bool {
+		pcs = append(pcs, m.address)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint64{0x1000, 0x1000}; !reflect.DeepEqual(pcs, want) {
+		t.Errorf("rows: got PCs %#x, want %#x", pcs, want)
+	}
+}
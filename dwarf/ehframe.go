@@ -0,0 +1,407 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Unwinding code that has no frame information in .debug_frame, such as the
+// C code of a cgo program, with the call frame information C compilers put
+// in an ELF file's .eh_frame section for exception handling.  Its format is
+// that of .debug_frame with the extensions described in the Linux Standard
+// Base Core Specification, section 10.6.
+
+package dwarf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// An EHFrame is the call frame information in an .eh_frame section.
+type EHFrame struct {
+	data    []byte
+	addr    uint64 // The address of the section, for PC-relative pointers.
+	order   binary.ByteOrder
+	ptrSize int
+
+	// index is the section's FDEs, read when first needed.
+	indexOnce sync.Once
+	index     []ehFDE
+	indexErr  error
+}
+
+// NewEHFrame returns the call frame information in data, the contents of an
+// .eh_frame section at address addr, for a machine with the given byte
+// order and size of pointers.
+func NewEHFrame(data []byte, addr uint64, order binary.ByteOrder, ptrSize int) *EHFrame {
+	return &EHFrame{data: data, addr: addr, order: order, ptrSize: ptrSize}
+}
+
+// An UnwindRule says how to find the caller's registers at a PC.
+type UnwindRule struct {
+	// Start and End are the [Start, End) range of addresses of the
+	// function the rule is for.
+	Start, End uint64
+	// The canonical frame address, which is the value of the stack pointer
+	// before the call to the function, is the value of register
+	// CFARegister plus CFAOffset.
+	CFARegister int
+	CFAOffset   int64
+	// Saved maps the registers the function has saved on the stack to
+	// where they are, as offsets from the canonical frame address.
+	// Registers are numbered as in DWARF.
+	Saved map[int]int64
+	// ReturnAddress is the register holding the return address, which is
+	// in Saved.
+	ReturnAddress int
+}
+
+// ehFormat is the data format of an .eh_frame section.
+type ehFormat struct{ ptrSize int }
+
+func (f ehFormat) version() int          { return 0 }
+func (f ehFormat) dwarf64() (bool, bool) { return false, true }
+func (f ehFormat) addrsize() int         { return f.ptrSize }
+
+// Pointer encodings (DW_EH_PE_*): the low four bits give the format, and the
+// next three how the value is applied.
+const (
+	ehPtrAbs     = 0x00
+	ehPtrULEB128 = 0x01
+	ehPtrUdata2  = 0x02
+	ehPtrUdata4  = 0x03
+	ehPtrUdata8  = 0x04
+	ehPtrSLEB128 = 0x09
+	ehPtrSdata2  = 0x0a
+	ehPtrSdata4  = 0x0b
+	ehPtrSdata8  = 0x0c
+	ehPtrPCRel   = 0x10
+	ehPtrOmit    = 0xff
+)
+
+// Call frame instructions found only in .eh_frame.
+const frameGNUArgsSize = 0x2e // op: ULEB128 size
+
+// An ehCIE is the part of a common information entry that the frame
+// description entries referring to it need.
+type ehCIE struct {
+	codeAlign     uint64
+	dataAlign     int64
+	returnAddress int
+	augmented     bool // The CIE and its FDEs have augmentation data.
+	fdeEncoding   uint8
+	initial       buf // The initial instructions.
+}
+
+// UnwindRule returns the rule for unwinding the function at pc.
+func (f *EHFrame) UnwindRule(pc uint64) (*UnwindRule, error) {
+	f.indexOnce.Do(f.buildIndex)
+	if f.indexErr != nil {
+		return nil, f.indexErr
+	}
+	i := sort.Search(len(f.index), func(i int) bool { return f.index[i].end > pc })
+	if i == len(f.index) || pc < f.index[i].start {
+		return nil, fmt.Errorf("no call frame information for PC %#x", pc)
+	}
+	fde := f.index[i]
+	cie, err := f.cie(fde.cie)
+	if err != nil {
+		return nil, err
+	}
+	b := fde.instructions
+	rule := &UnwindRule{
+		Start:         fde.start,
+		End:           fde.end,
+		Saved:         make(map[int]int64),
+		ReturnAddress: cie.returnAddress,
+	}
+	m := ehMachine{f: f, cie: cie, rule: rule, location: fde.start}
+	initial := cie.initial
+	if err := m.run(&initial, ^uint64(0)); err != nil {
+		return nil, err
+	}
+	m.initial = copySaved(rule.Saved)
+	if err := m.run(&b, pc); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// An ehFDE is a frame description entry: the instructions for unwinding the
+// code from start to end.
+type ehFDE struct {
+	start, end   uint64
+	cie          uint64 // The offset of the FDE's CIE.
+	instructions buf
+}
+
+// buildIndex reads the section's FDEs into f.index, in order of address.
+func (f *EHFrame) buildIndex() {
+	b := f.buf(0, f.data)
+	for len(b.data) > 0 {
+		start := uint64(b.off)
+		length := uint64(b.uint32())
+		if length == 0 {
+			break // A terminator.
+		}
+		if length == 0xffffffff {
+			length = b.uint64()
+		}
+		if length > uint64(len(b.data)) {
+			f.indexErr = fmt.Errorf("eh_frame entry at %#x: too short", start)
+			return
+		}
+		entry := b.slice(int(length))
+		idOff := uint64(entry.off)
+		id := uint64(entry.uint32())
+		if id == 0 {
+			continue // A CIE, which is read when an FDE refers to it.
+		}
+		cie, err := f.cie(idOff - id)
+		if err != nil {
+			f.indexErr = err
+			return
+		}
+		fde := ehFDE{cie: idOff - id}
+		fde.start = f.pointer(&entry, cie.fdeEncoding)
+		fde.end = fde.start + f.pointer(&entry, cie.fdeEncoding&0x0f)
+		if cie.augmented {
+			entry.skip(int(entry.uint()))
+		}
+		if entry.err != nil {
+			f.indexErr = entry.err
+			return
+		}
+		fde.instructions = entry
+		if fde.start < fde.end {
+			f.index = append(f.index, fde)
+		}
+	}
+	f.indexErr = b.err
+	sort.Slice(f.index, func(i, j int) bool { return f.index[i].start < f.index[j].start })
+}
+
+// buf returns a buf for reading data, which is at offset off in the section.
+func (f *EHFrame) buf(off uint64, data []byte) buf {
+	return buf{order: f.order, format: ehFormat{f.ptrSize}, name: "eh_frame", off: Offset(off), data: data}
+}
+
+// cie reads the CIE at offset off in the section.
+func (f *EHFrame) cie(off uint64) (*ehCIE, error) {
+	if off >= uint64(len(f.data)) {
+		return nil, fmt.Errorf("eh_frame: CIE offset %#x out of range", off)
+	}
+	b := f.buf(off, f.data[off:])
+	length := uint64(b.uint32())
+	if length == 0xffffffff {
+		length = b.uint64()
+	}
+	if length > uint64(len(b.data)) {
+		return nil, fmt.Errorf("eh_frame CIE at %#x: too short", off)
+	}
+	b = b.slice(int(length))
+	if id := b.uint32(); id != 0 {
+		return nil, fmt.Errorf("eh_frame entry at %#x is not a CIE", off)
+	}
+	c := new(ehCIE)
+	version := b.uint8()
+	if version != 1 && version != 3 {
+		return nil, fmt.Errorf("eh_frame CIE at %#x: unsupported version %d", off, version)
+	}
+	aug := b.string()
+	if len(aug) > 0 && aug[0] != 'z' {
+		return nil, fmt.Errorf("eh_frame CIE at %#x: unsupported augmentation %q", off, aug)
+	}
+	c.codeAlign = b.uint()
+	c.dataAlign = b.int()
+	if version == 1 {
+		c.returnAddress = int(b.uint8())
+	} else {
+		c.returnAddress = int(b.uint())
+	}
+	if c.augmented = len(aug) > 0; c.augmented {
+		data := b.slice(int(b.uint()))
+		for _, a := range aug[1:] {
+			switch a {
+			case 'R':
+				c.fdeEncoding = data.uint8()
+			case 'P':
+				f.pointer(&data, data.uint8())
+			case 'L':
+				data.uint8() // The encoding of the FDEs' LSDA pointers.
+			case 'S', 'B':
+			default:
+				return nil, fmt.Errorf("eh_frame CIE at %#x: unsupported augmentation %q", off, aug)
+			}
+		}
+	}
+	c.initial = b
+	return c, b.err
+}
+
+// pointer reads a pointer with the given encoding from b.
+func (f *EHFrame) pointer(b *buf, enc uint8) uint64 {
+	if enc == ehPtrOmit {
+		return 0
+	}
+	at := f.addr + uint64(b.off)
+	var v uint64
+	switch enc & 0x0f {
+	case ehPtrAbs:
+		v = b.addr()
+	case ehPtrULEB128:
+		v = b.uint()
+	case ehPtrUdata2:
+		v = uint64(b.uint16())
+	case ehPtrUdata4:
+		v = uint64(b.uint32())
+	case ehPtrUdata8:
+		v = b.uint64()
+	case ehPtrSLEB128:
+		v = uint64(b.int())
+	case ehPtrSdata2:
+		v = uint64(int16(b.uint16()))
+	case ehPtrSdata4:
+		v = uint64(int32(b.uint32()))
+	case ehPtrSdata8:
+		v = b.uint64()
+	default:
+		b.error(fmt.Sprintf("unsupported pointer encoding %#x", enc))
+		return 0
+	}
+	switch enc & 0x70 {
+	case 0:
+	case ehPtrPCRel:
+		v += at
+	default:
+		b.error(fmt.Sprintf("unsupported pointer encoding %#x", enc))
+	}
+	return v
+}
+
+// ehMachine runs the call frame instructions of a CIE and an FDE to find
+// the unwinding rule at a PC.  Unlike frameMachine, it follows the rules for
+// registers other than the stack pointer, as C code needs.
+type ehMachine struct {
+	f        *EHFrame
+	cie      *ehCIE
+	rule     *UnwindRule
+	location uint64
+	initial  map[int]int64 // The saved registers after the CIE's instructions.
+	stack    []UnwindRule  // Pushed by frameRememberState.
+}
+
+// run executes the instructions in b until the row for pc is complete.
+func (m *ehMachine) run(b *buf, pc uint64) error {
+	r := m.rule
+	for len(b.data) > 0 {
+		op := b.uint8()
+		switch op & 0xc0 {
+		case frameAdvanceLoc:
+			if !m.advance(uint64(op&0x3f), pc) {
+				return nil
+			}
+			continue
+		case frameOffset:
+			r.Saved[int(op&0x3f)] = int64(b.uint()) * m.cie.dataAlign
+			continue
+		case frameRestore:
+			m.restore(int(op & 0x3f))
+			continue
+		}
+		switch op {
+		case frameNop:
+		case frameSetLoc:
+			loc := m.f.pointer(b, m.cie.fdeEncoding)
+			if loc > pc {
+				return nil
+			}
+			m.location = loc
+		case frameAdvanceLoc1:
+			if !m.advance(uint64(b.uint8()), pc) {
+				return nil
+			}
+		case frameAdvanceLoc2:
+			if !m.advance(uint64(b.uint16()), pc) {
+				return nil
+			}
+		case frameAdvanceLoc4:
+			if !m.advance(uint64(b.uint32()), pc) {
+				return nil
+			}
+		case frameDefCFA:
+			r.CFARegister = int(b.uint())
+			r.CFAOffset = int64(b.uint())
+		case frameDefCFASf:
+			r.CFARegister = int(b.uint())
+			r.CFAOffset = b.int() * m.cie.dataAlign
+		case frameDefCFARegister:
+			r.CFARegister = int(b.uint())
+		case frameDefCFAOffset:
+			r.CFAOffset = int64(b.uint())
+		case frameDefCFAOffsetSf:
+			r.CFAOffset = b.int() * m.cie.dataAlign
+		case frameOffsetExtended:
+			reg := int(b.uint())
+			r.Saved[reg] = int64(b.uint()) * m.cie.dataAlign
+		case frameOffsetExtendedSf:
+			reg := int(b.uint())
+			r.Saved[reg] = b.int() * m.cie.dataAlign
+		case frameRestoreExtended:
+			m.restore(int(b.uint()))
+		case frameUndefined, frameSameValue:
+			delete(r.Saved, int(b.uint()))
+		case frameRegister, frameValOffset, frameValOffsetSf:
+			// Registers kept in other registers, or computed from the
+			// CFA, aren't needed for unwinding through C code.
+			delete(r.Saved, int(b.uint()))
+			b.uint()
+		case frameExpression, frameValExpression:
+			delete(r.Saved, int(b.uint()))
+			b.skip(int(b.uint()))
+		case frameRememberState:
+			saved := *r
+			saved.Saved = copySaved(r.Saved)
+			m.stack = append(m.stack, saved)
+		case frameRestoreState:
+			if len(m.stack) == 0 {
+				return fmt.Errorf("eh_frame: restore_state without remember_state")
+			}
+			saved := m.stack[len(m.stack)-1]
+			m.stack = m.stack[:len(m.stack)-1]
+			r.CFARegister, r.CFAOffset, r.Saved = saved.CFARegister, saved.CFAOffset, saved.Saved
+		case frameGNUArgsSize:
+			b.uint()
+		case frameDefCFAExpression:
+			return fmt.Errorf("eh_frame: unsupported CFA expression at PC %#x", pc)
+		default:
+			return fmt.Errorf("eh_frame: unknown frame op %#x", op)
+		}
+	}
+	return b.err
+}
+
+// advance moves the location on by delta code alignment units, and reports
+// whether it is still at or before pc, so the instructions that follow
+// apply to it.
+func (m *ehMachine) advance(delta, pc uint64) bool {
+	m.location += delta * m.cie.codeAlign
+	return m.location <= pc
+}
+
+// restore makes the rule for register reg that of the CIE's instructions.
+func (m *ehMachine) restore(reg int) {
+	if off, ok := m.initial[reg]; ok {
+		m.rule.Saved[reg] = off
+	} else {
+		delete(m.rule.Saved, reg)
+	}
+}
+
+func copySaved(saved map[int]int64) map[int]int64 {
+	c := make(map[int]int64, len(saved))
+	for reg, off := range saved {
+		c[reg] = off
+	}
+	return c
+}
@@ -0,0 +1,59 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dwarf_test
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/debug/dwarf"
+	"golang.org/x/debug/elf"
+)
+
+func TestUnwindRule(t *testing.T) {
+	f, err := elf.Open("testdata/typedef.elf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	s := f.Section(".eh_frame")
+	if s == nil {
+		t.Fatal("no .eh_frame section")
+	}
+	data, err := s.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := dwarf.NewEHFrame(data, s.Addr, f.ByteOrder, 8)
+
+	const rsp, rbp, rbx, rip = 7, 6, 3, 16
+	for _, test := range []struct {
+		pc   uint64
+		want dwarf.UnwindRule
+	}{
+		// main's frame, which uses the frame pointer after its prologue.
+		{0x4004c4, dwarf.UnwindRule{Start: 0x4004c4, End: 0x4004cf, CFARegister: rsp, CFAOffset: 8, Saved: map[int]int64{rip: -8}}},
+		{0x4004c5, dwarf.UnwindRule{Start: 0x4004c4, End: 0x4004cf, CFARegister: rsp, CFAOffset: 16, Saved: map[int]int64{rip: -8}}},
+		{0x4004ce, dwarf.UnwindRule{Start: 0x4004c4, End: 0x4004cf, CFARegister: rbp, CFAOffset: 16, Saved: map[int]int64{rip: -8, rbp: -16}}},
+		// __libc_csu_fini, which has no instructions of its own.
+		{0x4004d1, dwarf.UnwindRule{Start: 0x4004d0, End: 0x4004d2, CFARegister: rsp, CFAOffset: 8, Saved: map[int]int64{rip: -8}}},
+		// __libc_csu_init, which saves several registers.
+		{0x400516, dwarf.UnwindRule{Start: 0x4004e0, End: 0x400569, CFARegister: rsp, CFAOffset: 64,
+			Saved: map[int]int64{rip: -8, rbp: -48, rbx: -56, 12: -40, 13: -32, 14: -24, 15: -16}}},
+	} {
+		test.want.ReturnAddress = rip
+		rule, err := frame.UnwindRule(test.pc)
+		if err != nil {
+			t.Errorf("UnwindRule(%#x): %v", test.pc, err)
+			continue
+		}
+		if !reflect.DeepEqual(*rule, test.want) {
+			t.Errorf("UnwindRule(%#x) = %+v; want %+v", test.pc, *rule, test.want)
+		}
+	}
+	if rule, err := frame.UnwindRule(0x400000); err == nil {
+		t.Errorf("UnwindRule(0x400000) = %+v; want an error", *rule)
+	}
+}
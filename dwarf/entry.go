@@ -25,6 +25,7 @@ type abbrev struct {
 type afield struct {
 	attr Attr
 	fmt  format
+	val  int64 // value of a formImplicitConst attribute
 }
 
 // a map from entry format ids to their descriptions
@@ -66,6 +67,9 @@ func (d *Data) parseAbbrev(off uint32) (abbrevTable, error) {
 			if tag == 0 && fmt == 0 {
 				break
 			}
+			if format(fmt) == formImplicitConst {
+				b1.int()
+			}
 			n++
 		}
 		if b1.err != nil {
@@ -80,6 +84,9 @@ func (d *Data) parseAbbrev(off uint32) (abbrevTable, error) {
 		for i := range a.field {
 			a.field[i].attr = Attr(b.uint())
 			a.field[i].fmt = format(b.uint())
+			if a.field[i].fmt == formImplicitConst {
+				a.field[i].val = b.int()
+			}
 		}
 		b.uint()
 		b.uint()
@@ -160,6 +167,8 @@ func (b *buf) entry(atab abbrevTable, ubase Offset) *Entry {
 		// address
 		case formAddr:
 			val = b.addr()
+		case formAddrx, formAddrx1, formAddrx2, formAddrx3, formAddrx4:
+			val = b.index(fmt, func(u *unit, i uint64) (interface{}, error) { return b.dwarf.addrx(u, i) })
 
 		// block
 		case formDwarfBlock1:
@@ -184,6 +193,10 @@ func (b *buf) entry(atab abbrevTable, ubase Offset) *Entry {
 			val = int64(b.int())
 		case formUdata:
 			val = int64(b.uint())
+		case formData16:
+			val = b.bytes(16)
+		case formImplicitConst:
+			val = a.field[i].val
 
 		// flag
 		case formFlag:
@@ -221,6 +234,10 @@ func (b *buf) entry(atab abbrevTable, ubase Offset) *Entry {
 			val = Offset(b.uint64()) + ubase
 		case formRefUdata:
 			val = Offset(b.uint()) + ubase
+		case formRefSup4:
+			val = Offset(b.uint32())
+		case formRefSup8:
+			val = Offset(b.uint64())
 
 		// string
 		case formString:
@@ -237,6 +254,35 @@ func (b *buf) entry(atab abbrevTable, ubase Offset) *Entry {
 				b.err = b1.err
 				return nil
 			}
+		case formLineStrp:
+			off := b.unitOffset() // offset into .debug_line_str
+			if b.err != nil {
+				return nil
+			}
+			s, err := b.dwarf.stringAt("line_str", b.dwarf.lineStr, off)
+			if err != nil {
+				b.error(err.Error())
+				return nil
+			}
+			val = s
+		case formStrx, formStrx1, formStrx2, formStrx3, formStrx4:
+			val = b.index(fmt, func(u *unit, i uint64) (interface{}, error) { return b.dwarf.strx(u, i) })
+		case formStrpSup:
+			// The string is in a supplementary object file, which isn't
+			// read.
+			val = int64(b.unitOffset())
+
+		// Indexes of range and location lists, which are resolved to
+		// their offsets in .debug_rnglists and .debug_loclists.
+		// New in DWARF 5.
+		case formRnglistx:
+			val = b.index(fmt, func(u *unit, i uint64) (interface{}, error) {
+				return b.dwarf.listx(u, "rnglists", b.dwarf.rnglists, u.rnglistsBase, i)
+			})
+		case formLoclistx:
+			val = b.index(fmt, func(u *unit, i uint64) (interface{}, error) {
+				return b.dwarf.listx(u, "loclists", b.dwarf.loclists, u.loclistsBase, i)
+			})
 
 		// lineptr, loclistptr, macptr, rangelistptr
 		// New in DWARF 4, but clang can generate them with -gdwarf-2.
@@ -270,6 +316,43 @@ func (b *buf) entry(atab abbrevTable, ubase Offset) *Entry {
 	return e
 }
 
+// index reads the index in an attribute of format fmt, one of the DWARF 5
+// forms indexing into a table in another section, and resolves it with
+// lookup.  While a unit's bases are unknown, which is while its first entry
+// is read to find them, the index is returned as is.
+func (b *buf) index(fmt format, lookup func(u *unit, i uint64) (interface{}, error)) interface{} {
+	var i uint64
+	switch fmt {
+	case formStrx1, formAddrx1:
+		i = uint64(b.uint8())
+	case formStrx2, formAddrx2:
+		i = uint64(b.uint16())
+	case formStrx3, formAddrx3:
+		i = uint64(b.uint24())
+	case formStrx4, formAddrx4:
+		i = uint64(b.uint32())
+	default:
+		i = b.uint()
+	}
+	if b.err != nil {
+		return nil
+	}
+	u := unitOf(b.format)
+	if u == nil {
+		b.error("index form 0x" + strconv.FormatInt(int64(fmt), 16) + " outside a unit")
+		return nil
+	}
+	if !u.basesKnown {
+		return i
+	}
+	val, err := lookup(u, i)
+	if err != nil {
+		b.error(err.Error())
+		return nil
+	}
+	return val
+}
+
 // A Reader allows reading Entry structures from a DWARF ``info'' section.
 // The Entry structures are arranged in a tree.  The Reader's Next function
 // return successive entries from a pre-order traversal of the tree.
@@ -0,0 +1,86 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dwarf
+
+// This file handles the names of instantiations of generic functions and
+// types, which have their type arguments in square brackets.  The compiler
+// makes one instantiation for each shape of type arguments, and names the
+// shapes with the prefix "go.shape.": main.Max[go.shape.int] is the copy of
+// main.Max for type arguments whose underlying type is int.
+
+import (
+	"sort"
+	"strings"
+)
+
+const shapePrefix = "go.shape."
+
+// GenericName returns name without the type arguments of the generic
+// functions and types in it: main.List[go.shape.int].Len becomes
+// main.List.Len.  Other names are returned unchanged.
+func GenericName(name string) string {
+	if !strings.Contains(name, "[") {
+		return name
+	}
+	var b strings.Builder
+	depth := 0
+	for _, c := range name {
+		switch {
+		case c == '[':
+			depth++
+		case c == ']' && depth > 0:
+			depth--
+		case depth == 0:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// DemangleShapes returns name with the shapes in it written as the types
+// they stand for: main.Max[go.shape.int] becomes main.Max[int].
+func DemangleShapes(name string) string {
+	return strings.Replace(name, shapePrefix, "", -1)
+}
+
+// instantiations maps the names of generic functions, written both without
+// type arguments and with demangled shapes, to the names of their
+// instantiations.
+type instantiations map[string][]string
+
+// buildInstantiations indexes the instantiations of generic functions in
+// nameCache.
+func (d *Data) buildInstantiations() {
+	d.instantiations = make(instantiations)
+	for name, x := range d.nameCache {
+		if !strings.Contains(name, "[") {
+			continue
+		}
+		for ; x != nil; x = x.link {
+			if x.entry.Tag == TagSubprogram {
+				break
+			}
+		}
+		if x == nil {
+			continue
+		}
+		d.instantiations[GenericName(name)] = append(d.instantiations[GenericName(name)], name)
+		if demangled := DemangleShapes(name); demangled != name {
+			d.instantiations[demangled] = append(d.instantiations[demangled], name)
+		}
+	}
+	for _, names := range d.instantiations {
+		sort.Strings(names)
+	}
+}
+
+// LookupInstantiations returns the names of the instantiations of the
+// generic function with the given name, in order.  The name can be written
+// without type arguments, as main.Max, or with the types of an
+// instantiation's shapes, as main.Max[int].  It returns nil if there are
+// none.
+func (d *Data) LookupInstantiations(name string) []string {
+	return d.instantiations[name]
+}
@@ -0,0 +1,50 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dwarf_test
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/debug/dwarf"
+)
+
+func TestGenericNames(t *testing.T) {
+	for _, test := range []struct {
+		name, generic, demangled string
+	}{
+		{"main.f", "main.f", "main.f"},
+		{"main.Max[go.shape.int]", "main.Max", "main.Max[int]"},
+		{"main.List[go.shape.string].Len", "main.List.Len", "main.List[string].Len"},
+		{"main.F[go.shape.map[string]int,go.shape.*uint8]", "main.F", "main.F[map[string]int,*uint8]"},
+		{"example.com/p.G[go.shape.struct { example.com/q.X int }]", "example.com/p.G", "example.com/p.G[struct { example.com/q.X int }]"},
+	} {
+		if got := dwarf.GenericName(test.name); got != test.generic {
+			t.Errorf("GenericName(%q) = %q; want %q", test.name, got, test.generic)
+		}
+		if got := dwarf.DemangleShapes(test.name); got != test.demangled {
+			t.Errorf("DemangleShapes(%q) = %q; want %q", test.name, got, test.demangled)
+		}
+	}
+}
+
+func TestLookupInstantiations(t *testing.T) {
+	data := buildTestProgram(t, "linetest.go", "-gcflags=-N -l")
+
+	all := []string{"main.first[go.shape.int]", "main.first[go.shape.string]"}
+	for _, test := range []struct {
+		name string
+		want []string
+	}{
+		{"main.first", all},
+		{"main.first[string]", all[1:]},
+		{"main.first[go.shape.int]", nil},
+		{"main.main", nil},
+	} {
+		if got := data.LookupInstantiations(test.name); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("LookupInstantiations(%q) = %q; want %q", test.name, got, test.want)
+		}
+	}
+}
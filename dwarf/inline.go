@@ -0,0 +1,238 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dwarf
+
+// This file finds the calls that the compiler inlined, from the
+// inlined-subroutine entries in the functions they were inlined into.
+
+import (
+	"fmt"
+	"sort"
+
+	"golang.org/x/debug"
+)
+
+// An InlinedCall is a call of a function that the compiler inlined into
+// another.
+type InlinedCall struct {
+	// Function is the name of the inlined function.
+	Function string
+	// Entry is the inlined-subroutine entry describing the call.
+	Entry *Entry
+	// Ranges are the [low, high) ranges of the addresses of the inlined
+	// code, in order.
+	Ranges [][2]uint64
+	// CallFile and CallLine are where the function was called.
+	CallFile string
+	CallLine uint64
+	// Depth is how many other inlined calls this one is inside, in the
+	// function it was inlined into.
+	Depth int
+}
+
+// EntryPC returns the first address of the inlined code.
+func (c *InlinedCall) EntryPC() uint64 {
+	return c.Ranges[0][0]
+}
+
+// ResolveOrigin returns e, or if e is a concrete instance of an abstract
+// entry, such as a parameter of an inlined or out-of-line copy of a function
+// the compiler inlined, a copy of e with the attributes of the abstract entry
+// that e lacks, such as its name and type.
+func (d *Data) ResolveOrigin(e *Entry) (*Entry, error) {
+	off, ok := e.Val(AttrAbstractOrigin).(Offset)
+	if !ok {
+		return e, nil
+	}
+	r := d.Reader()
+	r.Seek(off)
+	origin, err := r.Next()
+	if err != nil {
+		return e, err
+	}
+	if origin == nil {
+		return e, fmt.Errorf("no abstract origin at offset %d", off)
+	}
+	c := *e
+	c.Field = append([]Field(nil), e.Field...)
+	for _, f := range origin.Field {
+		if f.Attr != AttrInline && c.Val(f.Attr) == nil {
+			c.Field = append(c.Field, f)
+		}
+	}
+	return &c, nil
+}
+
+// inlineCache holds the program's inlined calls, by the offset of the entry of
+// the function they were inlined into, and by the name of the inlined
+// function.
+type inlineCache struct {
+	byFunc map[Offset][]*InlinedCall
+	byName map[string][]*InlinedCall
+}
+
+// InlinedCallsAt returns the inlined calls whose code contains pc, innermost
+// first.
+func (d *Data) InlinedCallsAt(pc uint64) []*InlinedCall {
+	entry, _, err := d.PCToFunction(pc)
+	if err != nil {
+		return nil
+	}
+	d.inlineOnce.Do(d.buildInlineCache)
+	var calls []*InlinedCall
+	for _, c := range d.inlined.byFunc[entry.Offset] {
+		for _, r := range c.Ranges {
+			if r[0] <= pc && pc < r[1] {
+				calls = append(calls, c)
+				break
+			}
+		}
+	}
+	sort.SliceStable(calls, func(i, j int) bool { return calls[i].Depth > calls[j].Depth })
+	return calls
+}
+
+// InlinedCallsOf returns the calls of the named function that the compiler
+// inlined, in order of their addresses.
+func (d *Data) InlinedCallsOf(name string) []*InlinedCall {
+	d.inlineOnce.Do(d.buildInlineCache)
+	return d.inlined.byName[name]
+}
+
+// buildInlineCache walks the children of every function, recording the
+// inlined calls among them.  It logs and otherwise swallows any errors in
+// parsing.
+func (d *Data) buildInlineCache() {
+	d.inlined = inlineCache{
+		byFunc: make(map[Offset][]*InlinedCall),
+		byName: make(map[string][]*InlinedCall),
+	}
+	b := inlineBuilder{d: d, names: make(map[Offset]string)}
+	r := d.Reader()
+	for {
+		cu, err := r.Next()
+		if cu == nil || err != nil {
+			logInlineError(err)
+			break
+		}
+		if cu.Tag != TagCompileUnit {
+			r.SkipChildren()
+			continue
+		}
+		b.files = nil
+		if off, ok := cu.Val(AttrStmtList).(int64); ok {
+			b.files = d.lineFiles[Offset(off)]
+		}
+		if err := b.children(r, nil, 0); err != nil {
+			logInlineError(err)
+			break
+		}
+	}
+	for _, calls := range d.inlined.byName {
+		sort.Slice(calls, func(i, j int) bool { return calls[i].EntryPC() < calls[j].EntryPC() })
+	}
+}
+
+// An inlineBuilder records the inlined calls in a compilation unit.
+type inlineBuilder struct {
+	d     *Data
+	files []uint64          // The indexes in sourceFiles of the unit's files.
+	names map[Offset]string // The names of abstract function entries.
+}
+
+// children records the inlined calls among the children of the entry last
+// read by r, which are in the function with entry fn, if it isn't nil, and
+// inside depth inlined calls.
+func (b *inlineBuilder) children(r *Reader, fn *Entry, depth int) error {
+	for {
+		e, err := r.Next()
+		if err != nil {
+			return err
+		}
+		if e == nil || e.Tag == 0 {
+			return nil
+		}
+		switch {
+		case fn == nil && e.Tag == TagSubprogram:
+			if e.Children {
+				if err := b.children(r, e, 0); err != nil {
+					return err
+				}
+			}
+		case fn != nil && e.Tag == TagInlinedSubroutine:
+			b.add(fn, e, depth)
+			if e.Children {
+				if err := b.children(r, fn, depth+1); err != nil {
+					return err
+				}
+			}
+		case fn != nil && e.Tag == TagLexDwarfBlock:
+			if e.Children {
+				if err := b.children(r, fn, depth); err != nil {
+					return err
+				}
+			}
+		default:
+			r.SkipChildren()
+		}
+	}
+}
+
+// add records the inlined call described by entry e, in the function with
+// entry fn.
+func (b *inlineBuilder) add(fn, e *Entry, depth int) {
+	d := b.d
+	origin, ok := e.Val(AttrAbstractOrigin).(Offset)
+	if !ok {
+		return
+	}
+	ranges, err := d.EntryRanges(e)
+	if err != nil || len(ranges) == 0 {
+		return
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i][0] < ranges[j][0] })
+	c := &InlinedCall{
+		Function: b.name(origin),
+		Entry:    e,
+		Ranges:   ranges,
+		Depth:    depth,
+	}
+	if c.Function == "" {
+		return
+	}
+	if f, ok := e.Val(AttrCallFile).(int64); ok && f >= 0 && f < int64(len(b.files)) {
+		if n := b.files[f]; n < uint64(len(d.sourceFiles)) {
+			c.CallFile = d.sourceFiles[n]
+		}
+	}
+	if l, ok := e.Val(AttrCallLine).(int64); ok && l > 0 {
+		c.CallLine = uint64(l)
+	}
+	d.inlined.byFunc[fn.Offset] = append(d.inlined.byFunc[fn.Offset], c)
+	d.inlined.byName[c.Function] = append(d.inlined.byName[c.Function], c)
+}
+
+// name returns the name of the abstract function entry at off.
+func (b *inlineBuilder) name(off Offset) string {
+	if name, ok := b.names[off]; ok {
+		return name
+	}
+	r := b.d.Reader()
+	r.Seek(off)
+	var name string
+	if e, err := r.Next(); err == nil && e != nil {
+		name, _ = e.Val(AttrName).(string)
+	}
+	b.names[off] = name
+	return name
+}
+
+// logInlineError logs an error that stopped buildInlineCache reading
+// .debug_info.
+func logInlineError(err error) {
+	if err != nil {
+		debug.Log(debug.LevelWarn, "DWARF info unreadable; later inlined calls are missing", debug.Field{Key: "err", Value: err})
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dwarf_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"golang.org/x/debug/dwarf"
+)
+
+// buildTestProgram builds the program in the file src in testdata, with the
+// given extra arguments to go build, and returns its DWARF data.
+func buildTestProgram(t *testing.T, src string, args ...string) *dwarf.Data {
+	if runtime.GOOS != "linux" {
+		t.Skip("only reads ELF executables")
+	}
+	dir, err := ioutil.TempDir("", "dwarftest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	binary := filepath.Join(dir, strings.TrimSuffix(src, ".go"))
+	args = append(append([]string{"build", "-o", binary}, args...), filepath.Join("testdata", src))
+	cmd := exec.Command("go", args...)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("building testdata/%s: %v", src, err)
+	}
+	data, err := getData(binary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestInlinedCalls(t *testing.T) {
+	data := buildTestProgram(t, "inlinetest.go")
+
+	calls := data.InlinedCallsOf("main.add")
+	if len(calls) == 0 {
+		t.Fatal("InlinedCallsOf(main.add): no calls")
+	}
+	c := calls[0]
+	if c.Function != "main.add" || !strings.HasSuffix(c.CallFile, "inlinetest.go") || c.CallLine != 13 || c.Depth != 0 {
+		t.Errorf("InlinedCallsOf(main.add)[0] = %s called at %s:%d, depth %d; want it called at inlinetest.go:13, depth 0",
+			c.Function, c.CallFile, c.CallLine, c.Depth)
+	}
+	at := data.InlinedCallsAt(c.EntryPC())
+	if len(at) == 0 || at[0] != c {
+		t.Errorf("InlinedCallsAt(%#x) = %v; want the call of main.add first", c.EntryPC(), at)
+	}
+	entry, _, err := data.PCToFunction(c.EntryPC())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fn, _ := entry.Val(dwarf.AttrName).(string); fn != "main.double" {
+		t.Errorf("PCToFunction(%#x) = %s; want main.double", c.EntryPC(), fn)
+	}
+
+	// The out-of-line copy of add has its name from the abstract entry.
+	entry, err = data.LookupFunction("main.add")
+	if err != nil {
+		t.Fatal(err)
+	}
+	low, ok := entry.Val(dwarf.AttrLowpc).(uint64)
+	if !ok {
+		t.Fatal("LookupFunction(main.add) returned an entry without code")
+	}
+	if entry, _, err := data.PCToFunction(low); err != nil || entry.Val(dwarf.AttrName) != "main.add" {
+		t.Errorf("PCToFunction(%#x) = %v, %v; want main.add", low, entry, err)
+	}
+
+	if calls := data.InlinedCallsOf("main.nosuch"); len(calls) != 0 {
+		t.Errorf("InlinedCallsOf(main.nosuch) = %v; want none", calls)
+	}
+}
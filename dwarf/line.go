@@ -10,8 +10,11 @@ package dwarf
 // http://www.dwarfstd.org/doc/DWARF4.pdf Section 6.2 page 108
 
 import (
+	"errors"
 	"fmt"
+	"path"
 	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -41,10 +44,126 @@ func (d *Data) PCToLine(pc uint64) (file string, line uint64, err error) {
 	return d.sourceFiles[c[i].file], c[i].line, nil
 }
 
+// A LineRange is a span of instructions, from Low up to but not including
+// High, that the line table attributes to one source line.
+type LineRange struct {
+	Low, High uint64
+	File      string
+	Line      uint64
+}
+
+// LineTable returns the spans of instructions in the line table, in order of
+// address.
+func (d *Data) LineTable() []LineRange {
+	c := d.pcToLineEntries
+	var ranges []LineRange
+	for i := 0; i+1 < len(c); i++ {
+		// An entry with file number zero only marks the end of a span.
+		if c[i].file == 0 || c[i].file >= uint64(len(d.sourceFiles)) {
+			continue
+		}
+		ranges = append(ranges, LineRange{
+			Low:  c[i].pc,
+			High: c[i+1].pc,
+			File: d.sourceFiles[c[i].file],
+			Line: c[i].line,
+		})
+	}
+	return ranges
+}
+
+// SourceFiles returns the names of the source files in the line table, in
+// order.
+func (d *Data) SourceFiles() []string {
+	seen := make(map[string]bool)
+	var files []string
+	for _, f := range d.sourceFiles {
+		if f != "" && !seen[f] {
+			seen[f] = true
+			files = append(files, f)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
 // LineToBreakpointPCs returns the PCs that should be used as breakpoints
 // corresponding to the given file and line number.
 // It returns an empty slice if no PCs were found.
+//
+// The PCs are in order, and include those of every copy of the line's code,
+// such as in each instantiation of a generic function and in each place a
+// function was inlined.  Only PCs that start a statement are used, if the
+// line has any, and of those only the first in each range of addresses with
+// code for the line, so that the program stops once each time it reaches
+// the line, even if the line has more than one statement.
 func (d *Data) LineToBreakpointPCs(file string, line uint64) ([]uint64, error) {
+	fileNum, err := d.matchSourceFile(file)
+	if err != nil {
+		return nil, err
+	}
+	c := d.lineToPCEntries[fileNum]
+	// c contains all (pc, line) pairs for the appropriate file.
+	start := sort.Search(len(c), func(i int) bool { return c[i].line >= line })
+	end := sort.Search(len(c), func(i int) bool { return c[i].line > line })
+	// c[i].line == line for all i in the range [start, end).
+	stmts := false
+	for i := start; i < end; i++ {
+		stmts = stmts || c[i].stmt
+	}
+	var pcs []uint64
+	for i := start; i < end; i++ {
+		if c[i].stmt || !stmts {
+			pcs = append(pcs, c[i].pc)
+		}
+	}
+	sort.Slice(pcs, func(i, j int) bool { return pcs[i] < pcs[j] })
+
+	// Keep the first PC in each range of the line's code.
+	out := make([]uint64, 0, len(pcs))
+	var prevRange uint64
+	for i, pc := range pcs {
+		r := d.lineRangeStart(pc)
+		if i > 0 && (pc == pcs[i-1] || r == prevRange) {
+			continue
+		}
+		out = append(out, pc)
+		prevRange = r
+	}
+	return out, nil
+}
+
+// lineRangeStart returns the first address of the range of addresses with
+// code for the same line as pc.
+func (d *Data) lineRangeStart(pc uint64) uint64 {
+	p := d.pcToLineEntries
+	i := sort.Search(len(p), func(i int) bool { return p[i].pc > pc })
+	if i == 0 {
+		return pc
+	}
+	return p[i-1].pc
+}
+
+// StatementLines returns the name of the source file that best matches file,
+// as LineToBreakpointPCs chooses it, and the numbers of its lines that have
+// code, in order.
+func (d *Data) StatementLines(file string) (string, []uint64, error) {
+	fileNum, err := d.matchSourceFile(file)
+	if err != nil {
+		return "", nil, err
+	}
+	var lines []uint64
+	for _, e := range d.lineToPCEntries[fileNum] {
+		if n := len(lines); n == 0 || lines[n-1] != e.line {
+			lines = append(lines, e.line)
+		}
+	}
+	return d.sourceFiles[fileNum], lines, nil
+}
+
+// matchSourceFile returns the number of the source file in the line table
+// that is the closest match for file.
+func (d *Data) matchSourceFile(file string) (uint64, error) {
 	compDir := d.compilationDirectory()
 
 	// Find the closest match in the executable for the specified file.
@@ -78,19 +197,9 @@ func (d *Data) LineToBreakpointPCs(file string, line uint64) ([]uint64, error) {
 		}
 	}
 	if bestFile.components == 0 {
-		return nil, fmt.Errorf("couldn't find file %q", file)
-	}
-
-	c := d.lineToPCEntries[bestFile.fileNum]
-	// c contains all (pc, line) pairs for the appropriate file.
-	start := sort.Search(len(c), func(i int) bool { return c[i].line >= line })
-	end := sort.Search(len(c), func(i int) bool { return c[i].line > line })
-	// c[i].line == line for all i in the range [start, end).
-	pcs := make([]uint64, 0, end-start)
-	for i := start; i < end; i++ {
-		pcs = append(pcs, c[i].pc)
+		return 0, fmt.Errorf("couldn't find file %q", file)
 	}
-	return pcs, nil
+	return bestFile.fileNum, nil
 }
 
 // compilationDirectory finds the first compilation unit entry in d and returns
@@ -257,28 +366,82 @@ type lineMachine struct {
 	header lineHeader
 }
 
-// parseHeader parses the header describing the compilation unit in the line
-// table starting at the specified offset.
-func (m *lineMachine) parseHeader(b *buf) error {
+// lineFormat is the data format of a line number program, which its header
+// gives.
+type lineFormat struct {
+	vers  int
+	is64  bool
+	asize int
+}
+
+func (f lineFormat) version() int          { return f.vers }
+func (f lineFormat) dwarf64() (bool, bool) { return f.is64, true }
+func (f lineFormat) addrsize() int         { return f.asize }
+
+// parseHeader parses the header of the line number program at the start of
+// b, and returns the program's opcodes, advancing b past them.  Before
+// DWARF 5, where the header doesn't give the size of an address, it is
+// taken from b's format.
+func (m *lineMachine) parseHeader(b *buf) (buf, error) {
 	m.header = lineHeader{}
-	m.header.unitLength = int(b.uint32()) // Note: We are assuming 32-bit DWARF format.
-	if m.header.unitLength > len(b.data) {
-		return fmt.Errorf("DWARF: bad PC/line header length")
+	unitLength := uint64(b.uint32())
+	is64 := false
+	if unitLength == 0xffffffff {
+		is64 = true
+		unitLength = b.uint64()
+	}
+	if unitLength > uint64(len(b.data)) {
+		return buf{}, fmt.Errorf("DWARF: bad PC/line header length")
+	}
+	m.header.unitLength = int(unitLength)
+	u := b.slice(int(unitLength))
+	m.header.version = int(u.uint16())
+	if m.header.version < 2 || m.header.version > 5 {
+		return buf{}, fmt.Errorf("DWARF: unsupported line table version %d", m.header.version)
+	}
+	f := lineFormat{vers: m.header.version, is64: is64, asize: b.format.addrsize()}
+	if m.header.version >= 5 {
+		f.asize = int(u.uint8())
+		u.uint8() // segment selector size
 	}
-	m.header.version = int(b.uint16())
-	m.header.headerLength = int(b.uint32())
-	m.header.minInstructionLength = int(b.uint8())
+	u.format = f
+	headerLength := u.unitOffset()
+	if u.err != nil || headerLength > uint64(len(u.data)) {
+		return buf{}, fmt.Errorf("DWARF: bad PC/line header length")
+	}
+	m.header.headerLength = int(headerLength)
+	h := u.slice(int(headerLength))
+	m.header.minInstructionLength = int(h.uint8())
 	if m.header.version >= 4 {
-		m.header.maxOpsPerInstruction = int(b.uint8())
+		m.header.maxOpsPerInstruction = int(h.uint8())
 	} else {
 		m.header.maxOpsPerInstruction = 1
 	}
-	m.header.defaultIsStmt = b.uint8() != 0
-	m.header.lineBase = int(int8(b.uint8()))
-	m.header.lineRange = int(b.uint8())
-	m.header.opcodeBase = b.uint8()
+	m.header.defaultIsStmt = h.uint8() != 0
+	m.header.lineBase = int(int8(h.uint8()))
+	m.header.lineRange = int(h.uint8())
+	m.header.opcodeBase = h.uint8()
+	if m.header.opcodeBase == 0 {
+		return buf{}, fmt.Errorf("DWARF: bad PC/line opcode base")
+	}
 	m.header.stdOpcodeLengths = make([]byte, m.header.opcodeBase-1)
-	copy(m.header.stdOpcodeLengths, b.bytes(int(m.header.opcodeBase-1)))
+	copy(m.header.stdOpcodeLengths, h.bytes(int(m.header.opcodeBase-1)))
+	if m.header.version >= 5 {
+		if err := m.parseEntriesV5(&h); err != nil {
+			return buf{}, err
+		}
+	} else {
+		m.parseEntries(&h)
+	}
+	if h.err != nil {
+		return buf{}, h.err
+	}
+	return u, u.err
+}
+
+// parseEntries parses the include directories and file names of a line
+// table header before DWARF 5.
+func (m *lineMachine) parseEntries(b *buf) {
 	m.header.include = make([]string, 1) // First entry is empty; file index entries are 1-indexed.
 	// Includes
 	for {
@@ -306,7 +469,99 @@ func (m *lineMachine) parseHeader(b *buf) error {
 		}
 		m.header.file = append(m.header.file, f)
 	}
-	return nil
+}
+
+// parseEntriesV5 parses the directories and file names of a DWARF 5 line
+// table header.  Both are described by a list of the content types and forms
+// of their fields, and are indexed from zero.
+func (m *lineMachine) parseEntriesV5(b *buf) error {
+	dirs, err := parseLineEntryTable(b)
+	if err != nil {
+		return err
+	}
+	for _, d := range dirs {
+		m.header.include = append(m.header.include, d.name)
+	}
+	m.header.file, err = parseLineEntryTable(b)
+	return err
+}
+
+// parseLineEntryTable parses a DWARF 5 directory or file name table.
+func parseLineEntryTable(b *buf) ([]lineFile, error) {
+	type field struct{ content, form uint64 }
+	fields := make([]field, b.uint8())
+	for i := range fields {
+		fields[i] = field{b.uint(), b.uint()}
+	}
+	n := b.uint()
+	if n > uint64(len(b.data)) {
+		return nil, fmt.Errorf("DWARF: bad PC/line entry count")
+	}
+	entries := make([]lineFile, n)
+	for i := range entries {
+		for _, f := range fields {
+			str, val, err := readLineField(b, format(f.form))
+			if err != nil {
+				return nil, err
+			}
+			switch f.content {
+			case lnctPath:
+				entries[i].name = str
+			case lnctDirectoryIndex:
+				entries[i].index = int(val)
+			case lnctTimestamp:
+				entries[i].time = int(val)
+			case lnctSize:
+				entries[i].length = int(val)
+			}
+		}
+	}
+	return entries, b.err
+}
+
+// readLineField reads a field of form fmt in a DWARF 5 line table header,
+// returning its value as a string or a number as the form suits.
+func readLineField(b *buf, fmt format) (string, uint64, error) {
+	switch fmt {
+	case formString:
+		return b.string(), 0, nil
+	case formLineStrp:
+		s, err := b.dwarf.stringAt("line_str", b.dwarf.lineStr, b.unitOffset())
+		return s, 0, err
+	case formStrp:
+		s, err := b.dwarf.stringAt("str", b.dwarf.str, b.unitOffset())
+		return s, 0, err
+	case formUdata:
+		return "", b.uint(), nil
+	case formData1:
+		return "", uint64(b.uint8()), nil
+	case formData2:
+		return "", uint64(b.uint16()), nil
+	case formData4:
+		return "", uint64(b.uint32()), nil
+	case formData8:
+		return "", b.uint64(), nil
+	case formData16:
+		b.skip(16)
+		return "", 0, nil
+	case formDwarfBlock:
+		b.skip(int(b.uint()))
+		return "", 0, nil
+	}
+	return "", 0, errors.New("DWARF: unsupported form 0x" + strconv.FormatInt(int64(fmt), 16) + " in PC/line header")
+}
+
+// fileName returns the name of file f, joined to the name of its directory
+// if it is relative.
+func (m *lineMachine) fileName(f lineFile) string {
+	if f.name == "" || path.IsAbs(f.name) || f.index < 0 || f.index >= len(m.header.include) {
+		return f.name
+	}
+	dir := m.header.include[f.index]
+	if dir == "" {
+		return f.name
+	}
+	return path.Join(dir, f.name)
 }
 
 // Special opcodes, page 117.
@@ -425,7 +680,11 @@ func (m *lineMachine) evalCompilationUnit(b *buf, f func(m *lineMachine) (cont b
 			// Update the the address and op_index registers.
 			m.specialOpcodeStep2(255)
 		default:
-			panic("not reached")
+			// An opcode this package doesn't know, whose operands
+			// the header counts.
+			for i := byte(0); i < m.header.stdOpcodeLengths[op-1]; i++ {
+				b.uint()
+			}
 		}
 	}
 	return fmt.Errorf("DWARF: unexpected end of line number information")
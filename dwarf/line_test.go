@@ -0,0 +1,42 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dwarf_test
+
+import (
+	"sort"
+	"testing"
+
+	"golang.org/x/debug/dwarf"
+)
+
+func TestLineToBreakpointPCs(t *testing.T) {
+	data := buildTestProgram(t, "linetest.go", "-gcflags=-N -l")
+
+	// Line 12 has two statements, and is in both instantiations of first.
+	pcs, err := data.LineToBreakpointPCs("linetest.go", 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var funcs []string
+	for _, pc := range pcs {
+		entry, _, err := data.PCToFunction(pc)
+		if err != nil {
+			t.Fatalf("PCToFunction(%#x): %v", pc, err)
+		}
+		name, _ := entry.Val(dwarf.AttrName).(string)
+		funcs = append(funcs, name)
+		if file, line, err := data.PCToLine(pc); err != nil || line != 12 {
+			t.Errorf("PCToLine(%#x) = %s:%d, %v; want line 12", pc, file, line, err)
+		}
+	}
+	sort.Strings(funcs)
+	want := []string{"main.first[go.shape.int]", "main.first[go.shape.string]"}
+	if len(funcs) != len(want) || funcs[0] != want[0] || funcs[1] != want[1] {
+		t.Errorf("LineToBreakpointPCs(linetest.go, 12) is in %q; want one PC in each of %q", funcs, want)
+	}
+	if !sort.SliceIsSorted(pcs, func(i, j int) bool { return pcs[i] < pcs[j] }) {
+		t.Errorf("LineToBreakpointPCs(linetest.go, 12) = %#x; want them in order", pcs)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dwarf
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// AddLocationLists adds the contents of a .debug_loc section to the DWARF
+// data, so that EntryLocationAt can look up the locations of variables whose
+// location changes within their scope.
+func (d *Data) AddLocationLists(loc []byte) {
+	d.loc = loc
+}
+
+// EntryLocationAt returns the location expression giving the location of the
+// variable or parameter e while the program counter is pc.  If e's location is
+// a location list, the expression is the one from the list that covers pc, or
+// nil if there is none, meaning the variable isn't available there.
+//
+// Location list addresses are taken to be absolute until a base address
+// selection entry says otherwise, as in the lists the Go linker writes.
+func (d *Data) EntryLocationAt(e *Entry, pc uint64) ([]byte, error) {
+	switch loc := e.Val(AttrLocation).(type) {
+	case nil:
+		return nil, fmt.Errorf("missing location description")
+	case []byte:
+		return loc, nil
+	case int64:
+		if u := d.entryUnit(e.Offset); u != nil && u.vers >= 5 {
+			return d.locationListAtV5(u, loc, pc)
+		}
+		return d.locationListAt(loc, pc)
+	}
+	return nil, fmt.Errorf("unsupported location description")
+}
+
+// locationListAt returns the expression in the location list at offset off
+// in .debug_loc that covers pc.
+func (d *Data) locationListAt(off int64, pc uint64) ([]byte, error) {
+	if len(d.unit) == 0 {
+		return nil, fmt.Errorf("no compilation units")
+	}
+	if off < 0 || off >= int64(len(d.loc)) {
+		return nil, fmt.Errorf("location list offset %#x out of range", off)
+	}
+	// Assume the address size of the first unit applies to the whole
+	// program, as buildLineCaches does.
+	b := makeBuf(d, &d.unit[0], "loc", Offset(off), d.loc[off:])
+	var base uint64
+	maxAddr := ^uint64(0) >> uint(64-8*d.unit[0].asize)
+	for {
+		begin, end := b.addr(), b.addr()
+		if b.err != nil {
+			return nil, b.err
+		}
+		switch {
+		case begin == 0 && end == 0:
+			// End of list.
+			return nil, nil
+		case begin == maxAddr:
+			// Base address selection entry.
+			base = end
+			continue
+		}
+		expr := b.bytes(int(b.uint16()))
+		if b.err != nil {
+			return nil, b.err
+		}
+		if base+begin <= pc && pc < base+end {
+			return expr, nil
+		}
+	}
+}
+
+// locationListAtV5 returns the expression in the DWARF 5 location list at
+// offset off in .debug_loclists that covers pc, for a variable in unit u.
+// Offset pairs are relative to the unit's low PC until a base address entry
+// changes it.
+func (d *Data) locationListAtV5(u *unit, off int64, pc uint64) ([]byte, error) {
+	if off < 0 || off >= int64(len(d.loclists)) {
+		return nil, fmt.Errorf("location list offset %#x out of range", off)
+	}
+	r := d.Reader()
+	r.Seek(u.off)
+	var base uint64
+	if cu, err := r.Next(); err == nil && cu != nil {
+		base, _ = cu.Val(AttrLowpc).(uint64)
+	}
+	b := makeBuf(d, u, "loclists", Offset(off), d.loclists[off:])
+	addrx := func() uint64 {
+		a, err := d.addrx(u, b.uint())
+		if err != nil {
+			b.error(err.Error())
+		}
+		return a
+	}
+	var deflt []byte
+	for {
+		var begin, end uint64
+		switch kind := b.uint8(); kind {
+		case lleEndOfList:
+			return deflt, b.err
+		case lleBaseAddressx:
+			base = addrx()
+			continue
+		case lleBaseAddress:
+			base = b.addr()
+			continue
+		case lleDefaultLocation:
+			deflt = b.bytes(int(b.uint()))
+			continue
+		case lleStartxEndx:
+			begin = addrx()
+			end = addrx()
+		case lleStartxLength:
+			begin = addrx()
+			end = begin + b.uint()
+		case lleOffsetPair:
+			begin = base + b.uint()
+			end = base + b.uint()
+		case lleStartEnd:
+			begin, end = b.addr(), b.addr()
+		case lleStartLength:
+			begin = b.addr()
+			end = begin + b.uint()
+		default:
+			b.error("unknown location list entry kind " + strconv.Itoa(int(kind)))
+		}
+		expr := b.bytes(int(b.uint()))
+		if b.err != nil {
+			return nil, b.err
+		}
+		if begin <= pc && pc < end {
+			return expr, nil
+		}
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dwarf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestLocationList(t *testing.T) {
+	var loc bytes.Buffer
+	entry := func(begin, end uint64, expr ...byte) {
+		binary.Write(&loc, binary.LittleEndian, begin)
+		binary.Write(&loc, binary.LittleEndian, end)
+		if begin == ^uint64(0) || begin == 0 && end == 0 {
+			return
+		}
+		binary.Write(&loc, binary.LittleEndian, uint16(len(expr)))
+		loc.Write(expr)
+	}
+	entry(0x1000, 0x1010, 0x50)   // DW_OP_reg0, absolute addresses.
+	entry(^uint64(0), 0x2000)     // Base address selection.
+	entry(0x10, 0x40, 0x91, 0x08) // DW_OP_fbreg 8, relative to 0x2000.
+	entry(0, 0)                   // End of list.
+	d := &Data{
+		order: binary.LittleEndian,
+		unit:  []unit{{asize: 8}},
+	}
+	d.AddLocationLists(loc.Bytes())
+
+	tests := []struct {
+		pc   uint64
+		want []byte
+	}{
+		{0x0fff, nil},
+		{0x1000, []byte{0x50}},
+		{0x100f, []byte{0x50}},
+		{0x1010, nil},
+		{0x2010, []byte{0x91, 0x08}},
+		{0x203f, []byte{0x91, 0x08}},
+		{0x2040, nil},
+	}
+	for _, test := range tests {
+		got, err := d.locationListAt(0, test.pc)
+		if err != nil {
+			t.Errorf("pc %#x: %v", test.pc, err)
+			continue
+		}
+		if !bytes.Equal(got, test.want) {
+			t.Errorf("pc %#x: got %x, want %x", test.pc, got, test.want)
+		}
+	}
+	if _, err := d.locationListAt(int64(loc.Len()), 0x1000); err == nil {
+		t.Errorf("offset past the end of .debug_loc: got no error")
+	}
+}
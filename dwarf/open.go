@@ -7,7 +7,12 @@
 // http://dwarfstd.org/doc/dwarf-2.0.0.pdf
 package dwarf // import "golang.org/x/debug/dwarf"
 
-import "encoding/binary"
+import (
+	"encoding/binary"
+	"sync"
+
+	"golang.org/x/debug"
+)
 
 // Data represents the DWARF debugging information
 // loaded from an executable file (for example, an ELF or Mach-O executable).
@@ -18,10 +23,18 @@ type Data struct {
 	frame    []byte
 	info     []byte
 	line     []byte
+	loc      []byte
 	pubnames []byte
 	ranges   []byte
 	str      []byte
 
+	// New in DWARF 5.
+	addr       []byte
+	lineStr    []byte
+	strOffsets []byte
+	rnglists   []byte
+	loclists   []byte
+
 	// parsed data
 	abbrevCache     map[uint32]abbrevTable
 	order           binary.ByteOrder
@@ -30,9 +43,17 @@ type Data struct {
 	unit            []unit
 	sourceFiles     []string // source files listed in .debug_line.
 	nameCache                // map from name to top-level entries in .debug_info.
+	runtimeTypes             // map from runtime type address to type entry.
 	pcToFuncEntries          // cache of .debug_info data for function bounds.
 	pcToLineEntries          // cache of .debug_line data, used for efficient PC-to-line mapping.
 	lineToPCEntries          // cache of .debug_line data, used for efficient line-to-[]PC mapping.
+	instantiations           // map from generic function names to their instantiations.
+	// lineFiles maps the offset of each line number program in .debug_line
+	// to the indexes in sourceFiles of its files.
+	lineFiles map[Offset][]uint64
+	// inlined is the cache of inlined calls, built when first needed.
+	inlineOnce sync.Once
+	inlined    inlineCache
 }
 
 // New returns a new Data object initialized from the given parameters.
@@ -44,22 +65,46 @@ type Data struct {
 // in the object file; for example, for an ELF object, abbrev is the contents of
 // the ".debug_abbrev" section.
 func New(abbrev, aranges, frame, info, line, pubnames, ranges, str []byte) (*Data, error) {
+	return NewFromSections(map[string][]byte{
+		"abbrev":   abbrev,
+		"aranges":  aranges,
+		"frame":    frame,
+		"info":     info,
+		"line":     line,
+		"pubnames": pubnames,
+		"ranges":   ranges,
+		"str":      str,
+	})
+}
+
+// NewFromSections is like New, but takes the debug sections by name, without
+// the ".debug_" prefix, so that it can be given those that DWARF 4 and 5
+// added: "addr", "line_str", "str_offsets", "rnglists", "loclists", and
+// "loc", the location lists also added by AddLocationLists.  Sections that
+// are missing are taken to be empty.
+func NewFromSections(sections map[string][]byte) (*Data, error) {
 	d := &Data{
-		abbrev:      abbrev,
-		aranges:     aranges,
-		frame:       frame,
-		info:        info,
-		line:        line,
-		pubnames:    pubnames,
-		ranges:      ranges,
-		str:         str,
+		abbrev:      sections["abbrev"],
+		aranges:     sections["aranges"],
+		frame:       sections["frame"],
+		info:        sections["info"],
+		line:        sections["line"],
+		loc:         sections["loc"],
+		pubnames:    sections["pubnames"],
+		ranges:      sections["ranges"],
+		str:         sections["str"],
+		addr:        sections["addr"],
+		lineStr:     sections["line_str"],
+		strOffsets:  sections["str_offsets"],
+		rnglists:    sections["rnglists"],
+		loclists:    sections["loclists"],
 		abbrevCache: make(map[uint32]abbrevTable),
 		typeCache:   make(map[Offset]Type),
 		typeSigs:    make(map[uint64]*typeUnit),
 	}
 
 	// Sniff .debug_info to figure out byte order.
-	// bytes 4:6 are the version, a tiny 16-bit number (1, 2, 3).
+	// bytes 4:6 are the version, a tiny 16-bit number (1, 2, 3, 4, 5).
 	if len(d.info) < 6 {
 		return nil, DecodeError{"info", Offset(len(d.info)), "too short"}
 	}
@@ -82,6 +127,11 @@ func New(abbrev, aranges, frame, info, line, pubnames, ranges, str []byte) (*Dat
 	d.unit = u
 	d.buildInfoCaches()
 	d.buildLineCaches()
+	debug.Log(debug.LevelDebug, "DWARF parsed",
+		debug.Field{Key: "units", Value: len(d.unit)},
+		debug.Field{Key: "names", Value: len(d.nameCache)},
+		debug.Field{Key: "functions", Value: len(d.pcToFuncEntries)},
+		debug.Field{Key: "lines", Value: len(d.pcToLineEntries)})
 	return d, nil
 }
 
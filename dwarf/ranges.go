@@ -0,0 +1,137 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dwarf
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// EntryRanges returns the address ranges covered by an entry such as a
+// function or lexical block, as [low, high) pairs.  The ranges are given
+// either by the entry's DW_AT_low_pc and DW_AT_high_pc, or by a list in the
+// .debug_ranges section, or .debug_rnglists in DWARF 5, which DW_AT_ranges
+// refers to.
+func (d *Data) EntryRanges(e *Entry) ([][2]uint64, error) {
+	if low, ok := e.Val(AttrLowpc).(uint64); ok {
+		switch high := e.Val(AttrHighpc).(type) {
+		case uint64:
+			return [][2]uint64{{low, high}}, nil
+		case int64:
+			// Since DWARF 4, the high PC can be an offset from the low PC.
+			return [][2]uint64{{low, low + uint64(high)}}, nil
+		}
+		return [][2]uint64{{low, low + 1}}, nil
+	}
+	off, ok := e.Val(AttrRanges).(int64)
+	if !ok {
+		return nil, nil
+	}
+	u := d.entryUnit(e.Offset)
+	if u == nil {
+		return nil, fmt.Errorf("entry at offset %d is in no compilation unit", e.Offset)
+	}
+	sec := d.ranges
+	if u.vers >= 5 {
+		sec = d.rnglists
+	}
+	if off < 0 || off >= int64(len(sec)) {
+		return nil, fmt.Errorf("range list offset %d out of range", off)
+	}
+
+	// Range list entries are relative to a base address, which is the
+	// compilation unit's low PC unless a base address selection entry
+	// changes it.
+	r := d.Reader()
+	r.Seek(u.off)
+	var base uint64
+	if cu, err := r.Next(); err == nil && cu != nil {
+		base, _ = cu.Val(AttrLowpc).(uint64)
+	}
+	if u.vers >= 5 {
+		return d.rangeList(u, base, off)
+	}
+	maxAddr := ^uint64(0)
+	if u.asize < 8 {
+		maxAddr = 1<<(8*uint(u.asize)) - 1
+	}
+
+	var ranges [][2]uint64
+	b := makeBuf(d, u, "ranges", Offset(off), d.ranges[off:])
+	for {
+		low, high := b.addr(), b.addr()
+		if b.err != nil {
+			return nil, b.err
+		}
+		switch {
+		case low == 0 && high == 0:
+			return ranges, nil
+		case low == maxAddr:
+			base = high
+		case low < high:
+			ranges = append(ranges, [2]uint64{base + low, base + high})
+		}
+	}
+}
+
+// rangeList returns the ranges in the DWARF 5 range list at offset off in
+// .debug_rnglists, for an entry in unit u whose base address is base.
+func (d *Data) rangeList(u *unit, base uint64, off int64) ([][2]uint64, error) {
+	var ranges [][2]uint64
+	b := makeBuf(d, u, "rnglists", Offset(off), d.rnglists[off:])
+	addrx := func() uint64 {
+		a, err := d.addrx(u, b.uint())
+		if err != nil {
+			b.error(err.Error())
+		}
+		return a
+	}
+	for {
+		var low, high uint64
+		switch kind := b.uint8(); kind {
+		case rleEndOfList:
+			return ranges, b.err
+		case rleBaseAddressx:
+			base = addrx()
+			continue
+		case rleBaseAddress:
+			base = b.addr()
+			continue
+		case rleStartxEndx:
+			low = addrx()
+			high = addrx()
+		case rleStartxLength:
+			low = addrx()
+			high = low + b.uint()
+		case rleOffsetPair:
+			low = base + b.uint()
+			high = base + b.uint()
+		case rleStartEnd:
+			low, high = b.addr(), b.addr()
+		case rleStartLength:
+			low = b.addr()
+			high = low + b.uint()
+		default:
+			b.error("unknown range list entry kind " + strconv.Itoa(int(kind)))
+		}
+		if b.err != nil {
+			return nil, b.err
+		}
+		if low < high {
+			ranges = append(ranges, [2]uint64{low, high})
+		}
+	}
+}
+
+// entryUnit returns the compilation unit containing the entry at off.
+func (d *Data) entryUnit(off Offset) *unit {
+	for i := range d.unit {
+		u := &d.unit[i]
+		if u.off <= off && off < u.off+Offset(len(u.data)) {
+			return u
+		}
+	}
+	return nil
+}
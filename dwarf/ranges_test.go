@@ -0,0 +1,38 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dwarf_test
+
+import (
+	"testing"
+
+	. "golang.org/x/debug/dwarf"
+)
+
+func TestEntryRanges(t *testing.T) {
+	d := elfData(t, "testdata/typedef.elf")
+
+	main, err := d.LookupFunction("main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ranges, err := d.EntryRanges(main)
+	if err != nil {
+		t.Fatal(err)
+	}
+	low, _ := main.Val(AttrLowpc).(uint64)
+	if len(ranges) != 1 || ranges[0][0] != low || ranges[0][1] <= low {
+		t.Errorf("EntryRanges(main): got %#x, want one range starting at %#x", ranges, low)
+	}
+
+	// An offset high PC, as DWARF 4 allows, is relative to the low PC.
+	e := &Entry{Field: []Field{{Attr: AttrLowpc, Val: uint64(0x1000)}, {Attr: AttrHighpc, Val: int64(0x20)}}}
+	if ranges, err := d.EntryRanges(e); err != nil || len(ranges) != 1 || ranges[0] != [2]uint64{0x1000, 0x1020} {
+		t.Errorf("EntryRanges with offset high PC: got %#x, %v", ranges, err)
+	}
+
+	if ranges, err := d.EntryRanges(&Entry{}); err != nil || ranges != nil {
+		t.Errorf("EntryRanges of entry without ranges: got %#x, %v", ranges, err)
+	}
+}
@@ -38,13 +38,69 @@ func (d *Data) LookupMatchingSymbols(nameRE *regexp.Regexp) (result []string, er
 	return result, nil
 }
 
+// LookupMatchingFunctions returns the names of the functions matching the
+// given regular expression, in order.
+func (d *Data) LookupMatchingFunctions(nameRE *regexp.Regexp) []string {
+	return d.lookupMatching(nameRE, func(tag Tag) bool { return tag == TagSubprogram })
+}
+
+// LookupMatchingVariables returns the names of the global variables matching
+// the given regular expression, in order.
+func (d *Data) LookupMatchingVariables(nameRE *regexp.Regexp) []string {
+	return d.lookupMatching(nameRE, func(tag Tag) bool { return tag == TagVariable })
+}
+
+// LookupMatchingTypes returns the names of the types matching the given
+// regular expression, in order.
+func (d *Data) LookupMatchingTypes(nameRE *regexp.Regexp) []string {
+	return d.lookupMatching(nameRE, isTypeTag)
+}
+
+// lookupMatching returns the names matching nameRE of the top-level entries
+// whose tags satisfy match, in order.
+func (d *Data) lookupMatching(nameRE *regexp.Regexp, match func(Tag) bool) []string {
+	var names []string
+	for name, x := range d.nameCache {
+		if !nameRE.MatchString(name) {
+			continue
+		}
+		for ; x != nil; x = x.link {
+			if match(x.entry.Tag) {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// isTypeTag reports whether entries with the tag describe types that Type
+// can read.
+func isTypeTag(tag Tag) bool {
+	switch tag {
+	case TagArrayType, TagBaseType, TagClassType, TagStructType, TagUnionType,
+		TagConstType, TagVolatileType, TagRestrictType, TagEnumerationType,
+		TagPointerType, TagSubroutineType, TagTypedef, TagUnspecifiedType:
+		return true
+	}
+	return false
+}
+
 // LookupEntry returns the Entry for the named symbol.
 func (d *Data) LookupEntry(name string) (*Entry, error) {
 	return d.lookupEntry(name, 0)
 }
 
-// LookupFunction returns the entry for a function.
+// LookupFunction returns the entry for a function.  For a function the
+// compiler inlined, that is the entry for its out-of-line copy, if it has one,
+// rather than the abstract entry describing all the copies.
 func (d *Data) LookupFunction(name string) (*Entry, error) {
+	for x := d.nameCache[name]; x != nil; x = x.link {
+		if x.entry.Tag == TagSubprogram && x.entry.Val(AttrLowpc) != nil {
+			return x.entry, nil
+		}
+	}
 	return d.lookupEntry(name, TagSubprogram)
 }
 
@@ -98,6 +154,15 @@ func (d *Data) EntryTypeOffset(e *Entry) (Offset, error) {
 	return off, nil
 }
 
+// LookupRuntimeType returns the offset of the type entry whose runtime type
+// descriptor is identified by rtype, the value of its DW_AT_go_runtime_type
+// attribute.  Depending on the linker, that is either the descriptor's
+// address or its offset from the start of the program's type data.
+func (d *Data) LookupRuntimeType(rtype uint64) (Offset, bool) {
+	off, ok := d.runtimeTypes[rtype]
+	return off, ok
+}
+
 // PCToFunction returns the entry and address for the function containing the
 // specified PC.
 func (d *Data) PCToFunction(pc uint64) (entry *Entry, lowpc uint64, err error) {
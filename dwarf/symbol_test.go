@@ -0,0 +1,83 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dwarf_test
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestLookupMatching(t *testing.T) {
+	d := elfData(t, "testdata/typedef.elf")
+
+	got := d.LookupMatchingTypes(regexp.MustCompile(`^t_my_`))
+	want := []string{"t_my_enum", "t_my_list", "t_my_struct", "t_my_struct1", "t_my_tree", "t_my_union"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LookupMatchingTypes: got %q, want %q", got, want)
+	}
+
+	got = d.LookupMatchingFunctions(regexp.MustCompile(`.`))
+	want = []string{"main"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LookupMatchingFunctions: got %q, want %q", got, want)
+	}
+
+	if got := d.LookupMatchingFunctions(regexp.MustCompile(`^t_`)); len(got) != 0 {
+		t.Errorf("LookupMatchingFunctions matched types: %q", got)
+	}
+}
+
+func TestSourceFiles(t *testing.T) {
+	d := elfData(t, "testdata/typedef.elf")
+	files := d.SourceFiles()
+	found := false
+	for _, f := range files {
+		if f == "typedef.c" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("SourceFiles: got %q, want typedef.c among them", files)
+	}
+}
+
+func TestLineTable(t *testing.T) {
+	d := elfData(t, "testdata/typedef.elf")
+	table := d.LineTable()
+	if len(table) == 0 {
+		t.Fatal("LineTable: got no ranges")
+	}
+	for i, r := range table {
+		if r.Low >= r.High || i > 0 && r.Low < table[i-1].High {
+			t.Errorf("LineTable: range %d, %#x to %#x, is empty or out of order", i, r.Low, r.High)
+		}
+		if file, line, err := d.PCToLine(r.Low); err != nil || file != r.File || line != r.Line {
+			t.Errorf("PCToLine(%#x) = %s:%d, %v; LineTable says %s:%d", r.Low, file, line, err, r.File, r.Line)
+		}
+	}
+}
+
+func TestStatementLines(t *testing.T) {
+	d := elfData(t, "testdata/typedef.elf")
+	file, lines, err := d.StatementLines("typedef.c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file != "typedef.c" || len(lines) == 0 {
+		t.Fatalf("StatementLines: got %q, %d lines; want typedef.c, some lines", file, len(lines))
+	}
+	for i, line := range lines {
+		if i > 0 && line <= lines[i-1] {
+			t.Errorf("StatementLines: line %d follows %d", line, lines[i-1])
+		}
+		if pcs, err := d.LineToBreakpointPCs(file, line); err != nil || len(pcs) == 0 {
+			t.Errorf("LineToBreakpointPCs(%q, %d) = %#x, %v; want PCs", file, line, pcs, err)
+		}
+	}
+	if _, _, err := d.StatementLines("nosuch.go"); err == nil {
+		t.Error("StatementLines of a missing file succeeded")
+	}
+}
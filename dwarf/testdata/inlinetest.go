@@ -0,0 +1,21 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "os"
+
+func add(a, b int) int { return a + b }
+
+//go:noinline
+func double(a int) int {
+	return add(a, a) // The call is on line 13.
+}
+
+// addFunc makes the compiler keep an out-of-line copy of add.
+var addFunc = add
+
+func main() {
+	os.Exit(double(len(os.Args)) - addFunc(1, 1))
+}
@@ -0,0 +1,22 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "os"
+
+//go:noinline
+func first[T any](s []T) (T, int) {
+	var zero T
+	if n := len(s); n > 0 { // Two statements on line 12.
+		return s[0], n
+	}
+	return zero, 0
+}
+
+func main() {
+	i, _ := first([]int{len(os.Args)})
+	s, _ := first(os.Args)
+	os.Exit(i + len(s))
+}
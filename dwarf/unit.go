@@ -4,7 +4,10 @@
 
 package dwarf
 
-import "strconv"
+import (
+	"fmt"
+	"strconv"
+)
 
 // DWARF debug info is split into a sequence of compilation units.
 // Each unit has its own abbreviation table and address size.
@@ -17,6 +20,15 @@ type unit struct {
 	asize  int
 	vers   int
 	is64   bool // True for 64-bit DWARF format
+
+	// Bases of the unit's contributions to the sections that DWARF 5
+	// forms index into, from its first entry.  Until basesKnown is set,
+	// while that entry is read, indexes are left unresolved.
+	addrBase       uint64
+	strOffsetsBase uint64
+	rnglistsBase   uint64
+	loclistsBase   uint64
+	basesKnown     bool
 }
 
 // Implement the dataFormat interface.
@@ -65,13 +77,22 @@ func (d *Data) parseUnits() ([]unit, error) {
 			u.is64 = true
 			n = uint32(b.uint64())
 		}
+		hdroff := b.off
 		vers := b.uint16()
-		if vers != 2 && vers != 3 && vers != 4 {
+		if vers < 2 || vers > 5 {
 			b.error("unsupported DWARF version " + strconv.Itoa(int(vers)))
 			break
 		}
 		u.vers = int(vers)
-		atable, err := d.parseAbbrev(b.uint32())
+		// In DWARF 5 the header starts with the unit type, and the
+		// address size comes before the abbreviation table's offset.
+		var unitType uint8
+		if vers >= 5 {
+			unitType = b.uint8()
+			u.asize = int(b.uint8())
+		}
+		b.format = u
+		atable, err := d.parseAbbrev(uint32(b.unitOffset()))
 		if err != nil {
 			if b.err == nil {
 				b.err = err
@@ -79,12 +100,128 @@ func (d *Data) parseUnits() ([]unit, error) {
 			break
 		}
 		u.atable = atable
-		u.asize = int(b.uint8())
+		switch {
+		case vers < 5:
+			u.asize = int(b.uint8())
+		case unitType == utSkeleton || unitType == utSplitCompile:
+			b.skip(8) // DWO ID
+		case unitType == utType || unitType == utSplitType:
+			b.skip(8) // type signature
+			b.unitOffset()
+		}
+		b.format = unknownFormat{}
 		u.off = b.off
-		u.data = b.bytes(int(n - (2 + 4 + 1)))
+		u.data = b.bytes(int(n) - int(b.off-hdroff))
 	}
 	if b.err != nil {
 		return nil, b.err
 	}
+	for i := range units {
+		d.parseUnitBases(&units[i])
+	}
 	return units, nil
 }
+
+// parseUnitBases sets the bases of u's contributions to .debug_addr,
+// .debug_str_offsets, .debug_rnglists and .debug_loclists from its first
+// entry.  The defaults, for a unit without the attributes, skip the header of
+// a section holding a single contribution.
+func (d *Data) parseUnitBases(u *unit) {
+	defer func() { u.basesKnown = true }()
+	if u.vers < 5 {
+		return
+	}
+	hdr := uint64(8)
+	if u.is64 {
+		hdr = 16
+	}
+	u.addrBase, u.strOffsetsBase = hdr, hdr
+	u.rnglistsBase, u.loclistsBase = hdr+4, hdr+4
+	b := makeBuf(d, u, "info", u.off, u.data)
+	e := b.entry(u.atable, u.base)
+	if e == nil {
+		return
+	}
+	for _, f := range e.Field {
+		v, ok := f.Val.(int64)
+		if !ok {
+			continue
+		}
+		switch f.Attr {
+		case AttrAddrBase:
+			u.addrBase = uint64(v)
+		case AttrStrOffsetsBase:
+			u.strOffsetsBase = uint64(v)
+		case AttrRnglistsBase:
+			u.rnglistsBase = uint64(v)
+		case AttrLoclistsBase:
+			u.loclistsBase = uint64(v)
+		}
+	}
+}
+
+// unitOf returns the unit whose data the format f describes, or nil if it
+// isn't a unit's.
+func unitOf(f dataFormat) *unit {
+	switch f := f.(type) {
+	case *unit:
+		return f
+	case *typeUnit:
+		return &f.unit
+	}
+	return nil
+}
+
+// addrx returns the address at index i in u's contribution to .debug_addr.
+func (d *Data) addrx(u *unit, i uint64) (uint64, error) {
+	off := u.addrBase + i*uint64(u.asize)
+	if u.asize == 0 || off+uint64(u.asize) > uint64(len(d.addr)) {
+		return 0, fmt.Errorf("address index %d out of range", i)
+	}
+	b := makeBuf(d, u, "addr", Offset(off), d.addr[off:])
+	return b.addr(), b.err
+}
+
+// strx returns the string at index i in u's contribution to
+// .debug_str_offsets.
+func (d *Data) strx(u *unit, i uint64) (string, error) {
+	off, err := d.offsetAt(u, "str_offsets", d.strOffsets, u.strOffsetsBase, i)
+	if err != nil {
+		return "", err
+	}
+	return d.stringAt("str", d.str, off)
+}
+
+// listx returns the offset in sec, .debug_rnglists or .debug_loclists, of the
+// list at index i of the offset table at base.
+func (d *Data) listx(u *unit, name string, sec []byte, base, i uint64) (int64, error) {
+	off, err := d.offsetAt(u, name, sec, base, i)
+	if err != nil {
+		return 0, err
+	}
+	return int64(base + off), nil
+}
+
+// offsetAt returns the ith section offset in the table at base in sec.
+func (d *Data) offsetAt(u *unit, name string, sec []byte, base, i uint64) (uint64, error) {
+	size := uint64(4)
+	if u.is64 {
+		size = 8
+	}
+	off := base + i*size
+	if off+size > uint64(len(sec)) {
+		return 0, fmt.Errorf("%s index %d out of range", name, i)
+	}
+	b := makeBuf(d, u, name, Offset(off), sec[off:])
+	return b.unitOffset(), b.err
+}
+
+// stringAt returns the NUL-terminated string at offset off in sec.
+func (d *Data) stringAt(name string, sec []byte, off uint64) (string, error) {
+	if off >= uint64(len(sec)) {
+		return "", fmt.Errorf("%s offset %#x out of range", name, off)
+	}
+	b := makeBuf(d, unknownFormat{}, name, Offset(off), sec[off:])
+	s := b.string()
+	return s, b.err
+}
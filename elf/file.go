@@ -7,11 +7,13 @@ package elf
 
 import (
 	"bytes"
+	"compress/zlib"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"strings"
 
 	"golang.org/x/debug/dwarf"
 )
@@ -576,19 +578,23 @@ func (f *File) DWARF() (*dwarf.Data, error) {
 	// are the required ones, and the debug/dwarf package
 	// does not use the others, so don't bother loading them.
 	// r: added line.
-	var names = [...]string{"abbrev", "frame", "info", "line", "str"}
-	var dat [len(names)][]byte
-	for i, name := range names {
-		name = ".debug_" + name
-		s := f.Section(name)
+	// ranges: added for the scopes of lexical blocks.
+	// loc: location lists describe variables whose location varies,
+	// such as arguments passed in registers.
+	// addr, line_str, str_offsets, rnglists, loclists: added in DWARF 5.
+	var names = [...]string{"abbrev", "frame", "info", "line", "ranges", "str",
+		"loc", "addr", "line_str", "str_offsets", "rnglists", "loclists"}
+	sections := make(map[string][]byte)
+	for _, name := range names {
+		s := f.debugSection(name)
 		if s == nil {
 			continue
 		}
-		b, err := s.Data()
-		if err != nil && uint64(len(b)) < s.Size {
+		b, err := f.debugSectionData(s)
+		if err != nil {
 			return nil, err
 		}
-		dat[i] = b
+		sections[name] = b
 	}
 
 	// If there's a relocation table for .debug_info, we have to process it
@@ -599,23 +605,22 @@ func (f *File) DWARF() (*dwarf.Data, error) {
 		if err != nil {
 			return nil, err
 		}
-		err = f.applyRelocations(dat[2], data)
+		err = f.applyRelocations(sections["info"], data)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	abbrev, frame, info, line, str := dat[0], dat[1], dat[2], dat[3], dat[4]
-	d, err := dwarf.New(abbrev, nil, frame, info, line, nil, nil, str)
+	d, err := dwarf.NewFromSections(sections)
 	if err != nil {
 		return nil, err
 	}
 
 	// Look for DWARF4 .debug_types sections.
 	for i, s := range f.Sections {
-		if s.Name == ".debug_types" {
-			b, err := s.Data()
-			if err != nil && uint64(len(b)) < s.Size {
+		if s.Name == ".debug_types" || s.Name == ".zdebug_types" {
+			b, err := f.debugSectionData(s)
+			if err != nil {
 				return nil, err
 			}
 
@@ -646,6 +651,80 @@ func (f *File) DWARF() (*dwarf.Data, error) {
 	return d, nil
 }
 
+// debugSection returns the DWARF section .debug_name, or failing that the
+// compressed section .zdebug_name that older toolchains emit instead, or nil
+// if f has neither.
+func (f *File) debugSection(name string) *Section {
+	if s := f.Section(".debug_" + name); s != nil {
+		return s
+	}
+	return f.Section(".zdebug_" + name)
+}
+
+// debugSectionData returns the contents of the DWARF section s, decompressed
+// if s has the SHF_COMPRESSED flag or is a .zdebug section.
+func (f *File) debugSectionData(s *Section) ([]byte, error) {
+	b, err := s.Data()
+	if err != nil && uint64(len(b)) < s.Size {
+		return nil, err
+	}
+	switch {
+	case s.Flags&SHF_COMPRESSED != 0:
+		var typ CompressionType
+		var size, hdrSize uint64
+		switch f.Class {
+		case ELFCLASS32:
+			var ch Chdr32
+			hdrSize = uint64(binary.Size(ch))
+			if uint64(len(b)) < hdrSize {
+				return nil, fmt.Errorf("%s: compression header truncated", s.Name)
+			}
+			binary.Read(bytes.NewReader(b), f.ByteOrder, &ch)
+			typ, size = CompressionType(ch.Type), uint64(ch.Size)
+		case ELFCLASS64:
+			var ch Chdr64
+			hdrSize = uint64(binary.Size(ch))
+			if uint64(len(b)) < hdrSize {
+				return nil, fmt.Errorf("%s: compression header truncated", s.Name)
+			}
+			binary.Read(bytes.NewReader(b), f.ByteOrder, &ch)
+			typ, size = CompressionType(ch.Type), ch.Size
+		default:
+			return nil, fmt.Errorf("%s: compressed section in ELF class %v", s.Name, f.Class)
+		}
+		if typ != COMPRESS_ZLIB {
+			return nil, fmt.Errorf("%s: unsupported compression type %v", s.Name, typ)
+		}
+		return decompressZlib(s.Name, b[hdrSize:], size)
+	case strings.HasPrefix(s.Name, ".zdebug_"):
+		// A "ZLIB" tag and the uncompressed size, in big-endian order.
+		if len(b) < 12 || string(b[:4]) != "ZLIB" {
+			return nil, fmt.Errorf("%s: missing ZLIB header", s.Name)
+		}
+		return decompressZlib(s.Name, b[12:], binary.BigEndian.Uint64(b[4:12]))
+	}
+	return b, nil
+}
+
+// decompressZlib returns the size bytes compressed with zlib in b, which is
+// the contents of the section with the given name.
+func decompressZlib(name string, b []byte, size uint64) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	defer r.Close()
+	if size > uint64(len(b))*1032 {
+		// Beyond zlib's maximum compression ratio.
+		return nil, fmt.Errorf("%s: invalid uncompressed size %d", name, size)
+	}
+	out := make([]byte, size)
+	if _, err := io.ReadFull(r, out); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return out, nil
+}
+
 // Symbols returns the symbol table for f.
 //
 // For compatibility with Go 1.0, Symbols omits the null symbol at index 0.
@@ -656,6 +735,14 @@ func (f *File) Symbols() ([]Symbol, error) {
 	return sym, err
 }
 
+// DynamicSymbols returns the dynamic symbol table for f.
+//
+// As with Symbols, the null symbol at index 0 is omitted.
+func (f *File) DynamicSymbols() ([]Symbol, error) {
+	sym, _, err := f.getSymbols(SHT_DYNSYM)
+	return sym, err
+}
+
 type ImportedSymbol struct {
 	Name    string
 	Version string
@@ -7,6 +7,7 @@ package elf
 import (
 	"bytes"
 	"compress/gzip"
+	"compress/zlib"
 	"encoding/binary"
 	"io"
 	"net"
@@ -304,6 +305,26 @@ func TestDWARFRelocations(t *testing.T) {
 	}
 }
 
+func TestDynamicSymbols(t *testing.T) {
+	f, err := Open("testdata/gcc-amd64-linux-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	syms, err := f.DynamicSymbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, s := range syms {
+		names = append(names, s.Name)
+	}
+	want := []string{"__gmon_start__", "puts", "__libc_start_main"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("got dynamic symbols %q, want %q", names, want)
+	}
+}
+
 func TestNoSectionOverlaps(t *testing.T) {
 	// Ensure 6l outputs sections without overlaps.
 	if runtime.GOOS != "linux" && runtime.GOOS != "freebsd" {
@@ -332,3 +353,50 @@ func TestNoSectionOverlaps(t *testing.T) {
 		}
 	}
 }
+
+func TestCompressedDebugSections(t *testing.T) {
+	want := []byte("the uncompressed contents of a DWARF section")
+	var z bytes.Buffer
+	w := zlib.NewWriter(&z)
+	w.Write(want)
+	w.Close()
+
+	// A section with SHF_COMPRESSED starts with a compression header.
+	var chdr bytes.Buffer
+	binary.Write(&chdr, binary.LittleEndian, Chdr64{Type: uint32(COMPRESS_ZLIB), Size: uint64(len(want)), Addralign: 1})
+	chdr.Write(z.Bytes())
+	// A .zdebug section starts with "ZLIB" and the big-endian size.
+	zdebug := []byte("ZLIB\x00\x00\x00\x00\x00\x00\x00\x00")
+	binary.BigEndian.PutUint64(zdebug[4:], uint64(len(want)))
+	zdebug = append(zdebug, z.Bytes()...)
+
+	f := &File{FileHeader: FileHeader{Class: ELFCLASS64, ByteOrder: binary.LittleEndian}}
+	section := func(name string, flags SectionFlag, data []byte) *Section {
+		r := bytes.NewReader(data)
+		return &Section{
+			SectionHeader: SectionHeader{Name: name, Flags: flags, Size: uint64(len(data))},
+			ReaderAt:      r,
+			sr:            io.NewSectionReader(r, 0, int64(len(data))),
+		}
+	}
+	for _, s := range []*Section{
+		section(".debug_info", 0, want),
+		section(".debug_info", SHF_COMPRESSED, chdr.Bytes()),
+		section(".zdebug_info", 0, zdebug),
+	} {
+		got, err := f.debugSectionData(s)
+		if err != nil {
+			t.Errorf("%s (flags %v): %v", s.Name, s.Flags, err)
+		} else if !bytes.Equal(got, want) {
+			t.Errorf("%s (flags %v): got %q, want %q", s.Name, s.Flags, got, want)
+		}
+	}
+
+	if _, err := f.debugSectionData(section(".zdebug_info", 0, z.Bytes())); err == nil {
+		t.Errorf(".zdebug_info without a header: got no error")
+	}
+	binary.LittleEndian.PutUint32(chdr.Bytes(), 2)
+	if _, err := f.debugSectionData(section(".debug_info", SHF_COMPRESSED, chdr.Bytes())); err == nil {
+		t.Errorf("unknown compression type: got no error")
+	}
+}
@@ -272,3 +272,46 @@ func TestPCLine(t *testing.T) {
 		off = pc + 1 - text.Addr
 	}
 }
+
+// TestPCToSPAdj reads the frame sizes of a function from the test binary's
+// own table, which is in the format of the toolchain building the test.
+func TestPCToSPAdj(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("reads the test binary as an ELF file")
+	}
+	f, err := elf.Open(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	pclndat, err := f.Section(".gopclntab").Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tab, err := NewTable(nil, NewLineTable(pclndat, f.Section(".text").Addr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := tab.LookupFunc("golang.org/x/debug/gosym.TestPCToSPAdj")
+	if fn == nil {
+		t.Fatal("TestPCToSPAdj not found")
+	}
+	if file, _, _ := tab.PCToLine(fn.Entry); !strings.HasSuffix(file, "pclntab_test.go") {
+		t.Errorf("PCToLine(%#x): got file %q, want pclntab_test.go", fn.Entry, file)
+	}
+	if adj := tab.PCToSPAdj(fn.Entry); adj != 0 {
+		t.Errorf("PCToSPAdj(%#x) at entry: got %d, want 0", fn.Entry, adj)
+	}
+	max := 0
+	for pc := fn.Entry; pc < fn.End; pc++ {
+		if adj := tab.PCToSPAdj(pc); adj > max {
+			max = adj
+		}
+	}
+	if max <= 0 {
+		t.Errorf("PCToSPAdj: found no frame in %s", fn.Name)
+	}
+	if adj := tab.PCToSPAdj(0); adj != -1 {
+		t.Errorf("PCToSPAdj(0): got %d, want -1", adj)
+	}
+}
@@ -6,7 +6,13 @@
 package local // import "golang.org/x/debug/local"
 
 import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
 	"golang.org/x/debug"
+	"golang.org/x/debug/arch"
 	"golang.org/x/debug/server"
 	"golang.org/x/debug/server/protocol"
 )
@@ -18,6 +24,21 @@ var _ debug.File = (*File)(nil)
 // Through that interface it provides access to a program being debugged.
 type Program struct {
 	s *server.Server
+
+	eventsOnce sync.Once
+	events     chan debug.Event
+
+	mu            sync.Mutex
+	resumeTimeout time.Duration
+	resuming      *resumption // The call to Resume, if one is outstanding.
+}
+
+// A resumption is a call to the server's Resume, which callers of Resume wait
+// for until it returns or their timeout elapses.
+type resumption struct {
+	done   chan struct{} // Closed when the call returns.
+	status debug.Status
+	err    error
 }
 
 // New creates a new program from the specified file.
@@ -27,6 +48,13 @@ func New(textFile string) (*Program, error) {
 	return &Program{s: s}, err
 }
 
+// NewWithArch is like New, but lets chooseArch decide the architecture of the
+// program, as described for server.NewWithArch.
+func NewWithArch(textFile string, chooseArch func(detected *arch.Architecture) (*arch.Architecture, error)) (*Program, error) {
+	s, err := server.NewWithArch(textFile, chooseArch)
+	return &Program{s: s}, err
+}
+
 func (p *Program) Open(name string, mode string) (debug.File, error) {
 	req := protocol.OpenRequest{
 		Name: name,
@@ -45,7 +73,7 @@ func (p *Program) Open(name string, mode string) (debug.File, error) {
 }
 
 func (p *Program) Run(args ...string) (debug.Status, error) {
-	req := protocol.RunRequest{args}
+	req := protocol.RunRequest{Args: args}
 	var resp protocol.RunResponse
 	err := p.s.Run(&req, &resp)
 	if err != nil {
@@ -59,9 +87,112 @@ func (p *Program) Stop() (debug.Status, error) {
 }
 
 func (p *Program) Resume() (debug.Status, error) {
-	req := protocol.ResumeRequest{}
-	var resp protocol.ResumeResponse
-	err := p.s.Resume(&req, &resp)
+	p.mu.Lock()
+	r := p.resuming
+	if r == nil {
+		// The program isn't still running after an earlier Resume timed
+		// out, so resume it.
+		r = &resumption{done: make(chan struct{})}
+		p.resuming = r
+		go func() {
+			req := protocol.ResumeRequest{}
+			var resp protocol.ResumeResponse
+			r.err = p.s.Resume(&req, &resp)
+			r.status = resp.Status
+			close(r.done)
+		}()
+	}
+	timeout := p.resumeTimeout
+	p.mu.Unlock()
+
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		select {
+		case <-r.done:
+		case <-t.C:
+			return debug.Status{Reason: "running"}, nil
+		}
+	} else {
+		<-r.done
+	}
+	p.mu.Lock()
+	if p.resuming == r {
+		p.resuming = nil
+	}
+	p.mu.Unlock()
+	if r.err != nil {
+		return debug.Status{}, r.err
+	}
+	return r.status, nil
+}
+
+func (p *Program) SetResumeTimeout(d time.Duration) {
+	p.mu.Lock()
+	p.resumeTimeout = d
+	p.mu.Unlock()
+}
+
+func (p *Program) Checkpoint() (uint64, error) {
+	req := protocol.CheckpointRequest{}
+	var resp protocol.CheckpointResponse
+	err := p.s.Checkpoint(&req, &resp)
+	return resp.ID, err
+}
+
+func (p *Program) Restore(id uint64) (debug.Status, error) {
+	req := protocol.RestoreRequest{ID: id}
+	var resp protocol.RestoreResponse
+	err := p.s.Restore(&req, &resp)
+	return resp.Status, err
+}
+
+func (p *Program) DeleteCheckpoint(id uint64) error {
+	req := protocol.DeleteCheckpointRequest{ID: id}
+	var resp protocol.DeleteCheckpointResponse
+	return p.s.DeleteCheckpoint(&req, &resp)
+}
+
+func (p *Program) SetRecording(enabled bool) error {
+	req := protocol.SetRecordingRequest{Enabled: enabled}
+	var resp protocol.SetRecordingResponse
+	return p.s.SetRecording(&req, &resp)
+}
+
+func (p *Program) ReverseToPreviousBreak() (debug.Status, error) {
+	req := protocol.ReverseToPreviousBreakRequest{}
+	var resp protocol.ReverseToPreviousBreakResponse
+	err := p.s.ReverseToPreviousBreak(&req, &resp)
+	return resp.Status, err
+}
+
+func (p *Program) ReverseToPreviousStop() (debug.Status, error) {
+	req := protocol.ReverseToPreviousStopRequest{}
+	var resp protocol.ReverseToPreviousStopResponse
+	err := p.s.ReverseToPreviousStop(&req, &resp)
+	return resp.Status, err
+}
+
+func (p *Program) Interrupt() error {
+	req := protocol.InterruptRequest{}
+	var resp protocol.InterruptResponse
+	return p.s.Interrupt(&req, &resp)
+}
+
+func (p *Program) StepInstruction() (debug.Status, error) {
+	req := protocol.StepInstructionRequest{}
+	var resp protocol.StepInstructionResponse
+	err := p.s.StepInstruction(&req, &resp)
+	if err != nil {
+		return debug.Status{}, err
+	}
+	return resp.Status, nil
+}
+
+func (p *Program) RunToLine(file string, line uint64) (debug.Status, error) {
+	req := protocol.RunToLineRequest{File: file, Line: line}
+	var resp protocol.RunToLineResponse
+	err := p.s.RunToLine(&req, &resp)
 	if err != nil {
 		return debug.Status{}, err
 	}
@@ -69,43 +200,293 @@ func (p *Program) Resume() (debug.Status, error) {
 }
 
 func (p *Program) Kill() (debug.Status, error) {
-	panic("unimplemented")
+	req := protocol.KillRequest{}
+	var resp protocol.KillResponse
+	err := p.s.Kill(&req, &resp)
+	if err != nil {
+		return debug.Status{}, err
+	}
+	return resp.Status, nil
+}
+
+func (p *Program) Restart(keepBreakpoints bool) (debug.Status, error) {
+	req := protocol.RestartRequest{KeepBreakpoints: keepBreakpoints}
+	var resp protocol.RestartResponse
+	err := p.s.Restart(&req, &resp)
+	if err != nil {
+		return debug.Status{}, err
+	}
+	return resp.Status, nil
+}
+
+func (p *Program) SetKillOnExit(kill bool) error {
+	req := protocol.SetKillOnExitRequest{
+		Kill: kill,
+	}
+	var resp protocol.SetKillOnExitResponse
+	return p.s.SetKillOnExit(&req, &resp)
+}
+
+func (p *Program) SetDeterministic(on bool) error {
+	req := protocol.SetDeterministicRequest{
+		Deterministic: on,
+	}
+	var resp protocol.SetDeterministicResponse
+	return p.s.SetDeterministic(&req, &resp)
 }
 
-func (p *Program) Breakpoint(address uint64) ([]uint64, error) {
+func (p *Program) SetShowTemporaries(show bool) error {
+	req := protocol.SetShowTemporariesRequest{
+		Show: show,
+	}
+	var resp protocol.SetShowTemporariesResponse
+	return p.s.SetShowTemporaries(&req, &resp)
+}
+
+func (p *Program) SetSignalPolicy(signal string, policy debug.SignalPolicy) error {
+	req := protocol.SetSignalPolicyRequest{
+		Signal: signal,
+		Policy: policy,
+	}
+	var resp protocol.SetSignalPolicyResponse
+	return p.s.SetSignalPolicy(&req, &resp)
+}
+
+func (p *Program) SetPanicStops(functions []string) error {
+	req := protocol.SetPanicStopsRequest{
+		Functions: functions,
+	}
+	var resp protocol.SetPanicStopsResponse
+	return p.s.SetPanicStops(&req, &resp)
+}
+
+func (p *Program) SetThreadStops(stop bool) error {
+	req := protocol.SetThreadStopsRequest{
+		Stop: stop,
+	}
+	var resp protocol.SetThreadStopsResponse
+	return p.s.SetThreadStops(&req, &resp)
+}
+
+func (p *Program) Detach() error {
+	req := protocol.DetachRequest{}
+	var resp protocol.DetachResponse
+	return p.s.Detach(&req, &resp)
+}
+
+func (p *Program) Shutdown(kill bool) error {
+	req := protocol.ShutdownRequest{
+		Kill: kill,
+	}
+	var resp protocol.ShutdownResponse
+	return p.s.Shutdown(&req, &resp)
+}
+
+func (p *Program) ResumeAsync() error {
+	req := protocol.ResumeAsyncRequest{}
+	var resp protocol.ResumeAsyncResponse
+	return p.s.ResumeAsync(&req, &resp)
+}
+
+func (p *Program) Events() <-chan debug.Event {
+	p.eventsOnce.Do(func() {
+		p.events = make(chan debug.Event, 16)
+		go p.readEvents()
+	})
+	return p.events
+}
+
+// readEvents delivers the server's events on p.events, until the server
+// can no longer be asked for them.
+func (p *Program) readEvents() {
+	defer close(p.events)
+	for {
+		req := protocol.NextEventRequest{}
+		var resp protocol.NextEventResponse
+		if err := p.s.NextEvent(&req, &resp); err != nil {
+			return
+		}
+		p.events <- resp.Event
+	}
+}
+
+func (p *Program) Stdout() io.Reader {
+	return &outputReader{prog: p, fd: 1}
+}
+
+func (p *Program) Stderr() io.Reader {
+	return &outputReader{prog: p, fd: 2}
+}
+
+func (p *Program) Breakpoint(address uint64) (debug.Breakpoint, error) {
 	req := protocol.BreakpointRequest{
 		Address: address,
 	}
 	var resp protocol.BreakpointResponse
 	err := p.s.Breakpoint(&req, &resp)
-	return resp.PCs, err
+	return resp.Breakpoint, err
+}
+
+func (p *Program) BreakpointAtFunction(name string) (debug.Breakpoint, error) {
+	req := protocol.BreakpointAtFunctionRequest{
+		Function: name,
+	}
+	var resp protocol.BreakpointResponse
+	err := p.s.BreakpointAtFunction(&req, &resp)
+	return resp.Breakpoint, err
 }
 
-func (p *Program) BreakpointAtFunction(name string) ([]uint64, error) {
+func (p *Program) PendingBreakpointAtFunction(name string) (debug.Breakpoint, error) {
 	req := protocol.BreakpointAtFunctionRequest{
 		Function: name,
+		Pending:  true,
 	}
 	var resp protocol.BreakpointResponse
 	err := p.s.BreakpointAtFunction(&req, &resp)
-	return resp.PCs, err
+	return resp.Breakpoint, err
 }
 
-func (p *Program) BreakpointAtLine(file string, line uint64) ([]uint64, error) {
+func (p *Program) BreakpointAtLine(file string, line uint64) (debug.Breakpoint, error) {
 	req := protocol.BreakpointAtLineRequest{
 		File: file,
 		Line: line,
 	}
 	var resp protocol.BreakpointResponse
 	err := p.s.BreakpointAtLine(&req, &resp)
-	return resp.PCs, err
+	return resp.Breakpoint, err
 }
 
-func (p *Program) DeleteBreakpoints(pcs []uint64) error {
-	req := protocol.DeleteBreakpointsRequest{PCs: pcs}
+func (p *Program) BreakpointAtPackageInit(pkg string) (debug.Breakpoint, error) {
+	req := protocol.BreakpointAtPackageInitRequest{
+		Package: pkg,
+	}
+	var resp protocol.BreakpointResponse
+	err := p.s.BreakpointAtPackageInit(&req, &resp)
+	return resp.Breakpoint, err
+}
+
+func (p *Program) BreakpointAtCgoCalls() (debug.Breakpoint, error) {
+	req := protocol.BreakpointAtCgoCallsRequest{}
+	var resp protocol.BreakpointResponse
+	err := p.s.BreakpointAtCgoCalls(&req, &resp)
+	return resp.Breakpoint, err
+}
+
+func (p *Program) DeleteBreakpoints(ids []uint64) error {
+	req := protocol.DeleteBreakpointsRequest{IDs: ids}
 	var resp protocol.DeleteBreakpointsResponse
 	return p.s.DeleteBreakpoints(&req, &resp)
 }
 
+func (p *Program) EnableBreakpoint(id uint64, enabled bool) error {
+	req := protocol.EnableBreakpointRequest{ID: id, Enabled: enabled}
+	var resp protocol.EnableBreakpointResponse
+	return p.s.EnableBreakpoint(&req, &resp)
+}
+
+func (p *Program) SetBreakpointCaller(id uint64, function string) error {
+	req := protocol.SetBreakpointCallerRequest{ID: id, Function: function}
+	var resp protocol.SetBreakpointCallerResponse
+	return p.s.SetBreakpointCaller(&req, &resp)
+}
+
+func (p *Program) SetBreakpointGroup(id uint64, group string) error {
+	req := protocol.SetBreakpointGroupRequest{ID: id, Group: group}
+	var resp protocol.SetBreakpointGroupResponse
+	return p.s.SetBreakpointGroup(&req, &resp)
+}
+
+func (p *Program) SetBreakpointOneShot(id uint64, oneShot bool) error {
+	req := protocol.SetBreakpointOneShotRequest{ID: id, OneShot: oneShot}
+	var resp protocol.SetBreakpointOneShotResponse
+	return p.s.SetBreakpointOneShot(&req, &resp)
+}
+
+func (p *Program) SetBreakpointRecord(id uint64, record bool, exprs []string) error {
+	req := protocol.SetBreakpointRecordRequest{ID: id, Record: record, Exprs: exprs}
+	var resp protocol.SetBreakpointRecordResponse
+	return p.s.SetBreakpointRecord(&req, &resp)
+}
+
+func (p *Program) Snapshots() ([]debug.Snapshot, error) {
+	req := protocol.SnapshotsRequest{}
+	var resp protocol.SnapshotsResponse
+	err := p.s.Snapshots(&req, &resp)
+	return resp.Snapshots, err
+}
+
+func (p *Program) SetBreakpointTrace(id uint64, trace bool, exprs []string) error {
+	req := protocol.SetBreakpointTraceRequest{ID: id, Trace: trace, Exprs: exprs}
+	var resp protocol.SetBreakpointTraceResponse
+	return p.s.SetBreakpointTrace(&req, &resp)
+}
+
+func (p *Program) SetBreakpointCommands(id uint64, commands []string) error {
+	req := protocol.SetBreakpointCommandsRequest{ID: id, Commands: commands}
+	var resp protocol.SetBreakpointCommandsResponse
+	return p.s.SetBreakpointCommands(&req, &resp)
+}
+
+func (p *Program) TraceEvents() ([]debug.TraceEvent, error) {
+	req := protocol.TraceEventsRequest{}
+	var resp protocol.TraceEventsResponse
+	err := p.s.TraceEvents(&req, &resp)
+	return resp.Events, err
+}
+
+func (p *Program) Trace(funcRegexp string) ([]string, error) {
+	req := protocol.TraceRequest{Regexp: funcRegexp}
+	var resp protocol.TraceResponse
+	err := p.s.Trace(&req, &resp)
+	return resp.Functions, err
+}
+
+func (p *Program) EnableBreakpointGroup(group string, enabled bool) error {
+	req := protocol.EnableBreakpointGroupRequest{Group: group, Enabled: enabled}
+	var resp protocol.EnableBreakpointGroupResponse
+	return p.s.EnableBreakpointGroup(&req, &resp)
+}
+
+func (p *Program) DeleteBreakpointGroup(group string) error {
+	req := protocol.DeleteBreakpointGroupRequest{Group: group}
+	var resp protocol.DeleteBreakpointGroupResponse
+	return p.s.DeleteBreakpointGroup(&req, &resp)
+}
+
+func (p *Program) ListBreakpoints() ([]debug.Breakpoint, error) {
+	req := protocol.ListBreakpointsRequest{}
+	var resp protocol.ListBreakpointsResponse
+	err := p.s.ListBreakpoints(&req, &resp)
+	return resp.Breakpoints, err
+}
+
+func (p *Program) WatchGlobal(name string) (debug.Watchpoint, error) {
+	req := protocol.WatchGlobalRequest{Name: name}
+	var resp protocol.WatchGlobalResponse
+	err := p.s.WatchGlobal(&req, &resp)
+	return resp.Watchpoint, err
+}
+
+func (p *Program) WatchMap(m debug.Map, threshold uint64) (debug.Watchpoint, error) {
+	req := protocol.WatchMapRequest{Map: m, Threshold: threshold}
+	var resp protocol.WatchMapResponse
+	err := p.s.WatchMap(&req, &resp)
+	return resp.Watchpoint, err
+}
+
+func (p *Program) DeleteWatchpoints(ids []uint64) error {
+	req := protocol.DeleteWatchpointsRequest{IDs: ids}
+	var resp protocol.DeleteWatchpointsResponse
+	return p.s.DeleteWatchpoints(&req, &resp)
+}
+
+func (p *Program) FindString(substr string) ([]debug.StringMatch, error) {
+	req := protocol.FindStringRequest{Substring: substr}
+	var resp protocol.FindStringResponse
+	err := p.s.FindString(&req, &resp)
+	return resp.Matches, err
+}
+
 func (p *Program) Eval(expr string) ([]string, error) {
 	req := protocol.EvalRequest{
 		Expr: expr,
@@ -115,13 +496,58 @@ func (p *Program) Eval(expr string) ([]string, error) {
 	return resp.Result, err
 }
 
-func (p *Program) Evaluate(e string) (debug.Value, error) {
+func (p *Program) EvalFormat(expr string, opts debug.FormatOptions) ([]string, error) {
+	req := protocol.EvalRequest{
+		Expr:   expr,
+		Format: opts,
+	}
+	var resp protocol.EvalResponse
+	err := p.s.Eval(&req, &resp)
+	return resp.Result, err
+}
+
+func (p *Program) Evaluate(e string) (debug.Value, debug.Type, error) {
 	req := protocol.EvaluateRequest{
 		Expression: e,
 	}
 	var resp protocol.EvaluateResponse
 	err := p.s.Evaluate(&req, &resp)
-	return resp.Result, err
+	if err == nil && resp.Err != nil {
+		return nil, debug.Type{}, resp.Err
+	}
+	return resp.Result, resp.Type, err
+}
+
+func (p *Program) Sample(expressions ...string) ([]debug.Sample, error) {
+	req := protocol.SampleRequest{
+		Expressions: expressions,
+	}
+	var resp protocol.SampleResponse
+	err := p.s.Sample(&req, &resp)
+	return resp.Samples, err
+}
+
+func (p *Program) Batch(calls []debug.BatchCall) ([]debug.BatchResult, error) {
+	req := protocol.BatchRequest{
+		Calls: calls,
+	}
+	var resp protocol.BatchResponse
+	err := p.s.Batch(&req, &resp)
+	return resp.Results, err
+}
+
+func (p *Program) BinaryInfo() (debug.BinaryInfo, error) {
+	req := protocol.BinaryInfoRequest{}
+	var resp protocol.BinaryInfoResponse
+	err := p.s.BinaryInfo(&req, &resp)
+	return resp.Info, err
+}
+
+func (p *Program) History(expr string, n int) ([]debug.HistoryEntry, error) {
+	req := protocol.HistoryRequest{Expr: expr, N: n}
+	var resp protocol.HistoryResponse
+	err := p.s.History(&req, &resp)
+	return resp.Entries, err
 }
 
 func (p *Program) Frames(count int) ([]debug.Frame, error) {
@@ -133,6 +559,52 @@ func (p *Program) Frames(count int) ([]debug.Frame, error) {
 	return resp.Frames, err
 }
 
+func (p *Program) SelectFrame(frameIndex int) error {
+	req := protocol.SelectFrameRequest{
+		Frame: frameIndex,
+	}
+	var resp protocol.SelectFrameResponse
+	return p.s.SelectFrame(&req, &resp)
+}
+
+func (p *Program) Threads() ([]debug.Thread, error) {
+	req := protocol.ThreadsRequest{}
+	var resp protocol.ThreadsResponse
+	err := p.s.Threads(&req, &resp)
+	return resp.Threads, err
+}
+
+func (p *Program) SharedObjects() ([]debug.SharedObject, error) {
+	req := protocol.SharedObjectsRequest{}
+	var resp protocol.SharedObjectsResponse
+	err := p.s.SharedObjects(&req, &resp)
+	return resp.Objects, err
+}
+
+func (p *Program) SelectThread(tid int) error {
+	req := protocol.SelectThreadRequest{
+		Thread: tid,
+	}
+	var resp protocol.SelectThreadResponse
+	return p.s.SelectThread(&req, &resp)
+}
+
+func (p *Program) LocalVariables(frameIndex int) ([]debug.LocalVar, error) {
+	req := protocol.LocalVariablesRequest{
+		FrameIndex: frameIndex,
+	}
+	var resp protocol.LocalVariablesResponse
+	err := p.s.LocalVariables(&req, &resp)
+	return resp.Vars, err
+}
+
+func (p *Program) ChannelWaiters(ch debug.Channel) ([]debug.ChannelWaiter, error) {
+	req := protocol.ChannelWaitersRequest{Channel: ch}
+	var resp protocol.ChannelWaitersResponse
+	err := p.s.ChannelWaiters(&req, &resp)
+	return resp.Waiters, err
+}
+
 func (p *Program) Goroutines() ([]*debug.Goroutine, error) {
 	req := protocol.GoroutinesRequest{}
 	var resp protocol.GoroutinesResponse
@@ -140,6 +612,95 @@ func (p *Program) Goroutines() ([]*debug.Goroutine, error) {
 	return resp.Goroutines, err
 }
 
+func (p *Program) PanicInfo() (debug.PanicInfo, error) {
+	req := protocol.PanicInfoRequest{}
+	var resp protocol.PanicInfoResponse
+	err := p.s.PanicInfo(&req, &resp)
+	return resp.Info, err
+}
+
+func (p *Program) DeferredCalls(goroutine int64, frameIndex int) ([]debug.DeferredCall, error) {
+	req := protocol.DeferredCallsRequest{
+		Goroutine:  goroutine,
+		FrameIndex: frameIndex,
+	}
+	var resp protocol.DeferredCallsResponse
+	err := p.s.DeferredCalls(&req, &resp)
+	return resp.Calls, err
+}
+
+func (p *Program) HeapStats() (debug.HeapStats, error) {
+	req := protocol.HeapStatsRequest{}
+	var resp protocol.HeapStatsResponse
+	err := p.s.HeapStats(&req, &resp)
+	return resp.Stats, err
+}
+
+func (p *Program) HeapDump() ([]debug.HeapObject, error) {
+	req := protocol.HeapDumpRequest{}
+	var resp protocol.HeapDumpResponse
+	err := p.s.HeapDump(&req, &resp)
+	return resp.Objects, err
+}
+
+func (p *Program) FindReferences(addr uint64) ([]debug.Reference, error) {
+	req := protocol.FindReferencesRequest{Address: addr}
+	var resp protocol.FindReferencesResponse
+	err := p.s.FindReferences(&req, &resp)
+	return resp.References, err
+}
+
+func (p *Program) RuntimeStatus() (debug.RuntimeStatus, error) {
+	req := protocol.RuntimeStatusRequest{}
+	var resp protocol.RuntimeStatusResponse
+	err := p.s.RuntimeStatus(&req, &resp)
+	return resp.Status, err
+}
+
+func (p *Program) Functions(re string) ([]string, error) {
+	req := protocol.FunctionsRequest{Regexp: re}
+	var resp protocol.FunctionsResponse
+	err := p.s.Functions(&req, &resp)
+	return resp.Names, err
+}
+
+func (p *Program) Sources() ([]string, error) {
+	req := protocol.SourcesRequest{}
+	var resp protocol.SourcesResponse
+	err := p.s.Sources(&req, &resp)
+	return resp.Files, err
+}
+
+func (p *Program) Source(file string, startLine, endLine uint64) (debug.Source, error) {
+	req := protocol.SourceRequest{File: file, StartLine: startLine, EndLine: endLine}
+	var resp protocol.SourceResponse
+	err := p.s.Source(&req, &resp)
+	return resp.Source, err
+}
+
+func (p *Program) Types(re string) ([]string, error) {
+	req := protocol.TypesRequest{Regexp: re}
+	var resp protocol.TypesResponse
+	err := p.s.Types(&req, &resp)
+	return resp.Names, err
+}
+
+func (p *Program) Type(typeID uint64) (debug.TypeInfo, error) {
+	req := protocol.TypeRequest{TypeID: typeID}
+	var resp protocol.TypeResponse
+	err := p.s.Type(&req, &resp)
+	return resp.Info, err
+}
+
+func (p *Program) ExportDebugManifest(w io.Writer) error {
+	req := protocol.DebugManifestRequest{}
+	var resp protocol.DebugManifestResponse
+	if err := p.s.DebugManifest(&req, &resp); err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(resp.Manifest)
+}
+
 func (p *Program) VarByName(name string) (debug.Var, error) {
 	req := protocol.VarByNameRequest{Name: name}
 	var resp protocol.VarByNameResponse
@@ -147,13 +708,59 @@ func (p *Program) VarByName(name string) (debug.Var, error) {
 	return resp.Var, err
 }
 
+func (p *Program) AsPointer(v debug.Value, typeName string) (debug.Var, error) {
+	req := protocol.AsPointerRequest{Value: v, TypeName: typeName}
+	var resp protocol.AsPointerResponse
+	err := p.s.AsPointer(&req, &resp)
+	return resp.Var, err
+}
+
 func (p *Program) Value(v debug.Var) (debug.Value, error) {
 	req := protocol.ValueRequest{Var: v}
 	var resp protocol.ValueResponse
 	err := p.s.Value(&req, &resp)
+	if err == nil && resp.Freed != nil {
+		return nil, resp.Freed
+	}
 	return resp.Value, err
 }
 
+func (p *Program) ReadMemory(addr uint64, length int) ([]byte, error) {
+	req := protocol.ReadMemoryRequest{
+		Address: addr,
+		Length:  length,
+	}
+	var resp protocol.ReadMemoryResponse
+	err := p.s.ReadMemory(&req, &resp)
+	if err == nil && resp.Err != nil {
+		return resp.Data, resp.Err
+	}
+	return resp.Data, err
+}
+
+func (p *Program) WriteMemory(addr uint64, data []byte) (int, error) {
+	req := protocol.WriteMemoryRequest{
+		Address: addr,
+		Data:    data,
+	}
+	var resp protocol.WriteMemoryResponse
+	err := p.s.WriteMemory(&req, &resp)
+	if err == nil && resp.Err != nil {
+		return resp.Written, resp.Err
+	}
+	return resp.Written, err
+}
+
+func (p *Program) ValueTree(v debug.Var, depth int) (debug.ValueTree, error) {
+	req := protocol.ValueTreeRequest{
+		Var:   v,
+		Depth: depth,
+	}
+	var resp protocol.ValueTreeResponse
+	err := p.s.ValueTree(&req, &resp)
+	return resp.Tree, err
+}
+
 func (p *Program) MapElement(m debug.Map, index uint64) (debug.Var, debug.Var, error) {
 	req := protocol.MapElementRequest{Map: m, Index: index}
 	var resp protocol.MapElementResponse
@@ -161,6 +768,13 @@ func (p *Program) MapElement(m debug.Map, index uint64) (debug.Var, debug.Var, e
 	return resp.Key, resp.Value, err
 }
 
+func (p *Program) MapElements(m debug.Map, start, count uint64) ([]debug.MapEntry, error) {
+	req := protocol.MapElementsRequest{Map: m, Start: start, Count: count}
+	var resp protocol.MapElementsResponse
+	err := p.s.MapElements(&req, &resp)
+	return resp.Entries, err
+}
+
 // File implements the debug.File interface, providing access
 // to file-like resources associated with the target program.
 type File struct {
@@ -191,3 +805,28 @@ func (f *File) Close() error {
 	err := f.prog.s.Close(&req, &resp)
 	return err
 }
+
+// outputReader reads the output of the process from one of its standard
+// output streams.
+type outputReader struct {
+	prog *Program
+	fd   int
+}
+
+func (f *outputReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	req := protocol.ReadOutputRequest{
+		FD:  f.fd,
+		Len: len(p),
+	}
+	var resp protocol.ReadOutputResponse
+	if err := f.prog.s.ReadOutput(&req, &resp); err != nil {
+		return 0, err
+	}
+	if resp.EOF {
+		return 0, io.EOF
+	}
+	return copy(p, resp.Data), nil
+}
@@ -0,0 +1,195 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Debugging a package's tests.
+
+package local
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/server/protocol"
+)
+
+// Test is a program running the tests of a package.
+type Test struct {
+	*Program
+
+	// Binary is the path of the test binary.
+	Binary string
+
+	// Breakpoints holds the breakpoint set on each test function that the
+	// -test.run pattern selects, by the name of the function.
+	Breakpoints map[string]debug.Breakpoint
+
+	// Status is the status of the process after it was started.
+	Status debug.Status
+
+	dir string // The temporary directory holding Binary.
+}
+
+// NewTest builds the test binary for the package in directory pkgDir, with
+// optimizations and inlining disabled, and starts it as go test would,
+// running the tests that match testRunPattern (all of them, if it is empty).
+// It sets a breakpoint on each of those tests, so that the first Resume stops
+// at the start of the first test to run.
+//
+// The test binary is removed by Close.
+func NewTest(pkgDir, testRunPattern string) (*Test, error) {
+	pkgDir, err := filepath.Abs(pkgDir)
+	if err != nil {
+		return nil, err
+	}
+	names, err := testFunctions(pkgDir, testRunPattern)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := ioutil.TempDir("", "debugtest")
+	if err != nil {
+		return nil, err
+	}
+	t := &Test{
+		Binary:      filepath.Join(dir, "test.exe"),
+		Breakpoints: make(map[string]debug.Breakpoint),
+		dir:         dir,
+	}
+	if err := t.build(pkgDir); err != nil {
+		t.Close()
+		return nil, err
+	}
+	if t.Program, err = New(t.Binary); err != nil {
+		t.Close()
+		return nil, err
+	}
+	var args []string
+	if testRunPattern != "" {
+		args = append(args, "-test.run", testRunPattern)
+	}
+	// Tests run in the package's directory, as they do under go test.
+	req := protocol.RunRequest{Args: args, Dir: pkgDir}
+	var resp protocol.RunResponse
+	if err := t.s.Run(&req, &resp); err != nil {
+		t.Close()
+		return nil, err
+	}
+	t.Status = resp.Status
+	for _, name := range names {
+		bp, err := t.BreakpointAtFunction(name)
+		if err != nil {
+			t.Detach() // Kills the process, since it was started to be killed on exit.
+			t.Close()
+			return nil, fmt.Errorf("breakpoint on %s: %v", name, err)
+		}
+		t.Breakpoints[name] = bp
+	}
+	return t, nil
+}
+
+// build builds the test binary for the package in pkgDir.
+func (t *Test) build(pkgDir string) error {
+	cmd := exec.Command("go", "test", "-c", "-o", t.Binary,
+		"-gcflags=all=-N -l", "-ldflags=-compressdwarf=false")
+	cmd.Dir = pkgDir
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("go test -c: %v\n%s", err, out.Bytes())
+	}
+	if _, err := os.Stat(t.Binary); err != nil {
+		// go test -c writes nothing for a package without tests.
+		return fmt.Errorf("no test binary for %s", pkgDir)
+	}
+	return nil
+}
+
+// Close removes the test binary.  It does not stop the process; use Kill or
+// Detach for that.
+func (t *Test) Close() error {
+	return os.RemoveAll(t.dir)
+}
+
+// testFunctions returns the full names of the test functions in the package
+// in pkgDir that testRunPattern selects.  As with go test, the pattern is
+// split on slashes into patterns for tests and their subtests; only the
+// first is used here.
+func testFunctions(pkgDir, testRunPattern string) ([]string, error) {
+	cmd := exec.Command("go", "list", "-f", "{{.Name}} {{.ImportPath}}")
+	cmd.Dir = pkgDir
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go list: %v", err)
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("go list: unexpected output %q", out)
+	}
+	// Symbols in a main package are qualified by "main", not the import path.
+	importPath := fields[1]
+	if fields[0] == "main" {
+		importPath = "main"
+	}
+
+	var re *regexp.Regexp
+	if testRunPattern != "" {
+		re, err = regexp.Compile(strings.SplitN(testRunPattern, "/", 2)[0])
+		if err != nil {
+			return nil, fmt.Errorf("bad test pattern: %v", err)
+		}
+	}
+	files, err := filepath.Glob(filepath.Join(pkgDir, "*_test.go"))
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	fset := token.NewFileSet()
+	for _, file := range files {
+		f, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		// Functions in an external test package have that package's name.
+		pkg := importPath
+		if strings.HasSuffix(f.Name.Name, "_test") {
+			pkg += "_test"
+		}
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv != nil || !isTest(fn.Name.Name) {
+				continue
+			}
+			if re != nil && !re.MatchString(fn.Name.Name) {
+				continue
+			}
+			names = append(names, pkg+"."+fn.Name.Name)
+		}
+	}
+	return names, nil
+}
+
+// isTest reports whether name is the name of a test function: "Test", or
+// "Test" followed by something that doesn't start with a lower-case letter.
+func isTest(name string) bool {
+	if !strings.HasPrefix(name, "Test") {
+		return false
+	}
+	if len(name) == len("Test") {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(name[len("Test"):])
+	return !unicode.IsLower(r)
+}
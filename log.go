@@ -0,0 +1,112 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package debug
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Level is the severity of a log message.
+type Level int
+
+const (
+	LevelDebug Level = iota // Detailed traces, such as each ptrace call.
+	LevelInfo               // Significant events, such as a process starting.
+	LevelWarn               // Problems the debugger can work around.
+	LevelError              // Failures.
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// Field is a named value attached to a log message.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Logger receives messages describing the debugger's internal operations.
+// Its methods may be called concurrently.
+type Logger interface {
+	Log(level Level, msg string, fields ...Field)
+}
+
+// loggerHolder lets a Logger of any dynamic type be stored in an atomic.Value.
+type loggerHolder struct {
+	l Logger
+}
+
+var logger atomic.Value // Holds a loggerHolder.
+
+// SetLogger sets the Logger that receives traces from the server (its ptrace
+// calls and the requests it handles), from DWARF parsing, and from remote
+// clients' RPCs.  The default, nil, turns logging off.  SetLogger can be
+// called at any time, from any goroutine.
+func SetLogger(l Logger) {
+	logger.Store(loggerHolder{l})
+}
+
+// Log sends a message to the Logger set with SetLogger, if there is one.
+func Log(level Level, msg string, fields ...Field) {
+	if h, ok := logger.Load().(loggerHolder); ok && h.l != nil {
+		h.l.Log(level, msg, fields...)
+	}
+}
+
+// TextLogger is a Logger that writes each message as a line of text: the
+// level, the message, and the fields as key=value pairs.  Values of type
+// uintptr, which are usually addresses, are written in hexadecimal.
+type TextLogger struct {
+	mu  sync.Mutex
+	w   io.Writer
+	min Level
+}
+
+// NewTextLogger returns a TextLogger writing the messages at level min and
+// above to w.
+func NewTextLogger(w io.Writer, min Level) *TextLogger {
+	return &TextLogger{w: w, min: min}
+}
+
+func (t *TextLogger) Log(level Level, msg string, fields ...Field) {
+	if level < t.min {
+		return
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s %s", level, msg)
+	for _, f := range fields {
+		var v string
+		switch x := f.Value.(type) {
+		case uintptr:
+			v = fmt.Sprintf("%#x", x)
+		default:
+			v = fmt.Sprint(x)
+		}
+		if v == "" || strings.ContainsAny(v, " \t\n\"=") {
+			v = fmt.Sprintf("%q", v)
+		}
+		fmt.Fprintf(&b, " %s=%s", f.Key, v)
+	}
+	b.WriteByte('\n')
+	t.mu.Lock()
+	t.w.Write(b.Bytes())
+	t.mu.Unlock()
+}
@@ -0,0 +1,32 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package debug
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestTextLogger(t *testing.T) {
+	var b bytes.Buffer
+	SetLogger(NewTextLogger(&b, LevelInfo))
+	defer SetLogger(nil)
+
+	Log(LevelDebug, "ptrace", Field{"op", "peek"})
+	Log(LevelInfo, "started", Field{"pid", 123}, Field{"addr", uintptr(0x4000)})
+	Log(LevelWarn, "failed", Field{"err", errors.New("no such process")}, Field{"name", ""})
+	want := "info started pid=123 addr=0x4000\n" +
+		`warn failed err="no such process" name=""` + "\n"
+	if got := b.String(); got != want {
+		t.Errorf("got log\n%s\nwant\n%s", got, want)
+	}
+
+	SetLogger(nil)
+	Log(LevelError, "dropped")
+	if got := b.String(); got != want {
+		t.Errorf("logged after SetLogger(nil): %q", got[len(want):])
+	}
+}
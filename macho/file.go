@@ -9,9 +9,11 @@ package macho
 
 import (
 	"bytes"
+	"compress/zlib"
 	"encoding/binary"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 
 	"golang.org/x/debug/dwarf"
@@ -473,27 +475,74 @@ func (f *File) Section(name string) *Section {
 // DWARF returns the DWARF debug information for the Mach-O file.
 func (f *File) DWARF() (*dwarf.Data, error) {
 	// There are many other DWARF sections, but these
-	// are the required ones, and the debug/dwarf package
-	// does not use the others, so don't bother loading them.
-	var names = [...]string{"abbrev", "frame", "info", "line", "str"}
-	var dat [len(names)][]byte
-	for i, name := range names {
-		name = "__debug_" + name
-		s := f.Section(name)
-		if s == nil {
-			continue
+	// are the required ones, those DWARF 5 adds, and the
+	// location lists describing variables whose location
+	// varies, such as arguments passed in registers.
+	sections := make(map[string][]byte)
+	for _, name := range dwarfSections {
+		b, err := f.sectionData(name)
+		if err != nil {
+			return nil, err
+		}
+		if b != nil {
+			sections[name] = b
 		}
+	}
+	return dwarf.NewFromSections(sections)
+}
+
+// sectionData returns the contents of the DWARF section with the given
+// suffix, such as "info", or nil if there is none.  The Go linker names
+// sections it has compressed "__zdebug_" rather than "__debug_".
+func (f *File) sectionData(suffix string) ([]byte, error) {
+	// Section names are truncated to 16 bytes.
+	section := func(prefix string) *Section {
+		name := prefix + suffix
+		if len(name) > 16 {
+			name = name[:16]
+		}
+		return f.Section(name)
+	}
+	if s := section("__debug_"); s != nil {
 		b, err := s.Data()
 		if err != nil && uint64(len(b)) < s.Size {
 			return nil, err
 		}
-		dat[i] = b
+		return b, nil
 	}
-
-	abbrev, frame, info, line, str := dat[0], dat[1], dat[2], dat[3], dat[4]
-	return dwarf.New(abbrev, nil, frame, info, line, nil, nil, str)
+	s := section("__zdebug_")
+	if s == nil {
+		return nil, nil
+	}
+	b, err := s.Data()
+	if err != nil && uint64(len(b)) < s.Size {
+		return nil, err
+	}
+	// A compressed section is "ZLIB", the big-endian uncompressed size, and
+	// the zlib stream.
+	if len(b) < 12 || string(b[:4]) != "ZLIB" {
+		return nil, fmt.Errorf("section %s: bad compression header", s.Name)
+	}
+	size := binary.BigEndian.Uint64(b[4:12])
+	r, err := zlib.NewReader(bytes.NewReader(b[12:]))
+	if err != nil {
+		return nil, fmt.Errorf("section %s: %v", s.Name, err)
+	}
+	d, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("section %s: %v", s.Name, err)
+	}
+	if uint64(len(d)) != size {
+		return nil, fmt.Errorf("section %s: got %d bytes, expected %d", s.Name, len(d), size)
+	}
+	return d, nil
 }
 
+// dwarfSections are the names, without their prefix, of the DWARF sections
+// that DWARF reads.
+var dwarfSections = [...]string{"abbrev", "frame", "info", "line", "ranges", "str",
+	"loc", "addr", "line_str", "str_offsets", "rnglists", "loclists"}
+
 // ImportedSymbols returns the names of all symbols
 // referred to by the binary f that are expected to be
 // satisfied by other libraries at dynamic load time.
@@ -5,7 +5,12 @@
 package macho
 
 import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -208,3 +213,51 @@ func TestOpenFatFailure(t *testing.T) {
 		t.Errorf("OpenFat %s: got %v, want nil", filename, ff)
 	}
 }
+
+func TestGoDWARF(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+	dir, err := ioutil.TempDir("", "machotest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "hello.go")
+	if err := ioutil.WriteFile(src, []byte("package main\n\nfunc main() {\n\tprintln(\"hello\")\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name, ldflags string
+	}{
+		{"compressed", ""},
+		{"uncompressed", "-compressdwarf=false"},
+	} {
+		exe := filepath.Join(dir, test.name)
+		cmd := exec.Command("go", "build", "-ldflags="+test.ldflags, "-o", exe, src)
+		cmd.Env = append(os.Environ(), "GO111MODULE=off", "GOOS=darwin", "GOARCH=amd64", "CGO_ENABLED=0")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Skipf("building test program: %v\n%s", err, out)
+		}
+		f, err := Open(exe)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		d, err := f.DWARF()
+		if err != nil && strings.Contains(err.Error(), "unsupported DWARF version") {
+			f.Close()
+			t.Skipf("%s: %v", test.name, err)
+		}
+		if err != nil {
+			t.Fatalf("%s: DWARF: %v", test.name, err)
+		}
+		entry, err := d.LookupFunction("main.main")
+		if err != nil {
+			t.Errorf("%s: LookupFunction(main.main): %v", test.name, err)
+		} else if entry == nil {
+			t.Errorf("%s: no entry for main.main", test.name)
+		}
+		f.Close()
+	}
+}
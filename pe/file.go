@@ -0,0 +1,137 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package pe implements access to PE (Microsoft Windows Portable Executable)
+// files.  The file format itself is parsed by the standard library's debug/pe
+// package; this package adds access to the DWARF debugging information, for
+// which it uses golang.org/x/debug/dwarf.
+package pe // import "golang.org/x/debug/pe"
+
+import (
+	"bytes"
+	"compress/zlib"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"golang.org/x/debug/dwarf"
+)
+
+// Machine types, as in the FileHeader.
+const (
+	IMAGE_FILE_MACHINE_I386  = pe.IMAGE_FILE_MACHINE_I386
+	IMAGE_FILE_MACHINE_AMD64 = pe.IMAGE_FILE_MACHINE_AMD64
+	IMAGE_FILE_MACHINE_ARMNT = pe.IMAGE_FILE_MACHINE_ARMNT
+)
+
+// A File represents an open PE file.
+type File struct {
+	*pe.File
+}
+
+// Open opens the named file using os.Open and prepares it for use as a PE
+// binary.
+func Open(name string) (*File, error) {
+	f, err := pe.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &File{f}, nil
+}
+
+// NewFile creates a new File for accessing a PE binary in an underlying
+// reader.
+func NewFile(r io.ReaderAt) (*File, error) {
+	f, err := pe.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+	return &File{f}, nil
+}
+
+// ImageBase returns the address at which the image is loaded, to which the
+// sections' virtual addresses are relative.
+func (f *File) ImageBase() uint64 {
+	switch h := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		return uint64(h.ImageBase)
+	case *pe.OptionalHeader64:
+		return h.ImageBase
+	}
+	return 0
+}
+
+// sectionData returns the contents of the DWARF section with the given
+// suffix, such as "info", or nil if there is none.  The Go linker names
+// sections it has compressed ".zdebug_" rather than ".debug_".
+func (f *File) sectionData(suffix string) ([]byte, error) {
+	if s := f.Section(".debug_" + suffix); s != nil {
+		return sectionData(s)
+	}
+	s := f.Section(".zdebug_" + suffix)
+	if s == nil {
+		return nil, nil
+	}
+	b, err := sectionData(s)
+	if err != nil {
+		return nil, err
+	}
+	// A compressed section is "ZLIB", the big-endian uncompressed size, and
+	// the zlib stream.
+	if len(b) < 12 || string(b[:4]) != "ZLIB" {
+		return nil, fmt.Errorf("section %s: bad compression header", s.Name)
+	}
+	size := binary.BigEndian.Uint64(b[4:12])
+	r, err := zlib.NewReader(bytes.NewReader(b[12:]))
+	if err != nil {
+		return nil, fmt.Errorf("section %s: %v", s.Name, err)
+	}
+	d, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("section %s: %v", s.Name, err)
+	}
+	if uint64(len(d)) != size {
+		return nil, fmt.Errorf("section %s: got %d bytes, expected %d", s.Name, len(d), size)
+	}
+	return d, nil
+}
+
+// sectionData returns the contents of s, without the padding to the file
+// alignment that follows them in the file.
+func sectionData(s *pe.Section) ([]byte, error) {
+	b, err := s.Data()
+	if err != nil {
+		return nil, err
+	}
+	if 0 < s.VirtualSize && s.VirtualSize < uint32(len(b)) {
+		b = b[:s.VirtualSize]
+	}
+	return b, nil
+}
+
+// DWARF returns the DWARF debug information for the PE file.
+func (f *File) DWARF() (*dwarf.Data, error) {
+	// There are many other DWARF sections, but these
+	// are the required ones, those DWARF 5 adds, and the
+	// location lists describing variables whose location
+	// varies, such as arguments passed in registers.
+	sections := make(map[string][]byte)
+	for _, name := range dwarfSections {
+		b, err := f.sectionData(name)
+		if err != nil {
+			return nil, err
+		}
+		if b != nil {
+			sections[name] = b
+		}
+	}
+	return dwarf.NewFromSections(sections)
+}
+
+// dwarfSections are the names, without their prefix, of the DWARF sections
+// that DWARF reads.
+var dwarfSections = [...]string{"abbrev", "frame", "info", "line", "ranges", "str",
+	"loc", "addr", "line_str", "str_offsets", "rnglists", "loclists"}
@@ -0,0 +1,70 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pe
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// buildHello builds testdata/hello.go for Windows, with the given linker
+// flags, returning the path of the executable.
+func buildHello(t *testing.T, dir, name, ldflags string) string {
+	exe := filepath.Join(dir, name)
+	cmd := exec.Command("go", "build", "-ldflags="+ldflags, "-o", exe, "testdata/hello.go")
+	cmd.Env = append(os.Environ(), "GOOS=windows", "GOARCH=amd64", "CGO_ENABLED=0")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Skipf("building test program: %v\n%s", err, out)
+	}
+	return exe
+}
+
+func TestDWARF(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+	dir, err := ioutil.TempDir("", "petest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, test := range []struct {
+		name, ldflags string
+	}{
+		{"compressed.exe", ""},
+		{"uncompressed.exe", "-compressdwarf=false"},
+	} {
+		f, err := Open(buildHello(t, dir, test.name, test.ldflags))
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if f.Machine != IMAGE_FILE_MACHINE_AMD64 {
+			t.Errorf("%s: got machine %#x, expected %#x", test.name, f.Machine, IMAGE_FILE_MACHINE_AMD64)
+		}
+		if f.ImageBase() == 0 {
+			t.Errorf("%s: got zero image base", test.name)
+		}
+		d, err := f.DWARF()
+		if err != nil && strings.Contains(err.Error(), "unsupported DWARF version") {
+			f.Close()
+			t.Skipf("%s: %v", test.name, err)
+		}
+		if err != nil {
+			t.Fatalf("%s: DWARF: %v", test.name, err)
+		}
+		entry, err := d.LookupFunction("main.main")
+		if err != nil {
+			t.Errorf("%s: LookupFunction(main.main): %v", test.name, err)
+		} else if entry == nil {
+			t.Errorf("%s: no entry for main.main", test.name)
+		}
+		f.Close()
+	}
+}
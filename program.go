@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"time"
 )
 
 // Program is the interface to a (possibly remote) program being debugged.
@@ -41,26 +42,322 @@ type Program interface {
 	// Resume resumes execution of a stopped process.
 	// The call hangs until the program stops executing,
 	// at which point it returns the program status.
+	// If the process exits instead, Resume returns a *ProcessExited error,
+	// as do all subsequent calls that need the process until Run starts
+	// a new one.
+	// If a timeout has been set with SetResumeTimeout, Resume returns after
+	// that long even if the program hasn't stopped, as described there.
 	Resume() (Status, error)
 
+	// SetResumeTimeout sets how long Resume waits for the program to stop.
+	// If the program is still running after that long, Resume returns a
+	// Status with the Reason "running", leaving the program running; the
+	// next call to Resume doesn't resume it again, but waits for it to stop
+	// in the same way.  Meanwhile Interrupt can stop it, and other requests
+	// that need the process wait until it stops.  A timeout of zero, the
+	// default, makes Resume wait until the program stops.  The timeout is
+	// kept by the client, and is not sent to the debugger.
+	SetResumeTimeout(d time.Duration)
+
+	// RunToLine resumes execution of a stopped process until it reaches the
+	// specified source line, as if a one-shot breakpoint were set there.  If
+	// the program stops somewhere else first, RunToLine returns the status
+	// there, and the program won't later stop at the line.
+	RunToLine(file string, line uint64) (Status, error)
+
+	// ResumeAsync resumes execution of a stopped process, like Resume, but
+	// returns at once.  What happens to the process while it runs is
+	// reported on the channel returned by Events: signals its threads
+	// receive, and finally its stopping or exiting, or the failure to resume
+	// it.  Other requests wait until the process stops.
+	ResumeAsync() error
+
+	// Events returns the channel on which the events of processes resumed
+	// with ResumeAsync are delivered.  Events are kept until they are
+	// received, so it need not be called before ResumeAsync.
+	Events() <-chan Event
+
+	// Checkpoint saves a copy of the stopped process, made with fork, and
+	// returns an ID with which Restore can return to it.  As with GDB's
+	// checkpoints, only the thread that stopped the program is copied, so
+	// a restored program that needs its other threads may hang.
+	Checkpoint() (uint64, error)
+
+	// Restore replaces the process, killing it if it is still alive, with
+	// a new copy of the process saved by the checkpoint with the specified
+	// ID, stopped where it was saved, and returns its status, whose Reason
+	// is "restore".  The current breakpoints are set in it.  The
+	// checkpoint is kept, so that it can be restored again.  The restored
+	// process's output goes where the saved process's did.
+	Restore(id uint64) (Status, error)
+
+	// DeleteCheckpoint discards the checkpoint with the specified ID.
+	DeleteCheckpoint(id uint64) error
+
+	// SetRecording sets whether the program's stops are recorded, so that
+	// ReverseToPreviousBreak and ReverseToPreviousStop can take it back to
+	// them.  At each stop a checkpoint is made, as by Checkpoint, and those
+	// of the last 16 stops are kept.  Nothing is replayed: the program isn't
+	// run backwards, and its system calls and signals aren't logged; it is
+	// only returned to each stop exactly as it was.  Running on from a stop
+	// it was taken back to may not take the same path as before, and
+	// forgets the stops that came after it.  As with Checkpoint, only the
+	// thread that stopped the program is copied at each stop, so a program
+	// taken back to a stop that needs its other threads may hang.
+	SetRecording(enabled bool) error
+
+	// ReverseToPreviousBreak takes the program back to the last recorded
+	// stop before the current one for a reason other than a step, or to the
+	// last one if the process has exited, and returns its status as it was
+	// then, but with the new thread.
+	ReverseToPreviousBreak() (Status, error)
+
+	// ReverseToPreviousStop takes the program back to the recorded stop
+	// before the current one, which after StepInstruction is the instruction
+	// before, and returns its status like ReverseToPreviousBreak.
+	ReverseToPreviousStop() (Status, error)
+
+	// Interrupt stops the process while it runs after Resume, ResumeAsync or
+	// RunToLine, which then report its status with the Reason "interrupt",
+	// so that a program that doesn't reach a breakpoint can be examined.
+	// Interrupt returns as soon as the process is stopped, without waiting
+	// for Resume to return.  If the process isn't running, Interrupt does
+	// nothing.
+	Interrupt() error
+
+	// StepInstruction executes one machine instruction in the thread that
+	// stopped the program, and returns the status of the program after it.
+	// The program's other threads stay stopped.  A signal the program
+	// stopped for stays pending until the program is resumed.
+	StepInstruction() (Status, error)
+
 	// TODO: Step(). Where does the granularity happen,
 	// on the proxy end or the debugging control end?
 
-	// Kill kills the current process.
+	// Kill kills the current process, and waits for it to exit.  Like
+	// Resume after the process exits, subsequent calls that need the
+	// process return a *ProcessExited error until Run or Restart starts a
+	// new one.  Breakpoints are kept, for the next process.
 	Kill() (Status, error)
 
+	// Restart kills the current process, if it is still running, and starts
+	// a new one with the arguments of the last Run.  If keepBreakpoints is
+	// true, breakpoints, and watchpoints on globals, are re-established in
+	// the new process, even if its executable is loaded at a different
+	// address; otherwise they are deleted.  Watchpoints set by WatchMap are
+	// always deleted.
+	Restart(keepBreakpoints bool) (Status, error)
+
+	// SetKillOnExit sets whether the process is killed, rather than left
+	// running, when the debugger detaches from it or exits.  It takes effect
+	// from the next Run.  Processes are killed by default.  If the debugger
+	// crashes while a process it left running has breakpoints set, the process
+	// will die when it reaches one.
+	SetKillOnExit(kill bool) error
+
+	// SetDeterministic sets whether processes are run with as little
+	// nondeterminism as possible, for reproducing bugs that depend on the
+	// order in which goroutines run.  It takes effect from the next Run.
+	// Processes are then started with GOMAXPROCS=1 and asynchronous
+	// preemption disabled, so that goroutines switch only at function calls
+	// and blocking operations; and when the debugger steps a thread past a
+	// breakpoint whose condition isn't met, the other threads are stopped
+	// meanwhile, so that the stepping doesn't change which thread runs first.
+	SetDeterministic(on bool) error
+
+	// SetShowTemporaries sets whether the variables listed for stack frames,
+	// by Frames and LocalVariables, include those the compiler introduces,
+	// like ".autotmp_3", and the parameters and results that are left
+	// unnamed, which the compiler calls names like "~r0".  They are left out
+	// by default.
+	SetShowTemporaries(show bool) error
+
+	// SetSignalPolicy sets what happens when the process receives the named
+	// signal, such as "SIGSEGV".  Signals that are passed or ignored are
+	// reported as events if the process was resumed with ResumeAsync; those
+	// that stop the process are reported in its Status.  SIGTRAP, SIGSTOP
+	// and SIGKILL can't be given a policy.
+	SetSignalPolicy(signal string, policy SignalPolicy) error
+
+	// SetPanicStops sets the runtime functions at whose start the program
+	// stops, with the Reason "panic", so that a panic or fatal error can be
+	// examined where it happens, before the runtime unwinds the stack or
+	// exits.  The default is runtime.gopanic, which is also reached by
+	// panics that will be recovered, runtime.fatalpanic, runtime.throw and
+	// runtime.fatal.  An empty list turns the stops off.  Functions that
+	// aren't in the executable are ignored.
+	SetPanicStops(functions []string) error
+
+	// SetThreadStops sets whether Resume stops the program when it starts a
+	// new thread, with the Reason "thread".  The default is not to.
+	SetThreadStops(stop bool) error
+
+	// Detach ends debugging of the current process.  The process is killed,
+	// or its breakpoints and watchpoints are removed and each of its threads
+	// is detached, leaving it running, as set by SetKillOnExit.  A signal
+	// the process stopped for is delivered to it when it is left running.
+	Detach() error
+
+	// Shutdown ends the debugging session: the process is killed if kill is
+	// true, and otherwise left running as Detach leaves it, the files opened
+	// with Open are closed, and a debugproxy serving the Program exits.  The
+	// Program can't be used afterwards.
+	Shutdown(kill bool) error
+
+	// Stdout returns a reader of the output the process writes to its
+	// standard output.  Reads wait until output is available, and return
+	// io.EOF once the process has closed its standard output and all of it
+	// has been read.  Each Run starts a new stream of output.  If the server
+	// drops output that isn't read soon enough, a line such as "[1024 bytes
+	// of output dropped]" is read in its place.
+	Stdout() io.Reader
+
+	// Stderr is like Stdout, for the process's standard error.
+	Stderr() io.Reader
+
 	// Breakpoint sets a breakpoint at the specified address.
-	Breakpoint(address uint64) (PCs []uint64, err error)
+	Breakpoint(address uint64) (Breakpoint, error)
 
 	// BreakpointAtFunction sets a breakpoint at the start of the specified function.
-	BreakpointAtFunction(name string) (PCs []uint64, err error)
+	// A name without a package, such as "SSL_read", can also be that of a
+	// C function, found from the symbol tables of the executable and of the
+	// shared objects the process has loaded, which are also where the
+	// functions of a Go plugin are found.  A breakpoint in a shared object
+	// is pending after Run until the new process loads the object again;
+	// see Breakpoint.Pending.  If the compiler inlined the function, the
+	// breakpoint is also at the start of each inlined copy.  A generic
+	// function's breakpoint is at the start of each of its instantiations,
+	// or of one, named with the types of its shapes as frames name it,
+	// such as "main.Max[int]".
+	BreakpointAtFunction(name string) (Breakpoint, error)
+
+	// PendingBreakpointAtFunction is like BreakpointAtFunction, but if the
+	// function can't be found, such as one in a plugin or other shared
+	// object the process hasn't loaded yet, the breakpoint is still set,
+	// pending: it is looked for again each time the process loads shared
+	// objects, and once found, an event of kind "resolved" reports it.
+	PendingBreakpointAtFunction(name string) (Breakpoint, error)
 
 	// BreakpointAtLine sets a breakpoint at the specified source line.
-	BreakpointAtLine(file string, line uint64) (PCs []uint64, err error)
+	// The breakpoint is at the start of each range of addresses with code
+	// for the line, in every function whose code includes it, so the
+	// program stops once each time it reaches the line.
+	BreakpointAtLine(file string, line uint64) (Breakpoint, error)
+
+	// BreakpointAtPackageInit sets breakpoints at the start of the
+	// compiler-generated init functions of the package with the given
+	// import path, such as "example.com/foo".
+	BreakpointAtPackageInit(pkg string) (Breakpoint, error)
+
+	// BreakpointAtCgoCalls sets breakpoints where the program calls from Go
+	// into C, and where C code calls back into Go.
+	BreakpointAtCgoCalls() (Breakpoint, error)
+
+	// DeleteBreakpoints removes the breakpoints with the specified IDs.
+	// IDs that don't identify a breakpoint are ignored.
+	DeleteBreakpoints(ids []uint64) error
 
-	// DeleteBreakpoints removes the breakpoints at the specified addresses.
-	// Addresses where no breakpoint is set are ignored.
-	DeleteBreakpoints(pcs []uint64) error
+	// EnableBreakpoint enables or disables the breakpoint with the specified ID.
+	// A disabled breakpoint is kept, but the program does not stop there.
+	EnableBreakpoint(id uint64, enabled bool) error
+
+	// SetBreakpointCaller makes the breakpoint with the specified ID stop the
+	// program only when the named function is among the callers, direct or
+	// indirect, of the function containing the breakpoint.  An empty name
+	// removes the condition.
+	SetBreakpointCaller(id uint64, function string) error
+
+	// SetBreakpointGroup puts the breakpoint with the specified ID in the
+	// named group, taking it out of any group it was in.  An empty name
+	// just takes it out.
+	SetBreakpointGroup(id uint64, group string) error
+
+	// SetBreakpointOneShot sets whether the breakpoint with the specified ID
+	// is deleted the first time the program stops at it.
+	SetBreakpointOneShot(id uint64, oneShot bool) error
+
+	// SetBreakpointRecord sets whether the breakpoint with the specified ID
+	// is a recording breakpoint.  When the program reaches a recording
+	// breakpoint, it doesn't stop; the debugger records a Snapshot of the
+	// stack of the goroutine that reached it and of the values of exprs
+	// there, and the program carries on at once.  The expressions can't
+	// call functions.  Snapshots are kept until Snapshots fetches them, and
+	// the oldest are discarded to make room for new ones.
+	SetBreakpointRecord(id uint64, record bool, exprs []string) error
+
+	// Snapshots returns the snapshots recorded since it was last called,
+	// oldest first.  It can be called while the program runs.
+	Snapshots() ([]Snapshot, error)
+
+	// SetBreakpointTrace sets whether the breakpoint with the specified ID
+	// is a tracepoint.  When the program reaches a tracepoint, it doesn't
+	// stop; the debugger records a TraceEvent with the values of exprs
+	// there and the goroutine that reached it, and the program carries on
+	// at once.  Unlike a recording breakpoint's snapshot, an event has no
+	// stack, so tracepoints cost little more than the stop itself.  The
+	// expressions can't call functions.  Events are kept until TraceEvents
+	// fetches them, and the oldest are discarded to make room for new ones.
+	SetBreakpointTrace(id uint64, trace bool, exprs []string) error
+
+	// TraceEvents returns the events recorded by tracepoints since it was
+	// last called, oldest first.  It can be called while the program runs.
+	TraceEvents() ([]TraceEvent, error)
+
+	// SetBreakpointCommands sets the commands the debugger runs when the
+	// program reaches the breakpoint with the specified ID, in place of
+	// those set before; none removes them.  Each command is an expression
+	// to evaluate, which can't call functions, except that the last can be
+	// "continue".  The values are reported in the Commands of the Status
+	// with which the program stops there, or with "continue", the program
+	// carries on at once and they are reported as an Event with Kind
+	// "commands" on the channel returned by Events.  Like calls traced by
+	// Trace, such events are dropped while a client has many waiting.
+	SetBreakpointCommands(id uint64, commands []string) error
+
+	// Trace traces the calls of the functions whose names match the regular
+	// expression funcRegexp, in place of those traced before, and returns
+	// their names.  An empty funcRegexp stops tracing.  The program doesn't
+	// stop for traced calls; each is reported when it returns, as an Event
+	// with Kind "call" on the channel returned by Events, with its
+	// arguments as they were on entry.  Calls are dropped while a client
+	// has many events waiting, rather than letting them pile up.
+	Trace(funcRegexp string) ([]string, error)
+
+	// EnableBreakpointGroup enables or disables all the breakpoints in the
+	// named group.  If any of them can't be enabled, none are.
+	EnableBreakpointGroup(group string, enabled bool) error
+
+	// DeleteBreakpointGroup removes all the breakpoints in the named group.
+	DeleteBreakpointGroup(group string) error
+
+	// ListBreakpoints returns the breakpoints currently set, ordered by ID.
+	ListBreakpoints() ([]Breakpoint, error)
+
+	// WatchGlobal sets a watchpoint on the global variable with the given name.
+	// The program stops when the variable is written.  Variables larger than
+	// a hardware watchpoint are split across several debug registers.  A
+	// write by another thread while the program is being stopped for one is
+	// reported by the next Resume, which stops in that thread without
+	// running the program.
+	WatchGlobal(name string) (Watchpoint, error)
+
+	// WatchMap sets a watchpoint on the map m, which stops the program when
+	// the map's hash table grows, and, if threshold isn't zero, when the
+	// number of elements in the map goes past threshold.  It uses one debug
+	// register, or two with a threshold.  For Swiss table maps, used since
+	// Go 1.24, growth is seen only when the map gets its first table or its
+	// directory of tables doubles.
+	WatchMap(m Map, threshold uint64) (Watchpoint, error)
+
+	// DeleteWatchpoints removes the watchpoints with the specified IDs.
+	// IDs that don't identify a watchpoint are ignored.
+	DeleteWatchpoints(ids []uint64) error
+
+	// FindString searches the program's read-only data for string constants
+	// containing substr, and reports for each match the code that appears to
+	// refer to the constant.  This helps to find the code that produces a given
+	// log message.  References are only found in amd64 code.
+	FindString(substr string) ([]StringMatch, error)
 
 	// Eval evaluates the expression (typically an address) and returns
 	// its string representation(s). Multivalued expressions such as
@@ -80,36 +377,479 @@ type Program interface {
 	//		symbol ("main.foo") at that address (hex, octal, decimal).
 	Eval(expr string) ([]string, error)
 
+	// EvalFormat is like Eval, but formats the values of val: expressions
+	// as opts says.
+	EvalFormat(expr string, opts FormatOptions) ([]string, error)
+
 	// Evaluate evaluates an expression.  Accepts a subset of Go expression syntax:
 	// basic literals, identifiers, parenthesized expressions, and most operators.
-	// Only the len function call is available.
+	// Of the built-in functions, only len is available.
+	//
+	// Calls of the program's package-level functions, like main.f(1, 2), run
+	// the function in the goroutine of the thread that stopped the program,
+	// with the program's other threads running meanwhile.  The function must
+	// have one result; its arguments must be booleans, numbers or pointers,
+	// and its result can also be a string.  This needs amd64, a runtime that
+	// supports debugger calls (Go 1.18 or later), and the program to be
+	// stopped at a point where the runtime allows calls, which is not the
+	// first instruction of a function.
 	//
 	// The expression can refer to local variables and function parameters of the
-	// function where the program is stopped.
+	// function where the program is stopped, or of the frame selected by
+	// SelectFrame.
 	//
 	// On success, the type of the value returned will be one of:
 	// int8, int16, int32, int64, uint8, uint16, uint32, uint64, float32, float64,
 	// complex64, complex128, bool, Pointer, Array, Slice, String, Map, Struct,
-	// Channel, Func, or Interface.
-	Evaluate(e string) (Value, error)
+	// Channel, Func, Interface, Mutex, RWMutex, or WaitGroup.  The last three
+	// are for sync.Mutex, sync.RWMutex and sync.WaitGroup, decoded to show
+	// their state and the goroutines blocked on them.
+	//
+	// Evaluate also returns the static type of the expression, which for
+	// named types and interfaces differs from what the type of the value
+	// shows.
+	//
+	// If the expression can't be evaluated, the error is an
+	// *ExpressionError, which says which part of the expression is at fault.
+	Evaluate(e string) (Value, Type, error)
+
+	// Sample evaluates expressions over global variables, like Evaluate,
+	// but without waiting for the program to stop, so that a front end can
+	// show live values of selected variables.  If the program is running,
+	// the thread that last stopped it is interrupted just long enough to
+	// read the values; the other threads keep running, so the values
+	// needn't be consistent with each other.  The expressions can't use
+	// local variables or call functions.  An expression that can't be
+	// evaluated doesn't stop the others from being evaluated; its error is
+	// reported in its Sample.
+	Sample(expressions ...string) ([]Sample, error)
+
+	// Batch makes several Eval, Value and VarByName calls in one request,
+	// so that a remote client needn't wait for a round trip for each of
+	// them.  The calls are made in order, and a call that fails doesn't
+	// stop the others from being made; its error is reported in its
+	// BatchResult.
+	Batch(calls []BatchCall) ([]BatchResult, error)
+
+	// BinaryInfo describes how the program's executable was built.
+	BinaryInfo() (BinaryInfo, error)
+
+	// History returns the values expr had at the last n stops of the program,
+	// oldest first.  The first call for an expression starts recording its
+	// value each time the program stops, so returns nothing; later calls can
+	// change n.  An n of zero stops recording the expression.
+	History(expr string, n int) ([]HistoryEntry, error)
 
 	// Frames returns up to count stack frames from where the program
-	// is currently stopped.
+	// is currently stopped.  Calls the compiler inlined have frames of
+	// their own, whose Inlined is set.  The stack is followed through C
+	// code, whose frames have Kind "foreign", and back to the Go code that
+	// called it.
 	Frames(count int) ([]Frame, error)
 
+	// LocalVariables returns the local variables in scope at the PC of the
+	// stack frame with the given index, where 0 is the frame the program is
+	// stopped in.  Variables declared in blocks the PC is not in are left
+	// out.  Parameters are in the frame's Params, as returned by Frames.
+	LocalVariables(frameIndex int) ([]LocalVar, error)
+
+	// SelectFrame selects the stack frame with the given index, where 0 is
+	// the frame the program is stopped in, as the one whose parameters and
+	// local variables Evaluate can refer to.  The selection lasts until the
+	// program next stops, when frame 0 is selected again.
+	SelectFrame(frameIndex int) error
+
+	// Threads returns the threads of the stopped program, in order of ID.
+	Threads() ([]Thread, error)
+
+	// SelectThread selects the thread with the given ID as the one whose
+	// registers and stack Frames, LocalVariables, Evaluate and the other
+	// requests about the stopped thread use, or if tid is zero, the thread
+	// that stopped the program.  It also selects that thread's frame 0.
+	// The selection lasts until the program next runs: the program resumes
+	// and steps from where the thread that stopped it is, as before.
+	SelectThread(tid int) error
+
+	// SharedObjects returns the shared objects the process has loaded, such
+	// as the C libraries of a cgo program and Go plugins, in the order the
+	// dynamic linker lists them, as of when it last finished loading or
+	// unloading them.  Breakpoints, frames and the functions and lines of
+	// PCs are found in the code of those with debugging information as in
+	// the executable's, though their frames' variables aren't read.
+	SharedObjects() ([]SharedObject, error)
+
+	// Functions returns the names of the program's functions that match the
+	// regular expression re, in order.  Like Sources and Types, it reads
+	// the executable's debugging information, so it doesn't need a process,
+	// and front ends can offer the names without having the executable.
+	Functions(re string) ([]string, error)
+
+	// Sources returns the names of the program's source files, in order.
+	Sources() ([]string, error)
+
+	// Source returns the lines of the source file from startLine to
+	// endLine inclusive, or to the end of the file if endLine is 0, read
+	// where the debugger runs, so that front ends can show code they don't
+	// have.  The file can be named by a suffix of its path, as for
+	// BreakpointAtLine.  Lines past the end of the file are omitted.
+	Source(file string, startLine, endLine uint64) (Source, error)
+
+	// Types returns the names of the program's types that match the regular
+	// expression re, in order.
+	Types(re string) ([]string, error)
+
+	// Type describes the type with the given ID, such as a Var's TypeID or a
+	// slice's ElementTypeID.  Like Types, it doesn't need a process.
+	Type(typeID uint64) (TypeInfo, error)
+
+	// ExportDebugManifest writes a DebugManifest describing the executable's
+	// functions, line table and global variables to w, encoded as JSON, so
+	// that other tools can reuse the debugger's reading of the debugging
+	// information.  Like Types, it doesn't need a process.
+	ExportDebugManifest(w io.Writer) error
+
 	// VarByName returns a Var referring to a global variable with the given name.
 	// TODO: local variables
 	VarByName(name string) (Var, error)
 
+	// AsPointer reinterprets v, a uintptr or unsafe.Pointer value read from
+	// the program, as a pointer to a value of the named type, such as
+	// "main.node", and returns a Var referring to the value it points to.
+	// It fails unless all of the value is in memory the program can read,
+	// so that pointers computed by hand in the program can be followed with
+	// some confidence.
+	AsPointer(v Value, typeName string) (Var, error)
+
 	// Value gets the value of a variable by reading the program's memory.
+	// If the variable is in the Go heap but no longer within an allocated
+	// object, because the object was freed or the variable reaches past it,
+	// the error is an *ObjectFreed rather than the value of whatever bytes
+	// are there now.  Mutexes and wait groups are decoded as for Evaluate.
 	Value(v Var) (Value, error)
 
+	// ReadMemory reads length bytes of the program's memory starting at
+	// addr, as the program sees them, so without the debugger's breakpoint
+	// instructions.  If not all of the memory can be read, it returns the
+	// bytes before the first that can't, and a *MemoryError.
+	ReadMemory(addr uint64, length int) ([]byte, error)
+
+	// WriteMemory writes data to the program's memory starting at addr, and
+	// returns the number of bytes written.  If not all of the memory can be
+	// written, it writes the bytes before the first that can't, and returns
+	// a *MemoryError.  Breakpoints in the memory written remain set, and
+	// break before the new instructions.
+	WriteMemory(addr uint64, data []byte) (int, error)
+
+	// ValueTree reads the value of v, like Value, together with the values
+	// nested in it to the given depth, so that they needn't each be read
+	// with another call: the fields of structs, up to 100 elements of
+	// arrays and slices, and what non-nil pointers point to.  A depth of
+	// zero reads only the value of v.  Errors reading values are recorded
+	// in the tree rather than returned.
+	ValueTree(v Var, depth int) (ValueTree, error)
+
 	// MapElement returns Vars for the key and value of a map element specified by
 	// a 0-based index.
 	MapElement(m Map, index uint64) (Var, Var, error)
 
+	// MapElements returns Vars for the keys and values of up to count
+	// elements of a map, starting at the 0-based index start, in the order
+	// MapElement numbers them.  It reads the map once, so it is much faster
+	// than MapElement for listing many elements.  Fewer elements are
+	// returned if the map doesn't have that many.
+	MapElements(m Map, start, count uint64) ([]MapEntry, error)
+
+	// ChannelWaiters returns the goroutines blocked receiving from or
+	// sending to a channel: the receivers, then the senders, each in the
+	// order they will be woken.  A goroutine blocked in a select is among
+	// the waiters of each of the select's channels.
+	ChannelWaiters(ch Channel) ([]ChannelWaiter, error)
+
 	// Goroutines gets the current goroutines.
 	Goroutines() ([]*Goroutine, error)
+
+	// PanicInfo describes the panic or fatal error that the program is
+	// stopped at, when its Reason is "panic".
+	PanicInfo() (PanicInfo, error)
+
+	// DeferredCalls returns the deferred calls pending in the goroutine with
+	// the specified ID, or in the goroutine of the thread that stopped the
+	// program if the ID is 0, in the order they will run.  If frameIndex
+	// isn't negative, only the calls deferred by that frame of the
+	// goroutine's stack are returned, with frames numbered from the
+	// innermost, as by Frames.  The stacks of goroutines running on other
+	// threads can't be read.
+	DeferredCalls(goroutine int64, frameIndex int) ([]DeferredCall, error)
+
+	// HeapStats counts the live objects in the Go heap by type and size,
+	// from the runtime's spans.  An object is live if it was allocated
+	// since the last garbage collection or survived it, so some may be
+	// garbage the next collection will free.  The types of objects of Go
+	// 1.22 and later programs are known if the runtime records them: for
+	// those of more than 512 bytes that contain pointers.
+	HeapStats() (HeapStats, error)
+
+	// HeapDump lists the live objects in the Go heap, as counted by
+	// HeapStats, in address order.  If there are more than a million, it
+	// returns an error rather than list them.
+	HeapDump() ([]HeapObject, error)
+
+	// FindReferences returns the pointers to the heap object holding the
+	// specified address, or if it isn't in the heap to the address itself,
+	// found in the program's global variables, the live parts of its
+	// goroutines' stacks, and its live heap objects, other than the object
+	// itself.  Memory is scanned conservatively: a word of a variable or
+	// object that may hold pointers is taken for a pointer if its value
+	// points into the object.  At most 1000 references are returned.
+	FindReferences(addr uint64) ([]Reference, error)
+
+	// RuntimeStatus summarizes the state of the program's garbage collector
+	// and scheduler, from the runtime's variables.
+	RuntimeStatus() (RuntimeStatus, error)
+}
+
+// HeapObject is a live object in the Go heap.
+type HeapObject struct {
+	Address uint64
+	// Size is the size of the object's slot in its span, less the header
+	// the runtime keeps there for some objects' types.
+	Size uint64
+	// TypeID and TypeName identify the object's type, or for an array, such
+	// as the one backing a slice, its elements' type.  They are zero if the
+	// type isn't known.
+	TypeID   uint64
+	TypeName string
+}
+
+// HeapStats summarizes the live objects in the Go heap.
+type HeapStats struct {
+	Objects   uint64 // The number of live objects.
+	Bytes     uint64 // The total of their Sizes, as in HeapObject.
+	Spans     uint64 // The number of spans holding objects.
+	SpanBytes uint64 // The total size of those spans, including free slots.
+	// Types breaks the objects down by type and size, largest total first.
+	Types []HeapTypeStats
+}
+
+// HeapTypeStats counts the live objects in the Go heap of one type and size.
+// Objects whose type isn't known are counted by size, with an empty
+// TypeName.
+type HeapTypeStats struct {
+	TypeID   uint64
+	TypeName string
+	Size     uint64 // The size of each object, as in HeapObject.
+	Objects  uint64
+	Bytes    uint64
+}
+
+// Reference is a pointer to an object, found by FindReferences.
+type Reference struct {
+	// Kind is where the pointer is: "global", "stack" or "heap".
+	Kind    string
+	Address uint64 // The address of the pointer.
+	Pointer uint64 // The pointer itself.
+	// Name is the global variable holding the pointer, from the
+	// executable's symbol table.
+	Name string
+	// Goroutine and Function are the goroutine whose stack holds the
+	// pointer and, if its stack can be walked, the function whose frame does.
+	Goroutine int64
+	Function  string
+	// Object is the heap object holding the pointer.
+	Object HeapObject
+}
+
+// RuntimeStatus is the state of the Go runtime's garbage collector and
+// scheduler.  Fields the program's runtime doesn't have are zero.
+type RuntimeStatus struct {
+	// GCPhase is "off", "mark" or "mark termination".
+	GCPhase  string
+	GCCycles uint64 // The number of garbage collections completed.
+	// HeapLive is the size of the heap objects allocated, as the collector
+	// counts them, HeapMarked the size of those the last collection found
+	// live, and HeapInUse the size of the spans holding objects.
+	HeapLive   uint64
+	HeapMarked uint64
+	HeapInUse  uint64
+	// NextGC is the heap size GCPercent sets as the goal of the next
+	// collection, which starts before the heap reaches it.  The memory
+	// limit may lower the goal.
+	NextGC      uint64
+	GCPercent   int64 // As set by GOGC; negative if collection is off.
+	MemoryLimit int64 // As set by GOMEMLIMIT, in bytes.
+
+	GOMAXPROCS      int64
+	Threads         int64 // The number of threads the runtime has started and not ended.
+	IdleThreads     int64 // Threads waiting for work.
+	SpinningThreads int64 // Threads looking for goroutines to run.
+	IdlePs          int64 // Processors without work.
+	RunQueue        int64 // The number of goroutines in the global run queue.
+	// Ps are the runtime's processors, which are what run goroutines.
+	Ps []Processor
+}
+
+// Processor is one of the runtime's processors, its P, which the scheduler
+// gives to a thread to run goroutines.
+type Processor struct {
+	ID int64
+	// Status is "idle", "running", "gcstop" or "dead".
+	Status string
+	// Thread is the ID of the thread the processor is given to, or zero.
+	Thread int
+	// RunQueue is the number of goroutines in the processor's run queue,
+	// including the one to run next.
+	RunQueue int64
+}
+
+// Breakpoint describes a breakpoint set in the program.
+type Breakpoint struct {
+	ID  uint64   // Identifies the breakpoint in later calls.
+	PCs []uint64 // The addresses at which the program will stop.
+	// Locations describe the PCs, in the same order.  A breakpoint at a line
+	// can be in several copies of its code, such as in each instantiation
+	// of a generic function and where the compiler inlined a function.
+	Locations []BreakpointLocation
+	// File, Line and Function are the source location of the first PC.
+	File     string
+	Line     uint64
+	Function string
+	// HitCount is the number of times the program has stopped at the breakpoint.
+	HitCount uint64
+	// Enabled reports whether the program will stop at the breakpoint.
+	Enabled bool
+	// CalledFrom, if set, is the function that must be on the call stack for
+	// the program to stop at the breakpoint.
+	CalledFrom string
+	// Group is the name of the group the breakpoint is in, if any.
+	Group string
+	// OneShot reports whether the breakpoint is deleted the first time the
+	// program stops at it.
+	OneShot bool
+	// Record reports whether the breakpoint records a Snapshot, with the
+	// values of RecordExprs, rather than stopping the program.
+	Record      bool
+	RecordExprs []string
+	// Trace reports whether the breakpoint is a tracepoint, which records a
+	// TraceEvent with the values of TraceExprs rather than stopping the
+	// program.
+	Trace      bool
+	TraceExprs []string
+	// Commands are run when the program reaches the breakpoint; see
+	// SetBreakpointCommands.
+	Commands []string
+	// Err, if set, says why the breakpoint's location couldn't be found
+	// when the process was last started, in which case it has no PCs.
+	// Breakpoints are kept by where they were asked for, such as a
+	// function or line, and are found again each time a process starts.
+	Err string
+	// Pending reports whether the breakpoint's location hasn't been found,
+	// as Err says, and is looked for again each time the process loads
+	// shared objects.
+	Pending bool
+}
+
+// A BreakpointLocation describes one of the addresses of a breakpoint.
+type BreakpointLocation struct {
+	PC uint64
+	// Function is the function whose code is at PC, such as one
+	// instantiation of a generic function.
+	Function string
+	// InlinedInto, if set, is the function into whose code the compiler
+	// inlined Function's code at PC.
+	InlinedInto string
+}
+
+// CommandResults are the values of the commands of a breakpoint the program
+// reached.
+type CommandResults struct {
+	Breakpoint uint64 // The ID of the breakpoint.
+	// Goroutine is the ID of the goroutine that reached the breakpoint, or
+	// 0 if it couldn't be determined.
+	Goroutine int64
+	Thread    int
+	PC        uint64
+	// Values holds the values of the breakpoint's commands, other than a
+	// final "continue".
+	Values []Sample
+}
+
+// Snapshot is what a recording breakpoint recorded when the program reached
+// it.
+type Snapshot struct {
+	Breakpoint uint64 // The ID of the breakpoint.
+	Time       time.Time
+	Thread     int
+	PC         uint64
+	// Frames is the stack of the goroutine that reached the breakpoint, or
+	// as much of it as could be read.  FramesErr says why it couldn't all
+	// be read, if it couldn't.
+	Frames    []Frame
+	FramesErr string
+	// Values holds the values of the breakpoint's expressions.
+	Values []Sample
+}
+
+// TraceEvent is what a tracepoint recorded when the program reached it.
+type TraceEvent struct {
+	Breakpoint uint64 // The ID of the breakpoint.
+	Time       time.Time
+	// Goroutine is the ID of the goroutine that reached the tracepoint, or
+	// 0 if it couldn't be determined.
+	Goroutine int64
+	Thread    int
+	PC        uint64
+	// Values holds the values of the tracepoint's expressions.
+	Values []Sample
+}
+
+// BinaryInfo describes how an executable was built.
+type BinaryInfo struct {
+	// GoVersion is the version of Go that built the executable, such as
+	// "go1.10.3", or "" if it couldn't be determined.
+	GoVersion string
+	// GOOS and GOARCH are the operating system and architecture the
+	// executable is for.
+	GOOS, GOARCH string
+	// RegisterABI reports whether functions take their arguments and return
+	// their results in registers, as on amd64 since Go 1.17, rather than on
+	// the stack.  Arguments passed in registers can't be inspected until the
+	// function stores them in its frame.
+	RegisterABI bool
+}
+
+// HistoryEntry is the value of an expression at one of the program's stops.
+type HistoryEntry struct {
+	Stop  uint64 // Counts the stops made by programs the debugger has run, from 1.
+	PC    uint64 // Where the program stopped.
+	Value Value  // The expression's value, if it could be evaluated.
+	Err   string // Why the expression couldn't be evaluated, if it couldn't.
+}
+
+// Watchpoint describes a watchpoint set in the program.
+type Watchpoint struct {
+	ID      uint64 // Identifies the watchpoint in later calls.
+	Name    string // The name of the watched variable.
+	Address uint64 // The address of the watched variable.
+	Size    uint64 // The size of the watched variable, in bytes.
+}
+
+// StringMatch describes an occurrence of text in a string constant.
+type StringMatch struct {
+	// Address is the address of the matching text.
+	Address uint64
+	// Text is the matching text, preceded by the start of the constant
+	// containing it if that could be determined.
+	Text string
+	// References are the instructions that refer to the constant.
+	References []CodeLocation
+}
+
+// CodeLocation is the location of an instruction in the program.
+type CodeLocation struct {
+	PC       uint64
+	File     string
+	Line     uint64
+	Function string
 }
 
 type Goroutine struct {
@@ -119,6 +859,84 @@ type Goroutine struct {
 	Function     string // Name of the goroutine function.
 	Caller       string // Name of the function that created this goroutine.
 	StackFrames  []Frame
+	// Labels are the goroutine's profiler labels, as set by runtime/pprof's
+	// Do and SetGoroutineLabels, such as a request ID to find the
+	// goroutines handling a request by.
+	Labels map[string]string
+}
+
+// A SharedObject is a shared object the process has loaded.
+type SharedObject struct {
+	Path string
+	// Base is what is added to the addresses in the file to give those in
+	// the process.
+	Base uint64
+	// Start and End are the range of addresses its segments are loaded at.
+	Start, End uint64
+	// DWARF reports whether the object has debugging information.
+	DWARF bool
+}
+
+// A Thread is one of the operating system threads of a stopped program.
+type Thread struct {
+	ID int
+	// State is "trapped" for the thread that stopped the program, "syscall"
+	// for a thread that was stopped in a system call, such as one waiting
+	// for a lock or for input, and "stopped" for the others.
+	State    string
+	PC, SP   uint64
+	Function string // The function at PC, if it is known.
+	Selected bool   // Whether the thread is the one selected by SelectThread.
+}
+
+// PanicInfo describes a panic or fatal error that the program is stopped at.
+type PanicInfo struct {
+	// Function is the runtime function the program is stopped at the start
+	// of, such as "runtime.gopanic".
+	Function string
+	// Goroutine is the ID of the goroutine that is panicking or failing.
+	Goroutine int64
+	// Value is the value being panicked with, if the program is stopped in
+	// runtime.gopanic or runtime.fatalpanic.
+	Value string
+	// Message is the error the runtime is about to print, if the program is
+	// stopped in runtime.throw or runtime.fatal.
+	Message string
+	// Panics are the goroutine's panics in progress, newest first.  A panic
+	// that has just started, in runtime.gopanic, isn't among them yet.
+	Panics []Panic
+	// Deferred are the goroutine's pending deferred calls, in the order they
+	// will run.  Calls deferred by functions whose defers the compiler
+	// open-coded aren't included, unless they are running.
+	Deferred []DeferredCall
+}
+
+// Panic is a panic in progress.
+type Panic struct {
+	Value     string
+	Recovered bool
+}
+
+// DeferredCall is a pending deferred call.
+type DeferredCall struct {
+	// Function is the name of the deferred function, or "" if it couldn't
+	// be found, as for a closure without a symbol.
+	Function string
+	// File and Line are where the call was deferred.
+	File string
+	Line uint64
+	// SP is the stack pointer of the frame that deferred the call.
+	SP uint64
+	// Args are the arguments of a call the compiler wrapped in a closure,
+	// as it does for defer f(x, y), evaluated when the call was deferred.
+	// Constant arguments aren't included, and the rest are named by the
+	// compiler.  They are missing if the compiler optimized them away.
+	Args []Param
+	// Recovers reports whether the deferred function calls recover, and
+	// so would stop a panic in progress that hasn't been recovered.  A
+	// call of recover the function only makes under some condition
+	// counts.
+	Recovers bool
 }
 
 type GoroutineStatus byte
@@ -155,6 +973,131 @@ type Var struct {
 // A value read from a remote program.
 type Value interface{}
 
+// Type is the static type of an expression.
+type Type struct {
+	Name string // The type as written in Go, such as "int", "[]string" or "main.T".
+	// TypeID identifies the type in the program's debugging information, as
+	// in Var.  It is zero for types the program doesn't describe, such as the
+	// default types of untyped constants.
+	TypeID uint64
+}
+
+// A DebugManifest describes an executable, as written by ExportDebugManifest.
+// Addresses are those the executable was linked at; in the process, they are
+// LoadBias higher.
+type DebugManifest struct {
+	Executable string             `json:"executable"`
+	GoVersion  string             `json:"goVersion,omitempty"`
+	LoadBias   uint64             `json:"loadBias"` // Zero if there is no process.
+	Functions  []ManifestFunction `json:"functions"`
+	Lines      []ManifestLine     `json:"lines"`
+	Globals    []ManifestGlobal   `json:"globals"`
+}
+
+// Source is a range of the lines of a source file.
+type Source struct {
+	File  string // The file's name in the debugging information.
+	Lines []SourceLine
+}
+
+// SourceLine is a line of a source file.
+type SourceLine struct {
+	Line uint64
+	Text string // Without the newline.
+	// Statement reports whether the line has code, at which a breakpoint
+	// can be set.
+	Statement bool
+}
+
+// ManifestFunction describes a function: its code is from Low up to but not
+// including High, and it starts at File and Line.
+type ManifestFunction struct {
+	Name string `json:"name"`
+	Low  uint64 `json:"low"`
+	High uint64 `json:"high"`
+	File string `json:"file,omitempty"`
+	Line uint64 `json:"line,omitempty"`
+}
+
+// ManifestLine is an entry in the line table: the instructions from Low up to
+// but not including High belong to the source line File and Line.
+type ManifestLine struct {
+	Low  uint64 `json:"low"`
+	High uint64 `json:"high"`
+	File string `json:"file"`
+	Line uint64 `json:"line"`
+}
+
+// ManifestGlobal describes a global variable.
+type ManifestGlobal struct {
+	Name    string `json:"name"`
+	Address uint64 `json:"address"`
+	Type    string `json:"type"`
+	TypeID  uint64 `json:"typeID"`
+	Size    int64  `json:"size"`
+}
+
+// TypeInfo describes a type, as returned by Type.
+type TypeInfo struct {
+	TypeID uint64
+	Name   string // The type as written in Go, such as "main.T" or "[]int".
+	// Kind is the kind of the type's underlying type, named as by
+	// reflect.Kind, such as "int16", "struct", "ptr" or "slice".
+	Kind string
+	Size int64 // In bytes.
+	// Fields are the fields of a struct type.
+	Fields []TypeField
+	// ElementTypeID is the type of what a pointer points to, of the elements
+	// of an array, slice or channel, or of the values of a map.
+	ElementTypeID uint64
+	// KeyTypeID is the type of the keys of a map.
+	KeyTypeID uint64
+	// Length is the length of an array type.
+	Length int64
+	// Methods are the methods declared on a named type and on pointers to
+	// it, which the program contains code for, in order of name.
+	Methods []TypeMethod
+}
+
+// TypeField describes a field of a struct type.
+type TypeField struct {
+	Name     string
+	TypeID   uint64
+	TypeName string
+	Offset   int64 // In bytes, from the start of the struct.
+	Embedded bool
+}
+
+// TypeMethod describes a method of a type.
+type TypeMethod struct {
+	Name     string // Such as "String".
+	Function string // The function's name, such as "main.(*T).String".
+	// PointerReceiver reports whether the method is declared on pointers to
+	// the type.
+	PointerReceiver bool
+}
+
+// A ValueTree is a value read by ValueTree, with the values nested in it.
+type ValueTree struct {
+	// Name says how the value is reached from its parent: it is the name
+	// of a struct field, an index like "[3]" for an element, or "*" for
+	// what a pointer points to.  It is empty for the tree's root.
+	Name  string
+	Var   Var
+	Value Value
+	Err   string // Why the value couldn't be read, if it couldn't.
+	// Children are the values nested in this one, if they were read.
+	Children []ValueTree
+	// Truncated is true if nested values were left out of Children,
+	// because of the depth or the limit on elements.
+	Truncated bool
+}
+
+// MapEntry holds Vars for the key and value of a map element.
+type MapEntry struct {
+	Key, Value Var
+}
+
 // Pointer is a Value representing a pointer.
 // Note that the TypeID field will be the type of the variable being pointed to,
 // not the type of this pointer.
@@ -165,10 +1108,11 @@ type Pointer struct {
 
 // Array is a Value representing an array.
 type Array struct {
-	ElementTypeID uint64
-	Address       uint64
-	Length        uint64 // Number of elements in the array
-	StrideBits    uint64 // Number of bits between array entries
+	ElementTypeID   uint64
+	ElementTypeName string // Such as "int16", so that clients needn't look up the type.
+	Address         uint64
+	Length          uint64 // Number of elements in the array
+	StrideBits      uint64 // Number of bits between array entries
 }
 
 // Len returns the number of elements in the array.
@@ -201,9 +1145,11 @@ type String struct {
 
 // Map is a Value representing a map.
 type Map struct {
-	TypeID  uint64
-	Address uint64
-	Length  uint64 // Number of elements in the map.
+	TypeID          uint64
+	KeyTypeName     string // Such as "int16".
+	ElementTypeName string
+	Address         uint64
+	Length          uint64 // Number of elements in the map.
 }
 
 // Struct is a Value representing a struct.
@@ -219,13 +1165,31 @@ type StructField struct {
 
 // Channel is a Value representing a channel.
 type Channel struct {
-	ElementTypeID uint64
-	Address       uint64 // Location of the channel struct in memory.
-	Buffer        uint64 // Location of the buffer; zero for nil channels.
-	Length        uint64 // Number of elements stored in the channel buffer.
-	Capacity      uint64 // Capacity of the buffer; zero for unbuffered channels.
-	Stride        uint64 // Number of bytes between buffer entries.
-	BufferStart   uint64 // Index in the buffer of the element at the head of the queue.
+	ElementTypeID   uint64
+	ElementTypeName string  // Such as "int16".
+	Dir             ChanDir // The directions the channel's type allows.
+	Address         uint64  // Location of the channel struct in memory.
+	Buffer          uint64  // Location of the buffer; zero for nil channels.
+	Length          uint64  // Number of elements stored in the channel buffer.
+	Capacity        uint64  // Capacity of the buffer; zero for unbuffered channels.
+	Stride          uint64  // Number of bytes between buffer entries.
+	BufferStart     uint64  // Index in the buffer of the element at the head of the queue.
+}
+
+// ChannelWaiter is a goroutine blocked on a channel.
+type ChannelWaiter struct {
+	Goroutine int64
+	Send      bool // Whether the goroutine is sending; otherwise it is receiving.
+	Select    bool // Whether the goroutine is blocked in a select.
+	// Value is the element being sent, if Send is set.
+	Value Var
+	// PC, Function, File and Line are where the goroutine is blocked: the
+	// return address of the call in its innermost frame outside the
+	// runtime, or zero if its stack couldn't be read.
+	PC       uint64
+	Function string
+	File     string
+	Line     uint64
 }
 
 // Element returns a Var referring to the given element of the channel's queue.
@@ -253,13 +1217,91 @@ func (m Channel) Element(index uint64) Var {
 	}
 }
 
+// ChanDir is the direction of a channel type.
+type ChanDir int
+
+const (
+	RecvDir ChanDir = 1 // <-chan T
+	SendDir ChanDir = 2 // chan<- T
+	BothDir ChanDir = 3 // chan T
+)
+
 // Func is a Value representing a func.
 type Func struct {
+	// Address is the func value itself, which points to the address of the
+	// function's code; it is zero for a nil func.
 	Address uint64
+	// Entry is the address of the function's code.  Name, File and Line are
+	// the function's name and where it is defined, if the debugging
+	// information describes it.
+	Entry uint64
+	Name  string
+	File  string
+	Line  uint64
+	// Context, for a closure, is the context the closure's code is called
+	// with, which holds the variables it captured; otherwise it is zero.
+	Context uint64
 }
 
 // Interface is a Value representing an interface.
-type Interface struct{}
+type Interface struct {
+	// TypeID and TypeName identify the interface's dynamic type.  They are
+	// zero for a nil interface, or if the dynamic type isn't described by the
+	// debugging information.
+	TypeID   uint64
+	TypeName string // Such as "*main.T".
+	// Data is the interface's data word, which points to the dynamic value or,
+	// for pointer-shaped types, is the value itself; it is zero for a nil
+	// interface.
+	Data uint64
+	// Value refers to the dynamic value.  Its Address is zero if TypeID is.
+	Value Var
+}
+
+// Mutex is a Value representing a sync.Mutex, decoded from its state.  Its
+// Struct holds the mutex's fields.
+type Mutex struct {
+	Struct
+	Locked   bool
+	Woken    bool // Whether a goroutine has been woken to take the lock.
+	Starving bool // Whether the lock is handed directly to waiters.
+	// WaiterCount is the number of goroutines waiting in Lock, by the
+	// mutex's count, which includes those about to block.
+	WaiterCount uint64
+	// Waiters are the goroutines blocked on the mutex's semaphore, in the
+	// order they will be woken.
+	Waiters []int64
+}
+
+// RWMutex is a Value representing a sync.RWMutex.  Its Struct holds the
+// mutex's fields.
+type RWMutex struct {
+	Struct
+	// W is the mutex writers hold; goroutines waiting for it are writers
+	// queued behind the one holding or waiting for the lock.
+	W Mutex
+	// Locked is whether a writer holds the lock.  Writer is whether a
+	// writer holds it or is waiting for readers to unlock.
+	Locked bool
+	Writer bool
+	// Readers is the number of read locks held.
+	Readers int64
+	// ReaderWaiters are the goroutines blocked in RLock until the writer
+	// unlocks, and WriterWaiters the goroutine blocked in Lock until the
+	// readers unlock.
+	ReaderWaiters []int64
+	WriterWaiters []int64
+}
+
+// WaitGroup is a Value representing a sync.WaitGroup.  Its Struct holds the
+// wait group's fields.
+type WaitGroup struct {
+	Struct
+	Counter     int64  // The number of calls to Done outstanding.
+	WaiterCount uint64 // The number of goroutines waiting, by the count.
+	// Waiters are the goroutines blocked in Wait.
+	Waiters []int64
+}
 
 // The File interface provides access to file-like resources in the program.
 // It implements only ReaderAt and WriterAt, not Reader and Writer, because
@@ -274,6 +1316,222 @@ type File interface {
 
 type Status struct {
 	PC, SP uint64
+	// Thread is the ID of the thread that stopped the program.  The program's
+	// other threads are stopped with it, and resume with it.
+	Thread int
+	// Goroutine is the ID of the goroutine the thread was running, or zero
+	// if it wasn't running one, such as in C code or the runtime's
+	// scheduler.
+	Goroutine int64
+	// Reason says why the program stopped: "breakpoint", "watchpoint",
+	// "signal" for a signal whose policy is SignalStop, "step" after
+	// StepInstruction, "interrupt" after Interrupt, "restore" after Restore,
+	// "panic" at the start of one of the functions set by SetPanicStops,
+	// "thread" when the thread started a new one, if SetThreadStops is set,
+	// or "trap" for a trap that wasn't caused by the debugger.  It is
+	// "running" if the program hasn't stopped, when Resume returns after the
+	// timeout set by SetResumeTimeout.  When the program exits, Resume
+	// returns a *ProcessExited error, which has its exit status, instead.
+	Reason string
+	// Breakpoints are the IDs of the breakpoints the program stopped at, in
+	// order, if Reason is "breakpoint".
+	Breakpoints []uint64
+	// Watchpoints are the IDs of the watchpoints that stopped the program,
+	// in order, if Reason is "watchpoint".
+	Watchpoints []uint64
+	// Signal is the name of the signal the program stopped for, such as
+	// "SIGSEGV", if Reason is "signal".  The signal is delivered to the
+	// program when it is resumed.
+	Signal string
+	// SignalNumber is the number of the signal named by Signal.
+	SignalNumber int
+	// NewThread is the ID of the thread that was started, if Reason is
+	// "thread".
+	NewThread int
+	// Fatal is set if the program stopped at the start of runtime.throw or
+	// runtime.fatal, such as at a breakpoint there.  It is the message the
+	// runtime is about to print before exiting, such as "fatal error:
+	// concurrent map writes".
+	Fatal string
+	// FatalGoroutine and FatalM are the IDs of the goroutine that is
+	// failing, and of the runtime's thread (M) running it, if Fatal is set
+	// and they could be read.
+	FatalGoroutine int64
+	FatalM         int64
+	// Commands holds the results of the commands of the breakpoints the
+	// program stopped at, ordered by breakpoint ID.
+	Commands []CommandResults
+	// Unresolved, after Run or Restart, holds the IDs of the breakpoints
+	// that couldn't be found again in the new process, such as a breakpoint
+	// at a function the rebuilt executable no longer has.  Their Err says
+	// why.
+	Unresolved []uint64
+}
+
+// FormatOptions control how Eval formats values.  The zero value gives the
+// default format.
+type FormatOptions struct {
+	// MaxElements is the number of elements of each array, slice or map
+	// that are printed; the rest are elided as "...".  If it is zero, 100
+	// elements of arrays, all of slices, and 8 of maps are printed.
+	MaxElements int
+	// MaxStringLen is the number of bytes of each string that are printed,
+	// or 100 if it is zero.
+	MaxStringLen int
+	// MaxDepth is how deeply values nested in structs, arrays, slices,
+	// maps and dereferenced pointers are printed; deeper ones are printed
+	// as "...".  If it is zero, there is no limit.
+	MaxDepth int
+	// Hex prints integers in hexadecimal rather than decimal.
+	Hex bool
+	// Deref prints the values that non-nil pointers point to, after "&",
+	// rather than their addresses.
+	Deref bool
+}
+
+// A Sample is the value of an expression read by Sample.
+type Sample struct {
+	Expression string
+	Value      Value
+	Type       Type
+	Err        string // Why the expression couldn't be evaluated, if it couldn't.
+}
+
+// A BatchCall is one of the calls made by Batch.  Exactly one of Eval, Value
+// and VarByName is set.
+type BatchCall struct {
+	Eval      string        // An expression to evaluate, as EvalFormat does.
+	Format    FormatOptions // How to format the result of Eval.
+	Value     *Var          // A variable to read, as Value does.
+	VarByName string        // A global variable to look up, as VarByName does.
+}
+
+// A BatchResult is the result of a BatchCall: Eval, Value or Var is set,
+// matching the call, unless it failed.
+type BatchResult struct {
+	Eval  []string
+	Value Value
+	Var   Var
+	Err   string // Why the call failed, if it did.
+}
+
+// SignalPolicy says what the debugger does when the process receives a
+// signal.
+type SignalPolicy int
+
+const (
+	SignalPass   SignalPolicy = iota // Deliver the signal and carry on; the default.
+	SignalStop                       // Stop the process, and deliver the signal when it resumes.
+	SignalIgnore                     // Discard the signal and carry on.
+)
+
+// Event is something that happened to a process resumed with ResumeAsync,
+// or a call traced by Trace.
+type Event struct {
+	// Kind is "stop" if the process stopped, as described by Status; "signal"
+	// if the thread given by Status.Thread received the signal named by
+	// Signal, after which the process carries on; "exit" if the process
+	// exited, as described by Exit; "error" if resuming the process failed,
+	// as described by Err; "call" if a traced function returned, as
+	// described by Call; "commands" if the program carried on after
+	// running the commands of a breakpoint, with the results in Commands;
+	// or "resolved" if the location of a pending breakpoint was found, when
+	// the process loaded shared objects, as described by Breakpoint.
+	Kind       string
+	Status     Status
+	Signal     string
+	Exit       *ProcessExited
+	Err        string
+	Call       *CallEvent
+	Commands   *CommandResults
+	Breakpoint *Breakpoint
+}
+
+// CallEvent describes a call of a function traced by Trace.
+type CallEvent struct {
+	Function string
+	// Args holds the function's parameters, with their values on entry
+	// formatted in Value.  Results aren't included.
+	Args      []Param
+	Goroutine int64 // The ID of the calling goroutine, or 0 if it couldn't be determined.
+	Thread    int   // The thread the call started on.
+	Start     time.Time
+	// Duration is how long the call took, including the time the debugger
+	// took to record it.
+	Duration time.Duration
+}
+
+// ProcessExited is the error returned when the process being debugged has
+// exited.
+type ProcessExited struct {
+	// ExitStatus is the process's exit status, or -1 if it was killed by a
+	// signal or the status is unknown.
+	ExitStatus int
+	// Signal is the name of the signal that killed the process, if any.
+	Signal string
+}
+
+func (e *ProcessExited) Error() string {
+	if e.Signal != "" {
+		return fmt.Sprintf("process exited: killed by signal %s", e.Signal)
+	}
+	return fmt.Sprintf("process exited with status %d", e.ExitStatus)
+}
+
+// ExpressionError is the error returned by Evaluate when an expression can't
+// be evaluated.
+type ExpressionError struct {
+	Expression string
+	// Kind is "parse" if the expression isn't valid syntax, "runtime" if
+	// reading the program's values failed or they can't be computed with,
+	// as for an index out of range or a nil pointer dereference, and "type"
+	// for other errors, such as mismatched types or unknown identifiers.
+	Kind string
+	// Start and End are the byte offsets in Expression of the part that
+	// caused the error.  They are equal if no part did, or the error is at
+	// the end of the expression.
+	Start, End int
+	Reason     string // Such as "unknown identifier".
+}
+
+func (e *ExpressionError) Error() string {
+	if e.Start < e.End {
+		return e.Reason + `: "` + e.Expression[e.Start:e.End] + `"`
+	}
+	if e.Start == len(e.Expression) && e.Kind == "parse" {
+		return e.Reason + " at end of expression"
+	}
+	return e.Reason
+}
+
+// MemoryError is the error returned by ReadMemory and WriteMemory when some of
+// the memory can't be accessed.
+type MemoryError struct {
+	Address uint64 // The first address that couldn't be accessed.
+	Write   bool
+	Reason  string // Such as "input/output error".
+}
+
+func (e *MemoryError) Error() string {
+	op := "read"
+	if e.Write {
+		op = "write"
+	}
+	return fmt.Sprintf("can't %s memory at %#x: %s", op, e.Address, e.Reason)
+}
+
+// ObjectFreed is the error returned by Value when, according to the
+// runtime's heap metadata, a variable's memory is no longer part of an
+// allocated object.
+type ObjectFreed struct {
+	// Address is the variable's address.
+	Address uint64
+	// Reason says why the memory isn't part of an allocated object.
+	Reason string
+}
+
+func (e *ObjectFreed) Error() string {
+	return fmt.Sprintf("object at %#x freed or moved: %s", e.Address, e.Reason)
 }
 
 type Frame struct {
@@ -284,20 +1542,40 @@ type Frame struct {
 	// File and Line are the source code location of the PC.
 	File string
 	Line uint64
-	// Function is the name of this frame's function.
+	// Function is the name of this frame's function.  For an
+	// instantiation of a generic function, the type arguments are those of
+	// its shapes, such as main.Max[int].
 	Function string
 	// FunctionStart is the starting PC of the function.
 	FunctionStart uint64
 	// Params contains the function's parameters.
 	Params []Param
-	// Vars contains the function's local variables.
+	// Vars contains the function's local variables that are in scope at PC.
+	// A parameter or variable that one declared in an inner block shadows
+	// has its declaration line added to its name, as in "x (line 12)".
 	Vars []LocalVar
+	// Kind classifies frames that frontends may want to hide by default:
+	// it is "runtime" for the Go runtime, "testing" for the testing
+	// package, "cgo" for the code passing calls between Go and C, and empty
+	// for other frames.  It is "foreign" for code that isn't Go's, such as
+	// the C code a cgo program calls, whose frames are unwound with the
+	// .eh_frame sections of the executable and its shared objects.  They
+	// have no parameters or variables, and no source location unless the
+	// code has debugging information.
+	Kind string
+	// Inlined reports whether the frame is for a call the compiler inlined
+	// into the function of the frame after it.  It shares that frame's PC
+	// and SP, and its FunctionStart is the start of the inlined code.
+	Inlined bool
 }
 
 func (f Frame) String() string {
 	params := make([]string, len(f.Params))
 	for i, p := range f.Params {
-		params[i] = p.Name // TODO: more information
+		params[i] = p.Name
+		if p.Value != "" {
+			params[i] += "=" + p.Value
+		}
 	}
 	p := strings.Join(params, ", ")
 	off := f.PC - f.FunctionStart
@@ -308,6 +1586,10 @@ func (f Frame) String() string {
 type Param struct {
 	Name string
 	Var  Var
+	// Value is the parameter's value, formatted for display.  It is only set
+	// in the stack frames returned by Goroutines and in the arguments of a
+	// CallEvent, and is empty if the value could not be read.
+	Value string
 }
 
 // LocalVar is a local variable of a function.
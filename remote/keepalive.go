@@ -0,0 +1,189 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Keeping the connection to the debugproxy alive, and retrying calls whose
+// replies are late.
+
+package remote
+
+import (
+	"fmt"
+	"net/rpc"
+	"reflect"
+	"strings"
+	"time"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/server/protocol"
+)
+
+// These variables control how the connection to the debugproxy is checked.
+// They are read when New is called and by each call, so they should be set
+// before the first use of the package.
+var (
+	// KeepaliveInterval is how often the debugproxy is pinged. If it is
+	// zero, no pings are sent.
+	KeepaliveInterval = 30 * time.Second
+
+	// KeepaliveTimeout is how long a ping can go unanswered before the
+	// connection is considered lost and closed, failing all outstanding
+	// calls.
+	KeepaliveTimeout = 2 * time.Minute
+
+	// RetryTimeout is how long a call that only reads the debugproxy's state
+	// waits for its reply before it is sent again. The wait doubles with
+	// each attempt.
+	RetryTimeout = 30 * time.Second
+
+	// MaxRetries is the number of times such a call is sent again before
+	// its error is returned.
+	MaxRetries = 3
+)
+
+const (
+	retryBackoff    = 250 * time.Millisecond // Pause before the first retry.
+	maxRetryBackoff = 4 * time.Second
+)
+
+// idempotent holds the methods that only read the debugproxy's state, so
+// that repeating one whose reply is late does no harm.
+var idempotent = map[string]bool{
+	"Server.AsPointer":       true,
+	"Server.Batch":           true,
+	"Server.BinaryInfo":      true,
+	"Server.ChannelWaiters":  true,
+	"Server.DebugManifest":   true,
+	"Server.DeferredCalls":   true,
+	"Server.FindReferences":  true,
+	"Server.FindString":      true,
+	"Server.Frames":          true,
+	"Server.Functions":       true,
+	"Server.Goroutines":      true,
+	"Server.HeapDump":        true,
+	"Server.HeapStats":       true,
+	"Server.History":         true,
+	"Server.ListBreakpoints": true,
+	"Server.LocalVariables":  true,
+	"Server.MapElement":      true,
+	"Server.MapElements":     true,
+	"Server.PanicInfo":       true,
+	"Server.ReadMemory":      true,
+	"Server.RuntimeStatus":   true,
+	"Server.Sample":          true,
+	"Server.SharedObjects":   true,
+	"Server.Source":          true,
+	"Server.Sources":         true,
+	"Server.Threads":         true,
+	"Server.Types":           true,
+	"Server.Type":            true,
+	"Server.Value":           true,
+	"Server.ValueTree":       true,
+	"Server.VarByName":       true,
+}
+
+// errNoReply is returned by callOnce when the reply doesn't arrive in time.
+type errNoReply time.Duration
+
+func (e errNoReply) Error() string {
+	return fmt.Sprintf("no reply from debugproxy after %v", time.Duration(e))
+}
+
+// errUnsupported is returned for calls to methods the debugproxy doesn't have.
+type errUnsupported string
+
+func (e errUnsupported) Error() string {
+	return "the debugproxy is too old to support " + string(e)
+}
+
+// keepalive pings the debugproxy every KeepaliveInterval, and closes the
+// connection if a ping isn't answered within KeepaliveTimeout. The transport
+// is aborted first, since waiting for the SSH command to exit could take as
+// long as the network is down. keepalive returns when the connection is closed, or if
+// the debugproxy doesn't serve pings.
+func (p *Program) keepalive(interval, timeout time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for range t.C {
+		err := p.callOnce("Server.Ping", &protocol.PingRequest{}, &protocol.PingResponse{}, timeout)
+		if _, ok := err.(errNoReply); ok {
+			debug.Log(debug.LevelWarn, "connection to debugproxy lost", debug.Field{Key: "err", Value: err})
+			p.conn.Abort()
+			p.client.Close()
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// call makes an RPC to the debugproxy. Calls to methods that only read the
+// debugproxy's state are retried, with backoff, if their replies are late.
+// Calls to methods the debugproxy doesn't have fail with errUnsupported.
+func (p *Program) call(method string, req, resp interface{}) error {
+	name := strings.TrimPrefix(method, "Server.")
+	if !p.Supports(name) {
+		return errUnsupported(name)
+	}
+	if !idempotent[method] {
+		err := p.callOnce(method, req, resp, 0)
+		if isMissingMethod(err) {
+			return errUnsupported(name)
+		}
+		return err
+	}
+	timeout, backoff := RetryTimeout, retryBackoff
+	for attempt := 0; ; attempt++ {
+		// A late reply to an earlier attempt may still arrive, so each
+		// attempt decodes into its own response.
+		r := reflect.New(reflect.TypeOf(resp).Elem())
+		err := p.callOnce(method, req, r.Interface(), timeout)
+		if err == nil {
+			reflect.ValueOf(resp).Elem().Set(r.Elem())
+			return nil
+		}
+		if isMissingMethod(err) {
+			return errUnsupported(name)
+		}
+		if _, ok := err.(errNoReply); !ok || attempt == MaxRetries {
+			return err
+		}
+		time.Sleep(backoff)
+		timeout *= 2
+		if backoff *= 2; backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
+
+// callOnce makes an RPC to the debugproxy, logging it. If timeout is
+// positive, callOnce gives up waiting for the reply after that long.
+func (p *Program) callOnce(method string, req, resp interface{}, timeout time.Duration) error {
+	start := time.Now()
+	c := p.client.Go(method, req, resp, make(chan *rpc.Call, 1))
+	var err error
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		select {
+		case <-c.Done:
+			err = c.Error
+		case <-t.C:
+			err = errNoReply(timeout)
+		}
+		t.Stop()
+	} else {
+		<-c.Done
+		err = c.Error
+	}
+	err = exitedError(err)
+	fields := []debug.Field{
+		{Key: "method", Value: method},
+		{Key: "duration", Value: time.Since(start)},
+	}
+	if err != nil {
+		fields = append(fields, debug.Field{Key: "err", Value: err})
+	}
+	debug.Log(debug.LevelDebug, "rpc", fields...)
+	return err
+}
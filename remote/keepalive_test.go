@@ -0,0 +1,182 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package remote
+
+import (
+	"net"
+	"net/rpc"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/server/protocol"
+)
+
+// slowServer is a debugproxy that leaves calls unanswered: the first late[m]
+// calls to method m aren't answered until hang is closed.
+type slowServer struct {
+	mu    sync.Mutex
+	calls map[string]int
+	late  map[string]int
+	hang  chan struct{}
+}
+
+func newSlowServer(late map[string]int) *slowServer {
+	return &slowServer{calls: make(map[string]int), late: late, hang: make(chan struct{})}
+}
+
+// called counts a call to method, and waits for hang if it is one to leave
+// unanswered.
+func (s *slowServer) called(method string) {
+	s.mu.Lock()
+	s.calls[method]++
+	late := s.calls[method] <= s.late[method]
+	s.mu.Unlock()
+	if late {
+		<-s.hang
+	}
+}
+
+func (s *slowServer) numCalls(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[method]
+}
+
+func (s *slowServer) Frames(req *protocol.FramesRequest, resp *protocol.FramesResponse) error {
+	s.called("Frames")
+	resp.Frames = []debug.Frame{{PC: 0x1234}}
+	return nil
+}
+
+func (s *slowServer) Resume(req *protocol.ResumeRequest, resp *protocol.ResumeResponse) error {
+	s.called("Resume")
+	return nil
+}
+
+func (s *slowServer) Ping(req *protocol.PingRequest, resp *protocol.PingResponse) error {
+	s.called("Ping")
+	return nil
+}
+
+// abortConn is a Transport that records whether it was aborted.
+type abortConn struct {
+	net.Conn
+	aborted chan struct{}
+}
+
+func (c abortConn) Abort() {
+	close(c.aborted)
+	c.Conn.Close()
+}
+
+// newSlowProgram returns a Program connected to s.
+func newSlowProgram(t *testing.T, s *slowServer) (*Program, abortConn) {
+	client, conn := net.Pipe()
+	srv := rpc.NewServer()
+	srv.RegisterName("Server", s)
+	go srv.ServeConn(conn)
+	c := abortConn{client, make(chan struct{})}
+	p, err := NewWithTransport(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p, c
+}
+
+func TestRetry(t *testing.T) {
+	defer func(d time.Duration) { KeepaliveInterval = d }(KeepaliveInterval)
+	KeepaliveInterval = 0
+	defer func(d time.Duration) { RetryTimeout = d }(RetryTimeout)
+	RetryTimeout = 20 * time.Millisecond
+	defer func(n int) { MaxRetries = n }(MaxRetries)
+	MaxRetries = 2
+
+	tests := []struct {
+		name  string
+		late  int // Calls left unanswered.
+		calls int
+		err   bool
+	}{
+		{name: "answered", late: 0, calls: 1},
+		{name: "answered when retried", late: 2, calls: 3},
+		{name: "never answered", late: 100, calls: 3, err: true},
+	}
+	for _, tt := range tests {
+		s := newSlowServer(map[string]int{"Frames": tt.late})
+		p, _ := newSlowProgram(t, s)
+		frames, err := p.Frames(1)
+		if tt.err {
+			if _, ok := err.(errNoReply); !ok {
+				t.Errorf("%s: got error %v, want no reply", tt.name, err)
+			}
+		} else if err != nil || len(frames) != 1 || frames[0].PC != 0x1234 {
+			t.Errorf("%s: got frames %v, error %v; want the server's frame", tt.name, frames, err)
+		}
+		if got := s.numCalls("Frames"); got != tt.calls {
+			t.Errorf("%s: Frames sent %d times, want %d", tt.name, got, tt.calls)
+		}
+		close(s.hang)
+		p.client.Close()
+	}
+}
+
+func TestNoRetryOfChanges(t *testing.T) {
+	defer func(d time.Duration) { KeepaliveInterval = d }(KeepaliveInterval)
+	KeepaliveInterval = 0
+	defer func(d time.Duration) { RetryTimeout = d }(RetryTimeout)
+	RetryTimeout = 20 * time.Millisecond
+
+	s := newSlowServer(map[string]int{"Resume": 1})
+	p, _ := newSlowProgram(t, s)
+	defer p.client.Close()
+	// A late reply to a call that changes the process is waited for, since
+	// sending it again would repeat the change.
+	time.AfterFunc(10*RetryTimeout, func() { close(s.hang) })
+	if err := p.call("Server.Resume", &protocol.ResumeRequest{}, &protocol.ResumeResponse{}); err != nil {
+		t.Errorf("Resume: %v", err)
+	}
+	if got := s.numCalls("Resume"); got != 1 {
+		t.Errorf("Resume sent %d times, want 1", got)
+	}
+}
+
+func TestKeepalive(t *testing.T) {
+	defer func(d time.Duration) { KeepaliveInterval = d }(KeepaliveInterval)
+	KeepaliveInterval = 10 * time.Millisecond
+	defer func(d time.Duration) { KeepaliveTimeout = d }(KeepaliveTimeout)
+	KeepaliveTimeout = 50 * time.Millisecond
+
+	// While pings are answered, the connection is kept.
+	s := newSlowServer(nil)
+	p, c := newSlowProgram(t, s)
+	time.Sleep(10 * KeepaliveInterval)
+	if _, err := p.Frames(1); err != nil {
+		t.Errorf("Frames with pings answered: %v", err)
+	}
+	if s.numCalls("Ping") < 2 {
+		t.Errorf("sent %d pings, want several", s.numCalls("Ping"))
+	}
+	select {
+	case <-c.aborted:
+		t.Error("connection aborted with pings answered")
+	default:
+	}
+	p.client.Close()
+
+	// When a ping isn't answered, the connection is closed, failing calls.
+	s = newSlowServer(map[string]int{"Ping": 1})
+	defer close(s.hang)
+	p, c = newSlowProgram(t, s)
+	select {
+	case <-c.aborted:
+	case <-time.After(10 * time.Second):
+		t.Fatal("connection not aborted with a ping unanswered")
+	}
+	if _, err := p.Frames(1); err != rpc.ErrShutdown {
+		t.Errorf("Frames after the connection was lost: got error %v, want %v", err, rpc.ErrShutdown)
+	}
+}
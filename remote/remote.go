@@ -6,11 +6,14 @@
 package remote // import "golang.org/x/debug/remote"
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/rpc"
 	"os"
 	"os/exec"
+	"sync"
+	"time"
 
 	"golang.org/x/debug"
 	"golang.org/x/debug/server/protocol"
@@ -24,19 +27,78 @@ var _ debug.File = (*File)(nil)
 // debugged on a possibly remote machine by communicating
 // with a debugproxy adjacent to the target program.
 type Program struct {
-	client *rpc.Client
+	client   *rpc.Client
+	conn     Transport
+	features map[string]bool // The debugproxy's methods, or nil if it didn't say.
+	observer bool            // Whether the debugproxy serves the Program as an observer.
+	session  string          // The debugproxy's session ID.
+
+	eventsOnce sync.Once
+	events     chan debug.Event
+
+	mu            sync.Mutex
+	resumeTimeout time.Duration
+	resuming      *resumption // The call to Resume, if one is outstanding.
+}
+
+// A resumption is a call to the server's Resume, which callers of Resume wait
+// for until it returns or their timeout elapses.
+type resumption struct {
+	done   chan struct{} // Closed when the call returns.
+	status debug.Status
+	err    error
 }
 
 // DebugproxyCmd is the path to the debugproxy command. It is a variable in case
 // the default value, "debugproxy", is not in the $PATH.
 var DebugproxyCmd = "debugproxy"
 
+// DebugproxyGrace, if positive, is how long debugproxies started by New keep
+// the process after losing their connection, for Reconnect to connect to
+// them again.
+var DebugproxyGrace time.Duration
+
 // New connects to the specified host using SSH, starts DebugproxyCmd
 // there, and creates a new program from the specified file.
 // The program can then be started by the Run method.
 func New(host string, textFile string) (*Program, error) {
 	// TODO: add args.
-	cmdStrs := []string{"/usr/bin/ssh", host, DebugproxyCmd, "-text", textFile}
+	args := []string{"-text", textFile}
+	if DebugproxyGrace > 0 {
+		args = append(args, "-grace", DebugproxyGrace.String())
+	}
+	t, err := startDebugproxy(host, args...)
+	if err != nil {
+		return nil, err
+	}
+	return NewWithTransport(t)
+}
+
+// Reconnect connects to the specified host using SSH, and reconnects to the
+// debugproxy with the given session ID, as returned by SessionID, which must
+// have been started with -grace to keep the process while its client is
+// disconnected.  The returned Program replaces the one which lost its
+// connection, and finds the process and breakpoints as that one left them.
+func Reconnect(host string, sessionID string) (*Program, error) {
+	t, err := startDebugproxy(host, "-reconnect", sessionID)
+	if err != nil {
+		return nil, err
+	}
+	p, err := NewWithTransport(t)
+	if err != nil {
+		return nil, err
+	}
+	if p.session != sessionID {
+		p.client.Close()
+		return nil, fmt.Errorf("reconnected to session %q, want %q", p.session, sessionID)
+	}
+	return p, nil
+}
+
+// startDebugproxy runs DebugproxyCmd with the given arguments on the
+// specified host using SSH, and returns a Transport to it once it is ready.
+func startDebugproxy(host string, args ...string) (Transport, error) {
+	cmdStrs := append([]string{"/usr/bin/ssh", host, DebugproxyCmd}, args...)
 	if host == "localhost" {
 		cmdStrs = cmdStrs[2:]
 	}
@@ -63,14 +125,11 @@ func New(host string, textFile string) (*Program, error) {
 		// Communication error.
 		return nil, fmt.Errorf("unrecognized message %q", msg)
 	}
-	program := &Program{
-		client: rpc.NewClient(&rwc{
-			ssh: cmd,
-			r:   fromStdout,
-			w:   toStdin,
-		}),
-	}
-	return program, nil
+	return &rwc{
+		ssh: cmd,
+		r:   fromStdout,
+		w:   toStdin,
+	}, nil
 }
 
 // readLine reads one line of text from the reader. It does no buffering.
@@ -108,6 +167,11 @@ func (rwc *rwc) Write(p []byte) (int, error) {
 	return rwc.w.Write(p)
 }
 
+// Abort kills the debugproxy, or the SSH connection to it.
+func (rwc *rwc) Abort() {
+	rwc.ssh.Process.Kill()
+}
+
 func (rwc *rwc) Close() error {
 	rerr := rwc.r.Close()
 	werr := rwc.w.Close()
@@ -128,7 +192,7 @@ func (p *Program) Open(name string, mode string) (debug.File, error) {
 		Mode: mode,
 	}
 	var resp protocol.OpenResponse
-	err := p.client.Call("Server.Open", &req, &resp)
+	err := p.call("Server.Open", &req, &resp)
 	if err != nil {
 		return nil, err
 	}
@@ -140,9 +204,9 @@ func (p *Program) Open(name string, mode string) (debug.File, error) {
 }
 
 func (p *Program) Run(args ...string) (debug.Status, error) {
-	req := protocol.RunRequest{args}
+	req := protocol.RunRequest{Args: args}
 	var resp protocol.RunResponse
-	err := p.client.Call("Server.Run", &req, &resp)
+	err := p.call("Server.Run", &req, &resp)
 	if err != nil {
 		return debug.Status{}, err
 	}
@@ -154,9 +218,112 @@ func (p *Program) Stop() (debug.Status, error) {
 }
 
 func (p *Program) Resume() (debug.Status, error) {
-	req := protocol.ResumeRequest{}
-	var resp protocol.ResumeResponse
-	err := p.client.Call("Server.Resume", &req, &resp)
+	p.mu.Lock()
+	r := p.resuming
+	if r == nil {
+		// The program isn't still running after an earlier Resume timed
+		// out, so resume it.
+		r = &resumption{done: make(chan struct{})}
+		p.resuming = r
+		go func() {
+			req := protocol.ResumeRequest{}
+			var resp protocol.ResumeResponse
+			r.err = p.call("Server.Resume", &req, &resp)
+			r.status = resp.Status
+			close(r.done)
+		}()
+	}
+	timeout := p.resumeTimeout
+	p.mu.Unlock()
+
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		select {
+		case <-r.done:
+		case <-t.C:
+			return debug.Status{Reason: "running"}, nil
+		}
+	} else {
+		<-r.done
+	}
+	p.mu.Lock()
+	if p.resuming == r {
+		p.resuming = nil
+	}
+	p.mu.Unlock()
+	if r.err != nil {
+		return debug.Status{}, r.err
+	}
+	return r.status, nil
+}
+
+func (p *Program) SetResumeTimeout(d time.Duration) {
+	p.mu.Lock()
+	p.resumeTimeout = d
+	p.mu.Unlock()
+}
+
+func (p *Program) Checkpoint() (uint64, error) {
+	req := protocol.CheckpointRequest{}
+	var resp protocol.CheckpointResponse
+	err := p.call("Server.Checkpoint", &req, &resp)
+	return resp.ID, err
+}
+
+func (p *Program) Restore(id uint64) (debug.Status, error) {
+	req := protocol.RestoreRequest{ID: id}
+	var resp protocol.RestoreResponse
+	err := p.call("Server.Restore", &req, &resp)
+	return resp.Status, err
+}
+
+func (p *Program) DeleteCheckpoint(id uint64) error {
+	req := protocol.DeleteCheckpointRequest{ID: id}
+	var resp protocol.DeleteCheckpointResponse
+	return p.call("Server.DeleteCheckpoint", &req, &resp)
+}
+
+func (p *Program) SetRecording(enabled bool) error {
+	req := protocol.SetRecordingRequest{Enabled: enabled}
+	var resp protocol.SetRecordingResponse
+	return p.call("Server.SetRecording", &req, &resp)
+}
+
+func (p *Program) ReverseToPreviousBreak() (debug.Status, error) {
+	req := protocol.ReverseToPreviousBreakRequest{}
+	var resp protocol.ReverseToPreviousBreakResponse
+	err := p.call("Server.ReverseToPreviousBreak", &req, &resp)
+	return resp.Status, err
+}
+
+func (p *Program) ReverseToPreviousStop() (debug.Status, error) {
+	req := protocol.ReverseToPreviousStopRequest{}
+	var resp protocol.ReverseToPreviousStopResponse
+	err := p.call("Server.ReverseToPreviousStop", &req, &resp)
+	return resp.Status, err
+}
+
+func (p *Program) Interrupt() error {
+	req := protocol.InterruptRequest{}
+	var resp protocol.InterruptResponse
+	return p.call("Server.Interrupt", &req, &resp)
+}
+
+func (p *Program) StepInstruction() (debug.Status, error) {
+	req := protocol.StepInstructionRequest{}
+	var resp protocol.StepInstructionResponse
+	err := p.call("Server.StepInstruction", &req, &resp)
+	if err != nil {
+		return debug.Status{}, err
+	}
+	return resp.Status, nil
+}
+
+func (p *Program) RunToLine(file string, line uint64) (debug.Status, error) {
+	req := protocol.RunToLineRequest{File: file, Line: line}
+	var resp protocol.RunToLineResponse
+	err := p.call("Server.RunToLine", &req, &resp)
 	if err != nil {
 		return debug.Status{}, err
 	}
@@ -164,41 +331,294 @@ func (p *Program) Resume() (debug.Status, error) {
 }
 
 func (p *Program) Kill() (debug.Status, error) {
-	panic("unimplemented")
+	req := protocol.KillRequest{}
+	var resp protocol.KillResponse
+	err := p.call("Server.Kill", &req, &resp)
+	if err != nil {
+		return debug.Status{}, err
+	}
+	return resp.Status, nil
 }
 
-func (p *Program) Breakpoint(address uint64) ([]uint64, error) {
+func (p *Program) Restart(keepBreakpoints bool) (debug.Status, error) {
+	req := protocol.RestartRequest{KeepBreakpoints: keepBreakpoints}
+	var resp protocol.RestartResponse
+	err := p.call("Server.Restart", &req, &resp)
+	if err != nil {
+		return debug.Status{}, err
+	}
+	return resp.Status, nil
+}
+
+func (p *Program) SetKillOnExit(kill bool) error {
+	req := protocol.SetKillOnExitRequest{
+		Kill: kill,
+	}
+	var resp protocol.SetKillOnExitResponse
+	return p.call("Server.SetKillOnExit", &req, &resp)
+}
+
+func (p *Program) SetDeterministic(on bool) error {
+	req := protocol.SetDeterministicRequest{
+		Deterministic: on,
+	}
+	var resp protocol.SetDeterministicResponse
+	return p.call("Server.SetDeterministic", &req, &resp)
+}
+
+func (p *Program) SetShowTemporaries(show bool) error {
+	req := protocol.SetShowTemporariesRequest{
+		Show: show,
+	}
+	var resp protocol.SetShowTemporariesResponse
+	return p.call("Server.SetShowTemporaries", &req, &resp)
+}
+
+func (p *Program) SetSignalPolicy(signal string, policy debug.SignalPolicy) error {
+	req := protocol.SetSignalPolicyRequest{
+		Signal: signal,
+		Policy: policy,
+	}
+	var resp protocol.SetSignalPolicyResponse
+	return p.call("Server.SetSignalPolicy", &req, &resp)
+}
+
+func (p *Program) SetPanicStops(functions []string) error {
+	req := protocol.SetPanicStopsRequest{
+		Functions: functions,
+	}
+	var resp protocol.SetPanicStopsResponse
+	return p.call("Server.SetPanicStops", &req, &resp)
+}
+
+func (p *Program) SetThreadStops(stop bool) error {
+	req := protocol.SetThreadStopsRequest{
+		Stop: stop,
+	}
+	var resp protocol.SetThreadStopsResponse
+	return p.call("Server.SetThreadStops", &req, &resp)
+}
+
+func (p *Program) Detach() error {
+	req := protocol.DetachRequest{}
+	var resp protocol.DetachResponse
+	return p.call("Server.Detach", &req, &resp)
+}
+
+func (p *Program) Shutdown(kill bool) error {
+	req := protocol.ShutdownRequest{
+		Kill: kill,
+	}
+	var resp protocol.ShutdownResponse
+	err := p.call("Server.Shutdown", &req, &resp)
+	// The debugproxy exits once the connection is closed.
+	p.client.Close()
+	return err
+}
+
+func (p *Program) ResumeAsync() error {
+	req := protocol.ResumeAsyncRequest{}
+	var resp protocol.ResumeAsyncResponse
+	return p.call("Server.ResumeAsync", &req, &resp)
+}
+
+func (p *Program) Events() <-chan debug.Event {
+	p.eventsOnce.Do(func() {
+		p.events = make(chan debug.Event, 16)
+		go p.readEvents()
+	})
+	return p.events
+}
+
+// readEvents delivers the server's events on p.events, until the server
+// can no longer be asked for them.
+func (p *Program) readEvents() {
+	defer close(p.events)
+	for {
+		req := protocol.NextEventRequest{}
+		var resp protocol.NextEventResponse
+		if err := p.call("Server.NextEvent", &req, &resp); err != nil {
+			return
+		}
+		p.events <- resp.Event
+	}
+}
+
+func (p *Program) Stdout() io.Reader {
+	return &outputReader{prog: p, fd: 1}
+}
+
+func (p *Program) Stderr() io.Reader {
+	return &outputReader{prog: p, fd: 2}
+}
+
+func (p *Program) Breakpoint(address uint64) (debug.Breakpoint, error) {
 	req := protocol.BreakpointRequest{
 		Address: address,
 	}
 	var resp protocol.BreakpointResponse
-	err := p.client.Call("Server.Breakpoint", &req, &resp)
-	return resp.PCs, err
+	err := p.call("Server.Breakpoint", &req, &resp)
+	return resp.Breakpoint, err
+}
+
+func (p *Program) BreakpointAtFunction(name string) (debug.Breakpoint, error) {
+	req := protocol.BreakpointAtFunctionRequest{
+		Function: name,
+	}
+	var resp protocol.BreakpointResponse
+	err := p.call("Server.BreakpointAtFunction", &req, &resp)
+	return resp.Breakpoint, err
 }
 
-func (p *Program) BreakpointAtFunction(name string) ([]uint64, error) {
+func (p *Program) PendingBreakpointAtFunction(name string) (debug.Breakpoint, error) {
 	req := protocol.BreakpointAtFunctionRequest{
 		Function: name,
+		Pending:  true,
 	}
 	var resp protocol.BreakpointResponse
-	err := p.client.Call("Server.BreakpointAtFunction", &req, &resp)
-	return resp.PCs, err
+	err := p.call("Server.BreakpointAtFunction", &req, &resp)
+	return resp.Breakpoint, err
 }
 
-func (p *Program) BreakpointAtLine(file string, line uint64) ([]uint64, error) {
+func (p *Program) BreakpointAtLine(file string, line uint64) (debug.Breakpoint, error) {
 	req := protocol.BreakpointAtLineRequest{
 		File: file,
 		Line: line,
 	}
 	var resp protocol.BreakpointResponse
-	err := p.client.Call("Server.BreakpointAtLine", &req, &resp)
-	return resp.PCs, err
+	err := p.call("Server.BreakpointAtLine", &req, &resp)
+	return resp.Breakpoint, err
+}
+
+func (p *Program) BreakpointAtPackageInit(pkg string) (debug.Breakpoint, error) {
+	req := protocol.BreakpointAtPackageInitRequest{
+		Package: pkg,
+	}
+	var resp protocol.BreakpointResponse
+	err := p.call("Server.BreakpointAtPackageInit", &req, &resp)
+	return resp.Breakpoint, err
 }
 
-func (p *Program) DeleteBreakpoints(pcs []uint64) error {
-	req := protocol.DeleteBreakpointsRequest{PCs: pcs}
+func (p *Program) BreakpointAtCgoCalls() (debug.Breakpoint, error) {
+	req := protocol.BreakpointAtCgoCallsRequest{}
+	var resp protocol.BreakpointResponse
+	err := p.call("Server.BreakpointAtCgoCalls", &req, &resp)
+	return resp.Breakpoint, err
+}
+
+func (p *Program) DeleteBreakpoints(ids []uint64) error {
+	req := protocol.DeleteBreakpointsRequest{IDs: ids}
 	var resp protocol.DeleteBreakpointsResponse
-	return p.client.Call("Server.DeleteBreakpoints", &req, &resp)
+	return p.call("Server.DeleteBreakpoints", &req, &resp)
+}
+
+func (p *Program) EnableBreakpoint(id uint64, enabled bool) error {
+	req := protocol.EnableBreakpointRequest{ID: id, Enabled: enabled}
+	var resp protocol.EnableBreakpointResponse
+	return p.call("Server.EnableBreakpoint", &req, &resp)
+}
+
+func (p *Program) SetBreakpointCaller(id uint64, function string) error {
+	req := protocol.SetBreakpointCallerRequest{ID: id, Function: function}
+	var resp protocol.SetBreakpointCallerResponse
+	return p.call("Server.SetBreakpointCaller", &req, &resp)
+}
+
+func (p *Program) SetBreakpointGroup(id uint64, group string) error {
+	req := protocol.SetBreakpointGroupRequest{ID: id, Group: group}
+	var resp protocol.SetBreakpointGroupResponse
+	return p.call("Server.SetBreakpointGroup", &req, &resp)
+}
+
+func (p *Program) SetBreakpointOneShot(id uint64, oneShot bool) error {
+	req := protocol.SetBreakpointOneShotRequest{ID: id, OneShot: oneShot}
+	var resp protocol.SetBreakpointOneShotResponse
+	return p.call("Server.SetBreakpointOneShot", &req, &resp)
+}
+
+func (p *Program) SetBreakpointRecord(id uint64, record bool, exprs []string) error {
+	req := protocol.SetBreakpointRecordRequest{ID: id, Record: record, Exprs: exprs}
+	var resp protocol.SetBreakpointRecordResponse
+	return p.call("Server.SetBreakpointRecord", &req, &resp)
+}
+
+func (p *Program) Snapshots() ([]debug.Snapshot, error) {
+	req := protocol.SnapshotsRequest{}
+	var resp protocol.SnapshotsResponse
+	err := p.call("Server.Snapshots", &req, &resp)
+	return resp.Snapshots, err
+}
+
+func (p *Program) SetBreakpointTrace(id uint64, trace bool, exprs []string) error {
+	req := protocol.SetBreakpointTraceRequest{ID: id, Trace: trace, Exprs: exprs}
+	var resp protocol.SetBreakpointTraceResponse
+	return p.call("Server.SetBreakpointTrace", &req, &resp)
+}
+
+func (p *Program) SetBreakpointCommands(id uint64, commands []string) error {
+	req := protocol.SetBreakpointCommandsRequest{ID: id, Commands: commands}
+	var resp protocol.SetBreakpointCommandsResponse
+	return p.call("Server.SetBreakpointCommands", &req, &resp)
+}
+
+func (p *Program) TraceEvents() ([]debug.TraceEvent, error) {
+	req := protocol.TraceEventsRequest{}
+	var resp protocol.TraceEventsResponse
+	err := p.call("Server.TraceEvents", &req, &resp)
+	return resp.Events, err
+}
+
+func (p *Program) Trace(funcRegexp string) ([]string, error) {
+	req := protocol.TraceRequest{Regexp: funcRegexp}
+	var resp protocol.TraceResponse
+	err := p.call("Server.Trace", &req, &resp)
+	return resp.Functions, err
+}
+
+func (p *Program) EnableBreakpointGroup(group string, enabled bool) error {
+	req := protocol.EnableBreakpointGroupRequest{Group: group, Enabled: enabled}
+	var resp protocol.EnableBreakpointGroupResponse
+	return p.call("Server.EnableBreakpointGroup", &req, &resp)
+}
+
+func (p *Program) DeleteBreakpointGroup(group string) error {
+	req := protocol.DeleteBreakpointGroupRequest{Group: group}
+	var resp protocol.DeleteBreakpointGroupResponse
+	return p.call("Server.DeleteBreakpointGroup", &req, &resp)
+}
+
+func (p *Program) ListBreakpoints() ([]debug.Breakpoint, error) {
+	req := protocol.ListBreakpointsRequest{}
+	var resp protocol.ListBreakpointsResponse
+	err := p.call("Server.ListBreakpoints", &req, &resp)
+	return resp.Breakpoints, err
+}
+
+func (p *Program) WatchGlobal(name string) (debug.Watchpoint, error) {
+	req := protocol.WatchGlobalRequest{Name: name}
+	var resp protocol.WatchGlobalResponse
+	err := p.call("Server.WatchGlobal", &req, &resp)
+	return resp.Watchpoint, err
+}
+
+func (p *Program) WatchMap(m debug.Map, threshold uint64) (debug.Watchpoint, error) {
+	req := protocol.WatchMapRequest{Map: m, Threshold: threshold}
+	var resp protocol.WatchMapResponse
+	err := p.call("Server.WatchMap", &req, &resp)
+	return resp.Watchpoint, err
+}
+
+func (p *Program) DeleteWatchpoints(ids []uint64) error {
+	req := protocol.DeleteWatchpointsRequest{IDs: ids}
+	var resp protocol.DeleteWatchpointsResponse
+	return p.call("Server.DeleteWatchpoints", &req, &resp)
+}
+
+func (p *Program) FindString(substr string) ([]debug.StringMatch, error) {
+	req := protocol.FindStringRequest{Substring: substr}
+	var resp protocol.FindStringResponse
+	err := p.call("Server.FindString", &req, &resp)
+	return resp.Matches, err
 }
 
 func (p *Program) Eval(expr string) ([]string, error) {
@@ -206,17 +626,62 @@ func (p *Program) Eval(expr string) ([]string, error) {
 		Expr: expr,
 	}
 	var resp protocol.EvalResponse
-	err := p.client.Call("Server.Eval", &req, &resp)
+	err := p.call("Server.Eval", &req, &resp)
+	return resp.Result, err
+}
+
+func (p *Program) EvalFormat(expr string, opts debug.FormatOptions) ([]string, error) {
+	req := protocol.EvalRequest{
+		Expr:   expr,
+		Format: opts,
+	}
+	var resp protocol.EvalResponse
+	err := p.call("Server.Eval", &req, &resp)
 	return resp.Result, err
 }
 
-func (p *Program) Evaluate(e string) (debug.Value, error) {
+func (p *Program) Evaluate(e string) (debug.Value, debug.Type, error) {
 	req := protocol.EvaluateRequest{
 		Expression: e,
 	}
 	var resp protocol.EvaluateResponse
-	err := p.client.Call("Server.Evaluate", &req, &resp)
-	return resp.Result, err
+	err := p.call("Server.Evaluate", &req, &resp)
+	if err == nil && resp.Err != nil {
+		return nil, debug.Type{}, resp.Err
+	}
+	return resp.Result, resp.Type, err
+}
+
+func (p *Program) Sample(expressions ...string) ([]debug.Sample, error) {
+	req := protocol.SampleRequest{
+		Expressions: expressions,
+	}
+	var resp protocol.SampleResponse
+	err := p.call("Server.Sample", &req, &resp)
+	return resp.Samples, err
+}
+
+func (p *Program) Batch(calls []debug.BatchCall) ([]debug.BatchResult, error) {
+	req := protocol.BatchRequest{
+		Calls: calls,
+	}
+	var resp protocol.BatchResponse
+	err := p.call("Server.Batch", &req, &resp)
+	return resp.Results, err
+}
+
+func (p *Program) BinaryInfo() (debug.BinaryInfo, error) {
+	req := protocol.BinaryInfoRequest{}
+	var resp protocol.BinaryInfoResponse
+	err := p.call("Server.BinaryInfo", &req, &resp)
+	return resp.Info, err
+}
+
+func (p *Program) History(expr string, n int) ([]debug.HistoryEntry, error) {
+	req := protocol.HistoryRequest{Expr: expr, N: n}
+	var resp protocol.HistoryResponse
+	err := p.call("Server.History", &req, &resp)
+	return resp.Entries, err
 }
 
 func (p *Program) Frames(count int) ([]debug.Frame, error) {
@@ -224,38 +689,226 @@ func (p *Program) Frames(count int) ([]debug.Frame, error) {
 		Count: count,
 	}
 	var resp protocol.FramesResponse
-	err := p.client.Call("Server.Frames", &req, &resp)
+	err := p.call("Server.Frames", &req, &resp)
 	return resp.Frames, err
 }
 
+func (p *Program) SelectFrame(frameIndex int) error {
+	req := protocol.SelectFrameRequest{
+		Frame: frameIndex,
+	}
+	var resp protocol.SelectFrameResponse
+	return p.call("Server.SelectFrame", &req, &resp)
+}
+
+func (p *Program) Threads() ([]debug.Thread, error) {
+	req := protocol.ThreadsRequest{}
+	var resp protocol.ThreadsResponse
+	err := p.call("Server.Threads", &req, &resp)
+	return resp.Threads, err
+}
+
+func (p *Program) SharedObjects() ([]debug.SharedObject, error) {
+	req := protocol.SharedObjectsRequest{}
+	var resp protocol.SharedObjectsResponse
+	err := p.call("Server.SharedObjects", &req, &resp)
+	return resp.Objects, err
+}
+
+func (p *Program) SelectThread(tid int) error {
+	req := protocol.SelectThreadRequest{
+		Thread: tid,
+	}
+	var resp protocol.SelectThreadResponse
+	return p.call("Server.SelectThread", &req, &resp)
+}
+
+func (p *Program) LocalVariables(frameIndex int) ([]debug.LocalVar, error) {
+	req := protocol.LocalVariablesRequest{
+		FrameIndex: frameIndex,
+	}
+	var resp protocol.LocalVariablesResponse
+	err := p.call("Server.LocalVariables", &req, &resp)
+	return resp.Vars, err
+}
+
+func (p *Program) ChannelWaiters(ch debug.Channel) ([]debug.ChannelWaiter, error) {
+	req := protocol.ChannelWaitersRequest{Channel: ch}
+	var resp protocol.ChannelWaitersResponse
+	err := p.call("Server.ChannelWaiters", &req, &resp)
+	return resp.Waiters, err
+}
+
 func (p *Program) Goroutines() ([]*debug.Goroutine, error) {
 	req := protocol.GoroutinesRequest{}
 	var resp protocol.GoroutinesResponse
-	err := p.client.Call("Server.Goroutines", &req, &resp)
+	err := p.call("Server.Goroutines", &req, &resp)
 	return resp.Goroutines, err
 }
 
+func (p *Program) PanicInfo() (debug.PanicInfo, error) {
+	req := protocol.PanicInfoRequest{}
+	var resp protocol.PanicInfoResponse
+	err := p.call("Server.PanicInfo", &req, &resp)
+	return resp.Info, err
+}
+
+func (p *Program) DeferredCalls(goroutine int64, frameIndex int) ([]debug.DeferredCall, error) {
+	req := protocol.DeferredCallsRequest{
+		Goroutine:  goroutine,
+		FrameIndex: frameIndex,
+	}
+	var resp protocol.DeferredCallsResponse
+	err := p.call("Server.DeferredCalls", &req, &resp)
+	return resp.Calls, err
+}
+
+func (p *Program) HeapStats() (debug.HeapStats, error) {
+	req := protocol.HeapStatsRequest{}
+	var resp protocol.HeapStatsResponse
+	err := p.call("Server.HeapStats", &req, &resp)
+	return resp.Stats, err
+}
+
+func (p *Program) HeapDump() ([]debug.HeapObject, error) {
+	req := protocol.HeapDumpRequest{}
+	var resp protocol.HeapDumpResponse
+	err := p.call("Server.HeapDump", &req, &resp)
+	return resp.Objects, err
+}
+
+func (p *Program) FindReferences(addr uint64) ([]debug.Reference, error) {
+	req := protocol.FindReferencesRequest{Address: addr}
+	var resp protocol.FindReferencesResponse
+	err := p.call("Server.FindReferences", &req, &resp)
+	return resp.References, err
+}
+
+func (p *Program) RuntimeStatus() (debug.RuntimeStatus, error) {
+	req := protocol.RuntimeStatusRequest{}
+	var resp protocol.RuntimeStatusResponse
+	err := p.call("Server.RuntimeStatus", &req, &resp)
+	return resp.Status, err
+}
+
+func (p *Program) Functions(re string) ([]string, error) {
+	req := protocol.FunctionsRequest{Regexp: re}
+	var resp protocol.FunctionsResponse
+	err := p.call("Server.Functions", &req, &resp)
+	return resp.Names, err
+}
+
+func (p *Program) Sources() ([]string, error) {
+	req := protocol.SourcesRequest{}
+	var resp protocol.SourcesResponse
+	err := p.call("Server.Sources", &req, &resp)
+	return resp.Files, err
+}
+
+func (p *Program) Source(file string, startLine, endLine uint64) (debug.Source, error) {
+	req := protocol.SourceRequest{File: file, StartLine: startLine, EndLine: endLine}
+	var resp protocol.SourceResponse
+	err := p.call("Server.Source", &req, &resp)
+	return resp.Source, err
+}
+
+func (p *Program) Types(re string) ([]string, error) {
+	req := protocol.TypesRequest{Regexp: re}
+	var resp protocol.TypesResponse
+	err := p.call("Server.Types", &req, &resp)
+	return resp.Names, err
+}
+
+func (p *Program) Type(typeID uint64) (debug.TypeInfo, error) {
+	req := protocol.TypeRequest{TypeID: typeID}
+	var resp protocol.TypeResponse
+	err := p.call("Server.Type", &req, &resp)
+	return resp.Info, err
+}
+
+func (p *Program) ExportDebugManifest(w io.Writer) error {
+	req := protocol.DebugManifestRequest{}
+	var resp protocol.DebugManifestResponse
+	if err := p.call("Server.DebugManifest", &req, &resp); err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(resp.Manifest)
+}
+
 func (p *Program) VarByName(name string) (debug.Var, error) {
 	req := protocol.VarByNameRequest{Name: name}
 	var resp protocol.VarByNameResponse
-	err := p.client.Call("Server.VarByName", &req, &resp)
+	err := p.call("Server.VarByName", &req, &resp)
+	return resp.Var, err
+}
+
+func (p *Program) AsPointer(v debug.Value, typeName string) (debug.Var, error) {
+	req := protocol.AsPointerRequest{Value: v, TypeName: typeName}
+	var resp protocol.AsPointerResponse
+	err := p.call("Server.AsPointer", &req, &resp)
 	return resp.Var, err
 }
 
 func (p *Program) Value(v debug.Var) (debug.Value, error) {
 	req := protocol.ValueRequest{Var: v}
 	var resp protocol.ValueResponse
-	err := p.client.Call("Server.Value", &req, &resp)
+	err := p.call("Server.Value", &req, &resp)
+	if err == nil && resp.Freed != nil {
+		return nil, resp.Freed
+	}
 	return resp.Value, err
 }
 
+func (p *Program) ReadMemory(addr uint64, length int) ([]byte, error) {
+	req := protocol.ReadMemoryRequest{
+		Address: addr,
+		Length:  length,
+	}
+	var resp protocol.ReadMemoryResponse
+	err := p.call("Server.ReadMemory", &req, &resp)
+	if err == nil && resp.Err != nil {
+		return resp.Data, resp.Err
+	}
+	return resp.Data, err
+}
+
+func (p *Program) WriteMemory(addr uint64, data []byte) (int, error) {
+	req := protocol.WriteMemoryRequest{
+		Address: addr,
+		Data:    data,
+	}
+	var resp protocol.WriteMemoryResponse
+	err := p.call("Server.WriteMemory", &req, &resp)
+	if err == nil && resp.Err != nil {
+		return resp.Written, resp.Err
+	}
+	return resp.Written, err
+}
+
+func (p *Program) ValueTree(v debug.Var, depth int) (debug.ValueTree, error) {
+	req := protocol.ValueTreeRequest{
+		Var:   v,
+		Depth: depth,
+	}
+	var resp protocol.ValueTreeResponse
+	err := p.call("Server.ValueTree", &req, &resp)
+	return resp.Tree, err
+}
+
 func (p *Program) MapElement(m debug.Map, index uint64) (debug.Var, debug.Var, error) {
 	req := protocol.MapElementRequest{Map: m, Index: index}
 	var resp protocol.MapElementResponse
-	err := p.client.Call("Server.MapElement", &req, &resp)
+	err := p.call("Server.MapElement", &req, &resp)
 	return resp.Key, resp.Value, err
 }
 
+func (p *Program) MapElements(m debug.Map, start, count uint64) ([]debug.MapEntry, error) {
+	req := protocol.MapElementsRequest{Map: m, Start: start, Count: count}
+	var resp protocol.MapElementsResponse
+	err := p.call("Server.MapElements", &req, &resp)
+	return resp.Entries, err
+}
+
 // File implements the debug.File interface, providing access
 // to file-like resources associated with the target program.
 type File struct {
@@ -270,7 +923,7 @@ func (f *File) ReadAt(p []byte, offset int64) (int, error) {
 		Offset: offset,
 	}
 	var resp protocol.ReadAtResponse
-	err := f.prog.client.Call("Server.ReadAt", &req, &resp)
+	err := f.prog.call("Server.ReadAt", &req, &resp)
 	return copy(p, resp.Data), err
 }
 
@@ -281,7 +934,7 @@ func (f *File) WriteAt(p []byte, offset int64) (int, error) {
 		Offset: offset,
 	}
 	var resp protocol.WriteAtResponse
-	err := f.prog.client.Call("Server.WriteAt", &req, &resp)
+	err := f.prog.call("Server.WriteAt", &req, &resp)
 	return resp.Len, err
 }
 
@@ -290,6 +943,31 @@ func (f *File) Close() error {
 		FD: f.fd,
 	}
 	var resp protocol.CloseResponse
-	err := f.prog.client.Call("Server.Close", &req, &resp)
+	err := f.prog.call("Server.Close", &req, &resp)
 	return err
 }
+
+// outputReader reads the output of the process from one of its standard
+// output streams.
+type outputReader struct {
+	prog *Program
+	fd   int
+}
+
+func (f *outputReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	req := protocol.ReadOutputRequest{
+		FD:  f.fd,
+		Len: len(p),
+	}
+	var resp protocol.ReadOutputResponse
+	if err := f.prog.call("Server.ReadOutput", &req, &resp); err != nil {
+		return 0, err
+	}
+	if resp.EOF {
+		return 0, io.EOF
+	}
+	return copy(p, resp.Data), nil
+}
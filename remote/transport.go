@@ -0,0 +1,234 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Connections to debug servers other than a debugproxy started over SSH.
+
+package remote
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/rpc"
+	"strings"
+	"time"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/server"
+	"golang.org/x/debug/server/protocol"
+)
+
+// A Transport is a connection to a debug server, over which a Program sends
+// its calls, encoded by net/rpc, and receives the replies.  The server end
+// serves a server.Server registered with net/rpc, as debugproxy does.
+type Transport interface {
+	io.ReadWriteCloser
+	// Abort ends the connection without waiting for the server, when the
+	// server has stopped replying.  Close is called after it.
+	Abort()
+}
+
+// NewWithTransport returns a Program that sends its calls over t, after
+// checking the server at the other end speaks the same version of the
+// protocol.  If it doesn't, t is closed.
+func NewWithTransport(t Transport) (*Program, error) {
+	program := &Program{
+		client: rpc.NewClient(t),
+		conn:   t,
+	}
+	if err := program.handshake(); err != nil {
+		program.client.Close()
+		return nil, err
+	}
+	if KeepaliveInterval > 0 {
+		go program.keepalive(KeepaliveInterval, KeepaliveTimeout)
+	}
+	return program, nil
+}
+
+// handshake exchanges protocol versions with the server, and records the
+// server's features.  A debugproxy too old to have a Handshake method is
+// assumed to speak the current version, and to have every feature.
+func (p *Program) handshake() error {
+	req := protocol.HandshakeRequest{Version: protocol.Version}
+	var resp protocol.HandshakeResponse
+	err := p.callOnce("Server.Handshake", &req, &resp, HandshakeTimeout)
+	if isMissingMethod(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if resp.Version != protocol.Version {
+		return fmt.Errorf("debugproxy speaks protocol version %d, but this client speaks version %d", resp.Version, protocol.Version)
+	}
+	p.observer = resp.Observer
+	p.session = resp.Session
+	p.features = make(map[string]bool)
+	for _, f := range resp.Features {
+		p.features[f] = true
+	}
+	return nil
+}
+
+// Supports reports whether the debugproxy has the method with the given
+// name, such as "Batch", which is usually that of the Program method calling
+// it, so that a client can fall back to other methods when talking to an
+// older debugproxy.
+func (p *Program) Supports(method string) bool {
+	return p.features == nil || p.features[method]
+}
+
+// Observer reports whether the debugproxy serves p as an observer, which can
+// only make calls that observe the process, such as reading values, while
+// another client controls it.
+func (p *Program) Observer() bool {
+	return p.observer
+}
+
+// SessionID returns the debugproxy's session ID, with which Reconnect can
+// connect to it again if the connection is lost.  It is empty if the
+// debugproxy is too old to have one.
+func (p *Program) SessionID() string {
+	return p.session
+}
+
+// isMissingMethod reports whether err is net/rpc's error for a call to a
+// method the server doesn't have.
+func isMissingMethod(err error) bool {
+	e, ok := err.(rpc.ServerError)
+	return ok && strings.HasPrefix(string(e), "rpc: can't find method ")
+}
+
+// exitedError returns err as a *debug.ProcessExited if it is the server's
+// report that the process has exited, which net/rpc passes on only as a
+// string, so that callers can tell an exit from a failure as they can with a
+// local Program.
+func exitedError(err error) error {
+	e, ok := err.(rpc.ServerError)
+	if !ok {
+		return err
+	}
+	var exited debug.ProcessExited
+	if _, err1 := fmt.Sscanf(string(e), "process exited with status %d", &exited.ExitStatus); err1 == nil {
+		return &exited
+	}
+	if sig := strings.TrimPrefix(string(e), "process exited: killed by signal "); sig != string(e) {
+		return &debug.ProcessExited{ExitStatus: -1, Signal: sig}
+	}
+	return err
+}
+
+// NewInProcess creates a server for the specified file in this process, and
+// returns a Program connected to it by an in-memory Transport.  Calls take
+// the same path as to a debugproxy, through net/rpc and its encoding, without
+// starting one.
+func NewInProcess(textFile string) (*Program, error) {
+	s, err := server.New(textFile)
+	if err != nil {
+		return nil, err
+	}
+	return NewWithTransport(Pipe(s))
+}
+
+// Pipe returns an in-memory Transport to s, which it serves until the
+// Transport is closed.  Then, as debugproxy does when its connection closes,
+// s kills or detaches from the process, as its client asked.
+func Pipe(s *server.Server) Transport {
+	client, conn := net.Pipe()
+	go func() {
+		s.ServeConn(conn, false)
+		if err := s.Detach(&protocol.DetachRequest{}, &protocol.DetachResponse{}); err != nil {
+			debug.Log(debug.LevelWarn, "detaching", debug.Field{Key: "err", Value: err})
+		}
+	}()
+	return netConn{client}
+}
+
+// PipeObserver is like Pipe, but s serves the Transport as an observer, as
+// server.Server.ServeConn describes, and it doesn't detach when the Transport
+// is closed.
+func PipeObserver(s *server.Server) Transport {
+	client, conn := net.Pipe()
+	go s.ServeConn(conn, true)
+	return netConn{client}
+}
+
+// HandshakeTimeout is how long Dial and DialTLS wait for a debugproxy to
+// accept their token.
+var HandshakeTimeout = 30 * time.Second
+
+// Dial connects to a debugproxy listening on the TCP address addr, as
+// "debugproxy -listen" does, and authenticates with token, which must match
+// the one in the debugproxy's -token-file.  The debugproxy serves only the
+// first client to authenticate; when it disconnects, the debugproxy kills or
+// detaches from the process, as the client asked, and exits.
+//
+// The connection isn't encrypted; use DialTLS unless the network is trusted.
+func Dial(addr, token string) (*Program, error) {
+	conn, err := net.DialTimeout("tcp", addr, HandshakeTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return handshake(conn, token)
+}
+
+// DialTLS is like Dial, but connects using TLS configured by config, to a
+// debugproxy given -tls-cert and -tls-key.  A nil config verifies the
+// debugproxy's certificate against the system's roots.  If the debugproxy was
+// given -tls-client-ca, config must hold a certificate signed by that
+// authority, and token can be empty if the debugproxy has no -token-file.
+// TLS versions before 1.2 aren't used, unless config sets MinVersion.
+func DialTLS(addr, token string, config *tls.Config) (*Program, error) {
+	if config == nil {
+		config = &tls.Config{}
+	} else {
+		config = config.Clone()
+	}
+	if config.MinVersion == 0 {
+		config.MinVersion = tls.VersionTLS12
+	}
+	dialer := &net.Dialer{Timeout: HandshakeTimeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", addr, config)
+	if err != nil {
+		return nil, err
+	}
+	return handshake(conn, token)
+}
+
+// handshake sends token to the debugproxy at the other end of conn, which
+// replies "OK" if it accepts it, and returns a Program using the connection.
+func handshake(conn net.Conn, token string) (*Program, error) {
+	if strings.ContainsAny(token, "\r\n") {
+		conn.Close()
+		return nil, fmt.Errorf("token contains a line break")
+	}
+	conn.SetDeadline(time.Now().Add(HandshakeTimeout))
+	if _, err := io.WriteString(conn, token+"\n"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	msg, err := readLine(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("reading reply to token: %v", err)
+	}
+	if msg != "OK" {
+		conn.Close()
+		return nil, fmt.Errorf("debugproxy refused connection: %s", msg)
+	}
+	conn.SetDeadline(time.Time{})
+	return NewWithTransport(netConn{conn})
+}
+
+// netConn is a Transport over a network connection, or the in-memory
+// connection from Pipe.
+type netConn struct {
+	net.Conn
+}
+
+func (c netConn) Abort() {
+	c.Conn.Close()
+}
@@ -0,0 +1,199 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package remote
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"net/rpc"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/debug/server/protocol"
+)
+
+// fakeServer answers the Handshake call as a debugproxy does.
+type fakeServer struct{}
+
+func (fakeServer) Handshake(req *protocol.HandshakeRequest, resp *protocol.HandshakeResponse) error {
+	resp.Version = protocol.Version
+	resp.Session = "session"
+	resp.Features = []string{"Handshake", "Batch"}
+	return nil
+}
+
+// fakeProxy serves conn as debugproxy -listen does: it reads the client's
+// token, and if it is token, replies "OK" and serves a fakeServer.  If reply
+// is false, it reads the token but never replies.
+func fakeProxy(conn net.Conn, token string, reply bool) {
+	defer conn.Close()
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		if _, err := conn.Read(b); err != nil {
+			return
+		}
+		if b[0] == '\n' {
+			break
+		}
+		line = append(line, b[0])
+	}
+	if !reply {
+		io.Copy(ioutil.Discard, conn)
+		return
+	}
+	if string(line) != token {
+		io.WriteString(conn, "authentication failed\n")
+		return
+	}
+	io.WriteString(conn, "OK\n")
+	s := rpc.NewServer()
+	s.RegisterName("Server", fakeServer{})
+	s.ServeConn(conn)
+}
+
+func TestHandshake(t *testing.T) {
+	defer func(d time.Duration) { KeepaliveInterval = d }(KeepaliveInterval)
+	KeepaliveInterval = 0
+	defer func(d time.Duration) { HandshakeTimeout = d }(HandshakeTimeout)
+	HandshakeTimeout = 2 * time.Second
+
+	tests := []struct {
+		name    string
+		token   string
+		noReply bool
+		err     string
+	}{
+		{name: "right token", token: "secret"},
+		{name: "wrong token", token: "secrets", err: "debugproxy refused connection: authentication failed"},
+		{name: "line break in token", token: "sec\nret", err: "token contains a line break"},
+		{name: "no reply", token: "secret", noReply: true, err: "reading reply to token"},
+	}
+	for _, tt := range tests {
+		client, server := net.Pipe()
+		go fakeProxy(server, "secret", !tt.noReply)
+		p, err := handshake(client, tt.token)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+			}
+			if p != nil {
+				p.client.Close()
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if p.SessionID() != "session" || !p.Supports("Batch") || p.Supports("Checkpoint") {
+			t.Errorf("%s: got session %q, features %v; want the fake server's", tt.name, p.SessionID(), p.features)
+		}
+		p.client.Close()
+	}
+}
+
+func TestDial(t *testing.T) {
+	defer func(d time.Duration) { KeepaliveInterval = d }(KeepaliveInterval)
+	KeepaliveInterval = 0
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go fakeProxy(conn, "secret", true)
+		}
+	}()
+	p, err := Dial(l.Addr().String(), "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.SessionID() != "session" {
+		t.Errorf("got session %q, want %q", p.SessionID(), "session")
+	}
+	p.client.Close()
+	if _, err := Dial(l.Addr().String(), "wrong"); err == nil || !strings.Contains(err.Error(), "authentication failed") {
+		t.Errorf("dialing with the wrong token: got error %v", err)
+	}
+}
+
+func TestDialTLS(t *testing.T) {
+	defer func(d time.Duration) { KeepaliveInterval = d }(KeepaliveInterval)
+	KeepaliveInterval = 0
+	// httptest provides a certificate for 127.0.0.1, and the pool to
+	// trust it.
+	srv := httptest.NewUnstartedServer(nil)
+	srv.StartTLS()
+	cert := srv.TLS.Certificates[0]
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	srv.Close()
+
+	listen := func(maxVersion uint16) net.Listener {
+		l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MaxVersion:   maxVersion,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				go fakeProxy(conn, "secret", true)
+			}
+		}()
+		return l
+	}
+	l := listen(0)
+	defer l.Close()
+	old := listen(tls.VersionTLS11)
+	defer old.Close()
+
+	tests := []struct {
+		name   string
+		addr   string
+		config *tls.Config
+		err    string
+	}{
+		{name: "trusted", addr: l.Addr().String(), config: &tls.Config{RootCAs: roots}},
+		{name: "untrusted", addr: l.Addr().String(), err: "certificate"},
+		{name: "TLS 1.1", addr: old.Addr().String(), config: &tls.Config{RootCAs: roots}, err: "version"},
+	}
+	for _, tt := range tests {
+		p, err := DialTLS(tt.addr, "secret", tt.config)
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			} else {
+				p.client.Close()
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+		}
+		if p != nil {
+			p.client.Close()
+		}
+	}
+	if tests[0].config.MinVersion != 0 {
+		t.Errorf("DialTLS changed its caller's config")
+	}
+}
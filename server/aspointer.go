@@ -0,0 +1,87 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Reinterpreting uintptr and unsafe.Pointer values as typed pointers.
+
+package server
+
+import (
+	"fmt"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/server/protocol"
+)
+
+func (s *Server) AsPointer(req *protocol.AsPointerRequest, resp *protocol.AsPointerResponse) error {
+	return s.call(s.otherc, req, resp)
+}
+
+func (s *Server) handleAsPointer(req *protocol.AsPointerRequest, resp *protocol.AsPointerResponse) error {
+	var addr uint64
+	switch v := req.Value.(type) {
+	case uint64:
+		addr = v
+	case uint32:
+		addr = uint64(v)
+	case debug.Pointer:
+		addr = v.Address
+	default:
+		return fmt.Errorf("AsPointer: %T is not a uintptr or pointer", req.Value)
+	}
+	entry, err := s.dwarfData.LookupEntry(req.TypeName)
+	if err != nil {
+		return fmt.Errorf("type %s: %s", req.TypeName, err)
+	}
+	t, err := s.dwarfData.Type(entry.Offset)
+	if err != nil {
+		return fmt.Errorf("type %s: %s", req.TypeName, err)
+	}
+	if addr == 0 {
+		return fmt.Errorf("AsPointer: nil pointer")
+	}
+	size := uint64(t.Size())
+	if t.Size() <= 0 {
+		size = 1 // A zero-size value still has to point somewhere valid.
+	}
+	if err := s.checkMapped(addr, size); err != nil {
+		return fmt.Errorf("AsPointer: %s", err)
+	}
+	resp.Var = debug.Var{TypeID: uint64(entry.Offset), Address: addr}
+	return nil
+}
+
+// A memoryRegion is a mapping of the process's memory.
+type memoryRegion struct {
+	start, end uint64
+	readable   bool
+	offset     uint64 // The offset of the mapping in the file it maps.
+	path       string // The file mapped, or "" if it isn't known.
+}
+
+// checkMapped returns an error unless the size bytes at addr are all in
+// readable mappings of the process's memory.
+func (s *Server) checkMapped(addr, size uint64) error {
+	regions, err := memoryRegions(s.proc.Pid)
+	if err != nil {
+		return err
+	}
+	next, end := addr, addr+size
+	for _, r := range regions {
+		if !r.readable {
+			continue
+		}
+		// Mappings are listed in order of address, so a range spanning
+		// adjacent mappings is checked a mapping at a time.
+		if r.start <= next && next < r.end {
+			if end <= r.end {
+				return nil
+			}
+			next = r.end
+		}
+	}
+	if next == addr {
+		return fmt.Errorf("%#x is not in the process's readable memory", addr)
+	}
+	return fmt.Errorf("%d bytes at %#x extend past the process's readable memory", size, addr)
+}
@@ -0,0 +1,70 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Serving several requests for values in one call.
+
+package server
+
+import (
+	"fmt"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/server/protocol"
+)
+
+func (s *Server) Batch(req *protocol.BatchRequest, resp *protocol.BatchResponse) error {
+	return s.call(s.otherc, req, resp)
+}
+
+func (s *Server) handleBatch(req *protocol.BatchRequest, resp *protocol.BatchResponse) error {
+	resp.Results = make([]debug.BatchResult, len(req.Calls))
+	for i, c := range req.Calls {
+		r := &resp.Results[i]
+		if err := s.batchCall(c, r); err != nil {
+			r.Err = err.Error()
+		}
+	}
+	return nil
+}
+
+// batchCall makes a single call of a batch, storing its result in r.
+func (s *Server) batchCall(c debug.BatchCall, r *debug.BatchResult) error {
+	n := 0
+	if c.Eval != "" {
+		n++
+	}
+	if c.Value != nil {
+		n++
+	}
+	if c.VarByName != "" {
+		n++
+	}
+	if n != 1 {
+		return fmt.Errorf("batch call sets %d of Eval, Value and VarByName, want exactly one", n)
+	}
+
+	switch {
+	case c.Eval != "":
+		var resp protocol.EvalResponse
+		err := s.handleEval(&protocol.EvalRequest{Expr: c.Eval, Format: c.Format}, &resp)
+		r.Eval = resp.Result
+		return err
+	case c.Value != nil:
+		var resp protocol.ValueResponse
+		if err := s.handleValue(&protocol.ValueRequest{Var: *c.Value}, &resp); err != nil {
+			return err
+		}
+		if resp.Freed != nil {
+			return resp.Freed
+		}
+		r.Value = resp.Value
+	default:
+		var resp protocol.VarByNameResponse
+		if err := s.handleVarByName(&protocol.VarByNameRequest{Name: c.VarByName}, &resp); err != nil {
+			return err
+		}
+		r.Var = resp.Var
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Determining how the executable was built.
+
+package server
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/arch"
+	"golang.org/x/debug/dwarf"
+	"golang.org/x/debug/elf"
+	"golang.org/x/debug/macho"
+	"golang.org/x/debug/pe"
+	"golang.org/x/debug/server/protocol"
+)
+
+func (s *Server) BinaryInfo(req *protocol.BinaryInfoRequest, resp *protocol.BinaryInfoResponse) error {
+	return s.call(s.otherc, req, resp)
+}
+
+func (s *Server) handleBinaryInfo(req *protocol.BinaryInfoRequest, resp *protocol.BinaryInfoResponse) error {
+	resp.Info = s.binaryInfo
+	return nil
+}
+
+// loadSection is a section of the executable that is loaded into memory.
+type loadSection struct {
+	addr, size uint64
+	io.ReaderAt
+}
+
+// readBinaryInfo determines how the executable f, with the given
+// architecture and DWARF data, was built.  detected is the architecture
+// detected from f's headers, or nil; it names the architecture if a is a
+// customized one.
+func readBinaryInfo(f *os.File, a, detected *arch.Architecture, d *dwarf.Data) debug.BinaryInfo {
+	var info debug.BinaryInfo
+	info.GOARCH = goarch(a)
+	if info.GOARCH == "" {
+		info.GOARCH = goarch(detected)
+	}
+	var sections []loadSection
+	var buildInfo io.ReaderAt
+	if obj, err := elf.NewFile(f); err == nil {
+		// Only FreeBSD marks its executables in the ELF header; the other
+		// systems Go supports are told apart by the notes they need.
+		switch {
+		case obj.OSABI == elf.ELFOSABI_FREEBSD:
+			info.GOOS = "freebsd"
+		case obj.Section(".note.netbsd.ident") != nil:
+			info.GOOS = "netbsd"
+		case obj.Section(".note.openbsd.ident") != nil:
+			info.GOOS = "openbsd"
+		default:
+			info.GOOS = "linux"
+		}
+		for _, sect := range obj.Sections {
+			if sect.Flags&elf.SHF_ALLOC != 0 && sect.Type != elf.SHT_NOBITS {
+				sections = append(sections, loadSection{sect.Addr, sect.Size, sect})
+			}
+		}
+		if sect := obj.Section(".go.buildinfo"); sect != nil {
+			buildInfo = sect
+		}
+	} else if obj, err := macho.NewFile(f); err == nil {
+		info.GOOS = "darwin"
+		for _, sect := range obj.Sections {
+			sections = append(sections, loadSection{sect.Addr, sect.Size, sect})
+		}
+	} else if obj, err := pe.NewFile(f); err == nil {
+		info.GOOS = "windows"
+		base := obj.ImageBase()
+		for _, sect := range obj.Sections {
+			// Only the part of the section that is in the file can be read.
+			size := sect.VirtualSize
+			if sect.Size < size {
+				size = sect.Size
+			}
+			sections = append(sections, loadSection{base + uint64(sect.VirtualAddress), uint64(size), sect})
+		}
+	}
+
+	// Since Go 1.10 the compiler records its version in each compilation
+	// unit, followed by the flags it was run with, which for the register ABI
+	// include "regabi".  Older binaries only have the version in the runtime.
+	var producer string
+	if d != nil {
+		if entry, err := d.Reader().Next(); err == nil && entry != nil {
+			producer, _ = entry.Val(dwarf.AttrProducer).(string)
+		}
+	}
+	for _, field := range strings.FieldsFunc(producer, func(r rune) bool { return r == ' ' || r == ';' }) {
+		if strings.HasPrefix(field, "go1") {
+			info.GoVersion = field
+		}
+		if field == "regabi" {
+			info.RegisterABI = true
+		}
+	}
+	if info.GoVersion == "" {
+		info.GoVersion = readBuildVersion(d, a, sections)
+	}
+	if info.GoVersion == "" && buildInfo != nil {
+		info.GoVersion = readBuildInfoVersion(buildInfo)
+	}
+	if !info.RegisterABI && info.GOARCH == "amd64" && goMinorVersion(info.GoVersion) >= 17 {
+		info.RegisterABI = true
+	}
+	return info
+}
+
+// goarch returns the GOARCH value for a, or "" if a isn't one of the
+// architectures in package arch.
+func goarch(a *arch.Architecture) string {
+	switch a {
+	case &arch.AMD64:
+		return "amd64"
+	case &arch.X86:
+		return "386"
+	case &arch.ARM:
+		return "arm"
+	}
+	return ""
+}
+
+// readBuildVersion returns the value of the runtime's buildVersion string,
+// read from the executable's loaded sections, or "" if it can't be read.
+func readBuildVersion(d *dwarf.Data, a *arch.Architecture, sections []loadSection) string {
+	if d == nil {
+		return ""
+	}
+	entry, err := d.LookupVariable("runtime.buildVersion")
+	if err != nil {
+		return ""
+	}
+	addr, err := d.EntryLocation(entry)
+	if err != nil {
+		return ""
+	}
+	read := func(addr uint64, n int) []byte {
+		for _, sect := range sections {
+			if sect.addr <= addr && addr-sect.addr+uint64(n) <= sect.size {
+				buf := make([]byte, n)
+				if _, err := sect.ReadAt(buf, int64(addr-sect.addr)); err != nil {
+					return nil
+				}
+				return buf
+			}
+		}
+		return nil
+	}
+	ps := a.PointerSize
+	hdr := read(addr, 2*ps)
+	if hdr == nil {
+		return ""
+	}
+	var ptr, n uint64
+	if ps == 8 {
+		ptr, n = a.ByteOrder.Uint64(hdr), a.ByteOrder.Uint64(hdr[8:])
+	} else {
+		ptr, n = uint64(a.ByteOrder.Uint32(hdr)), uint64(a.ByteOrder.Uint32(hdr[4:]))
+	}
+	if n > 64 {
+		return ""
+	}
+	return string(read(ptr, int(n)))
+}
+
+// buildInfoMagic starts the .go.buildinfo section.
+const buildInfoMagic = "\xff Go buildinf:"
+
+// readBuildInfoVersion returns the Go version recorded in the executable's
+// .go.buildinfo section, which is all there is for a stripped executable, or
+// "" if it can't be read.  Only the format of Go 1.18 and later, which holds
+// the version itself rather than a pointer to it, is understood.
+func readBuildInfoVersion(r io.ReaderAt) string {
+	var hdr [32 + binary.MaxVarintLen64]byte
+	n, _ := r.ReadAt(hdr[:], 0)
+	if n < 32 || string(hdr[:len(buildInfoMagic)]) != buildInfoMagic {
+		return ""
+	}
+	const flagsVersionInl = 2
+	if hdr[len(buildInfoMagic)+1]&flagsVersionInl == 0 {
+		return ""
+	}
+	length, k := binary.Uvarint(hdr[32:n])
+	if k <= 0 || length > 64 {
+		return ""
+	}
+	v := make([]byte, length)
+	if _, err := r.ReadAt(v, 32+int64(k)); err != nil {
+		return ""
+	}
+	return string(v)
+}
+
+// goMinorVersion returns the minor version number of a Go release version
+// such as "go1.10.3", or 0 if it is something else, like a development
+// version.
+func goMinorVersion(v string) int {
+	if !strings.HasPrefix(v, "go1.") {
+		return 0
+	}
+	v = v[len("go1."):]
+	if i := strings.IndexFunc(v, func(r rune) bool { return r < '0' || r > '9' }); i >= 0 {
+		v = v[:i]
+	}
+	n, _ := strconv.Atoi(v)
+	return n
+}
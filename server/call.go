@@ -0,0 +1,364 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Calling functions in the program, using the runtime's debugCallV2
+// protocol.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/dwarf"
+)
+
+// Values the runtime's debugCallV2 leaves in R12 when it traps, to say what
+// the debugger should do next.
+const (
+	debugCallFrameReady = 0  // Set up the arguments and call the function.
+	debugCallReturned   = 1  // Read the results.
+	debugCallPanicked   = 2  // Read the panic value.
+	debugCallUnsafe     = 8  // The call can't be made; read the reason.
+	debugCallRestore    = 16 // Restore the registers, other than RIP and RSP.
+)
+
+// Limits on the arguments passed in registers by the amd64 register ABI.
+const (
+	maxIntArgRegs   = 9  // RAX, RBX, RCX, RDI, RSI, R8, R9, R10, R11.
+	maxFloatArgRegs = 15 // X0 to X14.
+)
+
+// callArgs holds the arguments for a function call, as the register ABI
+// passes them.
+type callArgs struct {
+	ints   []uint64
+	floats []uint64 // The bits of each float.
+}
+
+// funcSignature returns the start address of the named function, and the
+// types of its parameters and results.
+func (s *Server) funcSignature(name string) (pc uint64, params, results []dwarf.Type, err error) {
+	entry, err := s.dwarfData.LookupFunction(name)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	if pc, err = s.functionStartAddress(name); err != nil {
+		return 0, nil, nil, err
+	}
+	r := s.dwarfData.Reader()
+	r.Seek(entry.Offset)
+	if _, err := r.Next(); err != nil {
+		return 0, nil, nil, err
+	}
+	for {
+		child, err := r.Next()
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		if child == nil || child.Tag == 0 {
+			break
+		}
+		if child.Tag != dwarf.TagFormalParameter {
+			r.SkipChildren()
+			continue
+		}
+		off, err := s.dwarfData.EntryTypeOffset(child)
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		t, err := s.dwarfData.Type(off)
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		// Results are parameters with the VarParam attribute set.
+		if isResult, _ := child.Val(dwarf.AttrVarParam).(bool); isResult {
+			results = append(results, t)
+		} else {
+			params = append(params, t)
+		}
+	}
+	return pc, params, results, nil
+}
+
+// callFunction calls the function starting at pc in the goroutine of the
+// stopped thread, and returns its result, which has type result.  The call is
+// made through the runtime's debugCallV2, which checks that the goroutine is
+// at a point where a call is safe, and gives the call a frame that the
+// runtime can grow and scan.  The program's other threads run while the
+// function does, so that it can allocate memory and wait for other
+// goroutines; breakpoints it reaches are passed.  Afterwards the thread is
+// returned to where it was stopped, with its registers restored.
+func (s *Server) callFunction(pc uint64, args callArgs, result dwarf.Type) (val debug.Value, err error) {
+	if s.binaryInfo.GOARCH != "amd64" || !s.binaryInfo.RegisterABI {
+		return nil, errors.New("function calls are only supported on amd64 with the register ABI")
+	}
+	if len(args.ints) > maxIntArgRegs || len(args.floats) > maxFloatArgRegs {
+		return nil, errors.New("too many arguments to pass in registers")
+	}
+	debugCall, err := s.functionStartAddress("runtime.debugCallV2")
+	if err != nil {
+		return nil, errors.New("the program's runtime doesn't support function calls")
+	}
+	tid := s.stoppedPid
+	saved := s.stoppedRegs
+	var savedFP fpRegs
+	if err := s.ptraceGetFPRegs(tid, &savedFP); err != nil {
+		return nil, fmt.Errorf("ptraceGetFPRegs: %v", err)
+	}
+
+	// The call can only be made from the program's own Go code.
+	stopPC := saved.Rip
+	entry, _, err := s.pcToFunction(stopPC)
+	if err != nil {
+		return nil, errors.New("can't call a function here: not in Go code")
+	}
+	if name, _ := entry.Val(dwarf.AttrName).(string); !strings.Contains(name, ".") || strings.HasPrefix(name, "runtime.") {
+		return nil, fmt.Errorf("can't call a function here: in %s", name)
+	}
+
+	// When it is done, debugCallV2 returns to where the thread was stopped,
+	// which needs a breakpoint there to stop it again.  One is added for
+	// the duration of the call if there isn't one.
+	if _, ok := s.breakpoints[stopPC]; !ok {
+		if err := s.insertBreakpointPCs([]uint64{stopPC}); err != nil {
+			return nil, err
+		}
+		if err := s.ptracePoke(tid, uintptr(stopPC), s.arch.BreakpointInstr[:s.arch.BreakpointSize]); err != nil {
+			delete(s.breakpoints, stopPC)
+			return nil, fmt.Errorf("ptracePoke: %v", err)
+		}
+		defer func() {
+			bp := s.breakpoints[stopPC]
+			orig := bp.origInstr[:s.arch.BreakpointSize]
+			delete(s.breakpoints, stopPC)
+			if s.exited != nil {
+				return
+			}
+			if err1 := s.ptracePoke(tid, uintptr(stopPC), orig); err == nil && err1 != nil {
+				err = fmt.Errorf("ptracePoke: %v", err1)
+			}
+		}()
+	}
+
+	// The call frame must have room for the function to spill its register
+	// arguments, and for us to store its result.
+	frameSize := uint64(s.arch.PointerSize) * uint64(len(args.ints)+len(args.floats))
+	if size := uint64(result.Size()); size > frameSize {
+		frameSize = size
+	}
+
+	// Call debugCallV2 as though from the stopped PC.
+	regs := saved
+	regs.Rsp -= uint64(s.arch.PointerSize)
+	if err := s.pokeUint64(regs.Rsp, stopPC); err != nil {
+		return nil, err
+	}
+	if err := s.pokeUint64(regs.Rsp-16, frameSize); err != nil {
+		return nil, err
+	}
+	regs.Rip = debugCall
+	if err := s.ptraceSetRegs(tid, &regs); err != nil {
+		return nil, fmt.Errorf("ptraceSetRegs: %v", err)
+	}
+
+	if err := s.resumeOtherThreads(); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if s.exited != nil {
+			return
+		}
+		if err1 := s.stopOtherThreads(); err == nil {
+			err = err1
+		}
+	}()
+
+	var callErr error
+	for restored := false; ; {
+		if err := s.ptraceCont(tid, 0); err != nil {
+			return nil, fmt.Errorf("ptraceCont: %v", err)
+		}
+		if err := s.waitForCallTrap(tid, &regs); err != nil {
+			return nil, err
+		}
+		trapPC := regs.Rip - uint64(s.arch.BreakpointSize)
+		if restored {
+			if trapPC != stopPC {
+				return nil, fmt.Errorf("function call returned to %#x, not %#x", trapPC, stopPC)
+			}
+			// Back at the stopped PC.  debugCallV2 has restored the
+			// registers, adjusting any that point into the stack if the
+			// stack moved.
+			regs.Rip = stopPC
+			if err := s.ptraceSetRegs(tid, &regs); err != nil {
+				return nil, fmt.Errorf("ptraceSetRegs: %v", err)
+			}
+			s.stoppedRegs = regs
+			return val, callErr
+		}
+		if _, ok := s.breakpoints[trapPC]; ok {
+			// The function reached a breakpoint; carry on past it.
+			regs.Rip = trapPC
+			s.stoppedRegs = regs
+			if err := s.stepOverBreakpoint(trapPC); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		switch regs.R12 {
+		case debugCallFrameReady:
+			if err := s.setCallArgs(tid, &regs, args); err != nil {
+				return nil, err
+			}
+			// Call the function, returning to debugCallV2.
+			regs.Rsp -= uint64(s.arch.PointerSize)
+			if err := s.pokeUint64(regs.Rsp, regs.Rip); err != nil {
+				return nil, err
+			}
+			regs.Rip = pc
+			regs.Rdx = 0 // The closure context, which top-level functions don't use.
+		case debugCallReturned:
+			val, callErr = s.callResult(tid, &regs, result)
+		case debugCallPanicked:
+			callErr = errors.New("the function panicked")
+		case debugCallUnsafe:
+			reason, err := s.callString(regs.Rsp)
+			if err != nil {
+				return nil, err
+			}
+			callErr = fmt.Errorf("can't call a function here: %s", reason)
+		case debugCallRestore:
+			// Restore the registers, but leave debugCallV2 to return to the
+			// stopped PC.
+			rip, rsp := regs.Rip, regs.Rsp
+			regs = saved
+			regs.Rip, regs.Rsp = rip, rsp
+			if err := s.ptraceSetFPRegs(tid, &savedFP); err != nil {
+				return nil, fmt.Errorf("ptraceSetFPRegs: %v", err)
+			}
+			restored = true
+		default:
+			return nil, fmt.Errorf("unexpected trap at %#x during function call", trapPC)
+		}
+		if err := s.ptraceSetRegs(tid, &regs); err != nil {
+			return nil, fmt.Errorf("ptraceSetRegs: %v", err)
+		}
+	}
+}
+
+// waitForCallTrap waits for thread tid, which is making a function call, to
+// trap, and reads its registers into regs.  Signals it receives meanwhile are
+// handled as set by SetSignalPolicy, except that none stop the call.
+func (s *Server) waitForCallTrap(tid int, regs *ptraceRegs) error {
+	for {
+		_, status, err := s.wait(tid, false)
+		if err != nil {
+			return fmt.Errorf("wait: %v", err)
+		}
+		if status.Exited() || status.Signaled() {
+			if tid == s.proc.Pid {
+				s.setExited(processExited(status))
+				return s.exited
+			}
+			return fmt.Errorf("thread %d exited during function call", tid)
+		}
+		sig := status.StopSignal()
+		if sig == syscall.SIGTRAP && status.TrapCause() != ptraceEventClone {
+			if err := s.ptraceGetRegs(tid, regs); err != nil {
+				return fmt.Errorf("ptraceGetRegs: %v", err)
+			}
+			return nil
+		}
+		deliver := 0
+		if sig != syscall.SIGTRAP {
+			deliver = s.signalToDeliver(sig)
+		}
+		if err := s.ptraceCont(tid, deliver); err != nil {
+			return fmt.Errorf("ptraceCont: %v", err)
+		}
+	}
+}
+
+// setCallArgs puts the arguments of a function call in the registers the
+// register ABI passes them in.
+func (s *Server) setCallArgs(tid int, regs *ptraceRegs, args callArgs) error {
+	intRegs := []*uint64{&regs.Rax, &regs.Rbx, &regs.Rcx, &regs.Rdi, &regs.Rsi, &regs.R8, &regs.R9, &regs.R10, &regs.R11}
+	for i, x := range args.ints {
+		*intRegs[i] = x
+	}
+	if len(args.floats) == 0 {
+		return nil
+	}
+	var fp fpRegs
+	if err := s.ptraceGetFPRegs(tid, &fp); err != nil {
+		return fmt.Errorf("ptraceGetFPRegs: %v", err)
+	}
+	for i, x := range args.floats {
+		s.arch.FloatByteOrder.PutUint64(fp.xmm(i), x)
+	}
+	if err := s.ptraceSetFPRegs(tid, &fp); err != nil {
+		return fmt.Errorf("ptraceSetFPRegs: %v", err)
+	}
+	return nil
+}
+
+// callResult reads the result of a function call, of type t, from the
+// registers the register ABI returns it in.  The result is stored in the call
+// frame, so that it can be read like any value in memory.
+func (s *Server) callResult(tid int, regs *ptraceRegs, t dwarf.Type) (debug.Value, error) {
+	buf := make([]byte, 16)
+	switch followTypedefs(t).(type) {
+	case *dwarf.FloatType:
+		var fp fpRegs
+		if err := s.ptraceGetFPRegs(tid, &fp); err != nil {
+			return nil, fmt.Errorf("ptraceGetFPRegs: %v", err)
+		}
+		copy(buf, fp.xmm(0))
+	case *dwarf.StringType:
+		s.arch.ByteOrder.PutUint64(buf, regs.Rax)
+		s.arch.ByteOrder.PutUint64(buf[8:], regs.Rbx)
+	default:
+		s.arch.ByteOrder.PutUint64(buf, regs.Rax)
+	}
+	buf = buf[:t.Size()]
+	if err := s.ptracePoke(tid, uintptr(regs.Rsp), buf); err != nil {
+		return nil, fmt.Errorf("ptracePoke: %v", err)
+	}
+	return s.value(t, regs.Rsp)
+}
+
+// callString reads the string whose header is at addr, which debugCallV2
+// uses to say why a call can't be made.
+func (s *Server) callString(addr uint64) (string, error) {
+	ptr, err := s.peekPtr(addr)
+	if err != nil {
+		return "", err
+	}
+	n, err := s.peekPtr(addr + uint64(s.arch.PointerSize))
+	if err != nil {
+		return "", err
+	}
+	if n > 256 {
+		n = 256
+	}
+	buf := make([]byte, n)
+	if err := s.peekBytes(ptr, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// pokeUint64 writes x at addr in the stopped thread.
+func (s *Server) pokeUint64(addr, x uint64) error {
+	buf := make([]byte, 8)
+	s.arch.ByteOrder.PutUint64(buf, x)
+	if err := s.ptracePoke(s.stoppedPid, uintptr(addr), buf); err != nil {
+		return fmt.Errorf("ptracePoke: %v", err)
+	}
+	return nil
+}
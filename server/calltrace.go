@@ -0,0 +1,287 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Tracing calls of functions, with probes at their entry points and at the
+// addresses they return to.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/dwarf"
+	"golang.org/x/debug/server/protocol"
+)
+
+const (
+	maxTracedFunctions  = 1000 // Functions a Trace can match.
+	maxTracedCallDepth  = 1000 // Calls in progress kept for each goroutine.
+	maxQueuedCallEvents = 1024 // Events a client can have waiting before calls are dropped.
+)
+
+// callTracer holds the state of Trace: the functions whose calls are traced,
+// and the calls in progress.
+type callTracer struct {
+	entries map[uint64]string      // Names of the traced functions, keyed by entry point.
+	returns map[uint64]int         // Number of calls in progress returning to each address.
+	calls   map[int64][]tracedCall // Calls in progress, keyed by goroutine ID, outermost first.
+}
+
+// A tracedCall is a call in progress.
+type tracedCall struct {
+	event debug.CallEvent
+	ret   uint64 // The return address.
+	// depth is how far down the goroutine's stack the return address is.
+	// Unlike the stack pointer, it doesn't change when the stack is moved.
+	depth uint64
+}
+
+// probes reports whether there is a probe at pc.  It can be called on a nil
+// callTracer.
+func (t *callTracer) probes(pc uint64) bool {
+	if t == nil {
+		return false
+	}
+	_, entry := t.entries[pc]
+	return entry || t.returns[pc] > 0
+}
+
+func (s *Server) Trace(req *protocol.TraceRequest, resp *protocol.TraceResponse) error {
+	return s.call(s.breakpointc, req, resp)
+}
+
+func (s *Server) handleTrace(req *protocol.TraceRequest, resp *protocol.TraceResponse) error {
+	t := &callTracer{
+		entries: make(map[uint64]string),
+		returns: make(map[uint64]int),
+		calls:   make(map[int64][]tracedCall),
+	}
+	if req.Regexp != "" {
+		re, err := s.listingRegexp(req.Regexp)
+		if err != nil {
+			return err
+		}
+		names := s.dwarfData.LookupMatchingFunctions(re)
+		if len(names) > maxTracedFunctions {
+			return fmt.Errorf("%d functions match %q; at most %d can be traced", len(names), req.Regexp, maxTracedFunctions)
+		}
+		for _, name := range names {
+			pc, err := s.functionStartAddress(name)
+			if err != nil {
+				continue
+			}
+			t.entries[pc] = name
+			resp.Functions = append(resp.Functions, name)
+		}
+	}
+	var pcs []uint64
+	for pc := range t.entries {
+		pcs = append(pcs, pc)
+	}
+	if err := s.insertBreakpointPCs(pcs); err != nil {
+		return err
+	}
+	old := s.calls
+	s.calls = t
+	if old != nil {
+		return s.removeUnusedBreakpointPCs(old.probePCs())
+	}
+	return nil
+}
+
+// probePCs returns the addresses of t's probes.
+func (t *callTracer) probePCs() []uint64 {
+	var pcs []uint64
+	for pc := range t.entries {
+		pcs = append(pcs, pc)
+	}
+	for pc := range t.returns {
+		pcs = append(pcs, pc)
+	}
+	return pcs
+}
+
+// resolveCallProbes re-establishes the entry probes in a newly started
+// process, finding the traced functions again by name.  Functions that are
+// no longer in the executable stop being traced.  The previous process's
+// calls in progress are forgotten.
+func (s *Server) resolveCallProbes() error {
+	if s.calls == nil {
+		return nil
+	}
+	entries := make(map[uint64]string)
+	var pcs []uint64
+	for _, name := range s.calls.entries {
+		pc, err := s.functionStartAddress(name)
+		if err != nil {
+			debug.Log(debug.LevelWarn, "traced function not found", debug.Field{Key: "function", Value: name})
+			continue
+		}
+		entries[pc] = name
+		pcs = append(pcs, pc)
+	}
+	s.calls = &callTracer{
+		entries: entries,
+		returns: make(map[uint64]int),
+		calls:   make(map[int64][]tracedCall),
+	}
+	if err := s.insertBreakpointPCs(pcs); err != nil {
+		return fmt.Errorf("re-establishing call tracing: %v", err)
+	}
+	return nil
+}
+
+// callProbeHit records the start or end of a traced call at the probe at pc,
+// which the stopped thread has just reached.  Calls that can't be recorded
+// are skipped, since the program carries on regardless.
+func (s *Server) callProbeHit(pc uint64) {
+	t := s.calls
+	sp := s.stoppedRegs.Rsp
+	goid, depth := s.stoppedGoroutine(), s.stackDepth(sp)
+	// A call which ends at pc is the one made from the frame pc is in;
+	// those in progress below it were unwound by a panic.
+	if t.returns[pc] > 0 {
+		calls := t.calls[goid]
+		for i := len(calls) - 1; i >= 0; i-- {
+			if c := calls[i]; c.ret == pc && c.depth == depth+uint64(s.arch.PointerSize) {
+				c.event.Duration = time.Since(c.event.Start)
+				s.pushCallEvent(c.event)
+				s.endCalls(goid, i)
+				break
+			}
+		}
+	}
+	name, ok := t.entries[pc]
+	if !ok {
+		return
+	}
+	ret, err := s.peekPtr(sp)
+	if err != nil {
+		debug.Log(debug.LevelDebug, "reading return address of traced call", debug.Field{Key: "function", Value: name}, debug.Field{Key: "err", Value: err})
+		return
+	}
+	calls := t.calls[goid]
+	if n := len(calls); n > 0 && calls[n-1].ret == ret && calls[n-1].depth == depth && calls[n-1].event.Function == name {
+		// The function started again after growing its stack.
+		return
+	}
+	if err := s.insertBreakpointPCs([]uint64{ret}); err != nil {
+		debug.Log(debug.LevelDebug, "setting return probe of traced call", debug.Field{Key: "function", Value: name}, debug.Field{Key: "err", Value: err})
+		return
+	}
+	t.returns[ret]++
+	if len(calls) == maxTracedCallDepth {
+		// Make room by forgetting the outermost call, which is
+		// unlikely to return soon.
+		s.releaseReturnProbes([]uint64{calls[0].ret})
+		calls = calls[1:]
+	}
+	c := tracedCall{
+		event: debug.CallEvent{
+			Function:  name,
+			Args:      s.callArgs(pc, sp),
+			Goroutine: goid,
+			Thread:    s.stoppedPid,
+			Start:     time.Now(),
+		},
+		ret:   ret,
+		depth: depth,
+	}
+	t.calls[goid] = append(calls, c)
+}
+
+// endCalls forgets the calls in progress in the goroutine goid from the i'th
+// outermost inwards.
+func (s *Server) endCalls(goid int64, i int) {
+	calls := s.calls.calls[goid]
+	var rets []uint64
+	for _, c := range calls[i:] {
+		rets = append(rets, c.ret)
+	}
+	if i == 0 {
+		delete(s.calls.calls, goid)
+	} else {
+		s.calls.calls[goid] = calls[:i]
+	}
+	s.releaseReturnProbes(rets)
+}
+
+// releaseReturnProbes drops a use of each of the return probes at rets,
+// removing those no call in progress needs any more.
+func (s *Server) releaseReturnProbes(rets []uint64) {
+	t := s.calls
+	var unused []uint64
+	for _, ret := range rets {
+		if t.returns[ret]--; t.returns[ret] == 0 {
+			delete(t.returns, ret)
+			unused = append(unused, ret)
+		}
+	}
+	if err := s.removeUnusedBreakpointPCs(unused); err != nil {
+		debug.Log(debug.LevelDebug, "removing return probes", debug.Field{Key: "err", Value: err})
+	}
+}
+
+// callArgs returns the parameters of the function at whose entry point pc
+// the stopped thread is, with their formatted values.
+func (s *Server) callArgs(pc, sp uint64) []debug.Param {
+	frames, err := s.walkStack(pc, sp, 0, 1)
+	if err != nil || len(frames) == 0 {
+		return nil
+	}
+	s.describeParams(frames)
+	// The values of arguments in registers needn't be kept past this stop,
+	// which the client never sees.
+	s.composites = compositeMemory{}
+	// The function's frame follows those of any calls inlined into it.
+	args := frames[len(frames)-1].Params
+	for i := range args {
+		args[i].Var = debug.Var{}
+	}
+	return args
+}
+
+// stackDepth returns how far sp is below the top of the stopped goroutine's
+// stack, or if that can't be read, a value which decreases by as much as sp
+// increases.
+func (s *Server) stackDepth(sp uint64) uint64 {
+	g, err := s.currentG(&s.stoppedRegs)
+	if err != nil || g == 0 {
+		return -sp
+	}
+	hi, err := s.stackHi(g)
+	if err != nil {
+		return -sp
+	}
+	return hi - sp
+}
+
+// stackHi returns the address of the top of the stack of the goroutine g.
+func (s *Server) stackHi(g uint64) (uint64, error) {
+	gType, err := s.runtimeStruct("runtime.g")
+	if err != nil {
+		return 0, err
+	}
+	f, err := getField(gType, "stack")
+	if err != nil {
+		return 0, err
+	}
+	stackType, ok := followTypedefs(f.Type).(*dwarf.StructType)
+	if !ok {
+		return 0, errors.New("unexpected type for runtime.g's stack")
+	}
+	return s.peekUintStructField(stackType, g+uint64(f.ByteOffset), "hi")
+}
+
+// pushCallEvent delivers the event for a traced call that has returned to
+// every client whose queue has room for it.
+func (s *Server) pushCallEvent(c debug.CallEvent) {
+	e := debug.Event{Kind: "call", Call: &c}
+	if !s.clients.pushIfRoom(e, maxQueuedCallEvents) {
+		s.events.pushIfRoom(e, maxQueuedCallEvents)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Listing the goroutines blocked on a channel, from its queues of waiting
+// goroutines.
+
+package server
+
+import (
+	"fmt"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/dwarf"
+	"golang.org/x/debug/server/protocol"
+)
+
+// maxChannelWaiters limits how many of a channel's waiters are read, in case
+// a queue is corrupt.
+const maxChannelWaiters = 10000
+
+func (s *Server) ChannelWaiters(req *protocol.ChannelWaitersRequest, resp *protocol.ChannelWaitersResponse) error {
+	return s.call(s.otherc, req, resp)
+}
+
+func (s *Server) handleChannelWaiters(req *protocol.ChannelWaitersRequest, resp *protocol.ChannelWaitersResponse) error {
+	ch := req.Channel.Address
+	if ch == 0 {
+		// Goroutines blocked on a nil channel aren't queued anywhere.
+		return nil
+	}
+	hchan, err := s.runtimeStruct("runtime.hchan")
+	if err != nil {
+		return err
+	}
+	sudog, err := s.runtimeStruct("runtime.sudog")
+	if err != nil {
+		return err
+	}
+	gType, err := s.runtimeStruct("runtime.g")
+	if err != nil {
+		return err
+	}
+	s.goroutineStackOnce.Do(func() { s.goroutineStackInit(gType) })
+	for _, q := range []struct {
+		field string
+		send  bool
+	}{{"recvq", false}, {"sendq", true}} {
+		f, err := getField(hchan, q.field)
+		if err != nil {
+			return err
+		}
+		waitq, ok := followTypedefs(f.Type).(*dwarf.StructType)
+		if !ok {
+			return fmt.Errorf("channel field %s is not a struct", q.field)
+		}
+		sg, err := s.peekPtrStructField(waitq, ch+uint64(f.ByteOffset), "first")
+		for n := 0; err == nil && sg != 0 && n < maxChannelWaiters; n++ {
+			w, werr := s.channelWaiter(sudog, gType, sg)
+			if werr != nil {
+				return fmt.Errorf("reading %s: %v", q.field, werr)
+			}
+			w.Send = q.send
+			if w.Send {
+				w.Value = debug.Var{TypeID: req.Channel.ElementTypeID, Address: w.Value.Address}
+			} else {
+				w.Value = debug.Var{}
+			}
+			resp.Waiters = append(resp.Waiters, w)
+			sg, err = s.peekPtrStructField(sudog, sg, "next")
+		}
+		if err != nil {
+			return fmt.Errorf("reading %s: %v", q.field, err)
+		}
+	}
+	return nil
+}
+
+// channelWaiter describes the goroutine waiting in the sudog at sg.  The
+// address of the element it waits with is returned in Value.
+func (s *Server) channelWaiter(sudog, gType *dwarf.StructType, sg uint64) (debug.ChannelWaiter, error) {
+	var w debug.ChannelWaiter
+	g, err := s.peekPtrStructField(sudog, sg, "g")
+	if err != nil {
+		return w, err
+	}
+	id, err := s.peekUintOrIntStructField(gType, g, "goid")
+	if err != nil {
+		return w, err
+	}
+	w.Goroutine = int64(id)
+	if f, err := getField(sudog, "isSelect"); err == nil {
+		if b, err := s.peekUint(sg+uint64(f.ByteOffset), 1); err == nil {
+			w.Select = b != 0
+		}
+	}
+	if w.Value.Address, err = s.sudogElem(sudog, sg); err != nil {
+		return w, err
+	}
+	frames, _ := s.goroutineStack(g)
+	for _, f := range frames {
+		if f.Kind != "runtime" {
+			w.PC, w.Function, w.File, w.Line = f.PC, f.Function, f.File, f.Line
+			break
+		}
+	}
+	return w, nil
+}
+
+// sudogElem returns the elem field of the sudog at sg: for a channel, the
+// address of the element being sent or received; for a semaphore, the
+// semaphore's address.
+func (s *Server) sudogElem(sudog *dwarf.StructType, sg uint64) (uint64, error) {
+	// elem is a pointer, or in newer runtimes a struct holding it as a
+	// uintptr, vu.
+	f, err := getField(sudog, "elem")
+	if err != nil {
+		return 0, err
+	}
+	if st, ok := followTypedefs(f.Type).(*dwarf.StructType); ok {
+		return s.peekUintStructField(st, sg+uint64(f.ByteOffset), "vu")
+	}
+	return s.peekPtr(sg + uint64(f.ByteOffset))
+}
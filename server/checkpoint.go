@@ -0,0 +1,174 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Checkpoints: copies of the stopped process, made with fork, which the
+// process can later be returned to.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/server/protocol"
+)
+
+// maxCheckpoints is the number of checkpoints that can be kept at once, each
+// of which is a process.
+const maxCheckpoints = 16
+
+// A checkpoint is a stopped copy of the process.  It is left ready to exit,
+// should it ever be continued, and is itself copied to be restored.
+type checkpoint struct {
+	pid         int
+	regs        ptraceRegs            // The registers of the thread that stopped the process.
+	parkedRegs  ptraceRegs            // The registers the copy is left with.
+	loadBias    uint64                // The process's load bias.
+	breakpoints map[uint64]breakpoint // The breakpoint instructions in the copy's memory.
+	stopSignal  syscall.Signal        // The signal the process stopped for.
+}
+
+func (s *Server) Checkpoint(req *protocol.CheckpointRequest, resp *protocol.CheckpointResponse) error {
+	return s.call(s.controlc, req, resp)
+}
+
+func (s *Server) handleCheckpoint(req *protocol.CheckpointRequest, resp *protocol.CheckpointResponse) error {
+	if s.proc == nil || !s.procIsUp {
+		return errors.New("Checkpoint: no stopped process")
+	}
+	if len(s.checkpoints) >= maxCheckpoints {
+		return fmt.Errorf("Checkpoint: at most %d checkpoints can be kept", maxCheckpoints)
+	}
+	cp, err := s.newCheckpoint()
+	if err != nil {
+		return fmt.Errorf("Checkpoint: %v", err)
+	}
+	s.nextCheckpointID++
+	s.checkpoints[s.nextCheckpointID] = cp
+	resp.ID = s.nextCheckpointID
+	return nil
+}
+
+// newCheckpoint makes a checkpoint of the stopped process.
+func (s *Server) newCheckpoint() (*checkpoint, error) {
+	// The registers are read afresh, since they aren't loaded when the
+	// process has just started.
+	var regs ptraceRegs
+	if err := s.ptraceGetRegs(s.stoppedPid, &regs); err != nil {
+		return nil, fmt.Errorf("ptraceGetRegs: %v", err)
+	}
+	pid, err := s.forkProcess(s.stoppedPid, &regs)
+	if err != nil {
+		return nil, err
+	}
+	cp := &checkpoint{
+		pid:         pid,
+		regs:        regs,
+		parkedRegs:  regs,
+		loadBias:    s.loadBias,
+		breakpoints: make(map[uint64]breakpoint),
+		stopSignal:  s.stopSignal,
+	}
+	for pc, bp := range s.breakpoints {
+		cp.breakpoints[pc] = bp
+	}
+	// If the debugger goes away, the copy carries on by exiting.
+	s.parkCheckpoint(&cp.parkedRegs)
+	if err := s.ptraceSetRegs(pid, &cp.parkedRegs); err != nil {
+		s.killCheckpoint(pid)
+		return nil, fmt.Errorf("ptraceSetRegs: %v", err)
+	}
+	return cp, nil
+}
+
+func (s *Server) Restore(req *protocol.RestoreRequest, resp *protocol.RestoreResponse) error {
+	return s.call(s.controlc, req, resp)
+}
+
+func (s *Server) handleRestore(req *protocol.RestoreRequest, resp *protocol.RestoreResponse) error {
+	cp, ok := s.checkpoints[req.ID]
+	if !ok {
+		return fmt.Errorf("no checkpoint with ID %d", req.ID)
+	}
+	s.clearTimeline()
+	var err error
+	resp.Status, err = s.restoreCheckpoint(cp)
+	if err != nil {
+		return err
+	}
+	resp.Status.Reason = "restore"
+	s.recordStop(&resp.Status)
+	return nil
+}
+
+// restoreCheckpoint replaces the process with a new copy of the process
+// saved by cp, and returns its status.
+func (s *Server) restoreCheckpoint(cp *checkpoint) (debug.Status, error) {
+	// The checkpoint is copied, so that it can be restored again.
+	pid, err := s.forkProcess(cp.pid, &cp.parkedRegs)
+	if err != nil {
+		return debug.Status{}, err
+	}
+	if s.proc != nil {
+		if s.exited == nil {
+			if err := s.killProcess(); err != nil {
+				s.killCheckpoint(pid)
+				return debug.Status{}, err
+			}
+		}
+		s.resetProcess()
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		s.killCheckpoint(pid)
+		return debug.Status{}, err
+	}
+	s.proc = p
+	s.setLive(true)
+	s.procIsUp = true
+	s.stoppedPid = pid
+	s.stoppedRegs = cp.regs
+	s.stopSignal = cp.stopSignal
+	debug.Log(debug.LevelInfo, "process restored", debug.Field{Key: "pid", Value: pid}, debug.Field{Key: "checkpoint", Value: cp.pid})
+	if err := s.ptraceSetRegs(pid, &s.stoppedRegs); err != nil {
+		return debug.Status{}, fmt.Errorf("ptraceSetRegs: %v", err)
+	}
+	// The copy has the breakpoint instructions the process had when the
+	// checkpoint was made; replace them with the current breakpoints.
+	for pc, bp := range cp.breakpoints {
+		if err := s.ptracePoke(pid, uintptr(pc), bp.origInstr[:s.arch.BreakpointSize]); err != nil {
+			return debug.Status{}, fmt.Errorf("ptracePoke: %v", err)
+		}
+	}
+	s.loadBias = cp.loadBias
+	if _, err := s.resolveBreakpoints(); err != nil {
+		return debug.Status{}, err
+	}
+	s.recordHistories()
+	status := debug.Status{
+		PC:     s.stoppedRegs.Rip,
+		SP:     s.stoppedRegs.Rsp,
+		Thread: pid,
+	}
+	if s.stopSignal != 0 {
+		status.Signal = signalName(s.stopSignal)
+	}
+	return status, nil
+}
+
+func (s *Server) DeleteCheckpoint(req *protocol.DeleteCheckpointRequest, resp *protocol.DeleteCheckpointResponse) error {
+	return s.call(s.controlc, req, resp)
+}
+
+func (s *Server) handleDeleteCheckpoint(req *protocol.DeleteCheckpointRequest, resp *protocol.DeleteCheckpointResponse) error {
+	cp, ok := s.checkpoints[req.ID]
+	if !ok {
+		return fmt.Errorf("no checkpoint with ID %d", req.ID)
+	}
+	delete(s.checkpoints, req.ID)
+	return s.killCheckpoint(cp.pid)
+}
@@ -0,0 +1,151 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Copying the process with fork, to make checkpoints.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// syscallInstr is the x86 SYSCALL instruction.
+var syscallInstr = []byte{0x0f, 0x05}
+
+// parkCheckpoint sets regs, the registers of a checkpoint's copy of the
+// process, to call exit_group, at the system call instruction forkProcess
+// left at the scratch address.
+func (s *Server) parkCheckpoint(regs *ptraceRegs) {
+	regs.Rip = s.scratchPC
+	regs.Rax = syscall.SYS_EXIT_GROUP
+	regs.Rdi = 0
+	regs.Orig_rax = ^uint64(0)
+}
+
+// killCheckpoint kills the stopped copy pid of the process, and waits for it
+// to exit.
+func (s *Server) killCheckpoint(pid int) error {
+	if err := syscall.Kill(pid, syscall.SIGKILL); err != nil {
+		return err
+	}
+	for {
+		_, status, err := s.wait(pid, false)
+		if err != nil {
+			return fmt.Errorf("wait: %v", err)
+		}
+		if status.Exited() || status.Signaled() {
+			return nil
+		}
+	}
+}
+
+// forkProcess makes the stopped thread pid, whose registers are regs, call
+// fork, and returns the ID of the copy of its process.  Only the thread is
+// copied.  The copy is traced, and stopped where the call returned.  The
+// thread is left as it was, but for signals it received meanwhile, which are
+// sent to it again.
+func (s *Server) forkProcess(pid int, regs *ptraceRegs) (int, error) {
+	scratch, err := s.findScratch()
+	if err != nil {
+		return 0, err
+	}
+	code := append(append([]byte(nil), syscallInstr...), s.arch.BreakpointInstr[:s.arch.BreakpointSize]...)
+	if err := s.ptracePoke(pid, uintptr(scratch), code); err != nil {
+		return 0, fmt.Errorf("ptracePoke: %v", err)
+	}
+	if err := s.ptraceSetOptions(pid, syscall.PTRACE_O_TRACECLONE|syscall.PTRACE_O_TRACEFORK); err != nil {
+		return 0, fmt.Errorf("ptraceSetOptions: %v", err)
+	}
+	defer s.ptraceSetOptions(pid, syscall.PTRACE_O_TRACECLONE)
+	r := *regs
+	r.Rip = scratch
+	r.Rax = syscall.SYS_FORK
+	// Keep the kernel from restarting a system call the thread was in.
+	r.Orig_rax = ^uint64(0)
+	if err := s.ptraceSetRegs(pid, &r); err != nil {
+		return 0, fmt.Errorf("ptraceSetRegs: %v", err)
+	}
+	defer s.ptraceSetRegs(pid, regs)
+
+	child := 0
+	var signals []syscall.Signal
+	for {
+		if err := s.ptraceCont(pid, 0); err != nil {
+			return 0, fmt.Errorf("ptraceCont: %v", err)
+		}
+		_, status, err := s.wait(pid, false)
+		if err != nil {
+			return 0, fmt.Errorf("wait: %v", err)
+		}
+		if status.Exited() || status.Signaled() {
+			return 0, fmt.Errorf("thread %d exited", pid)
+		}
+		sig := status.StopSignal()
+		if sig != syscall.SIGTRAP {
+			// Not delivered now, since the thread isn't running its
+			// own code.  A SIGSTOP is the debugger's own.
+			if sig != sigstop {
+				signals = append(signals, sig)
+			}
+			continue
+		}
+		if status.TrapCause() == syscall.PTRACE_EVENT_FORK {
+			msg, err := s.ptraceGetEventMsg(pid)
+			if err != nil {
+				return 0, fmt.Errorf("ptraceGetEventMsg: %v", err)
+			}
+			child = int(msg)
+			continue
+		}
+		// At the breakpoint instruction after the call.
+		break
+	}
+	for _, sig := range signals {
+		syscall.Tgkill(s.tgid(pid), pid, sig)
+	}
+	var after ptraceRegs
+	if err := s.ptraceGetRegs(pid, &after); err != nil {
+		return 0, fmt.Errorf("ptraceGetRegs: %v", err)
+	}
+	if errno := -int64(after.Rax); errno > 0 && errno < 4096 {
+		return 0, fmt.Errorf("fork: %v", syscall.Errno(errno))
+	}
+	if child == 0 {
+		return 0, errors.New("fork: no new process reported")
+	}
+	// The new process starts with a SIGSTOP.
+	for {
+		_, status, err := s.wait(child, false)
+		if err != nil {
+			return 0, fmt.Errorf("wait: %v", err)
+		}
+		if status.Exited() || status.Signaled() {
+			return 0, fmt.Errorf("process %d exited", child)
+		}
+		if status.StopSignal() == sigstop {
+			break
+		}
+		if err := s.ptraceCont(child, 0); err != nil {
+			return 0, fmt.Errorf("ptraceCont: %v", err)
+		}
+	}
+	// The new process inherited the thread's options.
+	if err := s.ptraceSetOptions(child, syscall.PTRACE_O_TRACECLONE); err != nil {
+		s.killCheckpoint(child)
+		return 0, fmt.Errorf("ptraceSetOptions: %v", err)
+	}
+	return child, nil
+}
+
+// tgid returns the ID of the process whose thread is tid: the current
+// process, if tid is the thread that stopped it, or otherwise a checkpoint,
+// whose only thread has the process's ID.
+func (s *Server) tgid(tid int) int {
+	if tid == s.stoppedPid && s.proc != nil {
+		return s.proc.Pid
+	}
+	return tid
+}
@@ -0,0 +1,24 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+
+package server
+
+import "errors"
+
+// errNoFork is returned when making a checkpoint, which is a copy of the
+// process made by having it call fork, something only a Linux process can be
+// made to do.
+var errNoFork = errors.New("checkpoints can only be made of Linux processes")
+
+func (s *Server) parkCheckpoint(regs *ptraceRegs) {}
+
+func (s *Server) killCheckpoint(pid int) error {
+	return errNoFork
+}
+
+func (s *Server) forkProcess(pid int, regs *ptraceRegs) (int, error) {
+	return 0, errNoFork
+}
@@ -0,0 +1,85 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Commands run when the program reaches a breakpoint: expressions evaluated
+// there without a round trip to the client, and optionally continuing.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"go/parser"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/server/protocol"
+)
+
+// continueCommand, as a breakpoint's last command, makes the program carry on
+// after the others are run.
+const continueCommand = "continue"
+
+func (s *Server) SetBreakpointCommands(req *protocol.SetBreakpointCommandsRequest, resp *protocol.SetBreakpointCommandsResponse) error {
+	return s.call(s.breakpointc, req, resp)
+}
+
+func (s *Server) handleSetBreakpointCommands(req *protocol.SetBreakpointCommandsRequest, resp *protocol.SetBreakpointCommandsResponse) error {
+	bp, ok := s.userBreakpoints[req.ID]
+	if !ok {
+		return fmt.Errorf("no breakpoint with ID %d", req.ID)
+	}
+	for i, cmd := range req.Commands {
+		if cmd == continueCommand {
+			if i != len(req.Commands)-1 {
+				return errors.New(`"continue" must be the last command`)
+			}
+			continue
+		}
+		if _, err := parser.ParseExpr(cmd); err != nil {
+			return &debug.ExpressionError{Expression: cmd, Kind: "parse", Reason: err.Error()}
+		}
+	}
+	bp.Commands = nil
+	if len(req.Commands) > 0 {
+		bp.Commands = append([]string(nil), req.Commands...)
+	}
+	return nil
+}
+
+// runBreakpointCommands runs the commands of bp, which the stopped thread has
+// just reached, and reports whether the program should carry on.  If so the
+// results are delivered as an event, and otherwise they are kept for the
+// status with which the program stops.  Failures to evaluate an expression
+// are recorded in its sample.
+func (s *Server) runBreakpointCommands(bp *debug.Breakpoint) bool {
+	pc, sp := s.stoppedRegs.Rip, s.stoppedRegs.Rsp
+	r := debug.CommandResults{
+		Breakpoint: bp.ID,
+		Goroutine:  s.stoppedGoroutine(),
+		Thread:     s.stoppedPid,
+		PC:         pc,
+	}
+	cont := false
+	for _, cmd := range bp.Commands {
+		if cmd == continueCommand {
+			cont = true
+			break
+		}
+		v, t, err := s.snapshotExpression(cmd, pc, sp)
+		sample := debug.Sample{Expression: cmd, Value: v, Type: t}
+		if err != nil {
+			sample.Err = err.Error()
+		}
+		r.Values = append(r.Values, sample)
+	}
+	if !cont {
+		s.commandResults = append(s.commandResults, r)
+		return false
+	}
+	e := debug.Event{Kind: "commands", Commands: &r}
+	if !s.clients.pushIfRoom(e, maxQueuedCallEvents) {
+		s.events.pushIfRoom(e, maxQueuedCallEvents)
+	}
+	return true
+}
@@ -0,0 +1,146 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Breakpoints that only stop the program when reached from a given function.
+
+package server
+
+import (
+	"fmt"
+	"sort"
+
+	"golang.org/x/debug/server/protocol"
+)
+
+// maxCallerDepth limits how many frames are unwound when checking whether a
+// breakpoint was reached from the function it is conditioned on.
+const maxCallerDepth = 1000
+
+func (s *Server) SetBreakpointCaller(req *protocol.SetBreakpointCallerRequest, resp *protocol.SetBreakpointCallerResponse) error {
+	return s.call(s.breakpointc, req, resp)
+}
+
+func (s *Server) handleSetBreakpointCaller(req *protocol.SetBreakpointCallerRequest, resp *protocol.SetBreakpointCallerResponse) error {
+	bp, ok := s.userBreakpoints[req.ID]
+	if !ok {
+		return fmt.Errorf("no breakpoint with ID %d", req.ID)
+	}
+	if req.Function == "" {
+		delete(s.callerEntries, req.ID)
+		bp.CalledFrom = ""
+		return nil
+	}
+	pc, err := s.functionStartAddress(req.Function)
+	if err != nil {
+		return err
+	}
+	s.callerEntries[req.ID] = pc
+	bp.CalledFrom = req.Function
+	return nil
+}
+
+// breakpointHit records a hit on each enabled breakpoint at pc whose caller
+// condition is met, and reports whether there was one other than a
+// recording breakpoint, tracepoint or breakpoint whose commands continue,
+// which means the program should stop, adding the IDs of those that stop it
+// to s.hitBreakpoints.  Recording breakpoints and
+// tracepoints that are hit record a snapshot or an event instead, breakpoints
+// with commands run them, and one-shot breakpoints that are hit are deleted.  A probe
+// for tracing calls at pc records the call's start or end, and the load stop
+// looks for pending breakpoints in the shared objects loaded.
+func (s *Server) breakpointHit(pc uint64) (bool, error) {
+	if s.calls.probes(pc) {
+		s.callProbeHit(pc)
+	}
+	if pc == s.loadStop {
+		if err := s.loadStopHit(); err != nil {
+			return false, err
+		}
+	}
+	hit := false
+	var oneShots []uint64
+	for id, bp := range s.userBreakpoints {
+		if !bp.Enabled || !hasPC(bp.PCs, pc) {
+			continue
+		}
+		if entry, ok := s.callerEntries[id]; ok {
+			called, err := s.calledFrom(entry)
+			if err != nil {
+				return false, err
+			}
+			if !called {
+				continue
+			}
+		}
+		bp.HitCount++
+		if bp.OneShot {
+			oneShots = append(oneShots, id)
+		}
+		if bp.Record {
+			s.recordSnapshot(bp)
+		}
+		if bp.Trace {
+			s.recordTraceEvent(bp)
+		}
+		if bp.Record || bp.Trace {
+			continue
+		}
+		if len(bp.Commands) > 0 && s.runBreakpointCommands(bp) {
+			continue
+		}
+		hit = true
+		s.hitBreakpoints = append(s.hitBreakpoints, id)
+	}
+	sort.Slice(s.hitBreakpoints, func(i, j int) bool { return s.hitBreakpoints[i] < s.hitBreakpoints[j] })
+	sort.Slice(s.commandResults, func(i, j int) bool {
+		return s.commandResults[i].Breakpoint < s.commandResults[j].Breakpoint
+	})
+	if err := s.deleteBreakpoints(oneShots); err != nil {
+		return false, err
+	}
+	return hit, nil
+}
+
+// calledFrom reports whether the function starting at entry is a direct or
+// indirect caller of the stopped thread's current function.
+func (s *Server) calledFrom(entry uint64) (bool, error) {
+	var buf [8]byte
+	pc, sp := s.stoppedRegs.Rip, s.stoppedRegs.Rsp
+	for depth := 0; depth < maxCallerDepth; depth++ {
+		_, funcEntry, err := s.pcToFunctionName(pc)
+		if err != nil {
+			if depth > 0 {
+				// Unwound past the outermost function with debug information.
+				break
+			}
+			return false, fmt.Errorf("checking caller at %#x: %v", pc, err)
+		}
+		if depth > 0 && funcEntry == entry {
+			return true, nil
+		}
+		if s.topOfStack(funcEntry) {
+			break
+		}
+		fpOffset, err := s.pcToSPOffset(pc)
+		if err != nil {
+			return false, fmt.Errorf("checking caller at %#x: %v", pc, err)
+		}
+		fp := sp + uint64(fpOffset)
+		if err := s.ptracePeek(s.stoppedPid, uintptr(fp-uint64(s.arch.PointerSize)), buf[:s.arch.PointerSize]); err != nil {
+			return false, fmt.Errorf("ptracePeek: %v", err)
+		}
+		pc, sp = s.arch.Uintptr(buf[:s.arch.PointerSize]), fp
+	}
+	return false, nil
+}
+
+// hasPC reports whether pcs contains pc.
+func hasPC(pcs []uint64, pc uint64) bool {
+	for _, p := range pcs {
+		if p == pc {
+			return true
+		}
+	}
+	return false
+}
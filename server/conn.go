@@ -0,0 +1,318 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Serving clients over connections, one controlling the process and others
+// observing it.
+
+package server
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"io"
+	"net/rpc"
+	"strings"
+	"sync"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/server/protocol"
+)
+
+// errConnClosed is returned to calls waiting for events on a connection that
+// has closed.
+var errConnClosed = errors.New("connection closed")
+
+// observerMethods are the methods an observer can call: those which don't
+// change the process or the server's state.  Evaluate isn't one, since the
+// expression can call the program's functions.
+var observerMethods = map[string]bool{
+	"AsPointer":       true,
+	"Batch":           true,
+	"BinaryInfo":      true,
+	"ChannelWaiters":  true,
+	"DebugManifest":   true,
+	"DeferredCalls":   true,
+	"Eval":            true,
+	"FindReferences":  true,
+	"FindString":      true,
+	"Frames":          true,
+	"Functions":       true,
+	"Goroutines":      true,
+	"Handshake":       true,
+	"HeapDump":        true,
+	"HeapStats":       true,
+	"History":         true,
+	"ListBreakpoints": true,
+	"LocalVariables":  true,
+	"MapElement":      true,
+	"MapElements":     true,
+	"NextEvent":       true,
+	"PanicInfo":       true,
+	"Ping":            true,
+	"ReadMemory":      true,
+	"RuntimeStatus":   true,
+	"Sample":          true,
+	"SharedObjects":   true,
+	"Snapshots":       true,
+	"TraceEvents":     true,
+	"Source":          true,
+	"Sources":         true,
+	"Threads":         true,
+	"Type":            true,
+	"Types":           true,
+	"Value":           true,
+	"ValueTree":       true,
+	"VarByName":       true,
+}
+
+// ServeConn serves the client at the other end of conn, as net/rpc's
+// ServeConn would serve the Server registered with it, until the client
+// disconnects.  Any number of clients can be served at once.
+//
+// If observer is true, the client can only make calls which observe the
+// process, such as reading values, and not control it, so that others can
+// watch while one client debugs the process.  Its other calls fail.
+//
+// Each client served by ServeConn receives all the events, with NextEvent.
+// Observers also receive an event when the process stops or exits after a
+// request which made it run.
+func (s *Server) ServeConn(conn io.ReadWriteCloser, observer bool) {
+	buf := bufio.NewWriter(conn)
+	s.serveCodec(&gobCodec{
+		rwc:    conn,
+		dec:    gob.NewDecoder(conn),
+		enc:    gob.NewEncoder(buf),
+		encBuf: buf,
+	}, observer)
+}
+
+// serveCodec serves a client, as ServeConn does, with requests and responses
+// encoded by codec.
+func (s *Server) serveCodec(codec rpc.ServerCodec, observer bool) {
+	s.clients.rpcOnce.Do(func() {
+		s.clients.rpc = rpc.NewServer()
+		if err := s.clients.rpc.RegisterName("Server", s); err != nil {
+			// Server's methods are fixed, so this can't happen.
+			panic(err)
+		}
+	})
+	s.clients.rpc.ServeCodec(&serverCodec{
+		codec:    codec,
+		s:        s,
+		observer: observer,
+		client:   s.clients.add(observer),
+	})
+}
+
+// reportStop tells observers what happened to the process after a request
+// which made it run, as given by the request's response and error, since only
+// the client which made the request gets the response.
+func (s *Server) reportStop(resp interface{}, err error) {
+	var status debug.Status
+	switch resp := resp.(type) {
+	case *protocol.ResumeResponse:
+		status = resp.Status
+	case *protocol.StepInstructionResponse:
+		status = resp.Status
+	case *protocol.RunToLineResponse:
+		status = resp.Status
+	default:
+		return
+	}
+	if s.clients.hasObservers() {
+		s.clients.push(s.processEvent(status, err), true)
+	}
+}
+
+// clientSet holds the event queues of the connections served by ServeConn.
+type clientSet struct {
+	rpcOnce sync.Once
+	rpc     *rpc.Server
+
+	mu     sync.Mutex
+	queues map[uint64]*clientQueue // Keyed by client ID.
+	nextID uint64
+}
+
+type clientQueue struct {
+	*eventQueue
+	observer bool
+}
+
+// add adds a client, and returns its ID.
+func (cs *clientSet) add(observer bool) uint64 {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.nextID++
+	cs.queues[cs.nextID] = &clientQueue{newEventQueue(), observer}
+	return cs.nextID
+}
+
+// remove removes a client, and wakes its calls waiting for events.
+func (cs *clientSet) remove(id uint64) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if q := cs.queues[id]; q != nil {
+		q.close()
+		delete(cs.queues, id)
+	}
+}
+
+// queue returns the event queue of a client, or nil if it has disconnected.
+func (cs *clientSet) queue(id uint64) *eventQueue {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if q := cs.queues[id]; q != nil {
+		return q.eventQueue
+	}
+	return nil
+}
+
+// hasObservers reports whether any of the clients are observers.
+func (cs *clientSet) hasObservers() bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	for _, q := range cs.queues {
+		if q.observer {
+			return true
+		}
+	}
+	return false
+}
+
+// push adds an event to the queues of the clients, or if observersOnly is
+// true, of the observers.  It reports whether there were any clients.
+func (cs *clientSet) push(e debug.Event, observersOnly bool) bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	for _, q := range cs.queues {
+		if q.observer || !observersOnly {
+			q.push(e)
+		}
+	}
+	return len(cs.queues) > 0
+}
+
+// pushIfRoom adds an event to the queues of the clients which hold fewer than
+// limit events.  It reports whether there were any clients.
+func (cs *clientSet) pushIfRoom(e debug.Event, limit int) bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	for _, q := range cs.queues {
+		q.pushIfRoom(e, limit)
+	}
+	return len(cs.queues) > 0
+}
+
+// serverCodec wraps the codec for a client's connection.  It refuses an
+// observer's calls of methods it can't call, and tells the server which client
+// calls come from.
+type serverCodec struct {
+	codec    rpc.ServerCodec
+	s        *Server
+	observer bool
+	client   uint64
+
+	mu sync.Mutex // Serializes responses from the rpc.Server and refusals.
+}
+
+func (c *serverCodec) ReadRequestHeader(r *rpc.Request) error {
+	for {
+		if err := c.codec.ReadRequestHeader(r); err != nil {
+			// The client has gone; stop waiting for its events, so that
+			// the rpc.Server can finish its calls.
+			c.s.clients.remove(c.client)
+			return err
+		}
+		method := strings.TrimPrefix(r.ServiceMethod, "Server.")
+		if !c.observer || observerMethods[method] {
+			return nil
+		}
+		// Refuse the call, discarding its request.
+		if err := c.codec.ReadRequestBody(nil); err != nil {
+			c.s.clients.remove(c.client)
+			return err
+		}
+		resp := &rpc.Response{
+			ServiceMethod: r.ServiceMethod,
+			Seq:           r.Seq,
+			Error:         "an observer can't call " + method + "; only the controlling client can",
+		}
+		if err := c.WriteResponse(resp, struct{}{}); err != nil {
+			c.s.clients.remove(c.client)
+			return err
+		}
+	}
+}
+
+func (c *serverCodec) ReadRequestBody(body interface{}) error {
+	if err := c.codec.ReadRequestBody(body); err != nil {
+		return err
+	}
+	switch req := body.(type) {
+	case *protocol.NextEventRequest:
+		req.Client = c.client
+	case *protocol.HandshakeRequest:
+		req.Observer = c.observer
+	}
+	return nil
+}
+
+func (c *serverCodec) WriteResponse(r *rpc.Response, body interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.codec.WriteResponse(r, body)
+}
+
+func (c *serverCodec) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.codec.Close()
+}
+
+// gobCodec is like net/rpc's gob codec, which isn't exported.  Its responses
+// and Close are serialized by serverCodec.
+type gobCodec struct {
+	rwc    io.ReadWriteCloser
+	dec    *gob.Decoder
+	enc    *gob.Encoder
+	encBuf *bufio.Writer
+	closed bool
+}
+
+func (c *gobCodec) ReadRequestHeader(r *rpc.Request) error {
+	return c.dec.Decode(r)
+}
+
+func (c *gobCodec) ReadRequestBody(body interface{}) error {
+	// A nil body discards the request.
+	return c.dec.Decode(body)
+}
+
+func (c *gobCodec) WriteResponse(r *rpc.Response, body interface{}) error {
+	if err := c.enc.Encode(r); err != nil {
+		if c.encBuf.Flush() == nil {
+			// The response couldn't be encoded; the connection's
+			// stream is corrupt, so close it.
+			c.Close()
+		}
+		return err
+	}
+	if err := c.enc.Encode(body); err != nil {
+		if c.encBuf.Flush() == nil {
+			c.Close()
+		}
+		return err
+	}
+	return c.encBuf.Flush()
+}
+
+func (c *gobCodec) Close() error {
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	return c.rwc.Close()
+}
@@ -0,0 +1,139 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Breakpoints for C code: finding C functions, which may have no debugging
+// information, by their symbols in the executable and the shared objects the
+// process has loaded, and trapping calls between Go and C.
+
+package server
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/debug/elf"
+	"golang.org/x/debug/server/protocol"
+)
+
+func (s *Server) BreakpointAtCgoCalls(req *protocol.BreakpointAtCgoCallsRequest, resp *protocol.BreakpointResponse) error {
+	return s.call(s.breakpointc, req, resp)
+}
+
+// handleBreakpointAtCgoCalls sets breakpoints at the runtime functions that
+// every call from Go to C, and from C back to Go, goes through.
+func (s *Server) handleBreakpointAtCgoCalls(req *protocol.BreakpointAtCgoCallsRequest, resp *protocol.BreakpointResponse) error {
+	return s.addBreakpoint(breakpointSpec{kind: "cgo"}, resp)
+}
+
+// cgoCallPCs returns the addresses of the runtime functions that calls
+// between Go and C go through.
+func (s *Server) cgoCallPCs() ([]uint64, error) {
+	pc, err := s.functionStartAddress("runtime.cgocall")
+	if err != nil {
+		return nil, fmt.Errorf("the program makes no cgo calls")
+	}
+	pcs := []uint64{pc}
+	// Programs without callbacks from C may not have the function for them.
+	if pc, err := s.functionStartAddress("runtime.cgocallbackg"); err == nil {
+		pcs = append(pcs, pc)
+	}
+	return pcs, nil
+}
+
+// cFunctionAddress returns the address of the C function with the given
+// name, from the symbol tables of the executable or, if the process is
+// running, the shared objects it has loaded.  Those the dynamic linker
+// loads at startup are only found once it has done so, which is before the
+// Go runtime starts.
+func (s *Server) cFunctionAddress(name string) (uint64, error) {
+	if addr, ok := elfFunctionAddress(s.executable, name); ok {
+		return addr + s.loadBias, nil
+	}
+	if s.proc == nil || s.exited != nil {
+		return 0, fmt.Errorf("no C function %q in the executable", name)
+	}
+	objs, err := s.sharedObjects()
+	if err != nil {
+		return 0, err
+	}
+	for _, obj := range objs {
+		if addr, ok := elfFunctionAddress(obj.path, name); ok {
+			return obj.base + addr, nil
+		}
+	}
+	return 0, fmt.Errorf("no C function %q in the executable or its shared objects", name)
+}
+
+// elfFunctionAddress returns the value of the function symbol with the given
+// name in the ELF file at path, looking in its dynamic symbol table and its
+// full one, if it has one.
+func elfFunctionAddress(path, name string) (uint64, bool) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+	for _, symbols := range []func() ([]elf.Symbol, error){f.DynamicSymbols, f.Symbols} {
+		syms, err := symbols()
+		if err != nil {
+			continue
+		}
+		for _, sym := range syms {
+			if sym.Name == name && elf.ST_TYPE(sym.Info) == elf.STT_FUNC && sym.Section != elf.SHN_UNDEF {
+				return sym.Value, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// sharedObject is a shared object loaded into the process.
+type sharedObject struct {
+	path string
+	base uint64 // What to add to the addresses in the file.
+}
+
+// sharedObjects returns the shared objects loaded into the process, other
+// than the executable, in the order they are mapped.
+func (s *Server) sharedObjects() ([]sharedObject, error) {
+	regions, err := memoryRegions(s.proc.Pid)
+	if err != nil {
+		return nil, err
+	}
+	var objs []sharedObject
+	seen := make(map[string]bool)
+	for _, r := range regions {
+		if !strings.HasPrefix(r.path, "/") || r.offset != 0 {
+			continue
+		}
+		if seen[r.path] || r.path == s.executable {
+			continue
+		}
+		seen[r.path] = true
+		// The mapping at offset 0 holds the first loadable segment.
+		base, ok := elfLoadBase(r.path, r.start)
+		if !ok {
+			continue
+		}
+		objs = append(objs, sharedObject{r.path, base})
+	}
+	return objs, nil
+}
+
+// elfLoadBase returns the base address of the ELF file at path, given the
+// address its first loadable segment is mapped at, which is page-aligned.
+func elfLoadBase(path string, start uint64) (uint64, bool) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+	for _, prog := range f.Progs {
+		if prog.Type == elf.PT_LOAD {
+			return start - (prog.Vaddr &^ uint64(os.Getpagesize()-1)), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,156 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Reading the DWARF data of an executable from a separate debug file, as
+// distributions package it, found by the executable's build ID or its
+// .gnu_debuglink section.
+
+package server
+
+import (
+	"bytes"
+	"encoding/hex"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/dwarf"
+	"golang.org/x/debug/elf"
+)
+
+// DebugFileDirectory is the global directory for separate debug files, like
+// GDB's debug-file-directory.  Debug files are looked for under it by build
+// ID, in .build-id/xx/yyyy.debug, and by the name in the executable's
+// .gnu_debuglink section, in the subdirectory mirroring the executable's own
+// directory.
+var DebugFileDirectory = "/usr/lib/debug"
+
+// ntGNUBuildID is the type of the ELF note holding a GNU build ID.
+const ntGNUBuildID = 3
+
+// separateDWARF returns the DWARF data for the ELF executable obj, named
+// executable, from its separate debug file, or nil if it has none.  The
+// candidates are tried in the same order as GDB: by build ID, then by debug
+// link next to the executable, in its .debug subdirectory, and under
+// DebugFileDirectory.  A debug link's file is only used if its checksum
+// matches.
+func separateDWARF(executable string, obj *elf.File) (*dwarf.Data, error) {
+	type candidate struct {
+		path     string
+		checkCRC bool
+	}
+	var candidates []candidate
+	if id := buildID(obj); len(id) > 2 {
+		candidates = append(candidates, candidate{filepath.Join(DebugFileDirectory, ".build-id", id[:2], id[2:]+".debug"), false})
+	}
+	link, crc, hasLink := debugLink(obj)
+	if hasLink {
+		dir := filepath.Dir(executable)
+		if abs, err := filepath.Abs(dir); err == nil {
+			dir = abs
+		}
+		candidates = append(candidates,
+			candidate{filepath.Join(dir, link), true},
+			candidate{filepath.Join(dir, ".debug", link), true},
+			candidate{filepath.Join(DebugFileDirectory, dir, link), true})
+	}
+	for _, c := range candidates {
+		d, err := readDebugFile(c.path, c.checkCRC, crc)
+		if err != nil {
+			return nil, err
+		}
+		if d != nil {
+			debug.Log(debug.LevelInfo, "read separate debug file", debug.Field{Key: "path", Value: c.path})
+			return d, nil
+		}
+	}
+	return nil, nil
+}
+
+// readDebugFile returns the DWARF data in the debug file at path, or nil if
+// there is no such file, it has no DWARF data, or checkCRC is set and its
+// checksum isn't crc.
+func readDebugFile(path string, checkCRC bool, crc uint32) (*dwarf.Data, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil
+	}
+	defer f.Close()
+	if checkCRC {
+		h := crc32.NewIEEE()
+		if _, err := io.Copy(h, f); err != nil {
+			return nil, err
+		}
+		if h.Sum32() != crc {
+			debug.Log(debug.LevelWarn, "debug file checksum mismatch", debug.Field{Key: "path", Value: path})
+			return nil, nil
+		}
+	}
+	obj, err := elf.NewFile(f)
+	if err != nil || !hasDWARF(obj) {
+		return nil, nil
+	}
+	return obj.DWARF()
+}
+
+// hasDWARF reports whether the ELF file obj has DWARF data of its own,
+// compressed or not.
+func hasDWARF(obj *elf.File) bool {
+	return obj.Section(".debug_info") != nil || obj.Section(".zdebug_info") != nil
+}
+
+// buildID returns the GNU build ID of obj in hexadecimal, or "" if it has
+// none.
+func buildID(obj *elf.File) string {
+	sect := obj.Section(".note.gnu.build-id")
+	if sect == nil {
+		return ""
+	}
+	b, err := sect.Data()
+	if err != nil {
+		return ""
+	}
+	// Each note is a name size, a description size and a type, followed by
+	// the name and the description, both padded to four bytes.
+	align := func(n uint32) uint32 { return (n + 3) &^ 3 }
+	for len(b) >= 12 {
+		namesz, descsz, typ := obj.ByteOrder.Uint32(b), obj.ByteOrder.Uint32(b[4:]), obj.ByteOrder.Uint32(b[8:])
+		b = b[12:]
+		if uint64(align(namesz))+uint64(align(descsz)) > uint64(len(b)) {
+			return ""
+		}
+		name, desc := b[:namesz], b[align(namesz):align(namesz)+descsz]
+		if typ == ntGNUBuildID && string(name) == "GNU\x00" {
+			return hex.EncodeToString(desc)
+		}
+		b = b[align(namesz)+align(descsz):]
+	}
+	return ""
+}
+
+// debugLink returns the file name and CRC-32 checksum of the debug file
+// named in obj's .gnu_debuglink section.
+func debugLink(obj *elf.File) (name string, crc uint32, ok bool) {
+	sect := obj.Section(".gnu_debuglink")
+	if sect == nil {
+		return "", 0, false
+	}
+	b, err := sect.Data()
+	if err != nil {
+		return "", 0, false
+	}
+	// The name is NUL-terminated and padded to four bytes, and followed
+	// by the checksum.
+	i := bytes.IndexByte(b, 0)
+	if i <= 0 {
+		return "", 0, false
+	}
+	off := (i + 4) &^ 3
+	if off+4 > len(b) {
+		return "", 0, false
+	}
+	return filepath.Base(string(b[:i])), obj.ByteOrder.Uint32(b[off:]), true
+}
@@ -0,0 +1,130 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// testBuildID is the build ID given to the executables TestSeparateDWARF
+// builds.
+const testBuildID = "0123456789abcdef0123456789abcdef01234567"
+
+// command runs a command, failing the test if it fails.
+func command(t *testing.T, name string, args ...string) {
+	cmd := exec.Command(name, args...)
+	cmd.Env = append(os.Environ(), "GO111MODULE=off")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%s %v: %v\n%s", name, args, err, out)
+	}
+}
+
+func TestSeparateDWARF(t *testing.T) {
+	for _, name := range []string{"go", "objcopy"} {
+		if _, err := exec.LookPath(name); err != nil {
+			t.Skipf("%s command not found", name)
+		}
+	}
+	dir, err := ioutil.TempDir("", "debugfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(d string) { DebugFileDirectory = d }(DebugFileDirectory)
+	DebugFileDirectory = filepath.Join(dir, "debug")
+
+	// An executable, and its DWARF data in a separate file.
+	src := filepath.Join(dir, "main.go")
+	if err := ioutil.WriteFile(src, []byte(jsonTestProgram), 0644); err != nil {
+		t.Fatal(err)
+	}
+	full := filepath.Join(dir, "full")
+	command(t, "go", "build", "-o", full, "-ldflags=-compressdwarf=false -B 0x"+testBuildID, src)
+	debugFile := filepath.Join(dir, "prog.debug")
+	command(t, "objcopy", "--only-keep-debug", full, debugFile)
+	debugData, err := ioutil.ReadFile(debugFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(debugFile)
+
+	tests := []struct {
+		name      string
+		link      bool   // Whether the executable has a debug link to prog.debug.
+		debugPath string // Where the debug file is put, relative to dir.
+		corrupt   bool   // Whether the debug file's contents are changed after linking.
+		found     bool
+	}{
+		{name: "by build ID", debugPath: "debug/.build-id/01/23456789abcdef0123456789abcdef01234567.debug", found: true},
+		{name: "by debug link", link: true, debugPath: "prog.debug", found: true},
+		{name: "by debug link in .debug", link: true, debugPath: ".debug/prog.debug", found: true},
+		{name: "by debug link in the debug directory", link: true, debugPath: filepath.Join("debug", dir, "prog.debug"), found: true},
+		{name: "checksum mismatch", link: true, debugPath: "prog.debug", corrupt: true},
+		{name: "no debug file", link: true},
+	}
+	for _, tt := range tests {
+		var paths []string
+		if tt.link {
+			// objcopy computes the link's checksum from the file.
+			if err := ioutil.WriteFile(debugFile, debugData, 0644); err != nil {
+				t.Fatal(err)
+			}
+			paths = append(paths, debugFile)
+		}
+		exe := filepath.Join(dir, "prog")
+		args := []string{"--strip-debug"}
+		if tt.link {
+			// Without its build ID, only the link can find the file.
+			args = append(args, "--remove-section=.note.gnu.build-id", "--add-gnu-debuglink="+debugFile)
+		}
+		command(t, "objcopy", append(args, full, exe)...)
+		os.Remove(debugFile)
+		if tt.debugPath != "" {
+			path := filepath.Join(dir, tt.debugPath)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			data := debugData
+			if tt.corrupt {
+				data = append(append([]byte(nil), debugData...), 0)
+			}
+			if err := ioutil.WriteFile(path, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			paths = append(paths, path)
+		}
+
+		f, err := os.Open(exe)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, d, err := loadExecutable(f)
+		f.Close()
+		for _, p := range paths {
+			os.Remove(p)
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !tt.found {
+			if d != nil {
+				t.Errorf("%s: got DWARF data, want none", tt.name)
+			}
+			continue
+		}
+		if d == nil {
+			t.Errorf("%s: got no DWARF data", tt.name)
+			continue
+		}
+		if _, err := d.LookupFunction("main.main"); err != nil {
+			t.Errorf("%s: looking up main.main: %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Listing a goroutine's pending deferred calls, from the runtime's chain of
+// _defer records.
+
+package server
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/dwarf"
+	"golang.org/x/debug/server/protocol"
+)
+
+// maxScannedCode limits how much of a function's code is read to find the
+// functions it calls.
+const maxScannedCode = 1 << 16
+
+func (s *Server) DeferredCalls(req *protocol.DeferredCallsRequest, resp *protocol.DeferredCallsResponse) error {
+	return s.call(s.otherc, req, resp)
+}
+
+func (s *Server) handleDeferredCalls(req *protocol.DeferredCallsRequest, resp *protocol.DeferredCallsResponse) error {
+	stopped := req.Goroutine == 0 || req.Goroutine == s.stoppedGoroutine()
+	var (
+		gType *dwarf.StructType
+		g     uint64
+		err   error
+	)
+	if stopped {
+		if g, err = s.currentG(&s.stoppedRegs); err == nil {
+			gType, err = s.runtimeStruct("runtime.g")
+		}
+	} else {
+		gType, g, err = s.findGoroutine(req.Goroutine)
+	}
+	if err != nil {
+		return err
+	}
+	if g == 0 {
+		return errors.New("the stopped thread isn't running a goroutine")
+	}
+	calls, err := s.deferredCalls(gType, g)
+	if err != nil {
+		return err
+	}
+	if req.FrameIndex < 0 {
+		resp.Calls = calls
+		return nil
+	}
+	var frames []debug.Frame
+	if stopped {
+		frames, err = s.walkStack(s.stoppedRegs.Rip, s.stoppedRegs.Rsp, s.stoppedRegs.Rbp, req.FrameIndex+1)
+	} else {
+		if status, err := s.goroutineStatus(gType, g); err == nil && status == 2 {
+			// _Grunning.
+			return fmt.Errorf("goroutine %d is running on another thread", req.Goroutine)
+		}
+		frames, err = s.goroutineStack(g)
+	}
+	if req.FrameIndex >= len(frames) {
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("frame %d not found", req.FrameIndex)
+	}
+	// A frame's defers record the stack pointer it had when it deferred
+	// them, which is the same throughout its body.
+	sp := frames[req.FrameIndex].SP
+	for _, c := range calls {
+		if c.SP == sp {
+			resp.Calls = append(resp.Calls, c)
+		}
+	}
+	return nil
+}
+
+// deferredCalls returns the deferred calls pending in the goroutine g, in the
+// order they will run.
+func (s *Server) deferredCalls(gType *dwarf.StructType, g uint64) ([]debug.DeferredCall, error) {
+	dType, err := s.runtimeStruct("runtime._defer")
+	if err != nil {
+		return nil, err
+	}
+	fn, err := getField(dType, "fn")
+	if err != nil {
+		return nil, err
+	}
+	var calls []debug.DeferredCall
+	d, err := s.peekPtrStructField(gType, g, "_defer")
+	for ; err == nil && d != 0 && len(calls) < maxPanicChain; d, err = s.peekPtrStructField(dType, d, "link") {
+		var c debug.DeferredCall
+		if c.SP, err = s.peekUintStructField(dType, d, "sp"); err != nil {
+			return nil, err
+		}
+		// pc is where the deferring function carries on after the defer
+		// statement.
+		if pc, err := s.peekUintStructField(dType, d, "pc"); err == nil && pc != 0 {
+			c.File, c.Line, _ = s.lookupSource(pc - 1)
+		}
+		// fn is a func value: a pointer to a closure, whose first word
+		// is the function's code.
+		if closure, err := s.peekPtr(d + uint64(fn.ByteOffset)); err == nil && closure != 0 {
+			if code, err := s.peekPtr(closure); err == nil {
+				c.Function, _, _ = s.pcToFunctionName(code)
+				c.Args = s.wrappedArgs(code, closure)
+				c.Recovers = s.callsRecover(code)
+			}
+		}
+		calls = append(calls, c)
+	}
+	return calls, err
+}
+
+// wrappedArgs returns the arguments captured by the closure at closure, if
+// its function, which starts at pc, is a wrapper the compiler made for a
+// deferred call, with their formatted values.  The DWARF data gives each
+// captured variable of a function its offset in the closure.  Only wrappers'
+// variables are read: another closure's variable x captured by reference
+// is described as &x, a pointer, just like one captured by value that was
+// then moved to the heap, so what the closure holds can't be told.
+func (s *Server) wrappedArgs(pc, closure uint64) []debug.Param {
+	if s.dwarfData == nil {
+		return nil
+	}
+	entry, funcEntry, err := s.pcToFunction(pc)
+	if err != nil || funcEntry != pc || !entry.Children {
+		return nil
+	}
+	if wrapper, _ := entry.Val(dwarf.AttrTrampoline).(bool); !wrapper {
+		return nil
+	}
+	r := s.dwarfData.Reader()
+	r.Seek(entry.Offset)
+	if _, err := r.Next(); err != nil {
+		return nil
+	}
+	var params []debug.Param
+	for {
+		child, err := r.Next()
+		if err != nil || child == nil || child.Tag == 0 {
+			break
+		}
+		r.SkipChildren()
+		var off uint64
+		switch v := child.Val(dwarf.AttrGoClosureOffset).(type) {
+		case int64:
+			off = uint64(v)
+		case uint64:
+			off = v
+		default:
+			continue
+		}
+		typeOff, err := s.dwarfData.EntryTypeOffset(child)
+		if err != nil {
+			continue
+		}
+		name, _ := child.Val(dwarf.AttrName).(string)
+		params = append(params, debug.Param{
+			Name: name,
+			Var:  debug.Var{TypeID: uint64(typeOff), Address: closure + off},
+		})
+	}
+	s.describeParams([]debug.Frame{{Params: params}})
+	return params
+}
+
+// callsRecover reports whether the function starting at pc calls recover,
+// or, if it is a wrapper the compiler made, as for defer f(x), whether a
+// function it calls does.  Recover works through such wrappers.
+func (s *Server) callsRecover(pc uint64) bool {
+	gorecover, err := s.functionStartAddress("runtime.gorecover")
+	if err != nil {
+		return false
+	}
+	callees := s.directCalls(pc)
+	for _, c := range callees {
+		if c == gorecover {
+			return true
+		}
+	}
+	entry, _, err := s.pcToFunction(pc)
+	if err != nil {
+		return false
+	}
+	if wrapper, _ := entry.Val(dwarf.AttrTrampoline).(bool); !wrapper {
+		return false
+	}
+	for _, c := range callees {
+		if name, _, _ := s.pcToFunctionName(c); strings.HasPrefix(name, "runtime.") {
+			continue
+		}
+		for _, cc := range s.directCalls(c) {
+			if cc == gorecover {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// directCalls returns the targets of the direct calls made by the function
+// starting at pc.  Its code is searched for CALL instructions byte by byte,
+// rather than decoded, so a call is only believed if its target is the start
+// of a function.
+func (s *Server) directCalls(pc uint64) []uint64 {
+	if s.dwarfData == nil {
+		return nil
+	}
+	entry, funcEntry, err := s.pcToFunction(pc)
+	if err != nil || funcEntry != pc {
+		return nil
+	}
+	ranges, err := s.dwarfData.EntryRanges(entry)
+	if err != nil {
+		return nil
+	}
+	var targets []uint64
+	seen := make(map[uint64]bool)
+	for _, r := range ranges {
+		lo, hi := r[0]+s.loadBias, r[1]+s.loadBias
+		if hi-lo > maxScannedCode {
+			hi = lo + maxScannedCode
+		}
+		code := make([]byte, hi-lo)
+		if err := s.readOriginalCode(lo, code); err != nil {
+			continue
+		}
+		for i := 0; i+5 <= len(code); i++ {
+			if code[i] != 0xe8 {
+				continue
+			}
+			rel := int32(binary.LittleEndian.Uint32(code[i+1:]))
+			target := lo + uint64(i+5) + uint64(int64(rel))
+			if seen[target] {
+				continue
+			}
+			if _, start, err := s.pcToFunction(target); err == nil && start == target {
+				seen[target] = true
+				targets = append(targets, target)
+			}
+		}
+	}
+	return targets
+}
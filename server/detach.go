@@ -0,0 +1,151 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Detaching from the process, leaving it running, and shutting the server
+// down.
+
+package server
+
+import (
+	"fmt"
+	"syscall"
+
+	"golang.org/x/debug/server/protocol"
+)
+
+func (s *Server) SetKillOnExit(req *protocol.SetKillOnExitRequest, resp *protocol.SetKillOnExitResponse) error {
+	return s.call(s.otherc, req, resp)
+}
+
+func (s *Server) handleSetKillOnExit(req *protocol.SetKillOnExitRequest, resp *protocol.SetKillOnExitResponse) error {
+	s.killOnExit = req.Kill
+	return nil
+}
+
+func (s *Server) Detach(req *protocol.DetachRequest, resp *protocol.DetachResponse) error {
+	return s.call(s.controlc, req, resp)
+}
+
+func (s *Server) handleDetach(req *protocol.DetachRequest, resp *protocol.DetachResponse) error {
+	if s.proc == nil {
+		return nil
+	}
+	if s.exited != nil {
+		s.resetProcess()
+		return nil
+	}
+	if s.procKillOnExit {
+		err := s.proc.Kill()
+		s.resetProcess()
+		return err
+	}
+	// Put the original code back, so the process can run without us.
+	for pc, bp := range s.breakpoints {
+		if err := s.ptracePoke(s.stoppedPid, uintptr(pc), bp.origInstr[:s.arch.BreakpointSize]); err != nil {
+			return fmt.Errorf("ptracePoke: %v", err)
+		}
+	}
+	if err := s.clearWatchpoints(); err != nil {
+		return err
+	}
+	if err := s.detachThreads(); err != nil {
+		return err
+	}
+	s.proc.Release()
+	s.resetProcess()
+	return nil
+}
+
+// detachThreads detaches from each thread of the process, stopping the ones
+// that are running first, since only stopped threads can be detached.
+func (s *Server) detachThreads() error {
+	pid := s.proc.Pid
+	done := make(map[int]bool)
+	for {
+		// Threads can be created while we work, so repeat until there are no
+		// new ones.
+		tids, err := threadIDs(pid)
+		if err != nil {
+			return err
+		}
+		progress := false
+		for _, tid := range tids {
+			if done[tid] {
+				continue
+			}
+			done[tid], progress = true, true
+			if pending, stopped := s.otherThreads[tid]; tid != s.stoppedPid && (!stopped || pending) {
+				if _, err := s.stopThread(pid, tid, pending, false); err == errThreadExited {
+					continue
+				} else if err != nil {
+					return err
+				}
+			}
+			// The signal the process stopped for, if any, is delivered as
+			// it would have been had the process been resumed.
+			sig := 0
+			if tid == s.stoppedPid {
+				sig = int(s.stopSignal)
+			}
+			// Once one thread is detached, the process may run to completion,
+			// taking the other threads with it.
+			if err := s.ptraceDetach(tid, sig); err == syscall.ESRCH {
+				if tid != pid {
+					s.reapThread(tid)
+				}
+			} else if err != nil {
+				return fmt.Errorf("ptraceDetach: %v", err)
+			}
+		}
+		if !progress {
+			return nil
+		}
+	}
+}
+
+// reapThread waits for thread tid, which is still traced but was killed
+// before it could be detached, to exit.  Until its tracer has waited for it,
+// the thread stays a zombie, and the process can't finish exiting.
+func (s *Server) reapThread(tid int) {
+	for {
+		_, status, err := s.wait(tid, false)
+		if err != nil || status.Exited() || status.Signaled() {
+			return
+		}
+		// It was still alive after all.
+		if s.ptraceDetach(tid, 0) == nil {
+			return
+		}
+	}
+}
+
+func (s *Server) Shutdown(req *protocol.ShutdownRequest, resp *protocol.ShutdownResponse) error {
+	return s.call(s.controlc, req, resp)
+}
+
+func (s *Server) handleShutdown(req *protocol.ShutdownRequest, resp *protocol.ShutdownResponse) error {
+	s.procKillOnExit = req.Kill
+	err := s.handleDetach(&protocol.DetachRequest{}, &protocol.DetachResponse{})
+	for _, f := range s.files {
+		if f == nil {
+			continue
+		}
+		if err1 := f.f.Close(); err == nil {
+			err = err1
+		}
+	}
+	s.files = nil
+	select {
+	case <-s.done:
+	default:
+		close(s.done)
+	}
+	return err
+}
+
+// Done returns a channel that is closed once a client has called Shutdown,
+// when a program serving the Server, such as debugproxy, should exit.
+func (s *Server) Done() <-chan struct{} {
+	return s.done
+}
@@ -0,0 +1,71 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Running processes with as little nondeterminism as the runtime allows.
+
+package server
+
+import (
+	"os"
+	"strings"
+
+	"golang.org/x/debug/server/protocol"
+)
+
+func (s *Server) SetDeterministic(req *protocol.SetDeterministicRequest, resp *protocol.SetDeterministicResponse) error {
+	return s.call(s.otherc, req, resp)
+}
+
+func (s *Server) handleSetDeterministic(req *protocol.SetDeterministicRequest, resp *protocol.SetDeterministicResponse) error {
+	s.deterministic = req.Deterministic
+	return nil
+}
+
+// deterministicEnv returns env, changed so that the Go runtime runs goroutines
+// one at a time and switches between them only at function calls and
+// blocking operations, not at asynchronous preemptions.
+func deterministicEnv(env []string) []string {
+	godebug := "asyncpreemptoff=1"
+	var out []string
+	for _, kv := range env {
+		switch {
+		case strings.HasPrefix(kv, "GOMAXPROCS="):
+			continue
+		case strings.HasPrefix(kv, "GODEBUG="):
+			if old := strings.TrimPrefix(kv, "GODEBUG="); old != "" {
+				// Later settings override earlier ones.
+				godebug = old + "," + godebug
+			}
+			continue
+		}
+		out = append(out, kv)
+	}
+	return append(out, "GOMAXPROCS=1", "GODEBUG="+godebug)
+}
+
+// processEnv returns the environment for a new process: the server's own,
+// adjusted as set by SetDeterministic.
+func (s *Server) processEnv() []string {
+	if !s.deterministic {
+		return nil // The server's environment.
+	}
+	return deterministicEnv(os.Environ())
+}
+
+// stepPastCondition steps the stopped thread past the breakpoint it is at,
+// whose condition isn't met, while the other threads run on.  In a
+// deterministic process the other threads are stopped for the step, so that
+// none of them gets ahead while the breakpoint is being stepped over.
+func (s *Server) stepPastCondition() error {
+	if !s.procDeterminism {
+		return s.stepOverBreakpoint(s.stoppedRegs.Rip)
+	}
+	if err := s.stopOtherThreads(); err != nil {
+		return err
+	}
+	if err := s.stepOverBreakpoint(s.stoppedRegs.Rip); err != nil {
+		return err
+	}
+	return s.resumeOtherThreads()
+}
@@ -0,0 +1,45 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDeterministicEnv(t *testing.T) {
+	tests := []struct {
+		env, want []string
+	}{
+		{
+			env:  nil,
+			want: []string{"GOMAXPROCS=1", "GODEBUG=asyncpreemptoff=1"},
+		},
+		{
+			env:  []string{"HOME=/home/gopher", "GOMAXPROCS=8", "PATH=/bin"},
+			want: []string{"HOME=/home/gopher", "PATH=/bin", "GOMAXPROCS=1", "GODEBUG=asyncpreemptoff=1"},
+		},
+		{
+			// The process's own GODEBUG settings are kept, but can't turn
+			// asynchronous preemption back on.
+			env:  []string{"GODEBUG=gctrace=1,asyncpreemptoff=0", "USER=gopher"},
+			want: []string{"USER=gopher", "GOMAXPROCS=1", "GODEBUG=gctrace=1,asyncpreemptoff=0,asyncpreemptoff=1"},
+		},
+		{
+			env:  []string{"GODEBUG="},
+			want: []string{"GOMAXPROCS=1", "GODEBUG=asyncpreemptoff=1"},
+		},
+		{
+			// Only variables with those names are replaced.
+			env:  []string{"GOMAXPROCSX=2", "XGODEBUG=y"},
+			want: []string{"GOMAXPROCSX=2", "XGODEBUG=y", "GOMAXPROCS=1", "GODEBUG=asyncpreemptoff=1"},
+		},
+	}
+	for _, tt := range tests {
+		if got := deterministicEnv(tt.env); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("deterministicEnv(%q) = %q, want %q", tt.env, got, tt.want)
+		}
+	}
+}
@@ -7,14 +7,31 @@ package server
 import (
 	"errors"
 	"fmt"
+	"regexp"
+	"sort"
+	"strings"
 
 	"golang.org/x/debug/dwarf"
 )
 
 func (s *Server) functionStartAddress(name string) (uint64, error) {
+	if s.dwarfData == nil {
+		return s.pclnFunctionStart(name)
+	}
 	entry, err := s.dwarfData.LookupFunction(name)
 	if err != nil {
-		return 0, err
+		if addr, ok := s.objectFunctionStart(name); ok {
+			return addr, nil
+		}
+		// Frames name an instantiation of a generic function with the
+		// types of its shapes, as in main.Max[int].
+		names := s.dwarfData.LookupInstantiations(name)
+		if len(names) != 1 {
+			return 0, err
+		}
+		if entry, err = s.dwarfData.LookupFunction(names[0]); err != nil {
+			return 0, err
+		}
 	}
 	addrAttr := entry.Val(dwarf.AttrLowpc)
 	if addrAttr == nil {
@@ -24,55 +41,104 @@ func (s *Server) functionStartAddress(name string) (uint64, error) {
 	if !ok {
 		return 0, fmt.Errorf("symbol %q has non-uint64 LowPC attribute", name)
 	}
-	return addr, nil
+	return addr + s.loadBias, nil
+}
+
+// instantiations returns the names of the instantiations of the generic
+// function with the given name, or nil if it isn't one.
+func (s *Server) instantiations(name string) []string {
+	if s.dwarfData == nil {
+		return nil
+	}
+	return s.dwarfData.LookupInstantiations(name)
+}
+
+// packageInitAddresses returns the start addresses of the init functions the
+// compiler generated for the package with the given import path.  These are
+// pkg.init itself and the numbered functions pkg.init.0, pkg.init.1, ... (or
+// pkg.init·1, ... in older binaries) holding the bodies of the package's own
+// init functions.
+func (s *Server) packageInitAddresses(pkg string) ([]uint64, error) {
+	if pkg == "" {
+		return nil, errors.New("empty package path")
+	}
+	re, err := regexp.Compile(`^` + regexp.QuoteMeta(symbolPackagePath(pkg)) + `\.init((\.|·)[0-9]+)?$`)
+	if err != nil {
+		return nil, err
+	}
+	names, err := s.dwarfData.LookupMatchingSymbols(re)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	var pcs []uint64
+	for _, name := range names {
+		// Matching variables, such as the initdone flag, are skipped.
+		if pc, err := s.functionStartAddress(name); err == nil {
+			pcs = append(pcs, pc)
+		}
+	}
+	if len(pcs) == 0 {
+		return nil, fmt.Errorf("no init functions found for package %q", pkg)
+	}
+	return pcs, nil
+}
+
+// symbolPackagePath returns the form of the import path pkg that the linker
+// uses as a prefix of symbol names: dots in the last path element are escaped.
+func symbolPackagePath(pkg string) string {
+	i := strings.LastIndex(pkg, "/") + 1
+	return pkg[:i] + strings.Replace(pkg[i:], ".", "%2e", -1)
 }
 
-// evalLocation parses a DWARF location description encoded in v.  It works for
-// cases where the variable is stored at an offset from the Canonical Frame
-// Address.  The return value is this offset.
-// TODO: a more general location-description-parsing function.
-func evalLocation(v []uint8) (int64, error) {
-	// Some DWARF constants.
-	const (
-		opConsts       = 0x11
-		opPlus         = 0x22
-		opCallFrameCFA = 0x9C
-	)
-	if len(v) == 0 {
-		return 0, errors.New("empty location specifier")
-	}
-	if v[0] != opCallFrameCFA {
-		return 0, errors.New("unsupported location specifier")
-	}
-	if len(v) == 1 {
-		// The location description was just DW_OP_call_frame_cfa, so the location is exactly the CFA.
-		return 0, nil
-	}
-	if v[1] != opConsts {
-		return 0, errors.New("unsupported location specifier")
-	}
-	offset, v, err := sleb128(v[2:])
+// localAddress returns the address of the local variable or parameter
+// described by entry, of the function described by funcEntry, in the stack
+// frame with program counter pc and Canonical Frame Address fp.  A variable
+// that isn't in memory, or not in one piece, is given an address in composite
+// memory.
+func (s *Server) localAddress(funcEntry, entry *dwarf.Entry, pc, fp uint64) (uint64, error) {
+	loc, err := s.dwarfData.EntryLocationAt(entry, pc-s.loadBias)
 	if err != nil {
 		return 0, err
 	}
-	if len(v) == 1 && v[0] == opPlus {
-		// The location description was DW_OP_call_frame_cfa, DW_OP_consts <offset>, DW_OP_plus.
-		// So return the offset.
-		return offset, nil
+	if loc == nil {
+		return 0, errors.New("variable is not available here")
+	}
+	c, err := s.newFrameContext(funcEntry, pc, fp)
+	if err != nil {
+		return 0, err
 	}
-	return 0, errors.New("unsupported location specifier")
+	pieces, err := s.evalLocation(loc, c)
+	if err != nil {
+		return 0, err
+	}
+	var size int64
+	if off, err := s.dwarfData.EntryTypeOffset(entry); err == nil {
+		if t, err := s.dwarfData.Type(off); err == nil {
+			size = t.Size()
+		}
+	}
+	addr, err := s.locationAddress(pieces, size, c)
+	if err == errInRegisters && s.binaryInfo.RegisterABI && entry.Tag == dwarf.TagFormalParameter {
+		// The register ABI passes arguments in registers; the function
+		// stores them in its frame later, if at all.
+		return 0, errors.New("argument is in registers, not yet stored in memory")
+	}
+	return addr, err
 }
 
-func uleb128(v []uint8) (u uint64) {
+// uleb128 parses an unsigned integer encoded with uleb128 at the start of v,
+// and returns the integer and the remainder of v.
+func uleb128(v []uint8) (u uint64, rest []uint8, err error) {
 	var shift uint
-	for _, x := range v {
+	for i, x := range v {
 		u |= (uint64(x) & 0x7F) << shift
 		shift += 7
 		if x&0x80 == 0 {
-			break
+			return u, v[i+1:], nil
 		}
 	}
-	return u
+	return 0, nil, errors.New("truncated uleb128")
 }
 
 // sleb128 parses a signed integer encoded with sleb128 at the start of v, and
@@ -17,7 +17,9 @@ import (
 	"fmt"
 	"go/ast"
 	"go/parser"
+	"go/scanner"
 	"go/token"
+	"go/types"
 	"math"
 	"math/big"
 
@@ -82,6 +84,9 @@ type untComplex struct {
 // untString is an untyped string constant
 type untString string
 
+// untNil is the predeclared identifier nil
+type untNil struct{}
+
 // pointerToValue is a pointer to a value in memory.
 // The evaluator constructs these as the result of address operations like "&x".
 // Unlike debug.Pointer, the DWARF type stored alongside values of this type
@@ -109,21 +114,53 @@ type ident string
 // value of a global symbol.
 var identLookup ident = "lookup"
 
-// evalExpression evaluates a Go expression.
+// evalExpression evaluates a Go expression, returning its value and static type.
 // If the program counter and stack pointer are nonzero, they are used to determine
 // what local variables are available and where in memory they are.
-func (s *Server) evalExpression(expression string, pc, sp uint64) (debug.Value, error) {
+func (s *Server) evalExpression(expression string, pc, sp uint64) (debug.Value, debug.Type, error) {
 	e := evaluator{server: s, expression: expression, pc: pc, sp: sp}
-	node, err := parser.ParseExpr(expression)
+	return e.evaluate()
+}
+
+// sampleExpression evaluates an expression over global variables, without
+// calling any of the program's functions, for Sample.
+func (s *Server) sampleExpression(expression string) (debug.Value, debug.Type, error) {
+	e := evaluator{server: s, expression: expression, readOnly: true}
+	return e.evaluate()
+}
+
+// snapshotExpression evaluates an expression where the process has stopped,
+// without calling any of the program's functions, for recording breakpoints.
+func (s *Server) snapshotExpression(expression string, pc, sp uint64) (debug.Value, debug.Type, error) {
+	e := evaluator{server: s, expression: expression, pc: pc, sp: sp, readOnly: true}
+	return e.evaluate()
+}
+
+// evaluate evaluates e.expression.
+func (e *evaluator) evaluate() (debug.Value, debug.Type, error) {
+	node, err := parser.ParseExpr(e.expression)
 	if err != nil {
-		return nil, err
+		return nil, debug.Type{}, e.parseError(err)
 	}
 	val := e.evalNode(node, false)
 	if e.evalError != nil {
-		return nil, e.evalError
+		return nil, debug.Type{}, e.evalError
 	}
+	v, err := e.resultValue(val)
+	if err != nil {
+		return nil, debug.Type{}, &debug.ExpressionError{
+			Expression: e.expression,
+			Kind:       "type",
+			End:        len(e.expression),
+			Reason:     err.Error(),
+		}
+	}
+	return v, resultType(val, v), nil
+}
 
-	// Convert untyped constants to their default types.
+// resultValue returns the value of the result of an expression, converting
+// untyped constants to their default types.
+func (e *evaluator) resultValue(val result) (debug.Value, error) {
 	switch v := val.v.(type) {
 	case untInt:
 		return e.intFromInteger(v)
@@ -156,6 +193,8 @@ func (s *Server) evalExpression(expression string, pc, sp uint64) (debug.Value,
 		return complex(r, i), nil
 	case untString:
 		return debug.String{Length: uint64(len(v)), String: string(v)}, nil
+	case untNil:
+		return nil, errors.New("use of untyped nil")
 	case pointerToValue:
 		return debug.Pointer{TypeID: uint64(val.d.Common().Offset), Address: v.a}, nil
 	case sliceOf:
@@ -167,6 +206,42 @@ func (s *Server) evalExpression(expression string, pc, sp uint64) (debug.Value,
 	return val.v, nil
 }
 
+// resultType returns the static type of the result of an expression, whose
+// value, as returned by resultValue, is v.
+func resultType(val result, v debug.Value) debug.Type {
+	switch val.v.(type) {
+	case untInt:
+		return debug.Type{Name: "int"}
+	case untRune:
+		return debug.Type{Name: "rune"}
+	case pointerToValue:
+		// val.d is the type of the variable pointed to, and the program may
+		// have no type for pointers to it.
+		return debug.Type{Name: "*" + typeName(val.d)}
+	case sliceOf:
+		return debug.Type{Name: "[]" + typeName(val.d)}
+	}
+	if val.d != nil {
+		return debug.Type{Name: typeName(val.d), TypeID: uint64(val.d.Common().Offset)}
+	}
+	// Untyped constants other than integers, and the results of comparisons,
+	// have no DWARF type; v has the Go type they are given.
+	if _, ok := v.(debug.String); ok {
+		return debug.Type{Name: "string"}
+	}
+	return debug.Type{Name: fmt.Sprintf("%T", v)}
+}
+
+// typeName returns the Go name of a DWARF type, with the shapes in the
+// names of instantiations of generic types written as the types they stand
+// for.
+func typeName(t dwarf.Type) string {
+	if name := t.Common().Name; name != "" {
+		return dwarf.DemangleShapes(name)
+	}
+	return dwarf.DemangleShapes(t.String())
+}
+
 type evaluator struct {
 	// expression is the expression being evaluated.
 	expression string
@@ -183,6 +258,9 @@ type evaluator struct {
 	// without using local variables.
 	pc uint64
 	sp uint64
+	// readOnly is set when the program may be running, or mustn't be
+	// disturbed, so that its functions can't be called.
+	readOnly bool
 }
 
 // setNode sets curNode, and returns curNode's previous value.
@@ -191,14 +269,69 @@ func (e *evaluator) setNode(node ast.Node) (old ast.Node) {
 	return old
 }
 
-// err saves an error that occurred during evaluation.
+// parseError converts an error from parsing the expression to an
+// *debug.ExpressionError, whose position is that of the token the parser
+// reported.
+func (e *evaluator) parseError(err error) error {
+	pe := &debug.ExpressionError{Expression: e.expression, Kind: "parse", Reason: err.Error()}
+	list, ok := err.(scanner.ErrorList)
+	if !ok || len(list) == 0 {
+		return pe
+	}
+	pe.Reason = list[0].Msg
+	pe.Start = list[0].Pos.Offset
+	if pe.Start < 0 || pe.Start > len(e.expression) {
+		pe.Start = len(e.expression)
+	}
+	pe.End = pe.Start
+
+	// Find the end of the token at the error.
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(e.expression))
+	var s scanner.Scanner
+	s.Init(file, []byte(e.expression), nil, 0)
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if off := file.Offset(pos); off == pe.Start {
+			if lit == "" {
+				lit = tok.String()
+			}
+			if off+len(lit) <= len(e.expression) {
+				pe.End = off + len(lit)
+			}
+			break
+		} else if off > pe.Start {
+			break
+		}
+	}
+	return pe
+}
+
+// err saves a type error, or any other error that isn't a runtime error,
+// that occurred during evaluation.
 // It returns a zero result, so that functions can exit and set an error with
 //	return e.err(...)
 func (e *evaluator) err(s string) result {
+	return e.errOfKind("type", s)
+}
+
+// runtimeErr saves an error in reading the program's values, or in
+// computing with them, such as an index out of range, that occurred during
+// evaluation.  Like err, it returns a zero result.
+func (e *evaluator) runtimeErr(s string) result {
+	return e.errOfKind("runtime", s)
+}
+
+// errOfKind saves an error of the given kind, as described for
+// debug.ExpressionError, at the current AST node.
+func (e *evaluator) errOfKind(kind, s string) result {
 	if e.evalError != nil {
 		return result{}
 	}
-	// Append the substring of the expression that corresponds to the current AST node.
+	// Record the substring of the expression that corresponds to the current AST node.
 	start := int(e.curNode.Pos() - 1)
 	end := int(e.curNode.End() - 1)
 	if start < 0 {
@@ -210,7 +343,13 @@ func (e *evaluator) err(s string) result {
 	if start > end {
 		start, end = 0, 0
 	}
-	e.evalError = errors.New(s + `: "` + e.expression[start:end] + `"`)
+	e.evalError = &debug.ExpressionError{
+		Expression: e.expression,
+		Kind:       kind,
+		Start:      start,
+		End:        end,
+		Reason:     s,
+	}
 	return result{}
 }
 
@@ -241,6 +380,8 @@ func (e *evaluator) evalNode(node ast.Node, getAddress bool) result {
 			return result{nil, true}
 		case "false":
 			return result{nil, false}
+		case "nil":
+			return result{nil, untNil{}}
 		case "lookup":
 			return result{nil, identLookup}
 		}
@@ -248,6 +389,9 @@ func (e *evaluator) evalNode(node ast.Node, getAddress bool) result {
 
 	case *ast.BasicLit:
 		switch n.Kind {
+		// With base 0, SetString and ParseFloat accept the same prefixes
+		// and digit separators as Go: 0b, 0o and 0x, hexadecimal floats
+		// like 0x1p-2, and underscores as in 1_000.
 		case token.INT:
 			i := new(big.Int)
 			if _, ok := i.SetString(n.Value, 0); !ok {
@@ -255,7 +399,7 @@ func (e *evaluator) evalNode(node ast.Node, getAddress bool) result {
 			}
 			return result{nil, untInt{i}}
 		case token.FLOAT:
-			r, _, err := big.ParseFloat(n.Value, 10, prec, big.ToNearestEven)
+			r, _, err := big.ParseFloat(n.Value, 0, prec, big.ToNearestEven)
 			if err != nil {
 				return e.err(err.Error())
 			}
@@ -264,7 +408,9 @@ func (e *evaluator) evalNode(node ast.Node, getAddress bool) result {
 			if len(n.Value) <= 1 || n.Value[len(n.Value)-1] != 'i' {
 				return e.err("invalid imaginary constant")
 			}
-			r, _, err := big.ParseFloat(n.Value[:len(n.Value)-1], 10, prec, big.ToNearestEven)
+			// ParseFloat treats a leading 0 as decimal, as Go does for
+			// imaginary literals for backward compatibility, so 017i is 17i.
+			r, _, err := big.ParseFloat(n.Value[:len(n.Value)-1], 0, prec, big.ToNearestEven)
 			if err != nil {
 				return e.err(err.Error())
 			}
@@ -285,6 +431,10 @@ func (e *evaluator) evalNode(node ast.Node, getAddress bool) result {
 
 	case *ast.StarExpr:
 		x := e.evalNode(n.X, false)
+		if iface, ok := x.v.(debug.Interface); ok {
+			// Indirect through the pointer the interface holds.
+			x = e.dynamicValue(iface, false)
+		}
 		switch v := x.v.(type) {
 		case debug.Pointer:
 			// x.d may be a typedef pointing to a pointer type (or a typedef pointing
@@ -304,20 +454,37 @@ func (e *evaluator) evalNode(node ast.Node, getAddress bool) result {
 		return e.err("invalid indirect")
 
 	case *ast.SelectorExpr:
-		x := e.evalNode(n.X, false)
 		sel := n.Sel.Name
+		if id, ok := n.X.(*ast.Ident); ok && !e.isVariable(id.Name) {
+			// The expression may be a package-qualified global variable, like
+			// main.x.  DWARF names globals by their package and name.
+			if a, t := e.server.findGlobalVar(id.Name + "." + sel); t != nil {
+				return e.resultFrom(a, t, getAddress)
+			}
+			if _, t := e.server.findGlobalVar(id.Name); t == nil {
+				// id isn't a global either, so report the whole selector,
+				// which is most likely a misspelled global, as unknown.
+				return e.err("unknown identifier")
+			}
+		}
+		x := e.evalNode(n.X, false)
+		if iface, ok := x.v.(debug.Interface); ok {
+			// Select from the value the interface holds.
+			x = e.dynamicValue(iface, false)
+		}
 		switch v := x.v.(type) {
 		case debug.Struct:
-			for _, f := range v.Fields {
-				if f.Name == sel {
-					t, err := e.server.dwarfData.Type(dwarf.Offset(f.Var.TypeID))
-					if err != nil {
-						return e.err(err.Error())
-					}
-					return e.resultFrom(f.Var.Address, t, getAddress)
-				}
+			if len(v.Fields) == 0 {
+				return e.err("struct field not found")
 			}
-			return e.err("struct field not found")
+			st, ok := followTypedefs(x.d).(*dwarf.StructType)
+			if !ok {
+				return e.err("invalid DWARF type for struct")
+			}
+			// The struct's address is the address of its first field, minus that
+			// field's offset.
+			a := v.Fields[0].Var.Address - uint64(st.Field[0].ByteOffset)
+			return e.selectField(a, st, sel, getAddress)
 		case debug.Pointer:
 			pt, ok := followTypedefs(x.d).(*dwarf.PtrType) // x.d should be a pointer to struct.
 			if !ok {
@@ -327,26 +494,46 @@ func (e *evaluator) evalNode(node ast.Node, getAddress bool) result {
 			if !ok {
 				break
 			}
-			for _, f := range st.Field {
-				if f.Name == sel {
-					return e.resultFrom(v.Address+uint64(f.ByteOffset), f.Type, getAddress)
-				}
+			if v.Address == 0 {
+				return e.runtimeErr("nil pointer dereference")
 			}
-			return e.err("struct field not found")
+			return e.selectField(v.Address, st, sel, getAddress)
 		case pointerToValue:
 			st, ok := followTypedefs(x.d).(*dwarf.StructType) // x.d should be a struct.
 			if !ok {
 				break
 			}
-			for _, f := range st.Field {
-				if f.Name == sel {
-					return e.resultFrom(v.a+uint64(f.ByteOffset), f.Type, getAddress)
-				}
-			}
-			return e.err("struct field not found")
+			return e.selectField(v.a, st, sel, getAddress)
+		case nil:
+			return x
 		}
 		return e.err("invalid selector expression")
 
+	case *ast.TypeAssertExpr:
+		x := e.evalNode(n.X, false)
+		iface, ok := x.v.(debug.Interface)
+		if !ok {
+			if x.v == nil {
+				return x
+			}
+			return e.err("invalid type assertion: operand is not an interface")
+		}
+		want := types.ExprString(n.Type)
+		if t, ok := e.getBaseType(want); ok {
+			if _, ok := followTypedefs(t).(*dwarf.InterfaceType); ok {
+				return e.err("type assertion to an interface type is not supported")
+			}
+		}
+		switch {
+		case iface.TypeID == 0 && iface.Data == 0:
+			return e.runtimeErr("interface is nil, not " + want)
+		case iface.TypeName == "":
+			return e.runtimeErr("interface's dynamic type is unknown")
+		case iface.TypeName != want:
+			return e.runtimeErr("interface holds " + iface.TypeName + ", not " + want)
+		}
+		return e.dynamicValue(iface, getAddress)
+
 	case *ast.IndexExpr:
 		x, index := e.evalNode(n.X, false), e.evalNode(n.Index, false)
 		if x.v == nil || index.v == nil {
@@ -387,7 +574,7 @@ func (e *evaluator) evalNode(node ast.Node, getAddress bool) result {
 				}
 			)
 			if err := e.server.peekMapValues(mt, m.Address, fn); err != nil {
-				return e.err(err.Error())
+				return e.runtimeErr(err.Error())
 			}
 			if abort {
 				// Some operation on individual map keys failed.
@@ -400,6 +587,27 @@ func (e *evaluator) evalNode(node ast.Node, getAddress bool) result {
 			return e.zero(mt.ElemType)
 		}
 
+		// Indexing a pointer to an array indexes the array it points to.
+		switch v := x.v.(type) {
+		case debug.Pointer:
+			if v.Address == 0 {
+				return e.runtimeErr("nil pointer dereference")
+			}
+			pt, ok := followTypedefs(x.d).(*dwarf.PtrType)
+			if !ok {
+				return e.err("invalid DWARF type for pointer")
+			}
+			x = e.resultFrom(v.Address, pt.Type, false)
+			if _, ok := x.v.(debug.Array); !ok {
+				return e.err("cannot index pointer")
+			}
+		case pointerToValue:
+			x = e.resultFrom(v.a, x.d, false)
+			if _, ok := x.v.(debug.Array); !ok {
+				return e.err("cannot index pointer")
+			}
+		}
+
 		// The index should be a non-negative integer for the remaining cases.
 		u, err := uint64FromResult(index)
 		if err != nil {
@@ -408,7 +616,7 @@ func (e *evaluator) evalNode(node ast.Node, getAddress bool) result {
 		switch v := x.v.(type) {
 		case debug.Array:
 			if u >= v.Length {
-				return e.err("array index out of bounds")
+				return e.runtimeErr("array index out of bounds")
 			}
 			elemType, err := e.server.dwarfData.Type(dwarf.Offset(v.ElementTypeID))
 			if err != nil {
@@ -417,7 +625,7 @@ func (e *evaluator) evalNode(node ast.Node, getAddress bool) result {
 			return e.resultFrom(v.Element(u).Address, elemType, getAddress)
 		case debug.Slice:
 			if u >= v.Length {
-				return e.err("slice index out of bounds")
+				return e.runtimeErr("slice index out of bounds")
 			}
 			elemType, err := e.server.dwarfData.Type(dwarf.Offset(v.ElementTypeID))
 			if err != nil {
@@ -426,7 +634,7 @@ func (e *evaluator) evalNode(node ast.Node, getAddress bool) result {
 			return e.resultFrom(v.Element(u).Address, elemType, getAddress)
 		case sliceOf:
 			if u >= v.Length {
-				return e.err("slice index out of bounds")
+				return e.runtimeErr("slice index out of bounds")
 			}
 			return e.resultFrom(v.Element(u).Address, x.d, getAddress)
 		case debug.String:
@@ -434,10 +642,10 @@ func (e *evaluator) evalNode(node ast.Node, getAddress bool) result {
 				return e.err("can't take address of string element")
 			}
 			if u >= v.Length {
-				return e.err("string index out of bounds")
+				return e.runtimeErr("string index out of bounds")
 			}
 			if u >= uint64(len(v.String)) {
-				return e.err("string element unavailable")
+				return e.runtimeErr("string element unavailable")
 			}
 			return e.uint8Result(v.String[u])
 		case untString:
@@ -445,7 +653,7 @@ func (e *evaluator) evalNode(node ast.Node, getAddress bool) result {
 				return e.err("can't take address of string element")
 			}
 			if u >= uint64(len(v)) {
-				return e.err("string index out of bounds")
+				return e.runtimeErr("string index out of bounds")
 			}
 			return e.uint8Result(v[u])
 		}
@@ -515,24 +723,25 @@ func (e *evaluator) evalNode(node ast.Node, getAddress bool) result {
 			if n.High == nil {
 				high = arr.Length
 			} else if high > arr.Length {
-				return e.err("slice upper bound is too large")
+				return e.runtimeErr("slice upper bound is too large")
 			}
 			if n.Max == nil {
 				max = arr.Length
 			} else if max > arr.Length {
-				return e.err("slice capacity is too large")
+				return e.runtimeErr("slice capacity is too large")
 			}
 			if low > high || high > max {
-				return e.err("invalid slice index")
+				return e.runtimeErr("invalid slice index")
 			}
 			return result{
 				d: elemType,
 				v: sliceOf{
 					Array: debug.Array{
-						ElementTypeID: arr.ElementTypeID,
-						Address:       arr.Element(low).Address,
-						Length:        high - low,
-						StrideBits:    uint64(elemType.Common().ByteSize) * 8,
+						ElementTypeID:   arr.ElementTypeID,
+						ElementTypeName: arr.ElementTypeName,
+						Address:         arr.Element(low).Address,
+						Length:          high - low,
+						StrideBits:      uint64(elemType.Common().ByteSize) * 8,
 					},
 					Capacity: max - low,
 				},
@@ -541,15 +750,15 @@ func (e *evaluator) evalNode(node ast.Node, getAddress bool) result {
 			if n.High == nil {
 				high = v.Length
 			} else if high > v.Capacity {
-				return e.err("slice upper bound is too large")
+				return e.runtimeErr("slice upper bound is too large")
 			}
 			if n.Max == nil {
 				max = v.Capacity
 			} else if max > v.Capacity {
-				return e.err("slice capacity is too large")
+				return e.runtimeErr("slice capacity is too large")
 			}
 			if low > high || high > max {
-				return e.err("invalid slice index")
+				return e.runtimeErr("invalid slice index")
 			}
 			v.Address += low * (v.StrideBits / 8)
 			v.Length = high - low
@@ -559,15 +768,15 @@ func (e *evaluator) evalNode(node ast.Node, getAddress bool) result {
 			if n.High == nil {
 				high = v.Length
 			} else if high > v.Capacity {
-				return e.err("slice upper bound is too large")
+				return e.runtimeErr("slice upper bound is too large")
 			}
 			if n.Max == nil {
 				max = v.Capacity
 			} else if max > v.Capacity {
-				return e.err("slice capacity is too large")
+				return e.runtimeErr("slice capacity is too large")
 			}
 			if low > high || high > max {
-				return e.err("invalid slice index")
+				return e.runtimeErr("invalid slice index")
 			}
 			v.Address += low * (v.StrideBits / 8)
 			v.Length = high - low
@@ -581,7 +790,7 @@ func (e *evaluator) evalNode(node ast.Node, getAddress bool) result {
 				high = v.Length
 			}
 			if low > high || high > v.Length {
-				return e.err("invalid slice index")
+				return e.runtimeErr("invalid slice index")
 			}
 			v.Length = high - low
 			if low > uint64(len(v.String)) {
@@ -614,7 +823,11 @@ func (e *evaluator) evalNode(node ast.Node, getAddress bool) result {
 		}
 
 	case *ast.CallExpr:
-		// Only supports lookup("x"), which gets the value of a global symbol x.
+		// Supports calls of the program's functions, like main.f(1, 2), and
+		// lookup("x"), which gets the value of a global symbol x.
+		if name, ok := e.functionName(n.Fun); ok {
+			return e.callFunction(name, n.Args)
+		}
 		fun := e.evalNode(n.Fun, false)
 		var args []result
 		for _, a := range n.Args {
@@ -873,12 +1086,31 @@ func (e *evaluator) evalBinaryOp(op token.Token, x, y result) result {
 		return e.evalBinaryOp(token.LSS, y, x)
 	}
 	if op == token.GEQ {
-		return e.evalBinaryOp(token.LEQ, x, y)
+		return e.evalBinaryOp(token.LEQ, y, x)
 	}
 
 	x = convertUntyped(x, y)
 	y = convertUntyped(y, x)
 
+	// Pointers can be compared with each other, and pointers, maps, slices,
+	// channels and functions can be compared with nil.
+	_, xNil := x.v.(untNil)
+	_, yNil := y.v.(untNil)
+	if xNil || yNil || isPointer(x.v) || isPointer(y.v) {
+		if xNil && yNil {
+			return e.err("invalid operation")
+		}
+		a, aok := e.referenceAddress(x)
+		b, bok := e.referenceAddress(y)
+		if !aok || !bok || !xNil && !yNil && !(isPointer(x.v) && isPointer(y.v)) {
+			return e.err("type mismatch")
+		}
+		if op != token.EQL {
+			return e.err("invalid operation")
+		}
+		return result{nil, a == b}
+	}
+
 	switch a := x.v.(type) {
 
 	case int8:
@@ -906,12 +1138,12 @@ func (e *evaluator) evalBinaryOp(op token.Token, x, y result) result {
 			c = a * b
 		case token.QUO:
 			if b == 0 {
-				return e.err("integer divide by zero")
+				return e.runtimeErr("integer divide by zero")
 			}
 			c = a / b
 		case token.REM:
 			if b == 0 {
-				return e.err("integer divide by zero")
+				return e.runtimeErr("integer divide by zero")
 			}
 			c = a % b
 		case token.AND:
@@ -948,12 +1180,12 @@ func (e *evaluator) evalBinaryOp(op token.Token, x, y result) result {
 			c = a * b
 		case token.QUO:
 			if b == 0 {
-				return e.err("integer divide by zero")
+				return e.runtimeErr("integer divide by zero")
 			}
 			c = a / b
 		case token.REM:
 			if b == 0 {
-				return e.err("integer divide by zero")
+				return e.runtimeErr("integer divide by zero")
 			}
 			c = a % b
 		case token.AND:
@@ -990,12 +1222,12 @@ func (e *evaluator) evalBinaryOp(op token.Token, x, y result) result {
 			c = a * b
 		case token.QUO:
 			if b == 0 {
-				return e.err("integer divide by zero")
+				return e.runtimeErr("integer divide by zero")
 			}
 			c = a / b
 		case token.REM:
 			if b == 0 {
-				return e.err("integer divide by zero")
+				return e.runtimeErr("integer divide by zero")
 			}
 			c = a % b
 		case token.AND:
@@ -1032,12 +1264,12 @@ func (e *evaluator) evalBinaryOp(op token.Token, x, y result) result {
 			c = a * b
 		case token.QUO:
 			if b == 0 {
-				return e.err("integer divide by zero")
+				return e.runtimeErr("integer divide by zero")
 			}
 			c = a / b
 		case token.REM:
 			if b == 0 {
-				return e.err("integer divide by zero")
+				return e.runtimeErr("integer divide by zero")
 			}
 			c = a % b
 		case token.AND:
@@ -1074,12 +1306,12 @@ func (e *evaluator) evalBinaryOp(op token.Token, x, y result) result {
 			c = a * b
 		case token.QUO:
 			if b == 0 {
-				return e.err("integer divide by zero")
+				return e.runtimeErr("integer divide by zero")
 			}
 			c = a / b
 		case token.REM:
 			if b == 0 {
-				return e.err("integer divide by zero")
+				return e.runtimeErr("integer divide by zero")
 			}
 			c = a % b
 		case token.AND:
@@ -1116,12 +1348,12 @@ func (e *evaluator) evalBinaryOp(op token.Token, x, y result) result {
 			c = a * b
 		case token.QUO:
 			if b == 0 {
-				return e.err("integer divide by zero")
+				return e.runtimeErr("integer divide by zero")
 			}
 			c = a / b
 		case token.REM:
 			if b == 0 {
-				return e.err("integer divide by zero")
+				return e.runtimeErr("integer divide by zero")
 			}
 			c = a % b
 		case token.AND:
@@ -1158,12 +1390,12 @@ func (e *evaluator) evalBinaryOp(op token.Token, x, y result) result {
 			c = a * b
 		case token.QUO:
 			if b == 0 {
-				return e.err("integer divide by zero")
+				return e.runtimeErr("integer divide by zero")
 			}
 			c = a / b
 		case token.REM:
 			if b == 0 {
-				return e.err("integer divide by zero")
+				return e.runtimeErr("integer divide by zero")
 			}
 			c = a % b
 		case token.AND:
@@ -1200,12 +1432,12 @@ func (e *evaluator) evalBinaryOp(op token.Token, x, y result) result {
 			c = a * b
 		case token.QUO:
 			if b == 0 {
-				return e.err("integer divide by zero")
+				return e.runtimeErr("integer divide by zero")
 			}
 			c = a / b
 		case token.REM:
 			if b == 0 {
-				return e.err("integer divide by zero")
+				return e.runtimeErr("integer divide by zero")
 			}
 			c = a % b
 		case token.AND:
@@ -1560,43 +1792,336 @@ func (e *evaluator) evalBinaryOp(op token.Token, x, y result) result {
 	return e.err("invalid operation")
 }
 
+// isPointer reports whether v is a pointer value.
+func isPointer(v interface{}) bool {
+	switch v.(type) {
+	case debug.Pointer, pointerToValue:
+		return true
+	}
+	return false
+}
+
+// referenceAddress returns the address that a pointer, map, slice, channel or
+// function value refers to, which is zero if the value is nil.  ok is false for
+// other kinds of value.
+func (e *evaluator) referenceAddress(x result) (a uint64, ok bool) {
+	switch v := x.v.(type) {
+	case untNil:
+		return 0, true
+	case debug.Pointer:
+		return v.Address, true
+	case pointerToValue:
+		return v.a, true
+	case debug.Map:
+		// v.Address is the location of the map variable, which holds a pointer
+		// to the map's header.
+		mt, ok := followTypedefs(x.d).(*dwarf.MapType)
+		if !ok {
+			return 0, false
+		}
+		a, _, err := e.server.peekMapLocationAndType(mt, v.Address)
+		return a, err == nil
+	case debug.Slice:
+		return v.Address, true
+	case sliceOf:
+		return v.Address, true
+	case debug.Channel:
+		return v.Address, true
+	case debug.Func:
+		return v.Address, true
+	}
+	return 0, false
+}
+
+// maxEmbeddingDepth limits how deeply selectField searches embedded structs
+// for a promoted field.
+const maxEmbeddingDepth = 16
+
+// selectField returns the result for the field named sel of the struct of
+// type st at address a.  As in Go, the field may be promoted from an embedded
+// struct or pointer to struct, as long as it is the only field with that name
+// at the shallowest depth where one is found.
+func (e *evaluator) selectField(a uint64, st *dwarf.StructType, sel string, getAddress bool) result {
+	type embedded struct {
+		a  uint64
+		st *dwarf.StructType
+	}
+	level := []embedded{{a, st}}
+	for depth := 0; len(level) > 0 && depth < maxEmbeddingDepth; depth++ {
+		var (
+			found  []*dwarf.StructField
+			foundA uint64
+			next   []embedded
+		)
+		for _, x := range level {
+			for _, f := range x.st.Field {
+				fa := x.a + uint64(f.ByteOffset)
+				if f.Name == sel {
+					found, foundA = append(found, f), fa
+					continue
+				}
+				if !f.Embedded {
+					continue
+				}
+				switch ft := followTypedefs(f.Type).(type) {
+				case *dwarf.StructType:
+					next = append(next, embedded{fa, ft})
+				case *dwarf.PtrType:
+					est, ok := followTypedefs(ft.Type).(*dwarf.StructType)
+					if !ok {
+						continue
+					}
+					p, err := e.server.peekPtr(fa)
+					if err != nil || p == 0 {
+						// A field promoted through a nil pointer can't be read, but
+						// this one may not be the field being selected.
+						continue
+					}
+					next = append(next, embedded{p, est})
+				}
+			}
+		}
+		switch len(found) {
+		case 0:
+			level = next
+			continue
+		case 1:
+			return e.resultFrom(foundA, found[0].Type, getAddress)
+		}
+		return e.err("ambiguous selector")
+	}
+	return e.err("struct field not found")
+}
+
+// dynamicValue returns the result for the value held by an interface, whose
+// type is the interface's dynamic type.
+func (e *evaluator) dynamicValue(iface debug.Interface, getAddress bool) result {
+	if iface.TypeID == 0 {
+		if iface.Data == 0 {
+			return e.runtimeErr("nil interface")
+		}
+		return e.runtimeErr("interface's dynamic type is unknown")
+	}
+	t, err := e.server.dwarfData.Type(dwarf.Offset(iface.TypeID))
+	if err != nil {
+		return e.runtimeErr(err.Error())
+	}
+	return e.resultFrom(iface.Value.Address, t, getAddress)
+}
+
+// isVariable reports whether name is the name of a local or global variable.
+func (e *evaluator) isVariable(name string) bool {
+	if e.pc != 0 && e.sp != 0 {
+		if _, t := e.server.findLocalVar(name, e.pc, e.sp); t != nil {
+			return true
+		}
+	}
+	_, t := e.server.findGlobalVar(name)
+	return t != nil
+}
+
+// functionName returns the name of the function that fun, the function
+// expression of a call, refers to, if it is a package-qualified function in
+// the program, like main.f.
+func (e *evaluator) functionName(fun ast.Expr) (string, bool) {
+	sel, ok := fun.(*ast.SelectorExpr)
+	if !ok {
+		return "", false
+	}
+	id, ok := sel.X.(*ast.Ident)
+	if !ok || e.isVariable(id.Name) {
+		return "", false
+	}
+	name := id.Name + "." + sel.Sel.Name
+	if _, err := e.server.dwarfData.LookupFunction(name); err != nil {
+		return "", false
+	}
+	return name, true
+}
+
+// callFunction calls the named function in the program with the given
+// arguments, and returns its result.  The function must have exactly one
+// result, and its arguments and result must be of types that are passed in
+// registers: booleans, numbers, pointers, and, for results, strings.
+func (e *evaluator) callFunction(name string, argNodes []ast.Expr) result {
+	if e.readOnly {
+		return e.err("functions can't be called in sampled or recorded expressions")
+	}
+	pc, params, results, err := e.server.funcSignature(name)
+	if err != nil {
+		return e.err(err.Error())
+	}
+	if len(argNodes) != len(params) {
+		return e.err(fmt.Sprintf("%s takes %d arguments, not %d", name, len(params), len(argNodes)))
+	}
+	if len(results) != 1 {
+		return e.err("only functions with one result can be called")
+	}
+	switch followTypedefs(results[0]).(type) {
+	case *dwarf.BoolType, *dwarf.CharType, *dwarf.IntType, *dwarf.UcharType, *dwarf.UintType,
+		*dwarf.FloatType, *dwarf.PtrType, *dwarf.StringType:
+	default:
+		return e.err("unsupported result type " + typeName(results[0]))
+	}
+	var args callArgs
+	for i, a := range argNodes {
+		x := e.evalNode(a, false)
+		if x.v == nil {
+			return x
+		}
+		bits, isFloat, err := e.callArgument(x, params[i])
+		if err != nil {
+			return e.err(err.Error())
+		}
+		if isFloat {
+			args.floats = append(args.floats, bits)
+		} else {
+			args.ints = append(args.ints, bits)
+		}
+	}
+	v, err := e.server.callFunction(pc, args, results[0])
+	if err != nil {
+		return e.runtimeErr(err.Error())
+	}
+	return result{results[0], v}
+}
+
+// callArgument converts x to the register contents for passing it to a
+// function parameter of type t, and reports whether it goes in a
+// floating-point register.  As with assignments in Go, typed values must
+// have the parameter's type, and constants must be representable by it.
+func (e *evaluator) callArgument(x result, t dwarf.Type) (bits uint64, isFloat bool, err error) {
+	if x.d != nil {
+		if _, ok := x.v.(pointerToValue); ok {
+			// x.d is the type of what x points to.
+			if "*"+typeName(x.d) != typeName(t) {
+				return 0, false, fmt.Errorf("can't use *%s as %s", typeName(x.d), typeName(t))
+			}
+		} else if typeName(x.d) != typeName(t) {
+			return 0, false, fmt.Errorf("can't use %s as %s", typeName(x.d), typeName(t))
+		}
+	}
+	size := t.Common().ByteSize
+	switch t := followTypedefs(t).(type) {
+	case *dwarf.CharType, *dwarf.IntType, *dwarf.UcharType, *dwarf.UintType:
+		_, signed := t.(*dwarf.IntType)
+		if _, ok := t.(*dwarf.CharType); ok {
+			signed = true
+		}
+		var c *big.Int
+		switch v := x.v.(type) {
+		case untInt:
+			c = v.Int
+		case untRune:
+			c = v.Int
+
+		case int8:
+			return uint64(v), false, nil
+
+		case int16:
+			return uint64(v), false, nil
+
+		case int32:
+			return uint64(v), false, nil
+
+		case int64:
+			return uint64(v), false, nil
+
+		case uint8:
+			return uint64(v), false, nil
+
+		case uint16:
+			return uint64(v), false, nil
+
+		case uint32:
+			return uint64(v), false, nil
+
+		case uint64:
+			return uint64(v), false, nil
+
+		default:
+			return 0, false, fmt.Errorf("can't use %v as %s", x.v, typeName(t))
+		}
+		// Check that the constant fits in the parameter's type.
+		bitSize := uint(size * 8)
+		min, max := new(big.Int), new(big.Int).Lsh(big.NewInt(1), bitSize)
+		if signed {
+			max.Rsh(max, 1)
+			min.Neg(max)
+		}
+		if c.Cmp(min) < 0 || c.Cmp(max) >= 0 {
+			return 0, false, fmt.Errorf("constant %v overflows %s", c, typeName(t))
+		}
+		if signed {
+			return uint64(c.Int64()), false, nil
+		}
+		return c.Uint64(), false, nil
+	case *dwarf.FloatType:
+		var f float64
+		switch v := x.v.(type) {
+		case untInt:
+			f, _ = new(big.Float).SetInt(v.Int).Float64()
+		case untFloat:
+			f, _ = v.Float64()
+		case float32:
+			return uint64(math.Float32bits(v)), true, nil
+		case float64:
+			return math.Float64bits(v), true, nil
+		default:
+			return 0, false, fmt.Errorf("can't use %v as %s", x.v, typeName(t))
+		}
+		if size == 4 {
+			return uint64(math.Float32bits(float32(f))), true, nil
+		}
+		return math.Float64bits(f), true, nil
+	case *dwarf.BoolType:
+		if v, ok := x.v.(bool); ok {
+			if v {
+				return 1, false, nil
+			}
+			return 0, false, nil
+		}
+	case *dwarf.PtrType:
+		switch v := x.v.(type) {
+		case untNil:
+			return 0, false, nil
+		case debug.Pointer:
+			return v.Address, false, nil
+		case pointerToValue:
+			return v.a, false, nil
+		}
+	default:
+		return 0, false, fmt.Errorf("unsupported parameter type %s", typeName(t))
+	}
+	return 0, false, fmt.Errorf("can't use %v as %s", x.v, typeName(t))
+}
+
 // findLocalVar finds a local variable (or function parameter) by name, and
 // returns its address and DWARF type.  It returns a nil type on failure.
 // The PC and SP are used to determine the current function and stack frame.
 func (s *Server) findLocalVar(name string, pc, sp uint64) (uint64, dwarf.Type) {
 	// Find the DWARF entry for the function at pc.
-	funcEntry, _, err := s.dwarfData.PCToFunction(uint64(pc))
+	funcEntry, _, err := s.pcToFunction(uint64(pc))
 	if err != nil {
 		return 0, nil
 	}
 
 	// Compute the stack frame pointer.
-	fpOffset, err := s.dwarfData.PCToSPOffset(uint64(pc))
+	fpOffset, err := s.pcToSPOffset(uint64(pc))
 	if err != nil {
 		return 0, nil
 	}
 	framePointer := sp + uint64(fpOffset)
 
-	// Check each child of the function's DWARF entry to see if it is a parameter
-	// or local variable with the right name.  If so, return its address and type.
-	r := s.dwarfData.Reader()
-	r.Seek(funcEntry.Offset)
-	for {
-		varEntry, err := r.Next()
-		if err != nil {
-			break
-		}
-		if varEntry.Tag == 0 {
-			// This tag marks the end of the function's DWARF entry's children.
-			break
-		}
+	// Check each parameter or local variable in scope at pc to see if it has
+	// the right name.  If so, return its address and type.  Variables in
+	// inner blocks come last, and shadow those in outer ones.
+	entries, _ := s.scopeEntries(funcEntry, pc)
+	for i := len(entries) - 1; i >= 0; i-- {
+		varEntry := entries[i]
 
-		// Check this entry corresponds to a local variable or function parameter,
-		// that it has the correct name, and that we can get its type and location.
-		// If so, return them.
-		if varEntry.Tag != dwarf.TagFormalParameter && varEntry.Tag != dwarf.TagVariable {
-			continue
-		}
+		// Check this entry has the correct name, and that we can get its type
+		// and location.  If so, return them.
 		varName, ok := varEntry.Val(dwarf.AttrName).(string)
 		if !ok {
 			continue
@@ -1612,19 +2137,11 @@ func (s *Server) findLocalVar(name string, pc, sp uint64) (uint64, dwarf.Type) {
 		if err != nil {
 			continue
 		}
-		locationAttribute := varEntry.Val(dwarf.AttrLocation)
-		if locationAttribute == nil {
-			continue
-		}
-		locationDescription, ok := locationAttribute.([]uint8)
-		if !ok {
-			continue
-		}
-		frameOffset, err := evalLocation(locationDescription)
+		addr, err := s.localAddress(funcEntry, varEntry, pc, framePointer)
 		if err != nil {
 			continue
 		}
-		return framePointer + uint64(frameOffset), varType
+		return addr, varType
 	}
 
 	return 0, nil
@@ -1637,7 +2154,7 @@ func (s *Server) findGlobalVar(name string) (uint64, dwarf.Type) {
 	if err != nil {
 		return 0, nil
 	}
-	loc, err := s.dwarfData.EntryLocation(entry)
+	loc, err := s.entryLocation(entry)
 	if err != nil {
 		return 0, nil
 	}
@@ -1713,14 +2230,14 @@ func (e *evaluator) getBaseType(name string) (dwarf.Type, bool) {
 // so resultFrom returns a result containing a value of type addressableValue.
 func (e *evaluator) resultFrom(a uint64, t dwarf.Type, getAddress bool) result {
 	if a == 0 {
-		return e.err("nil pointer dereference")
+		return e.runtimeErr("nil pointer dereference")
 	}
 	if getAddress {
 		return result{t, addressableValue{a}}
 	}
 	v, err := e.server.value(t, a)
 	if err != nil {
-		return e.err(err.Error())
+		return e.runtimeErr(err.Error())
 	}
 	return result{t, v}
 }
@@ -1781,8 +2298,9 @@ func (e *evaluator) zero(t dwarf.Type) result {
 	case *dwarf.SliceType:
 		v = debug.Slice{
 			Array: debug.Array{
-				ElementTypeID: uint64(typ.ElemType.Common().Offset),
-				StrideBits:    uint64(typ.ElemType.Common().ByteSize) * 8,
+				ElementTypeID:   uint64(typ.ElemType.Common().Offset),
+				ElementTypeName: typeName(typ.ElemType),
+				StrideBits:      uint64(typ.ElemType.Common().ByteSize) * 8,
 			},
 		}
 	case *dwarf.StringType:
@@ -1792,11 +2310,17 @@ func (e *evaluator) zero(t dwarf.Type) result {
 	case *dwarf.FuncType:
 		v = debug.Func{}
 	case *dwarf.MapType:
-		v = debug.Map{TypeID: uint64(t.Common().Offset)}
+		v = debug.Map{
+			TypeID:          uint64(t.Common().Offset),
+			KeyTypeName:     typeName(typ.KeyType),
+			ElementTypeName: typeName(typ.ElemType),
+		}
 	case *dwarf.ChanType:
 		v = debug.Channel{
-			ElementTypeID: uint64(typ.ElemType.Common().Offset),
-			Stride:        uint64(typ.ElemType.Common().ByteSize),
+			ElementTypeID:   uint64(typ.ElemType.Common().Offset),
+			ElementTypeName: typeName(typ.ElemType),
+			Dir:             chanDir(typ),
+			Stride:          uint64(typ.ElemType.Common().ByteSize),
 		}
 	default:
 		return e.err("can't get zero value of this type")
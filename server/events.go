@@ -0,0 +1,149 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Resuming the process asynchronously, and reporting what happens to it as
+// events.
+
+package server
+
+import (
+	"sync"
+	"syscall"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/server/protocol"
+)
+
+// eventQueue holds events until the client collects them.  Its methods are
+// safe for concurrent use, since events are collected outside the server's
+// request loop.
+type eventQueue struct {
+	mu     sync.Mutex
+	cond   sync.Cond // Signaled when an event is added, or the queue is closed.
+	events []debug.Event
+	closed bool
+}
+
+func newEventQueue() *eventQueue {
+	q := &eventQueue{}
+	q.cond.L = &q.mu
+	return q
+}
+
+func (q *eventQueue) push(e debug.Event) {
+	q.mu.Lock()
+	q.events = append(q.events, e)
+	q.cond.Broadcast()
+	q.mu.Unlock()
+}
+
+// pushIfRoom adds an event unless the queue already holds limit events.
+func (q *eventQueue) pushIfRoom(e debug.Event, limit int) {
+	q.mu.Lock()
+	if len(q.events) < limit {
+		q.events = append(q.events, e)
+		q.cond.Broadcast()
+	}
+	q.mu.Unlock()
+}
+
+// pop removes and returns the oldest event, waiting for one if there is none.
+// It returns false if the queue is closed.
+func (q *eventQueue) pop() (debug.Event, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.events) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if q.closed {
+		return debug.Event{}, false
+	}
+	e := q.events[0]
+	q.events = q.events[1:]
+	return e, true
+}
+
+// close discards the queue's events, and wakes the callers of pop.
+func (q *eventQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.events = nil
+	q.cond.Broadcast()
+	q.mu.Unlock()
+}
+
+// pushEvent delivers an event to every client: to each connection served by
+// ServeConn, or if there are none, to the queue for callers of the Server's
+// methods.
+func (s *Server) pushEvent(e debug.Event) {
+	if !s.clients.push(e, false) {
+		s.events.push(e)
+	}
+}
+
+// processEvent returns the event reporting that resuming the process ended
+// with status and err.
+func (s *Server) processEvent(status debug.Status, err error) debug.Event {
+	if err != nil && s.checkExited() {
+		err = s.exited
+	}
+	switch e := err.(type) {
+	case nil:
+		return debug.Event{Kind: "stop", Status: status}
+	case *debug.ProcessExited:
+		return debug.Event{Kind: "exit", Exit: e}
+	default:
+		return debug.Event{Kind: "error", Err: err.Error()}
+	}
+}
+
+// ResumeAsync queues the resumption of the process and returns as soon as the
+// request loop has accepted it, so that requests made afterwards are handled
+// after it.  The outcome is reported as an event.
+func (s *Server) ResumeAsync(req *protocol.ResumeAsyncRequest, resp *protocol.ResumeAsyncResponse) error {
+	// Nothing waits for the result, so the channel is buffered.
+	s.controlc <- call{req, nil, make(chan error, 1)}
+	return nil
+}
+
+func (s *Server) handleResumeAsync(req *protocol.ResumeAsyncRequest) error {
+	s.resumingAsync = true
+	var resp protocol.ResumeResponse
+	err := s.handleResume(&protocol.ResumeRequest{}, &resp)
+	s.resumingAsync = false
+	s.pushEvent(s.processEvent(resp.Status, err))
+	return nil
+}
+
+// signalReceived reports a signal received by thread pid while the process
+// was resumed asynchronously.  The signals the runtime uses for preemption
+// and profiling, and the SIGTRAPs and SIGSTOPs the debugger causes itself, are too frequent to be
+// interesting, so they aren't reported.
+func (s *Server) signalReceived(pid int, sig syscall.Signal) {
+	if !s.resumingAsync {
+		return
+	}
+	switch sig {
+	case syscall.SIGTRAP, sigurg, sigprof, sigstop:
+		return
+	}
+	s.pushEvent(debug.Event{Kind: "signal", Status: debug.Status{Thread: pid}, Signal: signalName(sig)})
+}
+
+// NextEvent is served directly rather than by the server's request loop,
+// since it waits until there is an event to report.
+func (s *Server) NextEvent(req *protocol.NextEventRequest, resp *protocol.NextEventResponse) error {
+	q := s.events
+	if req.Client != 0 {
+		if q = s.clients.queue(req.Client); q == nil {
+			return errConnClosed
+		}
+	}
+	e, ok := q.pop()
+	if !ok {
+		return errConnClosed
+	}
+	resp.Event = e
+	return nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Reading the message of a fatal error the runtime is about to report.
+
+package server
+
+import (
+	"errors"
+
+	"golang.org/x/debug"
+)
+
+// fatalFunctions are the runtime functions that report a fatal error,
+// printing "fatal error: " followed by their string argument, and then exit.
+var fatalFunctions = []string{"runtime.throw", "runtime.fatal"}
+
+// maxFatalMessage limits how much of a fatal error's message is read.
+const maxFatalMessage = 1024
+
+// fatalStatus fills in status.Fatal, and the goroutine and M that are
+// failing, if the stopped thread is at the start of one of fatalFunctions.
+func (s *Server) fatalStatus(status *debug.Status) {
+	regs := &s.stoppedRegs
+	fn := ""
+	for _, name := range fatalFunctions {
+		if pc, err := s.functionStartAddress(name); err == nil && pc == regs.Rip {
+			fn = name
+		}
+	}
+	if fn == "" {
+		return
+	}
+	msg, err := s.fatalMessage(regs)
+	if err != nil {
+		debug.Log(debug.LevelDebug, "reading fatal error message", debug.Field{Key: "function", Value: fn}, debug.Field{Key: "err", Value: err})
+		return
+	}
+	status.Fatal = "fatal error: " + msg
+	g, err := s.currentG(regs)
+	if err != nil || g == 0 {
+		return
+	}
+	gType, err := s.runtimeStruct("runtime.g")
+	if err != nil {
+		return
+	}
+	if id, err := s.peekUintOrIntStructField(gType, g, "goid"); err == nil {
+		status.FatalGoroutine = int64(id)
+	}
+	m, err := s.peekPtrStructField(gType, g, "m")
+	if err != nil || m == 0 {
+		return
+	}
+	mType, err := s.runtimeStruct("runtime.m")
+	if err != nil {
+		return
+	}
+	if id, err := s.peekUintOrIntStructField(mType, m, "id"); err == nil {
+		status.FatalM = int64(id)
+	}
+}
+
+// fatalMessage reads the string argument of a function the thread with
+// registers regs is at the start of.  The register ABI passes a string's
+// pointer and length in RAX and RBX; otherwise they are on the stack, above
+// the return address.
+func (s *Server) fatalMessage(regs *ptraceRegs) (string, error) {
+	ptr, length := regs.Rax, regs.Rbx
+	if !s.binaryInfo.RegisterABI {
+		var err error
+		size := uint64(s.arch.PointerSize)
+		if ptr, err = s.peekPtr(regs.Rsp + size); err != nil {
+			return "", err
+		}
+		if length, err = s.peekUint(regs.Rsp+2*size, int64(s.arch.IntSize)); err != nil {
+			return "", err
+		}
+	}
+	if ptr == 0 {
+		return "", errors.New("message is nil")
+	}
+	n := length
+	if n > maxFatalMessage {
+		n = maxFatalMessage
+	}
+	buf := make([]byte, n)
+	if err := s.peekBytes(ptr, buf); err != nil {
+		return "", err
+	}
+	if n < length {
+		return string(buf) + "...", nil
+	}
+	return string(buf), nil
+}
+
+// currentG returns the address of the g of the goroutine running on the
+// thread with registers regs.  Go code compiled for the register ABI keeps it
+// in R14; otherwise it is in thread-local storage, just below the FS base.
+func (s *Server) currentG(regs *ptraceRegs) (uint64, error) {
+	if s.binaryInfo.RegisterABI {
+		return regs.R14, nil
+	}
+	return s.peekPtr(regs.Fs_base - uint64(s.arch.PointerSize))
+}
@@ -0,0 +1,206 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Unwinding the frames of code that isn't Go's, such as the C code of a cgo
+// program and the C libraries it uses, with the call frame information in
+// the .eh_frame sections of the executable and the shared objects the
+// process has loaded.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/dwarf"
+	"golang.org/x/debug/elf"
+)
+
+// The DWARF numbers of the amd64 registers unwinding foreign frames uses.
+const (
+	dwarfRegBP = 6
+	dwarfRegSP = 7
+)
+
+// A foreignObject is the information from an ELF file for unwinding the
+// frames of its code, which has no Go frame information.
+type foreignObject struct {
+	frame *dwarf.EHFrame
+	funcs []elf.Symbol // The file's function symbols, in order of address.
+}
+
+// loadForeignObject reads the foreign object information of the ELF file at
+// path, or returns nil if it has no call frame information.
+func loadForeignObject(path string) *foreignObject {
+	f, err := elf.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	sect := f.Section(".eh_frame")
+	if sect == nil {
+		return nil
+	}
+	data, err := sect.Data()
+	if err != nil {
+		return nil
+	}
+	ptrSize := 8
+	if f.Class == elf.ELFCLASS32 {
+		ptrSize = 4
+	}
+	o := &foreignObject{frame: dwarf.NewEHFrame(data, sect.Addr, f.ByteOrder, ptrSize)}
+	for _, symbols := range []func() ([]elf.Symbol, error){f.Symbols, f.DynamicSymbols} {
+		syms, _ := symbols()
+		for _, sym := range syms {
+			if elf.ST_TYPE(sym.Info) == elf.STT_FUNC && sym.Value != 0 {
+				o.funcs = append(o.funcs, sym)
+			}
+		}
+	}
+	sort.Slice(o.funcs, func(i, j int) bool { return o.funcs[i].Value < o.funcs[j].Value })
+	return o
+}
+
+// function returns the name and start address of the function symbol
+// containing addr, in the file's addresses.
+func (o *foreignObject) function(addr uint64) (string, uint64, bool) {
+	i := sort.Search(len(o.funcs), func(i int) bool { return o.funcs[i].Value > addr })
+	if i == 0 {
+		return "", 0, false
+	}
+	sym := o.funcs[i-1]
+	if sym.Size != 0 && addr >= sym.Value+sym.Size {
+		return "", 0, false
+	}
+	return sym.Name, sym.Value, true
+}
+
+// foreignObjectAt returns the foreign object information of the executable
+// or shared object whose code is at pc, and the address the object is
+// loaded at, which is added to its addresses.
+func (s *Server) foreignObjectAt(pc uint64) (*foreignObject, uint64, error) {
+	if s.foreignObjs == nil {
+		s.foreignObjs = make(map[string]*foreignObject)
+	}
+	load := func(path string) *foreignObject {
+		o, ok := s.foreignObjs[path]
+		if !ok {
+			o = loadForeignObject(path)
+			s.foreignObjs[path] = o
+		}
+		return o
+	}
+	if o := load(s.executable); o != nil {
+		if _, err := o.frame.UnwindRule(pc - s.loadBias); err == nil {
+			return o, s.loadBias, nil
+		}
+	}
+	objs, err := s.sharedObjects()
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, obj := range objs {
+		if pc < obj.base {
+			continue
+		}
+		if o := load(obj.path); o != nil {
+			if _, err := o.frame.UnwindRule(pc - obj.base); err == nil {
+				return o, obj.base, nil
+			}
+		}
+	}
+	return nil, 0, fmt.Errorf("no frame information for PC %#x", pc)
+}
+
+// foreignFrame returns the frame of the foreign code at pc, whose stack
+// pointer and frame pointer registers are sp and bp, and the caller's pc,
+// sp and bp.  caller says whether the frame is a caller's, whose pc is the
+// return address from a call.  The caller's pc is zero if the frame is the
+// outermost one.
+func (s *Server) foreignFrame(pc, sp, bp uint64, caller bool) (f debug.Frame, callerPC, callerSP, callerBP uint64, err error) {
+	o, base, err := s.foreignObjectAt(pc)
+	if err != nil {
+		return f, 0, 0, 0, err
+	}
+	rule, err := o.frame.UnwindRule(pc - base)
+	if err != nil {
+		return f, 0, 0, 0, err
+	}
+	f = debug.Frame{
+		PC:            pc,
+		SP:            sp,
+		FunctionStart: rule.Start + base,
+		Kind:          "foreign",
+	}
+	linePC := pc
+	if caller {
+		linePC--
+	}
+	if name, start, ok := o.function(linePC - base); ok {
+		f.Function, f.FunctionStart = name, start+base
+	}
+	// C code compiled with debugging information has its source location.
+	if s.dwarfData != nil {
+		if file, line, err := s.lookupSource(linePC); err == nil && line != 0 {
+			f.File, f.Line = file, line
+		}
+	}
+
+	var cfa uint64
+	switch rule.CFARegister {
+	case dwarfRegSP:
+		cfa = sp
+	case dwarfRegBP:
+		cfa = bp
+	default:
+		return f, 0, 0, 0, fmt.Errorf("unsupported canonical frame address register %d at PC %#x", rule.CFARegister, pc)
+	}
+	cfa += uint64(rule.CFAOffset)
+	raOffset, ok := rule.Saved[rule.ReturnAddress]
+	if !ok {
+		// The outermost frame of a thread has no return address.
+		return f, 0, cfa, bp, nil
+	}
+	if callerPC, err = s.peekPtr(cfa + uint64(raOffset)); err != nil {
+		return f, 0, 0, 0, err
+	}
+	callerBP = bp
+	if off, ok := rule.Saved[dwarfRegBP]; ok {
+		if callerBP, err = s.peekPtr(cfa + uint64(off)); err != nil {
+			return f, 0, 0, 0, err
+		}
+	}
+	return f, callerPC, cfa, callerBP, nil
+}
+
+// cgoCallerSP returns the stack pointer of runtime.asmcgocall's frame on the
+// goroutine stack, given its stack pointer on the system stack after it
+// called the C code whose frames were unwound to reach it.  It saved the
+// depth of its goroutine stack pointer below the stack's top there, and
+// the goroutine, or if it was already on a system stack, nothing and the
+// stack pointer itself.
+func (s *Server) cgoCallerSP(sp uint64) (uint64, error) {
+	saved, err := s.peekPtr(sp)
+	if err != nil {
+		return 0, err
+	}
+	g, err := s.peekPtr(sp + uint64(s.arch.PointerSize))
+	if err != nil {
+		return 0, err
+	}
+	if g == 0 {
+		return saved, nil
+	}
+	hi, err := s.stackHi(g)
+	if err != nil {
+		return 0, err
+	}
+	if saved > hi {
+		return 0, errors.New("corrupt cgo call frame")
+	}
+	return hi - saved, nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Named groups of breakpoints, which can be enabled, disabled and deleted
+// together.
+
+package server
+
+import (
+	"fmt"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/server/protocol"
+)
+
+func (s *Server) SetBreakpointGroup(req *protocol.SetBreakpointGroupRequest, resp *protocol.SetBreakpointGroupResponse) error {
+	return s.call(s.breakpointc, req, resp)
+}
+
+func (s *Server) handleSetBreakpointGroup(req *protocol.SetBreakpointGroupRequest, resp *protocol.SetBreakpointGroupResponse) error {
+	bp, ok := s.userBreakpoints[req.ID]
+	if !ok {
+		return fmt.Errorf("no breakpoint with ID %d", req.ID)
+	}
+	bp.Group = req.Group
+	return nil
+}
+
+func (s *Server) EnableBreakpointGroup(req *protocol.EnableBreakpointGroupRequest, resp *protocol.EnableBreakpointGroupResponse) error {
+	return s.call(s.breakpointc, req, resp)
+}
+
+func (s *Server) handleEnableBreakpointGroup(req *protocol.EnableBreakpointGroupRequest, resp *protocol.EnableBreakpointGroupResponse) error {
+	bps := s.breakpointGroup(req.Group)
+	if len(bps) == 0 {
+		return fmt.Errorf("no breakpoints in group %q", req.Group)
+	}
+	var pcs []uint64
+	for _, bp := range bps {
+		if bp.Enabled != req.Enabled {
+			pcs = append(pcs, bp.PCs...)
+		}
+	}
+	if req.Enabled {
+		// If any breakpoint can't be inserted, none are enabled.
+		if err := s.insertBreakpointPCs(pcs); err != nil {
+			return err
+		}
+		for _, bp := range bps {
+			bp.Enabled = true
+		}
+		return nil
+	}
+	for _, bp := range bps {
+		bp.Enabled = false
+	}
+	return s.removeUnusedBreakpointPCs(pcs)
+}
+
+func (s *Server) DeleteBreakpointGroup(req *protocol.DeleteBreakpointGroupRequest, resp *protocol.DeleteBreakpointGroupResponse) error {
+	return s.call(s.breakpointc, req, resp)
+}
+
+func (s *Server) handleDeleteBreakpointGroup(req *protocol.DeleteBreakpointGroupRequest, resp *protocol.DeleteBreakpointGroupResponse) error {
+	var pcs []uint64
+	for _, bp := range s.breakpointGroup(req.Group) {
+		delete(s.userBreakpoints, bp.ID)
+		delete(s.breakpointSpecs, bp.ID)
+		delete(s.callerEntries, bp.ID)
+		pcs = append(pcs, bp.PCs...)
+	}
+	return s.removeUnusedBreakpointPCs(pcs)
+}
+
+// breakpointGroup returns the breakpoints in the named group.  Breakpoints
+// not in a group aren't in the group named "".
+func (s *Server) breakpointGroup(group string) []*debug.Breakpoint {
+	if group == "" {
+		return nil
+	}
+	var bps []*debug.Breakpoint
+	for _, bp := range s.userBreakpoints {
+		if bp.Group == group {
+			bps = append(bps, bp)
+		}
+	}
+	return bps
+}
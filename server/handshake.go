@@ -0,0 +1,48 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Negotiating the protocol with a client.
+
+package server
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	"golang.org/x/debug/server/protocol"
+)
+
+var (
+	featuresOnce sync.Once
+	features     []string
+)
+
+// Handshake replies at once, like Ping, with the server's protocol version and
+// features.  It fails if the client speaks a different version of the
+// protocol, since their calls couldn't be decoded reliably.
+func (s *Server) Handshake(req *protocol.HandshakeRequest, resp *protocol.HandshakeResponse) error {
+	if req.Version != protocol.Version {
+		return fmt.Errorf("debugproxy speaks protocol version %d, but the client speaks version %d; use a debugproxy built from the same version of the debugger", protocol.Version, req.Version)
+	}
+	featuresOnce.Do(func() {
+		// The features are the methods which net/rpc serves: those with a
+		// request and a response pointer, returning an error.
+		errorType := reflect.TypeOf((*error)(nil)).Elem()
+		t := reflect.TypeOf(s)
+		for i := 0; i < t.NumMethod(); i++ {
+			m := t.Method(i).Type
+			if m.NumIn() == 3 && m.In(2).Kind() == reflect.Ptr && m.NumOut() == 1 && m.Out(0) == errorType {
+				features = append(features, t.Method(i).Name)
+			}
+		}
+		sort.Strings(features)
+	})
+	resp.Version = protocol.Version
+	resp.Observer = req.Observer
+	resp.Session = s.sessionID
+	resp.Features = features
+	return nil
+}
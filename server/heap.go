@@ -0,0 +1,224 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Checking, using the runtime's heap metadata, that a variable is still part
+// of a live heap object.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/dwarf"
+)
+
+// pageSize is the size of the runtime's heap pages.
+const pageSize = 8192
+
+// Span states, as in the runtime's mSpanState.
+const (
+	spanDead   = 0
+	spanInUse  = 1
+	spanManual = 2 // Used for goroutine stacks.
+)
+
+// heapLayout describes the runtime's heap metadata, as found in the DWARF
+// data of the executable.
+type heapLayout struct {
+	arenas        uint64 // Address of mheap_.arenas.
+	l1Len, l2Len  uint64 // Lengths of the two levels of the arena map.
+	pagesPerArena uint64
+	baseOffset    uint64 // The runtime's arenaBaseOffset.
+	mspan         *dwarf.StructType
+}
+
+// heapLayout returns a description of the runtime's heap metadata, or an
+// error if the program's runtime doesn't have the expected structures, which
+// are those of Go 1.11 and later.
+func (s *Server) heapLayout() (*heapLayout, error) {
+	mheapEntry, err := s.dwarfData.LookupVariable("runtime.mheap_")
+	if err != nil {
+		return nil, err
+	}
+	mheapAddr, err := s.entryLocation(mheapEntry)
+	if err != nil {
+		return nil, err
+	}
+	mheapType, err := s.runtimeStruct("runtime.mheap")
+	if err != nil {
+		return nil, err
+	}
+	arenasField, err := getField(mheapType, "arenas")
+	if err != nil {
+		return nil, err
+	}
+	// arenas is a [l1Len]*[l2Len]*heapArena.
+	l1, ok := followTypedefs(arenasField.Type).(*dwarf.ArrayType)
+	if !ok {
+		return nil, errors.New("mheap_.arenas is not an array")
+	}
+	l2Ptr, ok := followTypedefs(l1.Type).(*dwarf.PtrType)
+	if !ok {
+		return nil, errors.New("mheap_.arenas does not hold pointers")
+	}
+	l2, ok := followTypedefs(l2Ptr.Type).(*dwarf.ArrayType)
+	if !ok {
+		return nil, errors.New("mheap_.arenas does not point to arrays")
+	}
+	arenaType, err := s.runtimeStruct("runtime.heapArena")
+	if err != nil {
+		return nil, err
+	}
+	spansField, err := getField(arenaType, "spans")
+	if err != nil {
+		return nil, err
+	}
+	spans, ok := followTypedefs(spansField.Type).(*dwarf.ArrayType)
+	if !ok || spansField.ByteOffset != 0 {
+		return nil, errors.New("unexpected type for heapArena.spans")
+	}
+	mspan, err := s.runtimeStruct("runtime.mspan")
+	if err != nil {
+		return nil, err
+	}
+	h := &heapLayout{
+		arenas:        mheapAddr + uint64(arenasField.ByteOffset),
+		l1Len:         uint64(l1.Count),
+		l2Len:         uint64(l2.Count),
+		pagesPerArena: uint64(spans.Count),
+		mspan:         mspan,
+	}
+	if s.binaryInfo.GOARCH == "amd64" {
+		// Heap addresses on amd64 are offset so that the arena map also
+		// covers negative addresses.
+		h.baseOffset = 0xffff800000000000
+	}
+	return h, nil
+}
+
+// runtimeStruct returns the struct type with the given name.
+func (s *Server) runtimeStruct(name string) (*dwarf.StructType, error) {
+	if s.dwarfData == nil {
+		return nil, errNoDWARF
+	}
+	entry, err := s.dwarfData.LookupEntry(name)
+	if err != nil {
+		return nil, err
+	}
+	t, err := s.dwarfData.Type(entry.Offset)
+	if err != nil {
+		return nil, err
+	}
+	st, ok := followTypedefs(t).(*dwarf.StructType)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a struct", name)
+	}
+	return st, nil
+}
+
+// checkHeapObject returns a *debug.ObjectFreed error if the size bytes at
+// addr are in the Go heap but not within a single allocated object.  It
+// returns nil if they are, if they aren't in the heap, or if the heap
+// metadata can't be read, so that the value is read as usual.
+func (s *Server) checkHeapObject(addr, size uint64) error {
+	if s.heap == nil {
+		h, err := s.heapLayout()
+		if err != nil {
+			return nil
+		}
+		s.heap = h
+	}
+	h := s.heap
+	freed := func(reason string) error {
+		return &debug.ObjectFreed{Address: addr, Reason: reason}
+	}
+
+	// Find the span holding addr.
+	arenaBytes := h.pagesPerArena * pageSize
+	ri := (addr - h.baseOffset) / arenaBytes
+	if ri >= h.l1Len*h.l2Len {
+		return nil
+	}
+	l2, err := s.peekPtr(h.arenas + ri/h.l2Len*uint64(s.arch.PointerSize))
+	if err != nil || l2 == 0 {
+		return nil
+	}
+	arena, err := s.peekPtr(l2 + ri%h.l2Len*uint64(s.arch.PointerSize))
+	if err != nil || arena == 0 {
+		// Not in the heap.
+		return nil
+	}
+	page := addr / pageSize % h.pagesPerArena
+	span, err := s.peekPtr(arena + page*uint64(s.arch.PointerSize))
+	if err != nil {
+		return nil
+	}
+	if span == 0 {
+		return freed("its memory is not in use by the heap")
+	}
+
+	// Check that the span is in use and contains addr.
+	stateField, err := getField(h.mspan, "state")
+	if err != nil {
+		return nil
+	}
+	state, err := s.peekUint8(span + uint64(stateField.ByteOffset))
+	if err != nil {
+		return nil
+	}
+	start, err := s.peekUintStructField(h.mspan, span, "startAddr")
+	if err != nil {
+		return nil
+	}
+	npages, err := s.peekUintStructField(h.mspan, span, "npages")
+	if err != nil {
+		return nil
+	}
+	if state != spanInUse && state != spanManual || addr < start || addr >= start+npages*pageSize {
+		return freed("its span has been freed")
+	}
+	if state == spanManual {
+		// Stack spans aren't divided into objects.
+		if addr+size > start+npages*pageSize {
+			return freed("it extends past the end of its stack")
+		}
+		return nil
+	}
+
+	// Find the object in the span holding addr, and check it is allocated.
+	elemSize, err := s.peekUintStructField(h.mspan, span, "elemsize")
+	if err != nil || elemSize == 0 {
+		return nil
+	}
+	index := (addr - start) / elemSize
+	if addr+size > start+(index+1)*elemSize {
+		return freed("it extends past the end of its object")
+	}
+	// Objects before the free index are allocated; after it, the allocation
+	// bits say which are.
+	freeIndex, err := s.peekUintStructField(h.mspan, span, "freeIndexForScan")
+	if err != nil {
+		freeIndex, err = s.peekUintStructField(h.mspan, span, "freeindex")
+	}
+	if err != nil {
+		return nil
+	}
+	if index < freeIndex {
+		return nil
+	}
+	allocBits, err := s.peekPtrStructField(h.mspan, span, "allocBits")
+	if err != nil || allocBits == 0 {
+		return nil
+	}
+	bits, err := s.peekUint8(allocBits + index/8)
+	if err != nil {
+		return nil
+	}
+	if bits&(1<<(index%8)) == 0 {
+		return freed("its object has been freed")
+	}
+	return nil
+}
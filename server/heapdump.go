@@ -0,0 +1,278 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Enumerating the live objects in the Go heap, from the runtime's spans.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/dwarf"
+	"golang.org/x/debug/server/protocol"
+)
+
+// maxHeapObjects limits how many objects HeapDump lists.
+const maxHeapObjects = 1 << 20
+
+// errTooManyObjects stops the enumeration of the heap's objects for HeapDump.
+var errTooManyObjects = fmt.Errorf("the heap has more than %d live objects", maxHeapObjects)
+
+func (s *Server) HeapStats(req *protocol.HeapStatsRequest, resp *protocol.HeapStatsResponse) error {
+	return s.call(s.otherc, req, resp)
+}
+
+func (s *Server) handleHeapStats(req *protocol.HeapStatsRequest, resp *protocol.HeapStatsResponse) error {
+	type key struct {
+		typeID uint64
+		size   uint64
+	}
+	stats := &resp.Stats
+	byType := make(map[key]*debug.HeapTypeStats)
+	err := s.heapObjects(stats, func(o debug.HeapObject, noscan bool) error {
+		stats.Objects++
+		stats.Bytes += o.Size
+		k := key{o.TypeID, o.Size}
+		t := byType[k]
+		if t == nil {
+			t = &debug.HeapTypeStats{TypeID: o.TypeID, TypeName: o.TypeName, Size: o.Size}
+			byType[k] = t
+		}
+		t.Objects++
+		t.Bytes += o.Size
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, t := range byType {
+		stats.Types = append(stats.Types, *t)
+	}
+	sort.Slice(stats.Types, func(i, j int) bool {
+		a, b := stats.Types[i], stats.Types[j]
+		if a.Bytes != b.Bytes {
+			return a.Bytes > b.Bytes
+		}
+		if a.TypeName != b.TypeName {
+			return a.TypeName < b.TypeName
+		}
+		return a.Size < b.Size
+	})
+	return nil
+}
+
+func (s *Server) HeapDump(req *protocol.HeapDumpRequest, resp *protocol.HeapDumpResponse) error {
+	return s.call(s.otherc, req, resp)
+}
+
+func (s *Server) handleHeapDump(req *protocol.HeapDumpRequest, resp *protocol.HeapDumpResponse) error {
+	err := s.heapObjects(nil, func(o debug.HeapObject, noscan bool) error {
+		if len(resp.Objects) == maxHeapObjects {
+			return errTooManyObjects
+		}
+		resp.Objects = append(resp.Objects, o)
+		return nil
+	})
+	if err != nil {
+		resp.Objects = nil
+		return err
+	}
+	sort.Slice(resp.Objects, func(i, j int) bool { return resp.Objects[i].Address < resp.Objects[j].Address })
+	return nil
+}
+
+// heapObjects calls fn for each live object in the heap, and whether the
+// object is known to hold no pointers, stopping if fn returns an error.  If
+// stats isn't nil, the spans holding objects are counted in it.
+func (s *Server) heapObjects(stats *debug.HeapStats, fn func(o debug.HeapObject, noscan bool) error) error {
+	if s.dwarfData == nil {
+		return errNoDWARF
+	}
+	mheapAddr, mheapType := s.findGlobalVar("runtime.mheap_")
+	if mheapType == nil {
+		return errors.New("runtime.mheap_ not found")
+	}
+	mheap, ok := followTypedefs(mheapType).(*dwarf.StructType)
+	if !ok {
+		return errors.New("runtime.mheap_ is not a struct")
+	}
+	f, err := getField(mheap, "allspans")
+	if err != nil {
+		return err
+	}
+	st, ok := followTypedefs(f.Type).(*dwarf.SliceType)
+	if !ok {
+		return errors.New("mheap_.allspans is not a slice")
+	}
+	allspans, err := s.peekSlice(st, mheapAddr+uint64(f.ByteOffset))
+	if err != nil {
+		return fmt.Errorf("reading mheap_.allspans: %v", err)
+	}
+	mspan, err := s.runtimeStruct("runtime.mspan")
+	if err != nil {
+		return err
+	}
+	r := &spanReader{s: s, mspan: mspan, types: make(map[uint64]dwarf.Type)}
+	ptrSize := uint64(s.arch.PointerSize)
+	for i := uint64(0); i < allspans.Length; i++ {
+		span, err := s.peekPtr(allspans.Address + i*ptrSize)
+		if err != nil {
+			return fmt.Errorf("reading mheap_.allspans: %v", err)
+		}
+		if err := r.objects(span, stats, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// A spanReader reads the live objects in the runtime's spans.
+type spanReader struct {
+	s     *Server
+	mspan *dwarf.StructType
+	buf   []byte
+	// types caches the DWARF types of runtime type descriptors, with nil
+	// for those that have none.
+	types map[uint64]dwarf.Type
+}
+
+// field returns the integer field name of the span read into r.buf.
+func (r *spanReader) field(name string) (uint64, error) {
+	f, err := getField(r.mspan, name)
+	if err != nil {
+		return 0, err
+	}
+	size := followTypedefs(f.Type).Size()
+	if f.ByteOffset < 0 || f.ByteOffset+size > int64(len(r.buf)) {
+		return 0, fmt.Errorf("invalid offset for mspan field %s", name)
+	}
+	switch size {
+	case 1, 2, 4, 8:
+	default:
+		return 0, fmt.Errorf("invalid size for mspan field %s", name)
+	}
+	return r.s.arch.UintN(r.buf[f.ByteOffset : f.ByteOffset+size]), nil
+}
+
+// objects calls fn for each live object in span, if it is in use for heap
+// objects.
+func (r *spanReader) objects(span uint64, stats *debug.HeapStats, fn func(debug.HeapObject, bool) error) error {
+	s := r.s
+	if span == 0 {
+		return nil
+	}
+	if r.buf == nil {
+		r.buf = make([]byte, r.mspan.ByteSize)
+	}
+	if err := s.peek(uintptr(span), r.buf); err != nil {
+		return fmt.Errorf("reading span at %#x: %v", span, err)
+	}
+	// state is an mSpanState, or in newer runtimes a struct holding one,
+	// whose first byte is the state.
+	f, err := getField(r.mspan, "state")
+	if err != nil {
+		return err
+	}
+	if f.ByteOffset >= int64(len(r.buf)) || r.buf[f.ByteOffset] != spanInUse {
+		return nil
+	}
+	start, err := r.field("startAddr")
+	if err != nil {
+		return err
+	}
+	npages, err := r.field("npages")
+	if err != nil {
+		return err
+	}
+	elemSize, err := r.field("elemsize")
+	if err != nil {
+		return err
+	}
+	nelems, err := r.field("nelems")
+	if err != nil {
+		return err
+	}
+	spanClass, err := r.field("spanclass")
+	if err != nil {
+		return err
+	}
+	freeIndex, err := r.field("freeindex")
+	if err != nil {
+		return err
+	}
+	if elemSize == 0 || nelems > npages*pageSize/elemSize {
+		return fmt.Errorf("invalid span at %#x", span)
+	}
+	if stats != nil {
+		stats.Spans++
+		stats.SpanBytes += npages * pageSize
+	}
+	// Objects before the free index are allocated; after it, the allocation
+	// bits say which are.
+	var bits []byte
+	if freeIndex < nelems {
+		allocBits, err := r.field("allocBits")
+		if err != nil {
+			return err
+		}
+		bits = make([]byte, (nelems+7)/8)
+		if err := s.peekBytes(allocBits, bits); err != nil {
+			return fmt.Errorf("reading allocation bits of span at %#x: %v", span, err)
+		}
+	}
+	// Since Go 1.22, the runtime records the types of objects that contain
+	// pointers and aren't small: in the span, for the single object of a
+	// large span, and otherwise in a header at the start of the object.
+	ptrSize := uint64(s.arch.PointerSize)
+	sizeClass, noscan := spanClass>>1, spanClass&1 != 0
+	largeType, typed := uint64(0), false
+	if _, err := getField(r.mspan, "largeType"); err == nil && !noscan {
+		if sizeClass == 0 {
+			largeType, err = r.field("largeType")
+			typed = err == nil
+		} else {
+			typed = elemSize > ptrSize*8*ptrSize
+		}
+	}
+	for i := uint64(0); i < nelems; i++ {
+		if i >= freeIndex && bits[i/8]&(1<<(i%8)) == 0 {
+			continue
+		}
+		o := debug.HeapObject{Address: start + i*elemSize, Size: elemSize}
+		if typed {
+			rtype := largeType
+			if sizeClass != 0 {
+				if rtype, err = s.peekPtr(o.Address); err != nil {
+					return fmt.Errorf("reading object header at %#x: %v", o.Address, err)
+				}
+				o.Address += ptrSize
+				o.Size -= ptrSize
+			}
+			if t := r.typ(rtype); t != nil {
+				o.TypeID, o.TypeName = uint64(t.Common().Offset), typeName(t)
+			}
+		}
+		if err := fn(o, noscan); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// typ returns the DWARF type described by the runtime type descriptor at
+// rtype, or nil if there is none.
+func (r *spanReader) typ(rtype uint64) dwarf.Type {
+	if rtype == 0 {
+		return nil
+	}
+	t, ok := r.types[rtype]
+	if !ok {
+		t, _ = r.s.runtimeTypeToDWARF(rtype)
+		r.types[rtype] = t
+	}
+	return t
+}
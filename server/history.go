@@ -0,0 +1,110 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Recording the values of expressions each time the process stops.
+
+package server
+
+import (
+	"fmt"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/server/protocol"
+)
+
+// history is a ring buffer holding the most recent values of an expression.
+type history struct {
+	entries []debug.HistoryEntry
+	next    int // Index where the next entry goes.
+	count   int // Number of entries recorded, at most len(entries).
+}
+
+func newHistory(n int) *history {
+	return &history{entries: make([]debug.HistoryEntry, n)}
+}
+
+// add records e, replacing the oldest entry if the buffer is full.
+func (h *history) add(e debug.HistoryEntry) {
+	h.entries[h.next] = e
+	h.next = (h.next + 1) % len(h.entries)
+	if h.count < len(h.entries) {
+		h.count++
+	}
+}
+
+// list returns the recorded entries, oldest first.
+func (h *history) list() []debug.HistoryEntry {
+	l := make([]debug.HistoryEntry, 0, h.count)
+	for i := len(h.entries) - h.count; i < len(h.entries); i++ {
+		l = append(l, h.entries[(h.next+i)%len(h.entries)])
+	}
+	return l
+}
+
+// resize changes the number of entries the buffer holds to n, keeping the
+// most recent ones.
+func (h *history) resize(n int) {
+	if n == len(h.entries) {
+		return
+	}
+	l := h.list()
+	if len(l) > n {
+		l = l[len(l)-n:]
+	}
+	h.entries = make([]debug.HistoryEntry, n)
+	h.count = copy(h.entries, l)
+	h.next = h.count % n
+}
+
+func (s *Server) History(req *protocol.HistoryRequest, resp *protocol.HistoryResponse) error {
+	return s.call(s.otherc, req, resp)
+}
+
+func (s *Server) handleHistory(req *protocol.HistoryRequest, resp *protocol.HistoryResponse) error {
+	if req.N < 0 {
+		return fmt.Errorf("History: negative length %d", req.N)
+	}
+	h, ok := s.histories[req.Expr]
+	if req.N == 0 {
+		if ok {
+			delete(s.histories, req.Expr)
+			s.cache.release(int64(len(h.entries)) * historyEntryBytes)
+			resp.Entries = h.list()
+		}
+		return nil
+	}
+	old := 0
+	if ok {
+		old = len(h.entries)
+	}
+	if n := int64(req.N-old) * historyEntryBytes; n < 0 {
+		// Shrinking frees memory that output waiting for the quota can use.
+		s.cache.release(-n)
+	} else if err := s.cache.reserve(n); err != nil {
+		return err
+	}
+	if !ok {
+		h = newHistory(req.N)
+		s.histories[req.Expr] = h
+	}
+	h.resize(req.N)
+	resp.Entries = h.list()
+	return nil
+}
+
+// recordHistories evaluates each recorded expression where the process has
+// just stopped, and adds the results to their histories.
+func (s *Server) recordHistories() {
+	s.stops++
+	for expr, h := range s.histories {
+		e := debug.HistoryEntry{Stop: s.stops, PC: s.stoppedRegs.Rip}
+		v, _, err := s.evalExpression(expr, s.stoppedRegs.Rip, s.stoppedRegs.Rsp)
+		if err != nil {
+			e.Err = err.Error()
+		} else {
+			e.Value = v
+		}
+		h.add(e)
+	}
+}
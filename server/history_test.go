@@ -0,0 +1,75 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/server/protocol"
+)
+
+func TestHistoryResize(t *testing.T) {
+	s := &Server{histories: make(map[string]*history), cache: newCacheQuota()}
+	s.SetQuotas(Quotas{CacheBytes: 10 * historyEntryBytes})
+	history := func(n int) []debug.HistoryEntry {
+		t.Helper()
+		var resp protocol.HistoryResponse
+		if err := s.handleHistory(&protocol.HistoryRequest{Expr: "x", N: n}, &resp); err != nil {
+			t.Fatalf("History(%d): %v", n, err)
+		}
+		return resp.Entries
+	}
+	used := func() int64 {
+		s.cache.mu.Lock()
+		defer s.cache.mu.Unlock()
+		return s.cache.used
+	}
+
+	history(8)
+	for stop := uint64(1); stop <= 5; stop++ {
+		s.histories["x"].add(debug.HistoryEntry{Stop: stop})
+	}
+	if got, want := used(), int64(8*historyEntryBytes); got != want {
+		t.Errorf("recording 8 values: %d bytes of cache used, want %d", got, want)
+	}
+
+	// Output waiting for room in the cache gets what shrinking the history
+	// frees.
+	done := make(chan bool)
+	go func() {
+		s.cache.wait(4 * historyEntryBytes)
+		done <- true
+	}()
+	select {
+	case <-done:
+		t.Fatal("output didn't wait for room")
+	case <-time.After(50 * time.Millisecond):
+	}
+	got := history(2)
+	if want := []debug.HistoryEntry{{Stop: 4}, {Stop: 5}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after shrinking to 2: got %v, want %v", got, want)
+	}
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("output still waiting after the history shrank")
+	}
+	if got, want := used(), int64(6*historyEntryBytes); got != want {
+		t.Errorf("after shrinking to 2: %d bytes of cache used, want %d", got, want)
+	}
+
+	// Growing back past the quota fails, and stopping recording frees the
+	// rest.
+	if err := s.handleHistory(&protocol.HistoryRequest{Expr: "x", N: 8}, &protocol.HistoryResponse{}); err == nil {
+		t.Error("growing the history past the quota succeeded")
+	}
+	history(0)
+	if got, want := used(), int64(4*historyEntryBytes); got != want {
+		t.Errorf("after stopping recording: %d bytes of cache used, want %d", got, want)
+	}
+}
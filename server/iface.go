@@ -0,0 +1,141 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Resolution of interface values to their dynamic types and values.
+
+package server
+
+import (
+	"fmt"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/dwarf"
+)
+
+// interfaceValue returns the interface value of type t at addr.  An empty
+// interface is a runtime.eface, whose _type field points to its dynamic type's
+// runtime type descriptor; other interfaces are a runtime.iface, whose tab
+// field points to an itab holding that pointer.  If the dynamic type has no
+// DWARF entry, the result's TypeID and Value are zero.
+func (s *Server) interfaceValue(t *dwarf.InterfaceType, addr uint64) (debug.Interface, error) {
+	st, ok := followTypedefs(&t.TypedefType).(*dwarf.StructType)
+	if !ok {
+		return debug.Interface{}, fmt.Errorf("bad interface type: not a struct")
+	}
+	dataField, err := getField(st, "data")
+	if err != nil {
+		return debug.Interface{}, err
+	}
+	data, err := s.peekPtr(addr + uint64(dataField.ByteOffset))
+	if err != nil {
+		return debug.Interface{}, fmt.Errorf("reading interface value: %s", err)
+	}
+	rtype, err := s.interfaceRuntimeType(st, addr)
+	if err != nil {
+		return debug.Interface{}, fmt.Errorf("reading interface type: %s", err)
+	}
+	iface := debug.Interface{Data: data}
+	if rtype == 0 {
+		// The interface is nil.
+		return iface, nil
+	}
+	dyn, err := s.runtimeTypeToDWARF(rtype)
+	if err != nil {
+		return iface, nil
+	}
+	iface.TypeID = uint64(dyn.Common().Offset)
+	iface.TypeName = typeName(dyn)
+	iface.Value = debug.Var{TypeID: iface.TypeID, Address: data}
+	if isDirectIface(dyn) {
+		// The data word holds the value itself rather than a pointer to it.
+		iface.Value.Address = addr + uint64(dataField.ByteOffset)
+	}
+	return iface, nil
+}
+
+// interfaceRuntimeType returns the address of the runtime type descriptor of
+// the dynamic type of the interface at addr, whose layout is st, or zero if
+// the interface is nil.
+func (s *Server) interfaceRuntimeType(st *dwarf.StructType, addr uint64) (uint64, error) {
+	if _, err := getField(st, "_type"); err == nil {
+		return s.peekPtrStructField(st, addr, "_type")
+	}
+	tabField, err := getField(st, "tab")
+	if err != nil {
+		return 0, err
+	}
+	tab, err := s.peekPtr(addr + uint64(tabField.ByteOffset))
+	if err != nil || tab == 0 {
+		return 0, err
+	}
+	pt, ok := followTypedefs(tabField.Type).(*dwarf.PtrType)
+	if !ok {
+		return 0, fmt.Errorf("interface's tab is not a pointer")
+	}
+	itab, ok := followTypedefs(pt.Type).(*dwarf.StructType)
+	if !ok {
+		return 0, fmt.Errorf("interface's tab is not a pointer to struct")
+	}
+	// The itab's field is named Type since Go 1.22, and _type before.
+	if _, err := getField(itab, "Type"); err == nil {
+		return s.peekPtrStructField(itab, tab, "Type")
+	}
+	return s.peekPtrStructField(itab, tab, "_type")
+}
+
+// runtimeTypeToDWARF returns the DWARF type described by the runtime type
+// descriptor at address rtype.  The linker identifies a type entry's
+// descriptor by its offset from the start of the module's type data, or, in
+// older binaries, by its address.
+func (s *Server) runtimeTypeToDWARF(rtype uint64) (dwarf.Type, error) {
+	if types, etypes, err := s.moduleTypes(); err == nil && types <= rtype && rtype < etypes {
+		if off, ok := s.dwarfData.LookupRuntimeType(rtype - types); ok {
+			return s.dwarfData.Type(off)
+		}
+	}
+	if off, ok := s.dwarfData.LookupRuntimeType(rtype - s.loadBias); ok {
+		return s.dwarfData.Type(off)
+	}
+	return nil, fmt.Errorf("no type found for runtime type at %#x", rtype)
+}
+
+// moduleTypes returns the bounds of the program's runtime type descriptors,
+// from the types and etypes fields of runtime.firstmoduledata.
+func (s *Server) moduleTypes() (types, etypes uint64, err error) {
+	entry, err := s.dwarfData.LookupVariable("runtime.firstmoduledata")
+	if err != nil {
+		return 0, 0, err
+	}
+	addr, err := s.entryLocation(entry)
+	if err != nil {
+		return 0, 0, err
+	}
+	md, err := s.runtimeStruct("runtime.moduledata")
+	if err != nil {
+		return 0, 0, err
+	}
+	if types, err = s.peekUintOrIntStructField(md, addr, "types"); err != nil {
+		return 0, 0, err
+	}
+	if etypes, err = s.peekUintOrIntStructField(md, addr, "etypes"); err != nil {
+		return 0, 0, err
+	}
+	return types, etypes, nil
+}
+
+// isDirectIface reports whether values of type t are stored directly in an
+// interface's data word, rather than pointed to by it.  That is the case for
+// pointer-shaped types: pointers, maps, channels, funcs, and structs and
+// arrays consisting of exactly one such value.
+func isDirectIface(t dwarf.Type) bool {
+	switch t := followTypedefs(t).(type) {
+	case *dwarf.PtrType, *dwarf.MapType, *dwarf.ChanType, *dwarf.FuncType:
+		return true
+	case *dwarf.StructType:
+		return len(t.Field) == 1 && isDirectIface(t.Field[0].Type)
+	case *dwarf.ArrayType:
+		return t.Count == 1 && isDirectIface(t.Type)
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// The calls that the compiler inlined: their frames, and breakpoints in each
+// inlined copy of a function.
+
+package server
+
+import (
+	"golang.org/x/debug"
+	"golang.org/x/debug/dwarf"
+)
+
+// inlinedCallsAt returns the inlined calls whose code contains pc, innermost
+// first.
+func (s *Server) inlinedCallsAt(pc uint64) []*dwarf.InlinedCall {
+	if s.dwarfData == nil {
+		return nil
+	}
+	return s.dwarfData.InlinedCallsAt(pc - s.loadBias)
+}
+
+// inlinedFrames returns the frames of the calls inlined into the function of
+// the frame f at its PC, innermost first, and changes f's source location to
+// that of the outermost call.  The function has entry funcEntry and frame
+// pointer fp, and caller says whether f is a caller's frame, whose PC is the
+// return address from a call.
+func (s *Server) inlinedFrames(f *debug.Frame, funcEntry *dwarf.Entry, fp uint64, caller bool) []debug.Frame {
+	pc := f.PC
+	if caller {
+		// The return address can be just past the end of the inlined code
+		// containing the call.
+		pc--
+	}
+	calls := s.inlinedCallsAt(pc)
+	if len(calls) == 0 {
+		return nil
+	}
+	frames := make([]debug.Frame, 0, len(calls))
+	for _, c := range calls {
+		frame := debug.Frame{
+			PC:            f.PC,
+			SP:            f.SP,
+			File:          f.File,
+			Line:          f.Line,
+			Function:      dwarf.DemangleShapes(c.Function),
+			FunctionStart: c.EntryPC() + s.loadBias,
+			Kind:          frameKind(c.Function),
+			Inlined:       true,
+		}
+		// Failing to read the variables of an inlined call shouldn't lose
+		// the rest of the stack.
+		frame.Params, frame.Vars, _ = s.scopeVariables(funcEntry, c.Entry, f.PC, fp, caller)
+		frames = append(frames, frame)
+		if c.CallFile != "" {
+			f.File, f.Line = c.CallFile, c.CallLine
+		}
+	}
+	return frames
+}
+
+// inlinedEntryPCs returns the addresses of the starts of the copies of the
+// named function that the compiler inlined.
+func (s *Server) inlinedEntryPCs(name string) []uint64 {
+	if s.dwarfData == nil {
+		return nil
+	}
+	var pcs []uint64
+	for _, c := range s.dwarfData.InlinedCallsOf(name) {
+		pcs = append(pcs, c.EntryPC()+s.loadBias)
+	}
+	return pcs
+}
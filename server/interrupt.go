@@ -0,0 +1,22 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Interrupting the process while it runs.
+
+package server
+
+import "golang.org/x/debug/server/protocol"
+
+// Interrupt is served like the breakpoint requests, so that if the process is
+// running, Resume stops the thread it is waiting on to serve it.  Resume then
+// returns with the thread stopped, rather than continuing it.
+func (s *Server) Interrupt(req *protocol.InterruptRequest, resp *protocol.InterruptResponse) error {
+	return s.call(s.breakpointc, req, resp)
+}
+
+// handleInterrupt serves an Interrupt that arrives while the process isn't
+// running, so there is nothing to do.
+func (s *Server) handleInterrupt(req *protocol.InterruptRequest, resp *protocol.InterruptResponse) error {
+	return nil
+}
@@ -0,0 +1,190 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Serving clients with JSON-RPC 2.0, for front ends not written in Go.
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/rpc"
+	"strings"
+	"sync"
+)
+
+// JSON-RPC 2.0 error codes.
+const (
+	jsonParseError     = -32700
+	jsonInvalidRequest = -32600
+	jsonMethodNotFound = -32601
+	jsonInvalidParams  = -32602
+	jsonServerError    = -32000
+)
+
+// ServeJSONConn serves the client at the other end of conn, like ServeConn,
+// but with JSON-RPC 2.0 rather than net/rpc's gob encoding.
+//
+// The requests and responses are JSON values, one after another; the server
+// ends each response with a newline.  A request's method is the name of one
+// of the Server's methods, such as "Value" or "Server.Value", and its params
+// are the fields of the method's request type from package protocol, given
+// as an object, or an array holding the object.  The result is the method's
+// response type.  A request without an id is a notification, and isn't
+// answered.  Requests whose types hold a debug.Value, such as AsPointer,
+// can't be made, since the value's dynamic type can't be decoded.
+func (s *Server) ServeJSONConn(conn io.ReadWriteCloser, observer bool) {
+	enc := json.NewEncoder(conn)
+	enc.SetEscapeHTML(false)
+	s.serveCodec(&jsonCodec{
+		rwc:     conn,
+		dec:     json.NewDecoder(conn),
+		enc:     enc,
+		pending: make(map[uint64]*json.RawMessage),
+	}, observer)
+}
+
+type jsonRequest struct {
+	Version string           `json:"jsonrpc"`
+	Method  string           `json:"method"`
+	Params  json.RawMessage  `json:"params"`
+	ID      *json.RawMessage `json:"id"`
+}
+
+type jsonResponse struct {
+	Version string           `json:"jsonrpc"`
+	Result  interface{}      `json:"result,omitempty"`
+	Error   *jsonError       `json:"error,omitempty"`
+	ID      *json.RawMessage `json:"id"`
+}
+
+type jsonError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// errInvalidParams is returned by jsonCodec.ReadRequestBody when a request's
+// params aren't of its method's request type.
+type errInvalidParams struct {
+	err error
+}
+
+func (e errInvalidParams) Error() string {
+	return "invalid params: " + e.err.Error()
+}
+
+// jsonCodec is a net/rpc codec for JSON-RPC 2.0.  Its responses and Close are
+// serialized by serverCodec.
+type jsonCodec struct {
+	rwc io.ReadWriteCloser
+	dec *json.Decoder
+	enc *json.Encoder
+	req jsonRequest // The request being read.
+
+	mu      sync.Mutex // Guards seq and pending, used by reads and responses.
+	seq     uint64
+	pending map[uint64]*json.RawMessage // The IDs of requests, keyed by sequence number; nil for notifications.
+}
+
+func (c *jsonCodec) ReadRequestHeader(r *rpc.Request) error {
+	for {
+		c.req = jsonRequest{}
+		if err := c.dec.Decode(&c.req); err != nil {
+			if _, ok := err.(*json.SyntaxError); ok {
+				// The rest of the stream can't be parsed either.
+				c.mu.Lock()
+				c.writeError(nil, jsonParseError, err.Error())
+				c.mu.Unlock()
+			}
+			return err
+		}
+		if c.req.Version == "2.0" && c.req.Method != "" {
+			break
+		}
+		// The request can't be served, so answer it here.
+		c.mu.Lock()
+		err := c.writeError(c.req.ID, jsonInvalidRequest, `request needs "jsonrpc": "2.0" and a method`)
+		c.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	r.ServiceMethod = c.req.Method
+	if !strings.Contains(r.ServiceMethod, ".") {
+		r.ServiceMethod = "Server." + r.ServiceMethod
+	}
+	c.mu.Lock()
+	c.seq++
+	c.pending[c.seq] = c.req.ID
+	r.Seq = c.seq
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *jsonCodec) ReadRequestBody(body interface{}) error {
+	params := bytes.TrimSpace(c.req.Params)
+	if body == nil || len(params) == 0 || string(params) == "null" {
+		return nil
+	}
+	if params[0] == '[' {
+		var list []json.RawMessage
+		if err := json.Unmarshal(params, &list); err != nil {
+			return errInvalidParams{err}
+		}
+		switch len(list) {
+		case 0:
+			return nil
+		case 1:
+			params = list[0]
+		default:
+			return errInvalidParams{errors.New("params array must hold one object")}
+		}
+	}
+	if err := json.Unmarshal(params, body); err != nil {
+		return errInvalidParams{err}
+	}
+	return nil
+}
+
+func (c *jsonCodec) WriteResponse(r *rpc.Response, body interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id, ok := c.pending[r.Seq]
+	if !ok {
+		return errors.New("invalid sequence number in response")
+	}
+	delete(c.pending, r.Seq)
+	if id == nil {
+		// The request was a notification.
+		return nil
+	}
+	if r.Error != "" {
+		code := jsonServerError
+		switch {
+		case strings.HasPrefix(r.Error, "rpc: can't find"):
+			code = jsonMethodNotFound
+		case strings.HasPrefix(r.Error, "invalid params: "):
+			code = jsonInvalidParams
+		}
+		return c.writeError(id, code, r.Error)
+	}
+	return c.enc.Encode(jsonResponse{Version: "2.0", Result: body, ID: id})
+}
+
+// writeError writes an error response to the request with the given ID,
+// which is nil if it couldn't be read.  c.mu must be held.
+func (c *jsonCodec) writeError(id *json.RawMessage, code int, message string) error {
+	if id == nil {
+		id = &jsonNull
+	}
+	return c.enc.Encode(jsonResponse{Version: "2.0", Error: &jsonError{code, message}, ID: id})
+}
+
+var jsonNull = json.RawMessage("null")
+
+func (c *jsonCodec) Close() error {
+	return c.rwc.Close()
+}
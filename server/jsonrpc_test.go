@@ -0,0 +1,223 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/server/protocol"
+)
+
+// jsonTestProgram is run by TestJSONRoundTrip.
+const jsonTestProgram = `package main
+
+import "os"
+
+func main() {
+	os.Exit(3)
+}
+`
+
+// buildJSONTestProgram builds jsonTestProgram in dir, returning the name
+// of the executable.
+func buildJSONTestProgram(t *testing.T, dir string) string {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+	src := filepath.Join(dir, "main.go")
+	if err := ioutil.WriteFile(src, []byte(jsonTestProgram), 0644); err != nil {
+		t.Fatal(err)
+	}
+	exe := filepath.Join(dir, "exit3")
+	cmd := exec.Command("go", "build", "-o", exe, src)
+	cmd.Env = append(os.Environ(), "GO111MODULE=off")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("building test program: %v\n%s", err, out)
+	}
+	return exe
+}
+
+// jsonClient makes JSON-RPC 2.0 calls over a connection served by
+// ServeJSONConn.
+type jsonClient struct {
+	t    *testing.T
+	conn net.Conn
+	dec  *json.Decoder
+	id   int
+}
+
+func newJSONClient(t *testing.T, s *Server, observer bool) *jsonClient {
+	client, conn := net.Pipe()
+	go s.ServeJSONConn(conn, observer)
+	return &jsonClient{t: t, conn: client, dec: json.NewDecoder(client)}
+}
+
+// send writes a request, as the raw JSON given.
+func (c *jsonClient) send(request string) {
+	c.conn.SetDeadline(time.Now().Add(time.Minute))
+	if _, err := io.WriteString(c.conn, request+"\n"); err != nil {
+		c.t.Fatalf("sending %s: %v", request, err)
+	}
+}
+
+// response reads the next response, failing the test if its ID isn't id.
+// It returns the response's error, after decoding its result into result.
+func (c *jsonClient) response(id string, result interface{}) *jsonError {
+	var resp struct {
+		Version string          `json:"jsonrpc"`
+		Result  json.RawMessage `json:"result"`
+		Error   *jsonError      `json:"error"`
+		ID      json.RawMessage `json:"id"`
+	}
+	if err := c.dec.Decode(&resp); err != nil {
+		c.t.Fatalf("reading response %s: %v", id, err)
+	}
+	if resp.Version != "2.0" || string(resp.ID) != id {
+		c.t.Fatalf("got response with version %q and ID %s, want 2.0 and %s", resp.Version, resp.ID, id)
+	}
+	if resp.Error == nil && result != nil {
+		if err := json.Unmarshal(resp.Result, result); err != nil {
+			c.t.Fatalf("decoding result %s: %v", resp.Result, err)
+		}
+	}
+	return resp.Error
+}
+
+// call calls method with params, and decodes its result into result.
+func (c *jsonClient) call(method string, params, result interface{}) *jsonError {
+	c.id++
+	p, err := json.Marshal(params)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.send(fmt.Sprintf(`{"jsonrpc": "2.0", "id": %d, "method": %q, "params": %s}`, c.id, method, p))
+	return c.response(fmt.Sprint(c.id), result)
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jsonrpc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := New(buildJSONTestProgram(t, dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newJSONClient(t, s, false)
+	defer c.conn.Close()
+	observer := newJSONClient(t, s, true)
+	defer observer.conn.Close()
+
+	// A call served without a process.
+	var hs protocol.HandshakeResponse
+	if e := c.call("Handshake", protocol.HandshakeRequest{Version: protocol.Version}, &hs); e != nil {
+		t.Fatalf("Handshake: %v", e.Message)
+	}
+	if hs.Version != protocol.Version || hs.Observer {
+		t.Errorf("Handshake: got version %d, observer %t; want %d, false", hs.Version, hs.Observer, protocol.Version)
+	}
+	if e := observer.call("Handshake", protocol.HandshakeRequest{Version: protocol.Version}, &hs); e != nil || !hs.Observer {
+		t.Errorf("observer's Handshake: got error %v, observer %t", e, hs.Observer)
+	}
+
+	// A call controlling the process, with its params in an array and its
+	// method named with the service.
+	var run protocol.RunResponse
+	if e := c.call("Server.Run", []protocol.RunRequest{{}}, &run); e != nil {
+		t.Fatalf("Run: %v", e.Message)
+	}
+
+	// A call about breakpoints.
+	var bp protocol.BreakpointResponse
+	if e := c.call("BreakpointAtFunction", protocol.BreakpointAtFunctionRequest{Function: "main.main"}, &bp); e != nil {
+		t.Fatalf("BreakpointAtFunction: %v", e.Message)
+	}
+	if len(bp.Breakpoint.PCs) == 0 {
+		t.Fatalf("BreakpointAtFunction: no PCs in %+v", bp.Breakpoint)
+	}
+	var resume protocol.ResumeResponse
+	if e := c.call("Resume", protocol.ResumeRequest{}, &resume); e != nil {
+		t.Fatalf("Resume: %v", e.Message)
+	}
+	if resume.Status.Reason != "breakpoint" || len(resume.Status.Breakpoints) != 1 || resume.Status.Breakpoints[0] != bp.Breakpoint.ID {
+		t.Errorf("Resume: got status %+v, want a stop at breakpoint %d", resume.Status, bp.Breakpoint.ID)
+	}
+	var stop protocol.NextEventResponse
+	if e := observer.call("NextEvent", protocol.NextEventRequest{}, &stop); e != nil || stop.Event.Kind != "stop" {
+		t.Errorf("observer's NextEvent: got error %v, event %+v; want a stop", e, stop.Event)
+	}
+
+	// A call examining the stopped process.
+	var frames protocol.FramesResponse
+	if e := c.call("Frames", protocol.FramesRequest{Count: 1}, &frames); e != nil {
+		t.Fatalf("Frames: %v", e.Message)
+	}
+	if len(frames.Frames) != 1 || frames.Frames[0].Function != "main.main" {
+		t.Errorf("Frames: got %+v, want main.main's frame", frames.Frames)
+	}
+
+	// A notification isn't answered, so the next response is to the
+	// request after it.
+	c.send(`{"jsonrpc": "2.0", "method": "Ping"}`)
+
+	// Errors.
+	errorTests := []struct {
+		request  string
+		id       string
+		code     int
+		observer bool // Whether the observer makes the request.
+	}{
+		{`{"jsonrpc": "2.0", "id": "a", "method": "NoSuchMethod"}`, `"a"`, jsonMethodNotFound, false},
+		{`{"jsonrpc": "2.0", "id": "b", "method": "Frames", "params": {"Count": "one"}}`, `"b"`, jsonInvalidParams, false},
+		{`{"jsonrpc": "2.0", "id": "c", "method": "Frames", "params": [{}, {}]}`, `"c"`, jsonInvalidParams, false},
+		{`{"id": "d", "method": "Frames"}`, `"d"`, jsonInvalidRequest, false},
+		{`{"jsonrpc": "2.0", "id": "e", "method": "BreakpointAtFunction", "params": {"Function": "main.nosuchfunction"}}`, `"e"`, jsonServerError, false},
+		{`{"jsonrpc": "2.0", "id": "f", "method": "Run"}`, `"f"`, jsonServerError, true},
+	}
+	for _, tt := range errorTests {
+		client := c
+		if tt.observer {
+			client = observer
+		}
+		client.send(tt.request)
+		if e := client.response(tt.id, nil); e == nil || e.Code != tt.code {
+			t.Errorf("%s: got error %+v, want code %d", tt.request, e, tt.code)
+		}
+	}
+
+	// The process's exit is reported to the controlling client as the error
+	// message of a *debug.ProcessExited, and to observers as an event
+	// holding it.
+	want := &debug.ProcessExited{ExitStatus: 3}
+	e := c.call("Resume", protocol.ResumeRequest{}, nil)
+	if e == nil || e.Code != jsonServerError || e.Message != want.Error() {
+		t.Errorf("Resume to exit: got error %+v, want %q", e, want.Error())
+	}
+	var exit protocol.NextEventResponse
+	if e := observer.call("NextEvent", protocol.NextEventRequest{}, &exit); e != nil {
+		t.Fatalf("observer's NextEvent: %v", e.Message)
+	}
+	if exit.Event.Kind != "exit" || exit.Event.Exit == nil || *exit.Event.Exit != *want {
+		t.Errorf("observer's NextEvent: got %+v, want an exit with status 3", exit.Event)
+	}
+
+	// After a parse error, the connection is closed.
+	c.send(`{"jsonrpc": `)
+	c.send(`}`)
+	if e := c.response("null", nil); e == nil || e.Code != jsonParseError {
+		t.Errorf("unparseable request: got error %+v, want code %d", e, jsonParseError)
+	}
+}
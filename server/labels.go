@@ -0,0 +1,104 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Reading the profiler labels of goroutines, which runtime/pprof keeps for
+// the runtime.
+
+package server
+
+import (
+	"errors"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/dwarf"
+)
+
+// maxLabels limits how many of a goroutine's labels are read, in case they
+// are corrupt.
+const maxLabels = 1000
+
+// goroutineLabels returns the profiler labels of the goroutine g, or nil if
+// it has none.  Its labels field points to a runtime/pprof.labelMap, which
+// is a map from keys to values, or since Go 1.24 a struct holding a slice
+// of keys and values.
+func (s *Server) goroutineLabels(gType *dwarf.StructType, g uint64) (map[string]string, error) {
+	labels, err := s.peekPtrStructField(gType, g, "labels")
+	if err != nil || labels == 0 {
+		return nil, err
+	}
+	entry, err := s.dwarfData.LookupEntry("runtime/pprof.labelMap")
+	if err != nil {
+		return nil, err
+	}
+	t, err := s.dwarfData.Type(entry.Offset)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]string)
+	str := func(t dwarf.Type, addr uint64) (string, error) {
+		v, err := s.value(t, addr)
+		if err != nil {
+			return "", err
+		}
+		sv, ok := v.(debug.String)
+		if !ok {
+			return "", errors.New("profiler label is not a string")
+		}
+		return sv.String, nil
+	}
+
+	if mt, ok := followTypedefs(t).(*dwarf.MapType); ok {
+		var serr error
+		err := s.peekMapValues(mt, labels, func(keyAddr, valAddr uint64, keyType, valType dwarf.Type) bool {
+			var k, v string
+			if k, serr = str(keyType, keyAddr); serr != nil {
+				return false
+			}
+			if v, serr = str(valType, valAddr); serr != nil {
+				return false
+			}
+			m[k] = v
+			return len(m) < maxLabels
+		})
+		if err == nil {
+			err = serr
+		}
+		return m, err
+	}
+
+	// Find the slice of labels, in the struct the labelMap holds.
+	for {
+		st, ok := followTypedefs(t).(*dwarf.StructType)
+		if !ok || len(st.Field) != 1 {
+			break
+		}
+		labels += uint64(st.Field[0].ByteOffset)
+		t = st.Field[0].Type
+	}
+	st, ok := followTypedefs(t).(*dwarf.SliceType)
+	if !ok {
+		return nil, errors.New("unexpected type for runtime/pprof.labelMap")
+	}
+	list, err := s.peekSlice(st, labels)
+	if err != nil {
+		return nil, err
+	}
+	label, ok := followTypedefs(st.ElemType).(*dwarf.StructType)
+	if !ok || len(label.Field) != 2 {
+		return nil, errors.New("unexpected type for profiler labels")
+	}
+	for i := uint64(0); i < list.Length && i < maxLabels; i++ {
+		addr := list.Address + i*uint64(label.ByteSize)
+		k, err := str(label.Field[0].Type, addr+uint64(label.Field[0].ByteOffset))
+		if err != nil {
+			return nil, err
+		}
+		v, err := str(label.Field[1].Type, addr+uint64(label.Field[1].ByteOffset))
+		if err != nil {
+			return nil, err
+		}
+		m[k] = v
+	}
+	return m, nil
+}
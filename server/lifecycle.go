@@ -0,0 +1,127 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Killing and restarting the process.
+
+package server
+
+import (
+	"fmt"
+	"sort"
+	"syscall"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/server/protocol"
+)
+
+func (s *Server) Kill(req *protocol.KillRequest, resp *protocol.KillResponse) error {
+	return s.call(s.controlc, req, resp)
+}
+
+func (s *Server) handleKill(req *protocol.KillRequest, resp *protocol.KillResponse) error {
+	if s.proc == nil {
+		return fmt.Errorf("Kill: Run did not successfully start a process")
+	}
+	if s.exited != nil {
+		return nil
+	}
+	return s.killProcess()
+}
+
+// killProcess kills the process and waits for it to exit, so that its exit
+// status is recorded and it doesn't linger as a zombie.
+func (s *Server) killProcess() error {
+	if err := s.proc.Kill(); err != nil {
+		return err
+	}
+	for {
+		// The process's other threads are traced too, and must be reaped
+		// before its main thread's exit is reported.
+		wpid, status, err := s.wait(-1, false)
+		if err == syscall.ECHILD {
+			s.setExited(&debug.ProcessExited{ExitStatus: -1})
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("wait: %v", err)
+		}
+		if wpid == s.proc.Pid && (status.Exited() || status.Signaled()) {
+			s.setExited(processExited(status))
+			return nil
+		}
+	}
+}
+
+func (s *Server) Restart(req *protocol.RestartRequest, resp *protocol.RestartResponse) error {
+	return s.call(s.controlc, req, resp)
+}
+
+func (s *Server) handleRestart(req *protocol.RestartRequest, resp *protocol.RestartResponse) error {
+	if s.lastRun == nil {
+		return fmt.Errorf("Restart: Run has not been called")
+	}
+	if !req.KeepBreakpoints {
+		s.userBreakpoints = make(map[uint64]*debug.Breakpoint)
+		s.breakpointSpecs = make(map[uint64]breakpointSpec)
+		s.callerEntries = make(map[uint64]uint64)
+		s.breakpoints = make(map[uint64]breakpoint)
+		s.watchpoints = make(map[uint64]*watchpoint)
+		s.calls = nil
+	}
+	run := *s.lastRun
+	var runResp protocol.RunResponse
+	err := s.handleRun(&run, &runResp)
+	resp.Status = runResp.Status
+	return err
+}
+
+// resolveBreakpoints re-establishes the breakpoints in a newly started
+// process, finding their addresses again from where the client asked for
+// them, since the executable may be loaded at a different address from the
+// previous process's, or have been rebuilt.  It returns the IDs of the
+// breakpoints that could no longer be found.
+func (s *Server) resolveBreakpoints() ([]uint64, error) {
+	s.breakpoints = make(map[uint64]breakpoint)
+	// A process restored from a checkpoint can have loaded different
+	// shared objects, and a new one has loaded none yet.
+	s.objects = nil
+	if _, _, err := s.readLinkMap(); err != nil {
+		return nil, fmt.Errorf("reading the shared objects: %v", err)
+	}
+	var unresolved []uint64
+	for id, bp := range s.userBreakpoints {
+		s.resolveBreakpoint(id)
+		if bp.Pending {
+			debug.Log(debug.LevelWarn, "breakpoint not found", debug.Field{Key: "id", Value: id}, debug.Field{Key: "err", Value: bp.Err})
+			unresolved = append(unresolved, id)
+			continue
+		}
+		if !bp.Enabled {
+			continue
+		}
+		// The original instructions are read again, in case the
+		// executable has changed.
+		if err := s.insertBreakpointPCs(bp.PCs); err != nil {
+			return nil, fmt.Errorf("re-establishing breakpoint %d: %v", id, err)
+		}
+	}
+	sort.Slice(unresolved, func(i, j int) bool { return unresolved[i] < unresolved[j] })
+	if err := s.resolveCallProbes(); err != nil {
+		return nil, err
+	}
+	s.panicStops = nil
+	if err := s.insertPanicStops(); err != nil {
+		return nil, fmt.Errorf("setting panic stops: %v", err)
+	}
+	if err := s.insertLoadStop(); err != nil {
+		return nil, fmt.Errorf("setting load stop: %v", err)
+	}
+	for id, w := range s.watchpoints {
+		if w.monitor != nil || !s.resolveWatchpoint(w) {
+			debug.Log(debug.LevelWarn, "watchpoint deleted", debug.Field{Key: "id", Value: id}, debug.Field{Key: "name", Value: w.Name})
+			delete(s.watchpoints, id)
+		}
+	}
+	return unresolved, nil
+}
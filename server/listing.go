@@ -0,0 +1,110 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Listing the functions, source files and types in the executable, and the
+// source files' lines.
+
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/server/protocol"
+)
+
+func (s *Server) Functions(req *protocol.FunctionsRequest, resp *protocol.FunctionsResponse) error {
+	return s.call(s.otherc, req, resp)
+}
+
+func (s *Server) handleFunctions(req *protocol.FunctionsRequest, resp *protocol.FunctionsResponse) error {
+	re, err := s.listingRegexp(req.Regexp)
+	if err != nil {
+		return err
+	}
+	resp.Names = s.dwarfData.LookupMatchingFunctions(re)
+	return nil
+}
+
+func (s *Server) Sources(req *protocol.SourcesRequest, resp *protocol.SourcesResponse) error {
+	return s.call(s.otherc, req, resp)
+}
+
+func (s *Server) handleSources(req *protocol.SourcesRequest, resp *protocol.SourcesResponse) error {
+	if s.dwarfData == nil {
+		return fmt.Errorf("no DWARF data")
+	}
+	resp.Files = s.dwarfData.SourceFiles()
+	return nil
+}
+
+// maxSourceLineLen is the length of the longest line Source can read.
+const maxSourceLineLen = 1 << 20
+
+func (s *Server) Source(req *protocol.SourceRequest, resp *protocol.SourceResponse) error {
+	return s.call(s.otherc, req, resp)
+}
+
+func (s *Server) handleSource(req *protocol.SourceRequest, resp *protocol.SourceResponse) error {
+	if s.dwarfData == nil {
+		return fmt.Errorf("no DWARF data")
+	}
+	if req.EndLine != 0 && req.EndLine < req.StartLine {
+		return fmt.Errorf("invalid line range %d-%d", req.StartLine, req.EndLine)
+	}
+	name, lines, err := s.dwarfData.StatementLines(req.File)
+	if err != nil {
+		return err
+	}
+	statement := make(map[uint64]bool)
+	for _, l := range lines {
+		statement[l] = true
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	src := &resp.Source
+	src.File = name
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, maxSourceLineLen)
+	for n := uint64(1); sc.Scan(); n++ {
+		if n < req.StartLine {
+			continue
+		}
+		if req.EndLine != 0 && n > req.EndLine {
+			break
+		}
+		src.Lines = append(src.Lines, debug.SourceLine{Line: n, Text: sc.Text(), Statement: statement[n]})
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("reading %s: %v", name, err)
+	}
+	return nil
+}
+
+func (s *Server) Types(req *protocol.TypesRequest, resp *protocol.TypesResponse) error {
+	return s.call(s.otherc, req, resp)
+}
+
+func (s *Server) handleTypes(req *protocol.TypesRequest, resp *protocol.TypesResponse) error {
+	re, err := s.listingRegexp(req.Regexp)
+	if err != nil {
+		return err
+	}
+	resp.Names = s.dwarfData.LookupMatchingTypes(re)
+	return nil
+}
+
+// listingRegexp compiles the regular expression of a request for a listing.
+func (s *Server) listingRegexp(expr string) (*regexp.Regexp, error) {
+	if s.dwarfData == nil {
+		return nil, fmt.Errorf("no DWARF data")
+	}
+	return regexp.Compile(expr)
+}
@@ -0,0 +1,64 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Naming the parameters and local variables listed for stack frames.
+
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/debug/dwarf"
+	"golang.org/x/debug/server/protocol"
+)
+
+func (s *Server) SetShowTemporaries(req *protocol.SetShowTemporariesRequest, resp *protocol.SetShowTemporariesResponse) error {
+	return s.call(s.otherc, req, resp)
+}
+
+func (s *Server) handleSetShowTemporaries(req *protocol.SetShowTemporariesRequest, resp *protocol.SetShowTemporariesResponse) error {
+	s.showTemporaries = req.Show
+	return nil
+}
+
+// isTemporary reports whether name is one the compiler gives the variables it
+// introduces, like ".autotmp_3", or the parameters and results the program
+// leaves unnamed, like "~r0".
+func isTemporary(name string) bool {
+	return strings.HasPrefix(name, ".") || strings.HasPrefix(name, "~")
+}
+
+// listedVariables returns the entries, ordered as by scopeEntries, of the
+// variables that are listed for a frame, and the names they are listed under.
+// Compiler temporaries are left out unless SetShowTemporaries says otherwise.
+// A variable shadowed by a later one of the same name, which is declared in
+// an inner block, has its declaration line added to its name, as in
+// "x (line 12)", so that the two can be told apart; the innermost keeps the
+// name that expressions refer to it by.
+func (s *Server) listedVariables(entries []*dwarf.Entry) ([]*dwarf.Entry, []string) {
+	var listed []*dwarf.Entry
+	var names []string
+	last := make(map[string]int) // The index of the last variable with each name.
+	for _, entry := range entries {
+		name, _ := entry.Val(dwarf.AttrName).(string)
+		if isTemporary(name) && !s.showTemporaries {
+			continue
+		}
+		last[name] = len(names)
+		listed = append(listed, entry)
+		names = append(names, name)
+	}
+	for i, name := range names {
+		if last[name] == i {
+			continue
+		}
+		if line, ok := listed[i].Val(dwarf.AttrDeclLine).(int64); ok {
+			names[i] = fmt.Sprintf("%s (line %d)", name, line)
+		} else {
+			names[i] = name + " (shadowed)"
+		}
+	}
+	return listed, names
+}
@@ -0,0 +1,71 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/debug/dwarf"
+)
+
+// variableEntry returns a DWARF entry for a variable with the given name,
+// declared at line, or without a declaration line if line is zero.
+func variableEntry(name string, line int64) *dwarf.Entry {
+	e := &dwarf.Entry{Tag: dwarf.TagVariable, Field: []dwarf.Field{{Attr: dwarf.AttrName, Val: name}}}
+	if line != 0 {
+		e.Field = append(e.Field, dwarf.Field{Attr: dwarf.AttrDeclLine, Val: line})
+	}
+	return e
+}
+
+func TestListedVariables(t *testing.T) {
+	entries := []*dwarf.Entry{
+		variableEntry("x", 10),
+		variableEntry(".autotmp_3", 0),
+		variableEntry("y", 11),
+		variableEntry("~r0", 0),
+		variableEntry("x", 14), // Shadows the first x.
+		variableEntry("y", 0),  // Shadows y, without a declaration line.
+		variableEntry("x", 16), // Shadows both.
+	}
+	tests := []struct {
+		showTemporaries bool
+		indexes         []int // Of the entries listed.
+		names           []string
+	}{
+		{
+			false,
+			[]int{0, 2, 4, 5, 6},
+			[]string{"x (line 10)", "y (line 11)", "x (line 14)", "y", "x"},
+		},
+		{
+			true,
+			[]int{0, 1, 2, 3, 4, 5, 6},
+			[]string{"x (line 10)", ".autotmp_3", "y (line 11)", "~r0", "x (line 14)", "y", "x"},
+		},
+	}
+	for _, tt := range tests {
+		s := &Server{showTemporaries: tt.showTemporaries}
+		listed, names := s.listedVariables(entries)
+		var want []*dwarf.Entry
+		for _, i := range tt.indexes {
+			want = append(want, entries[i])
+		}
+		if !reflect.DeepEqual(listed, want) {
+			t.Errorf("with showTemporaries %t: listed entries %v, want %v", tt.showTemporaries, listed, want)
+		}
+		if !reflect.DeepEqual(names, tt.names) {
+			t.Errorf("with showTemporaries %t: got names %q, want %q", tt.showTemporaries, names, tt.names)
+		}
+	}
+
+	// A shadowed variable without a declaration line is marked as shadowed.
+	s := &Server{}
+	_, names := s.listedVariables([]*dwarf.Entry{variableEntry("z", 0), variableEntry("z", 5)})
+	if want := []string{"z (shadowed)", "z"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got names %q, want %q", names, want)
+	}
+}
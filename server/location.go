@@ -0,0 +1,547 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Evaluating DWARF location expressions, which say where a variable is: in
+// memory, in registers, or in pieces spread between them.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/debug/dwarf"
+)
+
+// DWARF expression opcodes.
+const (
+	opAddr         = 0x03
+	opDeref        = 0x06
+	opConst1u      = 0x08
+	opConst1s      = 0x09
+	opConst2u      = 0x0a
+	opConst2s      = 0x0b
+	opConst4u      = 0x0c
+	opConst4s      = 0x0d
+	opConst8u      = 0x0e
+	opConst8s      = 0x0f
+	opConstu       = 0x10
+	opConsts       = 0x11
+	opDup          = 0x12
+	opDrop         = 0x13
+	opOver         = 0x14
+	opPick         = 0x15
+	opSwap         = 0x16
+	opRot          = 0x17
+	opAbs          = 0x19
+	opAnd          = 0x1a
+	opDiv          = 0x1b
+	opMinus        = 0x1c
+	opMod          = 0x1d
+	opMul          = 0x1e
+	opNeg          = 0x1f
+	opNot          = 0x20
+	opOr           = 0x21
+	opPlus         = 0x22
+	opPlusUconst   = 0x23
+	opShl          = 0x24
+	opShr          = 0x25
+	opShra         = 0x26
+	opXor          = 0x27
+	opBra          = 0x28
+	opEq           = 0x29
+	opGe           = 0x2a
+	opGt           = 0x2b
+	opLe           = 0x2c
+	opLt           = 0x2d
+	opNe           = 0x2e
+	opSkip         = 0x2f
+	opLit0         = 0x30
+	opLit31        = 0x4f
+	opReg0         = 0x50
+	opReg31        = 0x6f
+	opBreg0        = 0x70
+	opBreg31       = 0x8f
+	opRegx         = 0x90
+	opFbreg        = 0x91
+	opBregx        = 0x92
+	opPiece        = 0x93
+	opDerefSize    = 0x94
+	opNop          = 0x96
+	opCallFrameCFA = 0x9c
+	opImplicitVal  = 0x9e
+	opStackValue   = 0x9f
+)
+
+// errInRegisters is returned for a variable held in registers whose values
+// aren't known, those of a frame other than the one the process is stopped
+// in.
+var errInRegisters = errors.New("variable is in registers")
+
+// A pieceKind says where a piece of a variable is.
+type pieceKind int
+
+const (
+	pieceMemory   pieceKind = iota // At an address.
+	pieceRegister                  // In a register.
+	pieceValue                     // Nowhere: the expression computed its value.
+)
+
+// A locationPiece is where part of a variable is, or all of it if the
+// location has one piece of size zero.
+type locationPiece struct {
+	kind  pieceKind
+	size  int    // In bytes; zero for the rest of the variable.
+	addr  uint64 // For pieceMemory.
+	reg   int    // DWARF register number, for pieceRegister.
+	value []byte // For pieceValue.
+}
+
+// A frameContext is the state of a stack frame that location expressions
+// refer to.
+type frameContext struct {
+	pc, sp    uint64
+	cfa       uint64      // Canonical Frame Address.
+	frameBase uint64      // The function's DW_AT_frame_base.
+	regs      *ptraceRegs // Nil if the registers are unknown.
+	fp        *fpRegs     // Read when first needed.
+}
+
+// newFrameContext returns the context of the frame of the function with the
+// given entry, with program counter pc and Canonical Frame Address cfa.  Its
+// registers are known if it is the frame the process is stopped in.
+func (s *Server) newFrameContext(funcEntry *dwarf.Entry, pc, cfa uint64) (*frameContext, error) {
+	spOffset, err := s.pcToSPOffset(pc)
+	if err != nil {
+		return nil, err
+	}
+	c := &frameContext{pc: pc, sp: cfa - uint64(spOffset), cfa: cfa, frameBase: cfa}
+	if pc == s.stoppedRegs.Rip && c.sp == s.stoppedRegs.Rsp {
+		regs := s.stoppedRegs
+		c.regs = &regs
+	}
+	// Go functions' frame base is the CFA; other compilers' may be a
+	// register or an address computed from one.
+	if expr, ok := funcEntry.Val(dwarf.AttrFrameBase).([]byte); ok {
+		pieces, err := s.evalLocation(expr, c)
+		if err != nil {
+			return nil, fmt.Errorf("frame base: %v", err)
+		}
+		if len(pieces) != 1 {
+			return nil, errors.New("frame base: unsupported location")
+		}
+		switch p := pieces[0]; p.kind {
+		case pieceMemory:
+			c.frameBase = p.addr
+		case pieceRegister:
+			if c.frameBase, err = s.register(c, p.reg); err != nil {
+				return nil, fmt.Errorf("frame base: %v", err)
+			}
+		default:
+			return nil, errors.New("frame base: unsupported location")
+		}
+	}
+	return c, nil
+}
+
+// evalLocation evaluates the location expression expr in the frame c, and
+// returns the pieces of the variable it describes.
+func (s *Server) evalLocation(expr []byte, c *frameContext) ([]locationPiece, error) {
+	if len(expr) == 0 {
+		return nil, errors.New("empty location expression")
+	}
+	var (
+		stack  []uint64
+		pieces []locationPiece
+		// The location described since the last piece, if it isn't
+		// the address on top of the stack.
+		cur *locationPiece
+		err error
+		pop func() uint64
+		// The operand readers keep an error already found, such as a
+		// stack underflow in the same operation.
+		readULEB = func() uint64 {
+			u, rest, rerr := uleb128(expr)
+			if rerr != nil && err == nil {
+				err = rerr
+			}
+			expr = rest
+			return u
+		}
+		readSLEB = func() int64 {
+			v, rest, rerr := sleb128(expr)
+			if rerr != nil && err == nil {
+				err = rerr
+			}
+			expr = rest
+			return v
+		}
+		readN = func(n int) []byte {
+			if len(expr) < n {
+				err = errors.New("truncated location expression")
+				return make([]byte, n)
+			}
+			b := expr[:n]
+			expr = expr[n:]
+			return b
+		}
+	)
+	pop = func() uint64 {
+		if len(stack) == 0 {
+			err = errors.New("location expression stack underflow")
+			return 0
+		}
+		x := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		return x
+	}
+	push := func(x uint64) { stack = append(stack, x) }
+	reg := func(n int) uint64 {
+		v, rerr := s.register(c, n)
+		if rerr != nil && err == nil {
+			err = rerr
+		}
+		return v
+	}
+	binary := func(f func(a, b uint64) uint64) {
+		b, a := pop(), pop()
+		push(f(a, b))
+	}
+	boolean := func(b bool) uint64 {
+		if b {
+			return 1
+		}
+		return 0
+	}
+
+	for len(expr) > 0 && err == nil {
+		op := expr[0]
+		expr = expr[1:]
+		switch {
+		case opLit0 <= op && op <= opLit31:
+			push(uint64(op - opLit0))
+			continue
+		case opReg0 <= op && op <= opReg31:
+			cur = &locationPiece{kind: pieceRegister, reg: int(op - opReg0)}
+			continue
+		case opBreg0 <= op && op <= opBreg31:
+			v := reg(int(op - opBreg0))
+			push(v + uint64(readSLEB()))
+			continue
+		}
+		switch op {
+		case opAddr:
+			push(s.arch.Uintptr(readN(s.arch.PointerSize)) + s.loadBias)
+		case opDeref, opDerefSize:
+			size := s.arch.PointerSize
+			if op == opDerefSize {
+				size = int(readN(1)[0])
+			}
+			addr := pop()
+			if err == nil {
+				if size < 1 || size > 8 {
+					err = fmt.Errorf("unsupported dereference size %d", size)
+					break
+				}
+				buf := make([]byte, size)
+				err = s.peekBytes(addr, buf)
+				push(s.arch.UintN(buf))
+			}
+		case opConst1u:
+			push(uint64(readN(1)[0]))
+		case opConst1s:
+			push(uint64(int8(readN(1)[0])))
+		case opConst2u:
+			push(s.arch.UintN(readN(2)))
+		case opConst2s:
+			push(uint64(s.arch.IntN(readN(2))))
+		case opConst4u:
+			push(s.arch.UintN(readN(4)))
+		case opConst4s:
+			push(uint64(s.arch.IntN(readN(4))))
+		case opConst8u, opConst8s:
+			push(s.arch.UintN(readN(8)))
+		case opConstu:
+			push(readULEB())
+		case opConsts:
+			push(uint64(readSLEB()))
+		case opDup:
+			x := pop()
+			push(x)
+			push(x)
+		case opDrop:
+			pop()
+		case opOver:
+			if len(stack) < 2 {
+				err = errors.New("location expression stack underflow")
+				break
+			}
+			push(stack[len(stack)-2])
+		case opPick:
+			i := int(readN(1)[0])
+			if i >= len(stack) {
+				err = errors.New("location expression stack underflow")
+				break
+			}
+			push(stack[len(stack)-1-i])
+		case opSwap:
+			b, a := pop(), pop()
+			push(b)
+			push(a)
+		case opRot:
+			z, y, x := pop(), pop(), pop()
+			push(z)
+			push(x)
+			push(y)
+		case opAbs:
+			x := int64(pop())
+			if x < 0 {
+				x = -x
+			}
+			push(uint64(x))
+		case opAnd:
+			binary(func(a, b uint64) uint64 { return a & b })
+		case opDiv, opMod:
+			b, a := int64(pop()), int64(pop())
+			if b == 0 {
+				err = errors.New("division by zero in location expression")
+				break
+			}
+			if op == opDiv {
+				push(uint64(a / b))
+			} else {
+				push(uint64(a % b))
+			}
+		case opMinus:
+			binary(func(a, b uint64) uint64 { return a - b })
+		case opMul:
+			binary(func(a, b uint64) uint64 { return a * b })
+		case opNeg:
+			push(uint64(-int64(pop())))
+		case opNot:
+			push(^pop())
+		case opOr:
+			binary(func(a, b uint64) uint64 { return a | b })
+		case opPlus:
+			binary(func(a, b uint64) uint64 { return a + b })
+		case opPlusUconst:
+			push(pop() + readULEB())
+		case opShl:
+			binary(func(a, b uint64) uint64 { return a << b })
+		case opShr:
+			binary(func(a, b uint64) uint64 { return a >> b })
+		case opShra:
+			binary(func(a, b uint64) uint64 { return uint64(int64(a) >> b) })
+		case opXor:
+			binary(func(a, b uint64) uint64 { return a ^ b })
+		case opEq:
+			binary(func(a, b uint64) uint64 { return boolean(a == b) })
+		case opGe:
+			binary(func(a, b uint64) uint64 { return boolean(int64(a) >= int64(b)) })
+		case opGt:
+			binary(func(a, b uint64) uint64 { return boolean(int64(a) > int64(b)) })
+		case opLe:
+			binary(func(a, b uint64) uint64 { return boolean(int64(a) <= int64(b)) })
+		case opLt:
+			binary(func(a, b uint64) uint64 { return boolean(int64(a) < int64(b)) })
+		case opNe:
+			binary(func(a, b uint64) uint64 { return boolean(a != b) })
+		case opSkip, opBra:
+			off := int(s.arch.IntN(readN(2)))
+			if op == opBra && pop() == 0 {
+				break
+			}
+			// The offset is from the end of this operation, in the
+			// expression as a whole; only forward branches are
+			// supported.
+			if off < 0 || off > len(expr) {
+				err = errors.New("unsupported branch in location expression")
+				break
+			}
+			expr = expr[off:]
+		case opRegx:
+			cur = &locationPiece{kind: pieceRegister, reg: int(readULEB())}
+		case opFbreg:
+			push(c.frameBase + uint64(readSLEB()))
+		case opBregx:
+			v := reg(int(readULEB()))
+			push(v + uint64(readSLEB()))
+		case opCallFrameCFA:
+			push(c.cfa)
+		case opImplicitVal:
+			cur = &locationPiece{kind: pieceValue, value: readN(int(readULEB()))}
+		case opStackValue:
+			buf := make([]byte, 8)
+			s.arch.ByteOrder.PutUint64(buf, pop())
+			cur = &locationPiece{kind: pieceValue, value: buf}
+		case opNop:
+		case opPiece:
+			size := int(readULEB())
+			p := cur
+			if p == nil {
+				if len(stack) == 0 {
+					// An empty piece: the part of the
+					// variable has been optimized away.
+					err = errors.New("variable is partly optimized away")
+					break
+				}
+				p = &locationPiece{kind: pieceMemory, addr: pop()}
+			}
+			p.size = size
+			pieces = append(pieces, *p)
+			cur, stack = nil, stack[:0]
+		default:
+			err = fmt.Errorf("unsupported location expression operation %#x", op)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case cur != nil:
+		pieces = append(pieces, *cur)
+	case len(stack) > 0:
+		pieces = append(pieces, locationPiece{kind: pieceMemory, addr: stack[len(stack)-1]})
+	case len(pieces) == 0:
+		return nil, errors.New("location expression has no result")
+	}
+	return pieces, nil
+}
+
+// register returns the value of the register with the given DWARF number in
+// the frame c.  Outside the frame the process is stopped in, only the stack
+// pointer and program counter are known.
+func (s *Server) register(c *frameContext, n int) (uint64, error) {
+	// DWARF register numbers on amd64, from the System V ABI.
+	const (
+		regRSP  = 7
+		regRIP  = 16
+		regXMM0 = 17
+	)
+	if c.regs == nil {
+		switch n {
+		case regRSP:
+			return c.sp, nil
+		case regRIP:
+			return c.pc, nil
+		}
+		return 0, errInRegisters
+	}
+	r := c.regs
+	gp := []*uint64{
+		&r.Rax, &r.Rdx, &r.Rcx, &r.Rbx, &r.Rsi, &r.Rdi, &r.Rbp, &r.Rsp,
+		&r.R8, &r.R9, &r.R10, &r.R11, &r.R12, &r.R13, &r.R14, &r.R15,
+		&r.Rip,
+	}
+	if n >= 0 && n < len(gp) {
+		return *gp[n], nil
+	}
+	if n >= regXMM0 && n < regXMM0+16 {
+		if c.fp == nil {
+			var fp fpRegs
+			if err := s.ptraceGetFPRegs(s.stoppedPid, &fp); err != nil {
+				return 0, fmt.Errorf("ptraceGetFPRegs: %v", err)
+			}
+			c.fp = &fp
+		}
+		return s.arch.ByteOrder.Uint64(c.fp.xmm(n - regXMM0)), nil
+	}
+	return 0, fmt.Errorf("unsupported DWARF register %d", n)
+}
+
+// locationAddress returns an address where the variable of the given size,
+// whose location is pieces, can be read.  That is its own address if it is
+// in memory in one piece.  Otherwise its value is assembled from the pieces,
+// and kept in the process's composite memory, which reads of the process's
+// memory see until it next stops.
+func (s *Server) locationAddress(pieces []locationPiece, size int64, c *frameContext) (uint64, error) {
+	if p := pieces[0]; p.kind == pieceMemory && (len(pieces) == 1 || contiguous(pieces)) {
+		return p.addr, nil
+	}
+	if size <= 0 {
+		return 0, errors.New("variable in registers has unknown size")
+	}
+	buf := make([]byte, size)
+	rest := buf
+	for _, p := range pieces {
+		n := p.size
+		if n == 0 || n > len(rest) {
+			n = len(rest)
+		}
+		switch p.kind {
+		case pieceMemory:
+			if err := s.peekBytes(p.addr, rest[:n]); err != nil {
+				return 0, err
+			}
+		case pieceRegister:
+			v, err := s.register(c, p.reg)
+			if err != nil {
+				return 0, err
+			}
+			var b [8]byte
+			s.arch.ByteOrder.PutUint64(b[:], v)
+			copy(rest[:n], b[:])
+		case pieceValue:
+			copy(rest[:n], p.value)
+		}
+		rest = rest[n:]
+		if len(rest) == 0 {
+			break
+		}
+	}
+	return s.composites.add(s.stops, buf), nil
+}
+
+// contiguous reports whether the pieces are in memory, each following the
+// one before.
+func contiguous(pieces []locationPiece) bool {
+	addr := pieces[0].addr
+	for _, p := range pieces {
+		if p.kind != pieceMemory || p.addr != addr || p.size == 0 {
+			return false
+		}
+		addr += uint64(p.size)
+	}
+	return true
+}
+
+// compositeBase is the start of the addresses given to the values of
+// variables that aren't in memory.  It is in the kernel's half of the address
+// space, so no process's memory is there.
+const compositeBase = 0xffffc00000000000
+
+// compositeMemory holds the values of variables that aren't in memory, at
+// made-up addresses, so that they can be read like any other.  The values
+// are those at one stop of the process, and are dropped at the next.
+type compositeMemory struct {
+	stop   uint64   // The value of s.stops for which the values were read.
+	values [][]byte // The value at compositeBase + i<<32 is values[i].
+}
+
+// add stores value for the given stop, and returns its address.
+func (m *compositeMemory) add(stop uint64, value []byte) uint64 {
+	if m.stop != stop {
+		*m = compositeMemory{stop: stop}
+	}
+	m.values = append(m.values, value)
+	return compositeBase + uint64(len(m.values)-1)<<32
+}
+
+// read copies into out the bytes at addr, if it is in composite memory, and
+// reports whether it is.
+func (m *compositeMemory) read(stop uint64, addr uint64, out []byte) (ok bool, err error) {
+	if addr < compositeBase {
+		return false, nil
+	}
+	i, off := (addr-compositeBase)>>32, addr&(1<<32-1)
+	if m.stop != stop || i >= uint64(len(m.values)) {
+		return true, errors.New("value of variable in registers is no longer available")
+	}
+	v := m.values[i]
+	if off+uint64(len(out)) > uint64(len(v)) {
+		return true, errors.New("read past the end of a variable in registers")
+	}
+	copy(out, v[off:])
+	return true, nil
+}
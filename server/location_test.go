@@ -0,0 +1,275 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/debug/arch"
+)
+
+// uleb returns x encoded in unsigned LEB128.
+func uleb(x uint64) []byte {
+	var b []byte
+	for {
+		c := byte(x & 0x7f)
+		x >>= 7
+		if x != 0 {
+			c |= 0x80
+		}
+		b = append(b, c)
+		if x == 0 {
+			return b
+		}
+	}
+}
+
+// sleb returns x encoded in signed LEB128.
+func sleb(x int64) []byte {
+	var b []byte
+	for {
+		c := byte(x & 0x7f)
+		x >>= 7
+		if (x == 0 && c&0x40 == 0) || (x == -1 && c&0x40 != 0) {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+// le returns the n-byte little-endian encoding of x.
+func le(x uint64, n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(x >> (8 * uint(i)))
+	}
+	return b
+}
+
+// expr concatenates opcodes and encoded operands into an expression.
+func expr(parts ...interface{}) []byte {
+	var b []byte
+	for _, p := range parts {
+		switch p := p.(type) {
+		case int:
+			b = append(b, byte(p))
+		case []byte:
+			b = append(b, p...)
+		default:
+			panic("bad expression part")
+		}
+	}
+	return b
+}
+
+const (
+	testLoadBias  = 0x1000
+	testPC        = 0x401234
+	testSP        = 0xc000100000
+	testCFA       = 0xc000100020
+	testFrameBase = 0xc000100010
+	testRBP       = 0xc000100018
+	testRBX       = 0x55
+)
+
+// testFrame returns a frame context whose registers are known if regs is set.
+func testFrame(regs bool) *frameContext {
+	c := &frameContext{pc: testPC, sp: testSP, cfa: testCFA, frameBase: testFrameBase}
+	if regs {
+		c.regs = &ptraceRegs{Rbx: testRBX, Rbp: testRBP, Rsp: testSP, Rip: testPC}
+	}
+	return c
+}
+
+// memory returns a piece of a variable in memory at addr.
+func memory(addr uint64) []locationPiece {
+	return []locationPiece{{kind: pieceMemory, addr: addr}}
+}
+
+func TestEvalLocation(t *testing.T) {
+	s := &Server{arch: arch.AMD64, loadBias: testLoadBias}
+	// A pointer and a 2-byte value, read by DW_OP_deref and DW_OP_deref_size.
+	ptr := s.composites.add(s.stops, le(0xc000200000, 8))
+	short := s.composites.add(s.stops, le(0xfffe, 2))
+
+	tests := []struct {
+		name string
+		expr []byte
+		regs bool // Whether the frame's registers are known.
+		want []locationPiece
+		err  string // A substring of the expected error.
+	}{
+		// Constants and addresses.
+		{name: "lit", expr: expr(opLit0 + 31), want: memory(31)},
+		{name: "addr", expr: expr(opAddr, le(0x500000, 8)), want: memory(0x500000 + testLoadBias)},
+		{name: "const1u", expr: expr(opConst1u, 0xff), want: memory(0xff)},
+		{name: "const1s", expr: expr(opConst1s, 0xff), want: memory(1<<64 - 1)},
+		{name: "const2u", expr: expr(opConst2u, le(0x1234, 2)), want: memory(0x1234)},
+		{name: "const2s", expr: expr(opConst2s, le(0xfffe, 2)), want: memory(1<<64 - 2)},
+		{name: "const4u", expr: expr(opConst4u, le(0x12345678, 4)), want: memory(0x12345678)},
+		{name: "const4s", expr: expr(opConst4s, le(0xfffffffd, 4)), want: memory(1<<64 - 3)},
+		{name: "const8u", expr: expr(opConst8u, le(0x123456789a, 8)), want: memory(0x123456789a)},
+		{name: "constu", expr: expr(opConstu, uleb(300)), want: memory(300)},
+		{name: "consts", expr: expr(opConsts, sleb(-300), opLit0+1, opPlus), want: memory(1<<64 - 299)},
+
+		// Stack operations.
+		{name: "dup", expr: expr(opLit0+5, opDup, opPlus), want: memory(10)},
+		{name: "drop", expr: expr(opLit0+1, opLit0+2, opDrop), want: memory(1)},
+		{name: "over", expr: expr(opLit0+1, opLit0+2, opOver), want: memory(1)},
+		{name: "pick", expr: expr(opLit0+1, opLit0+2, opLit0+3, opPick, 2), want: memory(1)},
+		{name: "swap", expr: expr(opLit0+1, opLit0+2, opSwap), want: memory(1)},
+		{name: "rot", expr: expr(opLit0+1, opLit0+2, opLit0+3, opRot), want: memory(2)},
+		{name: "rot order", expr: expr(opLit0+1, opLit0+2, opLit0+3, opRot, opDrop), want: memory(1)},
+		{name: "nop", expr: expr(opLit0+4, opNop), want: memory(4)},
+
+		// Arithmetic and logic.
+		{name: "minus", expr: expr(opLit0+9, opLit0+4, opMinus), want: memory(5)},
+		{name: "mul", expr: expr(opLit0+6, opLit0+7, opMul), want: memory(42)},
+		{name: "div", expr: expr(opConsts, sleb(-9), opLit0+2, opDiv), want: memory(1<<64 - 4)},
+		{name: "mod", expr: expr(opLit0+9, opLit0+4, opMod), want: memory(1)},
+		{name: "neg abs", expr: expr(opLit0+7, opNeg, opAbs), want: memory(7)},
+		{name: "not", expr: expr(opLit0, opNot), want: memory(1<<64 - 1)},
+		{name: "and or xor", expr: expr(opLit0+12, opLit0+10, opAnd, opLit0+1, opOr, opLit0+3, opXor), want: memory(10)},
+		{name: "shl", expr: expr(opLit0+1, opLit0+4, opShl), want: memory(16)},
+		{name: "shr", expr: expr(opConsts, sleb(-16), opConst1u, 60, opShr), want: memory(15)},
+		{name: "shra", expr: expr(opConsts, sleb(-16), opLit0+2, opShra), want: memory(1<<64 - 4)},
+		{name: "plus_uconst", expr: expr(opLit0+1, opPlusUconst, uleb(1000)), want: memory(1001)},
+		{name: "signed lt", expr: expr(opConsts, sleb(-1), opLit0, opLt), want: memory(1)},
+		{name: "ge", expr: expr(opLit0+2, opLit0+2, opGe), want: memory(1)},
+		{name: "gt", expr: expr(opLit0+2, opLit0+3, opGt), want: memory(0)},
+		{name: "le", expr: expr(opLit0+2, opLit0+3, opLe), want: memory(1)},
+		{name: "eq ne", expr: expr(opLit0+2, opLit0+2, opEq, opLit0+1, opNe), want: memory(0)},
+
+		// Branches, whose offsets are from the end of the operation.
+		{name: "bra taken", expr: expr(opLit0+1, opBra, le(1, 2), opLit0+9, opLit0+7), want: memory(7)},
+		{name: "bra not taken", expr: expr(opLit0, opBra, le(1, 2), opLit0+9), want: memory(9)},
+		{name: "skip", expr: expr(opSkip, le(1, 2), opLit0+9, opLit0+3), want: memory(3)},
+		{name: "skip to end", expr: expr(opLit0+5, opSkip, le(1, 2), opLit0+9), want: memory(5)},
+
+		// Registers and the frame.
+		{name: "fbreg", expr: expr(opFbreg, sleb(-16)), want: memory(testFrameBase - 16)},
+		{name: "breg", expr: expr(opBreg0+6, sleb(8)), regs: true, want: memory(testRBP + 8)},
+		{name: "bregx", expr: expr(opBregx, uleb(3), sleb(-5)), regs: true, want: memory(testRBX - 5)},
+		{name: "breg sp unknown regs", expr: expr(opBreg0+7, sleb(8)), want: memory(testSP + 8)},
+		{name: "call_frame_cfa", expr: expr(opCallFrameCFA), want: memory(testCFA)},
+		{name: "reg", expr: expr(opReg0 + 3), want: []locationPiece{{kind: pieceRegister, reg: 3}}},
+		{name: "regx", expr: expr(opRegx, uleb(17)), want: []locationPiece{{kind: pieceRegister, reg: 17}}},
+
+		// Memory.
+		{name: "deref", expr: expr(opConst8u, le(ptr, 8), opDeref), want: memory(0xc000200000)},
+		{name: "deref_size", expr: expr(opConst8u, le(short, 8), opDerefSize, 2), want: memory(0xfffe)},
+
+		// Values computed by the expression.
+		{name: "stack_value", expr: expr(opLit0+5, opStackValue), want: []locationPiece{{kind: pieceValue, value: le(5, 8)}}},
+		{name: "implicit_value", expr: expr(opImplicitVal, uleb(3), 1, 2, 3), want: []locationPiece{{kind: pieceValue, value: []byte{1, 2, 3}}}},
+
+		// Pieces.
+		{
+			name: "register and memory pieces",
+			expr: expr(opReg0, opPiece, uleb(8), opFbreg, sleb(8), opPiece, uleb(8)),
+			want: []locationPiece{
+				{kind: pieceRegister, reg: 0, size: 8},
+				{kind: pieceMemory, addr: testFrameBase + 8, size: 8},
+			},
+		},
+		{
+			name: "value and register pieces",
+			expr: expr(opLit0+1, opStackValue, opPiece, uleb(4), opReg0+1, opPiece, uleb(4)),
+			want: []locationPiece{
+				{kind: pieceValue, value: le(1, 8), size: 4},
+				{kind: pieceRegister, reg: 1, size: 4},
+			},
+		},
+
+		// Errors.
+		{name: "empty", expr: nil, err: "empty location expression"},
+		{name: "underflow", expr: expr(opLit0+1, opPlus), err: "stack underflow"},
+		{name: "over underflow", expr: expr(opLit0+1, opOver), err: "stack underflow"},
+		{name: "pick underflow", expr: expr(opLit0+1, opPick, 1), err: "stack underflow"},
+		{name: "deref underflow", expr: expr(opDeref), err: "stack underflow"},
+		{name: "plus_uconst underflow", expr: expr(opPlusUconst, uleb(1)), err: "stack underflow"},
+		{name: "truncated constant", expr: expr(opConst4u, 1, 2), err: "truncated location expression"},
+		{name: "truncated address", expr: expr(opAddr, 1, 2, 3), err: "truncated location expression"},
+		{name: "truncated uleb", expr: expr(opConstu, 0x80), err: "truncated uleb128"},
+		{name: "truncated implicit_value", expr: expr(opImplicitVal, uleb(4), 1, 2), err: "truncated location expression"},
+		{name: "truncated branch", expr: expr(opSkip, 1), err: "truncated location expression"},
+		{name: "divide by zero", expr: expr(opLit0+1, opLit0, opDiv), err: "division by zero"},
+		{name: "mod by zero", expr: expr(opLit0+1, opLit0, opMod), err: "division by zero"},
+		{name: "backward branch", expr: expr(opLit0+1, opSkip, le(0xfffd, 2)), err: "unsupported branch"},
+		{name: "branch past end", expr: expr(opSkip, le(2, 2), opLit0), err: "unsupported branch"},
+		{name: "partly optimized away", expr: expr(opReg0, opPiece, uleb(4), opPiece, uleb(4)), err: "partly optimized away"},
+		{name: "registers unknown", expr: expr(opBreg0+6, sleb(8)), err: errInRegisters.Error()},
+		{name: "bregx registers unknown", expr: expr(opBregx, uleb(3), sleb(8)), err: errInRegisters.Error()},
+		{name: "bad deref size", expr: expr(opLit0, opDerefSize, 9), err: "unsupported dereference size"},
+		{name: "unsupported operation", expr: expr(0xe0), err: "unsupported location expression operation"},
+		{name: "no result", expr: expr(opLit0+1, opDrop), err: "has no result"},
+	}
+	for _, tt := range tests {
+		pieces, err := s.evalLocation(tt.expr, testFrame(tt.regs))
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: got error %v, want one containing %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(pieces, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, pieces, tt.want)
+		}
+	}
+}
+
+func TestLocationAddress(t *testing.T) {
+	s := &Server{arch: arch.AMD64}
+	c := testFrame(true)
+	mem := s.composites.add(s.stops, []byte{0xa, 0xb, 0xc, 0xd})
+
+	// A variable in one piece of memory is read where it is, as is one
+	// whose pieces follow each other.
+	for _, pieces := range [][]locationPiece{
+		memory(mem),
+		{{kind: pieceMemory, addr: mem, size: 2}, {kind: pieceMemory, addr: mem + 2, size: 2}},
+	} {
+		if addr, err := s.locationAddress(pieces, 4, c); err != nil || addr != mem {
+			t.Errorf("locationAddress(%+v) = %#x, %v; want %#x", pieces, addr, err, mem)
+		}
+	}
+
+	// Otherwise its value is assembled from the pieces.
+	pieces := []locationPiece{
+		{kind: pieceRegister, reg: 3, size: 2},
+		{kind: pieceValue, value: []byte{1, 2, 3}, size: 2},
+		{kind: pieceMemory, addr: mem + 2, size: 2},
+	}
+	addr, err := s.locationAddress(pieces, 6, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, 6)
+	if err := s.peekBytes(addr, got); err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{testRBX, 0, 1, 2, 0xc, 0xd}; !reflect.DeepEqual(got, want) {
+		t.Errorf("variable in pieces: got %x, want %x", got, want)
+	}
+
+	if _, err := s.locationAddress(pieces, 6, testFrame(false)); err != errInRegisters {
+		t.Errorf("variable in registers of another frame: got error %v, want %v", err, errInRegisters)
+	}
+	if _, err := s.locationAddress(pieces, 0, c); err == nil {
+		t.Error("variable in pieces with unknown size: no error")
+	}
+
+	// The values are dropped when the process next stops.
+	s.stops++
+	if err := s.peekBytes(addr, got); err == nil {
+		t.Error("read a variable in pieces after the process stopped again")
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Describing the executable's debugging information for other tools.
+
+package server
+
+import (
+	"regexp"
+	"sort"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/server/protocol"
+)
+
+func (s *Server) DebugManifest(req *protocol.DebugManifestRequest, resp *protocol.DebugManifestResponse) error {
+	return s.call(s.otherc, req, resp)
+}
+
+func (s *Server) handleDebugManifest(req *protocol.DebugManifestRequest, resp *protocol.DebugManifestResponse) error {
+	m := debug.DebugManifest{
+		Executable: s.executable,
+		GoVersion:  s.binaryInfo.GoVersion,
+		LoadBias:   s.loadBias,
+		Functions:  []debug.ManifestFunction{},
+		Lines:      []debug.ManifestLine{},
+		Globals:    []debug.ManifestGlobal{},
+	}
+	all := regexp.MustCompile(".")
+
+	for _, name := range s.dwarfData.LookupMatchingFunctions(all) {
+		entry, err := s.dwarfData.LookupFunction(name)
+		if err != nil {
+			continue
+		}
+		ranges, err := s.dwarfData.EntryRanges(entry)
+		if err != nil || len(ranges) == 0 {
+			// Functions which were inlined everywhere have no code of their own.
+			continue
+		}
+		f := debug.ManifestFunction{Name: name, Low: ranges[0][0], High: ranges[0][1]}
+		for _, r := range ranges[1:] {
+			if r[0] < f.Low {
+				f.Low = r[0]
+			}
+			if r[1] > f.High {
+				f.High = r[1]
+			}
+		}
+		f.File, f.Line, _ = s.dwarfData.PCToLine(f.Low)
+		m.Functions = append(m.Functions, f)
+	}
+	sort.Slice(m.Functions, func(i, j int) bool { return m.Functions[i].Low < m.Functions[j].Low })
+
+	for _, r := range s.dwarfData.LineTable() {
+		m.Lines = append(m.Lines, debug.ManifestLine{Low: r.Low, High: r.High, File: r.File, Line: r.Line})
+	}
+
+	for _, name := range s.dwarfData.LookupMatchingVariables(all) {
+		entry, err := s.dwarfData.LookupVariable(name)
+		if err != nil {
+			continue
+		}
+		addr, err := s.dwarfData.EntryLocation(entry)
+		if err != nil {
+			// The variable was optimized away, or is thread-local.
+			continue
+		}
+		t, err := s.dwarfData.EntryType(entry)
+		if err != nil {
+			continue
+		}
+		m.Globals = append(m.Globals, debug.ManifestGlobal{
+			Name:    name,
+			Address: addr,
+			Type:    typeName(t),
+			TypeID:  uint64(t.Common().Offset),
+			Size:    t.Size(),
+		})
+	}
+	sort.Slice(m.Globals, func(i, j int) bool { return m.Globals[i].Address < m.Globals[j].Address })
+
+	resp.Manifest = m
+	return nil
+}
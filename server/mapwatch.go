@@ -0,0 +1,131 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Watching a map's header to stop the process when the map grows.
+
+package server
+
+import (
+	"fmt"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/dwarf"
+	"golang.org/x/debug/server/protocol"
+)
+
+// mapMonitor decides whether a write to the header of a map watched by
+// WatchMap should stop the process.
+type mapMonitor struct {
+	size      watchRegion // The field that changes when the map's table grows.
+	count     watchRegion // The field holding the number of elements.
+	threshold uint64      // Zero if only growth stops the process.
+	lastSize  uint64
+	lastCount uint64
+}
+
+func (s *Server) WatchMap(req *protocol.WatchMapRequest, resp *protocol.WatchMapResponse) error {
+	return s.call(s.controlc, req, resp)
+}
+
+func (s *Server) handleWatchMap(req *protocol.WatchMapRequest, resp *protocol.WatchMapResponse) error {
+	t, err := s.dwarfData.Type(dwarf.Offset(req.Map.TypeID))
+	if err != nil {
+		return err
+	}
+	mt, ok := t.(*dwarf.MapType)
+	if !ok {
+		return fmt.Errorf("WatchMap: value is not a map")
+	}
+	addr, st, err := s.peekMapLocationAndType(mt, req.Map.Address)
+	if err != nil {
+		return err
+	}
+	if addr == 0 {
+		return fmt.Errorf("WatchMap: map is nil")
+	}
+	// Maps before Go 1.24 keep the log of their number of buckets in B.
+	// Swiss table maps keep the length of their directory of tables in
+	// dirLen, which doesn't change when a table grows without splitting.
+	sizeField, countField := "B", "count"
+	if _, err := getField(st, "B"); err != nil {
+		sizeField, countField = "dirLen", "used"
+	}
+	m := &mapMonitor{threshold: req.Threshold}
+	if m.size, err = fieldRegion(st, addr, sizeField); err != nil {
+		return fmt.Errorf("WatchMap: %v", err)
+	}
+	if m.count, err = fieldRegion(st, addr, countField); err != nil {
+		return fmt.Errorf("WatchMap: %v", err)
+	}
+	if _, err := s.mapChanged(m); err != nil {
+		return err
+	}
+	regions := []watchRegion{m.size}
+	if m.threshold > 0 {
+		regions = append(regions, m.count)
+	}
+	if used := len(s.debugRegs()); used+len(regions) > numDebugRegs {
+		return fmt.Errorf("watching a map needs %d debug registers, but only %d are free", len(regions), numDebugRegs-used)
+	}
+	s.nextWatchpointID++
+	w := &watchpoint{
+		Watchpoint: debug.Watchpoint{
+			ID:      s.nextWatchpointID,
+			Name:    fmt.Sprintf("%s at %#x", typeName(mt), addr),
+			Address: addr,
+			Size:    uint64(st.ByteSize),
+		},
+		regions: regions,
+		monitor: m,
+	}
+	s.watchpoints[w.ID] = w
+	resp.Watchpoint = w.Watchpoint
+	return nil
+}
+
+// fieldRegion returns the region holding the named integer field of the
+// struct of type t at addr.
+func fieldRegion(t *dwarf.StructType, addr uint64, name string) (watchRegion, error) {
+	f, err := getField(t, name)
+	if err != nil {
+		return watchRegion{}, err
+	}
+	switch f.Type.(type) {
+	case *dwarf.IntType, *dwarf.UintType:
+	default:
+		return watchRegion{}, fmt.Errorf("map field %s is not an integer", name)
+	}
+	r := watchRegion{addr + uint64(f.ByteOffset), uint64(f.Type.Size())}
+	if regions := watchRegions(r.addr, r.size); len(regions) != 1 {
+		return watchRegion{}, fmt.Errorf("map field %s can't be watched", name)
+	}
+	return r, nil
+}
+
+// mapChanged reads the watched fields of a map, and reports whether the map
+// has grown, or its number of elements has passed the threshold, since they
+// were last read.
+func (s *Server) mapChanged(m *mapMonitor) (bool, error) {
+	size, err := s.peekRegion(m.size)
+	if err != nil {
+		return false, err
+	}
+	count, err := s.peekRegion(m.count)
+	if err != nil {
+		return false, err
+	}
+	changed := size != m.lastSize || m.threshold > 0 && m.lastCount <= m.threshold && count > m.threshold
+	m.lastSize, m.lastCount = size, count
+	return changed, nil
+}
+
+// peekRegion reads the integer in r.  It doesn't count towards the client's
+// quota of reads, since the server reads it for itself.
+func (s *Server) peekRegion(r watchRegion) (uint64, error) {
+	buf := make([]byte, r.size)
+	if err := s.ptracePeek(s.stoppedPid, uintptr(r.addr), buf); err != nil {
+		return 0, fmt.Errorf("reading map header: %v", err)
+	}
+	return s.arch.UintN(buf), nil
+}
@@ -0,0 +1,91 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Reading and writing the program's memory as raw bytes.
+
+package server
+
+import (
+	"fmt"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/server/protocol"
+)
+
+// maxMemoryRead is the most memory a ReadMemory request can read.
+const maxMemoryRead = 16 << 20
+
+func (s *Server) ReadMemory(req *protocol.ReadMemoryRequest, resp *protocol.ReadMemoryResponse) error {
+	return s.call(s.otherc, req, resp)
+}
+
+func (s *Server) handleReadMemory(req *protocol.ReadMemoryRequest, resp *protocol.ReadMemoryResponse) error {
+	if req.Length < 0 || req.Length > maxMemoryRead {
+		return fmt.Errorf("ReadMemory: length %d out of range [0, %d]", req.Length, maxMemoryRead)
+	}
+	resp.Data = []byte{}
+	if req.Length == 0 {
+		return nil
+	}
+	if err := s.chargeRead(req.Length); err != nil {
+		return err
+	}
+	buf := make([]byte, req.Length)
+	n, err := s.ptracePeekPartial(s.stoppedPid, uintptr(req.Address), buf)
+	resp.Data = buf[:n]
+	// Show the instructions the breakpoints replaced, as the program sees them.
+	s.forEachBreakpointByte(req.Address, resp.Data, func(b []byte, bp *breakpoint, i int) {
+		b[0] = bp.origInstr[i]
+	})
+	if err != nil {
+		resp.Err = &debug.MemoryError{Address: req.Address + uint64(n), Reason: err.Error()}
+	}
+	return nil
+}
+
+func (s *Server) WriteMemory(req *protocol.WriteMemoryRequest, resp *protocol.WriteMemoryResponse) error {
+	return s.call(s.otherc, req, resp)
+}
+
+func (s *Server) handleWriteMemory(req *protocol.WriteMemoryRequest, resp *protocol.WriteMemoryResponse) error {
+	if len(req.Data) == 0 {
+		return nil
+	}
+	// Where the data overwrites a breakpoint instruction, it replaces the
+	// instruction to be restored when the breakpoint is removed, and the
+	// breakpoint instruction stays.
+	buf := append([]byte(nil), req.Data...)
+	s.forEachBreakpointByte(req.Address, buf, func(b []byte, bp *breakpoint, i int) {
+		b[0] = s.arch.BreakpointInstr[i]
+	})
+	n, err := s.ptracePokePartial(s.stoppedPid, uintptr(req.Address), buf)
+	s.forEachBreakpointByte(req.Address, req.Data[:n], func(b []byte, bp *breakpoint, i int) {
+		bp.origInstr[i] = b[0]
+	})
+	resp.Written = n
+	if err != nil {
+		resp.Err = &debug.MemoryError{Address: req.Address + uint64(n), Write: true, Reason: err.Error()}
+	}
+	return nil
+}
+
+// forEachBreakpointByte calls f for each byte of buf, which holds the memory
+// at addr, that a breakpoint instruction occupies, with the byte, the
+// breakpoint, and the byte's index in the instruction.  Changes f makes to
+// the breakpoint are kept.
+func (s *Server) forEachBreakpointByte(addr uint64, buf []byte, f func(b []byte, bp *breakpoint, i int)) {
+	size := uint64(s.arch.BreakpointSize)
+	end := addr + uint64(len(buf))
+	for pc, bp := range s.breakpoints {
+		if pc+size <= addr || pc >= end {
+			continue
+		}
+		for i := uint64(0); i < size; i++ {
+			if a := pc + i; addr <= a && a < end {
+				f(buf[a-addr:], &bp, int(i))
+			}
+		}
+		s.breakpoints[pc] = bp
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Breakpoints that are deleted the first time the program stops at them.
+
+package server
+
+import (
+	"fmt"
+
+	"golang.org/x/debug/server/protocol"
+)
+
+func (s *Server) SetBreakpointOneShot(req *protocol.SetBreakpointOneShotRequest, resp *protocol.SetBreakpointOneShotResponse) error {
+	return s.call(s.breakpointc, req, resp)
+}
+
+func (s *Server) handleSetBreakpointOneShot(req *protocol.SetBreakpointOneShotRequest, resp *protocol.SetBreakpointOneShotResponse) error {
+	bp, ok := s.userBreakpoints[req.ID]
+	if !ok {
+		return fmt.Errorf("no breakpoint with ID %d", req.ID)
+	}
+	bp.OneShot = req.OneShot
+	return nil
+}
+
+func (s *Server) RunToLine(req *protocol.RunToLineRequest, resp *protocol.RunToLineResponse) error {
+	return s.call(s.controlc, req, resp)
+}
+
+func (s *Server) handleRunToLine(req *protocol.RunToLineRequest, resp *protocol.RunToLineResponse) error {
+	var bpResp protocol.BreakpointResponse
+	if err := s.handleBreakpointAtLine(&protocol.BreakpointAtLineRequest{File: req.File, Line: req.Line}, &bpResp); err != nil {
+		return err
+	}
+	id := bpResp.Breakpoint.ID
+	s.userBreakpoints[id].OneShot = true
+	var resumeResp protocol.ResumeResponse
+	err := s.handleResume(&protocol.ResumeRequest{}, &resumeResp)
+	// If the program stopped somewhere else first, the breakpoint goes all
+	// the same.
+	if _, ok := s.userBreakpoints[id]; ok {
+		if derr := s.deleteBreakpoints([]uint64{id}); err == nil {
+			err = derr
+		}
+	}
+	resp.Status = resumeResp.Status
+	return err
+}
@@ -0,0 +1,456 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Stepping over a breakpoint by executing a copy of the original instruction
+// out of line, so that the breakpoint stays in place for other threads.
+
+package server
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+const (
+	// maxInstrLen is the maximum length of an x86 instruction.
+	maxInstrLen = 15
+	// scratchLen is the space needed to execute an instruction out of line:
+	// the relocated instruction, which may have grown by up to 4 bytes when a
+	// short branch is widened, followed by a breakpoint instruction.
+	scratchLen = maxInstrLen + 4 + 1
+)
+
+// x86Instr describes an amd64 instruction, as far as needed to relocate it.
+type x86Instr struct {
+	len        int  // Length of the instruction.
+	opcode     int  // Offset of the (first) opcode byte.
+	dispOffset int  // Offset of a RIP-relative displacement, or 0 if none.
+	relOffset  int  // Offset of a branch displacement, or 0 if none.
+	relSize    int  // Size of the branch displacement: 1 or 4.
+	call       bool // Whether the instruction pushes a return address.
+}
+
+// Operand kinds for the decoding tables.
+const (
+	opNone   = iota // no ModRM or immediate.
+	opModRM         // ModRM, no immediate.
+	opModRM8        // ModRM and an 8-bit immediate.
+	opModRMz        // ModRM and a 16- or 32-bit immediate.
+	opImm8          // 8-bit immediate.
+	opImm16         // 16-bit immediate.
+	opImmz          // 16- or 32-bit immediate.
+	opRel8          // 8-bit branch displacement.
+	opRel32         // 32-bit branch displacement.
+	opBad           // not handled.
+)
+
+// oneByteOps gives the operands of the one-byte opcodes.  Opcodes with
+// irregular operands are special-cased in decodeX86.
+var oneByteOps = [256]uint8{}
+
+// twoByteOps gives the operands of the opcodes following 0x0F.
+var twoByteOps = [256]uint8{}
+
+func init() {
+	for i := range oneByteOps {
+		oneByteOps[i] = opBad
+		twoByteOps[i] = opBad
+	}
+	set := func(table *[256]uint8, kind uint8, ops ...int) {
+		for _, op := range ops {
+			table[op] = kind
+		}
+	}
+	setRange := func(table *[256]uint8, kind uint8, lo, hi int) {
+		for op := lo; op <= hi; op++ {
+			table[op] = kind
+		}
+	}
+	// The arithmetic instructions: ADD, OR, ADC, SBB, AND, SUB, XOR, CMP.
+	for op := 0x00; op < 0x40; op += 8 {
+		setRange(&oneByteOps, opModRM, op, op+3)
+		oneByteOps[op+4] = opImm8
+		oneByteOps[op+5] = opImmz
+	}
+	set(&oneByteOps, opModRM, 0x63, 0x84, 0x85, 0x86, 0x87, 0x88, 0x89, 0x8a, 0x8b, 0x8c, 0x8d, 0x8e, 0x8f,
+		0xd0, 0xd1, 0xd2, 0xd3, 0xfe, 0xff)
+	setRange(&oneByteOps, opNone, 0x50, 0x5f)
+	setRange(&oneByteOps, opNone, 0x90, 0x99)
+	set(&oneByteOps, opNone, 0x9c, 0x9d, 0x9e, 0x9f, 0xa4, 0xa5, 0xa6, 0xa7, 0xaa, 0xab, 0xac, 0xad, 0xae, 0xaf,
+		0xc3, 0xc9, 0xf5, 0xf8, 0xf9, 0xfa, 0xfb, 0xfc, 0xfd)
+	set(&oneByteOps, opModRM8, 0x6b, 0x80, 0x83, 0xc0, 0xc1, 0xc6)
+	set(&oneByteOps, opModRMz, 0x69, 0x81, 0xc7)
+	set(&oneByteOps, opImm8, 0x6a, 0xa8)
+	setRange(&oneByteOps, opImm8, 0xb0, 0xb7)
+	set(&oneByteOps, opImmz, 0x68, 0xa9)
+	set(&oneByteOps, opImm16, 0xc2)
+	setRange(&oneByteOps, opRel8, 0x70, 0x7f)
+	set(&oneByteOps, opRel8, 0xeb)
+	set(&oneByteOps, opRel32, 0xe8, 0xe9)
+
+	set(&twoByteOps, opNone, 0x05, 0xa2)
+	setRange(&twoByteOps, opNone, 0xc8, 0xcf)
+	setRange(&twoByteOps, opModRM, 0x10, 0x1f)
+	setRange(&twoByteOps, opModRM, 0x28, 0x2f)
+	setRange(&twoByteOps, opModRM, 0x40, 0x6f)
+	setRange(&twoByteOps, opModRM8, 0x70, 0x73)
+	setRange(&twoByteOps, opModRM, 0x74, 0x7f)
+	setRange(&twoByteOps, opRel32, 0x80, 0x8f)
+	setRange(&twoByteOps, opModRM, 0x90, 0x9f)
+	set(&twoByteOps, opModRM, 0xa3, 0xa5, 0xab, 0xad, 0xaf, 0xb0, 0xb1, 0xb3, 0xb6, 0xb7, 0xbb, 0xbc, 0xbd, 0xbe, 0xbf,
+		0xc0, 0xc1, 0xc3, 0xc7)
+	set(&twoByteOps, opModRM8, 0xa4, 0xac, 0xba, 0xc2, 0xc4, 0xc5, 0xc6)
+	setRange(&twoByteOps, opModRM, 0xd0, 0xff)
+}
+
+// decodeX86 decodes the amd64 instruction at the start of code.  It handles
+// the instructions the compiler commonly generates, and returns an error for
+// the rest.
+func decodeX86(code []byte) (x86Instr, error) {
+	var inst x86Instr
+	errUnknown := errors.New("unrecognized instruction")
+	i := 0
+	next := func() (byte, bool) {
+		if i >= len(code) || i >= maxInstrLen {
+			return 0, false
+		}
+		i++
+		return code[i-1], true
+	}
+	// Legacy prefixes.
+	opsize16 := false
+	b, ok := next()
+prefixes:
+	for ok {
+		switch b {
+		case 0x66:
+			opsize16 = true
+		case 0x67, 0xf2, 0xf3, 0x2e, 0x3e, 0x26, 0x36, 0x64, 0x65, 0xf0:
+		default:
+			break prefixes
+		}
+		b, ok = next()
+	}
+	if !ok {
+		return inst, errUnknown
+	}
+	rexW := false
+	if b&0xf0 == 0x40 {
+		rexW = b&8 != 0
+		if b, ok = next(); !ok {
+			return inst, errUnknown
+		}
+	}
+	inst.opcode = i - 1
+	kind := oneByteOps[b]
+	switch b {
+	case 0x0f:
+		if b, ok = next(); !ok {
+			return inst, errUnknown
+		}
+		switch b {
+		case 0x38:
+			if _, ok = next(); !ok {
+				return inst, errUnknown
+			}
+			kind = opModRM
+		case 0x3a:
+			if _, ok = next(); !ok {
+				return inst, errUnknown
+			}
+			kind = opModRM8
+		default:
+			kind = twoByteOps[b]
+		}
+	case 0xb8, 0xb9, 0xba, 0xbb, 0xbc, 0xbd, 0xbe, 0xbf:
+		// MOV r, imm: the immediate is 8 bytes with REX.W.
+		kind = opImmz
+		if rexW {
+			i += 8
+			kind = opNone
+		}
+	case 0xf6, 0xf7:
+		// TEST r/m, imm has an immediate; the other group 3 instructions don't.
+		if i >= len(code) {
+			return inst, errUnknown
+		}
+		kind = opModRM
+		if (code[i]>>3)&7 < 2 {
+			kind = opModRM8
+			if b == 0xf7 {
+				kind = opModRMz
+			}
+		}
+	case 0xe8:
+		inst.call = true
+	case 0xff:
+		if i < len(code) && (code[i]>>3)&7 == 2 {
+			// Indirect CALL.
+			inst.call = true
+		}
+	}
+	immz := 4
+	if opsize16 {
+		immz = 2
+	}
+	switch kind {
+	case opBad:
+		return inst, errUnknown
+	case opModRM, opModRM8, opModRMz:
+		modrm, ok := next()
+		if !ok {
+			return inst, errUnknown
+		}
+		mod, rm := modrm>>6, modrm&7
+		if mod != 3 && rm == 4 {
+			sib, ok := next()
+			if !ok {
+				return inst, errUnknown
+			}
+			if mod == 0 && sib&7 == 5 {
+				i += 4
+			}
+		}
+		switch {
+		case mod == 0 && rm == 5:
+			inst.dispOffset = i
+			i += 4
+		case mod == 1:
+			i++
+		case mod == 2:
+			i += 4
+		}
+		switch kind {
+		case opModRM8:
+			i++
+		case opModRMz:
+			i += immz
+		}
+	case opImm8:
+		i++
+	case opImm16:
+		i += 2
+	case opImmz:
+		i += immz
+	case opRel8:
+		inst.relOffset, inst.relSize = i, 1
+		i++
+	case opRel32:
+		inst.relOffset, inst.relSize = i, 4
+		i += 4
+	}
+	if i > len(code) || i > maxInstrLen {
+		return inst, errUnknown
+	}
+	inst.len = i
+	return inst, nil
+}
+
+// relocateX86 returns a copy of the instruction inst, which is at pc and
+// whose bytes are code, modified to have the same effect when executed at
+// newPC.  Short branches are widened so that they can still reach their
+// targets.
+func relocateX86(inst x86Instr, code []byte, pc, newPC uint64) ([]byte, error) {
+	out := append([]byte(nil), code[:inst.len]...)
+	fits := func(d int64) bool { return d == int64(int32(d)) }
+	if inst.dispOffset != 0 {
+		disp := int64(int32(binary.LittleEndian.Uint32(out[inst.dispOffset:])))
+		disp += int64(pc - newPC)
+		if !fits(disp) {
+			return nil, errors.New("displacement out of range")
+		}
+		binary.LittleEndian.PutUint32(out[inst.dispOffset:], uint32(disp))
+	}
+	if inst.relOffset == 0 {
+		return out, nil
+	}
+	var target uint64
+	if inst.relSize == 1 {
+		target = pc + uint64(inst.len) + uint64(int64(int8(out[inst.relOffset])))
+		// Replace the short branch with its 32-bit form.
+		op := out[inst.opcode]
+		out = out[:inst.opcode]
+		if op == 0xeb {
+			out = append(out, 0xe9)
+		} else {
+			out = append(out, 0x0f, 0x80+op&0xf)
+		}
+		out = append(out, 0, 0, 0, 0)
+	} else {
+		target = pc + uint64(inst.len) + uint64(int64(int32(binary.LittleEndian.Uint32(out[inst.relOffset:]))))
+	}
+	rel := int64(target - (newPC + uint64(len(out))))
+	if !fits(rel) {
+		return nil, errors.New("branch target out of range")
+	}
+	binary.LittleEndian.PutUint32(out[len(out)-4:], uint32(rel))
+	return out, nil
+}
+
+// findScratch finds space in the executable's code where instructions can be
+// executed out of line: a run of the breakpoint instructions which the linker
+// uses to pad between functions, and which are never executed.
+func (s *Server) findScratch() (uint64, error) {
+	if s.scratchPC != 0 {
+		return s.scratchPC, nil
+	}
+	text, err := s.readSection(".text", "__text")
+	if err != nil {
+		return 0, err
+	}
+	run := 0
+	for i, b := range text.data {
+		if b != s.arch.BreakpointInstr[0] {
+			run = 0
+			continue
+		}
+		// Leave the padding's first byte alone, so that the preceding function
+		// still ends with a breakpoint instruction.
+		if run++; run == scratchLen+1 {
+			s.scratchPC = text.addr + uint64(i+1-scratchLen)
+			return s.scratchPC, nil
+		}
+	}
+	return 0, errors.New("no space to execute instructions out of line")
+}
+
+// readOriginalCode reads the code at addr, with any breakpoint instructions
+// replaced by the original code.
+func (s *Server) readOriginalCode(addr uint64, buf []byte) error {
+	if err := s.ptracePeek(s.stoppedPid, uintptr(addr), buf); err != nil {
+		return fmt.Errorf("ptracePeek: %v", err)
+	}
+	for pc, bp := range s.breakpoints {
+		for i := 0; i < s.arch.BreakpointSize; i++ {
+			if a := pc + uint64(i); a >= addr && a < addr+uint64(len(buf)) {
+				buf[a-addr] = bp.origInstr[i]
+			}
+		}
+	}
+	return nil
+}
+
+// stepOverBreakpoint executes the instruction that the breakpoint at pc
+// replaced, in the stopped thread.  The instruction is copied into scratch
+// space and single-stepped there, so the breakpoint stays in place for other
+// threads.  Instructions that can't be relocated are stepped over by briefly
+// restoring the original code instead.
+func (s *Server) stepOverBreakpoint(pc uint64) error {
+	code := make([]byte, maxInstrLen)
+	if err := s.readOriginalCode(pc, code); err != nil {
+		// The instruction may end near the end of the mapped code.
+		code = code[:s.arch.BreakpointSize]
+		if err := s.readOriginalCode(pc, code); err != nil {
+			return err
+		}
+	}
+	inst, err := decodeX86(code)
+	var scratch uint64
+	if err == nil {
+		scratch, err = s.findScratch()
+	}
+	var relocated []byte
+	if err == nil {
+		relocated, err = relocateX86(inst, code, pc, scratch)
+	}
+	if err != nil {
+		return s.stepOverBreakpointInPlace(pc)
+	}
+
+	buf := append(relocated, s.arch.BreakpointInstr[:s.arch.BreakpointSize]...)
+	if err := s.ptracePoke(s.stoppedPid, uintptr(scratch), buf); err != nil {
+		return fmt.Errorf("ptracePoke: %v", err)
+	}
+	regs := s.stoppedRegs
+	regs.Rip = scratch
+	if err := s.ptraceSetRegs(s.stoppedPid, &regs); err != nil {
+		return fmt.Errorf("ptraceSetRegs: %v", err)
+	}
+	if err := s.singleStep(); err != nil {
+		return err
+	}
+	if err := s.ptraceGetRegs(s.stoppedPid, &regs); err != nil {
+		return fmt.Errorf("ptraceGetRegs: %v", err)
+	}
+
+	var ret uint64
+	regs.Rip, ret = resumeOriginal(inst, pc, scratch, len(relocated), s.arch.BreakpointSize, regs.Rip)
+	if inst.call {
+		// Fix the return address that the call pushed.
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], ret)
+		if err := s.ptracePoke(s.stoppedPid, uintptr(regs.Rsp), b[:]); err != nil {
+			return fmt.Errorf("ptracePoke: %v", err)
+		}
+	}
+	if err := s.ptraceSetRegs(s.stoppedPid, &regs); err != nil {
+		return fmt.Errorf("ptraceSetRegs: %v", err)
+	}
+	s.stoppedRegs = regs
+	return nil
+}
+
+// resumeOriginal returns where a thread that has executed the copy of inst,
+// relocated from pc to n bytes at scratch, and is now at rip, carries on in
+// the original code, and, if inst is a call, the return address that must
+// replace the one the call pushed, which is in the copy.  If the instruction
+// didn't branch, the thread continues after the original instruction; if it
+// ran on to the breakpoint after the copy, it is treated the same way.
+func resumeOriginal(inst x86Instr, pc, scratch uint64, n, breakpointSize int, rip uint64) (newRIP, ret uint64) {
+	end := scratch + uint64(n)
+	if rip == end || rip == end+uint64(breakpointSize) {
+		rip = pc + uint64(inst.len)
+	}
+	if inst.call {
+		ret = pc + uint64(inst.len)
+	}
+	return rip, ret
+}
+
+// stepOverBreakpointInPlace executes the instruction that the breakpoint at
+// pc replaced by restoring it, single-stepping the stopped thread, and
+// putting the breakpoint back.  Other threads can miss the breakpoint while
+// it is lifted.
+func (s *Server) stepOverBreakpointInPlace(pc uint64) error {
+	bp := s.breakpoints[pc]
+	if err := s.ptracePoke(s.stoppedPid, uintptr(pc), bp.origInstr[:s.arch.BreakpointSize]); err != nil {
+		return fmt.Errorf("ptracePoke: %v", err)
+	}
+	if err := s.singleStep(); err != nil {
+		return err
+	}
+	if err := s.ptracePoke(s.stoppedPid, uintptr(pc), s.arch.BreakpointInstr[:s.arch.BreakpointSize]); err != nil {
+		return fmt.Errorf("ptracePoke: %v", err)
+	}
+	return s.ptraceGetRegs(s.stoppedPid, &s.stoppedRegs)
+}
+
+// singleStep executes one instruction in the stopped thread.  Unlike
+// waitForTrap, it steps the thread again rather than continuing it when a
+// signal arrives first, so that the thread can't run on past the
+// instruction.
+func (s *Server) singleStep() error {
+	pid := s.stoppedPid
+	for {
+		if err := s.ptraceSingleStep(pid); err != nil {
+			return fmt.Errorf("ptraceSingleStep: %v", err)
+		}
+		_, status, err := s.wait(pid, false)
+		if err != nil {
+			return fmt.Errorf("wait: %v", err)
+		}
+		if status.Exited() || status.Signaled() {
+			if pid == s.proc.Pid {
+				s.setExited(processExited(status))
+				return s.exited
+			}
+			return fmt.Errorf("thread %d exited while single-stepping", pid)
+		}
+		if status.StopSignal() == syscall.SIGTRAP && status.TrapCause() != ptraceEventClone {
+			return nil
+		}
+	}
+}
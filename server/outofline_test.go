@@ -0,0 +1,278 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"testing"
+
+	"golang.org/x/debug/arch"
+)
+
+func TestDecodeX86(t *testing.T) {
+	tests := []struct {
+		name string
+		code []byte
+		want x86Instr
+	}{
+		{"nop", []byte{0x90}, x86Instr{len: 1}},
+		{"push rbp", []byte{0x55}, x86Instr{len: 1}},
+		{"ret", []byte{0xc3, 0xcc}, x86Instr{len: 1}},
+		{"syscall", []byte{0x0f, 0x05}, x86Instr{len: 2}},
+
+		// Prefixes and REX.
+		{"mov rbp, rsp", []byte{0x48, 0x89, 0xe5}, x86Instr{len: 3, opcode: 1}},
+		{"lock cmpxchg [rdx], rcx", []byte{0xf0, 0x48, 0x0f, 0xb1, 0x0a}, x86Instr{len: 5, opcode: 2}},
+		{"cmp cx, imm16", []byte{0x66, 0x81, 0xf9, 0x34, 0x12}, x86Instr{len: 5, opcode: 1}},
+		{"mov eax, imm32", []byte{0xb8, 1, 2, 3, 4}, x86Instr{len: 5}},
+		{"mov ax, imm16", []byte{0x66, 0xb8, 1, 2}, x86Instr{len: 4, opcode: 1}},
+		{"movabs rax, imm64", []byte{0x48, 0xb8, 1, 2, 3, 4, 5, 6, 7, 8}, x86Instr{len: 10, opcode: 1}},
+		{"movsd xmm0, [rip+d]", []byte{0xf2, 0x0f, 0x10, 0x05, 1, 2, 3, 4}, x86Instr{len: 8, opcode: 1, dispOffset: 4}},
+		{"pshufb", []byte{0x66, 0x0f, 0x38, 0x00, 0xc1}, x86Instr{len: 5, opcode: 1}},
+		{"palignr", []byte{0x66, 0x0f, 0x3a, 0x0f, 0xc1, 0x08}, x86Instr{len: 6, opcode: 1}},
+
+		// ModRM and SIB.
+		{"sub rsp, imm8", []byte{0x48, 0x83, 0xec, 0x18}, x86Instr{len: 4, opcode: 1}},
+		{"sub rsp, imm32", []byte{0x48, 0x81, 0xec, 0, 1, 0, 0}, x86Instr{len: 7, opcode: 1}},
+		{"mov rax, [rsp+d8]", []byte{0x48, 0x8b, 0x44, 0x24, 0x08}, x86Instr{len: 5, opcode: 1}},
+		{"mov rax, [rsp+d32]", []byte{0x48, 0x8b, 0x84, 0x24, 0, 1, 0, 0}, x86Instr{len: 8, opcode: 1}},
+		{"mov eax, [abs32]", []byte{0x8b, 0x04, 0x25, 0x78, 0x56, 0x34, 0x12}, x86Instr{len: 7}},
+		{"mov rax, [rbx+rcx*8]", []byte{0x48, 0x8b, 0x04, 0xcb}, x86Instr{len: 4, opcode: 1}},
+		{"test eax, imm32", []byte{0xf7, 0xc0, 1, 2, 3, 4}, x86Instr{len: 6}},
+		{"test cl, imm8", []byte{0xf6, 0xc1, 0x01}, x86Instr{len: 3}},
+		{"neg eax", []byte{0xf7, 0xd8}, x86Instr{len: 2}},
+
+		// RIP-relative operands.
+		{"lea rax, [rip+d]", []byte{0x48, 0x8d, 0x05, 0x10, 0, 0, 0}, x86Instr{len: 7, opcode: 1, dispOffset: 3}},
+		{"cmp byte [rip+d], imm8", []byte{0x80, 0x3d, 1, 0, 0, 0, 5}, x86Instr{len: 7, dispOffset: 2}},
+		{"mov dword [rip+d], imm32", []byte{0xc7, 0x05, 1, 0, 0, 0, 1, 2, 3, 4}, x86Instr{len: 10, dispOffset: 2}},
+
+		// Branches and calls.
+		{"je rel8", []byte{0x74, 0x05}, x86Instr{len: 2, relOffset: 1, relSize: 1}},
+		{"je rel8 with hint", []byte{0x2e, 0x74, 0x05}, x86Instr{len: 3, opcode: 1, relOffset: 2, relSize: 1}},
+		{"je rel32", []byte{0x0f, 0x84, 1, 0, 0, 0}, x86Instr{len: 6, relOffset: 2, relSize: 4}},
+		{"jmp rel8", []byte{0xeb, 0xfe}, x86Instr{len: 2, relOffset: 1, relSize: 1}},
+		{"jmp rel32", []byte{0xe9, 1, 0, 0, 0}, x86Instr{len: 5, relOffset: 1, relSize: 4}},
+		{"call rel32", []byte{0xe8, 1, 0, 0, 0}, x86Instr{len: 5, relOffset: 1, relSize: 4, call: true}},
+		{"call rax", []byte{0xff, 0xd0}, x86Instr{len: 2, call: true}},
+		{"call [rip+d]", []byte{0xff, 0x15, 1, 0, 0, 0}, x86Instr{len: 6, dispOffset: 2, call: true}},
+		{"jmp rax", []byte{0xff, 0xe0}, x86Instr{len: 2}},
+	}
+	for _, tt := range tests {
+		// Decoding mustn't depend on what follows the instruction.
+		code := append(append([]byte(nil), tt.code...), 0xcc, 0xcc)
+		got, err := decodeX86(code)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeX86Rejects(t *testing.T) {
+	tests := []struct {
+		name string
+		code []byte
+	}{
+		{"empty", nil},
+		{"only prefixes", []byte{0x66, 0x66, 0x66}},
+		{"only REX", []byte{0x48}},
+		{"no ModRM", []byte{0x48, 0x8b}},
+		{"no SIB", []byte{0x48, 0x8b, 0x44}},
+		{"truncated displacement", []byte{0x48, 0x8d, 0x05, 0x10, 0}},
+		{"truncated immediate", []byte{0x48, 0x81, 0xec, 0, 1}},
+		{"truncated branch", []byte{0x0f, 0x84, 1}},
+		{"too long", append(bytes.Repeat([]byte{0x66}, maxInstrLen), 0x90)},
+		// Instructions that can't be relocated, or aren't decoded.
+		{"jrcxz", []byte{0xe3, 0x05}},
+		{"loop", []byte{0xe2, 0x05}},
+		{"int", []byte{0xcd, 0x80}},
+		{"VEX", []byte{0xc5, 0xf9, 0x6f, 0xc1}},
+		{"ud2", []byte{0x0f, 0x0b}},
+	}
+	for _, tt := range tests {
+		if inst, err := decodeX86(tt.code); err == nil {
+			t.Errorf("%s: decoded as %+v, want an error", tt.name, inst)
+		}
+	}
+}
+
+// ripTarget returns the address that the RIP-relative operand of inst, whose
+// bytes are code, refers to when it is at pc.
+func ripTarget(inst x86Instr, code []byte, pc uint64) uint64 {
+	disp := int32(binary.LittleEndian.Uint32(code[inst.dispOffset:]))
+	return pc + uint64(inst.len) + uint64(int64(disp))
+}
+
+// branchTarget returns the target of the branch inst, whose bytes are code,
+// when it is at pc.
+func branchTarget(inst x86Instr, code []byte, pc uint64) uint64 {
+	var rel int64
+	if inst.relSize == 1 {
+		rel = int64(int8(code[inst.relOffset]))
+	} else {
+		rel = int64(int32(binary.LittleEndian.Uint32(code[inst.relOffset:])))
+	}
+	return pc + uint64(inst.len) + uint64(rel)
+}
+
+func TestRelocateX86(t *testing.T) {
+	const (
+		pc      = 0x401000
+		scratch = 0x402000
+	)
+	tests := []struct {
+		name   string
+		code   []byte
+		pc     uint64
+		newPC  uint64
+		want   []byte // If not nil, the relocated instruction's bytes.
+		errMsg string // If not "", the expected error.
+	}{
+		{name: "nop", code: []byte{0x90}, pc: pc, newPC: scratch, want: []byte{0x90}},
+		{name: "mov rax, [rsp+d8]", code: []byte{0x48, 0x8b, 0x44, 0x24, 0x08}, pc: pc, newPC: scratch, want: []byte{0x48, 0x8b, 0x44, 0x24, 0x08}},
+		{name: "lea rax, [rip+d]", code: []byte{0x48, 0x8d, 0x05, 0x10, 0, 0, 0}, pc: pc, newPC: scratch, want: []byte{0x48, 0x8d, 0x05, 0x10, 0xf0, 0xff, 0xff}},
+		{name: "lea backwards", code: []byte{0x48, 0x8d, 0x05, 0x10, 0, 0, 0}, pc: scratch, newPC: pc},
+		{name: "cmp byte [rip+d], imm8", code: []byte{0x80, 0x3d, 1, 0, 0, 0, 5}, pc: pc, newPC: scratch},
+		{name: "call [rip+d]", code: []byte{0xff, 0x15, 8, 0, 0, 0}, pc: pc, newPC: scratch},
+		{name: "call rel32", code: []byte{0xe8, 0x10, 0, 0, 0}, pc: pc, newPC: scratch},
+		{name: "jmp rel32", code: []byte{0xe9, 0xf0, 0xff, 0xff, 0xff}, pc: pc, newPC: scratch},
+		{name: "je rel32", code: []byte{0x0f, 0x84, 0x10, 0, 0, 0}, pc: pc, newPC: scratch},
+
+		// Short branches are widened.
+		{name: "je rel8", code: []byte{0x74, 0x05}, pc: pc, newPC: scratch, want: []byte{0x0f, 0x84, 0x01, 0xf0, 0xff, 0xff}},
+		{name: "jg rel8", code: []byte{0x7f, 0x05}, pc: pc, newPC: scratch, want: []byte{0x0f, 0x8f, 0x01, 0xf0, 0xff, 0xff}},
+		{name: "jmp rel8", code: []byte{0xeb, 0xfe}, pc: pc, newPC: scratch, want: []byte{0xe9, 0xfb, 0xef, 0xff, 0xff}},
+		{name: "je rel8 with hint", code: []byte{0x3e, 0x74, 0x05}, pc: pc, newPC: scratch, want: []byte{0x3e, 0x0f, 0x84, 0x01, 0xf0, 0xff, 0xff}},
+
+		// Targets out of reach of the copy.
+		{name: "displacement out of range", code: []byte{0x48, 0x8d, 0x05, 0x10, 0, 0, 0}, pc: pc, newPC: pc + 3<<30, errMsg: "displacement out of range"},
+		{name: "branch out of range", code: []byte{0xe9, 0, 0, 0, 0}, pc: pc, newPC: pc + 3<<30, errMsg: "branch target out of range"},
+		{name: "short branch out of range", code: []byte{0x74, 0x05}, pc: pc + 3<<30, newPC: pc, errMsg: "branch target out of range"},
+	}
+	for _, tt := range tests {
+		inst, err := decodeX86(tt.code)
+		if err != nil {
+			t.Errorf("%s: decodeX86: %v", tt.name, err)
+			continue
+		}
+		out, err := relocateX86(inst, tt.code, tt.pc, tt.newPC)
+		if tt.errMsg != "" {
+			if err == nil || err.Error() != tt.errMsg {
+				t.Errorf("%s: got error %v, want %q", tt.name, err, tt.errMsg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if tt.want != nil && !bytes.Equal(out, tt.want) {
+			t.Errorf("%s: got % x, want % x", tt.name, out, tt.want)
+		}
+		if len(out) > scratchLen-1 {
+			t.Errorf("%s: relocated to %d bytes, more than the scratch space holds", tt.name, len(out))
+		}
+		// The copy must refer to the same addresses as the original.
+		relocated, err := decodeX86(out)
+		if err != nil {
+			t.Errorf("%s: decoding the relocated instruction % x: %v", tt.name, out, err)
+			continue
+		}
+		if relocated.len != len(out) || relocated.call != inst.call {
+			t.Errorf("%s: relocated instruction % x decodes as %+v", tt.name, out, relocated)
+		}
+		if inst.dispOffset != 0 {
+			if got, want := ripTarget(relocated, out, tt.newPC), ripTarget(inst, tt.code, tt.pc); got != want {
+				t.Errorf("%s: copy refers to %#x, want %#x", tt.name, got, want)
+			}
+		}
+		if inst.relOffset != 0 {
+			if relocated.relSize != 4 {
+				t.Errorf("%s: relocated branch has a %d-byte displacement", tt.name, relocated.relSize)
+			}
+			if got, want := branchTarget(relocated, out, tt.newPC), branchTarget(inst, tt.code, tt.pc); got != want {
+				t.Errorf("%s: copy branches to %#x, want %#x", tt.name, got, want)
+			}
+		}
+	}
+}
+
+func TestResumeOriginal(t *testing.T) {
+	const (
+		pc      = 0x401000
+		scratch = 0x402000
+		target  = 0x403000
+	)
+	tests := []struct {
+		name    string
+		code    []byte
+		rip     uint64 // Where the thread stopped after executing the copy.
+		wantRIP uint64
+		wantRet uint64
+	}{
+		{name: "fall through", code: []byte{0x48, 0x89, 0xe5}, rip: scratch + 3, wantRIP: pc + 3},
+		{name: "ran on to the breakpoint", code: []byte{0x48, 0x89, 0xe5}, rip: scratch + 4, wantRIP: pc + 3},
+		{name: "branch not taken", code: []byte{0x74, 0x05}, rip: scratch + 6, wantRIP: pc + 2},
+		{name: "branch taken", code: []byte{0x74, 0x05}, rip: target, wantRIP: target},
+		{name: "call", code: []byte{0xe8, 0, 0x20, 0, 0}, rip: target, wantRIP: target, wantRet: pc + 5},
+		{name: "indirect call", code: []byte{0xff, 0xd0}, rip: target, wantRIP: target, wantRet: pc + 2},
+		{name: "ret", code: []byte{0xc3}, rip: target, wantRIP: target},
+	}
+	for _, tt := range tests {
+		inst, err := decodeX86(tt.code)
+		if err != nil {
+			t.Errorf("%s: decodeX86: %v", tt.name, err)
+			continue
+		}
+		out, err := relocateX86(inst, tt.code, pc, scratch)
+		if err != nil {
+			t.Errorf("%s: relocateX86: %v", tt.name, err)
+			continue
+		}
+		rip, ret := resumeOriginal(inst, pc, scratch, len(out), 1, tt.rip)
+		if rip != tt.wantRIP || ret != tt.wantRet {
+			t.Errorf("%s: got PC %#x, return address %#x; want %#x, %#x", tt.name, rip, ret, tt.wantRIP, tt.wantRet)
+		}
+	}
+}
+
+func TestFindScratch(t *testing.T) {
+	// The test binary has padding between its functions.
+	exe, err := os.Executable()
+	if err != nil {
+		t.Skip(err)
+	}
+	s := &Server{arch: arch.AMD64, executable: exe}
+	addr, err := s.findScratch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := s.readSection(".text", "__text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The padding's first byte is left alone.
+	off := addr - text.addr
+	if off < 1 || off+scratchLen > uint64(len(text.data)) {
+		t.Fatalf("scratch space at %#x is outside the text section", addr)
+	}
+	if want := bytes.Repeat([]byte{0xcc}, scratchLen+1); !bytes.Equal(text.data[off-1:off+scratchLen], want) {
+		t.Errorf("scratch space at %#x holds % x, want breakpoint instructions", addr, text.data[off-1:off+scratchLen])
+	}
+	if again, err := s.findScratch(); err != nil || again != addr {
+		t.Errorf("findScratch again: got %#x, %v; want %#x", again, err, addr)
+	}
+
+	s = &Server{arch: arch.AMD64, executable: "testdata/no-such-file"}
+	if _, err := s.findScratch(); err == nil {
+		t.Error("findScratch succeeded for a missing executable")
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Capturing the output of the process.
+
+package server
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/server/protocol"
+)
+
+// maxUnreadOutput is how much of each of the process's output streams is kept
+// unread when there is no limit on the server's cached data.  Beyond it, the
+// oldest output is dropped, so that a client that doesn't read the output
+// can't make the server use ever more memory.
+const maxUnreadOutput = 4 << 20
+
+// outputBuffer holds what the process has written to its standard output or
+// standard error until the client reads it.  Its methods are safe for
+// concurrent use, since reads don't go through the server's request loop.
+type outputBuffer struct {
+	mu     sync.Mutex
+	cond   sync.Cond // Signaled when data arrives or the stream closes.
+	data   []byte
+	closed bool        // Whether the process has closed the stream.
+	gen    uint64      // Incremented for each process.
+	quota  *cacheQuota // Accounts for the buffered data.
+	max    int         // The most unread output kept when quota has no limit.
+
+	// note is the length of the note at the start of data saying how much
+	// output was dropped, or 0 if there is none or reading it has begun,
+	// and dropped is the number of bytes it reports.
+	note    int
+	dropped int64
+}
+
+func newOutputBuffer(quota *cacheQuota) *outputBuffer {
+	b := &outputBuffer{closed: true, quota: quota, max: maxUnreadOutput}
+	b.cond.L = &b.mu
+	return b
+}
+
+// start opens the stream for a new process, which writes to r, and copies
+// the output into the buffer until r is closed.
+func (b *outputBuffer) start(r io.ReadCloser) {
+	b.mu.Lock()
+	b.gen++
+	gen := b.gen
+	b.closed = false
+	b.mu.Unlock()
+
+	go func() {
+		defer r.Close()
+		buf := make([]byte, 4096)
+		for {
+			n, err := r.Read(buf)
+			// Leave the process blocked writing while the buffers are full.
+			b.quota.wait(int64(n))
+			b.mu.Lock()
+			b.data = append(b.data, buf[:n]...)
+			if len(b.data)-b.note > b.max && !b.quota.limited() {
+				b.dropOldest(len(b.data) - b.note - b.max)
+			}
+			if err != nil && b.gen == gen {
+				// An earlier process's stream mustn't close the current one.
+				b.closed = true
+			}
+			b.cond.Broadcast()
+			b.mu.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}()
+}
+
+// dropOldest discards the oldest n bytes of the unread output, replacing the
+// note at the start of the buffer with one that also counts them.
+func (b *outputBuffer) dropOldest(n int) {
+	if b.dropped == 0 {
+		debug.Log(debug.LevelWarn, "dropping unread output of the process", debug.Field{Key: "limit", Value: b.max})
+	}
+	b.dropped += int64(n)
+	note := fmt.Sprintf("[%d bytes of output dropped]\n", b.dropped)
+	kept := b.data[b.note+n:]
+	b.quota.release(int64(len(b.data) - len(kept)))
+	b.quota.wait(int64(len(note)))
+	b.data = append([]byte(note), kept...)
+	b.note = len(note)
+}
+
+// read removes and returns up to max bytes of output, waiting until some is
+// available.  eof is true if there is no more output because the stream is
+// closed.
+func (b *outputBuffer) read(max int) (data []byte, eof bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for len(b.data) == 0 && !b.closed {
+		b.cond.Wait()
+	}
+	if len(b.data) == 0 {
+		return nil, true
+	}
+	if max > len(b.data) {
+		max = len(b.data)
+	}
+	data = append([]byte(nil), b.data[:max]...)
+	b.data = b.data[max:]
+	if max < b.note {
+		b.note -= max
+	} else {
+		b.note, b.dropped = 0, 0
+	}
+	b.quota.release(int64(max))
+	return data, false
+}
+
+// ReadOutput is served directly rather than by the server's request loop, so
+// that a client waiting for output doesn't hold up other requests.
+func (s *Server) ReadOutput(req *protocol.ReadOutputRequest, resp *protocol.ReadOutputResponse) error {
+	var b *outputBuffer
+	switch req.FD {
+	case 1:
+		b = s.stdout
+	case 2:
+		b = s.stderr
+	default:
+		return fmt.Errorf("ReadOutput: bad file descriptor %d", req.FD)
+	}
+	if req.Len <= 0 {
+		return nil
+	}
+	resp.Data, resp.EOF = b.read(req.Len)
+	return nil
+}
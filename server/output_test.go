@@ -0,0 +1,88 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"io"
+	"testing"
+)
+
+// chunkReader returns one of its chunks from each Read.
+type chunkReader struct {
+	chunks []string
+	done   chan struct{} // Closed by Close.
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.chunks[0])
+	r.chunks = r.chunks[1:]
+	return n, nil
+}
+
+func (r *chunkReader) Close() error {
+	close(r.done)
+	return nil
+}
+
+func TestOutputBuffer(t *testing.T) {
+	tests := []struct {
+		name   string
+		limit  int64 // The cache quota.
+		chunks []string
+		want   string
+	}{
+		{"fits", 0, []string{"hi, ", "you"}, "hi, you"},
+		{"dropped", 0, []string{"0123456789abcdef"}, "[6 bytes of output dropped]\n6789abcdef"},
+		{"dropped twice", 0, []string{"0123456789", "abc", "defg"}, "[7 bytes of output dropped]\n789abcdefg"},
+		{"quota", 100, []string{"0123456789abcdef"}, "0123456789abcdef"},
+	}
+	for _, tt := range tests {
+		q := newCacheQuota()
+		q.setLimit(tt.limit)
+		b := newOutputBuffer(q)
+		b.max = 10
+		r := &chunkReader{chunks: tt.chunks, done: make(chan struct{})}
+		b.start(r)
+		<-r.done
+		var got []byte
+		for {
+			data, eof := b.read(4)
+			if eof {
+				break
+			}
+			got = append(got, data...)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: read %q, want %q", tt.name, got, tt.want)
+		}
+		if q.used != 0 {
+			t.Errorf("%s: %d bytes still accounted for after reading everything", tt.name, q.used)
+		}
+	}
+}
+
+// TestOutputDroppedWhileReading checks that output dropped after the client
+// has begun reading the note about earlier drops is reported in a new note.
+func TestOutputDroppedWhileReading(t *testing.T) {
+	b := newOutputBuffer(newCacheQuota())
+	b.max = 4
+	b.data = []byte("abcdef")
+	b.dropOldest(2)
+	if got, want := string(b.data), "[2 bytes of output dropped]\ncdef"; got != want {
+		t.Fatalf("after dropping 2 bytes, buffer is %q, want %q", got, want)
+	}
+	b.closed = true
+	if data, _ := b.read(5); string(data) != "[2 by" {
+		t.Fatalf("read %q, want %q", data, "[2 by")
+	}
+	b.data = append(b.data, "gh"...)
+	b.dropOldest(2)
+	if got, want := string(b.data), "[4 bytes of output dropped]\nefgh"; got != want {
+		t.Errorf("after dropping 2 more bytes, buffer is %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Stopping the program where it panics or fails, and describing the panic.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/dwarf"
+	"golang.org/x/debug/server/protocol"
+)
+
+// defaultPanicStops are the functions the program stops at the start of
+// unless SetPanicStops says otherwise.
+var defaultPanicStops = []string{"runtime.gopanic", "runtime.fatalpanic", "runtime.throw", "runtime.fatal"}
+
+// maxPanicChain limits how many panics and deferred calls PanicInfo reads,
+// in case a chain is corrupt.
+const maxPanicChain = 1000
+
+func (s *Server) SetPanicStops(req *protocol.SetPanicStopsRequest, resp *protocol.SetPanicStopsResponse) error {
+	return s.call(s.breakpointc, req, resp)
+}
+
+func (s *Server) handleSetPanicStops(req *protocol.SetPanicStopsRequest, resp *protocol.SetPanicStopsResponse) error {
+	s.panicFunctions = append([]string(nil), req.Functions...)
+	if s.proc == nil || !s.procIsUp {
+		// They are set when the program is run.
+		return nil
+	}
+	return s.insertPanicStops()
+}
+
+// insertPanicStops sets breakpoints at the start of the functions in
+// s.panicFunctions, in place of those set before.
+func (s *Server) insertPanicStops() error {
+	stops := make(map[uint64]string)
+	var pcs []uint64
+	for _, name := range s.panicFunctions {
+		pc, err := s.functionStartAddress(name)
+		if err != nil {
+			continue
+		}
+		stops[pc] = name
+		pcs = append(pcs, pc)
+	}
+	if err := s.insertBreakpointPCs(pcs); err != nil {
+		return err
+	}
+	var old []uint64
+	for pc := range s.panicStops {
+		old = append(old, pc)
+	}
+	s.panicStops = stops
+	return s.removeUnusedBreakpointPCs(old)
+}
+
+func (s *Server) PanicInfo(req *protocol.PanicInfoRequest, resp *protocol.PanicInfoResponse) error {
+	return s.call(s.otherc, req, resp)
+}
+
+func (s *Server) handlePanicInfo(req *protocol.PanicInfoRequest, resp *protocol.PanicInfoResponse) error {
+	regs := &s.stoppedRegs
+	fn, ok := s.panicStops[regs.Rip]
+	if !ok {
+		return errors.New("PanicInfo: the program isn't stopped at a panic")
+	}
+	info := debug.PanicInfo{Function: fn}
+	g, err := s.currentG(regs)
+	if err != nil {
+		return fmt.Errorf("PanicInfo: reading the current goroutine: %v", err)
+	}
+	gType, err := s.runtimeStruct("runtime.g")
+	if err != nil {
+		return fmt.Errorf("PanicInfo: %v", err)
+	}
+	if id, err := s.peekUintOrIntStructField(gType, g, "goid"); err == nil {
+		info.Goroutine = int64(id)
+	}
+	if info.Panics, err = s.panics(gType, g); err != nil {
+		return fmt.Errorf("PanicInfo: %v", err)
+	}
+	if info.Deferred, err = s.deferredCalls(gType, g); err != nil {
+		return fmt.Errorf("PanicInfo: %v", err)
+	}
+	switch fn {
+	case "runtime.gopanic":
+		// The new panic is only added to the goroutine's panics once
+		// gopanic has started, so its value is read from the argument.
+		for _, p := range s.callArgs(regs.Rip, regs.Rsp) {
+			if p.Name == "e" {
+				info.Value = p.Value
+			}
+		}
+	case "runtime.fatalpanic":
+		if len(info.Panics) > 0 {
+			info.Value = info.Panics[0].Value
+		}
+	case "runtime.throw", "runtime.fatal":
+		if msg, err := s.fatalMessage(regs); err == nil {
+			info.Message = "fatal error: " + msg
+		}
+	}
+	resp.Info = info
+	return nil
+}
+
+// panics returns the panics in progress in the goroutine g, newest first.
+func (s *Server) panics(gType *dwarf.StructType, g uint64) ([]debug.Panic, error) {
+	pType, err := s.runtimeStruct("runtime._panic")
+	if err != nil {
+		return nil, err
+	}
+	arg, err := getField(pType, "arg")
+	if err != nil {
+		return nil, err
+	}
+	recovered, err := getField(pType, "recovered")
+	if err != nil {
+		return nil, err
+	}
+	var panics []debug.Panic
+	p, err := s.peekPtrStructField(gType, g, "_panic")
+	for ; err == nil && p != 0 && len(panics) < maxPanicChain; p, err = s.peekPtrStructField(pType, p, "link") {
+		var pn debug.Panic
+		v, perr := s.printer.SprintValueAt(arg.Type, p+uint64(arg.ByteOffset))
+		if perr != nil {
+			v = "<" + perr.Error() + ">"
+		}
+		pn.Value = v
+		if r, err := s.peekUint(p+uint64(recovered.ByteOffset), 1); err == nil {
+			pn.Recovered = r != 0
+		}
+		panics = append(panics, pn)
+	}
+	return panics, err
+}
@@ -0,0 +1,192 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Debugging executables stripped of their DWARF data, using the function and
+// line tables the Go runtime keeps for itself in .gopclntab.  Breakpoints,
+// stack traces and raw memory work; anything needing types doesn't.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/elf"
+	"golang.org/x/debug/gosym"
+	"golang.org/x/debug/server/protocol"
+)
+
+// errNoDWARF is returned for requests that need the executable's DWARF data
+// when it has none.
+var errNoDWARF = errors.New("no DWARF data")
+
+// loadPCLN reads the runtime's function and line tables from the ELF
+// executable f.
+func loadPCLN(f *os.File) (*gosym.Table, error) {
+	obj, err := elf.NewFile(f)
+	if err != nil {
+		return nil, err
+	}
+	pclntab, text := obj.Section(".gopclntab"), obj.Section(".text")
+	if pclntab == nil || text == nil {
+		return nil, fmt.Errorf("no .gopclntab section")
+	}
+	data, err := pclntab.Data()
+	if err != nil {
+		return nil, err
+	}
+	// Since Go 1.3 .gosymtab is empty, and the table is read from the
+	// pclntab alone.
+	return gosym.NewTable(nil, gosym.NewLineTable(data, text.Addr))
+}
+
+// needsDWARF reports whether the request can only be served with the
+// executable's DWARF data.  Those that can be served without it find
+// functions, lines and frame sizes in the pclntab instead.
+func needsDWARF(req interface{}) bool {
+	switch req.(type) {
+	case *protocol.BreakpointRequest, *protocol.BreakpointAtFunctionRequest, *protocol.BreakpointAtLineRequest,
+		*protocol.BreakpointAtCgoCallsRequest, *protocol.DeleteBreakpointsRequest, *protocol.EnableBreakpointRequest,
+		*protocol.SetBreakpointCallerRequest, *protocol.SetBreakpointOneShotRequest,
+		*protocol.SetBreakpointGroupRequest, *protocol.EnableBreakpointGroupRequest, *protocol.DeleteBreakpointGroupRequest,
+		*protocol.ListBreakpointsRequest, *protocol.DeleteWatchpointsRequest,
+		*protocol.RunRequest, *protocol.RestartRequest, *protocol.KillRequest, *protocol.DetachRequest, *protocol.ShutdownRequest,
+		*protocol.ResumeRequest, *protocol.ResumeAsyncRequest, *protocol.StepInstructionRequest,
+		*protocol.RunToLineRequest, *protocol.InterruptRequest, *protocol.FramesRequest,
+		*protocol.ThreadsRequest, *protocol.SelectThreadRequest, *protocol.SharedObjectsRequest,
+		*protocol.ReadMemoryRequest, *protocol.WriteMemoryRequest,
+		*protocol.OpenRequest, *protocol.ReadAtRequest, *protocol.CloseRequest,
+		*protocol.SetKillOnExitRequest, *protocol.SetDeterministicRequest, *protocol.SetShowTemporariesRequest,
+		*protocol.SetSignalPolicyRequest, *protocol.SetPanicStopsRequest, *protocol.SetThreadStopsRequest, *protocol.BinaryInfoRequest,
+		*protocol.CheckpointRequest, *protocol.RestoreRequest, *protocol.DeleteCheckpointRequest,
+		*protocol.SetRecordingRequest, *protocol.ReverseToPreviousBreakRequest, *protocol.ReverseToPreviousStopRequest:
+		return false
+	}
+	return true
+}
+
+// pclnFunction returns the name and entry point of the function containing
+// pc, from the pclntab.
+func (s *Server) pclnFunction(pc uint64) (name string, funcEntry uint64, err error) {
+	if s.pcln == nil {
+		return "", 0, errNoDWARF
+	}
+	f := s.pcln.PCToFunc(pc - s.loadBias)
+	if f == nil {
+		return "", 0, fmt.Errorf("no function contains PC %#x", pc)
+	}
+	return f.Name, f.Entry + s.loadBias, nil
+}
+
+// pclnFunctionStart returns the entry point of the named function, from the
+// pclntab.
+func (s *Server) pclnFunctionStart(name string) (uint64, error) {
+	if s.pcln == nil {
+		return 0, errNoDWARF
+	}
+	f := s.pcln.LookupFunc(name)
+	if f == nil {
+		return 0, fmt.Errorf("function %q not found", name)
+	}
+	return f.Entry + s.loadBias, nil
+}
+
+// pclnSource returns the file and line of pc, from the pclntab.
+func (s *Server) pclnSource(pc uint64) (file string, line uint64, err error) {
+	if s.pcln == nil {
+		return "", 0, errNoDWARF
+	}
+	file, l, f := s.pcln.PCToLine(pc - s.loadBias)
+	if f == nil || l < 0 {
+		return "", 0, fmt.Errorf("no line information for PC %#x", pc)
+	}
+	return file, uint64(l), nil
+}
+
+// pclnSPOffset returns the offset from the stack pointer at pc to the
+// canonical frame address, which is just above the return address, from the
+// pclntab's record of how far the function has moved the stack pointer.
+func (s *Server) pclnSPOffset(pc uint64) (int64, error) {
+	if s.pcln == nil {
+		return 0, errNoDWARF
+	}
+	adj := s.pcln.PCToSPAdj(pc - s.loadBias)
+	if adj < 0 {
+		return 0, fmt.Errorf("no frame size for PC %#x", pc)
+	}
+	return int64(adj) + int64(s.arch.PointerSize), nil
+}
+
+// pclnLineToPCs returns the first address of the given line in the file
+// whose name best matches file: the file itself, or failing that the
+// shortest name ending with it.  Unlike the DWARF line table, the pclntab
+// doesn't mark statement boundaries, so there is one address per line.
+func (s *Server) pclnLineToPCs(file string, line uint64) ([]uint64, error) {
+	if s.pcln == nil {
+		return nil, errNoDWARF
+	}
+	best := ""
+	for name := range s.pcln.Files {
+		if name == file {
+			best = name
+			break
+		}
+		if strings.HasSuffix(name, "/"+file) && (best == "" || len(name) < len(best)) {
+			best = name
+		}
+	}
+	if best == "" {
+		return nil, fmt.Errorf("couldn't find file %q", file)
+	}
+	pc, _, err := s.pcln.LineToPC(best, int(line))
+	if err != nil {
+		return nil, err
+	}
+	return []uint64{pc + s.loadBias}, nil
+}
+
+// walkStackPCLN is walkStack for executables without DWARF data.  The frames
+// have functions and lines, but no parameters or variables.
+func (s *Server) walkStackPCLN(pc, sp uint64, count int) ([]debug.Frame, error) {
+	var frames []debug.Frame
+	var buf [8]byte
+	for i := 0; i < count; i++ {
+		name, funcEntry, err := s.pclnFunction(pc)
+		if err != nil {
+			return frames, err
+		}
+		fpOffset, err := s.pclnSPOffset(pc)
+		if err != nil {
+			return frames, err
+		}
+		fp := sp + uint64(fpOffset)
+		frame := debug.Frame{
+			PC:            pc,
+			SP:            sp,
+			Function:      name,
+			FunctionStart: funcEntry,
+			Kind:          frameKind(name),
+		}
+		// As in walkStack, a caller's location is that of the byte before
+		// its return address.
+		linePC := pc
+		if i > 0 {
+			linePC--
+		}
+		frame.File, frame.Line, _ = s.pclnSource(linePC)
+		frames = append(frames, frame)
+
+		if s.topOfStack(funcEntry) {
+			break
+		}
+		if err := s.ptracePeek(s.stoppedPid, uintptr(fp-uint64(s.arch.PointerSize)), buf[:s.arch.PointerSize]); err != nil {
+			return frames, fmt.Errorf("ptracePeek: %v", err)
+		}
+		pc, sp = s.arch.Uintptr(buf[:s.arch.PointerSize]), fp
+	}
+	return frames, nil
+}
@@ -16,6 +16,9 @@ import (
 
 // peekBytes reads len(buf) bytes at addr.
 func (s *Server) peekBytes(addr uint64, buf []byte) error {
+	if err := s.chargeRead(len(buf)); err != nil {
+		return err
+	}
 	return s.ptracePeek(s.stoppedPid, uintptr(addr), buf)
 }
 
@@ -75,10 +78,11 @@ func (s *Server) peekSlice(t *dwarf.SliceType, addr uint64) (debug.Slice, error)
 
 	return debug.Slice{
 		debug.Array{
-			ElementTypeID: uint64(t.ElemType.Common().Offset),
-			Address:       uint64(ptr),
-			Length:        length,
-			StrideBits:    uint64(t.ElemType.Common().ByteSize) * 8,
+			ElementTypeID:   uint64(t.ElemType.Common().Offset),
+			ElementTypeName: typeName(t.ElemType),
+			Address:         uint64(ptr),
+			Length:          length,
+			StrideBits:      uint64(t.ElemType.Common().ByteSize) * 8,
 		},
 		capacity,
 	}, nil
@@ -358,7 +362,12 @@ func (s *Server) peekMapLength(t *dwarf.MapType, a uint64) (uint64, error) {
 		// The pointer was nil, so the map is empty.
 		return 0, nil
 	}
-	length, err := s.peekUintOrIntStructField(st, a, "count")
+	field := "count"
+	if _, err := getField(st, field); err != nil {
+		// Swiss table maps, used since Go 1.24, count their elements in used.
+		field = "used"
+	}
+	length, err := s.peekUintOrIntStructField(st, a, field)
 	if err != nil {
 		return 0, fmt.Errorf("reading map: %s", err)
 	}
@@ -0,0 +1,118 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Relocating the addresses in the debugging information for executables,
+// such as position-independent ones, that aren't loaded at the address they
+// were linked at.
+
+package server
+
+import (
+	"os"
+
+	"golang.org/x/debug/dwarf"
+	"golang.org/x/debug/elf"
+	"golang.org/x/debug/macho"
+	"golang.org/x/debug/pe"
+)
+
+// fileEntry returns the address the executable f was linked at that is
+// found again in the process, by processEntry, to tell where it was loaded:
+// the entry point of an ELF file, or the address of the headers of a PE or
+// Mach-O file.  It returns 0 for other files.
+func fileEntry(f *os.File) uint64 {
+	if obj, err := elf.NewFile(f); err == nil {
+		return obj.Entry
+	}
+	if obj, err := pe.NewFile(f); err == nil {
+		return obj.ImageBase()
+	}
+	if obj, err := macho.NewFile(f); err == nil {
+		if text := obj.Segment("__TEXT"); text != nil {
+			return text.Addr
+		}
+	}
+	return 0
+}
+
+// readLoadBias sets s.loadBias for the newly started process, from the
+// difference between where the address fileEntry found is in the process
+// and where it was linked.
+func (s *Server) readLoadBias() error {
+	s.loadBias = 0
+	s.scratchPC = 0 // It depends on the load bias.
+	if s.entry == 0 {
+		return nil
+	}
+	entry, err := s.processEntry()
+	if err != nil {
+		return err
+	}
+	s.loadBias = entry - s.entry
+	return nil
+}
+
+// The following methods answer questions about addresses in the process
+// using the debugging information, translating between the two.
+
+func (s *Server) pcToFunction(pc uint64) (entry *dwarf.Entry, funcEntry uint64, err error) {
+	if s.dwarfData == nil {
+		return nil, 0, errNoDWARF
+	}
+	entry, funcEntry, err = s.dwarfData.PCToFunction(pc - s.loadBias)
+	return entry, funcEntry + s.loadBias, err
+}
+
+// pcToFunctionName is like pcToFunction, but only returns the function's
+// name, which it can also find without DWARF data, and in the shared
+// objects the process has loaded.
+func (s *Server) pcToFunctionName(pc uint64) (name string, funcEntry uint64, err error) {
+	if o := s.objectAt(pc); o != nil {
+		return o.function(pc)
+	}
+	if s.dwarfData == nil {
+		return s.pclnFunction(pc)
+	}
+	entry, funcEntry, err := s.pcToFunction(pc)
+	if err != nil {
+		return "", 0, err
+	}
+	name, _ = entry.Val(dwarf.AttrName).(string)
+	return name, funcEntry, nil
+}
+
+func (s *Server) pcToSPOffset(pc uint64) (int64, error) {
+	if o := s.objectAt(pc); o != nil {
+		return o.dwarf.PCToSPOffset(pc - o.base)
+	}
+	if s.dwarfData == nil {
+		return s.pclnSPOffset(pc)
+	}
+	return s.dwarfData.PCToSPOffset(pc - s.loadBias)
+}
+
+func (s *Server) entryLocation(e *dwarf.Entry) (uint64, error) {
+	addr, err := s.dwarfData.EntryLocation(e)
+	return addr + s.loadBias, err
+}
+
+func (s *Server) lineToBreakpointPCs(file string, line uint64) ([]uint64, error) {
+	var (
+		pcs []uint64
+		err error
+	)
+	if s.dwarfData == nil {
+		pcs, err = s.pclnLineToPCs(file, line)
+	} else {
+		pcs, err = s.dwarfData.LineToBreakpointPCs(file, line)
+		for i := range pcs {
+			pcs[i] += s.loadBias
+		}
+	}
+	// The line can also be in the code of shared objects, such as plugins.
+	if opcs := s.objectLineToBreakpointPCs(file, line); len(opcs) > 0 {
+		pcs, err = append(pcs, opcs...), nil
+	}
+	return pcs, err
+}
@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"fmt"
 
+	"golang.org/x/debug"
 	"golang.org/x/debug/arch"
 	"golang.org/x/debug/dwarf"
 )
@@ -31,6 +32,8 @@ type Printer struct {
 	arch     *arch.Architecture
 	printBuf bytes.Buffer            // Accumulates the output.
 	visited  map[typeAndAddress]bool // Prevents looping on cyclic data.
+	opts     debug.FormatOptions
+	depth    int // How deeply the value being printed is nested.
 }
 
 // printf prints to printBuf.
@@ -59,11 +62,17 @@ func NewPrinter(arch *arch.Architecture, dwarf *dwarf.Data, server *Server) *Pri
 	}
 }
 
+// SetOptions sets how later printing operations format values.
+func (p *Printer) SetOptions(opts debug.FormatOptions) {
+	p.opts = opts
+}
+
 // reset resets the Printer. It must be called before starting a new
 // printing operation.
 func (p *Printer) reset() {
 	p.err = nil
 	p.printBuf.Reset()
+	p.depth = 0
 	// Just wipe the map rather than reallocating. It's almost always tiny.
 	for k := range p.visited {
 		delete(p.visited, k)
@@ -82,7 +91,7 @@ func (p *Printer) Sprint(name string) (string, error) {
 		var a uint64
 		iface := entry.Val(dwarf.AttrLocation)
 		if iface != nil {
-			a = p.decodeLocation(iface.([]byte))
+			a = p.decodeLocation(iface.([]byte)) + p.server.loadBias
 		}
 		p.printEntryValueAt(entry, a)
 	default:
@@ -114,6 +123,13 @@ func (p *Printer) SprintEntry(entry *dwarf.Entry, a uint64) (string, error) {
 	return p.printBuf.String(), p.err
 }
 
+// SprintValueAt returns the pretty-printed value of the data of the specified type at the specified address.
+func (p *Printer) SprintValueAt(typ dwarf.Type, a uint64) (string, error) {
+	p.reset()
+	p.printValueAt(typ, a)
+	return p.printBuf.String(), p.err
+}
+
 // printEntryValueAt pretty-prints the data at the specified address.
 // using the type information in the Entry.
 func (p *Printer) printEntryValueAt(entry *dwarf.Entry, a uint64) {
@@ -144,6 +160,13 @@ func (p *Printer) printEntryValueAt(entry *dwarf.Entry, a uint64) {
 // printValueAt pretty-prints the data at the specified address.
 // using the provided type information.
 func (p *Printer) printValueAt(typ dwarf.Type, a uint64) {
+	switch typ.(type) {
+	case *dwarf.StructType, *dwarf.ArrayType, *dwarf.SliceType, *dwarf.MapType:
+		if !p.descend() {
+			return
+		}
+		defer p.ascend()
+	}
 	if a != 0 {
 		// Check if we are repeating the same type and address.
 		ta := typeAndAddress{typ, a}
@@ -168,20 +191,20 @@ func (p *Printer) printValueAt(typ dwarf.Type, a uint64) {
 		if ptr, err := p.server.peekPtr(a); err != nil {
 			p.errorf("reading pointer: %s", err)
 		} else {
-			p.printf("%#x", ptr)
+			p.printPointer(typ, ptr)
 		}
 	case *dwarf.IntType:
 		// Sad we can't tell a rune from an int32.
 		if i, err := p.server.peekInt(a, typ.ByteSize); err != nil {
 			p.errorf("reading integer: %s", err)
 		} else {
-			p.printf("%d", i)
+			p.printInteger(i)
 		}
 	case *dwarf.UintType:
 		if u, err := p.server.peekUint(a, typ.ByteSize); err != nil {
 			p.errorf("reading unsigned integer: %s", err)
 		} else {
-			p.printf("%d", u)
+			p.printInteger(u)
 		}
 	case *dwarf.FloatType:
 		buf := make([]byte, typ.ByteSize)
@@ -217,7 +240,7 @@ func (p *Printer) printValueAt(typ dwarf.Type, a uint64) {
 			p.errorf("can't handle struct type %s", typ.Kind)
 			return
 		}
-		p.printf("%s {", typ.String())
+		p.printf("%s {", dwarf.DemangleShapes(typ.String()))
 		for i, field := range typ.Field {
 			if i != 0 {
 				p.printf(", ")
@@ -240,7 +263,7 @@ func (p *Printer) printValueAt(typ dwarf.Type, a uint64) {
 	case *dwarf.TypedefType:
 		p.printValueAt(typ.Type, a)
 	case *dwarf.FuncType:
-		p.printf("%v @%#x ", typ, a)
+		p.printFuncAt(typ, a)
 	case *dwarf.VoidType:
 		p.printf("void")
 	default:
@@ -248,6 +271,79 @@ func (p *Printer) printValueAt(typ dwarf.Type, a uint64) {
 	}
 }
 
+// descend enters a value nested in the one being printed, and reports whether
+// it should be printed.  If the value is nested too deeply, descend prints
+// "..." in its place instead.
+func (p *Printer) descend() bool {
+	if p.opts.MaxDepth > 0 && p.depth >= p.opts.MaxDepth {
+		p.printf("...")
+		return false
+	}
+	p.depth++
+	return true
+}
+
+// ascend leaves a value entered by descend.
+func (p *Printer) ascend() {
+	p.depth--
+}
+
+// printInteger prints a signed or unsigned integer in the base the options
+// call for.
+func (p *Printer) printInteger(i interface{}) {
+	if p.opts.Hex {
+		p.printf("%#x", i)
+	} else {
+		p.printf("%d", i)
+	}
+}
+
+// printPointer prints the pointer ptr of the given type: as an address, or
+// if the options say to dereference pointers, as "&" followed by the value it
+// points to.
+func (p *Printer) printPointer(typ *dwarf.PtrType, ptr uint64) {
+	if !p.opts.Deref || ptr == 0 {
+		p.printf("%#x", ptr)
+		return
+	}
+	if _, ok := typ.Type.(*dwarf.VoidType); ok || typ.Type == nil {
+		// An unsafe.Pointer, whose target's type isn't known.
+		p.printf("%#x", ptr)
+		return
+	}
+	if !p.descend() {
+		return
+	}
+	defer p.ascend()
+	p.printf("&")
+	p.printValueAt(typ.Type, ptr)
+}
+
+// maxElements returns how many elements of an array, slice or map are
+// printed, given the default.  A negative default means all of them.
+func (p *Printer) maxElements(def int64) int64 {
+	if p.opts.MaxElements > 0 {
+		return int64(p.opts.MaxElements)
+	}
+	return def
+}
+
+// printFuncAt prints the func value at a as the name of the function it
+// refers to, and the function's address.
+func (p *Printer) printFuncAt(typ *dwarf.FuncType, a uint64) {
+	f, err := p.server.funcValue(a)
+	switch {
+	case err != nil:
+		p.errorf("%s", err)
+	case f.Address == 0:
+		p.printf("<nil>")
+	case f.Name == "":
+		p.printf("%v @%#x", typ, f.Entry)
+	default:
+		p.printf("%s (%#x)", f.Name, f.Entry)
+	}
+}
+
 func (p *Printer) printArrayAt(typ *dwarf.ArrayType, a uint64) {
 	elemType := typ.Type
 	length := typ.Count
@@ -257,8 +353,8 @@ func (p *Printer) printArrayAt(typ *dwarf.ArrayType, a uint64) {
 	}
 	p.printf("%s{", typ)
 	n := length
-	if n > 100 {
-		n = 100 // TODO: Have a way to control this?
+	if limit := p.maxElements(100); n > limit {
+		n = limit
 	}
 	for i := int64(0); i < n; i++ {
 		if i != 0 {
@@ -273,7 +369,34 @@ func (p *Printer) printArrayAt(typ *dwarf.ArrayType, a uint64) {
 	p.printf("}")
 }
 
+// printInterfaceAt prints the interface at a as its dynamic type's name and
+// its data word or, if the options say to dereference pointers, its dynamic
+// value.
 func (p *Printer) printInterfaceAt(t *dwarf.InterfaceType, a uint64) {
+	iface, err := p.server.interfaceValue(t, a)
+	if err == nil && iface.TypeName == "" && iface.Data == 0 {
+		p.printf("(<nil>, <nil>)")
+		return
+	}
+	if err == nil && iface.TypeName != "" {
+		p.printf("(%q, ", iface.TypeName)
+		dyn, err := p.server.dwarfData.Type(dwarf.Offset(iface.TypeID))
+		switch {
+		case iface.Data == 0:
+			p.printf("<nil>")
+		case err == nil && p.opts.Deref:
+			if p.descend() {
+				p.printValueAt(dyn, iface.Value.Address)
+				p.ascend()
+			}
+		default:
+			p.printf("%#x", iface.Data)
+		}
+		p.printf(")")
+		return
+	}
+	// Otherwise, read the type's name from the runtime's type descriptor, as
+	// laid out by older runtimes.
 	// t embeds a TypedefType, which may point to another typedef.
 	// The underlying type should be a struct.
 	st, ok := followTypedefs(&t.TypedefType).(*dwarf.StructType)
@@ -378,15 +501,16 @@ func (p *Printer) printTypeOfInterface(t dwarf.Type, a uint64) {
 	}
 }
 
-// maxMapValuesToPrint values are printed for each map; any remaining values are
-// truncated to "...".
+// By default, maxMapValuesToPrint values are printed for each map; any
+// remaining values are truncated to "...".
 const maxMapValuesToPrint = 8
 
 func (p *Printer) printMapAt(typ *dwarf.MapType, a uint64) {
 	count := 0
+	limit := int(p.maxElements(maxMapValuesToPrint))
 	fn := func(keyAddr, valAddr uint64, keyType, valType dwarf.Type) (stop bool) {
 		count++
-		if count > maxMapValuesToPrint {
+		if count > limit {
 			return false
 		}
 		if count > 1 {
@@ -401,7 +525,7 @@ func (p *Printer) printMapAt(typ *dwarf.MapType, a uint64) {
 	if err := p.server.peekMapValues(typ, a, fn); err != nil {
 		p.errorf("reading map values: %s", err)
 	}
-	if count > maxMapValuesToPrint {
+	if count > limit {
 		p.printf(" ...")
 	}
 	p.printf("]")
@@ -475,19 +599,29 @@ func (p *Printer) printSliceAt(typ *dwarf.SliceType, a uint64) {
 	if !ok {
 		p.errorf("can't determine element size")
 	}
+	n := length
+	if limit := p.maxElements(-1); limit >= 0 && n > uint64(limit) {
+		n = uint64(limit)
+	}
 	p.printf("%s{", typ)
-	for i := uint64(0); i < length; i++ {
+	for i := uint64(0); i < n; i++ {
 		if i != 0 {
 			p.printf(", ")
 		}
 		p.printValueAt(elemType, ptr)
 		ptr += size // TODO: Alignment and padding - not given by Type
 	}
+	if n < length {
+		p.printf(", ...")
+	}
 	p.printf("}")
 }
 
 func (p *Printer) printStringAt(typ *dwarf.StringType, a uint64) {
-	const maxStringSize = 100
+	maxStringSize := uint64(100)
+	if p.opts.MaxStringLen > 0 {
+		maxStringSize = uint64(p.opts.MaxStringLen)
+	}
 	if s, err := p.server.peekString(typ, a, maxStringSize); err != nil {
 		p.errorf("reading string: %s", err)
 	} else {
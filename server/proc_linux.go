@@ -0,0 +1,131 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Finding out about the process and its threads from /proc, and signalling
+// them.
+
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// checkRunnable returns an error if the executable, built for the system
+// goos, can't be run here.  An executable for Windows or macOS can be read,
+// but only run by a server on that system.
+func checkRunnable(executable, goos string) error {
+	switch goos {
+	case "windows":
+		return fmt.Errorf("%s: can't run a Windows executable on Linux", executable)
+	case "darwin":
+		return fmt.Errorf("%s: can't run a macOS executable on Linux", executable)
+	}
+	return nil
+}
+
+// kill sends sig to process pid.
+func kill(pid int, sig syscall.Signal) error {
+	return syscall.Kill(pid, sig)
+}
+
+// tgkill sends sig to thread tid of process pid.
+func tgkill(pid, tid int, sig syscall.Signal) error {
+	return syscall.Tgkill(pid, tid, sig)
+}
+
+// threadIDs returns the IDs of the threads of process pid.
+func threadIDs(pid int) ([]int, error) {
+	infos, err := ioutil.ReadDir("/proc/" + strconv.Itoa(pid) + "/task")
+	if err != nil {
+		return nil, err
+	}
+	tids := make([]int, 0, len(infos))
+	for _, info := range infos {
+		if tid, err := strconv.Atoi(info.Name()); err == nil {
+			tids = append(tids, tid)
+		}
+	}
+	return tids, nil
+}
+
+// threadExited reports whether thread tid of process pid has exited, and is
+// waiting to be waited for.
+func threadExited(pid, tid int) bool {
+	stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/task/%d/stat", pid, tid))
+	if err != nil {
+		// The thread has gone.
+		return false
+	}
+	// The state follows the command name, which is in parentheses.
+	i := bytes.LastIndexByte(stat, ')')
+	return i >= 0 && i+2 < len(stat) && stat[i+2] == 'Z'
+}
+
+// atEntry is the auxiliary vector entry holding the program's entry point.
+const atEntry = 9
+
+// processEntry returns the entry point of the newly started process, from
+// its auxiliary vector.
+func (s *Server) processEntry() (uint64, error) {
+	auxv, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/auxv", s.proc.Pid))
+	if err != nil {
+		return 0, err
+	}
+	ps := s.arch.PointerSize
+	for i := 0; i+2*ps <= len(auxv); i += 2 * ps {
+		tag, val := s.arch.Uintptr(auxv[i:i+ps]), s.arch.Uintptr(auxv[i+ps:i+2*ps])
+		if tag == atEntry {
+			return val, nil
+		}
+	}
+	return 0, fmt.Errorf("no entry point in auxiliary vector")
+}
+
+// memoryRegions returns the mappings of process pid's memory, in order of
+// address, from /proc/pid/maps.
+func memoryRegions(pid int) ([]memoryRegion, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/maps", pid))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var regions []memoryRegion
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Lines look like
+		//	7f0c1a2b3000-7f0c1a2d5000 r--p 00000000 08:01 1234 /lib/x86_64-linux-gnu/libc.so.6
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		bounds := strings.SplitN(fields[0], "-", 2)
+		if len(bounds) != 2 {
+			continue
+		}
+		start, err1 := strconv.ParseUint(bounds[0], 16, 64)
+		end, err2 := strconv.ParseUint(bounds[1], 16, 64)
+		offset, err3 := strconv.ParseUint(fields[2], 16, 64)
+		if err1 != nil || err2 != nil || err3 != nil {
+			continue
+		}
+		r := memoryRegion{
+			start:    start,
+			end:      end,
+			readable: strings.HasPrefix(fields[1], "r"),
+			offset:   offset,
+		}
+		if len(fields) >= 6 {
+			r.path = fields[5]
+		}
+		regions = append(regions, r)
+	}
+	return regions, scanner.Err()
+}
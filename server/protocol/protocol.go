@@ -22,6 +22,9 @@ func init() {
 	gob.Register(debug.Channel{})
 	gob.Register(debug.Func{})
 	gob.Register(debug.Interface{})
+	gob.Register(debug.Mutex{})
+	gob.Register(debug.RWMutex{})
+	gob.Register(debug.WaitGroup{})
 }
 
 // For regularity, each method has a unique Request and a Response type even
@@ -39,6 +42,91 @@ type ReadAtResponse struct {
 	Data []byte
 }
 
+type SetKillOnExitRequest struct {
+	Kill bool
+}
+
+type SetKillOnExitResponse struct{}
+
+type SetDeterministicRequest struct {
+	Deterministic bool
+}
+
+type SetDeterministicResponse struct{}
+
+type SetShowTemporariesRequest struct {
+	Show bool
+}
+
+type SetShowTemporariesResponse struct{}
+
+type SetSignalPolicyRequest struct {
+	Signal string
+	Policy debug.SignalPolicy
+}
+
+type SetSignalPolicyResponse struct{}
+
+type SetPanicStopsRequest struct {
+	Functions []string
+}
+
+type SetPanicStopsResponse struct{}
+
+type SetThreadStopsRequest struct {
+	Stop bool
+}
+
+type SetThreadStopsResponse struct{}
+
+type DetachRequest struct{}
+
+type DetachResponse struct{}
+
+type ShutdownRequest struct {
+	Kill bool
+}
+
+type ShutdownResponse struct{}
+
+// Version is the version of the protocol.  It increases when the methods or
+// types in this package change in a way a client or server built with an
+// earlier version can't decode.  Methods that are added don't change it; a
+// client finds out about those from the server's features.
+const Version = 1
+
+// HandshakeRequest is the first call a client makes, to check the server
+// speaks its version of the protocol.
+type HandshakeRequest struct {
+	Version int
+	// Observer is set by the server for calls from a client it serves as
+	// an observer.
+	Observer bool
+}
+
+type HandshakeResponse struct {
+	Version  int
+	Observer bool   // Whether the client can only make calls which observe the process.
+	Session  string // The server's session ID, for reconnecting to it.
+	// Features are the names of the server's methods, such as "Batch", so
+	// that a client can avoid calling methods an older server lacks.
+	Features []string
+}
+
+type PingRequest struct{}
+
+type PingResponse struct{}
+
+type ReadOutputRequest struct {
+	FD  int // 1 for standard output, 2 for standard error.
+	Len int
+}
+
+type ReadOutputResponse struct {
+	Data []byte
+	EOF  bool
+}
+
 type WriteAtRequest struct {
 	FD     int
 	Data   []byte
@@ -69,12 +157,28 @@ type OpenResponse struct {
 
 type RunRequest struct {
 	Args []string
+	Dir  string // The process's working directory; if empty, the server's.
 }
 
 type RunResponse struct {
 	Status debug.Status
 }
 
+type KillRequest struct {
+}
+
+type KillResponse struct {
+	Status debug.Status
+}
+
+type RestartRequest struct {
+	KeepBreakpoints bool
+}
+
+type RestartResponse struct {
+	Status debug.Status
+}
+
 type ResumeRequest struct {
 }
 
@@ -82,12 +186,28 @@ type ResumeResponse struct {
 	Status debug.Status
 }
 
+type StepInstructionRequest struct{}
+
+type StepInstructionResponse struct {
+	Status debug.Status
+}
+
+type RunToLineRequest struct {
+	File string
+	Line uint64
+}
+
+type RunToLineResponse struct {
+	Status debug.Status
+}
+
 type BreakpointRequest struct {
 	Address uint64
 }
 
 type BreakpointAtFunctionRequest struct {
 	Function string
+	Pending  bool // Whether to keep the breakpoint, pending, if Function isn't found.
 }
 
 type BreakpointAtLineRequest struct {
@@ -95,19 +215,203 @@ type BreakpointAtLineRequest struct {
 	Line uint64
 }
 
+type BreakpointAtPackageInitRequest struct {
+	Package string
+}
+
+type BreakpointAtCgoCallsRequest struct{}
+
 type BreakpointResponse struct {
-	PCs []uint64
+	Breakpoint debug.Breakpoint
 }
 
 type DeleteBreakpointsRequest struct {
-	PCs []uint64
+	IDs []uint64
 }
 
 type DeleteBreakpointsResponse struct {
 }
 
+type EnableBreakpointRequest struct {
+	ID      uint64
+	Enabled bool
+}
+
+type EnableBreakpointResponse struct {
+}
+
+type SetBreakpointCallerRequest struct {
+	ID       uint64
+	Function string
+}
+
+type SetBreakpointCallerResponse struct {
+}
+
+type SetBreakpointGroupRequest struct {
+	ID    uint64
+	Group string
+}
+
+type SetBreakpointGroupResponse struct {
+}
+
+type SetBreakpointOneShotRequest struct {
+	ID      uint64
+	OneShot bool
+}
+
+type SetBreakpointOneShotResponse struct {
+}
+
+type SetBreakpointRecordRequest struct {
+	ID     uint64
+	Record bool
+	Exprs  []string
+}
+
+type SetBreakpointRecordResponse struct {
+}
+
+type SnapshotsRequest struct {
+}
+
+type SnapshotsResponse struct {
+	Snapshots []debug.Snapshot
+}
+
+type SetBreakpointTraceRequest struct {
+	ID    uint64
+	Trace bool
+	Exprs []string
+}
+
+type SetBreakpointTraceResponse struct {
+}
+
+type TraceEventsRequest struct {
+}
+
+type TraceEventsResponse struct {
+	Events []debug.TraceEvent
+}
+
+type SetBreakpointCommandsRequest struct {
+	ID       uint64
+	Commands []string
+}
+
+type SetBreakpointCommandsResponse struct {
+}
+
+type CheckpointRequest struct {
+}
+
+type CheckpointResponse struct {
+	ID uint64
+}
+
+type RestoreRequest struct {
+	ID uint64
+}
+
+type RestoreResponse struct {
+	Status debug.Status
+}
+
+type DeleteCheckpointRequest struct {
+	ID uint64
+}
+
+type DeleteCheckpointResponse struct {
+}
+
+type SetRecordingRequest struct {
+	Enabled bool
+}
+
+type SetRecordingResponse struct {
+}
+
+type ReverseToPreviousBreakRequest struct {
+}
+
+type ReverseToPreviousBreakResponse struct {
+	Status debug.Status
+}
+
+type ReverseToPreviousStopRequest struct {
+}
+
+type ReverseToPreviousStopResponse struct {
+	Status debug.Status
+}
+
+type TraceRequest struct {
+	Regexp string
+}
+
+type TraceResponse struct {
+	Functions []string
+}
+
+type EnableBreakpointGroupRequest struct {
+	Group   string
+	Enabled bool
+}
+
+type EnableBreakpointGroupResponse struct {
+}
+
+type DeleteBreakpointGroupRequest struct {
+	Group string
+}
+
+type DeleteBreakpointGroupResponse struct {
+}
+
+type ListBreakpointsRequest struct {
+}
+
+type ListBreakpointsResponse struct {
+	Breakpoints []debug.Breakpoint
+}
+
+type WatchGlobalRequest struct {
+	Name string
+}
+
+type WatchGlobalResponse struct {
+	Watchpoint debug.Watchpoint
+}
+
+type WatchMapRequest struct {
+	Map       debug.Map
+	Threshold uint64
+}
+
+type WatchMapResponse struct {
+	Watchpoint debug.Watchpoint
+}
+
+type DeleteWatchpointsRequest struct {
+	IDs []uint64
+}
+
+type DeleteWatchpointsResponse struct {
+}
+
+type FindStringRequest struct {
+	Substring string
+}
+
+type FindStringResponse struct {
+	Matches []debug.StringMatch
+}
+
 type EvalRequest struct {
-	Expr string
+	Expr   string
+	Format debug.FormatOptions
 }
 
 type EvalResponse struct {
@@ -120,6 +424,57 @@ type EvaluateRequest struct {
 
 type EvaluateResponse struct {
 	Result debug.Value
+	Type   debug.Type
+	Err    *debug.ExpressionError // Set instead of Result if the expression can't be evaluated.
+}
+
+type SampleRequest struct {
+	Expressions []string
+}
+
+type SampleResponse struct {
+	Samples []debug.Sample
+}
+
+type BatchRequest struct {
+	Calls []debug.BatchCall
+}
+
+type BatchResponse struct {
+	Results []debug.BatchResult
+}
+
+type InterruptRequest struct{}
+
+type InterruptResponse struct{}
+
+type ResumeAsyncRequest struct{}
+
+type ResumeAsyncResponse struct{}
+
+type NextEventRequest struct {
+	// Client identifies the connection whose events are wanted.  The
+	// server sets it for calls it receives from ServeConn.
+	Client uint64
+}
+
+type NextEventResponse struct {
+	Event debug.Event
+}
+
+type BinaryInfoRequest struct{}
+
+type BinaryInfoResponse struct {
+	Info debug.BinaryInfo
+}
+
+type HistoryRequest struct {
+	Expr string
+	N    int
+}
+
+type HistoryResponse struct {
+	Entries []debug.HistoryEntry
 }
 
 type FramesRequest struct {
@@ -130,6 +485,38 @@ type FramesResponse struct {
 	Frames []debug.Frame
 }
 
+type SelectFrameRequest struct {
+	Frame int
+}
+
+type SelectFrameResponse struct{}
+
+type ThreadsRequest struct{}
+
+type ThreadsResponse struct {
+	Threads []debug.Thread
+}
+
+type SelectThreadRequest struct {
+	Thread int
+}
+
+type SelectThreadResponse struct{}
+
+type SharedObjectsRequest struct{}
+
+type SharedObjectsResponse struct {
+	Objects []debug.SharedObject
+}
+
+type LocalVariablesRequest struct {
+	FrameIndex int
+}
+
+type LocalVariablesResponse struct {
+	Vars []debug.LocalVar
+}
+
 type VarByNameRequest struct {
 	Name string
 }
@@ -138,12 +525,79 @@ type VarByNameResponse struct {
 	Var debug.Var
 }
 
+type FunctionsRequest struct {
+	Regexp string
+}
+
+type FunctionsResponse struct {
+	Names []string
+}
+
+type SourcesRequest struct {
+}
+
+type SourcesResponse struct {
+	Files []string
+}
+
+type SourceRequest struct {
+	File      string
+	StartLine uint64
+	EndLine   uint64
+}
+
+type SourceResponse struct {
+	Source debug.Source
+}
+
+type TypesRequest struct {
+	Regexp string
+}
+
+type TypesResponse struct {
+	Names []string
+}
+
+type TypeRequest struct {
+	TypeID uint64
+}
+
+type TypeResponse struct {
+	Info debug.TypeInfo
+}
+
+type DebugManifestRequest struct {
+}
+
+type DebugManifestResponse struct {
+	Manifest debug.DebugManifest
+}
+
+type AsPointerRequest struct {
+	Value    debug.Value
+	TypeName string
+}
+
+type AsPointerResponse struct {
+	Var debug.Var
+}
+
 type ValueRequest struct {
 	Var debug.Var
 }
 
 type ValueResponse struct {
 	Value debug.Value
+	Freed *debug.ObjectFreed // Set instead of Value if the variable's object was freed.
+}
+
+type ValueTreeRequest struct {
+	Var   debug.Var
+	Depth int
+}
+
+type ValueTreeResponse struct {
+	Tree debug.ValueTree
 }
 
 type MapElementRequest struct {
@@ -156,9 +610,92 @@ type MapElementResponse struct {
 	Value debug.Var
 }
 
+type MapElementsRequest struct {
+	Map   debug.Map
+	Start uint64
+	Count uint64
+}
+
+type MapElementsResponse struct {
+	Entries []debug.MapEntry
+}
+
+type ChannelWaitersRequest struct {
+	Channel debug.Channel
+}
+
+type ChannelWaitersResponse struct {
+	Waiters []debug.ChannelWaiter
+}
+
 type GoroutinesRequest struct {
 }
 
 type GoroutinesResponse struct {
 	Goroutines []*debug.Goroutine
 }
+
+type PanicInfoRequest struct {
+}
+
+type PanicInfoResponse struct {
+	Info debug.PanicInfo
+}
+
+type DeferredCallsRequest struct {
+	Goroutine  int64
+	FrameIndex int
+}
+
+type DeferredCallsResponse struct {
+	Calls []debug.DeferredCall
+}
+
+type HeapStatsRequest struct {
+}
+
+type HeapStatsResponse struct {
+	Stats debug.HeapStats
+}
+
+type HeapDumpRequest struct {
+}
+
+type HeapDumpResponse struct {
+	Objects []debug.HeapObject
+}
+
+type FindReferencesRequest struct {
+	Address uint64
+}
+
+type FindReferencesResponse struct {
+	References []debug.Reference
+}
+
+type RuntimeStatusRequest struct {
+}
+
+type RuntimeStatusResponse struct {
+	Status debug.RuntimeStatus
+}
+
+type ReadMemoryRequest struct {
+	Address uint64
+	Length  int
+}
+
+type ReadMemoryResponse struct {
+	Data []byte
+	Err  *debug.MemoryError // Set if not all of the memory could be read.
+}
+
+type WriteMemoryRequest struct {
+	Address uint64
+	Data    []byte
+}
+
+type WriteMemoryResponse struct {
+	Written int
+	Err     *debug.MemoryError // Set if not all of the memory could be written.
+}
@@ -8,8 +8,9 @@ import (
 	"fmt"
 	"os"
 	"runtime"
-	"syscall"
 	"time"
+
+	"golang.org/x/debug"
 )
 
 // ptraceRun runs all the closures from fc on a dedicated OS thread. Errors
@@ -25,10 +26,13 @@ func ptraceRun(fc chan func() error, ec chan error) {
 	}
 }
 
-func (s *Server) startProcess(name string, argv []string, attr *os.ProcAttr) (proc *os.Process, err error) {
+// startProcess starts the program name, traced, and stopped before it runs.
+// If killOnExit is set, the process is killed if the server's ptrace thread
+// exits.
+func (s *Server) startProcess(name string, argv []string, attr *os.ProcAttr, killOnExit bool) (proc *os.Process, err error) {
 	s.fc <- func() error {
 		var err1 error
-		proc, err1 = os.StartProcess(name, argv, attr)
+		proc, err1 = sysStartProcess(name, argv, attr, killOnExit)
 		return err1
 	}
 	err = <-s.ec
@@ -37,21 +41,66 @@ func (s *Server) startProcess(name string, argv []string, attr *os.ProcAttr) (pr
 
 func (s *Server) ptraceCont(pid int, signal int) (err error) {
 	s.fc <- func() error {
-		return syscall.PtraceCont(pid, signal)
+		return sysCont(pid, signal)
+	}
+	err = <-s.ec
+	logPtrace("cont", pid, err, debug.Field{Key: "signal", Value: signal})
+	return err
+}
+
+// ptraceDetach detaches from the thread pid, delivering signal to it if it
+// isn't zero.
+func (s *Server) ptraceDetach(pid int, signal int) (err error) {
+	s.fc <- func() error {
+		return sysDetach(pid, signal)
+	}
+	err = <-s.ec
+	logPtrace("detach", pid, err, debug.Field{Key: "signal", Value: signal})
+	return err
+}
+
+func (s *Server) ptraceGetRegs(pid int, regsout *ptraceRegs) (err error) {
+	s.fc <- func() error {
+		return sysGetRegs(pid, regsout)
+	}
+	err = <-s.ec
+	logPtrace("getregs", pid, err)
+	return err
+}
+
+// fpRegs holds a thread's floating-point registers, in the layout of
+// PTRACE_GETFPREGS on amd64, which is that of the FXSAVE instruction.
+type fpRegs [512]byte
+
+// xmm returns the low 8 bytes of register Xi.
+func (f *fpRegs) xmm(i int) []byte {
+	return f[160+16*i:][:8]
+}
+
+func (s *Server) ptraceGetFPRegs(pid int, regsout *fpRegs) (err error) {
+	s.fc <- func() error {
+		return sysGetFPRegs(pid, regsout)
 	}
-	return <-s.ec
+	err = <-s.ec
+	logPtrace("getfpregs", pid, err)
+	return err
 }
 
-func (s *Server) ptraceGetRegs(pid int, regsout *syscall.PtraceRegs) (err error) {
+func (s *Server) ptraceSetFPRegs(pid int, regs *fpRegs) (err error) {
 	s.fc <- func() error {
-		return syscall.PtraceGetRegs(pid, regsout)
+		return sysSetFPRegs(pid, regs)
 	}
-	return <-s.ec
+	err = <-s.ec
+	logPtrace("setfpregs", pid, err)
+	return err
 }
 
 func (s *Server) ptracePeek(pid int, addr uintptr, out []byte) (err error) {
+	if ok, err := s.composites.read(s.stops, uint64(addr), out); ok {
+		return err
+	}
 	s.fc <- func() error {
-		n, err := syscall.PtracePeekText(pid, addr, out)
+		n, err := sysPeek(pid, addr, out)
 		if err != nil {
 			return err
 		}
@@ -60,12 +109,14 @@ func (s *Server) ptracePeek(pid int, addr uintptr, out []byte) (err error) {
 		}
 		return nil
 	}
-	return <-s.ec
+	err = <-s.ec
+	logPtrace("peek", pid, err, debug.Field{Key: "addr", Value: addr}, debug.Field{Key: "len", Value: len(out)})
+	return err
 }
 
 func (s *Server) ptracePoke(pid int, addr uintptr, data []byte) (err error) {
 	s.fc <- func() error {
-		n, err := syscall.PtracePokeText(pid, addr, data)
+		n, err := sysPoke(pid, addr, data)
 		if err != nil {
 			return err
 		}
@@ -74,28 +125,99 @@ func (s *Server) ptracePoke(pid int, addr uintptr, data []byte) (err error) {
 		}
 		return nil
 	}
-	return <-s.ec
+	err = <-s.ec
+	logPtrace("poke", pid, err, debug.Field{Key: "addr", Value: addr}, debug.Field{Key: "len", Value: len(data)})
+	return err
+}
+
+// ptracePeekPartial is like ptracePeek, but if not all of out can be read, it
+// returns the number of bytes that were.
+func (s *Server) ptracePeekPartial(pid int, addr uintptr, out []byte) (n int, err error) {
+	if ok, err := s.composites.read(s.stops, uint64(addr), out); ok {
+		if err != nil {
+			return 0, err
+		}
+		return len(out), nil
+	}
+	s.fc <- func() error {
+		n, err = sysPeek(pid, addr, out)
+		return err
+	}
+	err = <-s.ec
+	logPtrace("peek", pid, err, debug.Field{Key: "addr", Value: addr}, debug.Field{Key: "len", Value: len(out)})
+	return n, err
+}
+
+// ptracePokePartial is like ptracePoke, but if not all of data can be written,
+// it returns the number of bytes that were.
+func (s *Server) ptracePokePartial(pid int, addr uintptr, data []byte) (n int, err error) {
+	s.fc <- func() error {
+		n, err = sysPoke(pid, addr, data)
+		return err
+	}
+	err = <-s.ec
+	logPtrace("poke", pid, err, debug.Field{Key: "addr", Value: addr}, debug.Field{Key: "len", Value: len(data)})
+	return n, err
+}
+
+func (s *Server) ptracePeekUser(pid int, offset uintptr) (data uint64, err error) {
+	s.fc <- func() error {
+		var err1 error
+		data, err1 = sysPeekUser(pid, offset)
+		return err1
+	}
+	err = <-s.ec
+	logPtrace("peekuser", pid, err, debug.Field{Key: "offset", Value: offset})
+	return
+}
+
+func (s *Server) ptracePokeUser(pid int, offset uintptr, data uint64) (err error) {
+	s.fc <- func() error {
+		return sysPokeUser(pid, offset, data)
+	}
+	err = <-s.ec
+	logPtrace("pokeuser", pid, err, debug.Field{Key: "offset", Value: offset}, debug.Field{Key: "data", Value: uintptr(data)})
+	return err
+}
+
+// ptraceGetEventMsg returns the message of the ptrace event thread pid
+// stopped for, such as the ID of a new process.
+func (s *Server) ptraceGetEventMsg(pid int) (msg uint, err error) {
+	s.fc <- func() error {
+		var err1 error
+		msg, err1 = sysGetEventMsg(pid)
+		return err1
+	}
+	err = <-s.ec
+	logPtrace("geteventmsg", pid, err, debug.Field{Key: "msg", Value: msg})
+	return msg, err
 }
 
 func (s *Server) ptraceSetOptions(pid int, options int) (err error) {
 	s.fc <- func() error {
-		return syscall.PtraceSetOptions(pid, options)
+		return sysSetOptions(pid, options)
 	}
-	return <-s.ec
+	err = <-s.ec
+	logPtrace("setoptions", pid, err, debug.Field{Key: "options", Value: uintptr(options)})
+	return err
 }
 
-func (s *Server) ptraceSetRegs(pid int, regs *syscall.PtraceRegs) (err error) {
+func (s *Server) ptraceSetRegs(pid int, regs *ptraceRegs) (err error) {
 	s.fc <- func() error {
-		return syscall.PtraceSetRegs(pid, regs)
+		return sysSetRegs(pid, regs)
 	}
-	return <-s.ec
+	err = <-s.ec
+	logPtrace("setregs", pid, err, debug.Field{Key: "pc", Value: uintptr(regs.Rip)})
+	return err
 }
 
 func (s *Server) ptraceSingleStep(pid int) (err error) {
 	s.fc <- func() error {
-		return syscall.PtraceSingleStep(pid)
+		return sysSingleStep(pid)
 	}
-	return <-s.ec
+	err = <-s.ec
+	logPtrace("singlestep", pid, err)
+	return err
 }
 
 type breakpointsChangedError struct {
@@ -106,13 +228,42 @@ func (*breakpointsChangedError) Error() string {
 	return "breakpoints changed"
 }
 
-func (s *Server) wait(pid int, allowBreakpointsChange bool) (wpid int, status syscall.WaitStatus, err error) {
-	// We poll syscall.Wait4 with WNOHANG, sleeping in between, as a poor man's
-	// waitpid-with-timeout. This allows adding and removing breakpoints
+// logPtrace logs a ptrace operation on thread pid, and its result.
+func logPtrace(op string, pid int, err error, fields ...debug.Field) {
+	fields = append([]debug.Field{{Key: "op", Value: op}, {Key: "pid", Value: pid}}, fields...)
+	if err != nil {
+		fields = append(fields, debug.Field{Key: "err", Value: err})
+	}
+	debug.Log(debug.LevelDebug, "ptrace", fields...)
+}
+
+// logWait logs a status change reported by wait.
+func logWait(wpid int, status waitStatus) {
+	debug.Log(debug.LevelDebug, "wait", debug.Field{Key: "pid", Value: wpid}, debug.Field{Key: "status", Value: uintptr(status)})
+}
+
+// waitNoHang reports a status change of pid, if one is available, without
+// blocking.  wpid is zero if there is none.
+func (s *Server) waitNoHang(pid int) (wpid int, status waitStatus, err error) {
+	s.fc <- func() error {
+		var err1 error
+		wpid, err1 = sysWait(pid, &status)
+		return err1
+	}
+	err = <-s.ec
+	if wpid > 0 {
+		logWait(wpid, status)
+	}
+	return
+}
+
+func (s *Server) wait(pid int, allowBreakpointsChange bool) (wpid int, status waitStatus, err error) {
+	// We poll sysWait, which doesn't block, sleeping in between, as a poor
+	// man's waitpid-with-timeout. This allows adding and removing breakpoints
 	// concurrently with waiting to hit an existing breakpoint.
 	f := func() error {
 		var err1 error
-		wpid, err1 = syscall.Wait4(pid, &status, syscall.WALL|syscall.WNOHANG, nil)
+		wpid, err1 = sysWait(pid, &status)
 		return err1
 	}
 
@@ -126,6 +277,9 @@ func (s *Server) wait(pid int, allowBreakpointsChange bool) (wpid int, status sy
 
 		// wpid == 0 means that wait found nothing (and returned due to WNOHANG).
 		if wpid != 0 {
+			if wpid > 0 {
+				logWait(wpid, status)
+			}
 			return
 		}
 
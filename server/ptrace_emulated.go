@@ -0,0 +1,549 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build darwin || windows
+
+// The ptrace methods for systems without Linux's ptrace, which are given its
+// model of the process by emulating it: each thread stops and is continued
+// on its own, by suspending and resuming it, and its stops, and the events
+// of the process, are reported by wait as Linux reports them.  The system's
+// own part is in tracee_$GOOS.go.
+
+package server
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"syscall"
+)
+
+// ptraceRegs holds the general registers of a thread, with the names Linux
+// gives them.  Orig_rax is always -1, since a thread isn't known to be in a
+// system call, and Fs_base and Gs_base are only set where the system makes
+// them known.
+type ptraceRegs struct {
+	R15      uint64
+	R14      uint64
+	R13      uint64
+	R12      uint64
+	Rbp      uint64
+	Rbx      uint64
+	R11      uint64
+	R10      uint64
+	R9       uint64
+	R8       uint64
+	Rax      uint64
+	Rcx      uint64
+	Rdx      uint64
+	Rsi      uint64
+	Rdi      uint64
+	Orig_rax uint64
+	Rip      uint64
+	Cs       uint64
+	Eflags   uint64
+	Rsp      uint64
+	Ss       uint64
+	Fs_base  uint64
+	Gs_base  uint64
+	Ds       uint64
+	Es       uint64
+	Fs       uint64
+	Gs       uint64
+}
+
+// waitStatus is a status change of a thread, reported by wait, encoded as
+// Linux encodes it, except that an exit status can be wider than a byte.
+type waitStatus uint64
+
+const (
+	// ptraceEventClone is the cause of the SIGTRAP stop of a thread that
+	// has just been started, if ptraceOTraceClone is set.
+	ptraceEventClone = 3
+
+	// ptraceOTraceClone is the option that reports the start of a thread
+	// with a SIGTRAP stop, before its first SIGSTOP stop.
+	ptraceOTraceClone = 0x8
+
+	// stopped marks a waitStatus of a stopped thread.
+	stopped = 0x7f
+
+	// trapFlag is the flag in EFLAGS that makes a thread single-step.
+	trapFlag = 0x100
+)
+
+func stoppedStatus(sig syscall.Signal) waitStatus {
+	return waitStatus(sig)<<8 | stopped
+}
+
+func exitedStatus(code uint32) waitStatus {
+	return waitStatus(code) << 8
+}
+
+func signaledStatus(sig syscall.Signal) waitStatus {
+	return waitStatus(sig)
+}
+
+func (w waitStatus) Exited() bool {
+	return w&0x7f == 0
+}
+
+func (w waitStatus) ExitStatus() int {
+	if !w.Exited() {
+		return -1
+	}
+	return int(uint32(w >> 8))
+}
+
+func (w waitStatus) Signaled() bool {
+	return w&0x7f != stopped && w&0x7f != 0
+}
+
+func (w waitStatus) Signal() syscall.Signal {
+	if !w.Signaled() {
+		return -1
+	}
+	return syscall.Signal(w & 0x7f)
+}
+
+func (w waitStatus) Stopped() bool {
+	return w&0xff == stopped
+}
+
+func (w waitStatus) StopSignal() syscall.Signal {
+	if !w.Stopped() {
+		return -1
+	}
+	return syscall.Signal(w>>8) & 0xff
+}
+
+func (w waitStatus) TrapCause() int {
+	if w.StopSignal() != syscall.SIGTRAP {
+		return -1
+	}
+	return int(w>>16) & 0xff
+}
+
+// A tracee is a process being debugged.
+type tracee struct {
+	pid     int
+	sys     traceeSys // The system's own handles on the process.
+	threads map[int]*thread
+	options int // As set by sysSetOptions.
+}
+
+// A thread is a thread of a tracee.  The thread that started the process has
+// the process's ID, as on Linux.
+type thread struct {
+	tid      int
+	sys      threadSys // The system's own handles on the thread.
+	stopped  bool      // Suspended by the debugger, and in a stop.
+	status   *waitStatus
+	pending  []waitStatus // The stops it makes as soon as it is continued.
+	gone     bool         // It has exited.
+	msg      uint         // The message of the event it stopped for.
+	stepping bool         // It is single-stepping.
+}
+
+var (
+	// traceMu guards the tracees, which are used both by the ptrace thread
+	// and by the goroutine that stops threads.
+	traceMu sync.Mutex
+	tracees = make(map[int]*tracee)
+)
+
+// findThread returns the tracee and thread with ID tid, or an ESRCH error.
+func findThread(tid int) (*tracee, *thread, error) {
+	for _, t := range tracees {
+		if th, ok := t.threads[tid]; ok && !th.gone {
+			return t, th, nil
+		}
+	}
+	return nil, nil, syscall.ESRCH
+}
+
+// stop puts th, which the system has just stopped, or the debugger has just
+// suspended, into a stop with status st.  A thread that was single-stepping
+// stops doing so.
+func (t *tracee) stop(th *thread, st waitStatus) error {
+	th.stopped = true
+	th.status = &st
+	if th.stepping {
+		th.stepping = false
+		var regs ptraceRegs
+		if err := th.getRegs(&regs); err != nil {
+			return err
+		}
+		regs.Eflags &^= trapFlag
+		return th.setRegs(&regs)
+	}
+	return nil
+}
+
+// threadStarted adds the new thread th, which is suspended, with the stop a
+// new thread makes on Linux, after the start being reported, if asked for.
+func (t *tracee) threadStarted(th *thread) {
+	t.threads[th.tid] = th
+	th.stopped = true
+	st := stoppedStatus(sigstop)
+	if t.options&ptraceOTraceClone != 0 {
+		th.msg = uint(th.tid)
+		th.pending = append(th.pending, st)
+		st = stoppedStatus(syscall.SIGTRAP) | ptraceEventClone<<16
+	}
+	th.status = &st
+}
+
+// threadExited records that th has exited with status st.  The thread that
+// started the process is only reported to have exited with the process.
+func (t *tracee) threadExited(th *thread, st waitStatus) {
+	th.gone = true
+	th.stopped = false
+	th.pending = nil
+	if th.tid != t.pid {
+		th.status = &st
+	}
+}
+
+// processExited records that the process has exited with status st, which
+// is reported for the thread that started it.
+func (t *tracee) processExited(st waitStatus) {
+	for tid, th := range t.threads {
+		if tid != t.pid {
+			delete(t.threads, tid)
+			continue
+		}
+		th.gone = true
+		th.stopped = false
+		th.pending = nil
+		th.status = &st
+	}
+}
+
+func sysStartProcess(name string, argv []string, attr *os.ProcAttr, killOnExit bool) (*os.Process, error) {
+	traceMu.Lock()
+	defer traceMu.Unlock()
+	p, sys, err := startTracee(name, argv, attr, killOnExit)
+	if err != nil {
+		return nil, err
+	}
+	tracees[p.Pid] = &tracee{pid: p.Pid, sys: sys, threads: make(map[int]*thread)}
+	return p, nil
+}
+
+func sysCont(pid int, signal int) error {
+	traceMu.Lock()
+	defer traceMu.Unlock()
+	t, th, err := findThread(pid)
+	if err != nil {
+		return err
+	}
+	return t.cont(th, syscall.Signal(signal))
+}
+
+// cont continues th, which must be stopped, delivering sig to it if it
+// isn't zero.
+func (t *tracee) cont(th *thread, sig syscall.Signal) error {
+	if !th.stopped {
+		return syscall.ESRCH
+	}
+	if sig != 0 {
+		t.deliver(th, sig)
+	}
+	th.status = nil
+	if len(th.pending) > 0 {
+		st := th.pending[0]
+		th.pending = th.pending[1:]
+		th.status = &st
+		return nil
+	}
+	th.stopped = false
+	return th.resume()
+}
+
+func sysDetach(pid int, signal int) error {
+	traceMu.Lock()
+	defer traceMu.Unlock()
+	t, th, err := findThread(pid)
+	if err != nil {
+		return err
+	}
+	if !th.stopped {
+		return syscall.ESRCH
+	}
+	if signal != 0 {
+		t.deliver(th, syscall.Signal(signal))
+	}
+	th.pending = nil
+	th.stopped = false
+	if err := th.resume(); err != nil {
+		return err
+	}
+	th.gone = true
+	for _, th := range t.threads {
+		if !th.gone {
+			return nil
+		}
+	}
+	// The last thread has been let go.
+	delete(tracees, t.pid)
+	return t.detach()
+}
+
+func sysGetRegs(pid int, regsout *ptraceRegs) error {
+	traceMu.Lock()
+	defer traceMu.Unlock()
+	_, th, err := findThread(pid)
+	if err != nil {
+		return err
+	}
+	return th.getRegs(regsout)
+}
+
+func sysSetRegs(pid int, regs *ptraceRegs) error {
+	traceMu.Lock()
+	defer traceMu.Unlock()
+	_, th, err := findThread(pid)
+	if err != nil {
+		return err
+	}
+	return th.setRegs(regs)
+}
+
+func sysGetFPRegs(pid int, regsout *fpRegs) error {
+	traceMu.Lock()
+	defer traceMu.Unlock()
+	_, th, err := findThread(pid)
+	if err != nil {
+		return err
+	}
+	return th.getFPRegs(regsout)
+}
+
+func sysSetFPRegs(pid int, regs *fpRegs) error {
+	traceMu.Lock()
+	defer traceMu.Unlock()
+	_, th, err := findThread(pid)
+	if err != nil {
+		return err
+	}
+	return th.setFPRegs(regs)
+}
+
+func sysPeek(pid int, addr uintptr, out []byte) (int, error) {
+	traceMu.Lock()
+	defer traceMu.Unlock()
+	t, _, err := findThread(pid)
+	if err != nil {
+		return 0, err
+	}
+	return t.read(addr, out)
+}
+
+func sysPoke(pid int, addr uintptr, data []byte) (int, error) {
+	traceMu.Lock()
+	defer traceMu.Unlock()
+	t, _, err := findThread(pid)
+	if err != nil {
+		return 0, err
+	}
+	return t.write(addr, data)
+}
+
+// debugRegNumber returns the number of the debug register at offset in Linux's
+// struct user, which is how the ptrace methods address them.
+func debugRegNumber(offset uintptr) (int, error) {
+	i := int(offset-debugRegOffset) / 8
+	if offset < debugRegOffset || offset%8 != 0 || i >= 8 || i == 4 || i == 5 {
+		return 0, fmt.Errorf("no debug register at offset %d", offset)
+	}
+	return i, nil
+}
+
+func sysPeekUser(pid int, offset uintptr) (uint64, error) {
+	traceMu.Lock()
+	defer traceMu.Unlock()
+	_, th, err := findThread(pid)
+	if err != nil {
+		return 0, err
+	}
+	i, err := debugRegNumber(offset)
+	if err != nil {
+		return 0, err
+	}
+	var regs [8]uint64
+	if err := th.getDebugRegs(&regs); err != nil {
+		return 0, err
+	}
+	return regs[i], nil
+}
+
+func sysPokeUser(pid int, offset uintptr, data uint64) error {
+	traceMu.Lock()
+	defer traceMu.Unlock()
+	_, th, err := findThread(pid)
+	if err != nil {
+		return err
+	}
+	i, err := debugRegNumber(offset)
+	if err != nil {
+		return err
+	}
+	var regs [8]uint64
+	if err := th.getDebugRegs(&regs); err != nil {
+		return err
+	}
+	regs[i] = data
+	return th.setDebugRegs(&regs)
+}
+
+func sysGetEventMsg(pid int) (uint, error) {
+	traceMu.Lock()
+	defer traceMu.Unlock()
+	_, th, err := findThread(pid)
+	if err != nil {
+		return 0, err
+	}
+	return th.msg, nil
+}
+
+func sysSetOptions(pid int, options int) error {
+	traceMu.Lock()
+	defer traceMu.Unlock()
+	t, _, err := findThread(pid)
+	if err != nil {
+		return err
+	}
+	t.options = options
+	return nil
+}
+
+func sysSingleStep(pid int) error {
+	traceMu.Lock()
+	defer traceMu.Unlock()
+	t, th, err := findThread(pid)
+	if err != nil {
+		return err
+	}
+	var regs ptraceRegs
+	if err := th.getRegs(&regs); err != nil {
+		return err
+	}
+	regs.Eflags |= trapFlag
+	if err := th.setRegs(&regs); err != nil {
+		return err
+	}
+	th.stepping = true
+	return t.cont(th, 0)
+}
+
+// sysWait reports a status change of thread pid, or of any thread if pid is
+// -1, without blocking.  It returns zero if there is none.
+func sysWait(pid int, status *waitStatus) (int, error) {
+	traceMu.Lock()
+	defer traceMu.Unlock()
+	if err := pollEvents(); err != nil {
+		return 0, err
+	}
+	found := false
+	for _, t := range tracees {
+		for tid, th := range t.threads {
+			if pid != -1 && tid != pid {
+				continue
+			}
+			found = true
+			if th.status == nil {
+				continue
+			}
+			*status = *th.status
+			th.status = nil
+			if th.gone {
+				delete(t.threads, tid)
+			}
+			if len(t.threads) == 0 {
+				delete(tracees, t.pid)
+				t.close()
+			}
+			return tid, nil
+		}
+	}
+	if !found {
+		return 0, syscall.ECHILD
+	}
+	return 0, nil
+}
+
+// kill sends sig, which must be SIGSTOP, to process pid, or rather to its
+// thread with the same ID, which is the one the server sends it to.
+func kill(pid int, sig syscall.Signal) error {
+	return tgkill(pid, pid, sig)
+}
+
+// tgkill sends sig, which must be SIGSTOP, to thread tid of process pid,
+// stopping it.  A thread that is already stopped stops again when it is
+// continued.
+func tgkill(pid, tid int, sig syscall.Signal) error {
+	if sig != sigstop {
+		return syscall.EINVAL
+	}
+	traceMu.Lock()
+	defer traceMu.Unlock()
+	t, th, err := findThread(tid)
+	if err != nil {
+		return err
+	}
+	if th.stopped {
+		th.pending = append(th.pending, stoppedStatus(sig))
+		return nil
+	}
+	if err := th.suspend(); err != nil {
+		return err
+	}
+	return t.stop(th, stoppedStatus(sig))
+}
+
+// threadIDs returns the IDs of the threads of process pid.
+func threadIDs(pid int) ([]int, error) {
+	traceMu.Lock()
+	defer traceMu.Unlock()
+	t, ok := tracees[pid]
+	if !ok {
+		return nil, syscall.ESRCH
+	}
+	if err := t.refresh(); err != nil {
+		return nil, err
+	}
+	tids := make([]int, 0, len(t.threads))
+	for tid := range t.threads {
+		tids = append(tids, tid)
+	}
+	sort.Ints(tids)
+	return tids, nil
+}
+
+// threadExited reports whether thread tid of process pid has exited, and is
+// waiting to be waited for.
+func threadExited(pid, tid int) bool {
+	traceMu.Lock()
+	defer traceMu.Unlock()
+	if t, ok := tracees[pid]; ok {
+		if th, ok := t.threads[tid]; ok {
+			return th.gone && th.status != nil
+		}
+	}
+	return false
+}
+
+// memoryRegions returns the mappings of process pid's memory, in order of
+// address.
+func memoryRegions(pid int) ([]memoryRegion, error) {
+	traceMu.Lock()
+	defer traceMu.Unlock()
+	t, ok := tracees[pid]
+	if !ok {
+		return nil, syscall.ESRCH
+	}
+	return t.regions()
+}
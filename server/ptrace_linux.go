@@ -0,0 +1,125 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// The system calls behind the ptrace methods, which on Linux are ptrace's own.
+// They are made on the server's ptrace thread.
+
+package server
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// ptraceRegs holds the general registers of a thread.
+type ptraceRegs = syscall.PtraceRegs
+
+// waitStatus is a status change of a thread, reported by wait.
+type waitStatus = syscall.WaitStatus
+
+const (
+	// ptraceEventClone is the cause of the SIGTRAP stop of a thread that
+	// has started another.
+	ptraceEventClone = syscall.PTRACE_EVENT_CLONE
+
+	// ptraceOTraceClone is the option that traces the threads a thread
+	// starts.
+	ptraceOTraceClone = syscall.PTRACE_O_TRACECLONE
+)
+
+func sysStartProcess(name string, argv []string, attr *os.ProcAttr, killOnExit bool) (*os.Process, error) {
+	// The death signal is sent when the thread that started the process
+	// exits.
+	var deathsig syscall.Signal
+	if killOnExit {
+		deathsig = syscall.SIGKILL
+	}
+	attr.Sys = &syscall.SysProcAttr{
+		Pdeathsig: deathsig,
+		Ptrace:    true,
+	}
+	return os.StartProcess(name, argv, attr)
+}
+
+func sysCont(pid int, signal int) error {
+	return syscall.PtraceCont(pid, signal)
+}
+
+func sysDetach(pid int, signal int) error {
+	_, _, errno := syscall.Syscall6(syscall.SYS_PTRACE, syscall.PTRACE_DETACH, uintptr(pid), 0, uintptr(signal), 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func sysGetRegs(pid int, regsout *ptraceRegs) error {
+	return syscall.PtraceGetRegs(pid, regsout)
+}
+
+func sysSetRegs(pid int, regs *ptraceRegs) error {
+	return syscall.PtraceSetRegs(pid, regs)
+}
+
+func sysGetFPRegs(pid int, regsout *fpRegs) error {
+	_, _, errno := syscall.Syscall6(syscall.SYS_PTRACE, syscall.PTRACE_GETFPREGS, uintptr(pid), 0, uintptr(unsafe.Pointer(regsout)), 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func sysSetFPRegs(pid int, regs *fpRegs) error {
+	_, _, errno := syscall.Syscall6(syscall.SYS_PTRACE, syscall.PTRACE_SETFPREGS, uintptr(pid), 0, uintptr(unsafe.Pointer(regs)), 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func sysPeek(pid int, addr uintptr, out []byte) (int, error) {
+	return syscall.PtracePeekText(pid, addr, out)
+}
+
+func sysPoke(pid int, addr uintptr, data []byte) (int, error) {
+	return syscall.PtracePokeText(pid, addr, data)
+}
+
+func sysPeekUser(pid int, offset uintptr) (uint64, error) {
+	// The raw PTRACE_PEEKUSR system call stores the word at the address
+	// passed as its data argument.
+	var data uint64
+	_, _, errno := syscall.Syscall6(syscall.SYS_PTRACE, syscall.PTRACE_PEEKUSR, uintptr(pid), offset, uintptr(unsafe.Pointer(&data)), 0, 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return data, nil
+}
+
+func sysPokeUser(pid int, offset uintptr, data uint64) error {
+	_, _, errno := syscall.Syscall6(syscall.SYS_PTRACE, syscall.PTRACE_POKEUSR, uintptr(pid), offset, uintptr(data), 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func sysGetEventMsg(pid int) (uint, error) {
+	return syscall.PtraceGetEventMsg(pid)
+}
+
+func sysSetOptions(pid int, options int) error {
+	return syscall.PtraceSetOptions(pid, options)
+}
+
+func sysSingleStep(pid int) error {
+	return syscall.PtraceSingleStep(pid)
+}
+
+// sysWait reports a status change of thread pid, or of any thread if pid is
+// -1, without blocking.  It returns zero if there is none.
+func sysWait(pid int, status *waitStatus) (int, error) {
+	return syscall.Wait4(pid, status, syscall.WALL|syscall.WNOHANG, nil)
+}
@@ -0,0 +1,46 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// The order in which the server serves requests.
+
+package server
+
+// The server serves one request at a time, and every request that touches
+// the process goes through the ptrace thread, so a frontend reading a lot of
+// data, such as expanding a large value tree, can hold up the requests a user
+// is waiting on.  Requests therefore arrive on one of three channels, in
+// decreasing order of priority:
+//
+//	breakpointc: breakpoint changes and Interrupt, which Resume also serves
+//	             while the process runs;
+//	controlc:    requests that run, stop, step or kill the process, or change
+//	             its watchpoints;
+//	otherc:      everything else, which is mostly reading data.
+//
+// Before each request, next serves any waiting request of a higher priority
+// first, so bulk reads are let through only one at a time while nothing more
+// urgent is waiting.
+
+// next waits for the next request to serve, preferring breakpoint changes,
+// then control requests, to other requests.
+func (s *Server) next() call {
+	select {
+	case c := <-s.breakpointc:
+		return c
+	default:
+	}
+	select {
+	case c := <-s.controlc:
+		return c
+	default:
+	}
+	select {
+	case c := <-s.breakpointc:
+		return c
+	case c := <-s.controlc:
+		return c
+	case c := <-s.otherc:
+		return c
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import "testing"
+
+func TestNextPriority(t *testing.T) {
+	// The channels are buffered, so that requests can be waiting on each
+	// of them at once.
+	s := &Server{
+		breakpointc: make(chan call, 10),
+		controlc:    make(chan call, 10),
+		otherc:      make(chan call, 10),
+	}
+	send := func(c chan call, name string) {
+		c <- call{req: name}
+	}
+	expect := func(want ...string) {
+		t.Helper()
+		for _, w := range want {
+			if got := s.next().req; got != w {
+				t.Fatalf("next served %v, want %s", got, w)
+			}
+		}
+	}
+
+	send(s.otherc, "read 1")
+	send(s.otherc, "read 2")
+	send(s.controlc, "resume")
+	send(s.breakpointc, "breakpoint")
+	expect("breakpoint", "resume", "read 1")
+
+	// A control request arriving behind waiting reads goes before them.
+	send(s.otherc, "read 3")
+	send(s.controlc, "step")
+	expect("step", "read 2")
+	send(s.breakpointc, "interrupt")
+	send(s.controlc, "kill")
+	expect("interrupt", "kill", "read 3")
+}
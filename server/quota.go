@@ -0,0 +1,143 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Limiting the resources a client can use through the server.
+
+package server
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Quotas limit the resources that a client can use through a Server, so that
+// one careless client can't exhaust a debugging agent shared with others.
+// A zero field means no limit.
+type Quotas struct {
+	// CacheBytes limits the memory used by data the server keeps for the
+	// client: the output of the process that hasn't been read yet, and the
+	// recorded values of expressions.  When the buffered output reaches the
+	// limit, the process waits to write more until the client reads some.
+	// Without a limit, only the last 4MB of each output stream is kept
+	// unread, and the client reads a note of how much was dropped in place
+	// of the rest.
+	CacheBytes int64
+
+	// ReadBytesPerMinute limits how many bytes of the process's memory the
+	// client's requests can read in each minute.
+	ReadBytesPerMinute int64
+
+	// Breakpoints limits the number of breakpoints the client can have set.
+	Breakpoints int
+}
+
+// QuotaError is the error returned for a request that would take the client
+// past one of the server's quotas.
+type QuotaError struct {
+	Quota string // What is limited, such as "breakpoints".
+	Limit int64
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("quota exceeded: at most %d %s", e.Limit, e.Quota)
+}
+
+// SetQuotas sets the limits on the resources the client can use.  It must be
+// called before the server is given any requests.
+func (s *Server) SetQuotas(q Quotas) {
+	s.quotas = q
+	s.cache.setLimit(q.CacheBytes)
+}
+
+// historyEntryBytes is roughly the most memory a recorded value takes, given
+// that strings are read only up to their first 256 bytes.
+const historyEntryBytes = 512
+
+// chargeRead accounts for a read of n bytes of the process's memory on behalf
+// of the client, failing if it would exceed the quota for the current minute.
+func (s *Server) chargeRead(n int) error {
+	limit := s.quotas.ReadBytesPerMinute
+	if limit == 0 {
+		return nil
+	}
+	if now := time.Now(); now.Sub(s.readsSince) >= time.Minute {
+		s.readsSince = now
+		s.readBytes = 0
+	}
+	if s.readBytes+int64(n) > limit {
+		return &QuotaError{Quota: "bytes read from memory per minute", Limit: limit}
+	}
+	s.readBytes += int64(n)
+	return nil
+}
+
+// checkBreakpointQuota fails if the client can't set another breakpoint.
+func (s *Server) checkBreakpointQuota() error {
+	if limit := s.quotas.Breakpoints; limit > 0 && len(s.userBreakpoints) >= limit {
+		return &QuotaError{Quota: "breakpoints", Limit: int64(limit)}
+	}
+	return nil
+}
+
+// cacheQuota accounts for the memory used by the data the server keeps for
+// the client.  Its methods are safe for concurrent use, since the process's
+// output is buffered outside the server's request loop.
+type cacheQuota struct {
+	mu    sync.Mutex
+	cond  sync.Cond // Signaled when memory is released.
+	limit int64     // Zero for no limit.
+	used  int64
+}
+
+func newCacheQuota() *cacheQuota {
+	q := &cacheQuota{}
+	q.cond.L = &q.mu
+	return q
+}
+
+func (q *cacheQuota) setLimit(limit int64) {
+	q.mu.Lock()
+	q.limit = limit
+	q.cond.Broadcast()
+	q.mu.Unlock()
+}
+
+// reserve accounts for n more bytes, failing if they would exceed the limit.
+func (q *cacheQuota) reserve(n int64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.limit > 0 && n > 0 && q.used+n > q.limit {
+		return &QuotaError{Quota: "bytes of cached data", Limit: q.limit}
+	}
+	q.used += n
+	return nil
+}
+
+// wait accounts for n more bytes, first waiting until they are within the
+// limit.  If n alone exceeds the limit, it waits until nothing else is
+// accounted for.
+func (q *cacheQuota) wait(n int64) {
+	q.mu.Lock()
+	for q.limit > 0 && q.used > 0 && q.used+n > q.limit {
+		q.cond.Wait()
+	}
+	q.used += n
+	q.mu.Unlock()
+}
+
+// limited reports whether there is a limit on the memory used.
+func (q *cacheQuota) limited() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.limit > 0
+}
+
+// release accounts for n bytes being freed.
+func (q *cacheQuota) release(n int64) {
+	q.mu.Lock()
+	q.used -= n
+	q.cond.Broadcast()
+	q.mu.Unlock()
+}
@@ -0,0 +1,123 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/debug"
+)
+
+func TestChargeRead(t *testing.T) {
+	s := &Server{quotas: Quotas{ReadBytesPerMinute: 100}}
+	tests := []struct {
+		n  int
+		ok bool
+	}{
+		{60, true},
+		{50, false},
+		{40, true},
+		{1, false},
+	}
+	for _, tt := range tests {
+		err := s.chargeRead(tt.n)
+		if tt.ok && err != nil {
+			t.Errorf("chargeRead(%d) after %d bytes: %v", tt.n, s.readBytes, err)
+		}
+		if _, ok := err.(*QuotaError); !tt.ok && !ok {
+			t.Errorf("chargeRead(%d) after %d bytes: got error %v, want a *QuotaError", tt.n, s.readBytes, err)
+		}
+	}
+	// The quota is renewed each minute.
+	s.readsSince = s.readsSince.Add(-time.Minute)
+	if err := s.chargeRead(100); err != nil {
+		t.Errorf("chargeRead(100) a minute later: %v", err)
+	}
+
+	s = &Server{}
+	if err := s.chargeRead(1 << 30); err != nil {
+		t.Errorf("chargeRead with no quota: %v", err)
+	}
+}
+
+func TestBreakpointQuota(t *testing.T) {
+	s := &Server{userBreakpoints: make(map[uint64]*debug.Breakpoint), cache: newCacheQuota()}
+	s.SetQuotas(Quotas{Breakpoints: 2})
+	for id := uint64(1); id <= 2; id++ {
+		if err := s.checkBreakpointQuota(); err != nil {
+			t.Fatalf("with %d breakpoints: %v", len(s.userBreakpoints), err)
+		}
+		s.userBreakpoints[id] = &debug.Breakpoint{ID: id}
+	}
+	want := "quota exceeded: at most 2 breakpoints"
+	if err := s.checkBreakpointQuota(); err == nil || err.Error() != want {
+		t.Errorf("with 2 breakpoints: got error %v, want %q", err, want)
+	}
+	delete(s.userBreakpoints, 1)
+	if err := s.checkBreakpointQuota(); err != nil {
+		t.Errorf("after deleting a breakpoint: %v", err)
+	}
+}
+
+func TestCacheQuota(t *testing.T) {
+	q := newCacheQuota()
+	q.setLimit(100)
+	if err := q.reserve(80); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.reserve(30); err == nil {
+		t.Error("reserving past the limit succeeded")
+	}
+
+	// wait blocks until there is room.
+	done := make(chan bool)
+	go func() {
+		q.wait(30)
+		done <- true
+	}()
+	select {
+	case <-done:
+		t.Fatal("wait didn't wait for room")
+	case <-time.After(50 * time.Millisecond):
+	}
+	q.release(50)
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("wait didn't return after room was made")
+	}
+
+	// More than the limit waits until nothing else is accounted for.
+	go func() {
+		q.wait(500)
+		done <- true
+	}()
+	q.release(60)
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("wait for more than the limit didn't return once the rest was released")
+	}
+	if q.used != 500 {
+		t.Errorf("got %d bytes used, want 500", q.used)
+	}
+
+	// Removing the limit wakes waiters.
+	go func() {
+		q.wait(1)
+		done <- true
+	}()
+	time.Sleep(10 * time.Millisecond)
+	q.setLimit(0)
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("wait didn't return after the limit was removed")
+	}
+	if q.limited() {
+		t.Error("limited() with no limit")
+	}
+}
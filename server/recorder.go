@@ -0,0 +1,108 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Breakpoints that record a snapshot of the program and let it carry on.
+
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/server/protocol"
+)
+
+const (
+	maxSnapshots      = 256 // Snapshots kept until the client fetches them.
+	maxSnapshotFrames = 32  // Stack frames recorded in each snapshot.
+)
+
+func (s *Server) SetBreakpointRecord(req *protocol.SetBreakpointRecordRequest, resp *protocol.SetBreakpointRecordResponse) error {
+	return s.call(s.breakpointc, req, resp)
+}
+
+func (s *Server) handleSetBreakpointRecord(req *protocol.SetBreakpointRecordRequest, resp *protocol.SetBreakpointRecordResponse) error {
+	bp, ok := s.userBreakpoints[req.ID]
+	if !ok {
+		return fmt.Errorf("no breakpoint with ID %d", req.ID)
+	}
+	bp.Record = req.Record
+	bp.RecordExprs = nil
+	if req.Record {
+		bp.RecordExprs = append([]string(nil), req.Exprs...)
+	}
+	return nil
+}
+
+// Snapshots is served like the breakpoint requests, so that snapshots can be
+// collected while the program runs.
+func (s *Server) Snapshots(req *protocol.SnapshotsRequest, resp *protocol.SnapshotsResponse) error {
+	return s.call(s.breakpointc, req, resp)
+}
+
+func (s *Server) handleSnapshots(req *protocol.SnapshotsRequest, resp *protocol.SnapshotsResponse) error {
+	resp.Snapshots = s.snapshots
+	for len(s.snapshots) > 0 {
+		s.dropOldestSnapshot()
+	}
+	s.snapshots = nil
+	return nil
+}
+
+// recordSnapshot records a snapshot for the breakpoint bp, which the
+// stopped thread has just reached.  Failures are recorded in the snapshot,
+// since the program carries on regardless.
+func (s *Server) recordSnapshot(bp *debug.Breakpoint) {
+	pc, sp := s.stoppedRegs.Rip, s.stoppedRegs.Rsp
+	snap := debug.Snapshot{
+		Breakpoint: bp.ID,
+		Time:       time.Now(),
+		Thread:     s.stoppedPid,
+		PC:         pc,
+	}
+	var err error
+	if s.topOfStackAddrs == nil {
+		err = s.evaluateTopOfStackAddrs()
+	}
+	if err == nil {
+		snap.Frames, err = s.walkStack(pc, sp, s.stoppedRegs.Rbp, maxSnapshotFrames)
+	}
+	if err != nil {
+		snap.FramesErr = err.Error()
+	}
+	for _, expr := range bp.RecordExprs {
+		v, t, err := s.snapshotExpression(expr, pc, sp)
+		sample := debug.Sample{Expression: expr, Value: v, Type: t}
+		if err != nil {
+			sample.Err = err.Error()
+		}
+		snap.Values = append(snap.Values, sample)
+	}
+	// The oldest snapshots make way for the new one, if the buffer is full
+	// or the client's cache quota is used up.
+	if len(s.snapshots) == maxSnapshots {
+		s.dropOldestSnapshot()
+	}
+	n := snapshotBytes(&snap)
+	for s.cache.reserve(n) != nil {
+		if len(s.snapshots) == 0 {
+			return
+		}
+		s.dropOldestSnapshot()
+	}
+	s.snapshots = append(s.snapshots, snap)
+}
+
+// dropOldestSnapshot removes the oldest snapshot, releasing its memory.
+func (s *Server) dropOldestSnapshot() {
+	s.cache.release(snapshotBytes(&s.snapshots[0]))
+	s.snapshots = s.snapshots[1:]
+}
+
+// snapshotBytes is roughly the most memory a snapshot takes, counting its
+// frames and values like the entries of a history.
+func snapshotBytes(snap *debug.Snapshot) int64 {
+	return int64(1+len(snap.Frames)+len(snap.Values)) * historyEntryBytes
+}
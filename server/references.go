@@ -0,0 +1,283 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Finding the pointers to an object in the program's globals, goroutine
+// stacks and heap, to show what keeps it alive.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/dwarf"
+	"golang.org/x/debug/elf"
+	"golang.org/x/debug/server/protocol"
+)
+
+// maxReferences limits how many references FindReferences returns.
+const maxReferences = 1000
+
+// referenceChunk is how much memory is read at a time when scanning for
+// references.
+const referenceChunk = 1 << 16
+
+func (s *Server) FindReferences(req *protocol.FindReferencesRequest, resp *protocol.FindReferencesResponse) error {
+	return s.call(s.otherc, req, resp)
+}
+
+func (s *Server) handleFindReferences(req *protocol.FindReferencesRequest, resp *protocol.FindReferencesResponse) error {
+	var objects []heapObject
+	err := s.heapObjects(nil, func(o debug.HeapObject, noscan bool) error {
+		objects = append(objects, heapObject{o, noscan})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Address < objects[j].Address })
+
+	// The target is the heap object holding the address, or else just the
+	// byte there.
+	r := &refScanner{s: s, lo: req.Address, hi: req.Address + 1}
+	i := sort.Search(len(objects), func(i int) bool { return objects[i].Address > req.Address }) - 1
+	if i >= 0 && req.Address < objects[i].Address+objects[i].Size {
+		r.lo, r.hi = objects[i].Address, objects[i].Address+objects[i].Size
+	}
+
+	if err := r.scanGlobals(); err != nil {
+		return err
+	}
+	if err := r.scanStacks(); err != nil {
+		return err
+	}
+	for _, o := range objects {
+		if o.noscan || r.full() {
+			continue
+		}
+		err := r.scan(o.Address, o.Address+o.Size, func(addr, ptr uint64) {
+			r.add(debug.Reference{Kind: "heap", Address: addr, Pointer: ptr, Object: o.HeapObject})
+		})
+		if err != nil {
+			return err
+		}
+	}
+	resp.References = r.refs
+	return nil
+}
+
+// heapObject is a live heap object, and whether it is known to hold no
+// pointers.
+type heapObject struct {
+	debug.HeapObject
+	noscan bool
+}
+
+// A refScanner looks for pointers into the target object [lo, hi).
+type refScanner struct {
+	s      *Server
+	lo, hi uint64
+	refs   []debug.Reference
+}
+
+func (r *refScanner) full() bool {
+	return len(r.refs) >= maxReferences
+}
+
+func (r *refScanner) add(ref debug.Reference) {
+	if !r.full() {
+		r.refs = append(r.refs, ref)
+	}
+}
+
+// scan reads the memory [lo, hi), and calls found with the address and
+// value of each aligned word in it that points into the target, except for
+// those in the target itself.
+func (r *refScanner) scan(lo, hi uint64, found func(addr, ptr uint64)) error {
+	ptrSize := uint64(r.s.arch.PointerSize)
+	lo = (lo + ptrSize - 1) &^ (ptrSize - 1)
+	buf := make([]byte, referenceChunk)
+	for a := lo; a+ptrSize <= hi && !r.full(); a += referenceChunk {
+		n := hi - a
+		if n > referenceChunk {
+			n = referenceChunk
+		}
+		n &^= ptrSize - 1
+		if err := r.s.peekBytes(a, buf[:n]); err != nil {
+			return fmt.Errorf("reading memory at %#x: %v", a, err)
+		}
+		for i := uint64(0); i < n; i += ptrSize {
+			ptr := r.s.arch.Uintptr(buf[i : i+ptrSize])
+			if ptr < r.lo || ptr >= r.hi || r.lo <= a+i && a+i < r.hi {
+				continue
+			}
+			found(a+i, ptr)
+		}
+	}
+	return nil
+}
+
+// scanGlobals scans the program's data and bss sections, which hold the
+// global variables that can contain pointers.
+func (r *refScanner) scanGlobals() error {
+	s := r.s
+	entry, err := s.dwarfData.LookupVariable("runtime.firstmoduledata")
+	if err != nil {
+		return err
+	}
+	addr, err := s.entryLocation(entry)
+	if err != nil {
+		return err
+	}
+	md, err := s.runtimeStruct("runtime.moduledata")
+	if err != nil {
+		return err
+	}
+	syms := s.globalSymbols()
+	for _, section := range [][2]string{{"data", "edata"}, {"bss", "ebss"}} {
+		lo, err := s.peekUintOrIntStructField(md, addr, section[0])
+		if err != nil {
+			return err
+		}
+		hi, err := s.peekUintOrIntStructField(md, addr, section[1])
+		if err != nil {
+			return err
+		}
+		err = r.scan(lo, hi, func(addr, ptr uint64) {
+			r.add(debug.Reference{Kind: "global", Address: addr, Pointer: ptr, Name: syms.lookup(addr - s.loadBias)})
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanStacks scans the stacks of the program's goroutines, from their stack
+// pointers, which for goroutines running on threads other than the one that
+// stopped the program aren't known, so their whole stacks are scanned.
+func (r *refScanner) scanStacks() error {
+	s := r.s
+	gType, gs, err := s.goroutineAddrs()
+	if err != nil {
+		return err
+	}
+	f, err := getField(gType, "stack")
+	if err != nil {
+		return err
+	}
+	stackType, ok := followTypedefs(f.Type).(*dwarf.StructType)
+	if !ok {
+		return errors.New("g field stack is not a struct")
+	}
+	sched, err := getField(gType, "sched")
+	if err != nil {
+		return err
+	}
+	gobuf, ok := followTypedefs(sched.Type).(*dwarf.StructType)
+	if !ok {
+		return errors.New("g field sched is not a struct")
+	}
+	current, _ := s.currentG(&s.stoppedRegs)
+	for _, g := range gs {
+		if r.full() {
+			break
+		}
+		status, err := s.goroutineStatus(gType, g)
+		if err != nil {
+			return err
+		}
+		if status == 6 {
+			// _Gdead.
+			continue
+		}
+		lo, err := s.peekUintStructField(stackType, g+uint64(f.ByteOffset), "lo")
+		if err != nil {
+			return err
+		}
+		hi, err := s.peekUintStructField(stackType, g+uint64(f.ByteOffset), "hi")
+		if err != nil {
+			return err
+		}
+		var sp uint64
+		switch {
+		case g == current:
+			sp = s.stoppedRegs.Rsp
+		case status != 2: // _Grunning.
+			sp, _ = s.peekUintStructField(gobuf, g+uint64(sched.ByteOffset), "sp")
+		}
+		if sp < lo || sp > hi {
+			sp = lo
+		}
+		id, _ := s.peekUintOrIntStructField(gType, g, "goid")
+		var (
+			frames     []debug.Frame
+			walked     bool
+			stackStart = len(r.refs)
+		)
+		err = r.scan(sp, hi, func(addr, ptr uint64) {
+			r.add(debug.Reference{Kind: "stack", Address: addr, Pointer: ptr, Goroutine: int64(id)})
+		})
+		if err != nil {
+			return err
+		}
+		// Find the frames holding the pointers, if the stack can be walked.
+		for i := stackStart; i < len(r.refs); i++ {
+			if !walked {
+				walked = true
+				if g == current {
+					frames, _ = s.walkStack(s.stoppedRegs.Rip, s.stoppedRegs.Rsp, s.stoppedRegs.Rbp, goroutineStackFrameCount)
+				} else if status != 2 {
+					s.goroutineStackOnce.Do(func() { s.goroutineStackInit(gType) })
+					frames, _ = s.goroutineStack(g)
+				}
+			}
+			// Each frame runs from its stack pointer to its caller's.
+			for _, fr := range frames {
+				if fr.SP > r.refs[i].Address {
+					break
+				}
+				r.refs[i].Function = fr.Function
+			}
+		}
+	}
+	return nil
+}
+
+// symbolTable is the executable's symbols for data, sorted by address.
+type symbolTable []elf.Symbol
+
+// globalSymbols returns the executable's symbols for data, or none if it
+// has no symbol table.
+func (s *Server) globalSymbols() symbolTable {
+	f, err := elf.Open(s.executable)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	all, err := f.Symbols()
+	if err != nil {
+		return nil
+	}
+	var syms symbolTable
+	for _, sym := range all {
+		if elf.ST_TYPE(sym.Info) == elf.STT_OBJECT && sym.Size > 0 {
+			syms = append(syms, sym)
+		}
+	}
+	sort.Slice(syms, func(i, j int) bool { return syms[i].Value < syms[j].Value })
+	return syms
+}
+
+// lookup returns the name of the symbol holding the unrelocated address
+// addr, or "" if there is none.
+func (t symbolTable) lookup(addr uint64) string {
+	i := sort.Search(len(t), func(i int) bool { return t[i].Value > addr }) - 1
+	if i < 0 || addr >= t[i].Value+t[i].Size {
+		return ""
+	}
+	return t[i].Name
+}
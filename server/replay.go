@@ -0,0 +1,139 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Recording the program's stops as checkpoints, so that it can be taken back
+// to them.  This isn't record and replay: nothing the program does between
+// stops is logged, and since each checkpoint is made with fork, it holds only
+// the thread that stopped the program.
+
+package server
+
+import (
+	"errors"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/server/protocol"
+)
+
+// maxRecordedStops is the number of stops whose checkpoints are kept while
+// recording.
+const maxRecordedStops = 16
+
+// A recordedStop is a stop of the program recorded by SetRecording.
+type recordedStop struct {
+	cp     *checkpoint
+	status debug.Status
+}
+
+func (s *Server) SetRecording(req *protocol.SetRecordingRequest, resp *protocol.SetRecordingResponse) error {
+	return s.call(s.controlc, req, resp)
+}
+
+func (s *Server) handleSetRecording(req *protocol.SetRecordingRequest, resp *protocol.SetRecordingResponse) error {
+	if req.Enabled == s.recording {
+		return nil
+	}
+	s.recording = req.Enabled
+	if !req.Enabled {
+		s.clearTimeline()
+		return nil
+	}
+	// The stop the program is at is the first that can be returned to.
+	if s.proc != nil && s.procIsUp {
+		s.recordStop(nil)
+	}
+	return nil
+}
+
+// recordStop records the stop the program has just made, with the given
+// status, or if it is nil, with just its location, if recording is on.  The
+// stops after the current one in the timeline, which the program had made
+// before it was taken back, are forgotten, since it may not make them again.
+func (s *Server) recordStop(status *debug.Status) {
+	if !s.recording {
+		return
+	}
+	for _, r := range s.timeline[s.timelinePos+1:] {
+		s.killCheckpoint(r.cp.pid)
+	}
+	s.timeline = s.timeline[:s.timelinePos+1]
+	cp, err := s.newCheckpoint()
+	if err != nil {
+		debug.Log(debug.LevelWarn, "recording stop", debug.Field{Key: "err", Value: err})
+		return
+	}
+	if status == nil {
+		status = &debug.Status{PC: cp.regs.Rip, SP: cp.regs.Rsp, Thread: s.stoppedPid}
+	}
+	if len(s.timeline) == maxRecordedStops {
+		s.killCheckpoint(s.timeline[0].cp.pid)
+		s.timeline = s.timeline[1:]
+	}
+	s.timeline = append(s.timeline, recordedStop{cp, *status})
+	s.timelinePos = len(s.timeline) - 1
+}
+
+// clearTimeline forgets the recorded stops.
+func (s *Server) clearTimeline() {
+	for _, r := range s.timeline {
+		s.killCheckpoint(r.cp.pid)
+	}
+	s.timeline = nil
+	s.timelinePos = -1
+}
+
+func (s *Server) ReverseToPreviousBreak(req *protocol.ReverseToPreviousBreakRequest, resp *protocol.ReverseToPreviousBreakResponse) error {
+	return s.call(s.controlc, req, resp)
+}
+
+func (s *Server) handleReverseToPreviousBreak(req *protocol.ReverseToPreviousBreakRequest, resp *protocol.ReverseToPreviousBreakResponse) error {
+	for i := s.previousStop(); i >= 0; i-- {
+		if s.timeline[i].status.Reason != "step" {
+			var err error
+			resp.Status, err = s.returnToStop(i)
+			return err
+		}
+	}
+	return errors.New("ReverseToPreviousBreak: no earlier recorded stop")
+}
+
+func (s *Server) ReverseToPreviousStop(req *protocol.ReverseToPreviousStopRequest, resp *protocol.ReverseToPreviousStopResponse) error {
+	return s.call(s.controlc, req, resp)
+}
+
+func (s *Server) handleReverseToPreviousStop(req *protocol.ReverseToPreviousStopRequest, resp *protocol.ReverseToPreviousStopResponse) error {
+	i := s.previousStop()
+	if i < 0 {
+		return errors.New("ReverseToPreviousStop: no earlier recorded stop")
+	}
+	var err error
+	resp.Status, err = s.returnToStop(i)
+	return err
+}
+
+// previousStop returns the index in the timeline of the last recorded stop
+// before the program's current state, or -1 if there is none.  The current
+// stop is the last recorded one, unless the process has exited since.
+func (s *Server) previousStop() int {
+	if !s.recording {
+		return -1
+	}
+	if s.proc == nil || s.exited != nil {
+		return s.timelinePos
+	}
+	return s.timelinePos - 1
+}
+
+// returnToStop takes the program back to the i'th recorded stop, and returns
+// its status as it was recorded, but for the thread, which is a new one.
+func (s *Server) returnToStop(i int) (debug.Status, error) {
+	r := s.timeline[i]
+	status, err := s.restoreCheckpoint(r.cp)
+	if err != nil {
+		return debug.Status{}, err
+	}
+	s.timelinePos = i
+	r.status.Thread = status.Thread
+	return r.status, nil
+}
@@ -0,0 +1,232 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Finding the addresses of breakpoints again in each process Run starts,
+// which may load the executable at a different address, or run one that
+// has been rebuilt since the breakpoints were set, and whenever the process
+// loads shared objects, which may have the code of pending breakpoints.
+
+package server
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/gosym"
+)
+
+// breakpointSpec records where the client asked for a breakpoint, in terms
+// that don't depend on where the executable is loaded.
+type breakpointSpec struct {
+	// kind is "address", "function", "line", "init" for a package's
+	// initialization, or "cgo" for calls between Go and C.
+	kind string
+	// name is the function, file or package, or, for an address
+	// breakpoint, the function containing it, or "" if there is none.
+	name string
+	// line is the line of a line breakpoint.
+	line uint64
+	// offset is an address breakpoint's offset from the start of its
+	// function, or, if it has none, the address less the load bias.
+	offset uint64
+	// pending is set if the breakpoint is to be kept, pending, when its
+	// location can't be found.
+	pending bool
+}
+
+// addressSpec returns the spec of a breakpoint at the address pc of the
+// current process, or of the next one started if there is none.
+func (s *Server) addressSpec(pc uint64) breakpointSpec {
+	if name, entry, err := s.pcToFunctionName(pc); err == nil && name != "" {
+		return breakpointSpec{kind: "address", name: name, offset: pc - entry}
+	}
+	return breakpointSpec{kind: "address", offset: pc - s.loadBias}
+}
+
+// breakpointPCs returns the addresses of the breakpoint spec describes.
+func (s *Server) breakpointPCs(spec breakpointSpec) ([]uint64, error) {
+	switch spec.kind {
+	case "address":
+		if spec.name == "" {
+			return []uint64{spec.offset + s.loadBias}, nil
+		}
+		entry, err := s.functionStartAddress(spec.name)
+		if err != nil {
+			return nil, err
+		}
+		pc := entry + spec.offset
+		if name, _, err := s.pcToFunctionName(pc); err != nil || name != spec.name {
+			return nil, fmt.Errorf("%s is shorter than %d bytes", spec.name, spec.offset+1)
+		}
+		return []uint64{pc}, nil
+	case "function":
+		return s.functionBreakpointPCs(spec.name)
+	case "line":
+		return s.lineToBreakpointPCs(spec.name, spec.line)
+	case "init":
+		return s.packageInitAddresses(spec.name)
+	case "cgo":
+		return s.cgoCallPCs()
+	}
+	return nil, fmt.Errorf("unknown breakpoint kind %q", spec.kind)
+}
+
+// resolveBreakpoint finds the addresses of the breakpoint with the given ID
+// again, and of the function it must be called from, if any.  If they can't
+// be found, the breakpoint is left pending, without addresses, and with its
+// Err set.
+func (s *Server) resolveBreakpoint(id uint64) {
+	bp := s.userBreakpoints[id]
+	pcs, err := s.breakpointPCs(s.breakpointSpecs[id])
+	if err == nil && len(pcs) == 0 && len(bp.PCs) > 0 {
+		err = fmt.Errorf("no code at the breakpoint's location")
+	}
+	if err == nil && bp.CalledFrom != "" {
+		var entry uint64
+		if entry, err = s.functionStartAddress(bp.CalledFrom); err == nil {
+			s.callerEntries[id] = entry
+		} else {
+			err = fmt.Errorf("caller %s: %v", bp.CalledFrom, err)
+		}
+	}
+	if err != nil {
+		bp.PCs, bp.Locations = nil, nil
+		bp.Err = err.Error()
+		bp.Pending = true
+		return
+	}
+	s.setBreakpointPCs(bp, pcs)
+}
+
+// insertLoadStop sets a breakpoint at the function the dynamic linker calls
+// before and after it loads or unloads shared objects, so that pending
+// breakpoints can be looked for in them.  A statically linked program
+// has no dynamic linker, and so no load stop.
+func (s *Server) insertLoadStop() error {
+	s.loadStop = 0
+	pc, err := s.cFunctionAddress("_dl_debug_state")
+	if err != nil {
+		return nil
+	}
+	if err := s.insertBreakpointPCs([]uint64{pc}); err != nil {
+		return err
+	}
+	s.loadStop = pc
+	return nil
+}
+
+// loadStopHit updates the shared objects the process has loaded, now that
+// the dynamic linker has reached the load stop, and if it has finished
+// loading them, looks for the pending breakpoints in them, sending an event
+// for each that is found.  The breakpoints in objects that were unloaded
+// become pending.
+func (s *Server) loadStopHit() error {
+	unloaded, consistent, err := s.readLinkMap()
+	if err != nil {
+		return fmt.Errorf("reading the shared objects: %v", err)
+	}
+	if !consistent {
+		return nil
+	}
+	for _, o := range unloaded {
+		s.unloadBreakpoints(o)
+	}
+	var ids []uint64
+	for id, bp := range s.userBreakpoints {
+		if bp.Pending {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		bp := s.userBreakpoints[id]
+		s.resolveBreakpoint(id)
+		if bp.Pending {
+			continue
+		}
+		if bp.Enabled {
+			if err := s.insertBreakpointPCs(bp.PCs); err != nil {
+				return fmt.Errorf("setting breakpoint %d: %v", id, err)
+			}
+		}
+		debug.Log(debug.LevelInfo, "pending breakpoint found", debug.Field{Key: "id", Value: id}, debug.Field{Key: "function", Value: bp.Function})
+		r := *bp
+		s.pushEvent(debug.Event{Kind: "resolved", Breakpoint: &r})
+	}
+	return nil
+}
+
+// resolveWatchpoint finds the address of the watched variable of w again,
+// reporting whether it is still there to be watched, with the same size.
+func (s *Server) resolveWatchpoint(w *watchpoint) bool {
+	if s.dwarfData == nil {
+		return false
+	}
+	entry, err := s.dwarfData.LookupVariable(w.Name)
+	if err != nil {
+		return false
+	}
+	addr, err := s.entryLocation(entry)
+	if err != nil {
+		return false
+	}
+	t, err := s.dwarfData.EntryType(entry)
+	if err != nil || t.Size() != int64(w.Size) {
+		return false
+	}
+	w.Address = addr
+	w.regions = watchRegions(addr, w.Size)
+	return true
+}
+
+// reloadIfRebuilt reads the executable again if it has changed since it was
+// last read, so that the next process is debugged with its new symbols.
+// The checkpoints, being copies of processes of the old executable, are
+// discarded.
+func (s *Server) reloadIfRebuilt() error {
+	info, err := os.Stat(s.executable)
+	if err != nil || (info.ModTime().Equal(s.execTime) && info.Size() == s.execSize) {
+		// If the executable can't be read, starting it will say why.
+		return nil
+	}
+	fd, err := os.Open(s.executable)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	detected, dwarfData, err := loadExecutable(fd)
+	if err != nil {
+		return err
+	}
+	if detected == nil || detected.PointerSize != s.arch.PointerSize {
+		return fmt.Errorf("%s: rebuilt for a different architecture", s.executable)
+	}
+	var pcln *gosym.Table
+	if dwarfData == nil {
+		if pcln, err = loadPCLN(fd); err != nil {
+			return fmt.Errorf("%s: no DWARF data, and %v", s.executable, err)
+		}
+	}
+	for id, cp := range s.checkpoints {
+		s.killCheckpoint(cp.pid)
+		delete(s.checkpoints, id)
+	}
+	s.dwarfData = dwarfData
+	s.pcln = pcln
+	s.binaryInfo = readBinaryInfo(fd, &s.arch, detected, dwarfData)
+	s.entry = fileEntry(fd)
+	s.dynamic = fileDynamic(fd)
+	s.execTime = info.ModTime()
+	s.execSize = info.Size()
+	s.printer = NewPrinter(&s.arch, dwarfData, s)
+	s.foreignObjs = nil
+	s.heap = nil
+	s.goroutineStack = nil
+	s.goroutineStackOnce = sync.Once{}
+	debug.Log(debug.LevelInfo, "executable reloaded", debug.Field{Key: "executable", Value: s.executable})
+	return nil
+}
@@ -0,0 +1,192 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Summarizing the state of the runtime's garbage collector and scheduler.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/dwarf"
+	"golang.org/x/debug/server/protocol"
+)
+
+// gcPhases are the names of the runtime's GC phases, its _GCoff and so on.
+var gcPhases = [...]string{"off", "mark", "mark termination"}
+
+// pStatuses are the names of the runtime's P statuses, its _Pidle and so
+// on.  Status 2 was _Psyscall, which newer runtimes don't use.
+var pStatuses = [...]string{"idle", "running", "syscall", "gcstop", "dead"}
+
+// maxProcessors limits how many Ps are read, in case runtime.allp is
+// corrupt.
+const maxProcessors = 1 << 16
+
+func (s *Server) RuntimeStatus(req *protocol.RuntimeStatusRequest, resp *protocol.RuntimeStatusResponse) error {
+	return s.call(s.otherc, req, resp)
+}
+
+func (s *Server) handleRuntimeStatus(req *protocol.RuntimeStatusRequest, resp *protocol.RuntimeStatusResponse) error {
+	if s.dwarfData == nil {
+		return errNoDWARF
+	}
+	rs := &resp.Status
+	phase, err := s.runtimeNumber("runtime.gcphase")
+	if err != nil {
+		return err
+	}
+	rs.GCPhase = fmt.Sprintf("phase %d", phase)
+	if phase < uint64(len(gcPhases)) {
+		rs.GCPhase = gcPhases[phase]
+	}
+
+	// The rest are read as the runtime has them; older runtimes kept some
+	// of them elsewhere.
+	number := func(names ...[]string) uint64 {
+		for _, name := range names {
+			if n, err := s.runtimeNumber(name[0], name[1:]...); err == nil {
+				return n
+			}
+		}
+		return 0
+	}
+	rs.GCCycles = number([]string{"runtime.memstats", "numgc"})
+	rs.HeapLive = number([]string{"runtime.gcController", "heapLive"}, []string{"runtime.memstats", "heap_live"})
+	rs.HeapMarked = number([]string{"runtime.gcController", "heapMarked"}, []string{"runtime.memstats", "heap_marked"})
+	rs.HeapInUse = number([]string{"runtime.gcController", "heapInUse"}, []string{"runtime.memstats", "heap_inuse"})
+	rs.NextGC = number([]string{"runtime.gcController", "gcPercentHeapGoal"}, []string{"runtime.memstats", "next_gc"})
+	rs.GCPercent = int64(number([]string{"runtime.gcController", "gcPercent"}, []string{"runtime.gcpercent"}))
+	rs.MemoryLimit = int64(number([]string{"runtime.gcController", "memoryLimit"}))
+	rs.GOMAXPROCS = int64(number([]string{"runtime.gomaxprocs"}))
+	rs.Threads = int64(number([]string{"runtime.sched", "mnext"}) - number([]string{"runtime.sched", "nmfreed"}))
+	rs.IdleThreads = int64(number([]string{"runtime.sched", "nmidle"}))
+	rs.SpinningThreads = int64(number([]string{"runtime.sched", "nmspinning"}))
+	rs.IdlePs = int64(number([]string{"runtime.sched", "npidle"}))
+	rs.RunQueue = int64(number([]string{"runtime.sched", "runq", "size"}, []string{"runtime.sched", "runqsize"}))
+
+	rs.Ps, err = s.processors()
+	return err
+}
+
+// processors returns the runtime's Ps, from runtime.allp.
+func (s *Server) processors() ([]debug.Processor, error) {
+	addr, t := s.findGlobalVar("runtime.allp")
+	if t == nil {
+		return nil, errors.New("runtime.allp not found")
+	}
+	st, ok := followTypedefs(t).(*dwarf.SliceType)
+	if !ok {
+		return nil, errors.New("runtime.allp is not a slice")
+	}
+	allp, err := s.peekSlice(st, addr)
+	if err != nil {
+		return nil, fmt.Errorf("reading runtime.allp: %v", err)
+	}
+	pType, err := s.runtimeStruct("runtime.p")
+	if err != nil {
+		return nil, err
+	}
+	mType, err := s.runtimeStruct("runtime.m")
+	if err != nil {
+		return nil, err
+	}
+	ptrSize := uint64(s.arch.PointerSize)
+	var ps []debug.Processor
+	for i := uint64(0); i < allp.Length && i < maxProcessors; i++ {
+		p, err := s.peekPtr(allp.Address + i*ptrSize)
+		if err != nil {
+			return nil, fmt.Errorf("reading runtime.allp: %v", err)
+		}
+		if p == 0 {
+			continue
+		}
+		var pr debug.Processor
+		id, err := s.peekNumberField(pType, p, "id")
+		if err != nil {
+			return nil, err
+		}
+		pr.ID = int64(id)
+		status, err := s.peekNumberField(pType, p, "status")
+		if err != nil {
+			return nil, err
+		}
+		pr.Status = fmt.Sprintf("status %d", status)
+		if status < uint64(len(pStatuses)) {
+			pr.Status = pStatuses[status]
+		}
+		if m, err := s.peekNumberField(pType, p, "m"); err == nil && m != 0 {
+			if tid, err := s.peekNumberField(mType, m, "procid"); err == nil {
+				pr.Thread = int(tid)
+			}
+		}
+		head, err := s.peekNumberField(pType, p, "runqhead")
+		if err != nil {
+			return nil, err
+		}
+		tail, err := s.peekNumberField(pType, p, "runqtail")
+		if err != nil {
+			return nil, err
+		}
+		pr.RunQueue = int64(uint32(tail - head))
+		if next, err := s.peekNumberField(pType, p, "runnext"); err == nil && next != 0 {
+			pr.RunQueue++
+		}
+		ps = append(ps, pr)
+	}
+	return ps, nil
+}
+
+// runtimeNumber reads the integer in the runtime's global variable name,
+// or in the field of it reached through the given fields.
+func (s *Server) runtimeNumber(name string, fields ...string) (uint64, error) {
+	addr, t := s.findGlobalVar(name)
+	if t == nil {
+		return 0, fmt.Errorf("%s not found", name)
+	}
+	for _, field := range fields {
+		st, ok := followTypedefs(t).(*dwarf.StructType)
+		if !ok {
+			return 0, fmt.Errorf("reading %s: not a struct", name)
+		}
+		f, err := getField(st, field)
+		if err != nil {
+			return 0, fmt.Errorf("reading %s: %v", name, err)
+		}
+		addr, t = addr+uint64(f.ByteOffset), f.Type
+	}
+	return s.peekNumber(t, addr)
+}
+
+// peekNumberField reads the integer in the field name of the struct of type
+// t at addr.
+func (s *Server) peekNumberField(t *dwarf.StructType, addr uint64, name string) (uint64, error) {
+	f, err := getField(t, name)
+	if err != nil {
+		return 0, err
+	}
+	return s.peekNumber(f.Type, addr+uint64(f.ByteOffset))
+}
+
+// peekNumber reads the integer of type t at addr.  Signed integers are sign
+// extended.  Atomic types, which are structs holding the integer in their
+// field v, or in the runtime's own, value, are read through.
+func (s *Server) peekNumber(t dwarf.Type, addr uint64) (uint64, error) {
+	switch t := followTypedefs(t).(type) {
+	case *dwarf.IntType:
+		i, err := s.peekInt(addr, t.ByteSize)
+		return uint64(i), err
+	case *dwarf.UintType:
+		return s.peekUint(addr, t.ByteSize)
+	case *dwarf.StructType:
+		for _, name := range []string{"v", "value"} {
+			if f, err := getField(t, name); err == nil {
+				return s.peekNumber(f.Type, addr+uint64(f.ByteOffset))
+			}
+		}
+	}
+	return 0, fmt.Errorf("%s is not an integer", typeName(t))
+}
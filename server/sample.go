@@ -0,0 +1,32 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Sampling the values of global expressions while the process runs.
+
+package server
+
+import (
+	"golang.org/x/debug"
+	"golang.org/x/debug/server/protocol"
+)
+
+// Sample is served like the breakpoint requests, so that if the process is
+// running, Resume stops the thread it is waiting on to serve it, and then
+// continues the thread.  Only the thread's memory accesses are needed, and
+// it shares its memory with the process's other threads.
+func (s *Server) Sample(req *protocol.SampleRequest, resp *protocol.SampleResponse) error {
+	return s.call(s.breakpointc, req, resp)
+}
+
+func (s *Server) handleSample(req *protocol.SampleRequest, resp *protocol.SampleResponse) error {
+	resp.Samples = make([]debug.Sample, len(req.Expressions))
+	for i, expr := range req.Expressions {
+		v, t, err := s.sampleExpression(expr)
+		resp.Samples[i] = debug.Sample{Expression: expr, Value: v, Type: t}
+		if err != nil {
+			resp.Samples[i].Err = err.Error()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Selecting the stack frame that expressions are evaluated in.
+
+package server
+
+import (
+	"fmt"
+
+	"golang.org/x/debug/server/protocol"
+)
+
+// A frameSelection is a frame chosen by SelectFrame.  It lasts until the
+// process next stops.
+type frameSelection struct {
+	stop   uint64 // The value of s.stops when the frame was selected.
+	pc, sp uint64
+}
+
+func (s *Server) SelectFrame(req *protocol.SelectFrameRequest, resp *protocol.SelectFrameResponse) error {
+	return s.call(s.otherc, req, resp)
+}
+
+func (s *Server) handleSelectFrame(req *protocol.SelectFrameRequest, resp *protocol.SelectFrameResponse) error {
+	if req.Frame < 0 {
+		return fmt.Errorf("SelectFrame: invalid frame index %d", req.Frame)
+	}
+	if req.Frame == 0 {
+		s.selectedFrame = nil
+		return nil
+	}
+	if s.topOfStackAddrs == nil {
+		if err := s.evaluateTopOfStackAddrs(); err != nil {
+			return err
+		}
+	}
+
+	regs := ptraceRegs{}
+	err := s.ptraceGetRegs(s.stoppedPid, &regs)
+	if err != nil {
+		return err
+	}
+	frames, err := s.walkStack(regs.Rip, regs.Rsp, regs.Rbp, req.Frame+1)
+	if len(frames) <= req.Frame {
+		if err == nil {
+			err = fmt.Errorf("SelectFrame: the stack has only %d frames", len(frames))
+		}
+		return err
+	}
+	f := frames[req.Frame]
+	s.selectedFrame = &frameSelection{stop: s.stops, pc: f.PC, sp: f.SP}
+	return nil
+}
+
+// evalFrame returns the PC and SP of the frame that Evaluate uses: the one
+// selected by SelectFrame, if it was selected since the process last stopped,
+// or else the one the process is stopped in.
+func (s *Server) evalFrame() (pc, sp uint64) {
+	if f := s.selectedFrame; f != nil && f.stop == s.stops {
+		return f.pc, f.sp
+	}
+	return s.stoppedRegs.Rip, s.stoppedRegs.Rsp
+}
@@ -14,16 +14,21 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"syscall"
+	"time"
+	"unicode/utf8"
 
 	"golang.org/x/debug"
 	"golang.org/x/debug/arch"
 	"golang.org/x/debug/dwarf"
 	"golang.org/x/debug/elf"
+	"golang.org/x/debug/gosym"
 	"golang.org/x/debug/macho"
+	"golang.org/x/debug/pe"
 	"golang.org/x/debug/server/protocol"
 )
 
@@ -41,21 +46,86 @@ type Server struct {
 	arch       arch.Architecture
 	executable string // Name of executable.
 	dwarfData  *dwarf.Data
+	pcln       *gosym.Table // Functions and lines from .gopclntab, if dwarfData is nil.
+	binaryInfo debug.BinaryInfo
+	entry      uint64    // Where fileEntry found the executable was linked at.
+	dynamic    uint64    // Address of the executable's dynamic section, as linked, or 0 if it has none.
+	execTime   time.Time // Modification time of the executable when it was read.
+	execSize   int64     // Size of the executable when it was read.
+	loadBias   uint64    // Where the process's executable is, less where it was linked.
 
 	breakpointc chan call
+	controlc    chan call
 	otherc      chan call
 
 	fc chan func() error
 	ec chan error
 
-	proc            *os.Process
-	procIsUp        bool
-	stoppedPid      int
-	stoppedRegs     syscall.PtraceRegs
-	topOfStackAddrs []uint64
-	breakpoints     map[uint64]breakpoint
-	files           []*file // Index == file descriptor.
-	printer         *Printer
+	proc             *os.Process
+	procIsUp         bool
+	killOnExit       bool // Whether to kill processes when detaching or exiting.
+	procKillOnExit   bool // The value of killOnExit when the process was started.
+	deterministic    bool // Whether to start processes as set by SetDeterministic.
+	showTemporaries  bool // Whether frames list compiler temporaries, as set by SetShowTemporaries.
+	procDeterminism  bool // The value of deterministic when the process was started.
+	stoppedPid       int
+	stoppedRegs      ptraceRegs
+	otherThreads     map[int]bool // Threads stopped along with stoppedPid; true if a SIGSTOP is still pending.
+	stoppedPending   bool         // Whether a SIGSTOP is still pending for stoppedPid, if SelectThread chose it.
+	trapPid          int          // The thread that stopped the process, if SelectThread made another stoppedPid.
+	topOfStackAddrs  []uint64
+	foreignObjs      map[string]*foreignObject    // Frame information of code that isn't Go's, by file; see foreignObjectAt.
+	selectedFrame    *frameSelection              // Set by SelectFrame.
+	breakpoints      map[uint64]breakpoint        // Breakpoint instructions, keyed by PC.
+	userBreakpoints  map[uint64]*debug.Breakpoint // Breakpoints set by the client, keyed by ID.
+	breakpointSpecs  map[uint64]breakpointSpec    // Where the client asked for each breakpoint, keyed by ID.
+	nextBreakpointID uint64
+	callerEntries    map[uint64]uint64      // Entry PC of the function a breakpoint must be reached from, keyed by ID.
+	watchpoints      map[uint64]*watchpoint // Keyed by ID.
+	nextWatchpointID uint64
+	watchRegsSet     bool                 // Whether the debug registers may hold watchpoints.
+	queuedWatchHits  map[int][]uint64     // Watchpoints triggered by threads stopped along with another's; see queueWatchpointHit.
+	scratchPC        uint64               // Where instructions are executed out of line; see findScratch.
+	exited           *debug.ProcessExited // Non-nil once the process has exited.
+	files            []*file              // Index == file descriptor.
+	stdout, stderr   *outputBuffer        // The process's output.
+	events           *eventQueue          // Events for callers of NextEvent from outside ServeConn.
+	clients          clientSet            // The connections served by ServeConn.
+	resumingAsync    bool                 // Whether the process was resumed by ResumeAsync.
+	histories        map[string]*history  // Recorded values, keyed by expression.
+	stops            uint64               // Number of times a process has stopped.
+	heap             *heapLayout          // The runtime's heap metadata; see checkHeapObject.
+	printer          *Printer
+	signalPolicies   map[syscall.Signal]debug.SignalPolicy // Set by SetSignalPolicy.
+	stopSignal       syscall.Signal                        // The signal the process stopped for, delivered when it resumes.
+	quotas           Quotas                                // Set by SetQuotas.
+	cache            *cacheQuota                           // Memory used by stdout, stderr and histories.
+	readsSince       time.Time                             // Start of the minute counted by readBytes.
+	readBytes        int64                                 // Bytes of memory read for the client since readsSince.
+	lastRun          *protocol.RunRequest                  // The arguments of the last Run, for Restart.
+	snapshots        []debug.Snapshot                      // Recorded by recording breakpoints, oldest first.
+	traceEvents      []debug.TraceEvent                    // Recorded by tracepoints, oldest first.
+	commandResults   []debug.CommandResults                // For the breakpoints the program is stopping at.
+	calls            *callTracer                           // Set by Trace; nil if no calls are traced.
+	panicFunctions   []string                              // Set by SetPanicStops.
+	threadStops      bool                                  // Set by SetThreadStops.
+	newThread        int                                   // The thread whose start stopped the process, if any.
+	hitBreakpoints   []uint64                              // IDs of the breakpoints the program is stopping at.
+	hitWatchpoints   []uint64                              // IDs of the watchpoints the program is stopping for.
+	panicStops       map[uint64]string                     // The functions in panicFunctions, keyed by start address.
+	loadStop         uint64                                // Where the dynamic linker reports loading shared objects; see insertLoadStop.
+	objects          []*loadedObject                       // The shared objects the process has loaded; see readLinkMap.
+	checkpoints      map[uint64]*checkpoint                // Keyed by ID.
+	recording        bool                                  // Whether stops are recorded, as set by SetRecording.
+	timeline         []recordedStop                        // The recorded stops, oldest first.
+	timelinePos      int                                   // The index in timeline of the stop the program was last at.
+	composites       compositeMemory                       // Values of variables that aren't in memory, readable at made-up addresses.
+	nextCheckpointID uint64
+
+	sessionID string        // Identifies the server to reconnecting clients.
+	done      chan struct{} // Closed by Shutdown.
+	liveMu    sync.Mutex    // Guards live.
+	live      bool          // Whether there is a live process, for HasProcess.
 
 	// goroutineStack reads the stack of a (non-running) goroutine.
 	goroutineStack     func(uint64) ([]debug.Frame, error)
@@ -64,30 +134,91 @@ type Server struct {
 
 // peek implements the Peeker interface required by the printer.
 func (s *Server) peek(offset uintptr, buf []byte) error {
+	if err := s.chargeRead(len(buf)); err != nil {
+		return err
+	}
 	return s.ptracePeek(s.stoppedPid, offset, buf)
 }
 
 // New parses the executable and builds local data structures for answering requests.
 // It returns a Server ready to serve requests about the executable.
 func New(executable string) (*Server, error) {
+	return NewWithArch(executable, nil)
+}
+
+// NewWithArch is like New, but lets chooseArch decide the architecture of the
+// executable, for toolchains whose executables are misidentified.  It is
+// passed the architecture detected from the executable's headers, or nil if
+// it wasn't recognized, and returns the architecture to use: for example,
+// &arch.X86 to debug a 32-bit program on a 64-bit system, or a modified copy
+// of the detected architecture with a different breakpoint instruction.
+// A nil chooseArch uses the detected architecture.
+func NewWithArch(executable string, chooseArch func(detected *arch.Architecture) (*arch.Architecture, error)) (*Server, error) {
 	fd, err := os.Open(executable)
 	if err != nil {
 		return nil, err
 	}
 	defer fd.Close()
-	architecture, dwarfData, err := loadExecutable(fd)
+	info, err := fd.Stat()
+	if err != nil {
+		return nil, err
+	}
+	detected, dwarfData, err := loadExecutable(fd)
 	if err != nil {
 		return nil, err
 	}
+	architecture := detected
+	if chooseArch != nil {
+		if architecture, err = chooseArch(detected); err != nil {
+			return nil, err
+		}
+	}
+	if architecture == nil {
+		return nil, fmt.Errorf("%s: unrecognized architecture", executable)
+	}
+	if err := checkArch(architecture); err != nil {
+		return nil, err
+	}
+	cache := newCacheQuota()
 	srv := &Server{
-		arch:        *architecture,
-		executable:  executable,
-		dwarfData:   dwarfData,
-		breakpointc: make(chan call),
-		otherc:      make(chan call),
-		fc:          make(chan func() error),
-		ec:          make(chan error),
-		breakpoints: make(map[uint64]breakpoint),
+		arch:            *architecture,
+		executable:      executable,
+		dwarfData:       dwarfData,
+		binaryInfo:      readBinaryInfo(fd, architecture, detected, dwarfData),
+		entry:           fileEntry(fd),
+		dynamic:         fileDynamic(fd),
+		execTime:        info.ModTime(),
+		execSize:        info.Size(),
+		breakpointc:     make(chan call),
+		controlc:        make(chan call),
+		otherc:          make(chan call),
+		fc:              make(chan func() error),
+		ec:              make(chan error),
+		breakpoints:     make(map[uint64]breakpoint),
+		userBreakpoints: make(map[uint64]*debug.Breakpoint),
+		breakpointSpecs: make(map[uint64]breakpointSpec),
+		callerEntries:   make(map[uint64]uint64),
+		watchpoints:     make(map[uint64]*watchpoint),
+		checkpoints:     make(map[uint64]*checkpoint),
+		timelinePos:     -1,
+		histories:       make(map[string]*history),
+		signalPolicies:  make(map[syscall.Signal]debug.SignalPolicy),
+		panicFunctions:  defaultPanicStops,
+		killOnExit:      true,
+		cache:           cache,
+		stdout:          newOutputBuffer(cache),
+		stderr:          newOutputBuffer(cache),
+		events:          newEventQueue(),
+		clients:         clientSet{queues: make(map[uint64]*clientQueue)},
+		sessionID:       newSessionID(),
+		done:            make(chan struct{}),
+	}
+	if dwarfData == nil {
+		// A stripped executable can still be debugged, though with little
+		// more than functions and lines.
+		if srv.pcln, err = loadPCLN(fd); err != nil {
+			return nil, fmt.Errorf("%s: no DWARF data, and %v", executable, err)
+		}
 	}
 	srv.printer = NewPrinter(architecture, dwarfData, srv)
 	go ptraceRun(srv.fc, srv.ec)
@@ -95,10 +226,19 @@ func New(executable string) (*Server, error) {
 	return srv, nil
 }
 
+// loadExecutable reads the DWARF data of the executable f, and determines
+// its architecture, which is nil if it isn't one the debugger knows.  The
+// DWARF data of an ELF executable stripped of it is read from its separate
+// debug file, if there is one, and is otherwise nil.
 func loadExecutable(f *os.File) (*arch.Architecture, *dwarf.Data, error) {
 	// TODO: How do we detect NaCl?
 	if obj, err := elf.NewFile(f); err == nil {
-		dwarfData, err := obj.DWARF()
+		var dwarfData *dwarf.Data
+		if hasDWARF(obj) {
+			dwarfData, err = obj.DWARF()
+		} else {
+			dwarfData, err = separateDWARF(f.Name(), obj)
+		}
 		if err != nil {
 			return nil, nil, err
 		}
@@ -116,7 +256,7 @@ func loadExecutable(f *os.File) (*arch.Architecture, *dwarf.Data, error) {
 		case elf.EM_X86_64:
 			return &arch.AMD64, dwarfData, nil
 		}
-		return nil, nil, fmt.Errorf("unrecognized ELF architecture")
+		return nil, dwarfData, nil
 	}
 	if obj, err := macho.NewFile(f); err == nil {
 		dwarfData, err := obj.DWARF()
@@ -136,59 +276,264 @@ func loadExecutable(f *os.File) (*arch.Architecture, *dwarf.Data, error) {
 		case macho.CpuAmd64:
 			return &arch.AMD64, dwarfData, nil
 		}
-		return nil, nil, fmt.Errorf("unrecognized Mach-O architecture")
+		return nil, dwarfData, nil
+	}
+	if obj, err := pe.NewFile(f); err == nil {
+		dwarfData, err := obj.DWARF()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		switch obj.Machine {
+		case pe.IMAGE_FILE_MACHINE_I386:
+			return &arch.X86, dwarfData, nil
+		case pe.IMAGE_FILE_MACHINE_AMD64:
+			return &arch.AMD64, dwarfData, nil
+		case pe.IMAGE_FILE_MACHINE_ARMNT:
+			return &arch.ARM, dwarfData, nil
+		}
+		return nil, dwarfData, nil
 	}
 	return nil, nil, fmt.Errorf("unrecognized binary format")
 }
 
+// checkArch returns an error if a can't be the architecture of a program.
+func checkArch(a *arch.Architecture) error {
+	if a.BreakpointSize <= 0 || a.BreakpointSize > arch.MaxBreakpointSize {
+		return fmt.Errorf("invalid breakpoint size %d", a.BreakpointSize)
+	}
+	if a.PointerSize != 4 && a.PointerSize != 8 {
+		return fmt.Errorf("invalid pointer size %d", a.PointerSize)
+	}
+	if a.IntSize != 4 && a.IntSize != 8 {
+		return fmt.Errorf("invalid int size %d", a.IntSize)
+	}
+	if a.ByteOrder == nil || a.FloatByteOrder == nil {
+		return fmt.Errorf("architecture has no byte order")
+	}
+	return nil
+}
+
 func (s *Server) loop() {
 	for {
-		var c call
-		select {
-		case c = <-s.breakpointc:
-		case c = <-s.otherc:
-		}
-		s.dispatch(c)
+		s.dispatch(s.next())
 	}
 }
 
 func (s *Server) dispatch(c call) {
+	if s.exited != nil && needsProcess(c.req) {
+		c.errc <- s.exited
+		return
+	}
+	if s.dwarfData == nil && needsDWARF(c.req) {
+		c.errc <- errNoDWARF
+		return
+	}
+	if runsProcess(c.req) {
+		if err := s.deselectThread(); err != nil {
+			c.errc <- err
+			return
+		}
+	}
+	var err error
 	switch req := c.req.(type) {
 	case *protocol.BreakpointRequest:
-		c.errc <- s.handleBreakpoint(req, c.resp.(*protocol.BreakpointResponse))
+		err = s.handleBreakpoint(req, c.resp.(*protocol.BreakpointResponse))
 	case *protocol.BreakpointAtFunctionRequest:
-		c.errc <- s.handleBreakpointAtFunction(req, c.resp.(*protocol.BreakpointResponse))
+		err = s.handleBreakpointAtFunction(req, c.resp.(*protocol.BreakpointResponse))
 	case *protocol.BreakpointAtLineRequest:
-		c.errc <- s.handleBreakpointAtLine(req, c.resp.(*protocol.BreakpointResponse))
+		err = s.handleBreakpointAtLine(req, c.resp.(*protocol.BreakpointResponse))
+	case *protocol.BreakpointAtPackageInitRequest:
+		err = s.handleBreakpointAtPackageInit(req, c.resp.(*protocol.BreakpointResponse))
+	case *protocol.BreakpointAtCgoCallsRequest:
+		err = s.handleBreakpointAtCgoCalls(req, c.resp.(*protocol.BreakpointResponse))
 	case *protocol.DeleteBreakpointsRequest:
-		c.errc <- s.handleDeleteBreakpoints(req, c.resp.(*protocol.DeleteBreakpointsResponse))
+		err = s.handleDeleteBreakpoints(req, c.resp.(*protocol.DeleteBreakpointsResponse))
+	case *protocol.EnableBreakpointRequest:
+		err = s.handleEnableBreakpoint(req, c.resp.(*protocol.EnableBreakpointResponse))
+	case *protocol.SetBreakpointCallerRequest:
+		err = s.handleSetBreakpointCaller(req, c.resp.(*protocol.SetBreakpointCallerResponse))
+	case *protocol.SetBreakpointOneShotRequest:
+		err = s.handleSetBreakpointOneShot(req, c.resp.(*protocol.SetBreakpointOneShotResponse))
+	case *protocol.SetBreakpointRecordRequest:
+		err = s.handleSetBreakpointRecord(req, c.resp.(*protocol.SetBreakpointRecordResponse))
+	case *protocol.SnapshotsRequest:
+		err = s.handleSnapshots(req, c.resp.(*protocol.SnapshotsResponse))
+	case *protocol.SetBreakpointTraceRequest:
+		err = s.handleSetBreakpointTrace(req, c.resp.(*protocol.SetBreakpointTraceResponse))
+	case *protocol.TraceEventsRequest:
+		err = s.handleTraceEvents(req, c.resp.(*protocol.TraceEventsResponse))
+	case *protocol.SetBreakpointCommandsRequest:
+		err = s.handleSetBreakpointCommands(req, c.resp.(*protocol.SetBreakpointCommandsResponse))
+	case *protocol.TraceRequest:
+		err = s.handleTrace(req, c.resp.(*protocol.TraceResponse))
+	case *protocol.SetBreakpointGroupRequest:
+		err = s.handleSetBreakpointGroup(req, c.resp.(*protocol.SetBreakpointGroupResponse))
+	case *protocol.EnableBreakpointGroupRequest:
+		err = s.handleEnableBreakpointGroup(req, c.resp.(*protocol.EnableBreakpointGroupResponse))
+	case *protocol.DeleteBreakpointGroupRequest:
+		err = s.handleDeleteBreakpointGroup(req, c.resp.(*protocol.DeleteBreakpointGroupResponse))
+	case *protocol.ListBreakpointsRequest:
+		err = s.handleListBreakpoints(req, c.resp.(*protocol.ListBreakpointsResponse))
 	case *protocol.CloseRequest:
-		c.errc <- s.handleClose(req, c.resp.(*protocol.CloseResponse))
+		err = s.handleClose(req, c.resp.(*protocol.CloseResponse))
+	case *protocol.WatchGlobalRequest:
+		err = s.handleWatchGlobal(req, c.resp.(*protocol.WatchGlobalResponse))
+	case *protocol.WatchMapRequest:
+		err = s.handleWatchMap(req, c.resp.(*protocol.WatchMapResponse))
+	case *protocol.DeleteWatchpointsRequest:
+		err = s.handleDeleteWatchpoints(req, c.resp.(*protocol.DeleteWatchpointsResponse))
+	case *protocol.FindStringRequest:
+		err = s.handleFindString(req, c.resp.(*protocol.FindStringResponse))
+	case *protocol.SetKillOnExitRequest:
+		err = s.handleSetKillOnExit(req, c.resp.(*protocol.SetKillOnExitResponse))
+	case *protocol.SetDeterministicRequest:
+		err = s.handleSetDeterministic(req, c.resp.(*protocol.SetDeterministicResponse))
+	case *protocol.SetShowTemporariesRequest:
+		err = s.handleSetShowTemporaries(req, c.resp.(*protocol.SetShowTemporariesResponse))
+	case *protocol.SetSignalPolicyRequest:
+		err = s.handleSetSignalPolicy(req, c.resp.(*protocol.SetSignalPolicyResponse))
+	case *protocol.SetPanicStopsRequest:
+		err = s.handleSetPanicStops(req, c.resp.(*protocol.SetPanicStopsResponse))
+	case *protocol.SetThreadStopsRequest:
+		err = s.handleSetThreadStops(req, c.resp.(*protocol.SetThreadStopsResponse))
+	case *protocol.DetachRequest:
+		err = s.handleDetach(req, c.resp.(*protocol.DetachResponse))
+	case *protocol.ShutdownRequest:
+		err = s.handleShutdown(req, c.resp.(*protocol.ShutdownResponse))
 	case *protocol.EvalRequest:
-		c.errc <- s.handleEval(req, c.resp.(*protocol.EvalResponse))
+		err = s.handleEval(req, c.resp.(*protocol.EvalResponse))
 	case *protocol.EvaluateRequest:
-		c.errc <- s.handleEvaluate(req, c.resp.(*protocol.EvaluateResponse))
+		err = s.handleEvaluate(req, c.resp.(*protocol.EvaluateResponse))
+	case *protocol.SampleRequest:
+		err = s.handleSample(req, c.resp.(*protocol.SampleResponse))
+	case *protocol.InterruptRequest:
+		err = s.handleInterrupt(req, c.resp.(*protocol.InterruptResponse))
+	case *protocol.BinaryInfoRequest:
+		err = s.handleBinaryInfo(req, c.resp.(*protocol.BinaryInfoResponse))
+	case *protocol.HistoryRequest:
+		err = s.handleHistory(req, c.resp.(*protocol.HistoryResponse))
 	case *protocol.FramesRequest:
-		c.errc <- s.handleFrames(req, c.resp.(*protocol.FramesResponse))
+		err = s.handleFrames(req, c.resp.(*protocol.FramesResponse))
+	case *protocol.SelectFrameRequest:
+		err = s.handleSelectFrame(req, c.resp.(*protocol.SelectFrameResponse))
+	case *protocol.ThreadsRequest:
+		err = s.handleThreads(req, c.resp.(*protocol.ThreadsResponse))
+	case *protocol.SharedObjectsRequest:
+		err = s.handleSharedObjects(req, c.resp.(*protocol.SharedObjectsResponse))
+	case *protocol.SelectThreadRequest:
+		err = s.handleSelectThread(req, c.resp.(*protocol.SelectThreadResponse))
+	case *protocol.LocalVariablesRequest:
+		err = s.handleLocalVariables(req, c.resp.(*protocol.LocalVariablesResponse))
 	case *protocol.OpenRequest:
-		c.errc <- s.handleOpen(req, c.resp.(*protocol.OpenResponse))
+		err = s.handleOpen(req, c.resp.(*protocol.OpenResponse))
 	case *protocol.ReadAtRequest:
-		c.errc <- s.handleReadAt(req, c.resp.(*protocol.ReadAtResponse))
+		err = s.handleReadAt(req, c.resp.(*protocol.ReadAtResponse))
+	case *protocol.ResumeAsyncRequest:
+		err = s.handleResumeAsync(req)
 	case *protocol.ResumeRequest:
-		c.errc <- s.handleResume(req, c.resp.(*protocol.ResumeResponse))
+		err = s.handleResume(req, c.resp.(*protocol.ResumeResponse))
+	case *protocol.StepInstructionRequest:
+		err = s.handleStepInstruction(req, c.resp.(*protocol.StepInstructionResponse))
+	case *protocol.RunToLineRequest:
+		err = s.handleRunToLine(req, c.resp.(*protocol.RunToLineResponse))
 	case *protocol.RunRequest:
-		c.errc <- s.handleRun(req, c.resp.(*protocol.RunResponse))
+		err = s.handleRun(req, c.resp.(*protocol.RunResponse))
+	case *protocol.KillRequest:
+		err = s.handleKill(req, c.resp.(*protocol.KillResponse))
+	case *protocol.RestartRequest:
+		err = s.handleRestart(req, c.resp.(*protocol.RestartResponse))
+	case *protocol.CheckpointRequest:
+		err = s.handleCheckpoint(req, c.resp.(*protocol.CheckpointResponse))
+	case *protocol.RestoreRequest:
+		err = s.handleRestore(req, c.resp.(*protocol.RestoreResponse))
+	case *protocol.DeleteCheckpointRequest:
+		err = s.handleDeleteCheckpoint(req, c.resp.(*protocol.DeleteCheckpointResponse))
+	case *protocol.SetRecordingRequest:
+		err = s.handleSetRecording(req, c.resp.(*protocol.SetRecordingResponse))
+	case *protocol.ReverseToPreviousBreakRequest:
+		err = s.handleReverseToPreviousBreak(req, c.resp.(*protocol.ReverseToPreviousBreakResponse))
+	case *protocol.ReverseToPreviousStopRequest:
+		err = s.handleReverseToPreviousStop(req, c.resp.(*protocol.ReverseToPreviousStopResponse))
 	case *protocol.VarByNameRequest:
-		c.errc <- s.handleVarByName(req, c.resp.(*protocol.VarByNameResponse))
+		err = s.handleVarByName(req, c.resp.(*protocol.VarByNameResponse))
+	case *protocol.FunctionsRequest:
+		err = s.handleFunctions(req, c.resp.(*protocol.FunctionsResponse))
+	case *protocol.SourcesRequest:
+		err = s.handleSources(req, c.resp.(*protocol.SourcesResponse))
+	case *protocol.SourceRequest:
+		err = s.handleSource(req, c.resp.(*protocol.SourceResponse))
+	case *protocol.TypesRequest:
+		err = s.handleTypes(req, c.resp.(*protocol.TypesResponse))
+	case *protocol.TypeRequest:
+		err = s.handleType(req, c.resp.(*protocol.TypeResponse))
+	case *protocol.DebugManifestRequest:
+		err = s.handleDebugManifest(req, c.resp.(*protocol.DebugManifestResponse))
+	case *protocol.BatchRequest:
+		err = s.handleBatch(req, c.resp.(*protocol.BatchResponse))
+	case *protocol.ReadMemoryRequest:
+		err = s.handleReadMemory(req, c.resp.(*protocol.ReadMemoryResponse))
+	case *protocol.WriteMemoryRequest:
+		err = s.handleWriteMemory(req, c.resp.(*protocol.WriteMemoryResponse))
+	case *protocol.AsPointerRequest:
+		err = s.handleAsPointer(req, c.resp.(*protocol.AsPointerResponse))
 	case *protocol.ValueRequest:
-		c.errc <- s.handleValue(req, c.resp.(*protocol.ValueResponse))
+		err = s.handleValue(req, c.resp.(*protocol.ValueResponse))
+	case *protocol.ValueTreeRequest:
+		err = s.handleValueTree(req, c.resp.(*protocol.ValueTreeResponse))
 	case *protocol.MapElementRequest:
-		c.errc <- s.handleMapElement(req, c.resp.(*protocol.MapElementResponse))
+		err = s.handleMapElement(req, c.resp.(*protocol.MapElementResponse))
+	case *protocol.MapElementsRequest:
+		err = s.handleMapElements(req, c.resp.(*protocol.MapElementsResponse))
+	case *protocol.ChannelWaitersRequest:
+		err = s.handleChannelWaiters(req, c.resp.(*protocol.ChannelWaitersResponse))
 	case *protocol.GoroutinesRequest:
-		c.errc <- s.handleGoroutines(req, c.resp.(*protocol.GoroutinesResponse))
+		err = s.handleGoroutines(req, c.resp.(*protocol.GoroutinesResponse))
+	case *protocol.PanicInfoRequest:
+		err = s.handlePanicInfo(req, c.resp.(*protocol.PanicInfoResponse))
+	case *protocol.DeferredCallsRequest:
+		err = s.handleDeferredCalls(req, c.resp.(*protocol.DeferredCallsResponse))
+	case *protocol.HeapStatsRequest:
+		err = s.handleHeapStats(req, c.resp.(*protocol.HeapStatsResponse))
+	case *protocol.HeapDumpRequest:
+		err = s.handleHeapDump(req, c.resp.(*protocol.HeapDumpResponse))
+	case *protocol.FindReferencesRequest:
+		err = s.handleFindReferences(req, c.resp.(*protocol.FindReferencesResponse))
+	case *protocol.RuntimeStatusRequest:
+		err = s.handleRuntimeStatus(req, c.resp.(*protocol.RuntimeStatusResponse))
 	default:
 		panic(fmt.Sprintf("unexpected call request type %T", c.req))
 	}
+	if err != nil && needsProcess(c.req) && s.checkExited() {
+		// The error was most likely caused by the process going away.
+		err = s.exited
+	}
+	if err != nil {
+		debug.Log(debug.LevelDebug, "request", debug.Field{Key: "type", Value: fmt.Sprintf("%T", c.req)}, debug.Field{Key: "err", Value: err})
+	} else {
+		debug.Log(debug.LevelDebug, "request", debug.Field{Key: "type", Value: fmt.Sprintf("%T", c.req)})
+	}
+	s.reportStop(c.resp, err)
+	c.errc <- err
+}
+
+// needsProcess reports whether the request can only be served while there is
+// a live process.
+func needsProcess(req interface{}) bool {
+	switch req.(type) {
+	case *protocol.RunRequest, *protocol.RestartRequest, *protocol.KillRequest,
+		*protocol.OpenRequest, *protocol.ReadAtRequest, *protocol.CloseRequest,
+		*protocol.SetKillOnExitRequest, *protocol.SetDeterministicRequest, *protocol.SetSignalPolicyRequest,
+		*protocol.DetachRequest, *protocol.HistoryRequest, *protocol.BinaryInfoRequest,
+		*protocol.FunctionsRequest, *protocol.SourcesRequest, *protocol.SourceRequest, *protocol.TypesRequest, *protocol.TypeRequest,
+		*protocol.DebugManifestRequest, *protocol.RestoreRequest, *protocol.DeleteCheckpointRequest,
+		*protocol.SetRecordingRequest, *protocol.ReverseToPreviousBreakRequest, *protocol.ReverseToPreviousStopRequest,
+		*protocol.SnapshotsRequest, *protocol.TraceEventsRequest, *protocol.SetShowTemporariesRequest,
+		*protocol.SetPanicStopsRequest, *protocol.SetThreadStopsRequest, *protocol.ShutdownRequest,
+		*protocol.ListBreakpointsRequest:
+		return false
+	}
+	return true
 }
 
 func (s *Server) call(c chan call, req, resp interface{}) error {
@@ -197,6 +542,12 @@ func (s *Server) call(c chan call, req, resp interface{}) error {
 	return <-errc
 }
 
+// Ping replies at once, without waiting for the requests before it, so that
+// clients can tell a slow request from a lost connection.
+func (s *Server) Ping(req *protocol.PingRequest, resp *protocol.PingResponse) error {
+	return nil
+}
+
 type file struct {
 	mode  string
 	index int
@@ -273,40 +624,163 @@ func (s *Server) handleClose(req *protocol.CloseRequest, resp *protocol.CloseRes
 }
 
 func (s *Server) Run(req *protocol.RunRequest, resp *protocol.RunResponse) error {
-	return s.call(s.otherc, req, resp)
+	return s.call(s.controlc, req, resp)
 }
 
 func (s *Server) handleRun(req *protocol.RunRequest, resp *protocol.RunResponse) error {
 	if s.proc != nil {
-		s.proc.Kill()
-		s.proc = nil
-		s.procIsUp = false
-		s.stoppedPid = 0
-		s.stoppedRegs = syscall.PtraceRegs{}
-		s.topOfStackAddrs = nil
+		if s.exited == nil {
+			if err := s.killProcess(); err != nil {
+				return err
+			}
+		}
+		s.resetProcess()
+	}
+	s.clearTimeline()
+	if err := s.reloadIfRebuilt(); err != nil {
+		return err
+	}
+	if err := checkRunnable(s.executable, s.binaryInfo.GOOS); err != nil {
+		return err
+	}
+	run := *req
+	s.lastRun = &run
+	stdoutr, stdoutw, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	stderrr, stderrw, err := os.Pipe()
+	if err != nil {
+		stdoutr.Close()
+		stdoutw.Close()
+		return err
 	}
 	argv := append([]string{s.executable}, req.Args...)
 	p, err := s.startProcess(s.executable, argv, &os.ProcAttr{
+		Dir: req.Dir,
+		Env: s.processEnv(),
 		Files: []*os.File{
-			nil,       // TODO: be able to feed the target's stdin.
-			os.Stderr, // TODO: be able to capture the target's stdout.
-			os.Stderr,
+			nil, // TODO: be able to feed the target's stdin.
+			stdoutw,
+			stderrw,
 		},
-		Sys: &syscall.SysProcAttr{
-			Pdeathsig: syscall.SIGKILL,
-			Ptrace:    true,
-		},
-	})
+	}, s.killOnExit)
+	// The process has its own copies of the writing ends.
+	stdoutw.Close()
+	stderrw.Close()
 	if err != nil {
+		stdoutr.Close()
+		stderrr.Close()
 		return err
 	}
+	s.stdout.start(stdoutr)
+	s.stderr.start(stderrr)
 	s.proc = p
+	s.setLive(true)
+	debug.Log(debug.LevelInfo, "process started", debug.Field{Key: "pid", Value: p.Pid}, debug.Field{Key: "executable", Value: s.executable})
+	s.procKillOnExit = s.killOnExit
+	s.procDeterminism = s.deterministic
 	s.stoppedPid = p.Pid
+	// Wait for the process to stop at its exec, so that it can be examined
+	// and given breakpoints as soon as Run returns.
+	s.procIsUp = true
+	if _, err := s.waitForTrap(s.stoppedPid, false); err != nil {
+		return err
+	}
+	if err := s.ptraceSetOptions(s.stoppedPid, ptraceOTraceClone); err != nil {
+		return fmt.Errorf("ptraceSetOptions: %v", err)
+	}
+	if err := s.readLoadBias(); err != nil {
+		return err
+	}
+	unresolved, err := s.resolveBreakpoints()
+	if err != nil {
+		return err
+	}
+	resp.Status.Unresolved = unresolved
+	s.recordStop(nil)
 	return nil
 }
 
+// resetProcess forgets the state of the current process.
+func (s *Server) resetProcess() {
+	s.proc = nil
+	s.setLive(false)
+	s.procIsUp = false
+	s.stoppedPid = 0
+	s.stoppedRegs = ptraceRegs{}
+	s.selectedFrame = nil
+	s.otherThreads = nil
+	s.stoppedPending = false
+	s.trapPid = 0
+	s.topOfStackAddrs = nil
+	s.objects = nil
+	s.watchRegsSet = false
+	s.queuedWatchHits = nil
+	s.exited = nil
+	s.stopSignal = 0
+}
+
+// setExited records that the process has exited.
+func (s *Server) setExited(e *debug.ProcessExited) {
+	debug.Log(debug.LevelInfo, "process exited", debug.Field{Key: "status", Value: e})
+	s.exited = e
+	s.setLive(false)
+	s.procIsUp = false
+	s.stoppedPid = 0
+	s.stoppedRegs = ptraceRegs{}
+	s.otherThreads = nil
+	s.stoppedPending = false
+	s.trapPid = 0
+	s.watchRegsSet = false
+	s.queuedWatchHits = nil
+	s.stopSignal = 0
+}
+
+// processExited returns the error describing a process that exited with
+// the given wait status.
+func processExited(status waitStatus) *debug.ProcessExited {
+	e := &debug.ProcessExited{ExitStatus: status.ExitStatus()}
+	if status.Signaled() {
+		e.Signal = signalName(status.Signal())
+	}
+	return e
+}
+
+// checkExited reports whether the process has exited, polling for its exit
+// status if it was running.  It is used after a failed request, since a
+// process that dies underneath a ptrace request causes errors like ESRCH.
+func (s *Server) checkExited() bool {
+	if s.exited != nil {
+		return true
+	}
+	if s.proc == nil || !s.procIsUp {
+		return false
+	}
+	// A process whose threads we trace doesn't report its own exit until
+	// its other threads' exits have been waited for.
+	if tids, err := threadIDs(s.proc.Pid); err == nil {
+		for _, tid := range tids {
+			if tid != s.proc.Pid && threadExited(s.proc.Pid, tid) {
+				s.waitNoHang(tid)
+			}
+		}
+	}
+	wpid, status, err := s.waitNoHang(s.proc.Pid)
+	if err == syscall.ECHILD {
+		// The process has already been reaped, so its status is unknown.
+		s.setExited(&debug.ProcessExited{ExitStatus: -1})
+		return true
+	}
+	if err != nil || wpid != s.proc.Pid || !(status.Exited() || status.Signaled()) {
+		return false
+	}
+	s.setExited(processExited(status))
+	return true
+}
+
 func (s *Server) Resume(req *protocol.ResumeRequest, resp *protocol.ResumeResponse) error {
-	return s.call(s.otherc, req, resp)
+	return s.call(s.controlc, req, resp)
 }
 
 func (s *Server) handleResume(req *protocol.ResumeRequest, resp *protocol.ResumeResponse) error {
@@ -315,82 +789,189 @@ func (s *Server) handleResume(req *protocol.ResumeRequest, resp *protocol.Resume
 	}
 
 	if !s.procIsUp {
-		s.procIsUp = true
-		if _, err := s.waitForTrap(s.stoppedPid, false); err != nil {
+		return fmt.Errorf("Resume: process is not stopped")
+	}
+	// A watchpoint triggered by another thread while the process was being
+	// stopped is reported before the process runs again, unless a signal
+	// must be delivered to the stopped thread first.
+	if s.stopSignal == 0 {
+		if queued, err := s.takeQueuedWatchpointHit(); err != nil {
 			return err
+		} else if queued {
+			s.finishStop("watchpoint", &resp.Status)
+			return nil
 		}
-		if err := s.ptraceSetOptions(s.stoppedPid, syscall.PTRACE_O_TRACECLONE); err != nil {
-			return fmt.Errorf("ptraceSetOptions: %v", err)
-		}
-	} else if _, ok := s.breakpoints[s.stoppedRegs.Rip]; ok {
-		if err := s.ptraceSingleStep(s.stoppedPid); err != nil {
-			return fmt.Errorf("ptraceSingleStep: %v", err)
-		}
-		if _, err := s.waitForTrap(s.stoppedPid, false); err != nil {
+	}
+	if _, ok := s.breakpoints[s.stoppedRegs.Rip]; ok {
+		if err := s.stepOverBreakpoint(s.stoppedRegs.Rip); err != nil {
 			return err
 		}
 	}
+	// Each thread has its own debug registers, which can only be loaded
+	// while it is stopped.
+	if err := s.setWatchpoints(); err != nil {
+		return err
+	}
+	if err := s.resumeOtherThreads(); err != nil {
+		return err
+	}
 
+	// A signal the process stopped for is delivered now.
+	deliver := s.stopSignal
+	s.stopSignal = 0
+	var reason string
 	for {
 		if err := s.setBreakpoints(); err != nil {
 			return err
 		}
-		if err := s.ptraceCont(s.stoppedPid, 0); err != nil {
+		if err := s.ptraceCont(s.stoppedPid, int(deliver)); err != nil {
 			return fmt.Errorf("ptraceCont: %v", err)
 		}
+		deliver = 0
+		s.newThread = 0
 
 		wpid, err := s.waitForTrap(-1, true)
 		if err == nil {
 			s.stoppedPid = wpid
-			break
+			var atBreakpoint bool
+			reason, atBreakpoint, err = s.trapped()
+			if err != nil {
+				return err
+			}
+			if reason != "" {
+				break
+			}
+			// A breakpoint or watchpoint whose condition isn't met; carry
+			// on past it.  A return probe for tracing calls may have been
+			// removed, leaving nothing to step past.
+			if _, ok := s.breakpoints[s.stoppedRegs.Rip]; atBreakpoint && ok {
+				if err := s.stepPastCondition(); err != nil {
+					return err
+				}
+			}
+			continue
 		}
 		bce, ok := err.(*breakpointsChangedError)
 		if !ok {
 			return err
 		}
 
-		if err := syscall.Kill(s.stoppedPid, syscall.SIGSTOP); err != nil {
+		if err := kill(s.stoppedPid, sigstop); err != nil {
 			return fmt.Errorf("kill(SIGSTOP): %v", err)
 		}
 		_, status, err := s.wait(s.stoppedPid, false)
 		if err != nil {
 			return fmt.Errorf("wait (after SIGSTOP): %v", err)
 		}
-		if !status.Stopped() || status.StopSignal() != syscall.SIGSTOP {
+		if !status.Stopped() || status.StopSignal() != sigstop {
 			return fmt.Errorf("wait (after SIGSTOP): unexpected wait status 0x%x", status)
 		}
 
-		if err := s.liftBreakpoints(); err != nil {
-			return err
-		}
-
+		interrupted := false
 	loop:
 		for c := bce.call; ; {
-			s.dispatch(c)
+			if _, ok := c.req.(*protocol.InterruptRequest); ok {
+				interrupted = true
+				c.errc <- nil
+			} else {
+				s.dispatch(c)
+			}
 			select {
 			case c = <-s.breakpointc:
 			default:
 				break loop
 			}
 		}
+		if interrupted {
+			// Leave the thread stopped; the SIGSTOP isn't delivered when
+			// it is continued.
+			if err := s.ptraceGetRegs(s.stoppedPid, &s.stoppedRegs); err != nil {
+				return fmt.Errorf("ptraceGetRegs: %v", err)
+			}
+			reason = "interrupt"
+			break
+		}
 	}
-	if err := s.liftBreakpoints(); err != nil {
+	if err := s.stopOtherThreads(); err != nil {
 		return err
 	}
+	s.finishStop(reason, &resp.Status)
+	return nil
+}
 
+// finishStop fills in status for the stop the process has made, with all its
+// threads stopped, for reason, and records the stop.
+func (s *Server) finishStop(reason string, status *debug.Status) {
+	s.recordHistories()
+	status.PC = s.stoppedRegs.Rip
+	status.SP = s.stoppedRegs.Rsp
+	status.Thread = s.stoppedPid
+	status.Goroutine = s.stoppedGoroutine()
+	status.Reason = reason
+	switch reason {
+	case "breakpoint":
+		status.Breakpoints = s.hitBreakpoints
+	case "watchpoint":
+		status.Watchpoints = s.hitWatchpoints
+	case "thread":
+		status.NewThread = s.newThread
+	}
+	if s.stopSignal != 0 {
+		status.Signal = signalName(s.stopSignal)
+		status.SignalNumber = int(s.stopSignal)
+	}
+	s.fatalStatus(status)
+	status.Commands = s.commandResults
+	s.commandResults = nil
+	s.recordStop(status)
+}
+
+// trapped loads the registers of the thread that just stopped with a trap,
+// or with a signal whose policy is to stop, and returns why the program
+// should stop there, or "" if it shouldn't, which is when the thread is at a
+// breakpoint none of whose conditions are met, or has triggered only
+// watchpoints whose conditions aren't met.  atBreakpoint reports whether the
+// thread is at a breakpoint, which it must step past to carry on.
+func (s *Server) trapped() (reason string, atBreakpoint bool, err error) {
+	s.commandResults = nil
+	s.hitBreakpoints = nil
+	s.hitWatchpoints = nil
 	if err := s.ptraceGetRegs(s.stoppedPid, &s.stoppedRegs); err != nil {
-		return fmt.Errorf("ptraceGetRegs: %v", err)
+		return "", false, fmt.Errorf("ptraceGetRegs: %v", err)
 	}
-
+	if s.stopSignal != 0 {
+		return "signal", false, nil
+	}
+	if s.newThread != 0 {
+		return "thread", false, nil
+	}
+	if watched, stop, err := s.watchpointHit(); err != nil {
+		return "", false, err
+	} else if stop {
+		return "watchpoint", false, nil
+	} else if watched {
+		return "", false, nil
+	}
+	// The thread stopped after executing a breakpoint instruction; back up
+	// the PC so it points at the breakpoint.
 	s.stoppedRegs.Rip -= uint64(s.arch.BreakpointSize)
-
 	if err := s.ptraceSetRegs(s.stoppedPid, &s.stoppedRegs); err != nil {
-		return fmt.Errorf("ptraceSetRegs: %v", err)
+		return "", false, fmt.Errorf("ptraceSetRegs: %v", err)
 	}
-
-	resp.Status.PC = s.stoppedRegs.Rip
-	resp.Status.SP = s.stoppedRegs.Rsp
-	return nil
+	if _, ok := s.breakpoints[s.stoppedRegs.Rip]; !ok {
+		return "trap", false, nil
+	}
+	hit, err := s.breakpointHit(s.stoppedRegs.Rip)
+	if err != nil {
+		return "", true, err
+	}
+	if hit {
+		return "breakpoint", true, nil
+	}
+	if _, ok := s.panicStops[s.stoppedRegs.Rip]; ok {
+		return "panic", true, nil
+	}
+	return "", true, nil
 }
 
 func (s *Server) waitForTrap(pid int, allowBreakpointsChange bool) (wpid int, err error) {
@@ -402,13 +983,41 @@ func (s *Server) waitForTrap(pid int, allowBreakpointsChange bool) (wpid int, er
 			}
 			return 0, err
 		}
-		if status.StopSignal() == syscall.SIGTRAP && status.TrapCause() != syscall.PTRACE_EVENT_CLONE {
-			return wpid, nil
+		if status.Exited() || status.Signaled() {
+			if wpid == s.proc.Pid {
+				s.setExited(processExited(status))
+				return 0, s.exited
+			}
+			// Another thread exited; there's nothing to continue.
+			continue
 		}
-		if status.StopSignal() == syscall.SIGPROF {
-			err = s.ptraceCont(wpid, int(syscall.SIGPROF))
+		sig := status.StopSignal()
+		if sig == syscall.SIGTRAP {
+			if status.TrapCause() != ptraceEventClone {
+				return wpid, nil
+			}
+			if s.threadStops {
+				tid, err := s.ptraceGetEventMsg(wpid)
+				if err != nil {
+					return 0, fmt.Errorf("ptraceGetEventMsg: %v", err)
+				}
+				s.newThread = int(tid)
+				return wpid, nil
+			}
+			// A new thread; it starts stopped, and is continued when seen.
+			err = s.ptraceCont(wpid, 0)
+		} else if s.signalPolicy(sig) == debug.SignalStop {
+			s.stopSignal = sig
+			return wpid, nil
 		} else {
-			err = s.ptraceCont(wpid, 0) // TODO: non-zero when wait catches other signals?
+			if sig == sigstop {
+				// Perhaps a new thread's first stop.
+				if err := s.watchNewThread(wpid); err != nil {
+					return 0, err
+				}
+			}
+			s.signalReceived(wpid, sig)
+			err = s.ptraceCont(wpid, s.signalToDeliver(sig))
 		}
 		if err != nil {
 			return 0, fmt.Errorf("ptraceCont: %v", err)
@@ -421,7 +1030,7 @@ func (s *Server) Breakpoint(req *protocol.BreakpointRequest, resp *protocol.Brea
 }
 
 func (s *Server) handleBreakpoint(req *protocol.BreakpointRequest, resp *protocol.BreakpointResponse) error {
-	return s.addBreakpoints([]uint64{req.Address}, resp)
+	return s.addBreakpoint(s.addressSpec(req.Address), resp)
 }
 
 func (s *Server) BreakpointAtFunction(req *protocol.BreakpointAtFunctionRequest, resp *protocol.BreakpointResponse) error {
@@ -429,11 +1038,43 @@ func (s *Server) BreakpointAtFunction(req *protocol.BreakpointAtFunctionRequest,
 }
 
 func (s *Server) handleBreakpointAtFunction(req *protocol.BreakpointAtFunctionRequest, resp *protocol.BreakpointResponse) error {
-	pc, err := s.functionStartAddress(req.Function)
-	if err != nil {
-		return err
+	return s.addBreakpoint(breakpointSpec{kind: "function", name: req.Function, pending: req.Pending}, resp)
+}
+
+// functionBreakpointPCs returns the addresses of a breakpoint at the start of
+// the named function.
+func (s *Server) functionBreakpointPCs(function string) ([]uint64, error) {
+	// A generic function's breakpoint is in all its instantiations.
+	names := s.instantiations(function)
+	if names == nil {
+		names = []string{function}
+	}
+	var (
+		pcs, inlined []uint64
+		err          error
+	)
+	for _, name := range names {
+		var pc uint64
+		if pc, err = s.functionStartAddress(name); err == nil {
+			pcs = append(pcs, pc)
+		}
+		inlined = append(inlined, s.inlinedEntryPCs(name)...)
+	}
+	if len(pcs) == 0 && len(inlined) == 0 {
+		// Not a Go function of the executable; perhaps a C function
+		// without debugging information, or a function of a plugin.
+		pc, cerr := s.cFunctionAddress(function)
+		if cerr == nil {
+			pcs = append(pcs, pc)
+		} else if !strings.Contains(function, ".") {
+			err = cerr
+		}
+	}
+	if len(pcs) == 0 && len(inlined) == 0 {
+		return nil, err
 	}
-	return s.addBreakpoints([]uint64{pc}, resp)
+	// If pcs is empty, the function was inlined everywhere it is called.
+	return append(pcs, inlined...), nil
 }
 
 func (s *Server) BreakpointAtLine(req *protocol.BreakpointAtLineRequest, resp *protocol.BreakpointResponse) error {
@@ -441,18 +1082,80 @@ func (s *Server) BreakpointAtLine(req *protocol.BreakpointAtLineRequest, resp *p
 }
 
 func (s *Server) handleBreakpointAtLine(req *protocol.BreakpointAtLineRequest, resp *protocol.BreakpointResponse) error {
-	if s.dwarfData == nil {
-		return fmt.Errorf("no DWARF data")
+	return s.addBreakpoint(breakpointSpec{kind: "line", name: req.File, line: req.Line}, resp)
+}
+
+func (s *Server) BreakpointAtPackageInit(req *protocol.BreakpointAtPackageInitRequest, resp *protocol.BreakpointResponse) error {
+	return s.call(s.breakpointc, req, resp)
+}
+
+func (s *Server) handleBreakpointAtPackageInit(req *protocol.BreakpointAtPackageInitRequest, resp *protocol.BreakpointResponse) error {
+	return s.addBreakpoint(breakpointSpec{kind: "init", name: req.Package}, resp)
+}
+
+// addBreakpoint adds a breakpoint at the addresses spec gives, then stores a
+// description of it in the response.
+func (s *Server) addBreakpoint(spec breakpointSpec, resp *protocol.BreakpointResponse) error {
+	if err := s.checkBreakpointQuota(); err != nil {
+		return err
 	}
-	if pcs, err := s.dwarfData.LineToBreakpointPCs(req.File, req.Line); err != nil {
+	pcs, err := s.breakpointPCs(spec)
+	if err != nil && !spec.pending {
 		return err
+	}
+	if err := s.insertBreakpointPCs(pcs); err != nil {
+		return err
+	}
+	s.nextBreakpointID++
+	bp := &debug.Breakpoint{
+		ID:      s.nextBreakpointID,
+		Enabled: true,
+	}
+	if err != nil {
+		bp.Function = spec.name
+		bp.Err = err.Error()
+		bp.Pending = true
 	} else {
-		return s.addBreakpoints(pcs, resp)
+		s.setBreakpointPCs(bp, pcs)
+	}
+	s.userBreakpoints[bp.ID] = bp
+	s.breakpointSpecs[bp.ID] = spec
+	resp.Breakpoint = *bp
+	return nil
+}
+
+// setBreakpointPCs sets the addresses of bp, and its description of them.
+func (s *Server) setBreakpointPCs(bp *debug.Breakpoint, pcs []uint64) {
+	bp.PCs = pcs
+	bp.Locations = nil
+	for _, pc := range pcs {
+		bp.Locations = append(bp.Locations, s.breakpointLocation(pc))
+	}
+	if len(pcs) > 0 {
+		bp.File, bp.Line, _ = s.lookupSource(pcs[0])
+		bp.Function = bp.Locations[0].Function
 	}
+	bp.Err = ""
+	bp.Pending = false
 }
 
-// addBreakpoints adds breakpoints at the addresses in pcs, then stores pcs in the response.
-func (s *Server) addBreakpoints(pcs []uint64, resp *protocol.BreakpointResponse) error {
+// breakpointLocation describes the breakpoint address pc: the function whose
+// code is there, and if that code was inlined, the function it is in.
+func (s *Server) breakpointLocation(pc uint64) debug.BreakpointLocation {
+	loc := debug.BreakpointLocation{PC: pc}
+	loc.Function, _, _ = s.pcToFunctionName(pc)
+	if calls := s.inlinedCallsAt(pc); len(calls) > 0 {
+		loc.InlinedInto = loc.Function
+		loc.Function = calls[0].Function
+	}
+	loc.Function = dwarf.DemangleShapes(loc.Function)
+	loc.InlinedInto = dwarf.DemangleShapes(loc.InlinedInto)
+	return loc
+}
+
+// insertBreakpointPCs adds breakpoint instructions at the addresses in pcs
+// that don't already have one.
+func (s *Server) insertBreakpointPCs(pcs []uint64) error {
 	// Get the original code at each address with ptracePeek.
 	bps := make([]breakpoint, 0, len(pcs))
 	for _, pc := range pcs {
@@ -470,36 +1173,123 @@ func (s *Server) addBreakpoints(pcs []uint64, resp *protocol.BreakpointResponse)
 	for _, bp := range bps {
 		s.breakpoints[bp.pc] = bp
 	}
-	resp.PCs = pcs
 	return nil
 }
 
+// removeUnusedBreakpointPCs removes the breakpoint instructions at the
+// addresses in pcs that no enabled breakpoint uses any more.
+func (s *Server) removeUnusedBreakpointPCs(pcs []uint64) error {
+	for _, pc := range pcs {
+		bp, ok := s.breakpoints[pc]
+		if !ok || s.breakpointPCInUse(pc) {
+			continue
+		}
+		if s.procIsUp {
+			// Breakpoints stay in the process's memory while it is stopped.
+			if err := s.ptracePoke(s.stoppedPid, uintptr(pc), bp.origInstr[:s.arch.BreakpointSize]); err != nil {
+				return fmt.Errorf("ptracePoke: %v", err)
+			}
+		}
+		delete(s.breakpoints, pc)
+	}
+	return nil
+}
+
+// breakpointPCInUse reports whether an enabled breakpoint, a probe for
+// tracing calls, a panic stop or the load stop is at pc.
+func (s *Server) breakpointPCInUse(pc uint64) bool {
+	if s.calls.probes(pc) || pc == s.loadStop {
+		return true
+	}
+	if _, ok := s.panicStops[pc]; ok {
+		return true
+	}
+	for _, bp := range s.userBreakpoints {
+		if !bp.Enabled {
+			continue
+		}
+		for _, p := range bp.PCs {
+			if p == pc {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (s *Server) DeleteBreakpoints(req *protocol.DeleteBreakpointsRequest, resp *protocol.DeleteBreakpointsResponse) error {
 	return s.call(s.breakpointc, req, resp)
 }
 
 func (s *Server) handleDeleteBreakpoints(req *protocol.DeleteBreakpointsRequest, resp *protocol.DeleteBreakpointsResponse) error {
-	for _, pc := range req.PCs {
-		delete(s.breakpoints, pc)
+	return s.deleteBreakpoints(req.IDs)
+}
+
+// deleteBreakpoints removes the breakpoints with the given IDs, and the
+// breakpoint instructions no other breakpoint uses.
+func (s *Server) deleteBreakpoints(ids []uint64) error {
+	for _, id := range ids {
+		bp, ok := s.userBreakpoints[id]
+		if !ok {
+			continue
+		}
+		delete(s.userBreakpoints, id)
+		delete(s.breakpointSpecs, id)
+		delete(s.callerEntries, id)
+		if err := s.removeUnusedBreakpointPCs(bp.PCs); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-func (s *Server) setBreakpoints() error {
-	for pc := range s.breakpoints {
-		err := s.ptracePoke(s.stoppedPid, uintptr(pc), s.arch.BreakpointInstr[:s.arch.BreakpointSize])
-		if err != nil {
-			return fmt.Errorf("setBreakpoints: %v", err)
+func (s *Server) EnableBreakpoint(req *protocol.EnableBreakpointRequest, resp *protocol.EnableBreakpointResponse) error {
+	return s.call(s.breakpointc, req, resp)
+}
+
+func (s *Server) handleEnableBreakpoint(req *protocol.EnableBreakpointRequest, resp *protocol.EnableBreakpointResponse) error {
+	bp, ok := s.userBreakpoints[req.ID]
+	if !ok {
+		return fmt.Errorf("no breakpoint with ID %d", req.ID)
+	}
+	if bp.Enabled == req.Enabled {
+		return nil
+	}
+	if req.Enabled {
+		if err := s.insertBreakpointPCs(bp.PCs); err != nil {
+			return err
 		}
+		bp.Enabled = true
+		return nil
+	}
+	bp.Enabled = false
+	return s.removeUnusedBreakpointPCs(bp.PCs)
+}
+
+func (s *Server) ListBreakpoints(req *protocol.ListBreakpointsRequest, resp *protocol.ListBreakpointsResponse) error {
+	return s.call(s.otherc, req, resp)
+}
+
+func (s *Server) handleListBreakpoints(req *protocol.ListBreakpointsRequest, resp *protocol.ListBreakpointsResponse) error {
+	resp.Breakpoints = make([]debug.Breakpoint, 0, len(s.userBreakpoints))
+	for _, bp := range s.userBreakpoints {
+		resp.Breakpoints = append(resp.Breakpoints, *bp)
 	}
+	sort.Sort(breakpointsByID(resp.Breakpoints))
 	return nil
 }
 
-func (s *Server) liftBreakpoints() error {
-	for pc, breakpoint := range s.breakpoints {
-		err := s.ptracePoke(s.stoppedPid, uintptr(pc), breakpoint.origInstr[:s.arch.BreakpointSize])
+type breakpointsByID []debug.Breakpoint
+
+func (b breakpointsByID) Len() int           { return len(b) }
+func (b breakpointsByID) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b breakpointsByID) Less(i, j int) bool { return b[i].ID < b[j].ID }
+
+func (s *Server) setBreakpoints() error {
+	for pc := range s.breakpoints {
+		err := s.ptracePoke(s.stoppedPid, uintptr(pc), s.arch.BreakpointInstr[:s.arch.BreakpointSize])
 		if err != nil {
-			return fmt.Errorf("liftBreakpoints: %v", err)
+			return fmt.Errorf("setBreakpoints: %v", err)
 		}
 	}
 	return nil
@@ -510,13 +1300,13 @@ func (s *Server) Eval(req *protocol.EvalRequest, resp *protocol.EvalResponse) er
 }
 
 func (s *Server) handleEval(req *protocol.EvalRequest, resp *protocol.EvalResponse) (err error) {
-	resp.Result, err = s.eval(req.Expr)
+	resp.Result, err = s.eval(req.Expr, req.Format)
 	return err
 }
 
-// eval evaluates an expression.
+// eval evaluates an expression, formatting values as opts says.
 // TODO: very weak.
-func (s *Server) eval(expr string) ([]string, error) {
+func (s *Server) eval(expr string, opts debug.FormatOptions) ([]string, error) {
 	switch {
 	case strings.HasPrefix(expr, "re:"):
 		// Regular expression. Return list of symbols.
@@ -536,6 +1326,8 @@ func (s *Server) eval(expr string) ([]string, error) {
 
 	case strings.HasPrefix(expr, "val:"):
 		// Symbol lookup. Return formatted value.
+		s.printer.SetOptions(opts)
+		defer s.printer.SetOptions(debug.FormatOptions{})
 		value, err := s.printer.Sprint(expr[4:])
 		if err != nil {
 			return nil, err
@@ -560,7 +1352,7 @@ func (s *Server) eval(expr string) ([]string, error) {
 		if err != nil {
 			return nil, err
 		}
-		entry, _, err := s.dwarfData.PCToFunction(addr)
+		entry, _, err := s.pcToFunction(addr)
 		if err != nil {
 			return nil, err
 		}
@@ -579,17 +1371,29 @@ func (s *Server) Evaluate(req *protocol.EvaluateRequest, resp *protocol.Evaluate
 }
 
 func (s *Server) handleEvaluate(req *protocol.EvaluateRequest, resp *protocol.EvaluateResponse) (err error) {
-	resp.Result, err = s.evalExpression(req.Expression, s.stoppedRegs.Rip, s.stoppedRegs.Rsp)
+	pc, sp := s.evalFrame()
+	resp.Result, resp.Type, err = s.evalExpression(req.Expression, pc, sp)
+	if ee, ok := err.(*debug.ExpressionError); ok {
+		// Returned in the response, so that it keeps its type over RPC.
+		resp.Err = ee
+		return nil
+	}
+	if err == nil {
+		resp.Result = s.syncValue(resp.Type.TypeID, resp.Result)
+	}
 	return err
 }
 
 func (s *Server) lookupSource(pc uint64) (file string, line uint64, err error) {
+	if o := s.objectAt(pc); o != nil {
+		return o.dwarf.PCToLine(pc - o.base)
+	}
 	if s.dwarfData == nil {
-		return
+		return s.pclnSource(pc)
 	}
 	// TODO: The gosym equivalent also returns the relevant Func. Do that when
 	// DWARF has the same facility.
-	return s.dwarfData.PCToLine(pc)
+	return s.dwarfData.PCToLine(pc - s.loadBias)
 }
 
 func (s *Server) Frames(req *protocol.FramesRequest, resp *protocol.FramesResponse) error {
@@ -604,39 +1408,151 @@ func (s *Server) handleFrames(req *protocol.FramesRequest, resp *protocol.Frames
 		}
 	}
 
-	regs := syscall.PtraceRegs{}
+	regs := ptraceRegs{}
 	err := s.ptraceGetRegs(s.stoppedPid, &regs)
 	if err != nil {
 		return err
 	}
-	resp.Frames, err = s.walkStack(regs.Rip, regs.Rsp, req.Count)
+	resp.Frames, err = s.walkStack(regs.Rip, regs.Rsp, regs.Rbp, req.Count)
+	if len(resp.Frames) > req.Count {
+		resp.Frames = resp.Frames[:req.Count]
+	}
 	return err
 }
 
-// walkStack returns up to the requested number of stack frames.
-func (s *Server) walkStack(pc, sp uint64, count int) ([]debug.Frame, error) {
+func (s *Server) LocalVariables(req *protocol.LocalVariablesRequest, resp *protocol.LocalVariablesResponse) error {
+	return s.call(s.otherc, req, resp)
+}
+
+func (s *Server) handleLocalVariables(req *protocol.LocalVariablesRequest, resp *protocol.LocalVariablesResponse) error {
+	if req.FrameIndex < 0 {
+		return fmt.Errorf("LocalVariables: invalid frame index %d", req.FrameIndex)
+	}
+	regs := ptraceRegs{}
+	err := s.ptraceGetRegs(s.stoppedPid, &regs)
+	if err != nil {
+		return err
+	}
+	if req.FrameIndex == 0 && len(s.inlinedCallsAt(regs.Rip)) == 0 {
+		// The stack needn't be walked for the frame the program is stopped
+		// in, unless it has frames for inlined calls.
+		entry, _, err := s.pcToFunction(regs.Rip)
+		if err != nil {
+			return err
+		}
+		fpOffset, err := s.pcToSPOffset(regs.Rip)
+		if err != nil {
+			return err
+		}
+		_, resp.Vars, err = s.frameVariables(entry, regs.Rip, regs.Rsp+uint64(fpOffset), false)
+		return err
+	}
+
+	if s.topOfStackAddrs == nil {
+		if err := s.evaluateTopOfStackAddrs(); err != nil {
+			return err
+		}
+	}
+	frames, err := s.walkStack(regs.Rip, regs.Rsp, regs.Rbp, req.FrameIndex+1)
+	if len(frames) <= req.FrameIndex {
+		if err == nil {
+			err = fmt.Errorf("LocalVariables: the stack has only %d frames", len(frames))
+		}
+		return err
+	}
+	resp.Vars = frames[req.FrameIndex].Vars
+	return nil
+}
+
+// walkStack returns the frames of up to count functions on the stack, and
+// before each the frames of the calls inlined into it, so there can be more
+// than count frames.  The innermost frame's program counter, stack pointer
+// and frame pointer registers are pc, sp and bp.  bp is only needed for
+// unwinding the frames of foreign code, such as C code a cgo program calls,
+// so it can be zero for a goroutine's saved stack.
+func (s *Server) walkStack(pc, sp, bp uint64, count int) ([]debug.Frame, error) {
+	if s.dwarfData == nil {
+		return s.walkStackPCLN(pc, sp, count)
+	}
 	var frames []debug.Frame
 
 	var buf [8]byte
 	b := new(bytes.Buffer)
-	r := s.dwarfData.Reader()
+
+	// Go functions with frames save the caller's frame pointer just below
+	// the return address, at bpAt, which is only read for foreign frames.
+	var bpAt uint64
+	// cgoReturn is set after unwinding foreign frames, from which the C code
+	// returns to runtime.asmcgocall on the system stack.
+	cgoReturn := false
 
 	// TODO: handle walking over a split stack.
 	for i := 0; i < count; i++ {
 		b.Reset()
-		file, line, err := s.dwarfData.PCToLine(pc)
+		if frame, fpOffset, ok := s.objectFrame(pc, sp, i > 0); ok {
+			// Go code in a shared object, such as a plugin.
+			frames = append(frames, frame)
+			fp := sp + uint64(fpOffset)
+			callerPC, err := s.peekPtr(fp - uint64(s.arch.PointerSize))
+			if err != nil {
+				return frames, err
+			}
+			if fpOffset > int64(s.arch.PointerSize) {
+				bpAt = fp - 2*uint64(s.arch.PointerSize)
+			}
+			pc, sp = callerPC, fp
+			cgoReturn = false
+			continue
+		}
+		fpOffset, err := s.pcToSPOffset(pc)
 		if err != nil {
-			return frames, err
+			// Perhaps foreign code, which has no Go frame information.
+			if bpAt != 0 {
+				if bp, err = s.peekPtr(bpAt); err != nil {
+					return frames, err
+				}
+				bpAt = 0
+			}
+			frame, callerPC, callerSP, callerBP, ferr := s.foreignFrame(pc, sp, bp, i > 0)
+			if ferr != nil {
+				if i == 0 {
+					return frames, ferr
+				}
+				return frames, fmt.Errorf("unwinding at %#x: %v", pc, ferr)
+			}
+			frames = append(frames, frame)
+			if callerPC == 0 {
+				break
+			}
+			pc, sp, bp = callerPC, callerSP, callerBP
+			cgoReturn = true
+			continue
 		}
-		fpOffset, err := s.dwarfData.PCToSPOffset(pc)
+		// A caller's PC is the return address, which can be the start of
+		// the next line, or past the end of the inlined code containing the
+		// call, so the call's location is looked up from the byte before.
+		linePC := pc
+		if i > 0 {
+			linePC--
+		}
+		file, line, err := s.lookupSource(linePC)
 		if err != nil {
 			return frames, err
 		}
-		fp := sp + uint64(fpOffset)
-		entry, funcEntry, err := s.dwarfData.PCToFunction(pc)
+		entry, funcEntry, err := s.pcToFunction(pc)
 		if err != nil {
 			return frames, err
 		}
+		if cgoReturn && entry.Val(dwarf.AttrName) == "runtime.asmcgocall" {
+			// Back from C code, on the system stack.  Its frame, as
+			// the Go frame information describes it, and the rest
+			// of the frames are on the goroutine's stack.
+			if sp, err = s.cgoCallerSP(sp); err != nil {
+				return frames, err
+			}
+		}
+		cgoReturn = false
+		fp := sp + uint64(fpOffset)
 		frame := debug.Frame{
 			PC:            pc,
 			SP:            sp,
@@ -645,27 +1561,13 @@ func (s *Server) walkStack(pc, sp uint64, count int) ([]debug.Frame, error) {
 			FunctionStart: funcEntry,
 		}
 		frame.Function, _ = entry.Val(dwarf.AttrName).(string)
-		r.Seek(entry.Offset)
-		for {
-			entry, err := r.Next()
-			if err != nil {
-				return frames, err
-			}
-			if entry.Tag == 0 {
-				break
-			}
-			// TODO: report variables we couldn't parse?
-			if entry.Tag == dwarf.TagFormalParameter {
-				if v, err := s.parseParameterOrLocal(entry, fp); err == nil {
-					frame.Params = append(frame.Params, debug.Param(v))
-				}
-			}
-			if entry.Tag == dwarf.TagVariable {
-				if v, err := s.parseParameterOrLocal(entry, fp); err == nil {
-					frame.Vars = append(frame.Vars, v)
-				}
-			}
+		frame.Kind = frameKind(frame.Function)
+		frame.Function = dwarf.DemangleShapes(frame.Function)
+		frame.Params, frame.Vars, err = s.frameVariables(entry, pc, fp, i > 0)
+		if err != nil {
+			return frames, err
 		}
+		frames = append(frames, s.inlinedFrames(&frame, entry, fp, i > 0)...)
 		frames = append(frames, frame)
 
 		// Walk to the caller's PC and SP.
@@ -676,15 +1578,158 @@ func (s *Server) walkStack(pc, sp uint64, count int) ([]debug.Frame, error) {
 		if err != nil {
 			return frames, fmt.Errorf("ptracePeek: %v", err)
 		}
+		if fpOffset > int64(s.arch.PointerSize) {
+			bpAt = fp - 2*uint64(s.arch.PointerSize)
+		}
 		pc, sp = s.arch.Uintptr(buf[:s.arch.PointerSize]), fp
 	}
 	return frames, nil
 }
 
+// frameVariables returns the parameters and the local variables in scope of
+// the frame of the function with the given entry, whose program counter and
+// frame pointer are pc and fp.  caller says whether the frame is a caller's,
+// whose pc is the return address from a call.
+func (s *Server) frameVariables(funcEntry *dwarf.Entry, pc, fp uint64, caller bool) ([]debug.Param, []debug.LocalVar, error) {
+	return s.scopeVariables(funcEntry, funcEntry, pc, fp, caller)
+}
+
+// scopeVariables is like frameVariables, but returns the parameters and
+// local variables of scope, which is the function's entry or the entry of
+// a call inlined into it.
+func (s *Server) scopeVariables(funcEntry, scope *dwarf.Entry, pc, fp uint64, caller bool) ([]debug.Param, []debug.LocalVar, error) {
+	// A return address can be just past the end of the block containing the
+	// call.
+	scopePC := pc
+	if caller {
+		scopePC--
+	}
+	entries, err := s.scopeEntries(scope, scopePC)
+	if err != nil {
+		return nil, nil, err
+	}
+	entries, names := s.listedVariables(entries)
+	var params []debug.Param
+	var vars []debug.LocalVar
+	for i, entry := range entries {
+		// TODO: report variables we couldn't parse?
+		v, err := s.parseParameterOrLocal(funcEntry, entry, pc, fp)
+		if err != nil {
+			continue
+		}
+		v.Name = names[i]
+		if entry.Tag == dwarf.TagFormalParameter {
+			params = append(params, debug.Param{Name: v.Name, Var: v.Var})
+		} else {
+			vars = append(vars, v)
+		}
+	}
+	return params, vars, nil
+}
+
+// scopeEntries returns the entries for the parameters and local variables of
+// the function with the given entry which are in scope at pc.  Variables
+// declared in lexical blocks are included only if pc is within the block,
+// and those of inner blocks come after those of the blocks enclosing them.
+func (s *Server) scopeEntries(funcEntry *dwarf.Entry, pc uint64) ([]*dwarf.Entry, error) {
+	if !funcEntry.Children {
+		return nil, nil
+	}
+	pc -= s.loadBias
+	r := s.dwarfData.Reader()
+	r.Seek(funcEntry.Offset)
+	if _, err := r.Next(); err != nil {
+		return nil, err
+	}
+	var entries []*dwarf.Entry
+	for depth := 1; depth > 0; {
+		entry, err := r.Next()
+		if err != nil {
+			return entries, err
+		}
+		if entry == nil {
+			break
+		}
+		switch entry.Tag {
+		case 0:
+			depth--
+		case dwarf.TagFormalParameter, dwarf.TagVariable:
+			// Those of inlined and out-of-line copies of functions the
+			// compiler inlined have their names and types elsewhere.
+			if resolved, err := s.dwarfData.ResolveOrigin(entry); err == nil {
+				entry = resolved
+			}
+			entries = append(entries, entry)
+			r.SkipChildren()
+		case dwarf.TagLexDwarfBlock:
+			if !entry.Children {
+				break
+			}
+			ranges, err := s.dwarfData.EntryRanges(entry)
+			if err != nil {
+				return entries, err
+			}
+			if inRanges(pc, ranges) {
+				depth++
+			} else {
+				r.SkipChildren()
+			}
+		default:
+			r.SkipChildren()
+		}
+	}
+	return entries, nil
+}
+
+// inRanges reports whether pc is in one of the [low, high) ranges.
+func inRanges(pc uint64, ranges [][2]uint64) bool {
+	for _, r := range ranges {
+		if r[0] <= pc && pc < r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// cgoRuntimeFuncs are the runtime functions that pass calls between Go and C.
+var cgoRuntimeFuncs = map[string]bool{
+	"runtime.asmcgocall":    true,
+	"runtime.cgocall":       true,
+	"runtime.cgocallback":   true,
+	"runtime.cgocallbackg":  true,
+	"runtime.cgocallbackg1": true,
+}
+
+// frameKind classifies the frames of the named function, as described for
+// debug.Frame.Kind.
+func frameKind(function string) string {
+	// The package path ends at the first dot after its last slash.  Type
+	// arguments can have slashes of their own.
+	function = dwarf.GenericName(function)
+	pkg, name := "", function
+	slash := strings.LastIndex(function, "/")
+	if dot := strings.Index(function[slash+1:], "."); dot >= 0 {
+		dot += slash + 1
+		pkg, name = function[:dot], function[dot+1:]
+	}
+	switch {
+	case cgoRuntimeFuncs[function],
+		strings.HasPrefix(name, "_Cfunc_"), strings.HasPrefix(name, "_cgo"), strings.HasPrefix(name, "_Cgo"),
+		pkg == "" && (strings.HasPrefix(name, "x_cgo") || strings.HasPrefix(name, "crosscall")):
+		return "cgo"
+	case pkg == "runtime", strings.HasPrefix(pkg, "runtime/"), strings.HasPrefix(pkg, "internal/runtime/"):
+		return "runtime"
+	case pkg == "testing", strings.HasPrefix(pkg, "testing/"):
+		return "testing"
+	}
+	return ""
+}
+
 // parseParameterOrLocal parses the entry for a function parameter or local
-// variable, which are both specified the same way. fp contains the frame
-// pointer, which is used to calculate the variable location.
-func (s *Server) parseParameterOrLocal(entry *dwarf.Entry, fp uint64) (debug.LocalVar, error) {
+// variable, which are both specified the same way, of the function described
+// by funcEntry. pc and fp contain the frame's program counter and frame
+// pointer, which are used to calculate the variable location.
+func (s *Server) parseParameterOrLocal(funcEntry, entry *dwarf.Entry, pc, fp uint64) (debug.LocalVar, error) {
 	var v debug.LocalVar
 	v.Name, _ = entry.Val(dwarf.AttrName).(string)
 	if off, err := s.dwarfData.EntryTypeOffset(entry); err != nil {
@@ -692,15 +1737,11 @@ func (s *Server) parseParameterOrLocal(entry *dwarf.Entry, fp uint64) (debug.Loc
 	} else {
 		v.Var.TypeID = uint64(off)
 	}
-	if i := entry.Val(dwarf.AttrLocation); i == nil {
-		return v, fmt.Errorf("missing location description")
-	} else if locationDescription, ok := i.([]uint8); !ok {
-		return v, fmt.Errorf("unsupported location description")
-	} else if offset, err := evalLocation(locationDescription); err != nil {
+	addr, err := s.localAddress(funcEntry, entry, pc, fp)
+	if err != nil {
 		return v, err
-	} else {
-		v.Var.Address = fp + uint64(offset)
 	}
+	v.Var.Address = addr
 	return v, nil
 }
 
@@ -710,7 +1751,17 @@ func (s *Server) evaluateTopOfStackAddrs() error {
 		indirect bool
 		names    []string
 	)
-	if _, err := s.dwarfData.LookupVariable("runtime.rt0_goPC"); err != nil {
+	if s.dwarfData == nil {
+		// The pclntab has the functions, but not the variables holding
+		// their addresses.
+		lookup, indirect, names = s.functionStartAddress, false, []string{
+			"runtime.goexit",
+			"runtime.mstart",
+			"runtime.mcall",
+			"runtime.morestack",
+			"runtime.rt0_go",
+		}
+	} else if _, err := s.dwarfData.LookupVariable("runtime.rt0_goPC"); err != nil {
 		// Look for a Go 1.3 binary (or earlier version).
 		lookup, indirect, names = s.functionStartAddress, false, []string{
 			"runtime.goexit",
@@ -727,7 +1778,7 @@ func (s *Server) evaluateTopOfStackAddrs() error {
 			if err != nil {
 				return 0, err
 			}
-			return s.dwarfData.EntryLocation(entry)
+			return s.entryLocation(entry)
 		}
 		indirect, names = true, []string{
 			"runtime.goexitPC",
@@ -743,6 +1794,11 @@ func (s *Server) evaluateTopOfStackAddrs() error {
 	for _, name := range names {
 		addr, err := lookup(name)
 		if err != nil {
+			if !indirect {
+				// Not every runtime has all of these functions; newer
+				// ones have no lessstack.
+				continue
+			}
 			return err
 		}
 		addrs = append(addrs, addr)
@@ -782,7 +1838,7 @@ func (s *Server) handleVarByName(req *protocol.VarByNameRequest, resp *protocol.
 		return fmt.Errorf("variable %s: %s", req.Name, err)
 	}
 
-	loc, err := s.dwarfData.EntryLocation(entry)
+	loc, err := s.entryLocation(entry)
 	if err != nil {
 		return fmt.Errorf("variable %s: %s", req.Name, err)
 	}
@@ -806,8 +1862,16 @@ func (s *Server) handleValue(req *protocol.ValueRequest, resp *protocol.ValueRes
 	if err != nil {
 		return err
 	}
-	resp.Value, err = s.value(t, req.Var.Address)
-	return err
+	if err := s.checkHeapObject(req.Var.Address, uint64(t.Size())); err != nil {
+		// Returned in the response, so that it keeps its type over RPC.
+		resp.Freed = err.(*debug.ObjectFreed)
+		return nil
+	}
+	if resp.Value, err = s.value(t, req.Var.Address); err != nil {
+		return err
+	}
+	resp.Value = s.syncValue(req.Var.TypeID, resp.Value)
+	return nil
 }
 
 func (s *Server) MapElement(req *protocol.MapElementRequest, resp *protocol.MapElementResponse) error {
@@ -846,6 +1910,39 @@ func (s *Server) handleMapElement(req *protocol.MapElementRequest, resp *protoco
 	return nil
 }
 
+func (s *Server) MapElements(req *protocol.MapElementsRequest, resp *protocol.MapElementsResponse) error {
+	return s.call(s.otherc, req, resp)
+}
+
+func (s *Server) handleMapElements(req *protocol.MapElementsRequest, resp *protocol.MapElementsResponse) error {
+	t, err := s.dwarfData.Type(dwarf.Offset(req.Map.TypeID))
+	if err != nil {
+		return err
+	}
+	m, ok := t.(*dwarf.MapType)
+	if !ok {
+		return fmt.Errorf("variable is not a map")
+	}
+	if req.Count == 0 {
+		return nil
+	}
+	var index uint64
+	// fn is called for each element of the map, in the same order as for
+	// MapElement.  It collects the requested elements, and stops after them.
+	fn := func(keyAddr, valAddr uint64, keyType, valType dwarf.Type) bool {
+		index++
+		if index <= req.Start {
+			return true
+		}
+		resp.Entries = append(resp.Entries, debug.MapEntry{
+			Key:   debug.Var{TypeID: uint64(keyType.Common().Offset), Address: keyAddr},
+			Value: debug.Var{TypeID: uint64(valType.Common().Offset), Address: valAddr},
+		})
+		return uint64(len(resp.Entries)) < req.Count
+	}
+	return s.peekMapValues(m, req.Map.Address, fn)
+}
+
 func (s *Server) Goroutines(req *protocol.GoroutinesRequest, resp *protocol.GoroutinesResponse) error {
 	return s.call(s.otherc, req, resp)
 }
@@ -891,19 +1988,21 @@ var (
 	}
 )
 
-func (s *Server) handleGoroutines(req *protocol.GoroutinesRequest, resp *protocol.GoroutinesResponse) error {
+// goroutineAddrs returns the type runtime.g, and the addresses of the g
+// structs of all the goroutines, including dead ones.
+func (s *Server) goroutineAddrs() (*dwarf.StructType, []uint64, error) {
 	// Get DWARF type information for runtime.g.
 	ge, err := s.dwarfData.LookupEntry("runtime.g")
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 	t, err := s.dwarfData.Type(ge.Offset)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 	gType, ok := followTypedefs(t).(*dwarf.StructType)
 	if !ok {
-		return errors.New("runtime.g is not a struct")
+		return nil, nil, errors.New("runtime.g is not a struct")
 	}
 
 	var (
@@ -916,7 +2015,7 @@ func (s *Server) handleGoroutines(req *protocol.GoroutinesRequest, resp *protoco
 		if err != nil {
 			break
 		}
-		allgsAddr, err := s.dwarfData.EntryLocation(allgsEntry)
+		allgsAddr, err := s.entryLocation(allgsEntry)
 		if err != nil {
 			break
 		}
@@ -944,45 +2043,45 @@ func (s *Server) handleGoroutines(req *protocol.GoroutinesRequest, resp *protoco
 		// Read runtime.allg.
 		allgEntry, err := s.dwarfData.LookupVariable("runtime.allg")
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
-		allgAddr, err := s.dwarfData.EntryLocation(allgEntry)
+		allgAddr, err := s.entryLocation(allgEntry)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 		allgPtr, err = s.peekPtr(allgAddr)
 		if err != nil {
-			return fmt.Errorf("reading allg: %v", err)
+			return nil, nil, fmt.Errorf("reading allg: %v", err)
 		}
 
 		// Read runtime.allglen.
 		allglenEntry, err := s.dwarfData.LookupVariable("runtime.allglen")
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 		off, err := s.dwarfData.EntryTypeOffset(allglenEntry)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 		allglenType, err := s.dwarfData.Type(off)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
-		allglenAddr, err := s.dwarfData.EntryLocation(allglenEntry)
+		allglenAddr, err := s.entryLocation(allglenEntry)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 		switch followTypedefs(allglenType).(type) {
 		case *dwarf.UintType, *dwarf.IntType:
 			allgLen, err = s.peekUint(allglenAddr, allglenType.Common().ByteSize)
 			if err != nil {
-				return fmt.Errorf("reading allglen: %v", err)
+				return nil, nil, fmt.Errorf("reading allglen: %v", err)
 			}
 		default:
 			// Some runtimes don't specify the type for allglen.  Assume it's uint32.
 			allgLen, err = s.peekUint(allglenAddr, 4)
 			if err != nil {
-				return fmt.Errorf("reading allglen: %v", err)
+				return nil, nil, fmt.Errorf("reading allglen: %v", err)
 			}
 			if allgLen != 0 {
 				break
@@ -990,7 +2089,7 @@ func (s *Server) handleGoroutines(req *protocol.GoroutinesRequest, resp *protoco
 			// Zero?  Let's try uint64.
 			allgLen, err = s.peekUint(allglenAddr, 8)
 			if err != nil {
-				return fmt.Errorf("reading allglen: %v", err)
+				return nil, nil, fmt.Errorf("reading allglen: %v", err)
 			}
 		}
 	}
@@ -998,19 +2097,61 @@ func (s *Server) handleGoroutines(req *protocol.GoroutinesRequest, resp *protoco
 	// Initialize s.goroutineStack.
 	s.goroutineStackOnce.Do(func() { s.goroutineStackInit(gType) })
 
+	var gs []uint64
 	for i := uint64(0); i < allgLen; i++ {
 		// allg is an array of pointers to g structs.  Read allg[i].
 		g, err := s.peekPtr(allgPtr + i*uint64(s.arch.PointerSize))
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
-		gr := debug.Goroutine{}
+		gs = append(gs, g)
+	}
+	return gType, gs, nil
+}
 
-		// Read status from the field named "atomicstatus" or "status".
-		status, err := s.peekUintStructField(gType, g, "atomicstatus")
-		if err != nil {
-			status, err = s.peekUintOrIntStructField(gType, g, "status")
+// findGoroutine returns the type runtime.g and the address of the g struct
+// of the live goroutine with the given ID.
+func (s *Server) findGoroutine(id int64) (*dwarf.StructType, uint64, error) {
+	gType, gs, err := s.goroutineAddrs()
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, g := range gs {
+		if goid, err := s.peekUintOrIntStructField(gType, g, "goid"); err != nil || int64(goid) != id {
+			continue
 		}
+		// A dead g keeps the ID of the goroutine that last used it.
+		if status, err := s.goroutineStatus(gType, g); err == nil && status == 6 {
+			continue
+		}
+		return gType, g, nil
+	}
+	return nil, 0, fmt.Errorf("no goroutine with ID %d", id)
+}
+
+// goroutineStatus reads the status of the goroutine whose g struct is at g,
+// from the field named "atomicstatus" or "status".  In newer runtimes
+// atomicstatus is an atomic.Uint32, a struct holding the value.
+func (s *Server) goroutineStatus(gType *dwarf.StructType, g uint64) (uint64, error) {
+	f, err := getField(gType, "atomicstatus")
+	if err != nil {
+		return s.peekUintOrIntStructField(gType, g, "status")
+	}
+	if st, ok := followTypedefs(f.Type).(*dwarf.StructType); ok {
+		return s.peekUintStructField(st, g+uint64(f.ByteOffset), "value")
+	}
+	return s.peekUintStructField(gType, g, "atomicstatus")
+}
+
+func (s *Server) handleGoroutines(req *protocol.GoroutinesRequest, resp *protocol.GoroutinesResponse) error {
+	gType, gs, err := s.goroutineAddrs()
+	if err != nil {
+		return err
+	}
+	for _, g := range gs {
+		gr := debug.Goroutine{}
+
+		status, err := s.goroutineStatus(gType, g)
 		if err != nil {
 			return err
 		}
@@ -1045,15 +2186,16 @@ func (s *Server) handleGoroutines(req *protocol.GoroutinesRequest, resp *protoco
 			}
 		}
 
-		gr.ID, err = s.peekIntStructField(gType, g, "goid")
+		id, err := s.peekUintOrIntStructField(gType, g, "goid")
 		if err != nil {
 			return err
 		}
+		gr.ID = int64(id)
 
 		// Best-effort attempt to get the names of the goroutine function and the
 		// function that created the goroutine.  They aren't always available.
 		functionName := func(pc uint64) string {
-			entry, _, err := s.dwarfData.PCToFunction(pc)
+			entry, _, err := s.pcToFunction(pc)
 			if err != nil {
 				return ""
 			}
@@ -1066,9 +2208,11 @@ func (s *Server) handleGoroutines(req *protocol.GoroutinesRequest, resp *protoco
 		if gopc, err := s.peekUintStructField(gType, g, "gopc"); err == nil {
 			gr.Caller = functionName(gopc)
 		}
+		gr.Labels, _ = s.goroutineLabels(gType, g)
 		if gr.Status != debug.Running {
 			// TODO: running goroutines too.
 			gr.StackFrames, _ = s.goroutineStack(g)
+			s.describeParams(gr.StackFrames)
 		}
 
 		resp.Goroutines = append(resp.Goroutines, &gr)
@@ -1081,6 +2225,37 @@ func (s *Server) handleGoroutines(req *protocol.GoroutinesRequest, resp *protoco
 // determine the reason a goroutine is blocked.
 const goroutineStackFrameCount = 10
 
+// maxParamValueLen is the length at which describeParams truncates the
+// formatted value of a parameter, so that large arguments don't swamp a
+// stack dump.
+const maxParamValueLen = 64
+
+// describeParams sets the Value field of the parameters in frames to their
+// formatted values.
+func (s *Server) describeParams(frames []debug.Frame) {
+	for i := range frames {
+		for j := range frames[i].Params {
+			p := &frames[i].Params[j]
+			t, err := s.dwarfData.Type(dwarf.Offset(p.Var.TypeID))
+			if err != nil {
+				continue
+			}
+			v, err := s.printer.SprintValueAt(t, p.Var.Address)
+			if err != nil {
+				continue
+			}
+			if len(v) > maxParamValueLen {
+				n := maxParamValueLen
+				for n > 0 && !utf8.RuneStart(v[n]) {
+					n--
+				}
+				v = v[:n] + "..."
+			}
+			p.Value = v
+		}
+	}
+}
+
 // goroutineStackInit initializes s.goroutineStack.
 func (s *Server) goroutineStackInit(gType *dwarf.StructType) {
 	// If we fail to read the DWARF data needed for s.goroutineStack, calling it
@@ -1140,6 +2315,6 @@ func (s *Server) goroutineStackInit(gType *dwarf.StructType) {
 		if err != nil {
 			return nil, err
 		}
-		return s.walkStack(schedPC, schedSP, goroutineStackFrameCount)
+		return s.walkStack(schedPC, schedSP, 0, goroutineStackFrameCount)
 	}
 }
@@ -0,0 +1,119 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"golang.org/x/debug/arch"
+	"golang.org/x/debug/server/protocol"
+)
+
+func TestNewWithArch(t *testing.T) {
+	if runtime.GOARCH != "amd64" {
+		t.Skip("the test binary's architecture is detected as amd64")
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		t.Skip(err)
+	}
+	noBreakpoint := arch.AMD64
+	noBreakpoint.BreakpointSize = 0
+	tests := []struct {
+		name   string
+		choose func(*arch.Architecture) (*arch.Architecture, error)
+		want   *arch.Architecture
+		err    string
+	}{
+		{name: "detected", want: &arch.AMD64},
+		{
+			name:   "chosen",
+			choose: func(*arch.Architecture) (*arch.Architecture, error) { return &arch.X86, nil },
+			want:   &arch.X86,
+		},
+		{
+			name:   "error",
+			choose: func(*arch.Architecture) (*arch.Architecture, error) { return nil, errors.New("no such architecture") },
+			err:    "no such architecture",
+		},
+		{
+			name:   "none",
+			choose: func(*arch.Architecture) (*arch.Architecture, error) { return nil, nil },
+			err:    "unrecognized architecture",
+		},
+		{
+			name:   "invalid",
+			choose: func(*arch.Architecture) (*arch.Architecture, error) { return &noBreakpoint, nil },
+			err:    "invalid breakpoint size 0",
+		},
+	}
+	for _, tt := range tests {
+		var detected *arch.Architecture
+		choose := tt.choose
+		if choose != nil {
+			choose = func(a *arch.Architecture) (*arch.Architecture, error) {
+				detected = a
+				return tt.choose(a)
+			}
+		}
+		s, err := NewWithArch(exe, choose)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		} else if !reflect.DeepEqual(s.arch, *tt.want) {
+			t.Errorf("%s: got architecture %+v, want %+v", tt.name, s.arch, *tt.want)
+		}
+		if choose != nil && (detected == nil || !reflect.DeepEqual(*detected, arch.AMD64)) {
+			t.Errorf("%s: chooseArch was passed %+v, want amd64", tt.name, detected)
+		}
+	}
+}
+
+func TestRunForeignExecutable(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+	dir, err := ioutil.TempDir("", "foreign")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "main.go")
+	if err := ioutil.WriteFile(src, []byte(jsonTestProgram), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, goos := range []string{"windows", "darwin"} {
+		exe := filepath.Join(dir, goos)
+		cmd := exec.Command("go", "build", "-o", exe, src)
+		cmd.Env = append(os.Environ(), "GO111MODULE=off", "GOOS="+goos, "GOARCH=amd64", "CGO_ENABLED=0")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Errorf("%s: building test program: %v\n%s", goos, err, out)
+			continue
+		}
+		s, err := New(exe)
+		if err != nil {
+			t.Errorf("%s: %v", goos, err)
+			continue
+		}
+		var info protocol.BinaryInfoResponse
+		if err := s.BinaryInfo(&protocol.BinaryInfoRequest{}, &info); err != nil || info.Info.GOOS != goos {
+			t.Errorf("%s: BinaryInfo: got GOOS %q, error %v", goos, info.Info.GOOS, err)
+		}
+		if err := s.Run(&protocol.RunRequest{}, &protocol.RunResponse{}); err == nil || !strings.Contains(err.Error(), "can't run") {
+			t.Errorf("%s: Run: got error %v, want \"can't run\"", goos, err)
+		}
+	}
+}
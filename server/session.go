@@ -0,0 +1,47 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Identifying the server's session, so that a client which loses its
+// connection can reconnect to the same process.
+
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// newSessionID returns a random session ID.
+func newSessionID() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		// Reconnecting needs only uniqueness, not secrecy.
+		return fmt.Sprintf("%016x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// SessionID returns the server's session ID, a string of hexadecimal digits
+// which its clients are also told by Handshake, so that a client which loses
+// its connection can find the server again.
+func (s *Server) SessionID() string {
+	return s.sessionID
+}
+
+// HasProcess reports whether the server has a live process: one that was
+// started and hasn't exited, been killed, or been detached from.  Unlike
+// the Server's other methods, it answers at once even while the process runs.
+func (s *Server) HasProcess() bool {
+	s.liveMu.Lock()
+	defer s.liveMu.Unlock()
+	return s.live
+}
+
+func (s *Server) setLive(live bool) {
+	s.liveMu.Lock()
+	s.live = live
+	s.liveMu.Unlock()
+}
@@ -0,0 +1,299 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Tracking the shared objects the process loads, such as the C libraries of
+// a cgo program and Go plugins, from the list the dynamic linker keeps in
+// its rendezvous structure, and finding functions, lines and frames in
+// their code from their debugging information.
+
+package server
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/dwarf"
+	"golang.org/x/debug/elf"
+	"golang.org/x/debug/server/protocol"
+)
+
+// dtDebug is the tag of the entry in the executable's dynamic section that
+// the dynamic linker sets to the address of its rendezvous structure,
+// r_debug.
+const dtDebug = 21
+
+// rtConsistent is the value of r_debug's r_state field when the dynamic
+// linker isn't part way through loading or unloading shared objects.
+const rtConsistent = 0
+
+// maxLoadedObjects bounds the length of the dynamic linker's list of shared
+// objects, in case it is corrupt.
+const maxLoadedObjects = 10000
+
+// A loadedObject is a shared object in the dynamic linker's list of those
+// the process has loaded.
+type loadedObject struct {
+	path       string
+	base       uint64      // What to add to the addresses in the file.
+	start, end uint64      // The addresses its segments are loaded at.
+	dwarf      *dwarf.Data // Nil if it has no debugging information.
+}
+
+// loadObject reads the segments and debugging information of the shared
+// object at path, loaded at base.
+func loadObject(path string, base uint64) *loadedObject {
+	o := &loadedObject{path: path, base: base}
+	f, err := os.Open(path)
+	if err != nil {
+		return o
+	}
+	defer f.Close()
+	obj, err := elf.NewFile(f)
+	if err != nil {
+		return o
+	}
+	for _, p := range obj.Progs {
+		if p.Type != elf.PT_LOAD {
+			continue
+		}
+		if o.end == 0 || p.Vaddr+base < o.start {
+			o.start = p.Vaddr + base
+		}
+		if p.Vaddr+p.Memsz+base > o.end {
+			o.end = p.Vaddr + p.Memsz + base
+		}
+	}
+	_, o.dwarf, _ = loadExecutable(f)
+	return o
+}
+
+// fileDynamic returns the address of the dynamic section of the executable
+// f, as linked, or 0 if it has none, as a statically linked one doesn't.
+func fileDynamic(f *os.File) uint64 {
+	obj, err := elf.NewFile(f)
+	if err != nil {
+		return 0
+	}
+	for _, p := range obj.Progs {
+		if p.Type == elf.PT_DYNAMIC {
+			return p.Vaddr
+		}
+	}
+	return 0
+}
+
+// rendezvous returns the address of the dynamic linker's r_debug structure,
+// from the executable's dynamic section, or 0 if the dynamic linker hasn't
+// set it up yet.
+func (s *Server) rendezvous() (uint64, error) {
+	if s.dynamic == 0 {
+		return 0, nil
+	}
+	ps := uint64(s.arch.PointerSize)
+	a := s.dynamic + s.loadBias
+	for i := 0; i < maxLoadedObjects; i++ {
+		tag, err := s.peekPtr(a)
+		if err != nil || tag == 0 {
+			return 0, err
+		}
+		if tag == dtDebug {
+			return s.peekPtr(a + ps)
+		}
+		a += 2 * ps
+	}
+	return 0, nil
+}
+
+// readLinkMap updates s.objects from the dynamic linker's list of the shared
+// objects the process has loaded, and returns the objects that are no longer
+// loaded.  It does nothing, and reports that the list isn't consistent, if
+// the dynamic linker is part way through changing it.  Objects that are
+// still loaded keep the debugging information already read for them.
+func (s *Server) readLinkMap() (unloaded []*loadedObject, consistent bool, err error) {
+	r, err := s.rendezvous()
+	if err != nil || r == 0 {
+		return nil, false, err
+	}
+	// struct r_debug { int r_version; struct link_map *r_map;
+	//	ElfW(Addr) r_brk; enum r_state; ElfW(Addr) r_ldbase; };
+	ps := uint64(s.arch.PointerSize)
+	state, err := s.peekInt(r+3*ps, 4)
+	if err != nil || state != rtConsistent {
+		return nil, false, err
+	}
+	lm, err := s.peekPtr(r + ps)
+	if err != nil {
+		return nil, false, err
+	}
+	old := make(map[string]*loadedObject)
+	for _, o := range s.objects {
+		old[o.path] = o
+	}
+	var objs []*loadedObject
+	// struct link_map { ElfW(Addr) l_addr; char *l_name; ElfW(Dyn) *l_ld;
+	//	struct link_map *l_next, *l_prev; };
+	for i := 0; lm != 0 && i < maxLoadedObjects; i++ {
+		base, err := s.peekPtr(lm)
+		if err != nil {
+			return nil, false, err
+		}
+		name, err := s.peekPtr(lm + ps)
+		if err != nil {
+			return nil, false, err
+		}
+		// The executable has an empty name, and the vDSO one that isn't
+		// a file's.
+		if path := s.peekCString(name, 1024); strings.HasPrefix(path, "/") {
+			o, ok := old[path]
+			if ok && o.base == base {
+				delete(old, path)
+			} else {
+				o = loadObject(path, base)
+			}
+			objs = append(objs, o)
+		}
+		if lm, err = s.peekPtr(lm + 3*ps); err != nil {
+			return nil, false, err
+		}
+	}
+	s.objects = objs
+	for _, o := range old {
+		unloaded = append(unloaded, o)
+	}
+	return unloaded, true, nil
+}
+
+// unloadBreakpoints makes the breakpoints in the shared object o, which the
+// process has unloaded, pending, so that they are set again if it is
+// loaded again.
+func (s *Server) unloadBreakpoints(o *loadedObject) {
+	for _, bp := range s.userBreakpoints {
+		in := false
+		for _, pc := range bp.PCs {
+			if pc >= o.start && pc < o.end {
+				in = true
+				// The breakpoint instruction went with the object's code.
+				delete(s.breakpoints, pc)
+			}
+		}
+		if in {
+			bp.PCs, bp.Locations = nil, nil
+			bp.Err = fmt.Sprintf("%s was unloaded", o.path)
+			bp.Pending = true
+		}
+	}
+}
+
+// objectAt returns the shared object with debugging information whose code
+// is at pc, or nil if there is none.
+func (s *Server) objectAt(pc uint64) *loadedObject {
+	for _, o := range s.objects {
+		if o.dwarf != nil && pc >= o.start && pc < o.end {
+			return o
+		}
+	}
+	return nil
+}
+
+// function returns the name and start address of the function at pc, in
+// the process's addresses.
+func (o *loadedObject) function(pc uint64) (string, uint64, error) {
+	entry, funcEntry, err := o.dwarf.PCToFunction(pc - o.base)
+	if err != nil {
+		return "", 0, err
+	}
+	name, _ := entry.Val(dwarf.AttrName).(string)
+	return name, funcEntry + o.base, nil
+}
+
+// objectFunctionStart returns the start address of the named function in
+// the first shared object with debugging information that has it.
+func (s *Server) objectFunctionStart(name string) (uint64, bool) {
+	for _, o := range s.objects {
+		if o.dwarf == nil {
+			continue
+		}
+		entry, err := o.dwarf.LookupFunction(name)
+		if err != nil {
+			continue
+		}
+		if addr, ok := entry.Val(dwarf.AttrLowpc).(uint64); ok {
+			return addr + o.base, true
+		}
+	}
+	return 0, false
+}
+
+// objectLineToBreakpointPCs returns the addresses of breakpoints at the
+// given line in the shared objects with debugging information.
+func (s *Server) objectLineToBreakpointPCs(file string, line uint64) []uint64 {
+	var pcs []uint64
+	for _, o := range s.objects {
+		if o.dwarf == nil {
+			continue
+		}
+		opcs, err := o.dwarf.LineToBreakpointPCs(file, line)
+		if err != nil {
+			continue
+		}
+		for _, pc := range opcs {
+			pcs = append(pcs, pc+o.base)
+		}
+	}
+	return pcs
+}
+
+// objectFrame returns the frame of the Go code at pc in a shared object,
+// such as a plugin, whose stack pointer is sp, and the offset of its frame
+// pointer from sp, or false if pc isn't in such code.  caller says whether
+// the frame is a caller's, whose pc is the return address from a call.
+// The frame's variables aren't read, since their types are in the object's
+// debugging information rather than the executable's.
+func (s *Server) objectFrame(pc, sp uint64, caller bool) (debug.Frame, int64, bool) {
+	o := s.objectAt(pc)
+	if o == nil {
+		return debug.Frame{}, 0, false
+	}
+	fpOffset, err := o.dwarf.PCToSPOffset(pc - o.base)
+	if err != nil {
+		// Not Go code; perhaps C code, unwound as foreign code.
+		return debug.Frame{}, 0, false
+	}
+	name, funcEntry, err := o.function(pc)
+	if err != nil {
+		return debug.Frame{}, 0, false
+	}
+	linePC := pc
+	if caller {
+		linePC--
+	}
+	f := debug.Frame{
+		PC:            pc,
+		SP:            sp,
+		Function:      dwarf.DemangleShapes(name),
+		FunctionStart: funcEntry,
+		Kind:          frameKind(name),
+	}
+	f.File, f.Line, _ = o.dwarf.PCToLine(linePC - o.base)
+	return f, fpOffset, true
+}
+
+func (s *Server) SharedObjects(req *protocol.SharedObjectsRequest, resp *protocol.SharedObjectsResponse) error {
+	return s.call(s.otherc, req, resp)
+}
+
+func (s *Server) handleSharedObjects(req *protocol.SharedObjectsRequest, resp *protocol.SharedObjectsResponse) error {
+	for _, o := range s.objects {
+		resp.Objects = append(resp.Objects, debug.SharedObject{
+			Path:  o.path,
+			Base:  o.base,
+			Start: o.start,
+			End:   o.end,
+			DWARF: o.dwarf != nil,
+		})
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Deciding what to do with the signals the process receives.
+
+package server
+
+import (
+	"fmt"
+	"syscall"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/server/protocol"
+)
+
+// signalName returns the name of sig, such as "SIGSEGV".
+func signalName(sig syscall.Signal) string {
+	if name, ok := signalNames[sig]; ok {
+		return name
+	}
+	return fmt.Sprintf("signal %d", int(sig))
+}
+
+func (s *Server) SetSignalPolicy(req *protocol.SetSignalPolicyRequest, resp *protocol.SetSignalPolicyResponse) error {
+	return s.call(s.otherc, req, resp)
+}
+
+func (s *Server) handleSetSignalPolicy(req *protocol.SetSignalPolicyRequest, resp *protocol.SetSignalPolicyResponse) error {
+	var sig syscall.Signal
+	for n, name := range signalNames {
+		if name == req.Signal {
+			sig = n
+		}
+	}
+	switch sig {
+	case 0:
+		return fmt.Errorf("unknown signal %q", req.Signal)
+	case syscall.SIGTRAP, sigstop, syscall.SIGKILL:
+		// The debugger uses SIGTRAP and SIGSTOP itself, and SIGKILL can't be
+		// intercepted.
+		return fmt.Errorf("the policy for %s can't be changed", req.Signal)
+	}
+	switch req.Policy {
+	case debug.SignalPass, debug.SignalStop, debug.SignalIgnore:
+	default:
+		return fmt.Errorf("unknown signal policy %d", req.Policy)
+	}
+	s.signalPolicies[sig] = req.Policy
+	return nil
+}
+
+// signalPolicy returns what to do when the process receives sig.  Signals
+// are passed to the process unless SetSignalPolicy said otherwise, except
+// that SIGSTOPs are ignored, since they are sent by the debugger to stop
+// threads.
+func (s *Server) signalPolicy(sig syscall.Signal) debug.SignalPolicy {
+	if sig == sigstop {
+		return debug.SignalIgnore
+	}
+	return s.signalPolicies[sig]
+}
+
+// signalToDeliver returns the signal to deliver to a thread that stopped on
+// receiving sig, when continuing it: sig, or zero if it is to be ignored.
+// Signals whose policy is to stop are delivered, since threads other than
+// the one that stops the process are not held at them.
+func (s *Server) signalToDeliver(sig syscall.Signal) int {
+	if s.signalPolicy(sig) == debug.SignalIgnore {
+		return 0
+	}
+	return int(sig)
+}
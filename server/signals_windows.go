@@ -0,0 +1,35 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import "syscall"
+
+// The signals the server itself uses or passes over, which Windows doesn't
+// have, numbered as on Linux.  Only SIGSTOP is ever reported, for a thread
+// the server has stopped.
+const (
+	sigstop = syscall.Signal(0x13)
+	sigurg  = syscall.Signal(0x17)
+	sigprof = syscall.Signal(0x1b)
+)
+
+// signalNames holds the names of the signals, as used by clients.  Windows
+// exceptions are reported as the signals Go gives them.
+var signalNames = map[syscall.Signal]string{
+	syscall.SIGHUP:  "SIGHUP",
+	syscall.SIGINT:  "SIGINT",
+	syscall.SIGQUIT: "SIGQUIT",
+	syscall.SIGILL:  "SIGILL",
+	syscall.SIGTRAP: "SIGTRAP",
+	syscall.SIGABRT: "SIGABRT",
+	syscall.SIGBUS:  "SIGBUS",
+	syscall.SIGFPE:  "SIGFPE",
+	syscall.SIGKILL: "SIGKILL",
+	syscall.SIGSEGV: "SIGSEGV",
+	syscall.SIGPIPE: "SIGPIPE",
+	syscall.SIGALRM: "SIGALRM",
+	syscall.SIGTERM: "SIGTERM",
+	sigstop:         "SIGSTOP",
+}
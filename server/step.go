@@ -0,0 +1,48 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Stepping the stopped thread by one machine instruction.
+
+package server
+
+import (
+	"fmt"
+
+	"golang.org/x/debug/server/protocol"
+)
+
+func (s *Server) StepInstruction(req *protocol.StepInstructionRequest, resp *protocol.StepInstructionResponse) error {
+	return s.call(s.controlc, req, resp)
+}
+
+func (s *Server) handleStepInstruction(req *protocol.StepInstructionRequest, resp *protocol.StepInstructionResponse) error {
+	if s.proc == nil {
+		return fmt.Errorf("StepInstruction: Run did not successfully start a process")
+	}
+	if !s.procIsUp {
+		return fmt.Errorf("StepInstruction: process is not stopped")
+	}
+	// The other threads stay stopped, so only the stopped thread moves.
+	if _, ok := s.breakpoints[s.stoppedRegs.Rip]; ok {
+		if err := s.stepOverBreakpoint(s.stoppedRegs.Rip); err != nil {
+			return err
+		}
+	} else {
+		if err := s.singleStep(); err != nil {
+			return err
+		}
+		if err := s.ptraceGetRegs(s.stoppedPid, &s.stoppedRegs); err != nil {
+			return fmt.Errorf("ptraceGetRegs: %v", err)
+		}
+	}
+	s.recordHistories()
+	resp.Status.PC = s.stoppedRegs.Rip
+	resp.Status.SP = s.stoppedRegs.Rsp
+	resp.Status.Thread = s.stoppedPid
+	resp.Status.Goroutine = s.stoppedGoroutine()
+	resp.Status.Reason = "step"
+	s.fatalStatus(&resp.Status)
+	s.recordStop(&resp.Status)
+	return nil
+}
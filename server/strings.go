@@ -0,0 +1,174 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Searching the executable's read-only data for string constants.
+
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/dwarf"
+	"golang.org/x/debug/elf"
+	"golang.org/x/debug/macho"
+	"golang.org/x/debug/server/protocol"
+)
+
+const (
+	// maxStringMatches limits the number of matches FindString reports.
+	maxStringMatches = 100
+	// maxStringLookback is the furthest before a match that FindString looks
+	// for a referenced address that could be the start of the constant.
+	maxStringLookback = 4096
+)
+
+// sectionData is the contents of a section of the executable and the address
+// at which it is loaded.
+type sectionData struct {
+	addr uint64
+	data []byte
+}
+
+// codeRef is an instruction that computes the address of some data.
+type codeRef struct {
+	pc     uint64 // Address of the instruction.
+	target uint64 // Address it refers to.
+}
+
+type codeRefsByTarget []codeRef
+
+func (c codeRefsByTarget) Len() int           { return len(c) }
+func (c codeRefsByTarget) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c codeRefsByTarget) Less(i, j int) bool { return c[i].target < c[j].target }
+
+func (s *Server) FindString(req *protocol.FindStringRequest, resp *protocol.FindStringResponse) error {
+	return s.call(s.otherc, req, resp)
+}
+
+func (s *Server) handleFindString(req *protocol.FindStringRequest, resp *protocol.FindStringResponse) error {
+	if req.Substring == "" {
+		return errors.New("FindString: empty substring")
+	}
+	text, rodata, err := s.readTextAndRodata()
+	if err != nil {
+		return err
+	}
+	// Only amd64 code is decoded for references.
+	var refs []codeRef
+	if s.binaryInfo.GOARCH == "amd64" {
+		refs = findCodeRefs(text)
+	}
+	resp.Matches = findStrings(rodata, refs, []byte(req.Substring))
+	for _, m := range resp.Matches {
+		for i, ref := range m.References {
+			m.References[i] = s.codeLocation(ref.PC)
+		}
+	}
+	return nil
+}
+
+// findStrings returns the matches of sub in the read-only data, with the
+// PCs of the references among refs, which are sorted by target, to the
+// constant containing each match.
+func findStrings(rodata sectionData, refs []codeRef, sub []byte) []debug.StringMatch {
+	var matches []debug.StringMatch
+	for i := 0; len(matches) < maxStringMatches; {
+		j := bytes.Index(rodata.data[i:], sub)
+		if j < 0 {
+			break
+		}
+		start, end := i+j, i+j+len(sub)
+		i = end
+		addr := rodata.addr + uint64(start)
+
+		// The constant containing the match probably starts at the closest
+		// address before it that some instruction refers to.  References
+		// outside the section can't be to it.
+		m := debug.StringMatch{Address: addr}
+		k := sort.Search(len(refs), func(k int) bool { return refs[k].target > addr })
+		if k > 0 && refs[k-1].target >= rodata.addr && addr-refs[k-1].target <= maxStringLookback {
+			target := refs[k-1].target
+			for ; k > 0 && refs[k-1].target == target; k-- {
+				m.References = append(m.References, debug.CodeLocation{PC: refs[k-1].pc})
+			}
+			start = int(target - rodata.addr)
+		}
+		m.Text = string(rodata.data[start:end])
+		matches = append(matches, m)
+	}
+	return matches
+}
+
+// codeLocation returns the source location of the instruction at pc.
+func (s *Server) codeLocation(pc uint64) debug.CodeLocation {
+	loc := debug.CodeLocation{PC: pc}
+	loc.File, loc.Line, _ = s.lookupSource(pc)
+	if entry, _, err := s.pcToFunction(pc); err == nil {
+		loc.Function, _ = entry.Val(dwarf.AttrName).(string)
+	}
+	return loc
+}
+
+// readTextAndRodata reads the code and read-only data sections of the executable.
+func (s *Server) readTextAndRodata() (text, rodata sectionData, err error) {
+	if text, err = s.readSection(".text", "__text"); err != nil {
+		return text, rodata, err
+	}
+	rodata, err = s.readSection(".rodata", "__rodata")
+	return text, rodata, err
+}
+
+// readSection reads the section of the executable with the given ELF or
+// Mach-O name.  The section's address is where it is in the process.
+func (s *Server) readSection(elfName, machoName string) (sectionData, error) {
+	f, err := os.Open(s.executable)
+	if err != nil {
+		return sectionData{}, err
+	}
+	defer f.Close()
+	if obj, err := elf.NewFile(f); err == nil {
+		sect := obj.Section(elfName)
+		if sect == nil {
+			return sectionData{}, fmt.Errorf("executable has no %s section", elfName)
+		}
+		data, err := sect.Data()
+		return sectionData{sect.Addr + s.loadBias, data}, err
+	}
+	if obj, err := macho.NewFile(f); err == nil {
+		sect := obj.Section(machoName)
+		if sect == nil {
+			return sectionData{}, fmt.Errorf("executable has no %s section", machoName)
+		}
+		data, err := sect.Data()
+		return sectionData{sect.Addr + s.loadBias, data}, err
+	}
+	return sectionData{}, fmt.Errorf("unrecognized binary format")
+}
+
+// findCodeRefs scans amd64 machine code for RIP-relative LEA instructions,
+// which is how the compiler takes the address of a string constant, and
+// returns them sorted by the address they refer to.  The scan doesn't decode
+// instruction boundaries, so it can report spurious references.
+func findCodeRefs(text sectionData) []codeRef {
+	var refs []codeRef
+	const leaLen = 7 // REX.W, 8D, ModRM, disp32.
+	d := text.data
+	for i := 0; i+leaLen <= len(d); i++ {
+		// REX.W prefix, LEA opcode, and a ModRM byte with mod=00 and r/m=101.
+		if d[i]&0xf8 != 0x48 || d[i+1] != 0x8d || d[i+2]&0xc7 != 0x05 {
+			continue
+		}
+		pc := text.addr + uint64(i)
+		disp := int32(binary.LittleEndian.Uint32(d[i+3:]))
+		refs = append(refs, codeRef{pc, pc + leaLen + uint64(int64(disp))})
+	}
+	sort.Stable(codeRefsByTarget(refs))
+	return refs
+}
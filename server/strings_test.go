@@ -0,0 +1,62 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/debug"
+)
+
+func TestFindStrings(t *testing.T) {
+	// The section holds "abc" then "failed to open" at 0x1003.
+	rodata := sectionData{addr: 0x1000, data: []byte("abcfailed to open")}
+	tests := []struct {
+		name string
+		refs []codeRef
+		sub  string
+		want []debug.StringMatch
+	}{
+		{
+			name: "no references",
+			sub:  "open",
+			want: []debug.StringMatch{{Address: 0x100d, Text: "open"}},
+		},
+		{
+			name: "reference to the constant",
+			refs: []codeRef{{pc: 0x10, target: 0x1000}, {pc: 0x20, target: 0x1003}, {pc: 0x30, target: 0x1003}, {pc: 0x40, target: 0x1010}},
+			sub:  "to open",
+			want: []debug.StringMatch{{
+				Address:    0x100a,
+				Text:       "failed to open",
+				References: []debug.CodeLocation{{PC: 0x30}, {PC: 0x20}},
+			}},
+		},
+		{
+			name: "reference before the section",
+			refs: []codeRef{{pc: 0x10, target: 0xff0}},
+			sub:  "abc",
+			want: []debug.StringMatch{{Address: 0x1000, Text: "abc"}},
+		},
+		{
+			name: "closest reference before the match",
+			refs: []codeRef{{pc: 0x10, target: 0x1000}},
+			sub:  "open",
+			want: []debug.StringMatch{{
+				Address:    0x100d,
+				Text:       "abcfailed to open",
+				References: []debug.CodeLocation{{PC: 0x10}},
+			}},
+		},
+		{name: "no match", sub: "close"},
+	}
+	for _, tt := range tests {
+		got := findStrings(rodata, tt.refs, []byte(tt.sub))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
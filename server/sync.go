@@ -0,0 +1,276 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Decoding the state of sync.Mutex, sync.RWMutex and sync.WaitGroup, and
+// finding the goroutines blocked on them in the runtime's semaphore table.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/dwarf"
+)
+
+// The bits of a mutex's state, from sync.
+const (
+	mutexLocked      = 1
+	mutexWoken       = 2
+	mutexStarving    = 4
+	mutexWaiterShift = 3
+)
+
+// maxSemaWaiters limits how many goroutines blocked on a semaphore are read,
+// and how deep the runtime's tree of semaphores is searched, in case they
+// are corrupt.
+const maxSemaWaiters = 10000
+
+// syncValue returns v, the value of a variable of the type with the given
+// ID, decoded as a debug.Mutex, debug.RWMutex or debug.WaitGroup if its type
+// is one of those in sync.  If the type is another, or the variable's state
+// can't be read, v is returned unchanged.
+func (s *Server) syncValue(typeID uint64, v debug.Value) debug.Value {
+	sv, ok := v.(debug.Struct)
+	if !ok || len(sv.Fields) == 0 || s.dwarfData == nil {
+		return v
+	}
+	t, err := s.dwarfData.Type(dwarf.Offset(typeID))
+	if err != nil {
+		return v
+	}
+	st, ok := followTypedefs(t).(*dwarf.StructType)
+	if !ok || len(st.Field) == 0 {
+		return v
+	}
+	// The struct's address is the address of its first field, minus that
+	// field's offset.
+	addr := sv.Fields[0].Var.Address - uint64(st.Field[0].ByteOffset)
+	switch typeName(st) {
+	case "sync.Mutex":
+		m, err := s.mutexValue(st, addr)
+		if err != nil {
+			return v
+		}
+		m.Struct = sv
+		return m
+	case "sync.RWMutex":
+		rw, err := s.rwMutexValue(st, addr)
+		if err != nil {
+			return v
+		}
+		rw.Struct = sv
+		return rw
+	case "sync.WaitGroup":
+		wg, err := s.waitGroupValue(st, addr)
+		if err != nil {
+			return v
+		}
+		wg.Struct = sv
+		return wg
+	}
+	return v
+}
+
+// mutexValue decodes the sync.Mutex of type t at addr.
+func (s *Server) mutexValue(t *dwarf.StructType, addr uint64) (debug.Mutex, error) {
+	var m debug.Mutex
+	if f, err := getField(t, "mu"); err == nil {
+		// Since Go 1.24, a sync.Mutex holds an internal/sync.Mutex.
+		st, ok := followTypedefs(f.Type).(*dwarf.StructType)
+		if !ok {
+			return m, errors.New("mutex field mu is not a struct")
+		}
+		t, addr = st, addr+uint64(f.ByteOffset)
+	}
+	state, err := s.peekSyncField(t, addr, "state")
+	if err != nil {
+		return m, err
+	}
+	m.Locked = state&mutexLocked != 0
+	m.Woken = state&mutexWoken != 0
+	m.Starving = state&mutexStarving != 0
+	m.WaiterCount = uint64(uint32(state) >> mutexWaiterShift)
+	sema, _, err := s.syncField(t, addr, "sema")
+	if err != nil {
+		return m, err
+	}
+	m.Waiters, err = s.semaWaiters(sema)
+	return m, err
+}
+
+// rwMutexValue decodes the sync.RWMutex of type t at addr.
+func (s *Server) rwMutexValue(t *dwarf.StructType, addr uint64) (debug.RWMutex, error) {
+	var rw debug.RWMutex
+	f, err := getField(t, "w")
+	if err != nil {
+		return rw, err
+	}
+	wt, ok := followTypedefs(f.Type).(*dwarf.StructType)
+	if !ok {
+		return rw, errors.New("mutex field w is not a struct")
+	}
+	w := addr + uint64(f.ByteOffset)
+	if rw.W, err = s.mutexValue(wt, w); err != nil {
+		return rw, err
+	}
+	if v, err := s.value(wt, w); err == nil {
+		rw.W.Struct, _ = v.(debug.Struct)
+	}
+	count, err := s.peekSyncField(t, addr, "readerCount")
+	if err != nil {
+		return rw, err
+	}
+	wait, err := s.peekSyncField(t, addr, "readerWait")
+	if err != nil {
+		return rw, err
+	}
+	// A writer makes readerCount negative, to block new readers, and waits
+	// for the readerWait readers who held the lock then to unlock.
+	if readers := int64(int32(count)); readers >= 0 {
+		rw.Readers = readers
+	} else {
+		rw.Writer = true
+		rw.Readers = int64(int32(wait))
+		if rw.Readers < 0 {
+			// The readers unlocked before the writer counted them.
+			rw.Readers = 0
+		}
+		rw.Locked = rw.Readers == 0
+	}
+	for _, sem := range []struct {
+		field   string
+		waiters *[]int64
+	}{{"readerSem", &rw.ReaderWaiters}, {"writerSem", &rw.WriterWaiters}} {
+		a, _, err := s.syncField(t, addr, sem.field)
+		if err != nil {
+			return rw, err
+		}
+		if *sem.waiters, err = s.semaWaiters(a); err != nil {
+			return rw, err
+		}
+	}
+	return rw, nil
+}
+
+// waitGroupValue decodes the sync.WaitGroup of type t at addr.  Only the
+// layout of Go 1.20 and later, with a 64-bit state, is understood.
+func (s *Server) waitGroupValue(t *dwarf.StructType, addr uint64) (debug.WaitGroup, error) {
+	var wg debug.WaitGroup
+	state, err := s.peekSyncField(t, addr, "state")
+	if err != nil {
+		return wg, err
+	}
+	// The counter is in the high 32 bits, and the number of waiters in the
+	// low 31; the bit between marks wait groups in synctest bubbles.
+	wg.Counter = int64(int32(state >> 32))
+	wg.WaiterCount = state & 0x7fffffff
+	sema, _, err := s.syncField(t, addr, "sema")
+	if err != nil {
+		return wg, err
+	}
+	wg.Waiters, err = s.semaWaiters(sema)
+	return wg, err
+}
+
+// syncField returns the address and type of the integer field name of the
+// struct of type t at addr.  The field may be a sync/atomic type, such as
+// atomic.Int32, which holds the integer in its field v.
+func (s *Server) syncField(t *dwarf.StructType, addr uint64, name string) (uint64, dwarf.Type, error) {
+	f, err := getField(t, name)
+	if err != nil {
+		return 0, nil, err
+	}
+	addr += uint64(f.ByteOffset)
+	ft := followTypedefs(f.Type)
+	if st, ok := ft.(*dwarf.StructType); ok {
+		return s.syncField(st, addr, "v")
+	}
+	return addr, ft, nil
+}
+
+// peekSyncField reads the integer field name of the struct of type t at
+// addr, as syncField finds it.  Signed integers are returned as their bits.
+func (s *Server) peekSyncField(t *dwarf.StructType, addr uint64, name string) (uint64, error) {
+	a, ft, err := s.syncField(t, addr, name)
+	if err != nil {
+		return 0, err
+	}
+	switch ft.(type) {
+	case *dwarf.IntType, *dwarf.UintType:
+	default:
+		return 0, fmt.Errorf("field %s is not an integer", name)
+	}
+	return s.peekUint(a, ft.Size())
+}
+
+// semaWaiters returns the IDs of the goroutines blocked on the semaphore at
+// sema, in the order they will be woken.  The runtime keeps the goroutines
+// blocked on semaphores in a table of trees, ordered by the semaphores'
+// addresses, each of whose nodes heads a list of the goroutines blocked on
+// one semaphore.
+func (s *Server) semaWaiters(sema uint64) ([]int64, error) {
+	tableAddr, tt := s.findGlobalVar("runtime.semtable")
+	if tt == nil {
+		return nil, errors.New("runtime.semtable not found")
+	}
+	table, ok := followTypedefs(tt).(*dwarf.ArrayType)
+	if !ok || table.Count <= 0 {
+		return nil, errors.New("runtime.semtable is not an array")
+	}
+	entry, ok := followTypedefs(table.Type).(*dwarf.StructType)
+	if !ok {
+		return nil, errors.New("runtime.semtable is not an array of structs")
+	}
+	f, err := getField(entry, "root")
+	if err != nil {
+		return nil, err
+	}
+	semaRoot, ok := followTypedefs(f.Type).(*dwarf.StructType)
+	if !ok {
+		return nil, errors.New("semaphore root is not a struct")
+	}
+	sudog, err := s.runtimeStruct("runtime.sudog")
+	if err != nil {
+		return nil, err
+	}
+	gType, err := s.runtimeStruct("runtime.g")
+	if err != nil {
+		return nil, err
+	}
+	// This is semTable.rootFor.
+	i := (sema >> 3) % uint64(table.Count)
+	root := tableAddr + i*uint64(table.Type.Size()) + uint64(f.ByteOffset)
+	sg, err := s.peekPtrStructField(semaRoot, root, "treap")
+	for n := 0; err == nil && sg != 0; n++ {
+		var elem uint64
+		if elem, err = s.sudogElem(sudog, sg); err != nil || elem == sema {
+			break
+		}
+		switch {
+		case n == maxSemaWaiters:
+			err = errors.New("tree too deep")
+		case sema < elem:
+			sg, err = s.peekPtrStructField(sudog, sg, "prev")
+		default:
+			sg, err = s.peekPtrStructField(sudog, sg, "next")
+		}
+	}
+	var ids []int64
+	for ; err == nil && sg != 0 && len(ids) < maxSemaWaiters; sg, err = s.peekPtrStructField(sudog, sg, "waitlink") {
+		var g, id uint64
+		if g, err = s.peekPtrStructField(sudog, sg, "g"); err != nil {
+			break
+		}
+		if id, err = s.peekUintOrIntStructField(gType, g, "goid"); err != nil {
+			break
+		}
+		ids = append(ids, int64(id))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading the goroutines blocked on semaphore %#x: %v", sema, err)
+	}
+	return ids, nil
+}
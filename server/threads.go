@@ -0,0 +1,284 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Stopping and restarting all the threads of the process together, and
+// listing and selecting them.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"syscall"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/dwarf"
+	"golang.org/x/debug/server/protocol"
+)
+
+// errThreadExited is returned by stopThread for a thread that exits before it
+// can be stopped.
+var errThreadExited = errors.New("thread exited")
+
+// stopOtherThreads stops all the threads of the process except the one that
+// trapped, so that the process's memory doesn't change while it is inspected.
+func (s *Server) stopOtherThreads() error {
+	pid := s.proc.Pid
+	s.otherThreads = make(map[int]bool)
+	for {
+		// Threads can be created while we work, so repeat until there are no
+		// new ones.
+		tids, err := threadIDs(pid)
+		if err != nil {
+			return err
+		}
+		progress := false
+		for _, tid := range tids {
+			if _, done := s.otherThreads[tid]; done || tid == s.stoppedPid {
+				continue
+			}
+			progress = true
+			pending, err := s.stopThread(pid, tid, false, true)
+			if err == errThreadExited {
+				continue
+			} else if err != nil {
+				return err
+			}
+			s.otherThreads[tid] = pending
+		}
+		if !progress {
+			return nil
+		}
+	}
+}
+
+// resumeOtherThreads continues the threads stopped by stopOtherThreads.
+func (s *Server) resumeOtherThreads() error {
+	for tid := range s.otherThreads {
+		if err := s.ptraceCont(tid, 0); err != nil && err != syscall.ESRCH {
+			return fmt.Errorf("ptraceCont: %v", err)
+		}
+	}
+	s.otherThreads = nil
+	return nil
+}
+
+// stopThread stops the thread tid of process pid, which hasn't been waited for
+// since it was last continued, unless pending is set, which means it is
+// stopped but a SIGSTOP sent to it is still to arrive.  If keepTrap is set, a
+// thread found stopped at a trap is left there, with its PC backed up if it is
+// at a breakpoint so that it hits it again when continued; otherwise it is run
+// on until the SIGSTOP arrives.  stopThread reports whether a SIGSTOP is still
+// pending for the thread.
+func (s *Server) stopThread(pid, tid int, pending, keepTrap bool) (bool, error) {
+	var (
+		wpid   int
+		status waitStatus
+		err    error
+	)
+	sent := pending
+	if pending {
+		if err := s.ptraceCont(tid, 0); err != nil {
+			return false, fmt.Errorf("ptraceCont: %v", err)
+		}
+		wpid, status, err = s.wait(tid, false)
+	} else {
+		// A new thread starts with a stop that we may not have waited for yet.
+		wpid, status, err = s.waitNoHang(tid)
+	}
+	for {
+		if err != nil {
+			return false, fmt.Errorf("wait: %v", err)
+		}
+		if wpid == 0 {
+			if err := tgkill(pid, tid, sigstop); err != nil {
+				return false, errThreadExited
+			}
+			sent = true
+			wpid, status, err = s.wait(tid, false)
+			continue
+		}
+		if status.Exited() || status.Signaled() {
+			return false, errThreadExited
+		}
+		switch sig := status.StopSignal(); sig {
+		case sigstop:
+			return false, nil
+		case syscall.SIGTRAP:
+			// A watchpoint the thread triggered is reported by the next
+			// Resume, since only the thread that stopped the process
+			// reports why it stopped.
+			watched, err := s.queueWatchpointHit(tid)
+			if err != nil {
+				return false, err
+			}
+			// Otherwise the thread may have executed a breakpoint
+			// instruction; if so, back it up to the breakpoint.
+			var regs ptraceRegs
+			if err := s.ptraceGetRegs(tid, &regs); err != nil {
+				return false, fmt.Errorf("ptraceGetRegs: %v", err)
+			}
+			if _, ok := s.breakpoints[regs.Rip-uint64(s.arch.BreakpointSize)]; ok && !watched {
+				regs.Rip -= uint64(s.arch.BreakpointSize)
+				if err := s.ptraceSetRegs(tid, &regs); err != nil {
+					return false, fmt.Errorf("ptraceSetRegs: %v", err)
+				}
+			}
+			if !sent || keepTrap {
+				return sent, nil
+			}
+			if err := s.ptraceCont(tid, 0); err != nil {
+				return false, fmt.Errorf("ptraceCont: %v", err)
+			}
+		default:
+			// Deliver the signal, and stop the thread afterwards.
+			if err := s.ptraceCont(tid, s.signalToDeliver(sig)); err != nil {
+				return false, fmt.Errorf("ptraceCont: %v", err)
+			}
+			if !sent {
+				if err := tgkill(pid, tid, sigstop); err != nil {
+					return false, errThreadExited
+				}
+				sent = true
+			}
+		}
+		wpid, status, err = s.wait(tid, false)
+	}
+}
+
+func (s *Server) Threads(req *protocol.ThreadsRequest, resp *protocol.ThreadsResponse) error {
+	return s.call(s.otherc, req, resp)
+}
+
+func (s *Server) handleThreads(req *protocol.ThreadsRequest, resp *protocol.ThreadsResponse) error {
+	if s.proc == nil || !s.procIsUp {
+		return errors.New("Threads: no stopped process")
+	}
+	trap := s.trapPid
+	if trap == 0 {
+		trap = s.stoppedPid
+	}
+	tids := []int{s.stoppedPid}
+	for tid := range s.otherThreads {
+		tids = append(tids, tid)
+	}
+	sort.Ints(tids)
+	for _, tid := range tids {
+		regs := s.stoppedRegs
+		if tid != s.stoppedPid {
+			if err := s.ptraceGetRegs(tid, &regs); err == syscall.ESRCH {
+				// The thread has exited.
+				continue
+			} else if err != nil {
+				return fmt.Errorf("ptraceGetRegs: %v", err)
+			}
+		}
+		t := debug.Thread{
+			ID:       tid,
+			State:    "stopped",
+			PC:       regs.Rip,
+			SP:       regs.Rsp,
+			Function: s.threadFunction(regs.Rip),
+			Selected: tid == s.stoppedPid,
+		}
+		if tid == trap {
+			t.State = "trapped"
+		} else if int64(regs.Orig_rax) >= 0 {
+			// The system call the thread was stopped in, or -1.
+			t.State = "syscall"
+		}
+		resp.Threads = append(resp.Threads, t)
+	}
+	return nil
+}
+
+// threadFunction returns the name of the function at pc, which may be in Go
+// code or in foreign code, or "" if it isn't known.
+func (s *Server) threadFunction(pc uint64) string {
+	if name, _, err := s.pcToFunctionName(pc); err == nil {
+		return dwarf.DemangleShapes(name)
+	}
+	if o, base, err := s.foreignObjectAt(pc); err == nil {
+		name, _, _ := o.function(pc - base)
+		return name
+	}
+	return ""
+}
+
+func (s *Server) SelectThread(req *protocol.SelectThreadRequest, resp *protocol.SelectThreadResponse) error {
+	return s.call(s.otherc, req, resp)
+}
+
+func (s *Server) handleSelectThread(req *protocol.SelectThreadRequest, resp *protocol.SelectThreadResponse) error {
+	if s.proc == nil || !s.procIsUp {
+		return errors.New("SelectThread: no stopped process")
+	}
+	if req.Thread == 0 {
+		return s.deselectThread()
+	}
+	return s.selectThread(req.Thread)
+}
+
+// selectThread makes thread tid, one of the threads stopped along with the
+// one that stopped the process, stoppedPid, so that requests about the
+// stopped thread are about it.  The thread that stopped the process is kept
+// in trapPid, for deselectThread to switch back to before the process runs.
+func (s *Server) selectThread(tid int) error {
+	if tid == s.stoppedPid {
+		s.selectedFrame = nil
+		return nil
+	}
+	pending, ok := s.otherThreads[tid]
+	if !ok {
+		return fmt.Errorf("SelectThread: no stopped thread %d", tid)
+	}
+	var regs ptraceRegs
+	if err := s.ptraceGetRegs(tid, &regs); err != nil {
+		return fmt.Errorf("ptraceGetRegs: %v", err)
+	}
+	if s.trapPid == 0 {
+		s.trapPid = s.stoppedPid
+	}
+	delete(s.otherThreads, tid)
+	s.otherThreads[s.stoppedPid] = s.stoppedPending
+	s.stoppedPid, s.stoppedRegs, s.stoppedPending = tid, regs, pending
+	if tid == s.trapPid {
+		s.trapPid = 0
+	}
+	s.selectedFrame = nil
+	return nil
+}
+
+// deselectThread switches back to the thread that stopped the process, if
+// SelectThread selected another.  It is done before anything runs the
+// process, which carries on from where that thread stopped.
+func (s *Server) deselectThread() error {
+	if s.trapPid == 0 {
+		return nil
+	}
+	return s.selectThread(s.trapPid)
+}
+
+func (s *Server) SetThreadStops(req *protocol.SetThreadStopsRequest, resp *protocol.SetThreadStopsResponse) error {
+	return s.call(s.breakpointc, req, resp)
+}
+
+func (s *Server) handleSetThreadStops(req *protocol.SetThreadStopsRequest, resp *protocol.SetThreadStopsResponse) error {
+	s.threadStops = req.Stop
+	return nil
+}
+
+// runsProcess reports whether the request runs the process, or replaces or
+// ends it, so that the thread that stopped it must be the selected one.
+func runsProcess(req interface{}) bool {
+	switch req.(type) {
+	case *protocol.RunRequest, *protocol.RestartRequest, *protocol.KillRequest, *protocol.DetachRequest, *protocol.ShutdownRequest,
+		*protocol.ResumeRequest, *protocol.ResumeAsyncRequest, *protocol.StepInstructionRequest,
+		*protocol.RunToLineRequest, *protocol.CheckpointRequest, *protocol.RestoreRequest,
+		*protocol.ReverseToPreviousBreakRequest, *protocol.ReverseToPreviousStopRequest:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,256 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/debug/server/protocol"
+)
+
+// threadsTestProgram starts threads that wait until the test tells them to
+// exit, or to start more.
+const threadsTestProgram = `package main
+
+import (
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// Set by the test.
+var (
+	exitThread   int32 // Makes the thread waiting for it exit.
+	startThreads int32 // Makes main start more threads.
+)
+
+var never int32
+
+// lockedThread waits on a thread of its own until *flag is set, and then
+// returns without unlocking the thread, so that the thread exits.
+func lockedThread(flag *int32) {
+	runtime.LockOSThread()
+	for atomic.LoadInt32(flag) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+//go:noinline
+func stop() {}
+
+// starter starts more threads once startThreads is set.
+func starter() {
+	for atomic.LoadInt32(&startThreads) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	for i := 0; i < 4; i++ {
+		go lockedThread(&never)
+	}
+}
+
+func main() {
+	// The other goroutines run while main's thread is stopped.
+	runtime.GOMAXPROCS(4)
+	for i := 0; i < 3; i++ {
+		go lockedThread(&never)
+	}
+	go lockedThread(&exitThread)
+	go starter()
+	time.Sleep(100 * time.Millisecond)
+	stop()
+	time.Sleep(time.Hour)
+}
+`
+
+// threadStates returns the state of each thread of process pid, as given in
+// /proc: "t" for one stopped by the debugger, and "Z" for one that has
+// exited but hasn't been waited for.
+func threadStates(t *testing.T, pid int) map[int]string {
+	t.Helper()
+	tids, err := threadIDs(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	states := make(map[int]string)
+	for _, tid := range tids {
+		stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/task/%d/stat", pid, tid))
+		if err != nil {
+			// The thread has gone.
+			continue
+		}
+		// The state follows the command name, which is in parentheses.
+		if i := bytes.LastIndexByte(stat, ')'); i >= 0 && i+2 < len(stat) {
+			states[tid] = string(stat[i+2])
+		}
+	}
+	return states
+}
+
+// waitForThreads polls the states of the threads of process pid until ok
+// accepts them, failing the test if it doesn't within half a minute,
+// which allows for a loaded machine.
+func waitForThreads(t *testing.T, pid int, what string, ok func(map[int]string) bool) map[int]string {
+	t.Helper()
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		states := threadStates(t, pid)
+		if ok(states) {
+			return states
+		}
+		if time.Since(start) > 30*time.Second {
+			t.Fatalf("%s: got thread states %v", what, states)
+		}
+	}
+}
+
+// setFlag sets the named int32 variable of the stopped process to 1.
+func setFlag(t *testing.T, s *Server, name string) {
+	t.Helper()
+	var v protocol.VarByNameResponse
+	if err := s.VarByName(&protocol.VarByNameRequest{Name: name}, &v); err != nil {
+		t.Fatal(err)
+	}
+	var data [4]byte
+	binary.LittleEndian.PutUint32(data[:], 1)
+	if err := s.WriteMemory(&protocol.WriteMemoryRequest{Address: v.Var.Address, Data: data[:]}, &protocol.WriteMemoryResponse{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestStopOtherThreads checks that stopOtherThreads stops every thread, and
+// resumeOtherThreads resumes them, including threads that exit, or are
+// started, while they are being stopped.
+func TestStopOtherThreads(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go command not found")
+	}
+	dir, err := ioutil.TempDir("", "threads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "main.go")
+	if err := ioutil.WriteFile(src, []byte(threadsTestProgram), 0644); err != nil {
+		t.Fatal(err)
+	}
+	exe := filepath.Join(dir, "threads")
+	cmd := exec.Command("go", "build", "-o", exe, src)
+	cmd.Env = append(os.Environ(), "GO111MODULE=off")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("building test program: %v\n%s", err, out)
+	}
+
+	s, err := New(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Run(&protocol.RunRequest{}, &protocol.RunResponse{}); err != nil {
+		t.Fatal("Run:", err)
+	}
+	defer s.Kill(&protocol.KillRequest{}, &protocol.KillResponse{})
+	if err := s.BreakpointAtFunction(&protocol.BreakpointAtFunctionRequest{Function: "main.stop"}, &protocol.BreakpointResponse{}); err != nil {
+		t.Fatal("BreakpointAtFunction:", err)
+	}
+	if err := s.Resume(&protocol.ResumeRequest{}, &protocol.ResumeResponse{}); err != nil {
+		t.Fatal("Resume:", err)
+	}
+	pid := s.proc.Pid
+
+	// checkStopped checks that every thread that hasn't exited is stopped,
+	// and that those other than the one that stopped the process are
+	// among the other threads.
+	checkStopped := func(what string) map[int]string {
+		t.Helper()
+		states := threadStates(t, pid)
+		for tid, state := range states {
+			if state == "Z" {
+				continue
+			}
+			if state != "t" {
+				t.Errorf("%s: thread %d in state %q, want stopped", what, tid, state)
+			}
+			if _, ok := s.otherThreads[tid]; !ok && tid != s.stoppedPid {
+				t.Errorf("%s: thread %d not among the other threads %v", what, tid, s.otherThreads)
+			}
+		}
+		if len(states) < 6 {
+			t.Errorf("%s: got threads %v, want at least main's and the four it started", what, states)
+		}
+		return states
+	}
+	before := checkStopped("at the breakpoint")
+
+	// Resuming the other threads leaves only the one that stopped the
+	// process stopped.  A thread whose SIGSTOP was still pending stops
+	// again, and, as when waiting for the process to trap, is continued;
+	// so is one that stops to start a thread.  New threads' first stops
+	// and exited threads are left for stopOtherThreads.
+	setFlag(t, s, "main.exitThread")
+	stopped := s.stoppedPid
+	if err := s.resumeOtherThreads(); err != nil {
+		t.Fatal("resumeOtherThreads:", err)
+	}
+	runOn := func(states map[int]string) {
+		for tid, state := range states {
+			if state != "t" || tid == stopped || before[tid] == "" {
+				continue
+			}
+			if wpid, _, err := s.waitNoHang(tid); err == nil && wpid == tid {
+				s.ptraceCont(tid, 0)
+			}
+		}
+	}
+	waitForThreads(t, pid, "after resumeOtherThreads", func(states map[int]string) bool {
+		runOn(states)
+		for tid, state := range states {
+			if (state == "t") != (tid == stopped) && before[tid] != "" && state != "Z" {
+				return false
+			}
+		}
+		return true
+	})
+
+	// A thread that exits is listed until it is waited for, and a thread
+	// that is started has a first stop that hasn't been waited for;
+	// stopping the threads copes with both.
+	waitForThreads(t, pid, "waiting for a thread to exit", func(states map[int]string) bool {
+		runOn(states)
+		for _, state := range states {
+			if state == "Z" {
+				return true
+			}
+		}
+		return false
+	})
+	setFlag(t, s, "main.startThreads")
+	states := waitForThreads(t, pid, "waiting for a thread to start", func(states map[int]string) bool {
+		runOn(states)
+		for tid := range states {
+			if before[tid] == "" {
+				return true
+			}
+		}
+		return false
+	})
+	if err := s.stopOtherThreads(); err != nil {
+		t.Fatal("stopOtherThreads:", err)
+	}
+	checkStopped("after stopOtherThreads")
+	for tid, state := range states {
+		if _, ok := s.otherThreads[tid]; state == "Z" && ok {
+			t.Errorf("exited thread %d among the other threads", tid)
+		}
+		if _, ok := s.otherThreads[tid]; before[tid] == "" && !ok {
+			t.Errorf("new thread %d not among the other threads", tid)
+		}
+	}
+}
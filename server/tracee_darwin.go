@@ -0,0 +1,779 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Controlling a macOS process with its Mach task, for the emulation of ptrace
+// in ptrace_emulated.go.  The process is traced, so that its signals stop it
+// and are reported by wait4, and its threads are suspended, resumed, read
+// and written through the task's ports.  Each stop of the process is turned
+// into the stop of the thread the signal is for, which is left suspended,
+// and the process is continued straight away, so that its other threads run
+// on.
+//
+// Getting a process's task port with task_for_pid needs the debugger to be
+// run as root, or signed with the com.apple.security.cs.debugger
+// entitlement.
+
+package server
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sort"
+	"syscall"
+	"unsafe"
+)
+
+// The functions of libSystem called through the trampolines in
+// tracee_darwin_amd64.s.
+
+//go:cgo_import_dynamic libc_mach_port_deallocate mach_port_deallocate "/usr/lib/libSystem.B.dylib"
+//go:cgo_import_dynamic libc_mach_vm_deallocate mach_vm_deallocate "/usr/lib/libSystem.B.dylib"
+//go:cgo_import_dynamic libc_mach_vm_protect mach_vm_protect "/usr/lib/libSystem.B.dylib"
+//go:cgo_import_dynamic libc_mach_vm_read_overwrite mach_vm_read_overwrite "/usr/lib/libSystem.B.dylib"
+//go:cgo_import_dynamic libc_mach_vm_region mach_vm_region "/usr/lib/libSystem.B.dylib"
+//go:cgo_import_dynamic libc_mach_vm_write mach_vm_write "/usr/lib/libSystem.B.dylib"
+//go:cgo_import_dynamic libc_ptrace ptrace "/usr/lib/libSystem.B.dylib"
+//go:cgo_import_dynamic libc_task_for_pid task_for_pid "/usr/lib/libSystem.B.dylib"
+//go:cgo_import_dynamic libc_task_self_trap task_self_trap "/usr/lib/libSystem.B.dylib"
+//go:cgo_import_dynamic libc_task_threads task_threads "/usr/lib/libSystem.B.dylib"
+//go:cgo_import_dynamic libc_thread_get_state thread_get_state "/usr/lib/libSystem.B.dylib"
+//go:cgo_import_dynamic libc_thread_info thread_info "/usr/lib/libSystem.B.dylib"
+//go:cgo_import_dynamic libc_thread_resume thread_resume "/usr/lib/libSystem.B.dylib"
+//go:cgo_import_dynamic libc_thread_set_state thread_set_state "/usr/lib/libSystem.B.dylib"
+//go:cgo_import_dynamic libc_thread_suspend thread_suspend "/usr/lib/libSystem.B.dylib"
+
+var (
+	libc_mach_port_deallocate_trampoline_addr   uintptr
+	libc_mach_vm_deallocate_trampoline_addr     uintptr
+	libc_mach_vm_protect_trampoline_addr        uintptr
+	libc_mach_vm_read_overwrite_trampoline_addr uintptr
+	libc_mach_vm_region_trampoline_addr         uintptr
+	libc_mach_vm_write_trampoline_addr          uintptr
+	libc_ptrace_trampoline_addr                 uintptr
+	libc_task_for_pid_trampoline_addr           uintptr
+	libc_task_self_trap_trampoline_addr         uintptr
+	libc_task_threads_trampoline_addr           uintptr
+	libc_thread_get_state_trampoline_addr       uintptr
+	libc_thread_info_trampoline_addr            uintptr
+	libc_thread_resume_trampoline_addr          uintptr
+	libc_thread_set_state_trampoline_addr       uintptr
+	libc_thread_suspend_trampoline_addr         uintptr
+)
+
+//go:linkname syscall_syscall6 syscall.syscall6
+func syscall_syscall6(fn, a1, a2, a3, a4, a5, a6 uintptr) (r1, r2 uintptr, err syscall.Errno)
+
+//go:linkname syscall_syscall9 syscall.syscall9
+func syscall_syscall9(fn, a1, a2, a3, a4, a5, a6, a7, a8, a9 uintptr) (r1, r2 uintptr, err syscall.Errno)
+
+const (
+	ptContinue = 7
+	ptDetach   = 11
+
+	// Thread state flavors, and their sizes in 32-bit words.
+	x86ThreadState64         = 4
+	x86ThreadState64Count    = 42
+	x86FloatState64          = 5
+	x86FloatState64Count     = 131
+	x86ExceptionState64      = 6
+	x86ExceptionState64Count = 4
+	x86DebugState64          = 11
+	x86DebugState64Count     = 16
+
+	threadIdentifierInfo      = 4
+	threadIdentifierInfoCount = 6
+
+	vmRegionBasicInfo64      = 9
+	vmRegionBasicInfo64Count = 9
+
+	vmProtRead  = 0x1
+	vmProtWrite = 0x2
+	vmProtCopy  = 0x10
+
+	kernInvalidAddress = 1
+
+	// Mach-O header fields, for finding the executable in memory.
+	machOMagic64 = 0xfeedfacf
+	machOExecute = 0x2
+
+	// Exception numbers of the x86 faults behind the signals.
+	trapDivide        = 0
+	trapDebug         = 1
+	trapBreakpoint    = 3
+	trapInvalidOp     = 6
+	trapSegNotPresent = 11
+	trapStackFault    = 12
+	trapGeneralProt   = 13
+	trapPageFault     = 14
+	trapFPError       = 16
+	trapSIMDError     = 19
+)
+
+// threadState is the x86_thread_state64_t structure.
+type threadState struct {
+	rax    uint64
+	rbx    uint64
+	rcx    uint64
+	rdx    uint64
+	rdi    uint64
+	rsi    uint64
+	rbp    uint64
+	rsp    uint64
+	r8     uint64
+	r9     uint64
+	r10    uint64
+	r11    uint64
+	r12    uint64
+	r13    uint64
+	r14    uint64
+	r15    uint64
+	rip    uint64
+	rflags uint64
+	cs     uint64
+	fs     uint64
+	gs     uint64
+}
+
+// floatState is the x86_float_state64_t structure, whose registers are laid
+// out as FXSAVE lays them out.
+type floatState struct {
+	reserved  [2]int32
+	fxsave    fpRegs
+	reserved1 int32
+}
+
+// exceptionState is the x86_exception_state64_t structure, which describes
+// the last exception of a thread.
+type exceptionState struct {
+	trapno     uint16
+	cpu        uint16
+	err        uint32
+	faultvaddr uint64
+}
+
+// identifierInfo is the thread_identifier_info_data_t structure.
+type identifierInfo struct {
+	threadID     uint64
+	threadHandle uint64 // The thread's pthread_t, which is where its gs segment starts.
+	dispatchAddr uint64
+}
+
+// regionInfo is the vm_region_basic_info_data_64_t structure, which is
+// packed to 4 bytes, so its offset is split in two.
+type regionInfo struct {
+	protection     int32
+	maxProtection  int32
+	inheritance    uint32
+	shared         uint32
+	reserved       uint32
+	offsetLo       uint32
+	offsetHi       uint32
+	behavior       int32
+	userWiredCount uint16
+}
+
+// A machError is an error returned by a Mach function.
+type machError struct {
+	fn string
+	kr int32 // The kern_return_t.
+}
+
+func (e *machError) Error() string {
+	return fmt.Sprintf("%s: kern_return_t %d", e.fn, e.kr)
+}
+
+// kernReturn returns the error, if any, of the kern_return_t r returned by
+// the Mach function fn.
+func kernReturn(fn string, r uintptr) error {
+	if kr := int32(r); kr != 0 {
+		return &machError{fn, kr}
+	}
+	return nil
+}
+
+func ptrace(request, pid int, addr, data uintptr) error {
+	if _, _, errno := syscall_syscall6(libc_ptrace_trampoline_addr, uintptr(request), uintptr(pid), addr, data, 0, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// taskSelf is the port of the debugger's own task.
+var taskSelf = func() uint32 {
+	r, _, _ := syscall_syscall6(libc_task_self_trap_trampoline_addr, 0, 0, 0, 0, 0, 0)
+	return uint32(r)
+}()
+
+// traceeSys is what the emulation keeps of a macOS process.
+type traceeSys struct {
+	task       uint32                 // Zero until the process stops at its exec.
+	imageBase  uint64                 // Where the executable's Mach-O header is, once found.
+	mainThread uint64                 // The system's ID of the thread that started the process.
+	passes     map[syscall.Signal]int // Signals sent again for the program, to be let through.
+}
+
+// threadSys is what the emulation keeps of a macOS thread.
+type threadSys struct {
+	port    uint32
+	id      uint64         // The system's ID of the thread.
+	gsBase  uint64         // Where its gs segment starts.
+	deliver syscall.Signal // The signal of a fault to pass to the program when it recurs.
+}
+
+// checkRunnable returns an error if the executable, built for the system
+// goos, can't be run here.
+func checkRunnable(executable, goos string) error {
+	if goos != "" && goos != "darwin" {
+		return fmt.Errorf("%s: can't run a %s executable on macOS", executable, goos)
+	}
+	return nil
+}
+
+// startTracee starts the process traced, so that it stops at its exec.  A
+// traced process is killed if the debugger exits, whatever killOnExit says.
+func startTracee(name string, argv []string, attr *os.ProcAttr, killOnExit bool) (*os.Process, traceeSys, error) {
+	attr.Sys = &syscall.SysProcAttr{Ptrace: true}
+	p, err := os.StartProcess(name, argv, attr)
+	if err != nil {
+		return nil, traceeSys{}, err
+	}
+	return p, traceeSys{passes: make(map[syscall.Signal]int)}, nil
+}
+
+func (th *thread) suspend() error {
+	r, _, _ := syscall_syscall6(libc_thread_suspend_trampoline_addr, uintptr(th.sys.port), 0, 0, 0, 0, 0)
+	return kernReturn("thread_suspend", r)
+}
+
+func (th *thread) resume() error {
+	r, _, _ := syscall_syscall6(libc_thread_resume_trampoline_addr, uintptr(th.sys.port), 0, 0, 0, 0, 0)
+	return kernReturn("thread_resume", r)
+}
+
+// getState reads the state of the thread of the given flavor into state,
+// which is count 32-bit words long.
+func (th *thread) getState(flavor int, state unsafe.Pointer, count uint32) error {
+	r, _, _ := syscall_syscall6(libc_thread_get_state_trampoline_addr, uintptr(th.sys.port), uintptr(flavor), uintptr(state), uintptr(unsafe.Pointer(&count)), 0, 0)
+	return kernReturn("thread_get_state", r)
+}
+
+func (th *thread) setState(flavor int, state unsafe.Pointer, count uint32) error {
+	r, _, _ := syscall_syscall6(libc_thread_set_state_trampoline_addr, uintptr(th.sys.port), uintptr(flavor), uintptr(state), uintptr(count), 0, 0)
+	return kernReturn("thread_set_state", r)
+}
+
+func (th *thread) getRegs(regs *ptraceRegs) error {
+	var s threadState
+	if err := th.getState(x86ThreadState64, unsafe.Pointer(&s), x86ThreadState64Count); err != nil {
+		return err
+	}
+	*regs = ptraceRegs{
+		R15:      s.r15,
+		R14:      s.r14,
+		R13:      s.r13,
+		R12:      s.r12,
+		Rbp:      s.rbp,
+		Rbx:      s.rbx,
+		R11:      s.r11,
+		R10:      s.r10,
+		R9:       s.r9,
+		R8:       s.r8,
+		Rax:      s.rax,
+		Rcx:      s.rcx,
+		Rdx:      s.rdx,
+		Rsi:      s.rsi,
+		Rdi:      s.rdi,
+		Orig_rax: ^uint64(0),
+		Rip:      s.rip,
+		Cs:       s.cs,
+		Eflags:   s.rflags,
+		Rsp:      s.rsp,
+		Gs_base:  th.sys.gsBase,
+		Fs:       s.fs,
+		Gs:       s.gs,
+	}
+	return nil
+}
+
+func (th *thread) setRegs(regs *ptraceRegs) error {
+	var s threadState
+	if err := th.getState(x86ThreadState64, unsafe.Pointer(&s), x86ThreadState64Count); err != nil {
+		return err
+	}
+	s.r15, s.r14, s.r13, s.r12 = regs.R15, regs.R14, regs.R13, regs.R12
+	s.rbp, s.rbx, s.r11, s.r10 = regs.Rbp, regs.Rbx, regs.R11, regs.R10
+	s.r9, s.r8, s.rax, s.rcx = regs.R9, regs.R8, regs.Rax, regs.Rcx
+	s.rdx, s.rsi, s.rdi = regs.Rdx, regs.Rsi, regs.Rdi
+	s.rip, s.rsp, s.rflags = regs.Rip, regs.Rsp, regs.Eflags
+	return th.setState(x86ThreadState64, unsafe.Pointer(&s), x86ThreadState64Count)
+}
+
+func (th *thread) getFPRegs(regs *fpRegs) error {
+	var s floatState
+	if err := th.getState(x86FloatState64, unsafe.Pointer(&s), x86FloatState64Count); err != nil {
+		return err
+	}
+	*regs = s.fxsave
+	return nil
+}
+
+func (th *thread) setFPRegs(regs *fpRegs) error {
+	var s floatState
+	if err := th.getState(x86FloatState64, unsafe.Pointer(&s), x86FloatState64Count); err != nil {
+		return err
+	}
+	s.fxsave = *regs
+	return th.setState(x86FloatState64, unsafe.Pointer(&s), x86FloatState64Count)
+}
+
+func (th *thread) getDebugRegs(regs *[8]uint64) error {
+	return th.getState(x86DebugState64, unsafe.Pointer(regs), x86DebugState64Count)
+}
+
+func (th *thread) setDebugRegs(regs *[8]uint64) error {
+	return th.setState(x86DebugState64, unsafe.Pointer(regs), x86DebugState64Count)
+}
+
+// lastTrap returns the number of the thread's last exception.
+func (th *thread) lastTrap() (int, error) {
+	var s exceptionState
+	if err := th.getState(x86ExceptionState64, unsafe.Pointer(&s), x86ExceptionState64Count); err != nil {
+		return 0, err
+	}
+	return int(s.trapno), nil
+}
+
+func (t *tracee) read(addr uintptr, out []byte) (int, error) {
+	if len(out) == 0 {
+		return 0, nil
+	}
+	var n uint64
+	if r, _, _ := syscall_syscall6(libc_mach_vm_read_overwrite_trampoline_addr, uintptr(t.sys.task), addr, uintptr(len(out)), uintptr(unsafe.Pointer(&out[0])), uintptr(unsafe.Pointer(&n)), 0); r != 0 {
+		return 0, kernReturn("mach_vm_read_overwrite", r)
+	}
+	return int(n), nil
+}
+
+// write writes data to the process's memory, which can be code.  The pages
+// are made writable, as copies of the ones mapped, while they are written.
+func (t *tracee) write(addr uintptr, data []byte) (int, error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+	start, _, info, err := t.region(addr)
+	if err != nil {
+		return 0, err
+	}
+	if start > uint64(addr) {
+		return 0, &machError{"mach_vm_write", kernInvalidAddress}
+	}
+	protect := func(prot int32) error {
+		r, _, _ := syscall_syscall6(libc_mach_vm_protect_trampoline_addr, uintptr(t.sys.task), addr, uintptr(len(data)), 0, uintptr(prot), 0)
+		return kernReturn("mach_vm_protect", r)
+	}
+	if info.protection&vmProtWrite == 0 {
+		if err := protect(info.protection | vmProtWrite | vmProtCopy); err != nil {
+			return 0, err
+		}
+		defer protect(info.protection)
+	}
+	if r, _, _ := syscall_syscall6(libc_mach_vm_write_trampoline_addr, uintptr(t.sys.task), addr, uintptr(unsafe.Pointer(&data[0])), uintptr(len(data)), 0, 0); r != 0 {
+		return 0, kernReturn("mach_vm_write", r)
+	}
+	return len(data), nil
+}
+
+// isFault reports whether sig is sent for an instruction the thread ran, and
+// so is sent again if the thread runs it again.
+func isFault(sig syscall.Signal) bool {
+	switch sig {
+	case syscall.SIGSEGV, syscall.SIGBUS, syscall.SIGILL, syscall.SIGFPE:
+		return true
+	}
+	return false
+}
+
+// deliver arranges for sig, which th stopped for, to be passed to the
+// program.  A fault happens again when the thread is continued, and is let
+// through then; any other signal is sent to the process again, and let
+// through when it arrives.
+func (t *tracee) deliver(th *thread, sig syscall.Signal) {
+	if isFault(sig) {
+		th.sys.deliver = sig
+		return
+	}
+	if syscall.Kill(t.pid, sig) == nil {
+		t.sys.passes[sig]++
+	}
+}
+
+// attach gets the task of the process, which has just stopped at its exec,
+// and adds the thread it was started with, in the stop it makes at the exec
+// on Linux.
+func (t *tracee) attach() error {
+	var task uint32
+	if r, _, _ := syscall_syscall6(libc_task_for_pid_trampoline_addr, uintptr(taskSelf), uintptr(t.pid), uintptr(unsafe.Pointer(&task)), 0, 0, 0); r != 0 {
+		err := kernReturn("task_for_pid", r)
+		return fmt.Errorf("%v: getting the task of process %d needs the debugger to run as root, or to be signed as a debugger", err, t.pid)
+	}
+	t.sys.task = task
+	ports, err := t.taskThreads()
+	if err != nil {
+		return err
+	}
+	if len(ports) != 1 {
+		return fmt.Errorf("process %d has %d threads at its exec", t.pid, len(ports))
+	}
+	th := &thread{tid: t.pid, sys: threadSys{port: ports[0]}}
+	if err := th.identify(); err != nil {
+		return err
+	}
+	t.sys.mainThread = th.sys.id
+	t.threads[t.pid] = th
+	if err := th.suspend(); err != nil {
+		return err
+	}
+	return t.stop(th, stoppedStatus(syscall.SIGTRAP))
+}
+
+// taskThreads returns the ports of the task's threads.
+func (t *tracee) taskThreads() ([]uint32, error) {
+	// The list is allocated in the debugger's memory by the kernel.
+	var list *uint32
+	var count uint32
+	if r, _, _ := syscall_syscall6(libc_task_threads_trampoline_addr, uintptr(t.sys.task), uintptr(unsafe.Pointer(&list)), uintptr(unsafe.Pointer(&count)), 0, 0, 0); r != 0 {
+		return nil, kernReturn("task_threads", r)
+	}
+	ports := append([]uint32(nil), unsafe.Slice(list, count)...)
+	syscall_syscall6(libc_mach_vm_deallocate_trampoline_addr, uintptr(taskSelf), uintptr(unsafe.Pointer(list)), uintptr(count)*4, 0, 0, 0)
+	return ports, nil
+}
+
+// identify finds the system's ID of th, and where its gs segment starts.
+func (th *thread) identify() error {
+	var info identifierInfo
+	count := uint32(threadIdentifierInfoCount)
+	if r, _, _ := syscall_syscall6(libc_thread_info_trampoline_addr, uintptr(th.sys.port), threadIdentifierInfo, uintptr(unsafe.Pointer(&info)), uintptr(unsafe.Pointer(&count)), 0, 0); r != 0 {
+		return kernReturn("thread_info", r)
+	}
+	th.sys.id = info.threadID
+	th.sys.gsBase = info.threadHandle
+	return nil
+}
+
+func deallocatePort(port uint32) {
+	syscall_syscall6(libc_mach_port_deallocate_trampoline_addr, uintptr(taskSelf), uintptr(port), 0, 0, 0, 0)
+}
+
+// refresh finds the threads the process has started, and those that have
+// exited, since the last time, which the system doesn't report.  A new
+// thread is suspended, and added in the stop it makes on Linux.
+func (t *tracee) refresh() error {
+	if t.sys.task == 0 {
+		return nil
+	}
+	ports, err := t.taskThreads()
+	if err != nil {
+		return err
+	}
+	byID := make(map[uint64]*thread)
+	for _, th := range t.threads {
+		if !th.gone {
+			byID[th.sys.id] = th
+		}
+	}
+	live := make(map[uint64]bool)
+	for _, port := range ports {
+		th := &thread{sys: threadSys{port: port}}
+		if err := th.identify(); err != nil {
+			// The thread has exited since the list was made.
+			deallocatePort(port)
+			continue
+		}
+		live[th.sys.id] = true
+		if _, ok := byID[th.sys.id]; ok {
+			// The name of the port is the one we have already, with
+			// another reference.
+			deallocatePort(port)
+			continue
+		}
+		th.tid = int(th.sys.id)
+		if err := th.suspend(); err != nil {
+			deallocatePort(port)
+			continue
+		}
+		t.threadStarted(th)
+	}
+	for id, th := range byID {
+		if !live[id] {
+			t.threadExited(th, exitedStatus(0))
+			deallocatePort(th.sys.port)
+			th.sys.port = 0
+		}
+	}
+	return nil
+}
+
+// detach stops tracing the process, whose threads have all been resumed.
+// The process must be stopped for that, so it is sent SIGSTOP, which
+// detaching discards.
+func (t *tracee) detach() error {
+	defer t.close()
+	if t.sys.task == 0 {
+		return nil
+	}
+	if err := syscall.Kill(t.pid, syscall.SIGSTOP); err != nil {
+		return err
+	}
+	for {
+		var ws syscall.WaitStatus
+		if _, err := syscall.Wait4(t.pid, &ws, 0, nil); err != nil {
+			return err
+		}
+		if !ws.Stopped() {
+			// It has exited.
+			return nil
+		}
+		if ws.StopSignal() == syscall.SIGSTOP {
+			return ptrace(ptDetach, t.pid, 1, 0)
+		}
+		// Another signal, which the program is given.
+		if err := ptrace(ptContinue, t.pid, 1, uintptr(ws.StopSignal())); err != nil {
+			return err
+		}
+	}
+}
+
+// close gives up the ports of a process that is no longer debugged.
+func (t *tracee) close() {
+	if t.sys.task == 0 {
+		return
+	}
+	for _, th := range t.threads {
+		if th.sys.port != 0 {
+			deallocatePort(th.sys.port)
+			th.sys.port = 0
+		}
+	}
+	deallocatePort(t.sys.task)
+	t.sys.task = 0
+}
+
+// region returns the bounds and information of the region at addr, or the
+// first one after it.
+func (t *tracee) region(addr uintptr) (start, end uint64, info regionInfo, err error) {
+	address, size := uint64(addr), uint64(0)
+	count := uint32(vmRegionBasicInfo64Count)
+	var objectName uint32
+	r, _, _ := syscall_syscall9(libc_mach_vm_region_trampoline_addr, uintptr(t.sys.task), uintptr(unsafe.Pointer(&address)), uintptr(unsafe.Pointer(&size)), vmRegionBasicInfo64, uintptr(unsafe.Pointer(&info)), uintptr(unsafe.Pointer(&count)), uintptr(unsafe.Pointer(&objectName)), 0, 0)
+	err = kernReturn("mach_vm_region", r)
+	return address, address + size, info, err
+}
+
+func (t *tracee) regions() ([]memoryRegion, error) {
+	var regions []memoryRegion
+	for addr := uint64(0); ; {
+		start, end, info, err := t.region(uintptr(addr))
+		if err != nil {
+			if e, ok := err.(*machError); ok && e.kr == kernInvalidAddress {
+				// Past the last region.
+				return regions, nil
+			}
+			return nil, err
+		}
+		regions = append(regions, memoryRegion{
+			start:    start,
+			end:      end,
+			readable: info.protection&vmProtRead != 0,
+			offset:   uint64(info.offsetHi)<<32 | uint64(info.offsetLo),
+		})
+		if end <= addr {
+			return regions, nil
+		}
+		addr = end
+	}
+}
+
+// processEntry returns the address of the executable's Mach-O header in the
+// newly started process, which is where the kernel mapped its __TEXT
+// segment.
+func (s *Server) processEntry() (uint64, error) {
+	traceMu.Lock()
+	defer traceMu.Unlock()
+	t, ok := tracees[s.proc.Pid]
+	if !ok {
+		return 0, syscall.ESRCH
+	}
+	if t.sys.imageBase != 0 {
+		return t.sys.imageBase, nil
+	}
+	regions, err := t.regions()
+	if err != nil {
+		return 0, err
+	}
+	for _, r := range regions {
+		var header [16]byte
+		if !r.readable {
+			continue
+		}
+		if _, err := t.read(uintptr(r.start), header[:]); err != nil {
+			continue
+		}
+		if binary.LittleEndian.Uint32(header[0:]) == machOMagic64 && binary.LittleEndian.Uint32(header[12:]) == machOExecute {
+			t.sys.imageBase = r.start
+			return r.start, nil
+		}
+	}
+	return 0, fmt.Errorf("the executable of process %d isn't mapped", s.proc.Pid)
+}
+
+// pollEvents handles the status changes of the processes that have
+// happened, without waiting for more.
+func pollEvents() error {
+	for _, t := range tracees {
+		// The threads of a process that is exiting can't be listed, but
+		// its exit is about to be reported.
+		t.refresh()
+		for {
+			var ws syscall.WaitStatus
+			wpid, err := syscall.Wait4(t.pid, &ws, syscall.WNOHANG, nil)
+			if err != nil || wpid == 0 {
+				break
+			}
+			if err := t.handleStatus(ws); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// handleStatus turns the status change ws of the process into the stop of
+// the thread Linux would report, and continues the process if it is
+// stopped.
+func (t *tracee) handleStatus(ws syscall.WaitStatus) error {
+	switch {
+	case ws.Exited():
+		t.close()
+		t.processExited(exitedStatus(uint32(ws.ExitStatus())))
+		return nil
+	case ws.Signaled():
+		t.close()
+		t.processExited(signaledStatus(ws.Signal()))
+		return nil
+	case !ws.Stopped():
+		return nil
+	}
+	sig := ws.StopSignal()
+	if t.sys.task == 0 {
+		// The stop at its exec.
+		if err := t.attach(); err != nil {
+			return err
+		}
+		return ptrace(ptContinue, t.pid, 1, 0)
+	}
+	if err := t.refresh(); err != nil {
+		return err
+	}
+	if t.sys.passes[sig] > 0 {
+		t.sys.passes[sig]--
+		return ptrace(ptContinue, t.pid, 1, uintptr(sig))
+	}
+	th, err := t.signalled(sig)
+	if err != nil {
+		return err
+	}
+	switch {
+	case th == nil:
+		return ptrace(ptContinue, t.pid, 1, uintptr(sig))
+	case th.sys.deliver == sig:
+		th.sys.deliver = 0
+		return ptrace(ptContinue, t.pid, 1, uintptr(sig))
+	case th.stopped:
+		th.pending = append(th.pending, stoppedStatus(sig))
+	default:
+		th.sys.deliver = 0
+		if err := th.suspend(); err != nil {
+			return err
+		}
+		if err := t.stop(th, stoppedStatus(sig)); err != nil {
+			return err
+		}
+	}
+	return ptrace(ptContinue, t.pid, 1, 0)
+}
+
+// signalled returns the thread sig was sent to.  The system reports the
+// signals of the process, not of its threads, so the thread is the one the
+// state of the threads points to: one single-stepping, at a breakpoint or
+// watchpoint, or whose last exception is of the kind behind sig.  Other
+// signals are given to the thread that started the process, if it is
+// running, as the kernel would.
+func (t *tracee) signalled(sig syscall.Signal) (*thread, error) {
+	var running []*thread
+	for _, th := range t.threads {
+		if !th.gone && !th.stopped {
+			running = append(running, th)
+		}
+	}
+	sort.Slice(running, func(i, j int) bool { return running[i].tid < running[j].tid })
+	for _, th := range running {
+		if th.sys.deliver == sig {
+			return th, nil
+		}
+	}
+	for _, th := range running {
+		trap, err := th.lastTrap()
+		if err != nil {
+			return nil, err
+		}
+		switch sig {
+		case syscall.SIGTRAP:
+			if th.stepping && trap == trapDebug {
+				return th, nil
+			}
+			if trap == trapBreakpoint {
+				var regs ptraceRegs
+				if err := th.getRegs(&regs); err != nil {
+					return nil, err
+				}
+				var instr [1]byte
+				if _, err := t.read(uintptr(regs.Rip-1), instr[:]); err == nil && instr[0] == 0xcc {
+					return th, nil
+				}
+			}
+			if trap == trapDebug {
+				var regs [8]uint64
+				if err := th.getDebugRegs(&regs); err != nil {
+					return nil, err
+				}
+				if regs[6]&0xf != 0 {
+					return th, nil
+				}
+			}
+		case syscall.SIGSEGV, syscall.SIGBUS:
+			if trap == trapPageFault || trap == trapGeneralProt || trap == trapStackFault || trap == trapSegNotPresent {
+				return th, nil
+			}
+		case syscall.SIGILL:
+			if trap == trapInvalidOp {
+				return th, nil
+			}
+		case syscall.SIGFPE:
+			if trap == trapDivide || trap == trapFPError || trap == trapSIMDError {
+				return th, nil
+			}
+		}
+	}
+	if th, ok := t.threads[t.pid]; ok && !th.gone {
+		if !th.stopped || len(running) == 0 {
+			return th, nil
+		}
+	}
+	if len(running) > 0 {
+		return running[0], nil
+	}
+	return nil, nil
+}
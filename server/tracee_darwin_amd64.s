@@ -0,0 +1,82 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+#include "textflag.h"
+
+// Trampolines to the functions of libSystem used in tracee_darwin.go.
+
+TEXT libc_mach_port_deallocate_trampoline<>(SB),NOSPLIT,$0-0
+	JMP	libc_mach_port_deallocate(SB)
+GLOBL	·libc_mach_port_deallocate_trampoline_addr(SB), RODATA, $8
+DATA	·libc_mach_port_deallocate_trampoline_addr(SB)/8, $libc_mach_port_deallocate_trampoline<>(SB)
+
+TEXT libc_mach_vm_deallocate_trampoline<>(SB),NOSPLIT,$0-0
+	JMP	libc_mach_vm_deallocate(SB)
+GLOBL	·libc_mach_vm_deallocate_trampoline_addr(SB), RODATA, $8
+DATA	·libc_mach_vm_deallocate_trampoline_addr(SB)/8, $libc_mach_vm_deallocate_trampoline<>(SB)
+
+TEXT libc_mach_vm_protect_trampoline<>(SB),NOSPLIT,$0-0
+	JMP	libc_mach_vm_protect(SB)
+GLOBL	·libc_mach_vm_protect_trampoline_addr(SB), RODATA, $8
+DATA	·libc_mach_vm_protect_trampoline_addr(SB)/8, $libc_mach_vm_protect_trampoline<>(SB)
+
+TEXT libc_mach_vm_read_overwrite_trampoline<>(SB),NOSPLIT,$0-0
+	JMP	libc_mach_vm_read_overwrite(SB)
+GLOBL	·libc_mach_vm_read_overwrite_trampoline_addr(SB), RODATA, $8
+DATA	·libc_mach_vm_read_overwrite_trampoline_addr(SB)/8, $libc_mach_vm_read_overwrite_trampoline<>(SB)
+
+TEXT libc_mach_vm_region_trampoline<>(SB),NOSPLIT,$0-0
+	JMP	libc_mach_vm_region(SB)
+GLOBL	·libc_mach_vm_region_trampoline_addr(SB), RODATA, $8
+DATA	·libc_mach_vm_region_trampoline_addr(SB)/8, $libc_mach_vm_region_trampoline<>(SB)
+
+TEXT libc_mach_vm_write_trampoline<>(SB),NOSPLIT,$0-0
+	JMP	libc_mach_vm_write(SB)
+GLOBL	·libc_mach_vm_write_trampoline_addr(SB), RODATA, $8
+DATA	·libc_mach_vm_write_trampoline_addr(SB)/8, $libc_mach_vm_write_trampoline<>(SB)
+
+TEXT libc_ptrace_trampoline<>(SB),NOSPLIT,$0-0
+	JMP	libc_ptrace(SB)
+GLOBL	·libc_ptrace_trampoline_addr(SB), RODATA, $8
+DATA	·libc_ptrace_trampoline_addr(SB)/8, $libc_ptrace_trampoline<>(SB)
+
+TEXT libc_task_for_pid_trampoline<>(SB),NOSPLIT,$0-0
+	JMP	libc_task_for_pid(SB)
+GLOBL	·libc_task_for_pid_trampoline_addr(SB), RODATA, $8
+DATA	·libc_task_for_pid_trampoline_addr(SB)/8, $libc_task_for_pid_trampoline<>(SB)
+
+TEXT libc_task_self_trap_trampoline<>(SB),NOSPLIT,$0-0
+	JMP	libc_task_self_trap(SB)
+GLOBL	·libc_task_self_trap_trampoline_addr(SB), RODATA, $8
+DATA	·libc_task_self_trap_trampoline_addr(SB)/8, $libc_task_self_trap_trampoline<>(SB)
+
+TEXT libc_task_threads_trampoline<>(SB),NOSPLIT,$0-0
+	JMP	libc_task_threads(SB)
+GLOBL	·libc_task_threads_trampoline_addr(SB), RODATA, $8
+DATA	·libc_task_threads_trampoline_addr(SB)/8, $libc_task_threads_trampoline<>(SB)
+
+TEXT libc_thread_get_state_trampoline<>(SB),NOSPLIT,$0-0
+	JMP	libc_thread_get_state(SB)
+GLOBL	·libc_thread_get_state_trampoline_addr(SB), RODATA, $8
+DATA	·libc_thread_get_state_trampoline_addr(SB)/8, $libc_thread_get_state_trampoline<>(SB)
+
+TEXT libc_thread_info_trampoline<>(SB),NOSPLIT,$0-0
+	JMP	libc_thread_info(SB)
+GLOBL	·libc_thread_info_trampoline_addr(SB), RODATA, $8
+DATA	·libc_thread_info_trampoline_addr(SB)/8, $libc_thread_info_trampoline<>(SB)
+
+TEXT libc_thread_resume_trampoline<>(SB),NOSPLIT,$0-0
+	JMP	libc_thread_resume(SB)
+GLOBL	·libc_thread_resume_trampoline_addr(SB), RODATA, $8
+DATA	·libc_thread_resume_trampoline_addr(SB)/8, $libc_thread_resume_trampoline<>(SB)
+
+TEXT libc_thread_set_state_trampoline<>(SB),NOSPLIT,$0-0
+	JMP	libc_thread_set_state(SB)
+GLOBL	·libc_thread_set_state_trampoline_addr(SB), RODATA, $8
+DATA	·libc_thread_set_state_trampoline_addr(SB)/8, $libc_thread_set_state_trampoline<>(SB)
+
+TEXT libc_thread_suspend_trampoline<>(SB),NOSPLIT,$0-0
+	JMP	libc_thread_suspend(SB)
+GLOBL	·libc_thread_suspend_trampoline_addr(SB), RODATA, $8
+DATA	·libc_thread_suspend_trampoline_addr(SB)/8, $libc_thread_suspend_trampoline<>(SB)
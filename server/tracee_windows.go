@@ -0,0 +1,593 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Controlling a Windows process with the debugging API, for the emulation of
+// ptrace in ptrace_emulated.go.  The process is started to be debugged by
+// the server's ptrace thread, which is the only one that can wait for its
+// debug events and continue it after them.  Each event is turned into the
+// stop Linux would have reported, of a thread that is left suspended, and
+// the process is continued straight away, so that its other threads run on.
+
+package server
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	modkernel32 = syscall.NewLazyDLL("kernel32.dll")
+
+	procContinueDebugEvent        = modkernel32.NewProc("ContinueDebugEvent")
+	procDebugActiveProcessStop    = modkernel32.NewProc("DebugActiveProcessStop")
+	procDebugSetProcessKillOnExit = modkernel32.NewProc("DebugSetProcessKillOnExit")
+	procFlushInstructionCache     = modkernel32.NewProc("FlushInstructionCache")
+	procGetThreadContext          = modkernel32.NewProc("GetThreadContext")
+	procReadProcessMemory         = modkernel32.NewProc("ReadProcessMemory")
+	procResumeThread              = modkernel32.NewProc("ResumeThread")
+	procSetThreadContext          = modkernel32.NewProc("SetThreadContext")
+	procSuspendThread             = modkernel32.NewProc("SuspendThread")
+	procVirtualQueryEx            = modkernel32.NewProc("VirtualQueryEx")
+	procWaitForDebugEvent         = modkernel32.NewProc("WaitForDebugEvent")
+	procWriteProcessMemory        = modkernel32.NewProc("WriteProcessMemory")
+)
+
+const (
+	debugOnlyThisProcess = 0x2
+
+	// Debug event codes.
+	exceptionDebugEvent     = 1
+	createThreadDebugEvent  = 2
+	createProcessDebugEvent = 3
+	exitThreadDebugEvent    = 4
+	exitProcessDebugEvent   = 5
+	loadDLLDebugEvent       = 6
+
+	// How the process is continued after a debug event.
+	dbgContinue            = 0x00010002
+	dbgExceptionNotHandled = 0x80010001
+
+	// Exception codes.
+	exceptionBreakpoint           = 0x80000003
+	exceptionSingleStep           = 0x80000004
+	exceptionDatatypeMisalignment = 0x80000002
+	exceptionAccessViolation      = 0xc0000005
+	exceptionInPageError          = 0xc0000006
+	exceptionIllegalInstruction   = 0xc000001d
+	exceptionArrayBoundsExceeded  = 0xc000008c
+	exceptionFltDenormalOperand   = 0xc000008d
+	exceptionFltDivideByZero      = 0xc000008e
+	exceptionFltInexactResult     = 0xc000008f
+	exceptionFltInvalidOperation  = 0xc0000090
+	exceptionFltOverflow          = 0xc0000091
+	exceptionFltStackCheck        = 0xc0000092
+	exceptionFltUnderflow         = 0xc0000093
+	exceptionIntDivideByZero      = 0xc0000094
+	exceptionIntOverflow          = 0xc0000095
+	exceptionPrivInstruction      = 0xc0000096
+	exceptionStackOverflow        = 0xc00000fd
+
+	// The parts of a thread's context that are read and written.
+	contextAMD64          = 0x100000
+	contextControl        = contextAMD64 | 0x1
+	contextInteger        = contextAMD64 | 0x2
+	contextSegments       = contextAMD64 | 0x4
+	contextFloatingPoint  = contextAMD64 | 0x8
+	contextDebugRegisters = contextAMD64 | 0x10
+
+	memCommit             = 0x1000
+	pageNoAccess          = 0x01
+	pageGuard             = 0x100
+	errorSemTimeout       = syscall.Errno(121)
+	errorInvalidParameter = syscall.Errno(87)
+)
+
+// debugEvent is the DEBUG_EVENT structure.  u holds the information about
+// the event, whose layout depends on its code.
+type debugEvent struct {
+	code      uint32
+	processID uint32
+	threadID  uint32
+	u         [20]uint64
+}
+
+// exceptionDebugInfo is the EXCEPTION_DEBUG_INFO structure.
+type exceptionDebugInfo struct {
+	code        uint32
+	flags       uint32
+	record      uintptr
+	address     uintptr
+	numParams   uint32
+	params      [15]uintptr
+	firstChance uint32
+}
+
+// createProcessDebugInfo is the CREATE_PROCESS_DEBUG_INFO structure.
+type createProcessDebugInfo struct {
+	file            syscall.Handle
+	process         syscall.Handle
+	thread          syscall.Handle
+	baseOfImage     uintptr
+	debugInfoOffset uint32
+	debugInfoSize   uint32
+	threadLocalBase uintptr
+	startAddress    uintptr
+	imageName       uintptr
+	unicode         uint16
+}
+
+// createThreadDebugInfo is the CREATE_THREAD_DEBUG_INFO structure.
+type createThreadDebugInfo struct {
+	thread          syscall.Handle
+	threadLocalBase uintptr
+	startAddress    uintptr
+}
+
+// context is the amd64 CONTEXT structure, which must be 16-byte aligned.
+type context struct {
+	pHome        [6]uint64
+	contextFlags uint32
+	mxCsr        uint32
+	segCs        uint16
+	segDs        uint16
+	segEs        uint16
+	segFs        uint16
+	segGs        uint16
+	segSs        uint16
+	eflags       uint32
+	dr0          uint64
+	dr1          uint64
+	dr2          uint64
+	dr3          uint64
+	dr6          uint64
+	dr7          uint64
+	rax          uint64
+	rcx          uint64
+	rdx          uint64
+	rbx          uint64
+	rsp          uint64
+	rbp          uint64
+	rsi          uint64
+	rdi          uint64
+	r8           uint64
+	r9           uint64
+	r10          uint64
+	r11          uint64
+	r12          uint64
+	r13          uint64
+	r14          uint64
+	r15          uint64
+	rip          uint64
+	fltSave      fpRegs // The FXSAVE area.
+	vector       [26][2]uint64
+	vectorCtl    uint64
+	debugCtl     uint64
+	branches     [4]uint64
+}
+
+// memoryBasicInformation is the MEMORY_BASIC_INFORMATION structure.
+type memoryBasicInformation struct {
+	baseAddress       uintptr
+	allocationBase    uintptr
+	allocationProtect uint32
+	partitionID       uint16
+	regionSize        uintptr
+	state             uint32
+	protect           uint32
+	typ               uint32
+}
+
+// traceeSys is what the emulation keeps of a Windows process.
+type traceeSys struct {
+	process      syscall.Handle
+	imageBase    uint64 // Where the executable is loaded.
+	mainThread   uint32 // The system's ID of the thread that started the process.
+	loaderBroken bool   // The loader's breakpoint, made for the debugger, has been passed.
+}
+
+// threadSys is what the emulation keeps of a Windows thread.
+type threadSys struct {
+	handle  syscall.Handle
+	teb     uint64         // The address of the thread's environment block.
+	deliver syscall.Signal // The signal of an exception to pass to the program when it recurs.
+}
+
+// checkRunnable returns an error if the executable, built for the system
+// goos, can't be run here.
+func checkRunnable(executable, goos string) error {
+	if goos != "" && goos != "windows" {
+		return fmt.Errorf("%s: can't run a %s executable on Windows", executable, goos)
+	}
+	return nil
+}
+
+func startTracee(name string, argv []string, attr *os.ProcAttr, killOnExit bool) (*os.Process, traceeSys, error) {
+	attr.Sys = &syscall.SysProcAttr{CreationFlags: debugOnlyThisProcess}
+	p, err := os.StartProcess(name, argv, attr)
+	if err != nil {
+		return nil, traceeSys{}, err
+	}
+	// The processes a thread debugs are killed when it exits, unless it says
+	// otherwise.
+	kill := uintptr(0)
+	if killOnExit {
+		kill = 1
+	}
+	procDebugSetProcessKillOnExit.Call(kill)
+	return p, traceeSys{}, nil
+}
+
+// newContext returns a thread context, aligned as the system requires, for
+// reading the parts flags selects.
+func newContext(flags uint32) *context {
+	buf := make([]byte, unsafe.Sizeof(context{})+15)
+	c := (*context)(unsafe.Pointer((uintptr(unsafe.Pointer(&buf[0])) + 15) &^ 15))
+	c.contextFlags = flags
+	return c
+}
+
+func (th *thread) getContext(flags uint32) (*context, error) {
+	c := newContext(flags)
+	if r, _, err := procGetThreadContext.Call(uintptr(th.sys.handle), uintptr(unsafe.Pointer(c))); r == 0 {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (th *thread) setContext(c *context) error {
+	if r, _, err := procSetThreadContext.Call(uintptr(th.sys.handle), uintptr(unsafe.Pointer(c))); r == 0 {
+		return err
+	}
+	return nil
+}
+
+func (th *thread) suspend() error {
+	if r, _, err := procSuspendThread.Call(uintptr(th.sys.handle)); int32(r) == -1 {
+		return err
+	}
+	return nil
+}
+
+func (th *thread) resume() error {
+	if r, _, err := procResumeThread.Call(uintptr(th.sys.handle)); int32(r) == -1 {
+		return err
+	}
+	return nil
+}
+
+func (th *thread) getRegs(regs *ptraceRegs) error {
+	c, err := th.getContext(contextControl | contextInteger | contextSegments)
+	if err != nil {
+		return err
+	}
+	*regs = ptraceRegs{
+		R15:      c.r15,
+		R14:      c.r14,
+		R13:      c.r13,
+		R12:      c.r12,
+		Rbp:      c.rbp,
+		Rbx:      c.rbx,
+		R11:      c.r11,
+		R10:      c.r10,
+		R9:       c.r9,
+		R8:       c.r8,
+		Rax:      c.rax,
+		Rcx:      c.rcx,
+		Rdx:      c.rdx,
+		Rsi:      c.rsi,
+		Rdi:      c.rdi,
+		Orig_rax: ^uint64(0),
+		Rip:      c.rip,
+		Cs:       uint64(c.segCs),
+		Eflags:   uint64(c.eflags),
+		Rsp:      c.rsp,
+		Ss:       uint64(c.segSs),
+		Gs_base:  th.sys.teb,
+		Ds:       uint64(c.segDs),
+		Es:       uint64(c.segEs),
+		Fs:       uint64(c.segFs),
+		Gs:       uint64(c.segGs),
+	}
+	return nil
+}
+
+func (th *thread) setRegs(regs *ptraceRegs) error {
+	c, err := th.getContext(contextControl | contextInteger)
+	if err != nil {
+		return err
+	}
+	c.r15, c.r14, c.r13, c.r12 = regs.R15, regs.R14, regs.R13, regs.R12
+	c.rbp, c.rbx, c.r11, c.r10 = regs.Rbp, regs.Rbx, regs.R11, regs.R10
+	c.r9, c.r8, c.rax, c.rcx = regs.R9, regs.R8, regs.Rax, regs.Rcx
+	c.rdx, c.rsi, c.rdi = regs.Rdx, regs.Rsi, regs.Rdi
+	c.rip, c.rsp, c.eflags = regs.Rip, regs.Rsp, uint32(regs.Eflags)
+	return th.setContext(c)
+}
+
+func (th *thread) getFPRegs(regs *fpRegs) error {
+	c, err := th.getContext(contextFloatingPoint)
+	if err != nil {
+		return err
+	}
+	*regs = c.fltSave
+	return nil
+}
+
+func (th *thread) setFPRegs(regs *fpRegs) error {
+	c, err := th.getContext(contextFloatingPoint)
+	if err != nil {
+		return err
+	}
+	c.fltSave = *regs
+	return th.setContext(c)
+}
+
+func (th *thread) getDebugRegs(regs *[8]uint64) error {
+	c, err := th.getContext(contextDebugRegisters)
+	if err != nil {
+		return err
+	}
+	*regs = [8]uint64{c.dr0, c.dr1, c.dr2, c.dr3, 0, 0, c.dr6, c.dr7}
+	return nil
+}
+
+func (th *thread) setDebugRegs(regs *[8]uint64) error {
+	c, err := th.getContext(contextDebugRegisters)
+	if err != nil {
+		return err
+	}
+	c.dr0, c.dr1, c.dr2, c.dr3 = regs[0], regs[1], regs[2], regs[3]
+	c.dr6, c.dr7 = regs[6], regs[7]
+	return th.setContext(c)
+}
+
+func (t *tracee) read(addr uintptr, out []byte) (int, error) {
+	if len(out) == 0 {
+		return 0, nil
+	}
+	var n uintptr
+	if r, _, err := procReadProcessMemory.Call(uintptr(t.sys.process), addr, uintptr(unsafe.Pointer(&out[0])), uintptr(len(out)), uintptr(unsafe.Pointer(&n))); r == 0 {
+		return int(n), err
+	}
+	return int(n), nil
+}
+
+// write writes data to the process's memory, which can be code, whose pages
+// WriteProcessMemory makes writable while it writes them.
+func (t *tracee) write(addr uintptr, data []byte) (int, error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+	var n uintptr
+	r, _, err := procWriteProcessMemory.Call(uintptr(t.sys.process), addr, uintptr(unsafe.Pointer(&data[0])), uintptr(len(data)), uintptr(unsafe.Pointer(&n)))
+	procFlushInstructionCache.Call(uintptr(t.sys.process), addr, n)
+	if r == 0 {
+		return int(n), err
+	}
+	return int(n), nil
+}
+
+// deliver arranges for the exception sig stands for, which th stopped for,
+// to be passed to the program.  Continuing the thread makes the exception
+// happen again, and this time the program's own handlers are given it.
+func (t *tracee) deliver(th *thread, sig syscall.Signal) {
+	th.sys.deliver = sig
+}
+
+// refresh does nothing, since the threads the process starts are reported as
+// debug events.
+func (t *tracee) refresh() error {
+	return nil
+}
+
+// detach stops debugging the process, whose threads have all been resumed.
+func (t *tracee) detach() error {
+	if r, _, err := procDebugActiveProcessStop.Call(uintptr(t.pid)); r == 0 {
+		return err
+	}
+	t.close()
+	return nil
+}
+
+// close closes the handles of a process that is no longer debugged.  The
+// system closes them itself when the process exits.
+func (t *tracee) close() {
+	if t.sys.process == 0 {
+		return
+	}
+	for _, th := range t.threads {
+		if th.sys.handle != 0 {
+			syscall.CloseHandle(th.sys.handle)
+		}
+	}
+	syscall.CloseHandle(t.sys.process)
+	t.sys.process = 0
+}
+
+func (t *tracee) regions() ([]memoryRegion, error) {
+	var regions []memoryRegion
+	for addr := uintptr(0); ; {
+		var info memoryBasicInformation
+		if r, _, err := procVirtualQueryEx.Call(uintptr(t.sys.process), addr, uintptr(unsafe.Pointer(&info)), unsafe.Sizeof(info)); r == 0 {
+			if err == errorInvalidParameter {
+				// Past the end of the address space.
+				return regions, nil
+			}
+			return nil, err
+		}
+		if info.state == memCommit {
+			regions = append(regions, memoryRegion{
+				start:    uint64(info.baseAddress),
+				end:      uint64(info.baseAddress + info.regionSize),
+				readable: info.protect&(pageNoAccess|pageGuard) == 0,
+			})
+		}
+		next := info.baseAddress + info.regionSize
+		if next <= addr {
+			return regions, nil
+		}
+		addr = next
+	}
+}
+
+// processEntry returns the address the executable is loaded at in the newly
+// started process.
+func (s *Server) processEntry() (uint64, error) {
+	traceMu.Lock()
+	defer traceMu.Unlock()
+	t, ok := tracees[s.proc.Pid]
+	if !ok || t.sys.imageBase == 0 {
+		return 0, fmt.Errorf("the address of process %d's executable isn't known", s.proc.Pid)
+	}
+	return t.sys.imageBase, nil
+}
+
+// exceptionSignal returns the signal Go gives the exception code, or 0 if it
+// isn't an exception the debugger stops for.
+func exceptionSignal(code uint32) syscall.Signal {
+	switch code {
+	case exceptionBreakpoint, exceptionSingleStep:
+		return syscall.SIGTRAP
+	case exceptionAccessViolation, exceptionArrayBoundsExceeded, exceptionStackOverflow:
+		return syscall.SIGSEGV
+	case exceptionInPageError, exceptionDatatypeMisalignment:
+		return syscall.SIGBUS
+	case exceptionIllegalInstruction, exceptionPrivInstruction:
+		return syscall.SIGILL
+	case exceptionIntDivideByZero, exceptionIntOverflow,
+		exceptionFltDenormalOperand, exceptionFltDivideByZero, exceptionFltInexactResult,
+		exceptionFltInvalidOperation, exceptionFltOverflow, exceptionFltStackCheck, exceptionFltUnderflow:
+		return syscall.SIGFPE
+	}
+	return 0
+}
+
+// pollEvents handles the debug events that have happened, without waiting
+// for more.
+func pollEvents() error {
+	for {
+		var ev debugEvent
+		if r, _, err := procWaitForDebugEvent.Call(uintptr(unsafe.Pointer(&ev)), 0); r == 0 {
+			if err == errorSemTimeout {
+				return nil
+			}
+			return fmt.Errorf("WaitForDebugEvent: %v", err)
+		}
+		cont := uintptr(dbgContinue)
+		if t, ok := tracees[int(ev.processID)]; ok {
+			var err error
+			if cont, err = t.handleEvent(&ev); err != nil {
+				return err
+			}
+		} else if ev.code == exceptionDebugEvent {
+			// A process that is no longer debugged.
+			cont = dbgExceptionNotHandled
+		}
+		if r, _, err := procContinueDebugEvent.Call(uintptr(ev.processID), uintptr(ev.threadID), cont); r == 0 {
+			return fmt.Errorf("ContinueDebugEvent: %v", err)
+		}
+	}
+}
+
+// handleEvent turns the debug event ev into the stops of the process's
+// threads Linux would report, and returns how the process is to be
+// continued.
+func (t *tracee) handleEvent(ev *debugEvent) (uintptr, error) {
+	u := unsafe.Pointer(&ev.u)
+	switch ev.code {
+	case createProcessDebugEvent:
+		info := (*createProcessDebugInfo)(u)
+		if info.file != 0 {
+			syscall.CloseHandle(info.file)
+		}
+		t.sys.process = info.process
+		t.sys.imageBase = uint64(info.baseOfImage)
+		t.sys.mainThread = ev.threadID
+		// The process stops before it runs, as it does at its exec on
+		// Linux.
+		th := &thread{tid: t.pid, sys: threadSys{handle: info.thread, teb: uint64(info.threadLocalBase)}}
+		t.threads[t.pid] = th
+		if err := th.suspend(); err != nil {
+			return 0, err
+		}
+		return dbgContinue, t.stop(th, stoppedStatus(syscall.SIGTRAP))
+
+	case createThreadDebugEvent:
+		info := (*createThreadDebugInfo)(u)
+		th := &thread{tid: int(ev.threadID), sys: threadSys{handle: info.thread, teb: uint64(info.threadLocalBase)}}
+		if err := th.suspend(); err != nil {
+			return 0, err
+		}
+		t.threadStarted(th)
+
+	case exitThreadDebugEvent:
+		if th := t.thread(ev.threadID); th != nil {
+			t.threadExited(th, exitedStatus(*(*uint32)(u)))
+			// The system closes the thread's handle.
+			th.sys.handle = 0
+		}
+
+	case exitProcessDebugEvent:
+		t.processExited(exitedStatus(*(*uint32)(u)))
+		// The system closes the process's handles.
+		t.sys.process = 0
+
+	case loadDLLDebugEvent:
+		// The first field is a handle of the file loaded.
+		if file := *(*syscall.Handle)(u); file != 0 {
+			syscall.CloseHandle(file)
+		}
+
+	case exceptionDebugEvent:
+		info := (*exceptionDebugInfo)(u)
+		if info.code == exceptionBreakpoint && !t.sys.loaderBroken {
+			t.sys.loaderBroken = true
+			return dbgContinue, nil
+		}
+		sig := exceptionSignal(info.code)
+		th := t.thread(ev.threadID)
+		if sig == 0 || info.firstChance == 0 || th == nil {
+			// Not one the debugger stops for, or one the program
+			// hasn't handled, which ends it.
+			return dbgExceptionNotHandled, nil
+		}
+		if sig == th.sys.deliver {
+			th.sys.deliver = 0
+			return dbgExceptionNotHandled, nil
+		}
+		th.sys.deliver = 0
+		if err := th.suspend(); err != nil {
+			return 0, err
+		}
+		if info.code == exceptionBreakpoint {
+			// The thread is left after the breakpoint instruction, as
+			// on Linux.
+			var regs ptraceRegs
+			if err := th.getRegs(&regs); err != nil {
+				return 0, err
+			}
+			regs.Rip = uint64(info.address) + 1
+			if err := th.setRegs(&regs); err != nil {
+				return 0, err
+			}
+		}
+		return dbgContinue, t.stop(th, stoppedStatus(sig))
+	}
+	return dbgContinue, nil
+}
+
+// thread returns the thread with the system's ID id, or nil if there is
+// none.
+func (t *tracee) thread(id uint32) *thread {
+	tid := int(id)
+	if id == t.sys.mainThread {
+		tid = t.pid
+	}
+	if th, ok := t.threads[tid]; ok && !th.gone {
+		return th
+	}
+	return nil
+}
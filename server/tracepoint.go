@@ -0,0 +1,116 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Tracepoints, which log the values of expressions and let the program carry
+// on.
+
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/server/protocol"
+)
+
+// maxTraceEvents is the number of events kept until the client fetches them.
+const maxTraceEvents = 1024
+
+func (s *Server) SetBreakpointTrace(req *protocol.SetBreakpointTraceRequest, resp *protocol.SetBreakpointTraceResponse) error {
+	return s.call(s.breakpointc, req, resp)
+}
+
+func (s *Server) handleSetBreakpointTrace(req *protocol.SetBreakpointTraceRequest, resp *protocol.SetBreakpointTraceResponse) error {
+	bp, ok := s.userBreakpoints[req.ID]
+	if !ok {
+		return fmt.Errorf("no breakpoint with ID %d", req.ID)
+	}
+	bp.Trace = req.Trace
+	bp.TraceExprs = nil
+	if req.Trace {
+		bp.TraceExprs = append([]string(nil), req.Exprs...)
+	}
+	return nil
+}
+
+// TraceEvents is served like the breakpoint requests, so that events can be
+// collected while the program runs.
+func (s *Server) TraceEvents(req *protocol.TraceEventsRequest, resp *protocol.TraceEventsResponse) error {
+	return s.call(s.breakpointc, req, resp)
+}
+
+func (s *Server) handleTraceEvents(req *protocol.TraceEventsRequest, resp *protocol.TraceEventsResponse) error {
+	resp.Events = s.traceEvents
+	for len(s.traceEvents) > 0 {
+		s.dropOldestTraceEvent()
+	}
+	s.traceEvents = nil
+	return nil
+}
+
+// recordTraceEvent records an event for the tracepoint bp, which the stopped
+// thread has just reached.  Failures to evaluate an expression are recorded
+// in its sample, since the program carries on regardless.
+func (s *Server) recordTraceEvent(bp *debug.Breakpoint) {
+	pc, sp := s.stoppedRegs.Rip, s.stoppedRegs.Rsp
+	ev := debug.TraceEvent{
+		Breakpoint: bp.ID,
+		Time:       time.Now(),
+		Goroutine:  s.stoppedGoroutine(),
+		Thread:     s.stoppedPid,
+		PC:         pc,
+	}
+	for _, expr := range bp.TraceExprs {
+		v, t, err := s.snapshotExpression(expr, pc, sp)
+		sample := debug.Sample{Expression: expr, Value: v, Type: t}
+		if err != nil {
+			sample.Err = err.Error()
+		}
+		ev.Values = append(ev.Values, sample)
+	}
+	// The oldest events make way for the new one, if the buffer is full or
+	// the client's cache quota is used up.
+	if len(s.traceEvents) == maxTraceEvents {
+		s.dropOldestTraceEvent()
+	}
+	n := traceEventBytes(&ev)
+	for s.cache.reserve(n) != nil {
+		if len(s.traceEvents) == 0 {
+			return
+		}
+		s.dropOldestTraceEvent()
+	}
+	s.traceEvents = append(s.traceEvents, ev)
+}
+
+// stoppedGoroutine returns the ID of the goroutine running on the stopped
+// thread, or 0 if it can't be read.
+func (s *Server) stoppedGoroutine() int64 {
+	g, err := s.currentG(&s.stoppedRegs)
+	if err != nil || g == 0 {
+		return 0
+	}
+	gType, err := s.runtimeStruct("runtime.g")
+	if err != nil {
+		return 0
+	}
+	id, err := s.peekUintOrIntStructField(gType, g, "goid")
+	if err != nil {
+		return 0
+	}
+	return int64(id)
+}
+
+// dropOldestTraceEvent removes the oldest event, releasing its memory.
+func (s *Server) dropOldestTraceEvent() {
+	s.cache.release(traceEventBytes(&s.traceEvents[0]))
+	s.traceEvents = s.traceEvents[1:]
+}
+
+// traceEventBytes is roughly the most memory an event takes, counting its
+// values like the entries of a history.
+func traceEventBytes(ev *debug.TraceEvent) int64 {
+	return int64(1+len(ev.Values)) * historyEntryBytes
+}
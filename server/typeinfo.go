@@ -0,0 +1,107 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Describing types by their IDs.
+
+package server
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/dwarf"
+	"golang.org/x/debug/server/protocol"
+)
+
+func (s *Server) Type(req *protocol.TypeRequest, resp *protocol.TypeResponse) error {
+	return s.call(s.otherc, req, resp)
+}
+
+func (s *Server) handleType(req *protocol.TypeRequest, resp *protocol.TypeResponse) error {
+	if s.dwarfData == nil {
+		return fmt.Errorf("no DWARF data")
+	}
+	t, err := s.dwarfData.Type(dwarf.Offset(req.TypeID))
+	if err != nil {
+		return err
+	}
+	info := debug.TypeInfo{
+		TypeID: req.TypeID,
+		Name:   typeName(t),
+		Size:   t.Size(),
+	}
+	u := followTypedefs(t)
+	if k := u.Common().ReflectKind; k != 0 {
+		info.Kind = k.String()
+	}
+	switch u := u.(type) {
+	case *dwarf.InterfaceType:
+		// Interface types carry no kind of their own.
+		info.Kind = "interface"
+	case *dwarf.StructType:
+		for _, f := range u.Field {
+			info.Fields = append(info.Fields, debug.TypeField{
+				Name:     f.Name,
+				TypeID:   uint64(f.Type.Common().Offset),
+				TypeName: typeName(f.Type),
+				Offset:   f.ByteOffset,
+				Embedded: f.Embedded,
+			})
+		}
+	case *dwarf.PtrType:
+		if _, ok := u.Type.(*dwarf.VoidType); !ok && u.Type != nil {
+			info.ElementTypeID = uint64(u.Type.Common().Offset)
+		}
+	case *dwarf.ArrayType:
+		info.ElementTypeID = uint64(u.Type.Common().Offset)
+		info.Length = u.Count
+	case *dwarf.SliceType:
+		info.ElementTypeID = uint64(u.ElemType.Common().Offset)
+	case *dwarf.ChanType:
+		info.ElementTypeID = uint64(u.ElemType.Common().Offset)
+	case *dwarf.MapType:
+		info.KeyTypeID = uint64(u.KeyType.Common().Offset)
+		info.ElementTypeID = uint64(u.ElemType.Common().Offset)
+	}
+	info.Methods = s.methods(info.Name)
+	resp.Info = info
+	return nil
+}
+
+// methods returns the methods of the named type with the given name, found
+// by the names of the functions implementing them: pkg.T.M for a method on
+// T, and pkg.(*T).M for a method on *T.  The compiler also generates
+// pkg.(*T).M for each method on T, which is left out.
+func (s *Server) methods(name string) []debug.TypeMethod {
+	i := strings.LastIndex(name, "/") + 1
+	j := strings.Index(name[i:], ".")
+	if j < 0 {
+		// An unnamed or predeclared type, which has no methods.
+		return nil
+	}
+	pkg, typ := name[:i+j], name[i+j+1:]
+	re, err := regexp.Compile(`^` + regexp.QuoteMeta(symbolPackagePath(pkg)) +
+		`\.(\(\*` + regexp.QuoteMeta(typ) + `\)|` + regexp.QuoteMeta(typ) + `)\.([^.]+)$`)
+	if err != nil {
+		return nil
+	}
+	byName := make(map[string]debug.TypeMethod)
+	for _, fn := range s.dwarfData.LookupMatchingFunctions(re) {
+		m := re.FindStringSubmatch(fn)
+		method := debug.TypeMethod{Name: m[2], Function: fn, PointerReceiver: strings.HasPrefix(m[1], "(")}
+		if prev, ok := byName[method.Name]; ok && !prev.PointerReceiver {
+			continue
+		}
+		byName[method.Name] = method
+	}
+	var methods []debug.TypeMethod
+	for _, m := range byName {
+		methods = append(methods, m)
+	}
+	sort.Slice(methods, func(i, j int) bool { return methods[i].Name < methods[j].Name })
+	return methods
+}
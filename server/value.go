@@ -6,6 +6,8 @@ package server
 
 import (
 	"fmt"
+	"regexp"
+	"strings"
 
 	"golang.org/x/debug"
 	"golang.org/x/debug/dwarf"
@@ -132,10 +134,11 @@ func (s *Server) value(t dwarf.Type, addr uint64) (debug.Value, error) {
 			return nil, fmt.Errorf("array is not byte-aligned")
 		}
 		return debug.Array{
-			ElementTypeID: uint64(t.Type.Common().Offset),
-			Address:       uint64(addr),
-			Length:        uint64(length),
-			StrideBits:    uint64(stride),
+			ElementTypeID:   uint64(t.Type.Common().Offset),
+			ElementTypeName: typeName(t.Type),
+			Address:         uint64(addr),
+			Length:          uint64(length),
+			StrideBits:      uint64(stride),
 		}, nil
 	case *dwarf.StructType:
 		fields := make([]debug.StructField, len(t.Field))
@@ -157,9 +160,11 @@ func (s *Server) value(t dwarf.Type, addr uint64) (debug.Value, error) {
 			return nil, err
 		}
 		return debug.Map{
-			TypeID:  uint64(t.Common().Offset),
-			Address: addr,
-			Length:  length,
+			TypeID:          uint64(t.Common().Offset),
+			KeyTypeName:     typeName(t.KeyType),
+			ElementTypeName: typeName(t.ElemType),
+			Address:         addr,
+			Length:          length,
 		}, nil
 	case *dwarf.StringType:
 		ptr, err := s.peekPtrStructField(&t.StructType, addr, "str")
@@ -199,13 +204,15 @@ func (s *Server) value(t dwarf.Type, addr uint64) (debug.Value, error) {
 		if a == 0 {
 			// This channel is nil.
 			return debug.Channel{
-				ElementTypeID: uint64(t.ElemType.Common().Offset),
-				Address:       0,
-				Buffer:        0,
-				Length:        0,
-				Capacity:      0,
-				Stride:        uint64(t.ElemType.Common().ByteSize),
-				BufferStart:   0,
+				ElementTypeID:   uint64(t.ElemType.Common().Offset),
+				ElementTypeName: typeName(t.ElemType),
+				Dir:             chanDir(t),
+				Address:         0,
+				Buffer:          0,
+				Length:          0,
+				Capacity:        0,
+				Stride:          uint64(t.ElemType.Common().ByteSize),
+				BufferStart:     0,
 			}, nil
 		}
 
@@ -226,23 +233,64 @@ func (s *Server) value(t dwarf.Type, addr uint64) (debug.Value, error) {
 			return nil, fmt.Errorf("reading channel buffer index: %s", err)
 		}
 		return debug.Channel{
-			ElementTypeID: uint64(t.ElemType.Common().Offset),
-			Address:       a,
-			Buffer:        buf,
-			Length:        qcount,
-			Capacity:      capacity,
-			Stride:        uint64(t.ElemType.Common().ByteSize),
-			BufferStart:   recvx,
+			ElementTypeID:   uint64(t.ElemType.Common().Offset),
+			ElementTypeName: typeName(t.ElemType),
+			Dir:             chanDir(t),
+			Address:         a,
+			Buffer:          buf,
+			Length:          qcount,
+			Capacity:        capacity,
+			Stride:          uint64(t.ElemType.Common().ByteSize),
+			BufferStart:     recvx,
 		}, nil
 	case *dwarf.FuncType:
-		a, err := s.peekPtr(addr)
-		if err != nil {
-			return nil, fmt.Errorf("reading func: %s", err)
-		}
-		return debug.Func{Address: a}, nil
+		return s.funcValue(addr)
 	case *dwarf.InterfaceType:
-		return debug.Interface{}, nil
+		return s.interfaceValue(t, addr)
 		// TODO: more types
 	}
 	return nil, fmt.Errorf("Unsupported type %T", t)
 }
+
+// funcValue returns the func value at addr, with the function it refers to.
+func (s *Server) funcValue(addr uint64) (debug.Func, error) {
+	a, err := s.peekPtr(addr)
+	if err != nil {
+		return debug.Func{}, fmt.Errorf("reading func: %s", err)
+	}
+	f := debug.Func{Address: a}
+	if a == 0 {
+		return f, nil
+	}
+	if f.Entry, err = s.peekPtr(a); err != nil {
+		return debug.Func{}, fmt.Errorf("reading func: %s", err)
+	}
+	// Functions written in assembly have no debugging information, so
+	// only their address is known.
+	if entry, _, err := s.pcToFunction(f.Entry); err == nil {
+		f.Name, _ = entry.Val(dwarf.AttrName).(string)
+	}
+	if file, line, err := s.lookupSource(f.Entry); err == nil {
+		f.File, f.Line = file, line
+	}
+	if closureName.MatchString(f.Name) {
+		f.Context = a
+	}
+	return f, nil
+}
+
+// closureName matches the names the compiler gives closures, such as
+// main.f.func1, and main.f.func1.2 for a closure within it.
+var closureName = regexp.MustCompile(`\.func\d+(\.\d+)*$`)
+
+// chanDir returns the direction of a channel type, which DWARF gives only in
+// the type's name.
+func chanDir(t *dwarf.ChanType) debug.ChanDir {
+	switch {
+	case strings.HasPrefix(t.Name, "<-chan "):
+		return debug.RecvDir
+	case strings.HasPrefix(t.Name, "chan<- "):
+		return debug.SendDir
+	}
+	return debug.BothDir
+}
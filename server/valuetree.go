@@ -0,0 +1,113 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Reading values together with the values nested in them.
+
+package server
+
+import (
+	"fmt"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/dwarf"
+	"golang.org/x/debug/server/protocol"
+)
+
+// maxTreeElements is the number of elements of each array or slice that
+// ValueTree expands.
+const maxTreeElements = 100
+
+func (s *Server) ValueTree(req *protocol.ValueTreeRequest, resp *protocol.ValueTreeResponse) error {
+	return s.call(s.otherc, req, resp)
+}
+
+func (s *Server) handleValueTree(req *protocol.ValueTreeRequest, resp *protocol.ValueTreeResponse) error {
+	if req.Depth < 0 {
+		return fmt.Errorf("ValueTree: invalid depth %d", req.Depth)
+	}
+	if _, err := s.dwarfData.Type(dwarf.Offset(req.Var.TypeID)); err != nil {
+		return err
+	}
+	resp.Tree = s.valueTree("", req.Var, req.Depth)
+	return nil
+}
+
+// valueTree reads the value of v, and those nested in it to the given depth.
+// Errors reading values are recorded in the tree's nodes.
+func (s *Server) valueTree(name string, v debug.Var, depth int) debug.ValueTree {
+	n := debug.ValueTree{Name: name, Var: v}
+	t, err := s.dwarfData.Type(dwarf.Offset(v.TypeID))
+	if err == nil {
+		err = s.checkHeapObject(v.Address, uint64(t.Size()))
+	}
+	if err == nil {
+		n.Value, err = s.value(t, v.Address)
+	}
+	if err == nil {
+		n.Value = s.syncValue(v.TypeID, n.Value)
+	}
+	if err != nil {
+		n.Err = err.Error()
+		return n
+	}
+
+	var names []string
+	var vars []debug.Var
+	addElements := func(a debug.Array) {
+		length := a.Length
+		if length > maxTreeElements {
+			length = maxTreeElements
+			n.Truncated = true
+		}
+		for i := uint64(0); i < length; i++ {
+			names = append(names, fmt.Sprintf("[%d]", i))
+			vars = append(vars, a.Element(i))
+		}
+	}
+	addFields := func(st debug.Struct) {
+		for _, f := range st.Fields {
+			names = append(names, f.Name)
+			vars = append(vars, f.Var)
+		}
+	}
+	switch val := n.Value.(type) {
+	case debug.Struct:
+		addFields(val)
+	case debug.Mutex:
+		addFields(val.Struct)
+	case debug.RWMutex:
+		addFields(val.Struct)
+	case debug.WaitGroup:
+		addFields(val.Struct)
+	case debug.Array:
+		addElements(val)
+	case debug.Slice:
+		addElements(val.Array)
+	case debug.Pointer:
+		// Nil pointers, and unsafe.Pointers, whose targets have no type,
+		// have nothing to expand.
+		if val.Address == 0 || val.TypeID == 0 {
+			break
+		}
+		if tt, err := s.dwarfData.Type(dwarf.Offset(val.TypeID)); err != nil {
+			break
+		} else if _, ok := tt.(*dwarf.VoidType); ok {
+			break
+		}
+		names = append(names, "*")
+		vars = append(vars, debug.Var{TypeID: val.TypeID, Address: val.Address})
+	}
+	if len(vars) == 0 {
+		return n
+	}
+	if depth == 0 {
+		n.Truncated = true
+		return n
+	}
+	n.Children = make([]debug.ValueTree, len(vars))
+	for i := range vars {
+		n.Children[i] = s.valueTree(names[i], vars[i], depth-1)
+	}
+	return n
+}
@@ -0,0 +1,353 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Hardware watchpoints, implemented with the x86 debug registers.
+
+package server
+
+import (
+	"fmt"
+	"sort"
+	"syscall"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/server/protocol"
+)
+
+const (
+	// numDebugRegs is the number of debug address registers, DR0-DR3.
+	numDebugRegs = 4
+	// debugRegOffset is the offset of u_debugreg in the Linux amd64 struct user,
+	// as used by PTRACE_PEEKUSR and PTRACE_POKEUSR.
+	debugRegOffset = 848
+	dr6            = debugRegOffset + 6*8
+	dr7            = debugRegOffset + 7*8
+)
+
+// watchRegion is a naturally aligned region of 1, 2, 4 or 8 bytes, which is
+// what a single debug register can watch.
+type watchRegion struct {
+	addr uint64
+	size uint64
+}
+
+// lenBits returns the encoding of the region's size in the LEN field of DR7.
+func (r watchRegion) lenBits() uint64 {
+	switch r.size {
+	case 1:
+		return 0
+	case 2:
+		return 1
+	case 8:
+		return 2
+	}
+	return 3
+}
+
+type watchpoint struct {
+	debug.Watchpoint
+	regions []watchRegion
+	monitor *mapMonitor // Non-nil for watchpoints set by WatchMap.
+}
+
+// watchRegions splits the size bytes at addr into regions that can each be
+// watched by one debug register.
+func watchRegions(addr, size uint64) []watchRegion {
+	var regions []watchRegion
+	for size > 0 {
+		n := uint64(8)
+		for n > size || addr%n != 0 {
+			n /= 2
+		}
+		regions = append(regions, watchRegion{addr, n})
+		addr += n
+		size -= n
+	}
+	return regions
+}
+
+func (s *Server) WatchGlobal(req *protocol.WatchGlobalRequest, resp *protocol.WatchGlobalResponse) error {
+	return s.call(s.controlc, req, resp)
+}
+
+func (s *Server) handleWatchGlobal(req *protocol.WatchGlobalRequest, resp *protocol.WatchGlobalResponse) error {
+	entry, err := s.dwarfData.LookupVariable(req.Name)
+	if err != nil {
+		return fmt.Errorf("variable %s: %s", req.Name, err)
+	}
+	addr, err := s.entryLocation(entry)
+	if err != nil {
+		return fmt.Errorf("variable %s: %s", req.Name, err)
+	}
+	t, err := s.dwarfData.EntryType(entry)
+	if err != nil {
+		return fmt.Errorf("variable %s: %s", req.Name, err)
+	}
+	size := t.Size()
+	if size <= 0 {
+		return fmt.Errorf("variable %s has size %d", req.Name, size)
+	}
+	regions := watchRegions(addr, uint64(size))
+	used := 0
+	for _, w := range s.watchpoints {
+		used += len(w.regions)
+	}
+	if used+len(regions) > numDebugRegs {
+		return fmt.Errorf("watching %s needs %d debug registers, but only %d are free", req.Name, len(regions), numDebugRegs-used)
+	}
+	s.nextWatchpointID++
+	w := &watchpoint{
+		Watchpoint: debug.Watchpoint{
+			ID:      s.nextWatchpointID,
+			Name:    req.Name,
+			Address: addr,
+			Size:    uint64(size),
+		},
+		regions: regions,
+	}
+	s.watchpoints[w.ID] = w
+	resp.Watchpoint = w.Watchpoint
+	return nil
+}
+
+func (s *Server) DeleteWatchpoints(req *protocol.DeleteWatchpointsRequest, resp *protocol.DeleteWatchpointsResponse) error {
+	return s.call(s.controlc, req, resp)
+}
+
+func (s *Server) handleDeleteWatchpoints(req *protocol.DeleteWatchpointsRequest, resp *protocol.DeleteWatchpointsResponse) error {
+	for _, id := range req.IDs {
+		delete(s.watchpoints, id)
+	}
+	return nil
+}
+
+// debugReg is what one debug register watches: a region of a watchpoint.
+type debugReg struct {
+	region watchRegion
+	w      *watchpoint
+}
+
+// debugRegs returns what each debug register watches, in the order of the
+// registers: the regions of the watchpoints, in order of their IDs.
+func (s *Server) debugRegs() []debugReg {
+	ids := make([]uint64, 0, len(s.watchpoints))
+	for id := range s.watchpoints {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	var regs []debugReg
+	for _, id := range ids {
+		w := s.watchpoints[id]
+		for _, r := range w.regions {
+			regs = append(regs, debugReg{r, w})
+		}
+	}
+	return regs
+}
+
+// stoppedThreads returns the IDs of the threads of the stopped process: the
+// one that stopped it and those stopped along with it.
+func (s *Server) stoppedThreads() []int {
+	tids := []int{s.stoppedPid}
+	for tid := range s.otherThreads {
+		tids = append(tids, tid)
+	}
+	return tids
+}
+
+// setWatchpoints loads the debug registers of each thread of the stopped
+// process with the current watchpoints, since each thread has its own.
+// Threads created after this get them from watchNewThread.
+func (s *Server) setWatchpoints() error {
+	if len(s.watchpoints) == 0 && !s.watchRegsSet {
+		return nil
+	}
+	regs := s.debugRegs()
+	for _, tid := range s.stoppedThreads() {
+		if err := s.loadDebugRegs(tid, regs); err == syscall.ESRCH {
+			// The thread has exited.
+			continue
+		} else if err != nil {
+			return fmt.Errorf("setWatchpoints: %v", err)
+		}
+	}
+	s.watchRegsSet = len(s.watchpoints) > 0
+	return nil
+}
+
+// loadDebugRegs loads the debug registers of the stopped thread tid so that
+// they watch regs.
+func (s *Server) loadDebugRegs(tid int, regs []debugReg) error {
+	var control uint64
+	for reg, d := range regs {
+		r := d.region
+		if err := s.ptracePokeUser(tid, uintptr(debugRegOffset+reg*8), r.addr); err != nil {
+			return err
+		}
+		// Enable the register locally, breaking on data writes (RW = 01).
+		control |= 1<<(2*uint(reg)) | (1|r.lenBits()<<2)<<(16+4*uint(reg))
+	}
+	return s.ptracePokeUser(tid, dr7, control)
+}
+
+// watchNewThread loads the debug registers of tid, a thread the process has
+// just created, which the kernel starts with none set, with the watchpoints.
+// It is called at the thread's first stop, before it runs.
+func (s *Server) watchNewThread(tid int) error {
+	if !s.watchRegsSet {
+		return nil
+	}
+	if err := s.loadDebugRegs(tid, s.debugRegs()); err != nil && err != syscall.ESRCH {
+		return fmt.Errorf("setting watchpoints for thread %d: %v", tid, err)
+	}
+	return nil
+}
+
+// clearWatchpoints clears the debug registers of each thread of the stopped
+// process, so that it can run without the debugger.
+func (s *Server) clearWatchpoints() error {
+	if !s.watchRegsSet {
+		return nil
+	}
+	for _, tid := range s.stoppedThreads() {
+		if err := s.ptracePokeUser(tid, dr7, 0); err == syscall.ESRCH {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("clearing watchpoints: %v", err)
+		}
+		if err := s.ptracePokeUser(tid, dr6, 0); err != nil && err != syscall.ESRCH {
+			return fmt.Errorf("clearing watchpoints: %v", err)
+		}
+	}
+	s.watchRegsSet = false
+	return nil
+}
+
+// watchpointHit reports whether the thread that stopped the process,
+// stoppedPid, stopped because a watchpoint was triggered, and if so resets
+// its debug status register.
+// stop reports whether one of the triggered watchpoints should stop the
+// process, which is always so except for those set by WatchMap; the IDs of
+// those that do are put in s.hitWatchpoints.
+func (s *Server) watchpointHit() (hit, stop bool, err error) {
+	hit, s.hitWatchpoints, err = s.triggeredWatchpoints(s.stoppedPid)
+	return hit, len(s.hitWatchpoints) > 0, err
+}
+
+// queueWatchpointHit records the watchpoints triggered by the stopped thread
+// tid, if any, for the next Resume to report, and reports whether a
+// watchpoint caused the thread's trap.  It is for threads found at a trap
+// while the process is being stopped for another's, which is the only one
+// whose stop is reported at once.  The debug status register is reset, so
+// that it doesn't make the thread's next trap look like a watchpoint's.
+func (s *Server) queueWatchpointHit(tid int) (bool, error) {
+	hit, ids, err := s.triggeredWatchpoints(tid)
+	if err != nil || len(ids) == 0 {
+		return hit, err
+	}
+	if s.queuedWatchHits == nil {
+		s.queuedWatchHits = make(map[int][]uint64)
+	}
+	// The thread may have been queued before, by an earlier stop it hasn't
+	// been continued since.
+queued:
+	for _, id := range ids {
+		for _, q := range s.queuedWatchHits[tid] {
+			if q == id {
+				continue queued
+			}
+		}
+		s.queuedWatchHits[tid] = append(s.queuedWatchHits[tid], id)
+	}
+	return true, nil
+}
+
+// takeQueuedWatchpointHit makes a thread whose watchpoint hits were queued
+// by queueWatchpointHit, and which is still stopped, the stopped thread, as
+// though it had just stopped the process, with the watchpoints it triggered
+// in s.hitWatchpoints.  It reports whether there was such a thread.  The
+// thread that was stopped is left among the other threads; if it was at a
+// breakpoint, it hits it again when it is continued.
+func (s *Server) takeQueuedWatchpointHit() (bool, error) {
+	tids := make([]int, 0, len(s.queuedWatchHits))
+	for tid := range s.queuedWatchHits {
+		tids = append(tids, tid)
+	}
+	sort.Ints(tids)
+	for _, tid := range tids {
+		queued := s.queuedWatchHits[tid]
+		delete(s.queuedWatchHits, tid)
+		pending, ok := s.otherThreads[tid]
+		if !ok {
+			continue
+		}
+		// Watchpoints deleted since aren't reported.
+		var ids []uint64
+		for _, id := range queued {
+			if _, ok := s.watchpoints[id]; ok {
+				ids = append(ids, id)
+			}
+		}
+		if len(ids) == 0 {
+			continue
+		}
+		var regs ptraceRegs
+		if err := s.ptraceGetRegs(tid, &regs); err == syscall.ESRCH {
+			// The thread has exited.
+			continue
+		} else if err != nil {
+			return false, fmt.Errorf("ptraceGetRegs: %v", err)
+		}
+		delete(s.otherThreads, tid)
+		s.otherThreads[s.stoppedPid] = s.stoppedPending
+		s.stoppedPid, s.stoppedRegs, s.stoppedPending = tid, regs, pending
+		s.selectedFrame = nil
+		s.commandResults = nil
+		s.hitBreakpoints = nil
+		s.hitWatchpoints = ids
+		return true, nil
+	}
+	return false, nil
+}
+
+// triggeredWatchpoints reports whether the stopped thread tid stopped because
+// a watchpoint was triggered, and if so resets its debug status register.  ids
+// are the IDs of the triggered watchpoints that should stop the process,
+// which is all of them except those set by WatchMap whose maps haven't
+// changed.
+func (s *Server) triggeredWatchpoints(tid int) (hit bool, ids []uint64, err error) {
+	if !s.watchRegsSet {
+		return false, nil, nil
+	}
+	status, err := s.ptracePeekUser(tid, dr6)
+	if err != nil {
+		return false, nil, fmt.Errorf("reading debug status: %v", err)
+	}
+	if status&(1<<numDebugRegs-1) == 0 {
+		return false, nil, nil
+	}
+	if err := s.ptracePokeUser(tid, dr6, 0); err != nil {
+		return false, nil, fmt.Errorf("resetting debug status: %v", err)
+	}
+	for reg, d := range s.debugRegs() {
+		if status&(1<<uint(reg)) == 0 {
+			continue
+		}
+		if d.w.monitor != nil {
+			changed, err := s.mapChanged(d.w.monitor)
+			if err != nil {
+				return true, nil, err
+			}
+			if !changed {
+				continue
+			}
+		}
+		// The registers are in order of watchpoint ID, and a watchpoint's
+		// are together.
+		if n := len(ids); n == 0 || ids[n-1] != d.w.ID {
+			ids = append(ids, d.w.ID)
+		}
+	}
+	return true, ids, nil
+}
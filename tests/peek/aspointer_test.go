@@ -0,0 +1,81 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import (
+	"testing"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/local"
+)
+
+func TestAsPointer(t *testing.T) {
+	prog, err := local.New(buildTestProgram(t, "pointers"))
+	if err != nil {
+		t.Fatal("local.New:", err)
+	}
+	defer prog.Kill()
+	if _, err := prog.Run(); err != nil {
+		t.Fatal("Run:", err)
+	}
+	if _, err := prog.BreakpointAtFunction("main.stop"); err != nil {
+		t.Fatal("BreakpointAtFunction:", err)
+	}
+	if _, err := prog.Resume(); err != nil {
+		t.Fatal("Resume:", err)
+	}
+
+	tests := []struct {
+		expr  string
+		value int64
+	}{
+		{"main.addr", 7},
+		{"main.ptr", 8},
+	}
+	for _, tt := range tests {
+		v, _, err := prog.Evaluate(tt.expr)
+		if err != nil {
+			t.Fatalf("Evaluate(%q): %v", tt.expr, err)
+		}
+		node, err := prog.AsPointer(v, "main.node")
+		if err != nil {
+			t.Errorf("AsPointer(%s): %v", tt.expr, err)
+			continue
+		}
+		s, err := prog.Value(node)
+		if err != nil {
+			t.Errorf("%s: Value: %v", tt.expr, err)
+			continue
+		}
+		fields := s.(debug.Struct).Fields
+		if len(fields) != 2 || fields[0].Name != "value" {
+			t.Errorf("%s: got fields %+v, want value and next", tt.expr, fields)
+			continue
+		}
+		if got, err := prog.Value(fields[0].Var); err != nil || got != tt.value {
+			t.Errorf("%s: got value %v (error %v), want %d", tt.expr, got, err, tt.value)
+		}
+	}
+
+	addr, _, err := prog.Evaluate("main.addr")
+	if err != nil {
+		t.Fatal("Evaluate:", err)
+	}
+	errorTests := []struct {
+		name     string
+		v        debug.Value
+		typeName string
+	}{
+		{"unmapped address", uint64(8), "main.node"},
+		{"nil", uint64(0), "main.node"},
+		{"not a pointer", int64(8), "main.node"},
+		{"unknown type", addr, "main.nosuchtype"},
+	}
+	for _, tt := range errorTests {
+		if _, err := prog.AsPointer(tt.v, tt.typeName); err == nil {
+			t.Errorf("AsPointer of %s succeeded", tt.name)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/debug/local"
+)
+
+func TestBreakpointCaller(t *testing.T) {
+	for _, caller := range []string{"main.wanted", "main.outer"} {
+		prog, err := local.New(buildTestProgram(t, "callers"))
+		if err != nil {
+			t.Fatal("local.New:", err)
+		}
+		if _, err := prog.Run(); err != nil {
+			t.Fatal("Run:", err)
+		}
+		bp, err := prog.BreakpointAtFunction("main.count")
+		if err != nil {
+			t.Fatal("BreakpointAtFunction:", err)
+		}
+		if err := prog.SetBreakpointCaller(bp.ID, caller); err != nil {
+			t.Fatal("SetBreakpointCaller:", err)
+		}
+
+		// main.count is called from main.other first, and then from
+		// main.wanted, called by main.outer, which is the only call the
+		// program stops for.
+		status, err := prog.Resume()
+		if err != nil {
+			t.Fatalf("caller %s: Resume: %v", caller, err)
+		}
+		if status.Reason != "breakpoint" || !reflect.DeepEqual(status.Breakpoints, []uint64{bp.ID}) {
+			t.Errorf("caller %s: stopped for %q at breakpoints %v, want breakpoint %d", caller, status.Reason, status.Breakpoints, bp.ID)
+		}
+		if v, _, err := prog.Evaluate("main.calls"); err != nil || v != int64(1) {
+			t.Errorf("caller %s: main.calls = %v (error %v), want 1", caller, v, err)
+		}
+		frames, err := prog.Frames(2)
+		if err != nil {
+			t.Fatal("Frames:", err)
+		}
+		if len(frames) < 2 || frames[1].Function != "main.wanted" {
+			t.Errorf("caller %s: got frames %+v, want main.count called by main.wanted", caller, frames)
+		}
+		if _, err := prog.Resume(); err == nil {
+			t.Errorf("caller %s: program stopped again after the call from main.wanted", caller)
+		}
+		prog.Kill()
+	}
+}
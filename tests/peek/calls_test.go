@@ -0,0 +1,92 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/local"
+)
+
+func TestCallFunction(t *testing.T) {
+	prog, err := local.New(buildTestProgram(t, "calls"))
+	if err != nil {
+		t.Fatal("local.New:", err)
+	}
+	defer prog.Kill()
+	if _, err := prog.Run(); err != nil {
+		t.Fatal("Run:", err)
+	}
+	if _, err := prog.BreakpointAtLine("testdata/calls/main.go", 48); err != nil {
+		t.Fatal("BreakpointAtLine:", err)
+	}
+	if _, err := prog.Resume(); err != nil {
+		t.Fatal("Resume:", err)
+	}
+	before, err := prog.Frames(1)
+	if err != nil {
+		t.Fatal("Frames:", err)
+	}
+
+	tests := []struct {
+		expr string
+		want debug.Value
+	}{
+		{"main.Sum(3, 4)", int64(7)},
+		{"main.Sum(main.total, -1)", int64(2)},
+		{"main.Sum(main.Sum(1, 2), 3) * 2", int64(12)},
+		{"main.Half(5)", float64(2.5)},
+		{"main.Greeting(true)", "good day"},
+		{"main.Greeting(false)", "hi"},
+		// Calls can change the program's state.
+		{"main.AddToTotal(10)", int64(13)},
+		{"main.total", int64(13)},
+	}
+	for _, tt := range tests {
+		got, _, err := prog.Evaluate(tt.expr)
+		if err != nil {
+			t.Errorf("Evaluate(%q): %v", tt.expr, err)
+			continue
+		}
+		if s, ok := got.(debug.String); ok {
+			got = s.String
+		}
+		if got != tt.want {
+			t.Errorf("Evaluate(%q): got %#v, want %#v", tt.expr, got, tt.want)
+		}
+	}
+
+	errorTests := []struct {
+		expr string
+		err  string
+	}{
+		{"main.Sum(1)", "takes 2 arguments, not 1"},
+		{"main.Sum(1, true)", "can't use true as int"},
+		{"main.Sum(9223372036854775808, 1)", "overflows int"},
+		{"main.Pair()", "only functions with one result"},
+		{"main.Fail(1)", "the function panicked"},
+	}
+	for _, tt := range errorTests {
+		if _, _, err := prog.Evaluate(tt.expr); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Evaluate(%q): got error %v, want %q", tt.expr, err, tt.err)
+		}
+	}
+
+	// The program is left where it was stopped, and carries on from there.
+	after, err := prog.Frames(1)
+	if err != nil {
+		t.Fatal("Frames:", err)
+	}
+	if after[0].PC != before[0].PC || after[0].SP != before[0].SP {
+		t.Errorf("after the calls, stopped at PC %#x, SP %#x; want %#x, %#x", after[0].PC, after[0].SP, before[0].PC, before[0].SP)
+	}
+	if _, err := prog.Resume(); err == nil {
+		t.Error("Resume: the program didn't exit")
+	} else if exited, ok := err.(*debug.ProcessExited); !ok || exited.ExitStatus != 0 {
+		t.Errorf("Resume: got error %v, want an exit with status 0", err)
+	}
+}
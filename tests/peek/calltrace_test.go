@@ -0,0 +1,82 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/local"
+)
+
+// checkCall checks that e reports a call of fn with the given arguments.
+func checkCall(t *testing.T, e debug.Event, fn string, args ...string) {
+	if e.Kind != "call" || e.Call == nil {
+		t.Errorf("got event %+v, want a call of %s", e, fn)
+		return
+	}
+	c := e.Call
+	var got []string
+	for _, p := range c.Args {
+		got = append(got, p.Name+"="+p.Value)
+	}
+	if c.Function != fn || !reflect.DeepEqual(got, args) {
+		t.Errorf("got call of %s with arguments %v, want %s with %v", c.Function, got, fn, args)
+	}
+	if c.Goroutine == 0 || c.Thread == 0 || c.Start.IsZero() || c.Duration <= 0 {
+		t.Errorf("call of %s: got goroutine %d, thread %d, start %v, duration %v", fn, c.Goroutine, c.Thread, c.Start, c.Duration)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	prog, err := local.New(buildTestProgram(t, "calls"))
+	if err != nil {
+		t.Fatal("local.New:", err)
+	}
+	defer prog.Kill()
+	if _, err := prog.Run(); err != nil {
+		t.Fatal("Run:", err)
+	}
+	if _, err := prog.BreakpointAtLine("testdata/calls/main.go", 48); err != nil {
+		t.Fatal("BreakpointAtLine:", err)
+	}
+	if _, err := prog.Trace("main.(Sum"); err == nil {
+		t.Error("Trace of an invalid regular expression succeeded")
+	}
+	fns, err := prog.Trace(`^main\.(Sum|Half)$`)
+	if err != nil {
+		t.Fatal("Trace:", err)
+	}
+	if want := []string{"main.Half", "main.Sum"}; !reflect.DeepEqual(fns, want) {
+		t.Errorf("Trace: got functions %v, want %v", fns, want)
+	}
+
+	// The program doesn't stop for traced calls.
+	status, err := prog.Resume()
+	if err != nil {
+		t.Fatal("Resume:", err)
+	}
+	if status.Reason != "breakpoint" {
+		t.Errorf("Resume: got status %+v, want a stop at line 48", status)
+	}
+	checkCall(t, nextEvent(t, prog), "main.Sum", "a=1", "b=2")
+	if fns, err = prog.Trace(""); err != nil || len(fns) != 0 {
+		t.Errorf("Trace to stop tracing: got functions %v, error %v", fns, err)
+	}
+
+	// Tracing starts again with other functions, so Half's call isn't
+	// reported.
+	if fns, err = prog.Trace(`^main\.Greeting$`); err != nil {
+		t.Fatal("Trace:", err)
+	}
+	if want := []string{"main.Greeting"}; !reflect.DeepEqual(fns, want) {
+		t.Errorf("Trace: got functions %v, want %v", fns, want)
+	}
+	if _, err := prog.Resume(); err == nil {
+		t.Error("Resume: the program didn't exit")
+	}
+	checkCall(t, nextEvent(t, prog), "main.Greeting", "formal=false")
+}
@@ -0,0 +1,85 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/local"
+)
+
+func TestChannelWaiters(t *testing.T) {
+	prog, err := local.New(buildTestProgram(t, "blocked"))
+	if err != nil {
+		t.Fatal("local.New:", err)
+	}
+	defer prog.Kill()
+	if _, err := prog.Run(); err != nil {
+		t.Fatal("Run:", err)
+	}
+	if _, err := prog.BreakpointAtFunction("main.stop"); err != nil {
+		t.Fatal("BreakpointAtFunction:", err)
+	}
+	channel := func(name string) debug.Channel {
+		v, _, err := prog.Evaluate(name)
+		if err != nil {
+			t.Fatalf("Evaluate(%q): %v", name, err)
+		}
+		c, ok := v.(debug.Channel)
+		if !ok {
+			t.Fatalf("Evaluate(%q): got %T, want a channel", name, v)
+		}
+		return c
+	}
+
+	// The program stops repeatedly, until its goroutines have all blocked.
+	var values, quit []debug.ChannelWaiter
+	for i := 0; len(values) < 2 || len(quit) < 1; i++ {
+		if i == 100 {
+			t.Fatalf("got waiters %+v and %+v, want 2 and 1", values, quit)
+		}
+		if _, err := prog.Resume(); err != nil {
+			t.Fatal("Resume:", err)
+		}
+		if values, err = prog.ChannelWaiters(channel("main.values")); err != nil {
+			t.Fatal("ChannelWaiters(main.values):", err)
+		}
+		if quit, err = prog.ChannelWaiters(channel("main.quit")); err != nil {
+			t.Fatal("ChannelWaiters(main.quit):", err)
+		}
+	}
+
+	// The senders' order depends on which goroutine ran first.
+	var sent []int64
+	for _, w := range values {
+		if !w.Send || w.Select || w.Goroutine == 0 || w.Function != "main.send" || !strings.HasSuffix(w.File, "testdata/blocked/main.go") || w.Line != 19 || w.PC == 0 {
+			t.Errorf("main.values: got waiter %+v, want a sender in main.send at line 19", w)
+		}
+		v, err := prog.Value(w.Value)
+		if err != nil {
+			t.Errorf("main.values: reading the value sent by goroutine %d: %v", w.Goroutine, err)
+			continue
+		}
+		if n, ok := v.(int64); ok {
+			sent = append(sent, n)
+		}
+	}
+	sort.Slice(sent, func(i, j int) bool { return sent[i] < sent[j] })
+	if len(sent) != 2 || sent[0] != 1 || sent[1] != 2 {
+		t.Errorf("main.values: got values sent %v, want 1 and 2", sent)
+	}
+	if len(quit) != 1 {
+		t.Fatalf("main.quit: got waiters %+v, want 1", quit)
+	}
+	if w := quit[0]; w.Send || !w.Select || w.Function != "main.wait" || w.Line != 24 || w.Value.Address != 0 {
+		t.Errorf("main.quit: got waiter %+v, want a receiver in a select in main.wait at line 24", w)
+	}
+	if w, err := prog.ChannelWaiters(channel("main.none")); err != nil || len(w) != 0 {
+		t.Errorf("ChannelWaiters(main.none): got %+v, error %v; want none", w, err)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import "testing"
+
+func TestBreakpointCommands(t *testing.T) {
+	prog, first, second := startRewind(t, false)
+	defer prog.Kill()
+
+	errorTests := []struct {
+		id       uint64
+		commands []string
+	}{
+		{1000, nil},
+		{first.ID, []string{"continue", "main.value"}},
+		{first.ID, []string{"main.value +"}},
+	}
+	for _, tt := range errorTests {
+		if err := prog.SetBreakpointCommands(tt.id, tt.commands); err == nil {
+			t.Errorf("SetBreakpointCommands(%d, %q) succeeded", tt.id, tt.commands)
+		}
+	}
+	if err := prog.SetBreakpointCommands(first.ID, []string{"main.value", "main.nosuchvariable", "continue"}); err != nil {
+		t.Fatal("SetBreakpointCommands:", err)
+	}
+	if err := prog.SetBreakpointCommands(second.ID, []string{"main.value"}); err != nil {
+		t.Fatal("SetBreakpointCommands:", err)
+	}
+
+	// The program carries on past the first breakpoint, whose results come
+	// as an event, and stops at the second, whose results come with the
+	// status.
+	status, err := prog.Resume()
+	if err != nil {
+		t.Fatal("Resume:", err)
+	}
+	checkStop(t, prog, "Resume", status, "breakpoint", second, 2)
+	e := nextEvent(t, prog)
+	if e.Kind != "commands" || e.Commands == nil {
+		t.Fatalf("got event %+v, want the results of the first breakpoint's commands", e)
+	}
+	r := e.Commands
+	if r.Breakpoint != first.ID || r.PC != first.PCs[0] || r.Goroutine == 0 || r.Thread == 0 || len(r.Values) != 2 {
+		t.Fatalf("got results %+v, want 2 values at breakpoint %d", r, first.ID)
+	}
+	if v := r.Values[0]; v.Expression != "main.value" || v.Err != "" || v.Value != int64(1) {
+		t.Errorf("got value %+v, want main.value = 1", v)
+	}
+	if v := r.Values[1]; v.Expression != "main.nosuchvariable" || v.Err == "" {
+		t.Errorf("got value %+v, want an error", v)
+	}
+	if len(status.Commands) != 1 {
+		t.Fatalf("got status commands %+v, want the second breakpoint's", status.Commands)
+	}
+	if r := status.Commands[0]; r.Breakpoint != second.ID || len(r.Values) != 1 || r.Values[0].Expression != "main.value" || r.Values[0].Value != int64(2) || r.Values[0].Err != "" {
+		t.Errorf("got status commands %+v, want main.value = 2 at breakpoint %d", r, second.ID)
+	}
+
+	// Without commands, the first breakpoint stops the program again.
+	if err := prog.SetBreakpointCommands(first.ID, nil); err != nil {
+		t.Fatal("SetBreakpointCommands:", err)
+	}
+	if _, err := prog.Restart(true); err != nil {
+		t.Fatal("Restart:", err)
+	}
+	if status, err = prog.Resume(); err != nil {
+		t.Fatal("Resume:", err)
+	}
+	checkStop(t, prog, "Resume after Restart", status, "breakpoint", first, 1)
+	if len(status.Commands) != 0 {
+		t.Errorf("Resume after Restart: got status commands %+v, want none", status.Commands)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/debug"
+)
+
+func TestDeferredCalls(t *testing.T) {
+	prog := startPanics(t)
+	defer prog.Kill()
+
+	// check checks that the deferred calls listed with the given arguments
+	// are the single call want, deferred at line.
+	check := func(goroutine int64, frameIndex int, want string, line uint64, recovers bool, args ...string) {
+		calls, err := prog.DeferredCalls(goroutine, frameIndex)
+		if err != nil {
+			t.Errorf("DeferredCalls(%d, %d): %v", goroutine, frameIndex, err)
+			return
+		}
+		if want == "" {
+			if len(calls) != 0 {
+				t.Errorf("DeferredCalls(%d, %d): got %+v, want none", goroutine, frameIndex, calls)
+			}
+			return
+		}
+		if len(calls) != 1 {
+			t.Errorf("DeferredCalls(%d, %d): got %+v, want a call of %s", goroutine, frameIndex, calls, want)
+			return
+		}
+		c := calls[0]
+		var got []string
+		for _, p := range c.Args {
+			got = append(got, p.Value)
+		}
+		if c.Function != want || !strings.HasSuffix(c.File, "testdata/panics/main.go") || c.Line != line || c.Recovers != recovers || strings.Join(got, ",") != strings.Join(args, ",") {
+			t.Errorf("DeferredCalls(%d, %d): got %s deferred at %s:%d with arguments %v, recovers %t; want %s at line %d with %v, recovers %t",
+				goroutine, frameIndex, c.Function, c.File, c.Line, got, c.Recovers, want, line, args, recovers)
+		}
+	}
+
+	// Stopped in runtime.gopanic, called by main.recovering, which
+	// deferred a closure that recovers.
+	if _, err := prog.Resume(); err != nil {
+		t.Fatal("Resume:", err)
+	}
+	check(0, -1, "main.recovering.func1", 21, true)
+	check(1, -1, "main.recovering.func1", 21, true)
+	check(0, 0, "", 0, false)
+	check(0, 1, "main.recovering.func1", 21, true)
+	check(0, 2, "", 0, false)
+	if _, err := prog.DeferredCalls(0, 100); err == nil {
+		t.Error("DeferredCalls of a missing frame succeeded")
+	}
+	if _, err := prog.DeferredCalls(1000, -1); err == nil {
+		t.Error("DeferredCalls of a missing goroutine succeeded")
+	}
+
+	// Stopped in runtime.gopanic again, called by main.crash, which
+	// deferred a call of cleanup with its argument.
+	var calls []debug.DeferredCall
+	for len(calls) == 0 || calls[0].Function == "main.recovering.func1" {
+		if _, err := prog.Resume(); err != nil {
+			t.Fatal("Resume:", err)
+		}
+		var err error
+		if calls, err = prog.DeferredCalls(0, -1); err != nil {
+			t.Fatal("DeferredCalls:", err)
+		}
+	}
+	check(0, -1, "main.crash.deferwrap1", 30, false, "7")
+	check(0, 1, "main.crash.deferwrap1", 30, false, "7")
+}
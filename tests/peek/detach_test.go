@@ -0,0 +1,86 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/debug/local"
+)
+
+// processOf returns the ID of the process that thread tid belongs to.
+func processOf(t *testing.T, tid int) int {
+	b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/status", tid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		var pid int
+		if _, err := fmt.Sscanf(line, "Tgid: %d", &pid); err == nil {
+			return pid
+		}
+	}
+	t.Fatalf("no Tgid in /proc/%d/status", tid)
+	return 0
+}
+
+func TestDetach(t *testing.T) {
+	prog, err := local.New(buildTestProgram(t, "rewind"))
+	if err != nil {
+		t.Fatal("local.New:", err)
+	}
+	defer prog.Kill()
+	if err := prog.SetKillOnExit(false); err != nil {
+		t.Fatal("SetKillOnExit:", err)
+	}
+	if _, err := prog.Run(); err != nil {
+		t.Fatal("Run:", err)
+	}
+	for _, f := range []string{"main.first", "main.second"} {
+		if _, err := prog.BreakpointAtFunction(f); err != nil {
+			t.Fatal("BreakpointAtFunction:", err)
+		}
+	}
+	if _, err := prog.WatchGlobal("main.value"); err != nil {
+		t.Fatal("WatchGlobal:", err)
+	}
+	status, err := prog.Resume()
+	if err != nil {
+		t.Fatal("Resume:", err)
+	}
+	pid := processOf(t, status.Thread)
+	if err := prog.Detach(); err != nil {
+		t.Fatal("Detach:", err)
+	}
+
+	// Left to itself, the process runs past where its breakpoints and
+	// watchpoint were, and exits normally.
+	done := make(chan error, 1)
+	var ws syscall.WaitStatus
+	go func() {
+		_, err := syscall.Wait4(pid, &ws, 0, nil)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal("Wait4:", err)
+		}
+	case <-time.After(10 * time.Second):
+		syscall.Kill(pid, syscall.SIGKILL)
+		t.Fatal("the process didn't exit after Detach")
+	}
+	if !ws.Exited() || ws.ExitStatus() != 0 {
+		t.Errorf("after Detach, the process ended with status %#x, want an exit with status 0", ws)
+	}
+	if _, err := prog.Resume(); err == nil {
+		t.Error("Resume after Detach succeeded")
+	}
+}
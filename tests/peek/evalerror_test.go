@@ -0,0 +1,62 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import (
+	"testing"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/local"
+)
+
+func TestExpressionError(t *testing.T) {
+	prog, err := local.New(buildTestProgram(t, "format"))
+	if err != nil {
+		t.Fatal("local.New:", err)
+	}
+	defer prog.Kill()
+	if _, err := prog.Run(); err != nil {
+		t.Fatal("Run:", err)
+	}
+	if _, err := prog.BreakpointAtFunction("main.stop"); err != nil {
+		t.Fatal("BreakpointAtFunction:", err)
+	}
+	if _, err := prog.Resume(); err != nil {
+		t.Fatal("Resume:", err)
+	}
+
+	tests := []struct {
+		expr       string
+		kind       string
+		start, end int
+		reason     string
+		message    string
+	}{
+		{"main.nums[", "parse", 10, 10, "expected operand, found 'EOF'", "expected operand, found 'EOF' at end of expression"},
+		{")", "parse", 0, 1, "expected operand, found ')'", `expected operand, found ')': ")"`},
+		{"main.nosuch + 1", "type", 0, 11, "unknown identifier", `unknown identifier: "main.nosuch"`},
+		{"nosuch.n", "type", 0, 8, "unknown identifier", `unknown identifier: "nosuch.n"`},
+		{"main.n + main.str", "type", 0, 17, "type mismatch", `type mismatch: "main.n + main.str"`},
+		{"1 + *2", "type", 4, 6, "invalid indirect", `invalid indirect: "*2"`},
+		{"main.nums[7]", "runtime", 0, 12, "slice index out of bounds", `slice index out of bounds: "main.nums[7]"`},
+		{"2 * (main.arr[1] / 0)", "runtime", 5, 20, "integer divide by zero", `integer divide by zero: "main.arr[1] / 0"`},
+		{"*main.p.next.next", "runtime", 0, 17, "nil pointer dereference", `nil pointer dereference: "*main.p.next.next"`},
+	}
+	for _, tt := range tests {
+		_, _, err := prog.Evaluate(tt.expr)
+		e, ok := err.(*debug.ExpressionError)
+		if !ok {
+			t.Errorf("Evaluate(%q): got error %v, want a *debug.ExpressionError", tt.expr, err)
+			continue
+		}
+		want := debug.ExpressionError{Expression: tt.expr, Kind: tt.kind, Start: tt.start, End: tt.end, Reason: tt.reason}
+		if *e != want {
+			t.Errorf("Evaluate(%q): got error %+v, want %+v", tt.expr, *e, want)
+		}
+		if e.Error() != tt.message {
+			t.Errorf("Evaluate(%q): got message %q, want %q", tt.expr, e.Error(), tt.message)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/debug"
+)
+
+// nextEvent returns the next event from prog, failing the test if none
+// arrives soon.
+func nextEvent(t *testing.T, prog debug.Program) debug.Event {
+	select {
+	case e := <-prog.Events():
+		return e
+	case <-time.After(time.Minute):
+		t.Fatal("no event")
+	}
+	panic("unreachable")
+}
+
+func TestResumeAsync(t *testing.T) {
+	prog, first, second := startRewind(t, false)
+	defer prog.Kill()
+	stops := []struct {
+		bp    debug.Breakpoint
+		value int64
+	}{
+		{first, 1},
+		{second, 2},
+	}
+	for _, stop := range stops {
+		if err := prog.ResumeAsync(); err != nil {
+			t.Fatal("ResumeAsync:", err)
+		}
+		e := nextEvent(t, prog)
+		if e.Kind != "stop" {
+			t.Fatalf("got event %+v, want a stop at %s", e, stop.bp.Function)
+		}
+		checkStop(t, prog, "ResumeAsync", e.Status, "breakpoint", stop.bp, stop.value)
+	}
+	if err := prog.ResumeAsync(); err != nil {
+		t.Fatal("ResumeAsync:", err)
+	}
+	if e := nextEvent(t, prog); e.Kind != "exit" || e.Exit == nil || e.Exit.ExitStatus != 0 {
+		t.Errorf("got event %+v, want an exit with status 0", e)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/local"
+)
+
+// startExit runs the exit test program until it stops in main.stop, and
+// returns the ID of its process.
+func startExit(t *testing.T) (debug.Program, int) {
+	t.Helper()
+	prog, err := local.New(buildTestProgram(t, "exit"))
+	if err != nil {
+		t.Fatal("local.New:", err)
+	}
+	if _, err := prog.Run(); err != nil {
+		t.Fatal("Run:", err)
+	}
+	if _, err := prog.BreakpointAtFunction("main.stop"); err != nil {
+		t.Fatal("BreakpointAtFunction:", err)
+	}
+	status, err := prog.Resume()
+	if err != nil {
+		t.Fatal("Resume:", err)
+	}
+	return prog, processOf(t, status.Thread)
+}
+
+// checkExited checks that the calls that need a process return want, once
+// the process has gone.
+func checkExited(t *testing.T, prog debug.Program, want *debug.ProcessExited) {
+	t.Helper()
+	for _, c := range []struct {
+		name string
+		f    func() error
+	}{
+		{"Resume", func() error { _, err := prog.Resume(); return err }},
+		{"Frames", func() error { _, err := prog.Frames(1); return err }},
+		{"Evaluate", func() error { _, _, err := prog.Evaluate("main.stop"); return err }},
+		{"BreakpointAtFunction", func() error { _, err := prog.BreakpointAtFunction("main.main"); return err }},
+	} {
+		if err := c.f(); !reflect.DeepEqual(err, want) {
+			t.Errorf("%s: got error %v, want %v", c.name, err, want)
+		}
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	prog, _ := startExit(t)
+	defer prog.Kill()
+	want := &debug.ProcessExited{ExitStatus: 3}
+	if _, err := prog.Resume(); !reflect.DeepEqual(err, want) {
+		t.Fatalf("Resume: got error %v, want %v", err, want)
+	}
+	checkExited(t, prog, want)
+}
+
+// exited reports whether process pid has exited, though it hasn't been
+// waited for.
+func exited(pid int) bool {
+	stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return true
+	}
+	i := bytes.LastIndexByte(stat, ')')
+	return i >= 0 && i+2 < len(stat) && stat[i+2] == 'Z'
+}
+
+func TestKilledWhileStopped(t *testing.T) {
+	prog, pid := startExit(t)
+	defer prog.Kill()
+
+	// The process is killed without the debugger knowing, so the next
+	// request that uses it finds it gone.
+	if err := syscall.Kill(pid, syscall.SIGKILL); err != nil {
+		t.Fatal(err)
+	}
+	for start := time.Now(); !exited(pid); time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("the process didn't die")
+		}
+	}
+	checkExited(t, prog, &debug.ProcessExited{ExitStatus: -1, Signal: "SIGKILL"})
+}
@@ -0,0 +1,70 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/local"
+)
+
+func TestEvalFormat(t *testing.T) {
+	prog, err := local.New(buildTestProgram(t, "format"))
+	if err != nil {
+		t.Fatal("local.New:", err)
+	}
+	defer prog.Kill()
+	if _, err := prog.Run(); err != nil {
+		t.Fatal("Run:", err)
+	}
+	if _, err := prog.BreakpointAtFunction("main.stop"); err != nil {
+		t.Fatal("BreakpointAtFunction:", err)
+	}
+	if _, err := prog.Resume(); err != nil {
+		t.Fatal("Resume:", err)
+	}
+	tests := []struct {
+		expr string
+		opts debug.FormatOptions
+		want string
+	}{
+		{"main.nums", debug.FormatOptions{}, "[]int{1, 2, 3, 4, 5}"},
+		{"main.nums", debug.FormatOptions{MaxElements: 2}, "[]int{1, 2, ...}"},
+		{"main.nums", debug.FormatOptions{Hex: true}, "[]int{0x1, 0x2, 0x3, 0x4, 0x5}"},
+		{"main.arr", debug.FormatOptions{}, "[3]int{10, 20, 30}"},
+		{"main.arr", debug.FormatOptions{MaxElements: 2, Hex: true}, "[3]int{0xa, 0x14, ...}"},
+		{"main.str", debug.FormatOptions{}, `"abcdefghij"`},
+		{"main.str", debug.FormatOptions{MaxStringLen: 3}, `"abc..."`},
+		{"main.n", debug.FormatOptions{Hex: true}, "0xc8"},
+		{"main.p", debug.FormatOptions{Deref: true}, "&struct main.pair {255, &struct main.pair {1, 0x0}}"},
+		{"main.p", debug.FormatOptions{Deref: true, Hex: true}, "&struct main.pair {0xff, &struct main.pair {0x1, 0x0}}"},
+		// Dereferencing a pointer counts as a level of nesting.
+		{"main.p", debug.FormatOptions{Deref: true, MaxDepth: 1}, "&..."},
+		{"main.p", debug.FormatOptions{Deref: true, MaxDepth: 2}, "&struct main.pair {255, ...}"},
+		{"main.p", debug.FormatOptions{Deref: true, MaxDepth: 3}, "&struct main.pair {255, &...}"},
+		{"main.nums", debug.FormatOptions{MaxDepth: 1}, "[]int{1, 2, 3, 4, 5}"},
+	}
+	for _, tt := range tests {
+		got, err := prog.EvalFormat("val:"+tt.expr, tt.opts)
+		if err != nil {
+			t.Errorf("EvalFormat(%s, %+v): %v", tt.expr, tt.opts, err)
+			continue
+		}
+		if len(got) != 1 || got[0] != tt.want {
+			t.Errorf("EvalFormat(%s, %+v): got %q, want %q", tt.expr, tt.opts, got, tt.want)
+		}
+	}
+
+	// Eval uses the default format, and pointers are printed as addresses.
+	got, err := prog.Eval("val:main.p")
+	if err != nil {
+		t.Fatal("Eval:", err)
+	}
+	if len(got) != 1 || !strings.HasPrefix(got[0], "0x") {
+		t.Errorf("Eval(val:main.p): got %q, want an address", got)
+	}
+}
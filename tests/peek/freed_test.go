@@ -0,0 +1,74 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import (
+	"testing"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/local"
+)
+
+func TestObjectFreed(t *testing.T) {
+	prog, err := local.New(buildTestProgram(t, "freed"))
+	if err != nil {
+		t.Fatal("local.New:", err)
+	}
+	defer prog.Kill()
+	if _, err := prog.Run(); err != nil {
+		t.Fatal("Run:", err)
+	}
+	if _, err := prog.BreakpointAtFunction("main.stop"); err != nil {
+		t.Fatal("BreakpointAtFunction:", err)
+	}
+	if _, err := prog.Resume(); err != nil {
+		t.Fatal("Resume:", err)
+	}
+	v, err := prog.VarByName("main.live")
+	if err != nil {
+		t.Fatal("VarByName:", err)
+	}
+	val, err := prog.Value(v)
+	if err != nil {
+		t.Fatal("Value:", err)
+	}
+	p, ok := val.(debug.Pointer)
+	if !ok {
+		t.Fatalf("main.live: got %T, want a debug.Pointer", val)
+	}
+	freedAddr, _, err := prog.Evaluate("main.freedAddr")
+	if err != nil {
+		t.Fatal("Evaluate:", err)
+	}
+	addr, ok := freedAddr.(uint64)
+	if !ok {
+		t.Fatalf("main.freedAddr: got %T, want uint64", freedAddr)
+	}
+
+	tests := []struct {
+		name  string
+		v     debug.Var
+		freed bool
+	}{
+		{"live object", debug.Var{TypeID: p.TypeID, Address: p.Address}, false},
+		{"freed object", debug.Var{TypeID: p.TypeID, Address: addr}, true},
+		{"past the end of the live object", debug.Var{TypeID: p.TypeID, Address: p.Address + 8}, true},
+	}
+	for _, tt := range tests {
+		val, err := prog.Value(tt.v)
+		if !tt.freed {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			} else if s, ok := val.(debug.Struct); !ok || len(s.Fields) != 1 {
+				t.Errorf("%s: got %#v, want a struct", tt.name, val)
+			}
+			continue
+		}
+		e, ok := err.(*debug.ObjectFreed)
+		if !ok || e.Address != tt.v.Address || e.Reason == "" {
+			t.Errorf("%s: got value %v, error %v; want an *ObjectFreed", tt.name, val, err)
+		}
+	}
+}
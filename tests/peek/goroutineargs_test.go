@@ -0,0 +1,60 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"golang.org/x/debug/local"
+)
+
+func TestGoroutineArguments(t *testing.T) {
+	prog, err := local.New(buildTestProgram(t, "args"))
+	if err != nil {
+		t.Fatal("local.New:", err)
+	}
+	defer prog.Kill()
+	if _, err := prog.Run(); err != nil {
+		t.Fatal("Run:", err)
+	}
+	if _, err := prog.BreakpointAtFunction("main.stop"); err != nil {
+		t.Fatal("BreakpointAtFunction:", err)
+	}
+	// The goroutines have blocked by the time main stops a second time,
+	// after sleeping.
+	for i := 0; i < 2; i++ {
+		if _, err := prog.Resume(); err != nil {
+			t.Fatal("Resume:", err)
+		}
+	}
+	gs, err := prog.Goroutines()
+	if err != nil {
+		t.Fatal("Goroutines:", err)
+	}
+
+	// Two goroutines are blocked in main.block, called with 1 and "one",
+	// and 2 and "two".
+	var got []string
+	for _, g := range gs {
+		for _, f := range g.StackFrames {
+			if f.Function != "main.block" {
+				continue
+			}
+			var params []string
+			for _, p := range f.Params {
+				params = append(params, p.Name+"="+p.Value)
+			}
+			got = append(got, strings.Join(params, ", "))
+		}
+	}
+	sort.Strings(got)
+	want := []string{`n=1, name="one"`, `n=2, name="two"`}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got main.block arguments %q, want %q", got, want)
+	}
+}
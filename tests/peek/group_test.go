@@ -0,0 +1,77 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBreakpointGroup(t *testing.T) {
+	prog, first, second := startRewind(t, false)
+	defer prog.Kill()
+	// The breakpoint at fmt.Println, outside the group, is reached after
+	// those in it.
+	printBP, err := prog.BreakpointAtFunction("fmt.Println")
+	if err != nil {
+		t.Fatal("BreakpointAtFunction:", err)
+	}
+	for _, id := range []uint64{first.ID, second.ID} {
+		if err := prog.SetBreakpointGroup(id, "values"); err != nil {
+			t.Fatal("SetBreakpointGroup:", err)
+		}
+	}
+	// resume resumes the program and checks it stops at the breakpoint
+	// with the given ID.
+	resume := func(call string, id uint64) {
+		status, err := prog.Resume()
+		if err != nil {
+			t.Fatalf("%s: Resume: %v", call, err)
+		}
+		if !reflect.DeepEqual(status.Breakpoints, []uint64{id}) {
+			t.Errorf("%s: stopped at breakpoints %v, want %d", call, status.Breakpoints, id)
+		}
+	}
+
+	if err := prog.EnableBreakpointGroup("values", false); err != nil {
+		t.Fatal("EnableBreakpointGroup:", err)
+	}
+	bps, err := prog.ListBreakpoints()
+	if err != nil {
+		t.Fatal("ListBreakpoints:", err)
+	}
+	for _, bp := range bps {
+		if inGroup := bp.ID != printBP.ID; (bp.Group == "values") != inGroup || bp.Enabled == inGroup {
+			t.Errorf("after disabling the group, breakpoint %d is in group %q, enabled %t", bp.ID, bp.Group, bp.Enabled)
+		}
+	}
+	resume("with the group disabled", printBP.ID)
+
+	if _, err := prog.Restart(true); err != nil {
+		t.Fatal("Restart:", err)
+	}
+	if err := prog.EnableBreakpointGroup("values", true); err != nil {
+		t.Fatal("EnableBreakpointGroup:", err)
+	}
+	resume("with the group enabled", first.ID)
+
+	if err := prog.DeleteBreakpointGroup("values"); err != nil {
+		t.Fatal("DeleteBreakpointGroup:", err)
+	}
+	if bps, err = prog.ListBreakpoints(); err != nil {
+		t.Fatal("ListBreakpoints:", err)
+	}
+	if len(bps) != 1 || bps[0].ID != printBP.ID {
+		t.Errorf("after deleting the group, got breakpoints %+v, want only %d", bps, printBP.ID)
+	}
+	resume("with the group deleted", printBP.ID)
+
+	if err := prog.EnableBreakpointGroup("values", true); err == nil {
+		t.Error("enabling an empty group succeeded")
+	}
+	if err := prog.SetBreakpointGroup(first.ID, "values"); err == nil {
+		t.Error("putting a deleted breakpoint in a group succeeded")
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import (
+	"testing"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/local"
+)
+
+// startHeap starts the heap test program, and runs it to where it stops
+// with its objects allocated.
+func startHeap(t *testing.T) debug.Program {
+	prog, err := local.New(buildTestProgram(t, "heap"))
+	if err != nil {
+		t.Fatal("local.New:", err)
+	}
+	if _, err := prog.Run(); err != nil {
+		prog.Kill()
+		t.Fatal("Run:", err)
+	}
+	if _, err := prog.BreakpointAtFunction("main.stop"); err != nil {
+		prog.Kill()
+		t.Fatal("BreakpointAtFunction:", err)
+	}
+	if _, err := prog.Resume(); err != nil {
+		prog.Kill()
+		t.Fatal("Resume:", err)
+	}
+	return prog
+}
+
+// pointerAt returns the address the pointer expr holds.
+func pointerAt(t *testing.T, prog debug.Program, expr string) uint64 {
+	v, _, err := prog.Evaluate(expr)
+	if err != nil {
+		t.Fatalf("Evaluate(%q): %v", expr, err)
+	}
+	switch v := v.(type) {
+	case debug.Pointer:
+		return v.Address
+	case debug.Slice:
+		return v.Address
+	}
+	t.Fatalf("Evaluate(%q): got %#v, want a pointer", expr, v)
+	panic("unreachable")
+}
+
+func TestHeapStats(t *testing.T) {
+	prog := startHeap(t)
+	defer prog.Kill()
+	stats, err := prog.HeapStats()
+	if err != nil {
+		t.Fatal("HeapStats:", err)
+	}
+	if stats.Objects == 0 || stats.Spans == 0 || stats.SpanBytes < stats.Bytes {
+		t.Errorf("HeapStats: got %d objects of %d bytes, in %d spans of %d bytes", stats.Objects, stats.Bytes, stats.Spans, stats.SpanBytes)
+	}
+	var objects, bytes uint64
+	var nodes, buffers *debug.HeapTypeStats
+	for i, ts := range stats.Types {
+		objects += ts.Objects
+		bytes += ts.Bytes
+		if ts.Bytes != ts.Objects*ts.Size {
+			t.Errorf("HeapStats: got %d bytes in %d objects of %s of size %d", ts.Bytes, ts.Objects, ts.TypeName, ts.Size)
+		}
+		if i > 0 && ts.Bytes > stats.Types[i-1].Bytes {
+			t.Errorf("HeapStats: types out of order: %+v after %+v", ts, stats.Types[i-1])
+		}
+		switch {
+		case ts.TypeName == "main.node":
+			nodes = &stats.Types[i]
+		case ts.TypeName == "" && ts.Size == 1<<20:
+			buffers = &stats.Types[i]
+		}
+	}
+	if objects != stats.Objects || bytes != stats.Bytes {
+		t.Errorf("HeapStats: types add up to %d objects of %d bytes, want %d of %d", objects, bytes, stats.Objects, stats.Bytes)
+	}
+	// The objects of main.node have pointers and are large enough that the
+	// runtime records their type; the buffer of bytes has no pointers.
+	if nodes == nil || nodes.Objects != 100 || nodes.Size < 608 || nodes.TypeID == 0 {
+		t.Errorf("HeapStats: got main.node objects %+v, want 100 of at least 608 bytes", nodes)
+	}
+	if buffers == nil || buffers.Objects != 1 {
+		t.Errorf("HeapStats: got untyped objects of 1MB %+v, want 1", buffers)
+	}
+
+	dump, err := prog.HeapDump()
+	if err != nil {
+		t.Fatal("HeapDump:", err)
+	}
+	if uint64(len(dump)) != stats.Objects {
+		t.Errorf("HeapDump: got %d objects, want %d as counted by HeapStats", len(dump), stats.Objects)
+	}
+	head, buf := pointerAt(t, prog, "main.head"), pointerAt(t, prog, "main.buf")
+	var foundHead, foundBuf bool
+	for i, o := range dump {
+		if i > 0 && o.Address <= dump[i-1].Address {
+			t.Errorf("HeapDump: object at %#x after one at %#x", o.Address, dump[i-1].Address)
+		}
+		switch o.Address {
+		case head:
+			foundHead = o.TypeName == "main.node" && nodes != nil && o.Size == nodes.Size
+		case buf:
+			foundBuf = o.TypeName == "" && o.Size == 1<<20
+		}
+	}
+	if !foundHead || !foundBuf {
+		t.Errorf("HeapDump: found main.head %t, main.buf %t", foundHead, foundBuf)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/debug/local"
+)
+
+func TestBreakpointAtPackageInit(t *testing.T) {
+	prog, err := local.New(buildTestProgram(t, "inits"))
+	if err != nil {
+		t.Fatal("local.New:", err)
+	}
+	defer prog.Kill()
+	if _, err := prog.Run(); err != nil {
+		t.Fatal("Run:", err)
+	}
+	if _, err := prog.BreakpointAtPackageInit(traceeSrc + "/inits/nosuchpackage"); err == nil {
+		t.Error("BreakpointAtPackageInit succeeded for a package that isn't in the program")
+	}
+	const pkg = traceeSrc + "/inits/dep"
+	bp, err := prog.BreakpointAtPackageInit(pkg)
+	if err != nil {
+		t.Fatal("BreakpointAtPackageInit:", err)
+	}
+	mainBP, err := prog.BreakpointAtFunction("main.main")
+	if err != nil {
+		t.Fatal("BreakpointAtFunction:", err)
+	}
+
+	// The package is initialized before main.main starts.
+	status, err := prog.Resume()
+	if err != nil {
+		t.Fatal("Resume:", err)
+	}
+	if len(status.Breakpoints) != 1 || status.Breakpoints[0] != bp.ID {
+		t.Fatalf("stopped at breakpoints %v, want the package's init breakpoint %d", status.Breakpoints, bp.ID)
+	}
+	frames, err := prog.Frames(1)
+	if err != nil {
+		t.Fatal("Frames:", err)
+	}
+	if len(frames) == 0 || !strings.HasPrefix(frames[0].Function, pkg+".init") {
+		t.Errorf("got frames %+v, want an init function of %s", frames, pkg)
+	}
+	if v, _, err := prog.Evaluate("main.started"); err != nil || v != false {
+		t.Errorf("main.started = %v (error %v), want false", v, err)
+	}
+
+	if err := prog.DeleteBreakpoints([]uint64{bp.ID}); err != nil {
+		t.Fatal("DeleteBreakpoints:", err)
+	}
+	status, err = prog.Resume()
+	if err != nil {
+		t.Fatal("Resume:", err)
+	}
+	if len(status.Breakpoints) != 1 || status.Breakpoints[0] != mainBP.ID {
+		t.Errorf("stopped at breakpoints %v, want main.main's breakpoint %d", status.Breakpoints, mainBP.ID)
+	}
+}
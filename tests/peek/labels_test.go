@@ -0,0 +1,55 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/debug/local"
+)
+
+func TestGoroutineLabels(t *testing.T) {
+	prog, err := local.New(buildTestProgram(t, "labels"))
+	if err != nil {
+		t.Fatal("local.New:", err)
+	}
+	defer prog.Kill()
+	if _, err := prog.Run(); err != nil {
+		t.Fatal("Run:", err)
+	}
+	if _, err := prog.BreakpointAtFunction("main.stop"); err != nil {
+		t.Fatal("BreakpointAtFunction:", err)
+	}
+	if _, err := prog.Resume(); err != nil {
+		t.Fatal("Resume:", err)
+	}
+	gs, err := prog.Goroutines()
+	if err != nil {
+		t.Fatal("Goroutines:", err)
+	}
+
+	// Only main's goroutine and those it started to serve requests have
+	// labels.
+	want := map[string]map[string]string{
+		"main":     {"role": "main"},
+		"request1": {"request": "1", "handler": "serve"},
+		"request2": {"request": "2", "handler": "serve"},
+	}
+	got := make(map[string]map[string]string)
+	for _, g := range gs {
+		switch {
+		case g.Labels["role"] != "":
+			got[g.Labels["role"]] = g.Labels
+		case g.Labels["request"] != "":
+			got["request"+g.Labels["request"]] = g.Labels
+		case len(g.Labels) != 0:
+			t.Errorf("goroutine %d running %s has labels %v, want none", g.ID, g.Function, g.Labels)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got labels %v, want %v", got, want)
+	}
+}
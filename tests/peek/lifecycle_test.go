@@ -0,0 +1,95 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/debug"
+)
+
+func TestKill(t *testing.T) {
+	prog, first, second := startRewind(t, false)
+	defer prog.Kill()
+	status, err := prog.Resume()
+	if err != nil {
+		t.Fatal("Resume:", err)
+	}
+	checkStop(t, prog, "Resume", status, "breakpoint", first, 1)
+	if _, err := prog.Kill(); err != nil {
+		t.Fatal("Kill:", err)
+	}
+	if _, err := prog.Resume(); err == nil {
+		t.Error("Resume after Kill succeeded")
+	} else if _, ok := err.(*debug.ProcessExited); !ok {
+		t.Errorf("Resume after Kill: got error %v, want a *debug.ProcessExited", err)
+	}
+	if _, err := prog.Kill(); err != nil {
+		t.Errorf("Kill after Kill: %v", err)
+	}
+
+	// The breakpoints are kept for the next process.
+	if ids := breakpointIDs(t, prog); !reflect.DeepEqual(ids, []uint64{first.ID, second.ID}) {
+		t.Errorf("after Kill, got breakpoints %v, want %d and %d", ids, first.ID, second.ID)
+	}
+	if _, err := prog.Run(); err != nil {
+		t.Fatal("Run:", err)
+	}
+	if status, err = prog.Resume(); err != nil {
+		t.Fatal("Resume:", err)
+	}
+	checkStop(t, prog, "Resume after Kill and Run", status, "breakpoint", first, 1)
+}
+
+func TestRestart(t *testing.T) {
+	prog, first, _ := startRewind(t, false)
+	defer prog.Kill()
+	w, err := prog.WatchGlobal("main.value")
+	if err != nil {
+		t.Fatal("WatchGlobal:", err)
+	}
+	status, err := prog.Resume()
+	if err != nil {
+		t.Fatal("Resume:", err)
+	}
+	checkStop(t, prog, "Resume", status, "breakpoint", first, 1)
+
+	// Restarting with the breakpoints keeps the watchpoint too.
+	if _, err := prog.Restart(true); err != nil {
+		t.Fatal("Restart:", err)
+	}
+	if status, err = prog.Resume(); err != nil {
+		t.Fatal("Resume:", err)
+	}
+	checkStop(t, prog, "Resume after Restart", status, "breakpoint", first, 1)
+	if status, err = prog.Resume(); err != nil {
+		t.Fatal("Resume:", err)
+	}
+	if status.Reason != "watchpoint" || !reflect.DeepEqual(status.Watchpoints, []uint64{w.ID}) {
+		t.Errorf("Resume after Restart: stopped for %q at watchpoints %v, want watchpoint %d", status.Reason, status.Watchpoints, w.ID)
+	}
+
+	// Restarting without them runs the program to the end.
+	if _, err := prog.Restart(false); err != nil {
+		t.Fatal("Restart:", err)
+	}
+	if ids := breakpointIDs(t, prog); len(ids) != 0 {
+		t.Errorf("after Restart(false), got breakpoints %v, want none", ids)
+	}
+	if _, err := prog.Resume(); err == nil {
+		t.Error("Resume after Restart(false): the program didn't exit")
+	}
+
+	// A process that has exited can be restarted.
+	if _, err := prog.Restart(false); err != nil {
+		t.Fatal("Restart after exit:", err)
+	}
+	if _, err := prog.Resume(); err == nil {
+		t.Error("Resume after Restart: the program didn't exit")
+	} else if exited, ok := err.(*debug.ProcessExited); !ok || exited.ExitStatus != 0 {
+		t.Errorf("Resume after Restart: got error %v, want an exit with status 0", err)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import (
+	"testing"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/local"
+)
+
+func TestWatchMap(t *testing.T) {
+	prog, err := local.New(buildTestProgram(t, "mapgrowth"))
+	if err != nil {
+		t.Fatal("local.New:", err)
+	}
+	defer prog.Kill()
+	if _, err := prog.Run(); err != nil {
+		t.Fatal("Run:", err)
+	}
+	if _, err := prog.BreakpointAtFunction("main.stop"); err != nil {
+		t.Fatal("BreakpointAtFunction:", err)
+	}
+	if _, err := prog.Resume(); err != nil {
+		t.Fatal("Resume:", err)
+	}
+	v, _, err := prog.Evaluate("main.m")
+	if err != nil {
+		t.Fatal("Evaluate:", err)
+	}
+	m, ok := v.(debug.Map)
+	if !ok {
+		t.Fatalf("main.m is %T, want debug.Map", v)
+	}
+	if _, err := prog.WatchMap(debug.Map{TypeID: m.TypeID}, 0); err == nil {
+		t.Error("WatchMap of a nil map succeeded")
+	}
+	w, err := prog.WatchMap(m, 5)
+	if err != nil {
+		t.Fatal("WatchMap:", err)
+	}
+	var lengths []uint64
+	for {
+		status, err := prog.Resume()
+		if _, ok := err.(*debug.ProcessExited); ok {
+			break
+		}
+		if err != nil {
+			t.Fatal("Resume:", err)
+		}
+		if status.Reason != "watchpoint" || len(status.Watchpoints) != 1 || status.Watchpoints[0] != w.ID {
+			t.Fatalf("Resume: stopped for %q, watchpoints %v; want watchpoint %d", status.Reason, status.Watchpoints, w.ID)
+		}
+		v, _, err := prog.Evaluate("main.m")
+		if err != nil {
+			t.Fatal("Evaluate:", err)
+		}
+		lengths = append(lengths, v.(debug.Map).Length)
+	}
+	// The first stop is for passing the threshold, and the others for
+	// growing, each at a greater length.
+	if len(lengths) < 3 || lengths[0] != 6 {
+		t.Fatalf("stopped with the map's length %v, want 6 and then the lengths at which it grew", lengths)
+	}
+	for i := 1; i < len(lengths); i++ {
+		if lengths[i] <= lengths[i-1] {
+			t.Errorf("stopped with the map's length %v, want increasing lengths", lengths)
+			break
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import (
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/local"
+)
+
+// textAt returns n bytes of the executable's text at address addr.
+func textAt(t *testing.T, exe string, addr uint64, n int) []byte {
+	t.Helper()
+	f, err := elf.Open(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	text := f.Section(".text")
+	if text == nil || addr < text.Addr || addr+uint64(n) > text.Addr+text.Size {
+		t.Fatalf("%x isn't in the text of %s", addr, exe)
+	}
+	b := make([]byte, n)
+	if _, err := text.ReadAt(b, int64(addr-text.Addr)); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// TestMemoryAtBreakpoint checks that reading memory holding a breakpoint
+// shows the instruction it replaced, and that writing it leaves the
+// breakpoint set.
+func TestMemoryAtBreakpoint(t *testing.T) {
+	exe := buildTestProgram(t, "callers")
+	prog, err := local.New(exe)
+	if err != nil {
+		t.Fatal("local.New:", err)
+	}
+	defer prog.Kill()
+	if _, err := prog.Run(); err != nil {
+		t.Fatal("Run:", err)
+	}
+	bp, err := prog.BreakpointAtFunction("main.count")
+	if err != nil {
+		t.Fatal("BreakpointAtFunction:", err)
+	}
+	var pid int
+	checkStop := func(calls int64) {
+		t.Helper()
+		status, err := prog.Resume()
+		if err != nil {
+			t.Fatal("Resume:", err)
+		}
+		if !reflect.DeepEqual(status.Breakpoints, []uint64{bp.ID}) {
+			t.Fatalf("stopped at breakpoints %v, want %d", status.Breakpoints, bp.ID)
+		}
+		pid = processOf(t, status.Thread)
+		if v, _, err := prog.Evaluate("main.calls"); err != nil || v != calls {
+			t.Errorf("main.calls = %v (error %v), want %d", v, err, calls)
+		}
+	}
+	checkStop(0)
+
+	// The memory read spans the breakpoint, which is in the process now,
+	// starting some bytes before it.
+	const before = 8
+	addr := bp.PCs[0] - before
+	want := textAt(t, exe, addr, 16)
+	got, err := prog.ReadMemory(addr, len(want))
+	if err != nil {
+		t.Fatal("ReadMemory:", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("ReadMemory(%#x, %d) = %x, want the executable's instructions %x", addr, len(want), got, want)
+	}
+
+	// Writing the instructions back leaves the breakpoint where it was.
+	if n, err := prog.WriteMemory(addr, want); err != nil || n != len(want) {
+		t.Fatalf("WriteMemory: wrote %d bytes (error %v), want %d", n, err, len(want))
+	}
+	mem, err := os.Open(fmt.Sprintf("/proc/%d/mem", pid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := make([]byte, len(want))
+	_, err = mem.ReadAt(raw, int64(addr))
+	mem.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw[before] == want[before] {
+		t.Errorf("after WriteMemory, the process's memory at %#x is %x, want a breakpoint instruction", addr, raw)
+	}
+	if got, err := prog.ReadMemory(addr, len(want)); err != nil || !bytes.Equal(got, want) {
+		t.Errorf("ReadMemory after WriteMemory = %x (error %v), want %x", got, err, want)
+	}
+	checkStop(1)
+
+	// The instruction restored when the breakpoint is deleted is the one
+	// written, so the program runs on to the end.
+	if err := prog.DeleteBreakpoints([]uint64{bp.ID}); err != nil {
+		t.Fatal("DeleteBreakpoints:", err)
+	}
+	if _, err := prog.Resume(); err == nil {
+		t.Error("Resume: the program didn't exit")
+	} else if exited, ok := err.(*debug.ProcessExited); !ok || exited.ExitStatus != 0 {
+		t.Errorf("Resume: got error %v, want an exit with status 0", err)
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/local"
+)
+
+func TestNewTest(t *testing.T) {
+	test, err := local.NewTest("testdata/testpkg", "Double$|External/sub")
+	if err != nil {
+		t.Fatal("NewTest:", err)
+	}
+	defer test.Close()
+	defer test.Kill()
+	// The functions are named with the package's import path, which
+	// depends on where the tree is.
+	var names []string
+	for name := range test.Breakpoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) != 2 || !strings.HasSuffix(names[0], "/testpkg.TestDouble") || !strings.HasSuffix(names[1], "/testpkg_test.TestExternal") {
+		t.Fatalf("got breakpoints on %v, want TestDouble and TestExternal", names)
+	}
+	// The package's own tests run before those of its external test
+	// package.  A test function can stop at its breakpoint twice, if its
+	// stack has to grow on entry, which runs the function again from the
+	// start.
+	var want, got []uint64
+	for _, name := range names {
+		want = append(want, test.Breakpoints[name].ID)
+	}
+	for {
+		status, err := test.Resume()
+		if _, ok := err.(*debug.ProcessExited); ok {
+			break
+		}
+		if err != nil {
+			t.Fatal("Resume:", err)
+		}
+		if len(status.Breakpoints) != 1 {
+			t.Fatalf("Resume: stopped at breakpoints %v, want one", status.Breakpoints)
+		}
+		if n := len(got); n == 0 || got[n-1] != status.Breakpoints[0] {
+			got = append(got, status.Breakpoints[0])
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("stopped at breakpoints %v, want %v", got, want)
+	}
+	if _, err := local.NewTest("testdata/testpkg", "("); err == nil {
+		t.Error("NewTest with a bad pattern succeeded")
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import (
+	"testing"
+
+	"golang.org/x/debug"
+)
+
+// breakpointIDs returns the IDs of the program's breakpoints.
+func breakpointIDs(t *testing.T, prog debug.Program) []uint64 {
+	t.Helper()
+	bps, err := prog.ListBreakpoints()
+	if err != nil {
+		t.Fatal("ListBreakpoints:", err)
+	}
+	var ids []uint64
+	for _, bp := range bps {
+		ids = append(ids, bp.ID)
+	}
+	return ids
+}
+
+func TestOneShotBreakpoint(t *testing.T) {
+	prog, first, second := startRewind(t, false)
+	defer prog.Kill()
+	if err := prog.SetBreakpointOneShot(first.ID, true); err != nil {
+		t.Fatal("SetBreakpointOneShot:", err)
+	}
+	if err := prog.SetBreakpointOneShot(1000, true); err == nil {
+		t.Error("SetBreakpointOneShot of a missing breakpoint succeeded")
+	}
+	bps, err := prog.ListBreakpoints()
+	if err != nil {
+		t.Fatal("ListBreakpoints:", err)
+	}
+	if len(bps) != 2 || !bps[0].OneShot || bps[1].OneShot {
+		t.Errorf("got breakpoints %+v, want only the first one-shot", bps)
+	}
+
+	status, err := prog.Resume()
+	if err != nil {
+		t.Fatal("Resume:", err)
+	}
+	checkStop(t, prog, "Resume", status, "breakpoint", first, 1)
+	if ids := breakpointIDs(t, prog); len(ids) != 1 || ids[0] != second.ID {
+		t.Errorf("after stopping at the one-shot breakpoint, got breakpoints %v, want only %d", ids, second.ID)
+	}
+
+	// It is gone for the next run too.
+	if _, err := prog.Restart(true); err != nil {
+		t.Fatal("Restart:", err)
+	}
+	if status, err = prog.Resume(); err != nil {
+		t.Fatal("Resume:", err)
+	}
+	checkStop(t, prog, "Resume after Restart", status, "breakpoint", second, 2)
+}
+
+func TestRunToLine(t *testing.T) {
+	prog, first, second := startRewind(t, false)
+	defer prog.Kill()
+	if err := prog.DeleteBreakpoints([]uint64{second.ID}); err != nil {
+		t.Fatal("DeleteBreakpoints:", err)
+	}
+	status, err := prog.Resume()
+	if err != nil {
+		t.Fatal("Resume:", err)
+	}
+	checkStop(t, prog, "Resume", status, "breakpoint", first, 1)
+
+	// Run to the call of fmt.Println in main.
+	status, err = prog.RunToLine("testdata/rewind/main.go", 27)
+	if err != nil {
+		t.Fatal("RunToLine:", err)
+	}
+	frames, err := prog.Frames(1)
+	if err != nil {
+		t.Fatal("Frames:", err)
+	}
+	if status.Reason != "breakpoint" || frames[0].Function != "main.main" || frames[0].Line != 27 {
+		t.Errorf("RunToLine: stopped for %q in %s at line %d, want a breakpoint in main.main at line 27", status.Reason, frames[0].Function, frames[0].Line)
+	}
+	if v, _, err := prog.Evaluate("main.value"); err != nil || v != int64(3) {
+		t.Errorf("RunToLine: main.value = %v (error %v), want 3", v, err)
+	}
+	if ids := breakpointIDs(t, prog); len(ids) != 1 || ids[0] != first.ID {
+		t.Errorf("after RunToLine, got breakpoints %v, want only %d", ids, first.ID)
+	}
+
+	// When another breakpoint comes first, the program stops there, and not
+	// later at the line.
+	if _, err := prog.Restart(true); err != nil {
+		t.Fatal("Restart:", err)
+	}
+	status, err = prog.RunToLine("testdata/rewind/main.go", 27)
+	if err != nil {
+		t.Fatal("RunToLine:", err)
+	}
+	checkStop(t, prog, "RunToLine past a breakpoint", status, "breakpoint", first, 1)
+	if ids := breakpointIDs(t, prog); len(ids) != 1 || ids[0] != first.ID {
+		t.Errorf("after RunToLine stopped elsewhere, got breakpoints %v, want only %d", ids, first.ID)
+	}
+	if _, err := prog.Resume(); err == nil {
+		t.Error("Resume: the program didn't exit")
+	}
+	if _, err := prog.RunToLine("testdata/rewind/main.go", 1000); err == nil {
+		t.Error("RunToLine of a line without code succeeded")
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/local"
+)
+
+// startPanics builds and starts the panics test program.  It is built
+// without optimizations, so that its defers aren't open-coded and are in the
+// goroutine's chain of deferred calls.
+func startPanics(t *testing.T) debug.Program {
+	exe := "./panics.out"
+	if err := run("go", "build", "-gcflags=-N -l", "-o", exe, traceeSrc+"/panics"); err != nil {
+		t.Fatal("building panics:", err)
+	}
+	filesToRemove = append(filesToRemove, exe)
+	prog, err := local.New(exe)
+	if err != nil {
+		t.Fatal("local.New:", err)
+	}
+	if _, err := prog.Run(); err != nil {
+		prog.Kill()
+		t.Fatal("Run:", err)
+	}
+	return prog
+}
+
+func TestPanicStops(t *testing.T) {
+	prog := startPanics(t)
+	defer prog.Kill()
+	if _, err := prog.PanicInfo(); err == nil {
+		t.Error("PanicInfo before a panic succeeded")
+	}
+
+	// The stops, each of which can be made twice if runtime.gopanic grows
+	// its stack.
+	stops := []struct {
+		function string
+		value    string // A prefix of the formatted value.
+		panics   int
+		deferred string
+	}{
+		{"runtime.gopanic", `("string"`, 0, "main.recovering.func1"},
+		{"runtime.gopanic", `("*errors.errorString"`, 0, "main.crash.deferwrap1"},
+		// The runtime has replaced the error with its message by now.
+		{"runtime.fatalpanic", `("string"`, 1, ""},
+	}
+	var got []debug.PanicInfo
+	for {
+		status, err := prog.Resume()
+		if err != nil {
+			if exit, ok := err.(*debug.ProcessExited); !ok || exit.ExitStatus != 2 {
+				t.Errorf("Resume: got error %v, want an exit with status 2", err)
+			}
+			break
+		}
+		if status.Reason != "panic" {
+			t.Fatalf("Resume: got status %+v, want a stop at a panic", status)
+		}
+		info, err := prog.PanicInfo()
+		if err != nil {
+			t.Fatal("PanicInfo:", err)
+		}
+		if n := len(got); n > 0 && info.Function == got[n-1].Function && info.Value == got[n-1].Value {
+			continue
+		}
+		got = append(got, info)
+	}
+	if len(got) != len(stops) {
+		t.Fatalf("got %d panic stops (%+v), want %d", len(got), got, len(stops))
+	}
+	for i, want := range stops {
+		info := got[i]
+		if info.Function != want.function || !strings.HasPrefix(info.Value, want.value) || info.Goroutine != 1 {
+			t.Errorf("stop %d: got %s with value %s in goroutine %d, want %s with %s... in goroutine 1", i, info.Function, info.Value, info.Goroutine, want.function, want.value)
+		}
+		if len(info.Panics) != want.panics {
+			t.Errorf("stop %d: got panics %+v, want %d", i, info.Panics, want.panics)
+		}
+		var deferred string
+		if len(info.Deferred) > 0 {
+			deferred = info.Deferred[0].Function
+		}
+		if len(info.Deferred) > 1 || deferred != want.deferred {
+			t.Errorf("stop %d: got deferred calls %+v, want %q", i, info.Deferred, want.deferred)
+		}
+	}
+
+	// Without panic stops, the program runs until it fails.
+	if err := prog.SetPanicStops(nil); err != nil {
+		t.Fatal("SetPanicStops:", err)
+	}
+	if _, err := prog.Restart(false); err != nil {
+		t.Fatal("Restart:", err)
+	}
+	if status, err := prog.Resume(); err == nil {
+		t.Errorf("Resume without panic stops: got status %+v, want the program to exit", status)
+	}
+}
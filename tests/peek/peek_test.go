@@ -5,6 +5,8 @@
 package peek_test
 
 import (
+	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
@@ -14,10 +16,12 @@ import (
 	"regexp"
 	"sync"
 	"testing"
+	"time"
 
 	"golang.org/x/debug"
 	"golang.org/x/debug/local"
 	"golang.org/x/debug/remote"
+	"golang.org/x/debug/server"
 )
 
 var expectedVarValues = map[string]interface{}{
@@ -52,10 +56,10 @@ var expectedVars = map[string]string{
 	`main.Z_complex64`:           `(1.54321+2.54321i)`,
 	`main.Z_float32`:             `1.54321`,
 	`main.Z_float64`:             `1.987654321`,
-	`main.Z_func_int8_r_int8`:    `func(int8, *int8) void @0xX `,
-	`main.Z_func_int8_r_pint8`:   `func(int8, **int8) void @0xX `,
-	`main.Z_func_bar`:            `func(*main.FooStruct) void @0xX `,
-	`main.Z_func_nil`:            `func(int8, *int8) void @0xX `,
+	`main.Z_func_int8_r_int8`:    `main.init.func1 (0xX)`,
+	`main.Z_func_int8_r_pint8`:   `main.init.func2 (0xX)`,
+	`main.Z_func_bar`:            `main.(*FooStruct).Bar (0xX)`,
+	`main.Z_func_nil`:            `<nil>`,
 	`main.Z_int`:                 `-21`,
 	`main.Z_int16`:               `-32321`,
 	`main.Z_int32`:               `-1987654321`,
@@ -91,13 +95,13 @@ var expectedVars = map[string]string{
 // A nil value indicates that an error is expected.
 var expectedEvaluate = map[string]debug.Value{
 	`x`:                                                          int16(42),
-	`local_array`:                                                debug.Array{42, 42, 5, 8},
-	`local_channel`:                                              debug.Channel{42, 42, 42, 0, 0, 2, 0},
-	`local_channel_buffered`:                                     debug.Channel{42, 42, 42, 6, 10, 2, 8},
-	`local_map`:                                                  debug.Map{42, 42, 1},
-	`local_map_2`:                                                debug.Map{42, 42, 1},
-	`local_map_3`:                                                debug.Map{42, 42, 2},
-	`local_map_empty`:                                            debug.Map{42, 42, 0},
+	`local_array`:                                                debug.Array{42, "int8", 42, 5, 8},
+	`local_channel`:                                              debug.Channel{42, "int16", debug.BothDir, 42, 42, 0, 0, 2, 0},
+	`local_channel_buffered`:                                     debug.Channel{42, "int16", debug.BothDir, 42, 42, 6, 10, 2, 8},
+	`local_map`:                                                  debug.Map{42, "int8", "float32", 42, 1},
+	`local_map_2`:                                                debug.Map{42, "int16", "int8", 42, 1},
+	`local_map_3`:                                                debug.Map{42, "int16", "int8", 42, 2},
+	`local_map_empty`:                                            debug.Map{42, "int8", "float32", 42, 0},
 	`x + 5`:                                                      int16(47),
 	`x - 5`:                                                      int16(37),
 	`x / 5`:                                                      int16(8),
@@ -119,6 +123,20 @@ var expectedEvaluate = map[string]debug.Value{
 	`34.5`:                                                       34.5,
 	`1e5`:                                                        100000.0,
 	`0x42`:                                                       66,
+	`0b1010`:                                                     10,
+	`0o17`:                                                       15,
+	`017`:                                                        15,
+	`1_000_000`:                                                  1000000,
+	`0x_ff`:                                                      255,
+	`-0b11`:                                                      -3,
+	`0x1p-2`:                                                     0.25,
+	`0x1.8p1`:                                                    3.0,
+	`1_000.5`:                                                    1000.5,
+	`0b101i`:                                                     5i,
+	`0x10i`:                                                      16i,
+	`017i`:                                                       17i,
+	`1_0i`:                                                       10i,
+	`0x1p2i`:                                                     4i,
 	`'c'`:                                                        'c',
 	`"de"`:                                                       debug.String{2, `de`},
 	"`ef`":                                                       debug.String{2, `ef`},
@@ -134,6 +152,14 @@ var expectedEvaluate = map[string]debug.Value{
 	`true && false`:                                              false,
 	`true && true`:                                               true,
 	`!(5 > 8)`:                                                   true,
+	`5 > 8`:                                                      false,
+	`8 > 5`:                                                      true,
+	`5 >= 8`:                                                     false,
+	`8 >= 5`:                                                     true,
+	`5 >= 5`:                                                     true,
+	`x > 41`:                                                     true,
+	`x >= 43`:                                                    false,
+	`local_string >= "J"`:                                        false,
 	`10 + 'a'`:                                                   'k',
 	`10 + 10.5`:                                                  20.5,
 	`10 + 10.5i`:                                                 10 + 10.5i,
@@ -146,8 +172,22 @@ var expectedEvaluate = map[string]debug.Value{
 	`(6 + 8i) * (1 + 1i)`:                                        -2 + 14i,
 	`(6 + 8i) * (6 - 8i)`:                                        complex128(100),
 	`(6 + 8i) / (3 + 4i)`:                                        complex128(2),
+	`local_pointer == &main.Z_struct`:                            true,
+	`local_pointer_nil == nil`:                                   true,
+	`nil != local_pointer`:                                       true,
+	`local_pointer == local_pointer_nil`:                         false,
+	`local_map_nil == nil`:                                       true,
+	`local_slice_nil == nil`:                                     true,
+	`local_slice != nil`:                                         true,
+	`local_channel_nil == nil`:                                   true,
+	`local_func_nil == nil`:                                      true,
+	`local_string == "I'm a string"`:                             true,
+	`local_string < "J"`:                                         true,
 	`local_array[2]`:                                             int8(3),
 	`&local_array[1]`:                                            debug.Pointer{42, 42},
+	`(&local_array)[2]`:                                          int8(3),
+	`local_array[1+1]`:                                           int8(3),
+	`local_string[1]`:                                            uint8('\''),
 	`local_map[-21]`:                                             float32(3.54321),
 	`local_map[+21]`:                                             float32(0),
 	`local_map_3[1024]`:                                          int8(1),
@@ -156,54 +196,57 @@ var expectedEvaluate = map[string]debug.Value{
 	`"hello"[2]`:                                                 uint8('l'),
 	`local_array[1:3][1]`:                                        int8(3),
 	`local_array[0:4][2:3][0]`:                                   int8(3),
-	`local_array[:]`:                                             debug.Slice{debug.Array{42, 42, 5, 8}, 5},
-	`local_array[:2]`:                                            debug.Slice{debug.Array{42, 42, 2, 8}, 5},
-	`local_array[2:]`:                                            debug.Slice{debug.Array{42, 42, 3, 8}, 3},
-	`local_array[1:3]`:                                           debug.Slice{debug.Array{42, 42, 2, 8}, 4},
-	`local_array[:3:4]`:                                          debug.Slice{debug.Array{42, 42, 3, 8}, 4},
-	`local_array[1:3:4]`:                                         debug.Slice{debug.Array{42, 42, 2, 8}, 3},
-	`local_array[1:][1:][1:]`:                                    debug.Slice{debug.Array{42, 42, 2, 8}, 2},
-	`(&local_array)[:]`:                                          debug.Slice{debug.Array{42, 42, 5, 8}, 5},
-	`(&local_array)[:2]`:                                         debug.Slice{debug.Array{42, 42, 2, 8}, 5},
-	`(&local_array)[2:]`:                                         debug.Slice{debug.Array{42, 42, 3, 8}, 3},
-	`(&local_array)[1:3]`:                                        debug.Slice{debug.Array{42, 42, 2, 8}, 4},
-	`(&local_array)[:3:4]`:                                       debug.Slice{debug.Array{42, 42, 3, 8}, 4},
-	`(&local_array)[1:3:4]`:                                      debug.Slice{debug.Array{42, 42, 2, 8}, 3},
-	`lookup("main.Z_array")`:                                     debug.Array{42, 42, 5, 8},
-	`lookup("main.Z_array_empty")`:                               debug.Array{42, 42, 0, 8},
+	`local_array[:]`:                                             debug.Slice{debug.Array{42, "int8", 42, 5, 8}, 5},
+	`local_array[:2]`:                                            debug.Slice{debug.Array{42, "int8", 42, 2, 8}, 5},
+	`local_array[2:]`:                                            debug.Slice{debug.Array{42, "int8", 42, 3, 8}, 3},
+	`local_array[1:3]`:                                           debug.Slice{debug.Array{42, "int8", 42, 2, 8}, 4},
+	`local_array[:3:4]`:                                          debug.Slice{debug.Array{42, "int8", 42, 3, 8}, 4},
+	`local_array[1:3:4]`:                                         debug.Slice{debug.Array{42, "int8", 42, 2, 8}, 3},
+	`local_array[1:][1:][1:]`:                                    debug.Slice{debug.Array{42, "int8", 42, 2, 8}, 2},
+	`(&local_array)[:]`:                                          debug.Slice{debug.Array{42, "int8", 42, 5, 8}, 5},
+	`(&local_array)[:2]`:                                         debug.Slice{debug.Array{42, "int8", 42, 2, 8}, 5},
+	`(&local_array)[2:]`:                                         debug.Slice{debug.Array{42, "int8", 42, 3, 8}, 3},
+	`(&local_array)[1:3]`:                                        debug.Slice{debug.Array{42, "int8", 42, 2, 8}, 4},
+	`(&local_array)[:3:4]`:                                       debug.Slice{debug.Array{42, "int8", 42, 3, 8}, 4},
+	`(&local_array)[1:3:4]`:                                      debug.Slice{debug.Array{42, "int8", 42, 2, 8}, 3},
+	`lookup("main.Z_array")`:                                     debug.Array{42, "int8", 42, 5, 8},
+	`lookup("main.Z_array_empty")`:                               debug.Array{42, "int8", 42, 0, 8},
 	`lookup("main.Z_bool_false")`:                                false,
 	`lookup("main.Z_bool_true")`:                                 true,
-	`lookup("main.Z_channel")`:                                   debug.Channel{42, 42, 42, 0, 0, 2, 0},
-	`lookup("main.Z_channel_buffered")`:                          debug.Channel{42, 42, 42, 6, 10, 2, 8},
-	`lookup("main.Z_channel_nil")`:                               debug.Channel{42, 0, 0, 0, 0, 2, 0},
-	`lookup("main.Z_array_of_empties")`:                          debug.Array{42, 42, 2, 0},
+	`lookup("main.Z_channel")`:                                   debug.Channel{42, "int16", debug.BothDir, 42, 42, 0, 0, 2, 0},
+	`lookup("main.Z_channel_buffered")`:                          debug.Channel{42, "int16", debug.BothDir, 42, 42, 6, 10, 2, 8},
+	`lookup("main.Z_channel_nil")`:                               debug.Channel{42, "int16", debug.BothDir, 0, 0, 0, 0, 2, 0},
+	`lookup("main.Z_array_of_empties")`:                          debug.Array{42, "struct {}", 42, 2, 0},
 	`lookup("main.Z_complex128")`:                                complex128(1.987654321 - 2.987654321i),
 	`lookup("main.Z_complex64")`:                                 complex64(1.54321 + 2.54321i),
 	`lookup("main.Z_float32")`:                                   float32(1.54321),
 	`lookup("main.Z_float64")`:                                   float64(1.987654321),
-	`lookup("main.Z_func_int8_r_int8")`:                          debug.Func{42},
-	`lookup("main.Z_func_int8_r_pint8")`:                         debug.Func{42},
-	`lookup("main.Z_func_bar")`:                                  debug.Func{42},
-	`lookup("main.Z_func_nil")`:                                  debug.Func{0},
+	`lookup("main.Z_func_int8_r_int8")`:                          debug.Func{Address: 42},
+	`lookup("main.Z_func_int8_r_pint8")`:                         debug.Func{Address: 42},
+	`lookup("main.Z_func_bar")`:                                  debug.Func{Address: 42},
+	`lookup("main.Z_func_nil")`:                                  debug.Func{Address: 0},
 	`lookup("main.Z_int")`:                                       -21,
 	`lookup("main.Z_int16")`:                                     int16(-32321),
 	`lookup("main.Z_int32")`:                                     int32(-1987654321),
 	`lookup("main.Z_int64")`:                                     int64(-9012345678987654321),
 	`lookup("main.Z_int8")`:                                      int8(-121),
 	`lookup("main.Z_int_typedef")`:                               int16(88),
-	`lookup("main.Z_interface")`:                                 debug.Interface{},
+	`lookup("main.Z_interface")`:                                 debug.Interface{TypeID: 42, TypeName: "*main.FooStruct", Data: 42},
 	`lookup("main.Z_interface_nil")`:                             debug.Interface{},
-	`lookup("main.Z_interface_typed_nil")`:                       debug.Interface{},
-	`lookup("main.Z_map")`:                                       debug.Map{42, 42, 1},
-	`lookup("main.Z_map_2")`:                                     debug.Map{42, 42, 1},
-	`lookup("main.Z_map_3")`:                                     debug.Map{42, 42, 2},
-	`lookup("main.Z_map_empty")`:                                 debug.Map{42, 42, 0},
-	`lookup("main.Z_map_nil")`:                                   debug.Map{42, 42, 0},
+	`lookup("main.Z_interface_typed_nil")`:                       debug.Interface{TypeID: 42, TypeName: "*main.FooStruct"},
+	`main.Z_interface.(*main.FooStruct).a`:                       21,
+	`main.Z_interface.(main.FooStruct)`:                          nil,
+	`main.Z_interface.a`:                                         21,
+	`lookup("main.Z_map")`:                                       debug.Map{42, "int8", "float32", 42, 1},
+	`lookup("main.Z_map_2")`:                                     debug.Map{42, "int16", "int8", 42, 1},
+	`lookup("main.Z_map_3")`:                                     debug.Map{42, "int16", "int8", 42, 2},
+	`lookup("main.Z_map_empty")`:                                 debug.Map{42, "int8", "float32", 42, 0},
+	`lookup("main.Z_map_nil")`:                                   debug.Map{42, "int8", "float32", 42, 0},
 	`lookup("main.Z_pointer")`:                                   debug.Pointer{42, 42},
 	`lookup("main.Z_pointer_nil")`:                               debug.Pointer{42, 0},
-	`lookup("main.Z_slice")`:                                     debug.Slice{debug.Array{42, 42, 5, 8}, 5},
-	`lookup("main.Z_slice_2")`:                                   debug.Slice{debug.Array{42, 42, 2, 8}, 5},
-	`lookup("main.Z_slice_nil")`:                                 debug.Slice{debug.Array{42, 0, 0, 8}, 0},
+	`lookup("main.Z_slice")`:                                     debug.Slice{debug.Array{42, "uint8", 42, 5, 8}, 5},
+	`lookup("main.Z_slice_2")`:                                   debug.Slice{debug.Array{42, "int8", 42, 2, 8}, 5},
+	`lookup("main.Z_slice_nil")`:                                 debug.Slice{debug.Array{42, "uint8", 0, 0, 8}, 0},
 	`lookup("main.Z_string")`:                                    debug.String{12, `I'm a string`},
 	`lookup("main.Z_struct")`:                                    debug.Struct{[]debug.StructField{{"a", debug.Var{}}, {"b", debug.Var{}}}},
 	`lookup("main.Z_uint")`:                                      uint(21),
@@ -241,11 +284,15 @@ var expectedEvaluate = map[string]debug.Value{
 	`lookup("main.Z_slice")[1]`:                                  uint8(108),
 	`lookup("main.Z_slice_2")[1]`:                                int8(121),
 	`lookup("main.Z_slice")[1:5][0:3][1]`:                        uint8('i'),
-	`lookup("main.Z_array")[1:3:4]`:                              debug.Slice{debug.Array{42, 42, 2, 8}, 3},
-	`(&lookup("main.Z_array"))[1:3:4]`:                           debug.Slice{debug.Array{42, 42, 2, 8}, 3},
+	`lookup("main.Z_array")[1:3:4]`:                              debug.Slice{debug.Array{42, "int8", 42, 2, 8}, 3},
+	`(&lookup("main.Z_array"))[1:3:4]`:                           debug.Slice{debug.Array{42, "int8", 42, 2, 8}, 3},
 	`lookup("main.Z_string") + "!"`:                              debug.String{13, `I'm a string!`},
 	`lookup("main.Z_struct").a`:                                  21,
 	`(&lookup("main.Z_struct")).a`:                               21,
+	`main.Z_struct.a`:                                            21,
+	`main.Z_pointer.b`:                                           debug.String{2, `hi`},
+	`main.Z_int16`:                                               int16(-32321),
+	`&main.Z_struct.a`:                                           debug.Pointer{42, 42},
 	`lookup("main.Z_uint")/10`:                                   uint(2),
 	`lookup("main.Z_uint16")/10`:                                 uint16(5432),
 	`lookup("main.Z_uint32")/10`:                                 uint32(321765432),
@@ -284,6 +331,7 @@ var expectedEvaluate = map[string]debug.Value{
 	`"hello"[-2]`:                                                nil,
 	`"hello"[22]`:                                                nil,
 	`local_pointer_nil.a`:                                        nil,
+	`main.not_a_real_symbol`:                                     nil,
 	`(local_struct).c`:                                           nil,
 	`(&local_struct).c`:                                          nil,
 	`(*local_pointer).c`:                                         nil,
@@ -391,7 +439,9 @@ func initTracee() {
 		traceeBinary = *traceeFlag
 		return
 	}
-	if err := run("go", "build", "-o", traceeBinary, traceeSrc); err != nil {
+	// Optimizations are disabled so that the locals the tests look at are
+	// kept where the debugging information says.
+	if err := run("go", "build", "-gcflags=-N -l", "-o", traceeBinary, traceeSrc); err != nil {
 		log.Fatalf("couldn't build target: %v", err)
 	}
 	filesToRemove = append(filesToRemove, traceeBinary)
@@ -416,17 +466,97 @@ func TestRemoteProgram(t *testing.T) {
 	testProgram(t, prog)
 }
 
+func TestInProcessProgram(t *testing.T) {
+	traceeOnce.Do(initTracee)
+	prog, err := remote.NewInProcess(traceeBinary)
+	if err != nil {
+		t.Fatal("remote.NewInProcess:", err)
+	}
+	if !prog.Supports("Batch") || prog.Supports("NoSuchMethod") {
+		t.Error("Supports doesn't match the server's methods")
+	}
+	testProgram(t, prog)
+}
+
+func TestObserver(t *testing.T) {
+	traceeOnce.Do(initTracee)
+	s, err := server.New(traceeBinary)
+	if err != nil {
+		t.Fatal("server.New:", err)
+	}
+	ctl, err := remote.NewWithTransport(remote.Pipe(s))
+	if err != nil {
+		t.Fatal("connecting controller:", err)
+	}
+	defer ctl.Kill()
+	obs, err := remote.NewWithTransport(remote.PipeObserver(s))
+	if err != nil {
+		t.Fatal("connecting observer:", err)
+	}
+	if ctl.Observer() || !obs.Observer() {
+		t.Errorf("Observer: got %t for the controller and %t for the observer", ctl.Observer(), obs.Observer())
+	}
+	if _, err := obs.Run("some", "arguments"); err == nil {
+		t.Error("observer's Run succeeded")
+	}
+	events := obs.Events()
+	if _, err := ctl.Run("some", "arguments"); err != nil {
+		t.Fatal("Run:", err)
+	}
+	bp, err := ctl.BreakpointAtFunction("main.foo")
+	if err != nil {
+		t.Fatal("BreakpointAtFunction:", err)
+	}
+	if _, err := ctl.Resume(); err != nil {
+		t.Fatal("Resume:", err)
+	}
+	select {
+	case e := <-events:
+		if e.Kind != "stop" || e.Status.PC != bp.PCs[0] {
+			t.Errorf("observer's event: got %+v, want a stop at %x", e, bp.PCs[0])
+		}
+	case <-time.After(10 * time.Second):
+		t.Error("observer wasn't told the process stopped")
+	}
+}
+
+// TestEvaluate checks Evaluate on its own, so that its results are checked
+// even if testProgram fails before reaching them.
+func TestEvaluate(t *testing.T) {
+	traceeOnce.Do(initTracee)
+	prog, err := local.New(traceeBinary)
+	if err != nil {
+		t.Fatal("local.New:", err)
+	}
+	defer prog.Kill()
+	if _, err := prog.Run("some", "arguments"); err != nil {
+		t.Fatal("Run:", err)
+	}
+	bp, err := prog.BreakpointAtLine("testdata/main.go", 125)
+	if err != nil {
+		t.Fatal("BreakpointAtLine:", err)
+	}
+	status, err := prog.Resume()
+	if err != nil {
+		t.Fatal("Resume:", err)
+	}
+	if !reflect.DeepEqual(status.Breakpoints, []uint64{bp.ID}) {
+		t.Fatalf("stopped at %x for breakpoints %v; expected breakpoint %d at %x", status.PC, status.Breakpoints, bp.ID, bp.PCs)
+	}
+	checkEvaluate(t, prog)
+}
+
 func testProgram(t *testing.T, prog debug.Program) {
 	_, err := prog.Run("some", "arguments")
 	if err != nil {
 		log.Fatalf("Run: %v", err)
 	}
 
-	pcs, err := prog.BreakpointAtFunction("main.foo")
+	bp, err := prog.BreakpointAtFunction("main.foo")
 	if err != nil {
 		log.Fatalf("BreakpointAtFunction: %v", err)
 	}
-	fmt.Printf("breakpoints set at %x\n", pcs)
+	fmt.Printf("breakpoints set at %x\n", bp.PCs)
 
 	_, err = prog.Resume()
 	if err != nil {
@@ -492,40 +622,47 @@ func testProgram(t *testing.T, prog debug.Program) {
 	for _, v := range varnames {
 		val, err := prog.Eval("val:" + v)
 		if err != nil {
-			log.Fatalf("prog.Eval error for %s: %v", v, err)
+			t.Errorf("prog.Eval error for %s: %v", v, err)
 		} else {
 			fmt.Printf("%s = %v\n", v, val)
 			if seen[v] {
-				log.Fatalf("repeated variable %s\n", v)
+				t.Errorf("repeated variable %s", v)
 			}
 			seen[v] = true
 			if len(val) != 1 {
-				log.Fatalf("should be one value for %s\n", v)
+				t.Errorf("should be one value for %s", v)
+				continue
 			}
 			expected, ok := expectedVars[v]
 			if !ok {
-				log.Fatalf("unexpected variable %s\n", v)
+				t.Errorf("unexpected variable %s", v)
 			} else {
 				if !matches(expected, val[0]) {
-					log.Fatalf("expected %s = %s\n", v, expected)
+					t.Errorf("expected %s = %s, got %s", v, expected, val[0])
 				}
 			}
 		}
 	}
 	for v, e := range expectedVars {
 		if !seen[v] {
-			log.Fatalf("didn't get %s = %s\n", v, e)
+			t.Errorf("didn't get %s = %s", v, e)
 		}
 	}
 
+	if bps, err := prog.ListBreakpoints(); err != nil {
+		t.Errorf("ListBreakpoints: %v", err)
+	} else if len(bps) != 1 || bps[0].ID != bp.ID || bps[0].HitCount != 1 || bps[0].Function != "main.foo" {
+		t.Errorf("ListBreakpoints: got %+v, expected one breakpoint in main.foo with one hit", bps)
+	}
+
 	// Remove the breakpoint at main.foo.
-	err = prog.DeleteBreakpoints(pcs)
+	err = prog.DeleteBreakpoints([]uint64{bp.ID})
 	if err != nil {
 		log.Fatalf("DeleteBreakpoints: %v", err)
 	}
 
 	// Set a breakpoint at line 125, resume, and check we stopped there.
-	pcsLine125, err := prog.BreakpointAtLine("testdata/main.go", 125)
+	bpLine125, err := prog.BreakpointAtLine("testdata/main.go", 125)
 	if err != nil {
 		t.Fatal("BreakpointAtLine:", err)
 	}
@@ -541,205 +678,28 @@ func testProgram(t *testing.T, prog debug.Program) {
 		}
 		return false
 	}
-	if !stoppedAt(pcsLine125) {
-		t.Errorf("stopped at %X; expected one of %X.", status.PC, pcsLine125)
-	}
-
-	for k, v := range expectedEvaluate {
-		val, err := prog.Evaluate(k)
-		if v == nil {
-			if err == nil {
-				t.Errorf("got Evaluate(%s) = %v, expected error", k, val)
-			}
-			continue
-		}
-		if err != nil {
-			t.Errorf("Evaluate(%s): got error %s, expected %v", k, err, v)
-			continue
-		}
-		typ := reflect.TypeOf(v)
-		if typ != reflect.TypeOf(val) && typ != reflect.TypeOf(int(0)) && typ != reflect.TypeOf(uint(0)) {
-			t.Errorf("got Evaluate(%s) = %T(%v), expected %T(%v)", k, val, val, v, v)
-			continue
-		}
-
-		// For types with fields like Address, TypeID, etc., we can't know the exact
-		// value, so we only test whether those fields are zero or not.
-		switch v := v.(type) {
-		default:
-			if v != val {
-				t.Errorf("got Evaluate(%s) = %T(%v), expected %T(%v)", k, val, val, v, v)
-			}
-		case debug.Array:
-			val := val.(debug.Array)
-			if v.ElementTypeID == 0 && val.ElementTypeID != 0 {
-				t.Errorf("got Evaluate(%s) = %+v, expected zero ElementTypeID", k, val)
-			}
-			if v.ElementTypeID != 0 && val.ElementTypeID == 0 {
-				t.Errorf("got Evaluate(%s) = %+v, expected non-zero ElementTypeID", k, val)
-			}
-			if v.Address == 0 && val.Address != 0 {
-				t.Errorf("got Evaluate(%s) = %+v, expected zero Address", k, val)
-			}
-			if v.Address != 0 && val.Address == 0 {
-				t.Errorf("got Evaluate(%s) = %+v, expected non-zero Address", k, val)
-			}
-		case debug.Slice:
-			val := val.(debug.Slice)
-			if v.ElementTypeID == 0 && val.ElementTypeID != 0 {
-				t.Errorf("got Evaluate(%s) = %+v, expected zero ElementTypeID", k, val)
-			}
-			if v.ElementTypeID != 0 && val.ElementTypeID == 0 {
-				t.Errorf("got Evaluate(%s) = %+v, expected non-zero ElementTypeID", k, val)
-			}
-			if v.Address == 0 && val.Address != 0 {
-				t.Errorf("got Evaluate(%s) = %+v, expected zero Address", k, val)
-			}
-			if v.Address != 0 && val.Address == 0 {
-				t.Errorf("got Evaluate(%s) = %+v, expected non-zero Address", k, val)
-			}
-		case debug.Map:
-			val := val.(debug.Map)
-			if v.TypeID == 0 && val.TypeID != 0 {
-				t.Errorf("got Evaluate(%s) = %+v, expected zero TypeID", k, val)
-			}
-			if v.TypeID != 0 && val.TypeID == 0 {
-				t.Errorf("got Evaluate(%s) = %+v, expected non-zero TypeID", k, val)
-			}
-			if v.Address == 0 && val.Address != 0 {
-				t.Errorf("got Evaluate(%s) = %+v, expected zero Address", k, val)
-			}
-			if v.Address != 0 && val.Address == 0 {
-				t.Errorf("got Evaluate(%s) = %+v, expected non-zero Address", k, val)
-			}
-		case debug.Pointer:
-			val := val.(debug.Pointer)
-			if v.TypeID == 0 && val.TypeID != 0 {
-				t.Errorf("got Evaluate(%s) = %+v, expected zero TypeID", k, val)
-			}
-			if v.TypeID != 0 && val.TypeID == 0 {
-				t.Errorf("got Evaluate(%s) = %+v, expected non-zero TypeID", k, val)
-			}
-			if v.Address == 0 && val.Address != 0 {
-				t.Errorf("got Evaluate(%s) = %+v, expected zero Address", k, val)
-			}
-			if v.Address != 0 && val.Address == 0 {
-				t.Errorf("got Evaluate(%s) = %+v, expected non-zero Address", k, val)
-			}
-		case debug.Channel:
-			val := val.(debug.Channel)
-			if v.ElementTypeID == 0 && val.ElementTypeID != 0 {
-				t.Errorf("got Evaluate(%s) = %+v, expected zero ElementTypeID", k, val)
-			}
-			if v.ElementTypeID != 0 && val.ElementTypeID == 0 {
-				t.Errorf("got Evaluate(%s) = %+v, expected non-zero ElementTypeID", k, val)
-			}
-			if v.Address == 0 && val.Address != 0 {
-				t.Errorf("got Evaluate(%s) = %+v, expected zero Address", k, val)
-			}
-			if v.Address != 0 && val.Address == 0 {
-				t.Errorf("got Evaluate(%s) = %+v, expected non-zero Address", k, val)
-			}
-			if v.Buffer == 0 && val.Buffer != 0 {
-				t.Errorf("got Evaluate(%s) = %+v, expected zero Buffer", k, val)
-			}
-			if v.Buffer != 0 && val.Buffer == 0 {
-				t.Errorf("got Evaluate(%s) = %+v, expected non-zero Buffer", k, val)
-			}
-		case debug.Struct:
-			val := val.(debug.Struct)
-			if len(v.Fields) != len(val.Fields) {
-				t.Errorf("got Evaluate(%s) = %T(%v), expected %T(%v)", k, val, val, v, v)
-				break
-			}
-			for i := range v.Fields {
-				a := v.Fields[i].Name
-				b := val.Fields[i].Name
-				if a != b {
-					t.Errorf("Evaluate(%s): field name mismatch: %s vs %s", k, a, b)
-					break
-				}
-			}
-		case debug.Func:
-			val := val.(debug.Func)
-			if v.Address == 0 && val.Address != 0 {
-				t.Errorf("got Evaluate(%s) = %+v, expected zero Address", k, val)
-			}
-			if v.Address != 0 && val.Address == 0 {
-				t.Errorf("got Evaluate(%s) = %+v, expected non-zero Address", k, val)
-			}
-		case int:
-			// ints in a remote program can be returned as int32 or int64
-			switch val := val.(type) {
-			case int32:
-				if val != int32(v) {
-					t.Errorf("got Evaluate(%s) = %T(%v), expected %v", k, val, val, v)
-				}
-			case int64:
-				if val != int64(v) {
-					t.Errorf("got Evaluate(%s) = %T(%v), expected %v", k, val, val, v)
-				}
-			default:
-				t.Errorf("got Evaluate(%s) = %T(%v), expected %T(%v)", k, val, val, v, v)
-			}
-		case uint:
-			// uints in a remote program can be returned as uint32 or uint64
-			switch val := val.(type) {
-			case uint32:
-				if val != uint32(v) {
-					t.Errorf("got Evaluate(%s) = %T(%v), expected %v", k, val, val, v)
-				}
-			case uint64:
-				if val != uint64(v) {
-					t.Errorf("got Evaluate(%s) = %T(%v), expected %v", k, val, val, v)
-				}
-			default:
-				t.Errorf("got Evaluate(%s) = %T(%v), expected %T(%v)", k, val, val, v, v)
-			}
-		}
+	if !stoppedAt(bpLine125.PCs) {
+		t.Errorf("stopped at %X; expected one of %X.", status.PC, bpLine125.PCs)
 	}
 
-	// Evaluate a struct.
-	v := `lookup("main.Z_struct")`
-	val, err := prog.Evaluate(v)
-	if err != nil {
-		t.Fatalf("Evaluate: %s", err)
-	}
-	s, ok := val.(debug.Struct)
-	if !ok {
-		t.Fatalf("got Evaluate(%q) = %T(%v), expected debug.Struct", v, val, val)
-	}
-	// Check the values of its fields.
-	if len(s.Fields) != 2 {
-		t.Fatalf("got Evaluate(%q) = %+v, expected 2 fields", v, s)
-	}
-	if v0, err := prog.Value(s.Fields[0].Var); err != nil {
-		t.Errorf("Value: %s", err)
-	} else if v0 != int32(21) && v0 != int64(21) {
-		t.Errorf("Value: got %T(%v), expected 21", v0, v0)
-	}
-	if v1, err := prog.Value(s.Fields[1].Var); err != nil {
-		t.Errorf("Value: %s", err)
-	} else if v1 != (debug.String{2, "hi"}) {
-		t.Errorf("Value: got %T(%v), expected `hi`", v1, v1)
-	}
+	checkEvaluate(t, prog)
 
 	// Remove the breakpoint at line 125, set a breakpoint at main.f1 and main.f2,
 	// then delete the breakpoint at main.f1.  Resume, then check we stopped at
 	// main.f2.
-	err = prog.DeleteBreakpoints(pcsLine125)
+	err = prog.DeleteBreakpoints([]uint64{bpLine125.ID})
 	if err != nil {
 		log.Fatalf("DeleteBreakpoints: %v", err)
 	}
-	pcs1, err := prog.BreakpointAtFunction("main.f1")
+	bp1, err := prog.BreakpointAtFunction("main.f1")
 	if err != nil {
 		log.Fatalf("BreakpointAtFunction: %v", err)
 	}
-	pcs2, err := prog.BreakpointAtFunction("main.f2")
+	bp2, err := prog.BreakpointAtFunction("main.f2")
 	if err != nil {
 		log.Fatalf("BreakpointAtFunction: %v", err)
 	}
-	err = prog.DeleteBreakpoints(pcs1)
+	err = prog.DeleteBreakpoints([]uint64{bp1.ID})
 	if err != nil {
 		log.Fatalf("DeleteBreakpoints: %v", err)
 	}
@@ -747,8 +707,8 @@ func testProgram(t *testing.T, prog debug.Program) {
 	if err != nil {
 		log.Fatalf("Resume: %v", err)
 	}
-	if !stoppedAt(pcs2) {
-		t.Errorf("stopped at %X; expected one of %X.", status.PC, pcs2)
+	if !stoppedAt(bp2.PCs) {
+		t.Errorf("stopped at %X; expected one of %X.", status.PC, bp2.PCs)
 	}
 
 	// Check we get the expected results calling VarByName then Value
@@ -781,6 +741,84 @@ func testProgram(t *testing.T, prog debug.Program) {
 		}
 	}
 
+	// Check the description of a struct type.
+	if v, err := prog.VarByName("main.Z_struct"); err != nil {
+		t.Error("VarByName(main.Z_struct) error:", err)
+	} else if info, err := prog.Type(v.TypeID); err != nil {
+		t.Error("Type of main.Z_struct:", err)
+	} else {
+		var fields []string
+		for _, f := range info.Fields {
+			fields = append(fields, f.Name+" "+f.TypeName)
+		}
+		if info.Name != "main.FooStruct" || info.Kind != "struct" || !reflect.DeepEqual(fields, []string{"a int", "b string"}) {
+			t.Errorf("Type of main.Z_struct: got %+v, want struct main.FooStruct with fields a and b", info)
+		}
+		if len(info.Methods) != 1 || info.Methods[0].Name != "Bar" || !info.Methods[0].PointerReceiver {
+			t.Errorf("Type of main.Z_struct: got methods %+v, want Bar on *main.FooStruct", info.Methods)
+		}
+	}
+
+	// Check the debug manifest describes main.main and the globals.
+	var manifest bytes.Buffer
+	if err := prog.ExportDebugManifest(&manifest); err != nil {
+		t.Error("ExportDebugManifest:", err)
+	} else {
+		var m debug.DebugManifest
+		if err := json.Unmarshal(manifest.Bytes(), &m); err != nil {
+			t.Error("decoding debug manifest:", err)
+		}
+		found := false
+		for _, f := range m.Functions {
+			found = found || f.Name == "main.main" && f.Low < f.High
+		}
+		if !found {
+			t.Error("debug manifest: main.main missing from functions")
+		}
+		found = false
+		for _, g := range m.Globals {
+			found = found || g.Name == "main.Z_int" && g.Type == "int" && g.Size == 8
+		}
+		if !found {
+			t.Error("debug manifest: main.Z_int missing from globals")
+		}
+	}
+
+	// Check raw memory reads see main.Z_int, and reads of unmapped memory fail.
+	if v, err := prog.VarByName("main.Z_int"); err != nil {
+		t.Error("VarByName(main.Z_int):", err)
+	} else if b, err := prog.ReadMemory(v.Address, 8); err != nil {
+		t.Error("ReadMemory of main.Z_int:", err)
+	} else if want := []byte{0xeb, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}; !bytes.Equal(b, want) {
+		t.Errorf("ReadMemory of main.Z_int: got %x, want %x", b, want)
+	}
+	if b, err := prog.ReadMemory(0, 8); len(b) != 0 || err == nil {
+		t.Errorf("ReadMemory(0, 8): got %x, %v, want a *debug.MemoryError", b, err)
+	} else if _, ok := err.(*debug.MemoryError); !ok {
+		t.Errorf("ReadMemory(0, 8): got error %T, want *debug.MemoryError", err)
+	}
+
+	// Check Batch makes each of its calls.
+	if results, err := prog.Batch([]debug.BatchCall{
+		{Eval: "val:main.Z_int"},
+		{VarByName: "main.Z_bool_true"},
+		{VarByName: "main.Z_nonexistent"},
+	}); err != nil {
+		t.Error("Batch:", err)
+	} else if len(results) != 3 {
+		t.Errorf("Batch: got %d results, want 3", len(results))
+	} else {
+		if !reflect.DeepEqual(results[0].Eval, []string{"-21"}) {
+			t.Errorf("Batch: Eval of main.Z_int: got %+v, want -21", results[0])
+		}
+		if v, err := prog.Value(results[1].Var); err != nil || v != true {
+			t.Errorf("Batch: VarByName of main.Z_bool_true: got %+v, value %v, %v", results[1], v, err)
+		}
+		if results[2].Err == "" {
+			t.Error("Batch: VarByName of main.Z_nonexistent succeeded")
+		}
+	}
+
 	// checkValue tests that we can get a Var for a variable with the given name,
 	// that we can then get the value of that Var, and that calling fn for that
 	// value succeeds.
@@ -935,6 +973,20 @@ func testProgram(t *testing.T, prog debug.Program) {
 		if err == nil {
 			return fmt.Errorf("MapElement: reading at a bad index succeeded, expected error")
 		}
+		entries, err := prog.MapElements(m, 0, 10)
+		if err != nil {
+			return err
+		}
+		if len(entries) != 2 || entries[0] != (debug.MapEntry{keyVar0, valVar0}) || entries[1] != (debug.MapEntry{keyVar1, valVar1}) {
+			return fmt.Errorf("MapElements: got %v, expected the elements MapElement returns", entries)
+		}
+		entries, err = prog.MapElements(m, 1, 10)
+		if err != nil {
+			return err
+		}
+		if len(entries) != 1 || entries[0] != (debug.MapEntry{keyVar1, valVar1}) {
+			return fmt.Errorf("MapElements from index 1: got %v, expected the second element", entries)
+		}
 		return nil
 	})
 
@@ -1058,3 +1110,215 @@ func testProgram(t *testing.T, prog debug.Program) {
 		return nil
 	})
 }
+
+// checkEvaluate checks the results of Evaluate in the tracee, stopped at line
+// 125 of testdata/main.go, against expectedEvaluate.
+func checkEvaluate(t *testing.T, prog debug.Program) {
+	for k, v := range expectedEvaluate {
+		val, _, err := prog.Evaluate(k)
+		if v == nil {
+			if err == nil {
+				t.Errorf("got Evaluate(%s) = %v, expected error", k, val)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Evaluate(%s): got error %s, expected %v", k, err, v)
+			continue
+		}
+		typ := reflect.TypeOf(v)
+		if typ != reflect.TypeOf(val) && typ != reflect.TypeOf(int(0)) && typ != reflect.TypeOf(uint(0)) {
+			t.Errorf("got Evaluate(%s) = %T(%v), expected %T(%v)", k, val, val, v, v)
+			continue
+		}
+
+		// For types with fields like Address, TypeID, etc., we can't know the exact
+		// value, so we only test whether those fields are zero or not.
+		switch v := v.(type) {
+		default:
+			if v != val {
+				t.Errorf("got Evaluate(%s) = %T(%v), expected %T(%v)", k, val, val, v, v)
+			}
+		case debug.Array:
+			val := val.(debug.Array)
+			if v.ElementTypeID == 0 && val.ElementTypeID != 0 {
+				t.Errorf("got Evaluate(%s) = %+v, expected zero ElementTypeID", k, val)
+			}
+			if v.ElementTypeID != 0 && val.ElementTypeID == 0 {
+				t.Errorf("got Evaluate(%s) = %+v, expected non-zero ElementTypeID", k, val)
+			}
+			if v.ElementTypeName != val.ElementTypeName {
+				t.Errorf("got Evaluate(%s) = %+v, expected ElementTypeName %q", k, val, v.ElementTypeName)
+			}
+			if v.Address == 0 && val.Address != 0 {
+				t.Errorf("got Evaluate(%s) = %+v, expected zero Address", k, val)
+			}
+			if v.Address != 0 && val.Address == 0 {
+				t.Errorf("got Evaluate(%s) = %+v, expected non-zero Address", k, val)
+			}
+		case debug.Slice:
+			val := val.(debug.Slice)
+			if v.ElementTypeID == 0 && val.ElementTypeID != 0 {
+				t.Errorf("got Evaluate(%s) = %+v, expected zero ElementTypeID", k, val)
+			}
+			if v.ElementTypeID != 0 && val.ElementTypeID == 0 {
+				t.Errorf("got Evaluate(%s) = %+v, expected non-zero ElementTypeID", k, val)
+			}
+			if v.ElementTypeName != val.ElementTypeName {
+				t.Errorf("got Evaluate(%s) = %+v, expected ElementTypeName %q", k, val, v.ElementTypeName)
+			}
+			if v.Address == 0 && val.Address != 0 {
+				t.Errorf("got Evaluate(%s) = %+v, expected zero Address", k, val)
+			}
+			if v.Address != 0 && val.Address == 0 {
+				t.Errorf("got Evaluate(%s) = %+v, expected non-zero Address", k, val)
+			}
+		case debug.Map:
+			val := val.(debug.Map)
+			if v.TypeID == 0 && val.TypeID != 0 {
+				t.Errorf("got Evaluate(%s) = %+v, expected zero TypeID", k, val)
+			}
+			if v.TypeID != 0 && val.TypeID == 0 {
+				t.Errorf("got Evaluate(%s) = %+v, expected non-zero TypeID", k, val)
+			}
+			if v.KeyTypeName != val.KeyTypeName || v.ElementTypeName != val.ElementTypeName {
+				t.Errorf("got Evaluate(%s) = %+v, expected key and element types %q and %q", k, val, v.KeyTypeName, v.ElementTypeName)
+			}
+			if v.Address == 0 && val.Address != 0 {
+				t.Errorf("got Evaluate(%s) = %+v, expected zero Address", k, val)
+			}
+			if v.Address != 0 && val.Address == 0 {
+				t.Errorf("got Evaluate(%s) = %+v, expected non-zero Address", k, val)
+			}
+		case debug.Pointer:
+			val := val.(debug.Pointer)
+			if v.TypeID == 0 && val.TypeID != 0 {
+				t.Errorf("got Evaluate(%s) = %+v, expected zero TypeID", k, val)
+			}
+			if v.TypeID != 0 && val.TypeID == 0 {
+				t.Errorf("got Evaluate(%s) = %+v, expected non-zero TypeID", k, val)
+			}
+			if v.Address == 0 && val.Address != 0 {
+				t.Errorf("got Evaluate(%s) = %+v, expected zero Address", k, val)
+			}
+			if v.Address != 0 && val.Address == 0 {
+				t.Errorf("got Evaluate(%s) = %+v, expected non-zero Address", k, val)
+			}
+		case debug.Channel:
+			val := val.(debug.Channel)
+			if v.ElementTypeID == 0 && val.ElementTypeID != 0 {
+				t.Errorf("got Evaluate(%s) = %+v, expected zero ElementTypeID", k, val)
+			}
+			if v.ElementTypeID != 0 && val.ElementTypeID == 0 {
+				t.Errorf("got Evaluate(%s) = %+v, expected non-zero ElementTypeID", k, val)
+			}
+			if v.ElementTypeName != val.ElementTypeName {
+				t.Errorf("got Evaluate(%s) = %+v, expected ElementTypeName %q", k, val, v.ElementTypeName)
+			}
+			if v.Dir != val.Dir {
+				t.Errorf("got Evaluate(%s) = %+v, expected Dir %v", k, val, v.Dir)
+			}
+			if v.Address == 0 && val.Address != 0 {
+				t.Errorf("got Evaluate(%s) = %+v, expected zero Address", k, val)
+			}
+			if v.Address != 0 && val.Address == 0 {
+				t.Errorf("got Evaluate(%s) = %+v, expected non-zero Address", k, val)
+			}
+			if v.Buffer == 0 && val.Buffer != 0 {
+				t.Errorf("got Evaluate(%s) = %+v, expected zero Buffer", k, val)
+			}
+			if v.Buffer != 0 && val.Buffer == 0 {
+				t.Errorf("got Evaluate(%s) = %+v, expected non-zero Buffer", k, val)
+			}
+		case debug.Struct:
+			val := val.(debug.Struct)
+			if len(v.Fields) != len(val.Fields) {
+				t.Errorf("got Evaluate(%s) = %T(%v), expected %T(%v)", k, val, val, v, v)
+				break
+			}
+			for i := range v.Fields {
+				a := v.Fields[i].Name
+				b := val.Fields[i].Name
+				if a != b {
+					t.Errorf("Evaluate(%s): field name mismatch: %s vs %s", k, a, b)
+					break
+				}
+			}
+		case debug.Interface:
+			val := val.(debug.Interface)
+			if v.TypeName != val.TypeName {
+				t.Errorf("got Evaluate(%s) = %+v, expected TypeName %q", k, val, v.TypeName)
+			}
+			if (v.TypeID == 0) != (val.TypeID == 0) {
+				t.Errorf("got Evaluate(%s) = %+v, expected TypeID %v", k, val, v.TypeID)
+			}
+			if (v.Data == 0) != (val.Data == 0) {
+				t.Errorf("got Evaluate(%s) = %+v, expected Data %v", k, val, v.Data)
+			}
+		case debug.Func:
+			val := val.(debug.Func)
+			if v.Address == 0 && val.Address != 0 {
+				t.Errorf("got Evaluate(%s) = %+v, expected zero Address", k, val)
+			}
+			if v.Address != 0 && val.Address == 0 {
+				t.Errorf("got Evaluate(%s) = %+v, expected non-zero Address", k, val)
+			}
+		case int:
+			// ints in a remote program can be returned as int32 or int64
+			switch val := val.(type) {
+			case int32:
+				if val != int32(v) {
+					t.Errorf("got Evaluate(%s) = %T(%v), expected %v", k, val, val, v)
+				}
+			case int64:
+				if val != int64(v) {
+					t.Errorf("got Evaluate(%s) = %T(%v), expected %v", k, val, val, v)
+				}
+			default:
+				t.Errorf("got Evaluate(%s) = %T(%v), expected %T(%v)", k, val, val, v, v)
+			}
+		case uint:
+			// uints in a remote program can be returned as uint32 or uint64
+			switch val := val.(type) {
+			case uint32:
+				if val != uint32(v) {
+					t.Errorf("got Evaluate(%s) = %T(%v), expected %v", k, val, val, v)
+				}
+			case uint64:
+				if val != uint64(v) {
+					t.Errorf("got Evaluate(%s) = %T(%v), expected %v", k, val, val, v)
+				}
+			default:
+				t.Errorf("got Evaluate(%s) = %T(%v), expected %T(%v)", k, val, val, v, v)
+			}
+		}
+	}
+
+	// Evaluate a struct.
+	v := `lookup("main.Z_struct")`
+	val, typ, err := prog.Evaluate(v)
+	if err != nil {
+		t.Fatalf("Evaluate: %s", err)
+	}
+	if typ.Name != "main.FooStruct" || typ.TypeID == 0 {
+		t.Errorf("got Evaluate(%q) type %+v, expected main.FooStruct with a TypeID", v, typ)
+	}
+	s, ok := val.(debug.Struct)
+	if !ok {
+		t.Fatalf("got Evaluate(%q) = %T(%v), expected debug.Struct", v, val, val)
+	}
+	// Check the values of its fields.
+	if len(s.Fields) != 2 {
+		t.Fatalf("got Evaluate(%q) = %+v, expected 2 fields", v, s)
+	}
+	if v0, err := prog.Value(s.Fields[0].Var); err != nil {
+		t.Errorf("Value: %s", err)
+	} else if v0 != int32(21) && v0 != int64(21) {
+		t.Errorf("Value: got %T(%v), expected 21", v0, v0)
+	}
+	if v1, err := prog.Value(s.Fields[1].Var); err != nil {
+		t.Errorf("Value: %s", err)
+	} else if v1 != (debug.String{2, "hi"}) {
+		t.Errorf("Value: got %T(%v), expected `hi`", v1, v1)
+	}
+}
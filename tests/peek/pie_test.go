@@ -0,0 +1,72 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import (
+	"debug/elf"
+	"testing"
+
+	"golang.org/x/debug/local"
+)
+
+// TestPIE checks that breakpoints, frames and variables are found in a
+// position-independent executable, which is loaded away from the addresses
+// it was linked at.
+func TestPIE(t *testing.T) {
+	const exe = "./rewind-pie.out"
+	if err := run("go", "build", "-buildmode=pie", "-o", exe, traceeSrc+"/rewind"); err != nil {
+		t.Skip("can't build a position-independent executable:", err)
+	}
+	filesToRemove = append(filesToRemove, exe)
+	f, err := elf.Open(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	syms, err := f.Symbols()
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var linked uint64
+	for _, sym := range syms {
+		if sym.Name == "main.second" {
+			linked = sym.Value
+		}
+	}
+	if linked == 0 {
+		t.Fatal("no symbol for main.second")
+	}
+
+	prog, err := local.New(exe)
+	if err != nil {
+		t.Fatal("local.New:", err)
+	}
+	defer prog.Kill()
+	if _, err := prog.Run(); err != nil {
+		t.Fatal("Run:", err)
+	}
+	bp, err := prog.BreakpointAtFunction("main.second")
+	if err != nil {
+		t.Fatal("BreakpointAtFunction:", err)
+	}
+	if len(bp.PCs) != 1 || bp.PCs[0] == linked {
+		t.Fatalf("got breakpoint at %#x, want one address other than the linked %#x", bp.PCs, linked)
+	}
+	status, err := prog.Resume()
+	if err != nil {
+		t.Fatal("Resume:", err)
+	}
+	checkStop(t, prog, "Resume", status, "breakpoint", bp, 2)
+	frames, err := prog.Frames(2)
+	if err != nil {
+		t.Fatal("Frames:", err)
+	}
+	if len(frames) != 2 || frames[0].Function != "main.second" || frames[1].Function != "main.main" {
+		t.Errorf("got frames %+v, want main.second called by main.main", frames)
+	}
+	if frames[0].FunctionStart != bp.PCs[0] {
+		t.Errorf("main.second's frame starts at %#x, want %#x", frames[0].FunctionStart, bp.PCs[0])
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecordingBreakpoint(t *testing.T) {
+	prog, first, second := startRewind(t, false)
+	defer prog.Kill()
+	if err := prog.SetBreakpointRecord(first.ID, true, []string{"main.value", "main.nosuchvariable"}); err != nil {
+		t.Fatal("SetBreakpointRecord:", err)
+	}
+	if err := prog.SetBreakpointRecord(1000, true, nil); err == nil {
+		t.Error("SetBreakpointRecord of a missing breakpoint succeeded")
+	}
+	start := time.Now()
+
+	// The program carries on past the recording breakpoint, to the next.
+	status, err := prog.Resume()
+	if err != nil {
+		t.Fatal("Resume:", err)
+	}
+	checkStop(t, prog, "Resume", status, "breakpoint", second, 2)
+
+	snaps, err := prog.Snapshots()
+	if err != nil {
+		t.Fatal("Snapshots:", err)
+	}
+	if len(snaps) != 1 {
+		t.Fatalf("got %d snapshots, want 1", len(snaps))
+	}
+	snap := snaps[0]
+	if snap.Breakpoint != first.ID || snap.PC != first.PCs[0] || snap.Thread == 0 || snap.Time.Before(start) {
+		t.Errorf("got snapshot of breakpoint %d at %#x, thread %d, time %v; want breakpoint %d at %#x", snap.Breakpoint, snap.PC, snap.Thread, snap.Time, first.ID, first.PCs[0])
+	}
+	if snap.FramesErr != "" || len(snap.Frames) < 2 || snap.Frames[0].Function != "main.first" || snap.Frames[1].Function != "main.main" {
+		t.Errorf("got snapshot frames %+v (error %q), want main.first called by main.main", snap.Frames, snap.FramesErr)
+	}
+	if len(snap.Values) != 2 {
+		t.Fatalf("got snapshot values %+v, want 2", snap.Values)
+	}
+	if v := snap.Values[0]; v.Expression != "main.value" || v.Err != "" || v.Value != int64(1) {
+		t.Errorf("got snapshot value %+v, want main.value = 1", v)
+	}
+	if v := snap.Values[1]; v.Expression != "main.nosuchvariable" || v.Err == "" {
+		t.Errorf("got snapshot value %+v, want an error", v)
+	}
+
+	// Snapshots are fetched once.
+	if snaps, err = prog.Snapshots(); err != nil || len(snaps) != 0 {
+		t.Errorf("Snapshots again: got %d snapshots (error %v), want none", len(snaps), err)
+	}
+
+	// A breakpoint that no longer records stops the program again.
+	if err := prog.SetBreakpointRecord(first.ID, false, nil); err != nil {
+		t.Fatal("SetBreakpointRecord:", err)
+	}
+	if _, err := prog.Restart(true); err != nil {
+		t.Fatal("Restart:", err)
+	}
+	if status, err = prog.Resume(); err != nil {
+		t.Fatal("Resume:", err)
+	}
+	checkStop(t, prog, "Resume after Restart", status, "breakpoint", first, 1)
+}
@@ -0,0 +1,70 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import (
+	"testing"
+
+	"golang.org/x/debug"
+)
+
+func TestFindReferences(t *testing.T) {
+	prog := startHeap(t)
+	defer prog.Kill()
+	head := pointerAt(t, prog, "main.head")
+	second := pointerAt(t, prog, "main.head.next")
+	third := pointerAt(t, prog, "main.head.next.next")
+
+	// find returns the references to addr of the given kind.
+	find := func(addr uint64, kind string) []debug.Reference {
+		refs, err := prog.FindReferences(addr)
+		if err != nil {
+			t.Fatalf("FindReferences(%#x): %v", addr, err)
+		}
+		var found []debug.Reference
+		for _, r := range refs {
+			if r.Kind == kind {
+				found = append(found, r)
+			}
+		}
+		return found
+	}
+
+	// The first node is only pointed to by main.head, which is found from
+	// an address inside the node too.
+	for _, addr := range []uint64{head, head + 8} {
+		if refs := find(addr, "global"); len(refs) != 1 || refs[0].Name != "main.head" || refs[0].Pointer != head {
+			t.Errorf("FindReferences(%#x): got global references %+v, want main.head", addr, refs)
+		}
+		if refs := find(addr, "heap"); len(refs) != 0 {
+			t.Errorf("FindReferences(%#x): got heap references %+v, want none", addr, refs)
+		}
+	}
+
+	// Each later node is pointed to by the node before it.
+	for _, tt := range []struct{ addr, from uint64 }{{second, head}, {third, second}} {
+		refs := find(tt.addr, "heap")
+		if len(refs) != 1 {
+			t.Errorf("FindReferences(%#x): got heap references %+v, want 1", tt.addr, refs)
+			continue
+		}
+		r := refs[0]
+		if r.Address != tt.from || r.Pointer != tt.addr || r.Object.Address != tt.from || r.Object.TypeName != "main.node" {
+			t.Errorf("FindReferences(%#x): got reference %+v, want the next field of the node at %#x", tt.addr, r, tt.from)
+		}
+	}
+
+	// The second node is also held by main's goroutine, which passed it to
+	// hold.
+	var held bool
+	for _, r := range find(second, "stack") {
+		if r.Goroutine == 1 && (r.Function == "main.main" || r.Function == "main.hold") && r.Pointer == second {
+			held = true
+		}
+	}
+	if !held {
+		t.Errorf("FindReferences(%#x): no reference from the stack of main.main or main.hold", second)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import "testing"
+
+// TestBreakpointsFoundAgain checks that breakpoints are found again, by the
+// function they were set at, in the processes Restart and Run start, even
+// when the executable was rebuilt and the function moved.
+func TestBreakpointsFoundAgain(t *testing.T) {
+	prog, first, second := startRewind(t, false)
+	defer prog.Kill()
+	if err := prog.DeleteBreakpoints([]uint64{first.ID}); err != nil {
+		t.Fatal("DeleteBreakpoints:", err)
+	}
+	status, err := prog.Resume()
+	if err != nil {
+		t.Fatal("Resume:", err)
+	}
+	checkStop(t, prog, "Resume", status, "breakpoint", second, 2)
+
+	if status, err = prog.Restart(true); err != nil {
+		t.Fatal("Restart:", err)
+	}
+	if len(status.Unresolved) != 0 {
+		t.Errorf("Restart: breakpoints %v unresolved", status.Unresolved)
+	}
+	if status, err = prog.Resume(); err != nil {
+		t.Fatal("Resume after Restart:", err)
+	}
+	checkStop(t, prog, "Resume after Restart", status, "breakpoint", second, 2)
+
+	// Building without optimization makes main.first longer, moving
+	// main.second after it.
+	if err := run("go", "build", "-gcflags=-N -l", "-o", "./rewind.out", traceeSrc+"/rewind"); err != nil {
+		t.Fatal("rebuilding rewind:", err)
+	}
+	if status, err = prog.Run(); err != nil {
+		t.Fatal("Run after rebuilding:", err)
+	}
+	if len(status.Unresolved) != 0 {
+		t.Errorf("Run after rebuilding: breakpoints %v unresolved", status.Unresolved)
+	}
+	bps, err := prog.ListBreakpoints()
+	if err != nil {
+		t.Fatal("ListBreakpoints:", err)
+	}
+	if len(bps) != 1 || bps[0].ID != second.ID || len(bps[0].PCs) != 1 {
+		t.Fatalf("ListBreakpoints after rebuilding: got %+v, want breakpoint %d with one PC", bps, second.ID)
+	}
+	if bps[0].PCs[0] == second.PCs[0] || bps[0].Pending || bps[0].Err != "" {
+		t.Errorf("after rebuilding, breakpoint %d is at %#x (pending %t, err %q); want it moved from %#x", second.ID, bps[0].PCs[0], bps[0].Pending, bps[0].Err, second.PCs[0])
+	}
+	if status, err = prog.Resume(); err != nil {
+		t.Fatal("Resume after rebuilding:", err)
+	}
+	checkStop(t, prog, "Resume after rebuilding", status, "breakpoint", bps[0], 2)
+}
@@ -0,0 +1,88 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/local"
+	"golang.org/x/debug/remote"
+)
+
+func TestResumeTimeout(t *testing.T) {
+	exe := buildTestProgram(t, "counter")
+	programs := []struct {
+		name string
+		new  func() (debug.Program, error)
+	}{
+		{"local", func() (debug.Program, error) { return local.New(exe) }},
+		{"remote", func() (debug.Program, error) { return remote.NewInProcess(exe) }},
+	}
+	for _, p := range programs {
+		prog, err := p.new()
+		if err != nil {
+			t.Fatalf("%s: %v", p.name, err)
+		}
+		testResumeTimeout(t, p.name, prog)
+		prog.Kill()
+	}
+}
+
+func testResumeTimeout(t *testing.T, name string, prog debug.Program) {
+	if _, err := prog.Run(); err != nil {
+		t.Fatalf("%s: Run: %v", name, err)
+	}
+	prog.SetResumeTimeout(50 * time.Millisecond)
+
+	// The counter program runs until it is stopped, so each Resume returns
+	// after the timeout, with the program still running.
+	for i := 0; i < 2; i++ {
+		start := time.Now()
+		status, err := prog.Resume()
+		if err != nil {
+			t.Fatalf("%s: Resume: %v", name, err)
+		}
+		if status.Reason != "running" {
+			t.Errorf("%s: Resume %d: got reason %q, want running", name, i, status.Reason)
+		}
+		if d := time.Since(start); d < 50*time.Millisecond {
+			t.Errorf("%s: Resume %d returned after %v, before the timeout", name, i, d)
+		}
+	}
+	samples, err := prog.Sample("main.count")
+	if err != nil {
+		t.Fatalf("%s: Sample: %v", name, err)
+	}
+	if n, ok := samples[0].Value.(int64); !ok || n == 0 {
+		t.Errorf("%s: after Resume timed out, got sample %+v, want a count above 0", name, samples[0])
+	}
+
+	// The next Resume returns when the program stops.
+	if err := prog.Interrupt(); err != nil {
+		t.Fatalf("%s: Interrupt: %v", name, err)
+	}
+	status, err := prog.Resume()
+	if err != nil {
+		t.Fatalf("%s: Resume after Interrupt: %v", name, err)
+	}
+	if status.Reason != "interrupt" {
+		t.Errorf("%s: Resume after Interrupt: got reason %q, want interrupt", name, status.Reason)
+	}
+
+	// A Resume that stops before the timeout returns the stop.
+	bp, err := prog.BreakpointAtFunction("main.next")
+	if err != nil {
+		t.Fatalf("%s: BreakpointAtFunction: %v", name, err)
+	}
+	prog.SetResumeTimeout(time.Minute)
+	if status, err = prog.Resume(); err != nil {
+		t.Fatalf("%s: Resume to a breakpoint: %v", name, err)
+	}
+	if status.Reason != "breakpoint" || len(status.Breakpoints) != 1 || status.Breakpoints[0] != bp.ID {
+		t.Errorf("%s: Resume to a breakpoint: stopped for %q at breakpoints %v, want breakpoint %d", name, status.Reason, status.Breakpoints, bp.ID)
+	}
+}
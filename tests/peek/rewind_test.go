@@ -0,0 +1,194 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/local"
+)
+
+// startRewind starts the rewind test program, with breakpoints at first and
+// second, recording its stops if recording is set, and returns it and the
+// breakpoints.
+func startRewind(t *testing.T, recording bool) (prog debug.Program, first, second debug.Breakpoint) {
+	prog, err := local.New(buildTestProgram(t, "rewind"))
+	if err != nil {
+		t.Fatal("local.New:", err)
+	}
+	if recording {
+		if err := prog.SetRecording(true); err != nil {
+			t.Fatal("SetRecording:", err)
+		}
+	}
+	if _, err := prog.Run(); err != nil {
+		t.Fatal("Run:", err)
+	}
+	if first, err = prog.BreakpointAtFunction("main.first"); err != nil {
+		t.Fatal("BreakpointAtFunction:", err)
+	}
+	if second, err = prog.BreakpointAtFunction("main.second"); err != nil {
+		t.Fatal("BreakpointAtFunction:", err)
+	}
+	return prog, first, second
+}
+
+// checkStop checks the program stopped at breakpoint bp, for reason, with
+// main.value equal to value.
+func checkStop(t *testing.T, prog debug.Program, call string, status debug.Status, reason string, bp debug.Breakpoint, value int64) {
+	t.Helper()
+	if status.Reason != reason || status.PC != bp.PCs[0] {
+		t.Errorf("%s: stopped for %q at %#x, want %q at %#x", call, status.Reason, status.PC, reason, bp.PCs[0])
+	}
+	if reason == "breakpoint" && !reflect.DeepEqual(status.Breakpoints, []uint64{bp.ID}) {
+		t.Errorf("%s: stopped at breakpoints %v, want %d", call, status.Breakpoints, bp.ID)
+	}
+	v, _, err := prog.Evaluate("main.value")
+	if err != nil {
+		t.Errorf("%s: Evaluate: %v", call, err)
+	} else if v != value {
+		t.Errorf("%s: main.value = %v, want %d", call, v, value)
+	}
+}
+
+func TestCheckpointRestore(t *testing.T) {
+	prog, first, second := startRewind(t, false)
+	defer prog.Kill()
+	status, err := prog.Resume()
+	if err != nil {
+		t.Fatal("Resume:", err)
+	}
+	checkStop(t, prog, "Resume", status, "breakpoint", first, 1)
+	id, err := prog.Checkpoint()
+	if err != nil {
+		t.Fatal("Checkpoint:", err)
+	}
+	// Running on changes the variable.
+	if status, err = prog.Resume(); err != nil {
+		t.Fatal("Resume:", err)
+	}
+	checkStop(t, prog, "Resume", status, "breakpoint", second, 2)
+
+	// Restoring the checkpoint undoes the change, and the program runs on
+	// from it as it did before.
+	if status, err = prog.Restore(id); err != nil {
+		t.Fatal("Restore:", err)
+	}
+	checkStop(t, prog, "Restore", status, "restore", first, 1)
+	if status, err = prog.Resume(); err != nil {
+		t.Fatal("Resume after Restore:", err)
+	}
+	checkStop(t, prog, "Resume after Restore", status, "breakpoint", second, 2)
+
+	// The checkpoint can be restored again, even after the process exits.
+	if _, err = prog.Resume(); err == nil {
+		t.Fatal("Resume: process didn't exit")
+	}
+	if status, err = prog.Restore(id); err != nil {
+		t.Fatal("Restore after exit:", err)
+	}
+	checkStop(t, prog, "Restore after exit", status, "restore", first, 1)
+
+	if err := prog.DeleteCheckpoint(id); err != nil {
+		t.Fatal("DeleteCheckpoint:", err)
+	}
+	if _, err := prog.Restore(id); err == nil {
+		t.Error("Restore of a deleted checkpoint succeeded")
+	}
+}
+
+func TestReverseToPreviousBreak(t *testing.T) {
+	prog, first, second := startRewind(t, true)
+	defer prog.Kill()
+	status, err := prog.Resume()
+	if err != nil {
+		t.Fatal("Resume:", err)
+	}
+	checkStop(t, prog, "Resume", status, "breakpoint", first, 1)
+	if status, err = prog.Resume(); err != nil {
+		t.Fatal("Resume:", err)
+	}
+	checkStop(t, prog, "Resume", status, "breakpoint", second, 2)
+
+	// Going back reports the earlier breakpoint, as it was reached.
+	if status, err = prog.ReverseToPreviousBreak(); err != nil {
+		t.Fatal("ReverseToPreviousBreak:", err)
+	}
+	checkStop(t, prog, "ReverseToPreviousBreak", status, "breakpoint", first, 1)
+
+	// Running forward again reaches the later breakpoint, and after the
+	// process exits, ReverseToPreviousBreak returns to the last stop.
+	if status, err = prog.Resume(); err != nil {
+		t.Fatal("Resume after ReverseToPreviousBreak:", err)
+	}
+	checkStop(t, prog, "Resume after ReverseToPreviousBreak", status, "breakpoint", second, 2)
+	if _, err = prog.Resume(); err == nil {
+		t.Fatal("Resume: process didn't exit")
+	}
+	if status, err = prog.ReverseToPreviousBreak(); err != nil {
+		t.Fatal("ReverseToPreviousBreak after exit:", err)
+	}
+	checkStop(t, prog, "ReverseToPreviousBreak after exit", status, "breakpoint", second, 2)
+}
+
+func TestReverseToPreviousStop(t *testing.T) {
+	unrecorded, _, _ := startRewind(t, false)
+	defer unrecorded.Kill()
+	if _, err := unrecorded.ReverseToPreviousStop(); err == nil {
+		t.Error("ReverseToPreviousStop without recording succeeded")
+	}
+
+	prog, first, _ := startRewind(t, true)
+	defer prog.Kill()
+	status, err := prog.Resume()
+	if err != nil {
+		t.Fatal("Resume:", err)
+	}
+	checkStop(t, prog, "Resume", status, "breakpoint", first, 1)
+	var pcs []uint64
+	for i := 0; i < 3; i++ {
+		if status, err = prog.StepInstruction(); err != nil {
+			t.Fatal("StepInstruction:", err)
+		}
+		pcs = append(pcs, status.PC)
+	}
+
+	// Going back a stop at a time returns to each instruction in turn, and
+	// then to the breakpoint, before the variable was changed.
+	for i := len(pcs) - 2; i >= 0; i-- {
+		if status, err = prog.ReverseToPreviousStop(); err != nil {
+			t.Fatal("ReverseToPreviousStop:", err)
+		}
+		if status.Reason != "step" || status.PC != pcs[i] {
+			t.Errorf("ReverseToPreviousStop: stopped for %q at %#x, want %q at %#x", status.Reason, status.PC, "step", pcs[i])
+		}
+	}
+	if status, err = prog.ReverseToPreviousStop(); err != nil {
+		t.Fatal("ReverseToPreviousStop:", err)
+	}
+	checkStop(t, prog, "ReverseToPreviousStop", status, "breakpoint", first, 1)
+
+	// ReverseToPreviousBreak passes over the steps taken since.
+	for i := 0; i < 2; i++ {
+		if _, err = prog.StepInstruction(); err != nil {
+			t.Fatal("StepInstruction:", err)
+		}
+	}
+	if status, err = prog.ReverseToPreviousBreak(); err != nil {
+		t.Fatal("ReverseToPreviousBreak:", err)
+	}
+	checkStop(t, prog, "ReverseToPreviousBreak", status, "breakpoint", first, 1)
+
+	// Before the breakpoint there is only the stop at the start of the
+	// program.
+	if _, err = prog.ReverseToPreviousStop(); err != nil {
+		t.Fatal("ReverseToPreviousStop to the start:", err)
+	}
+	if _, err = prog.ReverseToPreviousStop(); err == nil {
+		t.Error("ReverseToPreviousStop from the start succeeded")
+	}
+}
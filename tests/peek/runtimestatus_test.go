@@ -0,0 +1,77 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import (
+	"math"
+	"os"
+	"testing"
+)
+
+// setEnv sets the environment variables given, returning a function that
+// restores them.
+func setEnv(vars map[string]string) func() {
+	old := make(map[string]*string)
+	for k, v := range vars {
+		if o, ok := os.LookupEnv(k); ok {
+			old[k] = &o
+		} else {
+			old[k] = nil
+		}
+		os.Setenv(k, v)
+	}
+	return func() {
+		for k, v := range old {
+			if v == nil {
+				os.Unsetenv(k)
+			} else {
+				os.Setenv(k, *v)
+			}
+		}
+	}
+}
+
+func TestRuntimeStatus(t *testing.T) {
+	// The program inherits the environment, which sets how its runtime
+	// runs.  It collects garbage once before stopping.
+	restore := setEnv(map[string]string{"GOGC": "50", "GOMAXPROCS": "3", "GOMEMLIMIT": ""})
+	prog := startHeap(t)
+	restore()
+	defer prog.Kill()
+	rs, err := prog.RuntimeStatus()
+	if err != nil {
+		t.Fatal("RuntimeStatus:", err)
+	}
+	if rs.GCPhase != "off" || rs.GCCycles < 1 || rs.GCPercent != 50 || rs.MemoryLimit != math.MaxInt64 {
+		t.Errorf("got GC phase %q after %d cycles, GC percent %d, memory limit %d; want off, at least 1, 50, no limit", rs.GCPhase, rs.GCCycles, rs.GCPercent, rs.MemoryLimit)
+	}
+	// The program's buffer of bytes survived the collection.
+	if rs.HeapMarked < 1<<20 || rs.HeapLive < rs.HeapMarked || rs.HeapInUse < rs.HeapMarked || rs.NextGC <= rs.HeapMarked {
+		t.Errorf("got heap live %d, marked %d, in use %d, next GC %d; want at least 1MB marked", rs.HeapLive, rs.HeapMarked, rs.HeapInUse, rs.NextGC)
+	}
+	if rs.GOMAXPROCS != 3 || len(rs.Ps) != 3 || rs.Threads < 1 || rs.IdleThreads >= rs.Threads {
+		t.Fatalf("got GOMAXPROCS %d, Ps %+v, %d threads of which %d idle; want 3 Ps", rs.GOMAXPROCS, rs.Ps, rs.Threads, rs.IdleThreads)
+	}
+	var running, idle int64
+	for i, p := range rs.Ps {
+		if p.ID != int64(i) {
+			t.Errorf("got P %d with ID %d", i, p.ID)
+		}
+		switch p.Status {
+		case "running":
+			running++
+			if p.Thread == 0 {
+				t.Errorf("got running P %d without a thread", p.ID)
+			}
+		case "idle":
+			idle++
+		}
+	}
+	// At least the P of the stopped thread is running; the others may be
+	// running the runtime's own goroutines.
+	if running < 1 || running+idle != 3 || rs.IdlePs != idle {
+		t.Errorf("got %d running Ps and %d idle, %d as counted by the scheduler; want at least 1 running and the rest idle", running, idle, rs.IdlePs)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/local"
+)
+
+func TestSample(t *testing.T) {
+	prog, err := local.New(buildTestProgram(t, "counter"))
+	if err != nil {
+		t.Fatal("local.New:", err)
+	}
+	defer prog.Kill()
+	if _, err := prog.Run(); err != nil {
+		t.Fatal("Run:", err)
+	}
+	sample := func(expressions ...string) []debug.Sample {
+		t.Helper()
+		samples, err := prog.Sample(expressions...)
+		if err != nil {
+			t.Fatal("Sample:", err)
+		}
+		if len(samples) != len(expressions) {
+			t.Fatalf("Sample: got %d samples, want %d", len(samples), len(expressions))
+		}
+		return samples
+	}
+	if s := sample("main.count"); s[0].Err != "" || s[0].Value != int64(0) {
+		t.Errorf("before the program starts, got sample %+v, want 0", s[0])
+	}
+
+	if err := prog.ResumeAsync(); err != nil {
+		t.Fatal("ResumeAsync:", err)
+	}
+	// The count goes up between samples, as the program runs.
+	var last int64
+	for i := 0; i < 3; i++ {
+		time.Sleep(50 * time.Millisecond)
+		s := sample("main.count", "main.nosuchvariable", "main.next()", "main.count > 0")
+		count, ok := s[0].Value.(int64)
+		if s[0].Err != "" || !ok || count <= last {
+			t.Errorf("sample %d: got %+v, want a count greater than %d", i, s[0], last)
+		}
+		last = count
+		if s[1].Err == "" {
+			t.Errorf("sample %d: got %+v for an unknown variable, want an error", i, s[1])
+		}
+		if !strings.HasPrefix(s[2].Err, "functions can't be called in sampled") {
+			t.Errorf("sample %d: got %+v for a function call, want an error", i, s[2])
+		}
+		if s[3].Err != "" || s[3].Value != true {
+			t.Errorf("sample %d: got %+v, want true", i, s[3])
+		}
+	}
+	if err := prog.Interrupt(); err != nil {
+		t.Fatal("Interrupt:", err)
+	}
+	if e := nextEvent(t, prog); e.Kind != "stop" {
+		t.Errorf("after Interrupt, got event %+v, want a stop", e)
+	}
+}
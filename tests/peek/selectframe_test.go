@@ -0,0 +1,89 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import (
+	"testing"
+
+	"golang.org/x/debug/local"
+)
+
+func TestSelectFrame(t *testing.T) {
+	// The program is built without optimization, so that its local
+	// variables are kept in its frames.
+	exe := "./frames.out"
+	if err := run("go", "build", "-gcflags=-N -l", "-o", exe, traceeSrc+"/frames"); err != nil {
+		t.Fatal("building frames:", err)
+	}
+	filesToRemove = append(filesToRemove, exe)
+	prog, err := local.New(exe)
+	if err != nil {
+		t.Fatal("local.New:", err)
+	}
+	defer prog.Kill()
+	if _, err := prog.Run(); err != nil {
+		t.Fatal("Run:", err)
+	}
+	if _, err := prog.BreakpointAtFunction("main.stop"); err != nil {
+		t.Fatal("BreakpointAtFunction:", err)
+	}
+
+	type variable struct {
+		name  string
+		value int64
+	}
+	tests := []struct {
+		frame  int
+		locals []variable
+	}{
+		{1, []variable{{"x", 11}, {"y", 22}}},
+		{2, []variable{{"a", 10}, {"b", 11}}},
+		{1, []variable{{"x", 11}}},
+	}
+	if _, err := prog.Resume(); err != nil {
+		t.Fatal("Resume:", err)
+	}
+	if _, _, err := prog.Evaluate("x"); err == nil {
+		t.Error("Evaluate(x) in main.stop succeeded")
+	}
+	for _, tt := range tests {
+		if err := prog.SelectFrame(tt.frame); err != nil {
+			t.Fatalf("SelectFrame(%d): %v", tt.frame, err)
+		}
+		for _, l := range tt.locals {
+			if v, _, err := prog.Evaluate(l.name); err != nil || v != l.value {
+				t.Errorf("in frame %d, %s = %v (error %v), want %d", tt.frame, l.name, v, err, l.value)
+			}
+		}
+	}
+	if err := prog.SelectFrame(0); err != nil {
+		t.Fatal("SelectFrame(0):", err)
+	}
+	if _, _, err := prog.Evaluate("x"); err == nil {
+		t.Error("Evaluate(x) after SelectFrame(0) succeeded")
+	}
+	for _, frame := range []int{-1, 100} {
+		if err := prog.SelectFrame(frame); err == nil {
+			t.Errorf("SelectFrame(%d) succeeded", frame)
+		}
+	}
+
+	// The selection lasts until the program next stops.
+	if err := prog.SelectFrame(2); err != nil {
+		t.Fatal("SelectFrame(2):", err)
+	}
+	if _, err := prog.Resume(); err != nil {
+		t.Fatal("Resume:", err)
+	}
+	if _, _, err := prog.Evaluate("a"); err == nil {
+		t.Error("Evaluate(a) at the next stop succeeded")
+	}
+	if err := prog.SelectFrame(2); err != nil {
+		t.Fatal("SelectFrame(2):", err)
+	}
+	if v, _, err := prog.Evaluate("a"); err != nil || v != int64(20) {
+		t.Errorf("at the next stop, a = %v (error %v), want 20", v, err)
+	}
+}
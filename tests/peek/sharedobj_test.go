@@ -0,0 +1,168 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/local"
+)
+
+// startDlopen builds the dlopen test program and the shared object it
+// loads, and starts the program, returning it and the shared object's path.
+func startDlopen(t *testing.T) (debug.Program, string) {
+	if _, err := exec.LookPath("gcc"); err != nil {
+		t.Skip("gcc not found")
+	}
+	lib, err := filepath.Abs("./double.so")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := run("gcc", "-shared", "-fPIC", "-g", "-o", lib, "testdata/dlopen/lib/double.c"); err != nil {
+		t.Fatal("building double.so:", err)
+	}
+	filesToRemove = append(filesToRemove, lib)
+	prog, err := local.New(buildTestProgram(t, "dlopen"))
+	if err != nil {
+		t.Fatal("local.New:", err)
+	}
+	if _, err := prog.Run(lib); err != nil {
+		prog.Kill()
+		t.Fatal("Run:", err)
+	}
+	return prog, lib
+}
+
+// TestPendingBreakpointInSharedObject checks that a breakpoint at a
+// function in a shared object the process hasn't loaded is found when it is
+// loaded, and is pending again while it isn't.
+func TestPendingBreakpointInSharedObject(t *testing.T) {
+	prog, _ := startDlopen(t)
+	defer prog.Kill()
+	bp, err := prog.PendingBreakpointAtFunction("double_it")
+	if err != nil {
+		t.Fatal("PendingBreakpointAtFunction:", err)
+	}
+	if !bp.Pending || len(bp.PCs) != 0 {
+		t.Fatalf("before the shared object is loaded, got breakpoint %+v, want it pending", bp)
+	}
+	unloaded, err := prog.BreakpointAtFunction("main.unloaded")
+	if err != nil {
+		t.Fatal("BreakpointAtFunction:", err)
+	}
+	for i := 0; i < 2; i++ {
+		status, err := prog.Resume()
+		if err != nil {
+			t.Fatalf("Resume %d: %v", i, err)
+		}
+		if status.Reason != "breakpoint" || len(status.Breakpoints) != 1 || status.Breakpoints[0] != bp.ID {
+			t.Fatalf("Resume %d: stopped for %q at breakpoints %v, want breakpoint %d", i, status.Reason, status.Breakpoints, bp.ID)
+		}
+		select {
+		case e := <-prog.Events():
+			if e.Kind != "resolved" || e.Breakpoint == nil || e.Breakpoint.ID != bp.ID || len(e.Breakpoint.PCs) != 1 || e.Breakpoint.PCs[0] != status.PC {
+				t.Errorf("Resume %d: got event %+v, want breakpoint %d resolved at %#x", i, e, bp.ID, status.PC)
+			}
+		case <-time.After(10 * time.Second):
+			t.Errorf("Resume %d: no event for the breakpoint being resolved", i)
+		}
+
+		// Once the shared object is unloaded, the breakpoint is pending
+		// again.
+		if status, err = prog.Resume(); err != nil {
+			t.Fatalf("Resume %d: %v", i, err)
+		}
+		if len(status.Breakpoints) != 1 || status.Breakpoints[0] != unloaded.ID {
+			t.Fatalf("Resume %d: stopped at breakpoints %v, want main.unloaded's", i, status.Breakpoints)
+		}
+		bps, err := prog.ListBreakpoints()
+		if err != nil {
+			t.Fatal("ListBreakpoints:", err)
+		}
+		if bps[0].ID != bp.ID || !bps[0].Pending || len(bps[0].PCs) != 0 || bps[0].Err == "" {
+			t.Errorf("Resume %d: after the shared object is unloaded, got breakpoint %+v, want it pending", i, bps[0])
+		}
+	}
+	if _, err := prog.Resume(); err == nil {
+		t.Error("Resume after the last call: process didn't exit")
+	}
+}
+
+// TestSharedObjectList checks that SharedObjects lists a shared object,
+// with its debugging information, while it is loaded, and not before or
+// after.
+func TestSharedObjectList(t *testing.T) {
+	prog, lib := startDlopen(t)
+	defer prog.Kill()
+	// find returns the test's shared object from the list, or nil.
+	find := func(call string) *debug.SharedObject {
+		objs, err := prog.SharedObjects()
+		if err != nil {
+			t.Fatalf("%s: SharedObjects: %v", call, err)
+		}
+		for i := range objs {
+			if objs[i].Path == lib {
+				return &objs[i]
+			}
+		}
+		return nil
+	}
+	bp, err := prog.PendingBreakpointAtFunction("double_it")
+	if err != nil {
+		t.Fatal("PendingBreakpointAtFunction:", err)
+	}
+	if _, err := prog.BreakpointAtFunction("main.unloaded"); err != nil {
+		t.Fatal("BreakpointAtFunction:", err)
+	}
+	if _, err := prog.BreakpointAtFunction("main.main"); err != nil {
+		t.Fatal("BreakpointAtFunction:", err)
+	}
+	if _, err := prog.Resume(); err != nil {
+		t.Fatal("Resume:", err)
+	}
+	objs, err := prog.SharedObjects()
+	if err != nil {
+		t.Fatal("SharedObjects:", err)
+	}
+	if len(objs) == 0 {
+		t.Error("at main.main, the C library isn't listed")
+	}
+	if o := find("at main.main"); o != nil {
+		t.Errorf("before it is loaded, got %+v in the list", *o)
+	}
+
+	status, err := prog.Resume()
+	if err != nil {
+		t.Fatal("Resume:", err)
+	}
+	if len(status.Breakpoints) != 1 || status.Breakpoints[0] != bp.ID {
+		t.Fatalf("Resume: stopped at breakpoints %v, want %d", status.Breakpoints, bp.ID)
+	}
+	o := find("at double_it")
+	if o == nil {
+		t.Fatalf("at double_it, %s isn't listed", lib)
+	}
+	if !o.DWARF || o.Base == 0 || o.Start < o.Base || status.PC < o.Start || status.PC >= o.End {
+		t.Errorf("at double_it, at %#x, got %+v, want the object with DWARF, holding the PC", status.PC, *o)
+	}
+	frames, err := prog.Frames(1)
+	if err != nil {
+		t.Fatal("Frames:", err)
+	}
+	if len(frames) != 1 || frames[0].Function != "double_it" || filepath.Base(frames[0].File) != "double.c" {
+		t.Errorf("at double_it, got frames %+v, want double_it in double.c, from the object's DWARF", frames)
+	}
+
+	if _, err := prog.Resume(); err != nil {
+		t.Fatal("Resume:", err)
+	}
+	if o := find("at main.unloaded"); o != nil {
+		t.Errorf("after it is unloaded, got %+v in the list", *o)
+	}
+}
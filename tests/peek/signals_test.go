@@ -0,0 +1,78 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import (
+	"syscall"
+	"testing"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/local"
+)
+
+func TestSignalPolicy(t *testing.T) {
+	prog, err := local.New(buildTestProgram(t, "signals"))
+	if err != nil {
+		t.Fatal("local.New:", err)
+	}
+	defer prog.Kill()
+	if _, err := prog.Run(); err != nil {
+		t.Fatal("Run:", err)
+	}
+	stop, err := prog.BreakpointAtFunction("main.stop")
+	if err != nil {
+		t.Fatal("BreakpointAtFunction:", err)
+	}
+	// resumeToStop resumes the program until it reaches main.stop, and
+	// checks how many signals it has received.
+	resumeToStop := func(policy string, received int64) {
+		status, err := prog.Resume()
+		if err != nil {
+			t.Fatalf("with policy %s: Resume: %v", policy, err)
+		}
+		if len(status.Breakpoints) != 1 || status.Breakpoints[0] != stop.ID {
+			t.Fatalf("with policy %s: stopped for %q at %v, want main.stop", policy, status.Reason, status.Breakpoints)
+		}
+		if v, _, err := prog.Evaluate("main.received"); err != nil || v != received {
+			t.Errorf("with policy %s: main.received = %v (error %v), want %d", policy, v, err, received)
+		}
+	}
+
+	// By default, the signal is delivered without stopping.
+	resumeToStop("pass", 1)
+
+	if err := prog.SetSignalPolicy("SIGUSR1", debug.SignalStop); err != nil {
+		t.Fatal("SetSignalPolicy:", err)
+	}
+	status, err := prog.Resume()
+	if err != nil {
+		t.Fatal("Resume:", err)
+	}
+	if status.Reason != "signal" || status.Signal != "SIGUSR1" || status.SignalNumber != int(syscall.SIGUSR1) {
+		t.Errorf("with policy stop: got status %+v, want a stop for SIGUSR1", status)
+	}
+	// It is delivered when the program carries on.
+	resumeToStop("stop", 2)
+
+	if err := prog.SetSignalPolicy("SIGUSR1", debug.SignalIgnore); err != nil {
+		t.Fatal("SetSignalPolicy:", err)
+	}
+	resumeToStop("ignore", 2)
+
+	errorTests := []struct {
+		signal string
+		policy debug.SignalPolicy
+	}{
+		{"SIGNOTHING", debug.SignalStop},
+		{"SIGKILL", debug.SignalIgnore},
+		{"SIGTRAP", debug.SignalPass},
+		{"SIGUSR2", debug.SignalPolicy(99)},
+	}
+	for _, tt := range errorTests {
+		if err := prog.SetSignalPolicy(tt.signal, tt.policy); err == nil {
+			t.Errorf("SetSignalPolicy(%q, %d) succeeded", tt.signal, tt.policy)
+		}
+	}
+}
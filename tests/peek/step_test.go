@@ -0,0 +1,75 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import (
+	"testing"
+
+	"golang.org/x/debug/local"
+)
+
+func TestStepInstruction(t *testing.T) {
+	unstarted, err := local.New(buildTestProgram(t, "rewind"))
+	if err != nil {
+		t.Fatal("local.New:", err)
+	}
+	if _, err := unstarted.StepInstruction(); err == nil {
+		t.Error("StepInstruction before Run succeeded")
+	}
+
+	prog, first, second := startRewind(t, false)
+	defer prog.Kill()
+	status, err := prog.Resume()
+	if err != nil {
+		t.Fatal("Resume:", err)
+	}
+	checkStop(t, prog, "Resume", status, "breakpoint", first, 1)
+
+	// Step through main.first, one instruction at a time, off the breakpoint
+	// at its start and back to main.main.
+	pc := status.PC
+	for steps := 0; ; steps++ {
+		if steps == 100 {
+			t.Fatal("still in main.first after 100 instructions")
+		}
+		status, err := prog.StepInstruction()
+		if err != nil {
+			t.Fatal("StepInstruction:", err)
+		}
+		if status.Reason != "step" || status.PC == pc || status.Thread == 0 {
+			t.Errorf("StepInstruction from %#x: got status %+v, want a step to another PC", pc, status)
+		}
+		pc = status.PC
+		frames, err := prog.Frames(1)
+		if err != nil {
+			t.Fatal("Frames:", err)
+		}
+		if frames[0].PC != pc {
+			t.Errorf("after StepInstruction, Frames gives PC %#x, want %#x", frames[0].PC, pc)
+		}
+		if frames[0].Function != "main.first" {
+			if frames[0].Function != "main.main" {
+				t.Errorf("stepped from main.first to %s, want main.main", frames[0].Function)
+			}
+			break
+		}
+	}
+	if v, _, err := prog.Evaluate("main.value"); err != nil || v != int64(2) {
+		t.Errorf("after stepping through main.first, main.value = %v (error %v), want 2", v, err)
+	}
+
+	// The breakpoint stepped off is still there.
+	if _, err := prog.Restart(true); err != nil {
+		t.Fatal("Restart:", err)
+	}
+	if status, err = prog.Resume(); err != nil {
+		t.Fatal("Resume:", err)
+	}
+	checkStop(t, prog, "Resume after Restart", status, "breakpoint", first, 1)
+	if status, err = prog.Resume(); err != nil {
+		t.Fatal("Resume:", err)
+	}
+	checkStop(t, prog, "Resume", status, "breakpoint", second, 2)
+}
@@ -0,0 +1,76 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/debug/local"
+)
+
+func TestStopBreakpoints(t *testing.T) {
+	prog, first, _ := startRewind(t, false)
+	defer prog.Kill()
+	// Another breakpoint at the same place as the first.
+	also, err := prog.BreakpointAtFunction("main.first")
+	if err != nil {
+		t.Fatal("BreakpointAtFunction:", err)
+	}
+	status, err := prog.Resume()
+	if err != nil {
+		t.Fatal("Resume:", err)
+	}
+	if want := []uint64{first.ID, also.ID}; status.Reason != "breakpoint" || !reflect.DeepEqual(status.Breakpoints, want) {
+		t.Errorf("Resume: stopped for %q at breakpoints %v, want %v", status.Reason, status.Breakpoints, want)
+	}
+	if status.Goroutine != 1 || status.Thread == 0 || status.NewThread != 0 {
+		t.Errorf("Resume: got goroutine %d, thread %d, new thread %d; want goroutine 1", status.Goroutine, status.Thread, status.NewThread)
+	}
+}
+
+func TestThreadStops(t *testing.T) {
+	prog, err := local.New(buildTestProgram(t, "threads"))
+	if err != nil {
+		t.Fatal("local.New:", err)
+	}
+	defer prog.Kill()
+	if _, err := prog.Run(); err != nil {
+		t.Fatal("Run:", err)
+	}
+	if err := prog.SetThreadStops(true); err != nil {
+		t.Fatal("SetThreadStops:", err)
+	}
+
+	// The program starts threads, for the runtime and for the goroutines
+	// that lock theirs, before it exits.
+	for i := 0; i < 2; i++ {
+		status, err := prog.Resume()
+		if err != nil {
+			t.Fatal("Resume:", err)
+		}
+		if status.Reason != "thread" || status.NewThread == 0 || status.NewThread == status.Thread {
+			t.Fatalf("Resume: got status %+v, want a stop for a new thread", status)
+		}
+		threads, err := prog.Threads()
+		if err != nil {
+			t.Fatal("Threads:", err)
+		}
+		found := false
+		for _, th := range threads {
+			found = found || th.ID == status.NewThread
+		}
+		if !found {
+			t.Errorf("new thread %d not among threads %+v", status.NewThread, threads)
+		}
+	}
+
+	if err := prog.SetThreadStops(false); err != nil {
+		t.Fatal("SetThreadStops:", err)
+	}
+	if status, err := prog.Resume(); err == nil {
+		t.Errorf("Resume without thread stops: got status %+v, want the program to exit", status)
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+
+	"golang.org/x/debug/local"
+)
+
+func TestFindString(t *testing.T) {
+	prog, err := local.New(buildTestProgram(t, "strings"))
+	if err != nil {
+		t.Fatal("local.New:", err)
+	}
+	defer prog.Kill()
+
+	matches, err := prog.FindString("failed to frobnicate")
+	if err != nil {
+		t.Fatal("FindString:", err)
+	}
+	if len(matches) != 1 {
+		t.Fatalf("FindString: got %d matches, want 1: %+v", len(matches), matches)
+	}
+	m := matches[0]
+	if !strings.HasPrefix(m.Text, "widget %d failed to frobnicate") {
+		t.Errorf("FindString: got text %q, want the constant from its start", m.Text)
+	}
+	if runtime.GOARCH == "amd64" {
+		found := false
+		for _, ref := range m.References {
+			if ref.Function == "main.report" && strings.HasSuffix(ref.File, "testdata/strings/main.go") && ref.Line == 15 {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("FindString: got references %+v, want one in main.report at line 15", m.References)
+		}
+	}
+
+	if _, err := prog.FindString(""); err == nil {
+		t.Error("FindString of an empty string: got no error")
+	}
+	if matches, err := prog.FindString("no such message in the program"); err != nil || len(matches) != 0 {
+		t.Errorf("FindString of a missing string: got %+v, %v; want no matches", matches, err)
+	}
+}
@@ -0,0 +1,35 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// A program with goroutines blocked in a function whose arguments are still
+// needed after it blocks, for testing the argument values in goroutine
+// stacks.
+package main
+
+import "time"
+
+var (
+	wake  = make(chan bool)
+	total int
+	names string
+)
+
+//go:noinline
+func block(n int, name string) {
+	<-wake
+	total += n
+	names += name
+}
+
+//go:noinline
+func stop() {}
+
+func main() {
+	go block(1, "one")
+	go block(2, "two")
+	for {
+		stop()
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// A program with goroutines blocked sending to one channel and in a select
+// receiving from another, for testing listing a channel's waiters.
+package main
+
+import "time"
+
+var (
+	values = make(chan int)
+	quit   = make(chan bool)
+	none   chan int
+)
+
+//go:noinline
+func send(v int) {
+	values <- v
+}
+
+//go:noinline
+func wait() {
+	select {
+	case <-quit:
+	case <-time.After(time.Hour):
+	}
+}
+
+//go:noinline
+func stop() {}
+
+//go:noinline
+func waitForever() {
+	// A nil channel has no queue of waiters.
+	<-none
+}
+
+func main() {
+	go send(1)
+	go send(2)
+	go wait()
+	go waitForever()
+	for {
+		stop()
+		time.Sleep(10 * time.Millisecond)
+	}
+}
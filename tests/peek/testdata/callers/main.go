@@ -0,0 +1,39 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// A program that calls one function from two others, for testing
+// breakpoints that stop only for one of its callers.
+package main
+
+import "fmt"
+
+// calls counts the calls of count.
+var calls int
+
+//go:noinline
+func count() {
+	calls++
+}
+
+//go:noinline
+func wanted() {
+	count()
+}
+
+//go:noinline
+func other() {
+	count()
+}
+
+//go:noinline
+func outer() {
+	wanted()
+}
+
+func main() {
+	other()
+	outer()
+	other()
+	fmt.Println(calls)
+}
@@ -0,0 +1,54 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// A program with functions for testing calls made from Evaluate.
+package main
+
+import "fmt"
+
+var total int
+
+//go:noinline
+func Sum(a, b int) int {
+	return a + b
+}
+
+//go:noinline
+func Half(f float64) float64 {
+	return f / 2
+}
+
+//go:noinline
+func Greeting(formal bool) string {
+	if formal {
+		return "good day"
+	}
+	return "hi"
+}
+
+//go:noinline
+func AddToTotal(x int) int {
+	total += x
+	return total
+}
+
+//go:noinline
+func Fail(x int) int {
+	panic(x)
+}
+
+//go:noinline
+func Pair() (int, int) {
+	return 1, 2
+}
+
+func main() {
+	total = Sum(1, 2)
+	fmt.Println(total) // Line 48; the test stops here.
+	a, b := Pair()
+	fmt.Println(Half(3), Greeting(false), a+b, AddToTotal(0))
+	if total < 0 {
+		Fail(total)
+	}
+}
@@ -0,0 +1,23 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// A program that counts until it is killed, for testing reading variables
+// while a program runs.
+package main
+
+import "time"
+
+var count int64
+
+//go:noinline
+func next() int64 {
+	return count + 1
+}
+
+func main() {
+	for {
+		count = next()
+		time.Sleep(time.Millisecond)
+	}
+}
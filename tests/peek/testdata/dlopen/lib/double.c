@@ -0,0 +1,9 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// A shared object loaded by the dlopen test program.
+
+int double_it(int x) {
+	return 2 * x;
+}
@@ -0,0 +1,52 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// A program that loads the shared object named by its argument, built from
+// lib/double.c, calls its function double_it, and unloads it, twice, for
+// testing breakpoints in shared objects.
+package main
+
+/*
+#cgo LDFLAGS: -ldl
+#include <dlfcn.h>
+#include <stdlib.h>
+
+static int call_double(const char *path, int x) {
+	void *h = dlopen(path, RTLD_NOW);
+	if (h == NULL) {
+		return -1;
+	}
+	int (*f)(int) = (int (*)(int))dlsym(h, "double_it");
+	int r = f == NULL ? -1 : f(x);
+	dlclose(h);
+	return r;
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"os"
+	"unsafe"
+)
+
+// sum is the sum of the results of double_it.
+var sum int
+
+// unloaded is called after each time the shared object is unloaded.  It
+// calls nothing, so that it has no stack check, which could run it again from
+// the start after growing the stack.
+//
+//go:noinline
+func unloaded(r int) {
+	sum += r
+}
+
+func main() {
+	path := C.CString(os.Args[1])
+	defer C.free(unsafe.Pointer(path))
+	unloaded(int(C.call_double(path, 2)))
+	unloaded(int(C.call_double(path, 3)))
+	fmt.Println(sum)
+}
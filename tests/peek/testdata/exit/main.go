@@ -0,0 +1,17 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// A program that stops once and then exits with status 3, for testing how
+// the exit is reported.
+package main
+
+import "os"
+
+//go:noinline
+func stop() {}
+
+func main() {
+	stop()
+	os.Exit(3)
+}
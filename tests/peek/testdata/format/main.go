@@ -0,0 +1,31 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// A program with global variables of various kinds, for testing formatting
+// their values.
+package main
+
+import "fmt"
+
+type pair struct {
+	a    int
+	next *pair
+}
+
+var (
+	nums = []int{1, 2, 3, 4, 5}
+	arr  = [3]int{10, 20, 30}
+	str  = "abcdefghij"
+	p    = &pair{a: 255, next: &pair{a: 1}}
+	n    = uint8(200)
+	big  = make([]int, 150)
+)
+
+//go:noinline
+func stop() {}
+
+func main() {
+	stop()
+	fmt.Println(nums, arr, str, p, n, len(big))
+}
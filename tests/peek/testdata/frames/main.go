@@ -0,0 +1,29 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// A program with local variables in each of several frames, for testing
+// evaluating expressions in callers' frames.
+package main
+
+import "fmt"
+
+//go:noinline
+func stop() {}
+
+//go:noinline
+func inner(x int) int {
+	y := x * 2
+	stop()
+	return y
+}
+
+//go:noinline
+func outer(a int) int {
+	b := a + 1
+	return inner(b) + b
+}
+
+func main() {
+	fmt.Println(outer(10), outer(20))
+}
@@ -0,0 +1,37 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// A program that keeps the address of a heap object the garbage collector
+// has freed, for testing that its value isn't read.
+package main
+
+import (
+	"runtime"
+	"unsafe"
+)
+
+type object struct {
+	a [128]int64
+}
+
+var (
+	live      *object
+	sink      *object
+	freedAddr uintptr // The address of an object no pointer refers to.
+)
+
+//go:noinline
+func stop() {}
+
+func main() {
+	live = &object{}
+	live.a[0] = 42
+	sink = &object{}
+	freedAddr = uintptr(unsafe.Pointer(sink))
+	sink = nil
+	runtime.GC()
+	runtime.GC()
+	stop()
+	runtime.KeepAlive(live)
+}
@@ -0,0 +1,40 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// A program with a list of heap objects, for testing enumerating the heap,
+// finding references to objects and reading the runtime's state.
+package main
+
+import "runtime"
+
+// A node is big enough, and has pointers, so that the runtime records its
+// type in the heap.
+type node struct {
+	next *node
+	data [600]byte
+}
+
+var (
+	head *node
+	buf  []byte
+)
+
+//go:noinline
+func stop() {}
+
+//go:noinline
+func hold(n *node) {
+	// The program stops while n is in hold's frame.
+	stop()
+	runtime.KeepAlive(n)
+}
+
+func main() {
+	for i := 0; i < 100; i++ {
+		head = &node{next: head}
+	}
+	buf = make([]byte, 1<<20)
+	runtime.GC()
+	hold(head.next)
+}
@@ -0,0 +1,14 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package dep has an init function, for testing breakpoints in package
+// initialization.
+package dep
+
+// Ready is set by init.
+var Ready bool
+
+func init() {
+	Ready = true
+}
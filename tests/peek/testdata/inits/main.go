@@ -0,0 +1,21 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// A program importing a package with an init function, for testing
+// breakpoints in package initialization.
+package main
+
+import (
+	"fmt"
+
+	"golang.org/x/debug/tests/peek/testdata/inits/dep"
+)
+
+// started is set when main.main starts.
+var started bool
+
+func main() {
+	started = true
+	fmt.Println(dep.Ready)
+}
@@ -0,0 +1,33 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// A program with goroutines that have profiler labels, for testing reading
+// them.
+package main
+
+import (
+	"context"
+	"runtime/pprof"
+)
+
+//go:noinline
+func stop() {}
+
+func serve(id string, started chan bool) {
+	labels := pprof.Labels("request", id, "handler", "serve")
+	pprof.Do(context.Background(), labels, func(context.Context) {
+		started <- true
+		select {}
+	})
+}
+
+func main() {
+	started := make(chan bool)
+	go serve("1", started)
+	go serve("2", started)
+	<-started
+	<-started
+	pprof.SetGoroutineLabels(pprof.WithLabels(context.Background(), pprof.Labels("role", "main")))
+	stop()
+}
@@ -0,0 +1,23 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// A program that fills a map until it has grown several times, for testing
+// watching maps.
+package main
+
+import "fmt"
+
+var m map[int]int
+
+//go:noinline
+func stop() {}
+
+func main() {
+	m = make(map[int]int)
+	stop()
+	for i := 0; i < 2000; i++ {
+		m[i] = i
+	}
+	fmt.Println(len(m))
+}
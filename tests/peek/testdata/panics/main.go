@@ -0,0 +1,37 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// A program that panics twice, recovering from the first panic but not the
+// second, for testing stops at panics and
+// listing deferred calls.
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+//go:noinline
+func cleanup(n int) {
+	fmt.Println("cleanup", n)
+}
+
+func recovering() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("recovered: %v", r)
+		}
+	}()
+	panic("first")
+}
+
+func crash(n int) {
+	defer cleanup(n)
+	panic(errors.New("second"))
+}
+
+func main() {
+	fmt.Println(recovering())
+	crash(7)
+}
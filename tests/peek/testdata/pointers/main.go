@@ -0,0 +1,35 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// A program holding the addresses of values as a uintptr and an
+// unsafe.Pointer, for testing following them as typed pointers.
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"unsafe"
+)
+
+type node struct {
+	value int64
+	next  *node
+}
+
+var (
+	head = &node{value: 7, next: &node{value: 8}}
+	addr uintptr
+	ptr  unsafe.Pointer
+)
+
+//go:noinline
+func stop() {}
+
+func main() {
+	addr = uintptr(unsafe.Pointer(head))
+	ptr = unsafe.Pointer(head.next)
+	stop()
+	fmt.Println(addr != 0, ptr != nil)
+	runtime.KeepAlive(head)
+}
@@ -0,0 +1,28 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// A program that changes a global variable in each of two functions, for
+// testing checkpoints and taking the program back to earlier stops.
+package main
+
+import "fmt"
+
+// value is 1 until first sets it, and 2 until second does.
+var value = 1
+
+//go:noinline
+func first() {
+	value = 2
+}
+
+//go:noinline
+func second() {
+	value = 3
+}
+
+func main() {
+	first()
+	second()
+	fmt.Println(value)
+}
@@ -0,0 +1,34 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// A program that sends itself SIGUSR1 three times, counting those it
+// receives, for testing signal policies.
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// received is the number of signals received.
+var received int
+
+//go:noinline
+func stop() {}
+
+func main() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR1)
+	for i := 0; i < 3; i++ {
+		syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)
+		select {
+		case <-c:
+			received++
+		case <-time.After(time.Second):
+		}
+		stop()
+	}
+}
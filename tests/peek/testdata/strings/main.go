@@ -0,0 +1,20 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// A program with a log message for testing FindString.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+//go:noinline
+func report(n int) {
+	fmt.Fprintf(os.Stderr, "widget %d failed to frobnicate\n", n)
+}
+
+func main() {
+	report(1)
+}
@@ -0,0 +1,17 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package testpkg_test
+
+import (
+	"testing"
+
+	"golang.org/x/debug/tests/peek/testdata/testpkg"
+)
+
+func TestExternal(t *testing.T) {
+	if got := testpkg.Double(-1); got != -2 {
+		t.Errorf("Double(-1) = %d, want -2", got)
+	}
+}
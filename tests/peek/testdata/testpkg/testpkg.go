@@ -0,0 +1,11 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package testpkg has tests, for testing debugging them with local.NewTest.
+package testpkg
+
+// Double returns twice x.
+func Double(x int) int {
+	return 2 * x
+}
@@ -0,0 +1,24 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package testpkg
+
+import "testing"
+
+func TestDouble(t *testing.T) {
+	if got := Double(21); got != 42 {
+		t.Errorf("Double(21) = %d, want 42", got)
+	}
+}
+
+func TestDoubleZero(t *testing.T) {
+	if got := Double(0); got != 0 {
+		t.Errorf("Double(0) = %d, want 0", got)
+	}
+}
+
+// TestableDouble is a helper, not a test, since it has no *testing.T.
+func TestableDouble(x int) bool {
+	return Double(x) == x+x
+}
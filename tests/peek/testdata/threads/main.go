@@ -0,0 +1,35 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// A program that writes to a global variable from several threads, each
+// created after main starts, for testing watchpoints.
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// counter is incremented once by each thread.
+var counter int64
+
+func main() {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			runtime.LockOSThread()
+			time.Sleep(time.Duration(i+1) * 100 * time.Millisecond)
+			mu.Lock()
+			counter++
+			mu.Unlock()
+			wg.Done()
+		}(i)
+	}
+	wg.Wait()
+	fmt.Println(counter)
+}
@@ -0,0 +1,42 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// A program that writes to a global variable from several threads at once,
+// for testing watchpoints triggered by more than one thread together.
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// counter is incremented once by each thread.
+var counter int64
+
+// started is set when the threads are to write.
+var started int32
+
+func main() {
+	// A processor for each thread, and one for main, so that the threads
+	// can all spin until they are started.
+	runtime.GOMAXPROCS(5)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			runtime.LockOSThread()
+			for atomic.LoadInt32(&started) == 0 {
+			}
+			atomic.AddInt64(&counter, 1)
+			wg.Done()
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	atomic.StoreInt32(&started, 1)
+	wg.Wait()
+	fmt.Println(counter)
+}
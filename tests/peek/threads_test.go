@@ -0,0 +1,110 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import (
+	"testing"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/local"
+)
+
+func TestThreads(t *testing.T) {
+	prog, err := local.New(buildTestProgram(t, "threads"))
+	if err != nil {
+		t.Fatal("local.New:", err)
+	}
+	defer prog.Kill()
+	if _, err := prog.Run(); err != nil {
+		t.Fatal("Run:", err)
+	}
+	// The line incrementing the counter, which each of the program's
+	// threads reaches in turn.
+	if _, err := prog.BreakpointAtLine("testdata/threads/main.go", 28); err != nil {
+		t.Fatal("BreakpointAtLine:", err)
+	}
+	status, err := prog.Resume()
+	if err != nil {
+		t.Fatal("Resume:", err)
+	}
+
+	// checkThreads checks that the program's threads are listed in order,
+	// with the one that stopped it trapped, and returns them and the
+	// selected one.
+	checkThreads := func(name string) ([]debug.Thread, debug.Thread) {
+		threads, err := prog.Threads()
+		if err != nil {
+			t.Fatalf("%s: Threads: %v", name, err)
+		}
+		var selected debug.Thread
+		var trapped int
+		for i, th := range threads {
+			if i > 0 && th.ID <= threads[i-1].ID {
+				t.Errorf("%s: thread %d listed after %d", name, th.ID, threads[i-1].ID)
+			}
+			if th.Selected {
+				selected = th
+			}
+			switch th.State {
+			case "trapped":
+				trapped++
+				if th.ID != status.Thread || th.PC != status.PC {
+					t.Errorf("%s: got trapped thread %+v, want thread %d at %#x", name, th, status.Thread, status.PC)
+				}
+			case "syscall", "stopped":
+			default:
+				t.Errorf("%s: got thread %+v with unknown state", name, th)
+			}
+		}
+		if len(threads) < 2 || trapped != 1 || selected.ID == 0 {
+			t.Fatalf("%s: got threads %+v, want several, one trapped and one selected", name, threads)
+		}
+		return threads, selected
+	}
+
+	threads, selected := checkThreads("stopped")
+	if selected.ID != status.Thread {
+		t.Errorf("got thread %d selected, want %d, which stopped the program", selected.ID, status.Thread)
+	}
+
+	// Selecting another thread makes its registers those used.
+	var other debug.Thread
+	for _, th := range threads {
+		if th.ID != status.Thread {
+			other = th
+			break
+		}
+	}
+	if err := prog.SelectThread(other.ID); err != nil {
+		t.Fatal("SelectThread:", err)
+	}
+	if _, selected = checkThreads("another selected"); selected.ID != other.ID {
+		t.Errorf("after SelectThread(%d), got thread %d selected", other.ID, selected.ID)
+	}
+	frames, err := prog.Frames(1)
+	if err != nil || len(frames) != 1 || frames[0].PC != other.PC {
+		t.Errorf("Frames of thread %d: got %+v (error %v), want PC %#x", other.ID, frames, err, other.PC)
+	}
+	if err := prog.SelectThread(-1); err == nil {
+		t.Error("SelectThread of a missing thread succeeded")
+	}
+	if err := prog.SelectThread(0); err != nil {
+		t.Fatal("SelectThread(0):", err)
+	}
+	if _, selected = checkThreads("selection reset"); selected.ID != status.Thread {
+		t.Errorf("after SelectThread(0), got thread %d selected, want %d", selected.ID, status.Thread)
+	}
+
+	// The selection ends when the program runs.
+	if err := prog.SelectThread(other.ID); err != nil {
+		t.Fatal("SelectThread:", err)
+	}
+	if status, err = prog.Resume(); err != nil {
+		t.Fatal("Resume:", err)
+	}
+	if _, selected = checkThreads("stopped again"); selected.ID != status.Thread {
+		t.Errorf("after stopping again, got thread %d selected, want %d", selected.ID, status.Thread)
+	}
+}
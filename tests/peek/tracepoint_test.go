@@ -0,0 +1,72 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTracepoint(t *testing.T) {
+	prog, first, second := startRewind(t, false)
+	defer prog.Kill()
+	if err := prog.SetBreakpointTrace(first.ID, true, []string{"main.value", "main.nosuchvariable", "main.first()"}); err != nil {
+		t.Fatal("SetBreakpointTrace:", err)
+	}
+	if err := prog.SetBreakpointTrace(1000, true, nil); err == nil {
+		t.Error("SetBreakpointTrace of a missing breakpoint succeeded")
+	}
+	start := time.Now()
+
+	// The program carries on past the tracepoint, to the next breakpoint.
+	status, err := prog.Resume()
+	if err != nil {
+		t.Fatal("Resume:", err)
+	}
+	checkStop(t, prog, "Resume", status, "breakpoint", second, 2)
+
+	events, err := prog.TraceEvents()
+	if err != nil {
+		t.Fatal("TraceEvents:", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("got %d trace events, want 1", len(events))
+	}
+	ev := events[0]
+	if ev.Breakpoint != first.ID || ev.PC != first.PCs[0] || ev.Thread == 0 || ev.Goroutine == 0 || ev.Time.Before(start) {
+		t.Errorf("got event of breakpoint %d at %#x, goroutine %d, thread %d, time %v; want breakpoint %d at %#x", ev.Breakpoint, ev.PC, ev.Goroutine, ev.Thread, ev.Time, first.ID, first.PCs[0])
+	}
+	if len(ev.Values) != 3 {
+		t.Fatalf("got event values %+v, want 3", ev.Values)
+	}
+	if v := ev.Values[0]; v.Expression != "main.value" || v.Err != "" || v.Value != int64(1) {
+		t.Errorf("got event value %+v, want main.value = 1", v)
+	}
+	for _, v := range ev.Values[1:] {
+		if v.Err == "" {
+			t.Errorf("got event value %+v, want an error", v)
+		}
+	}
+
+	// Events are fetched once.
+	if events, err = prog.TraceEvents(); err != nil || len(events) != 0 {
+		t.Errorf("TraceEvents again: got %d events (error %v), want none", len(events), err)
+	}
+
+	// A breakpoint that is no longer a tracepoint stops the program again.
+	if err := prog.SetBreakpointTrace(first.ID, false, nil); err != nil {
+		t.Fatal("SetBreakpointTrace:", err)
+	}
+	if _, err := prog.Restart(true); err != nil {
+		t.Fatal("Restart:", err)
+	}
+	if status, err = prog.Resume(); err != nil {
+		t.Fatal("Resume:", err)
+	}
+	checkStop(t, prog, "Resume after Restart", status, "breakpoint", first, 1)
+	if events, err = prog.TraceEvents(); err != nil || len(events) != 0 {
+		t.Errorf("TraceEvents after stopping: got %d events (error %v), want none", len(events), err)
+	}
+}
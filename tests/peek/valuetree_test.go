@@ -0,0 +1,106 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/local"
+)
+
+// treeShape returns the names of the nodes of tree, depth first, with "+"
+// after those that are truncated.
+func treeShape(tree debug.ValueTree) []string {
+	name := tree.Name
+	if tree.Truncated {
+		name += "+"
+	}
+	shape := []string{name}
+	for _, c := range tree.Children {
+		shape = append(shape, treeShape(c)...)
+	}
+	return shape
+}
+
+func TestValueTree(t *testing.T) {
+	prog, err := local.New(buildTestProgram(t, "format"))
+	if err != nil {
+		t.Fatal("local.New:", err)
+	}
+	defer prog.Kill()
+	if _, err := prog.Run(); err != nil {
+		t.Fatal("Run:", err)
+	}
+	if _, err := prog.BreakpointAtFunction("main.stop"); err != nil {
+		t.Fatal("BreakpointAtFunction:", err)
+	}
+	if _, err := prog.Resume(); err != nil {
+		t.Fatal("Resume:", err)
+	}
+	tree := func(name string, depth int) debug.ValueTree {
+		t.Helper()
+		v, err := prog.VarByName(name)
+		if err != nil {
+			t.Fatal("VarByName:", err)
+		}
+		tree, err := prog.ValueTree(v, depth)
+		if err != nil {
+			t.Fatal("ValueTree:", err)
+		}
+		return tree
+	}
+
+	// main.p points to a pair, whose next field points to another.
+	tests := []struct {
+		depth int
+		shape []string
+	}{
+		{0, []string{"+"}},
+		{1, []string{"", "*+"}},
+		{3, []string{"", "*", "a", "next", "*+"}},
+		{4, []string{"", "*", "a", "next", "*", "a", "next"}},
+	}
+	for _, tt := range tests {
+		if got := treeShape(tree("main.p", tt.depth)); !reflect.DeepEqual(got, tt.shape) {
+			t.Errorf("main.p to depth %d: got tree %q, want %q", tt.depth, got, tt.shape)
+		}
+	}
+	p := tree("main.p", 4)
+	pair := p.Children[0]
+	if a := pair.Children[0]; a.Err != "" || a.Value != int64(255) {
+		t.Errorf("main.p.a: got %+v, want 255", a)
+	}
+	if a := pair.Children[1].Children[0].Children[0]; a.Value != int64(1) {
+		t.Errorf("main.p.next.a: got %+v, want 1", a)
+	}
+	next := pair.Children[1].Children[0].Children[1]
+	if ptr, ok := next.Value.(debug.Pointer); !ok || ptr.Address != 0 || len(next.Children) != 0 {
+		t.Errorf("main.p.next.next: got %+v, want a nil pointer", next)
+	}
+
+	// Slices have their elements expanded, up to a limit.
+	nums := tree("main.nums", 1)
+	if len(nums.Children) != 5 || nums.Truncated {
+		t.Fatalf("main.nums: got %d elements (truncated %t), want 5", len(nums.Children), nums.Truncated)
+	}
+	for i, c := range nums.Children {
+		if c.Value != int64(i+1) {
+			t.Errorf("main.nums%s: got %v, want %d", c.Name, c.Value, i+1)
+		}
+	}
+	if big := tree("main.big", 1); len(big.Children) != 100 || !big.Truncated || big.Children[99].Name != "[99]" {
+		t.Errorf("main.big: got %d elements (truncated %t), want the first 100", len(big.Children), big.Truncated)
+	}
+
+	v, err := prog.VarByName("main.p")
+	if err != nil {
+		t.Fatal("VarByName:", err)
+	}
+	if _, err := prog.ValueTree(v, -1); err == nil {
+		t.Error("ValueTree with a negative depth succeeded")
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package peek_test
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/debug"
+	"golang.org/x/debug/local"
+)
+
+// buildTestProgram builds the program in the named directory of testdata,
+// returning the path of the executable, which is removed when the tests
+// finish.
+func buildTestProgram(t *testing.T, name string) string {
+	exe := "./" + name + ".out"
+	if err := run("go", "build", "-o", exe, traceeSrc+"/"+name); err != nil {
+		t.Fatalf("couldn't build %s: %v", name, err)
+	}
+	filesToRemove = append(filesToRemove, exe)
+	return exe
+}
+
+// startMain runs prog until main.main starts.  The breakpoint it uses is
+// deleted, since main.main starts again if the runtime preempts it in its
+// prologue.
+func startMain(t *testing.T, prog debug.Program) {
+	t.Helper()
+	bp, err := prog.BreakpointAtFunction("main.main")
+	if err != nil {
+		t.Fatal("BreakpointAtFunction:", err)
+	}
+	if _, err := prog.Resume(); err != nil {
+		t.Fatal("Resume:", err)
+	}
+	if err := prog.DeleteBreakpoints([]uint64{bp.ID}); err != nil {
+		t.Fatal("DeleteBreakpoints:", err)
+	}
+}
+
+// TestWatchpointThreads checks that a watchpoint is triggered by writes from
+// threads other than the one stopped when it was set, including threads
+// created afterwards.
+func TestWatchpointThreads(t *testing.T) {
+	prog, err := local.New(buildTestProgram(t, "threads"))
+	if err != nil {
+		t.Fatal("local.New:", err)
+	}
+	defer prog.Kill()
+	if _, err := prog.Run(); err != nil {
+		t.Fatal("Run:", err)
+	}
+	startMain(t, prog)
+	w, err := prog.WatchGlobal("main.counter")
+	if err != nil {
+		t.Fatal("WatchGlobal:", err)
+	}
+	threads := make(map[int]bool)
+	for i := int64(1); i <= 4; i++ {
+		status, err := prog.Resume()
+		if err != nil {
+			t.Fatalf("Resume %d: %v", i, err)
+		}
+		if status.Reason != "watchpoint" || !reflect.DeepEqual(status.Watchpoints, []uint64{w.ID}) {
+			t.Fatalf("Resume %d: stopped for %q, watchpoints %v; want watchpoint %d", i, status.Reason, status.Watchpoints, w.ID)
+		}
+		threads[status.Thread] = true
+		v, _, err := prog.Evaluate("main.counter")
+		if err != nil {
+			t.Fatal("Evaluate:", err)
+		}
+		if v != i {
+			t.Errorf("after write %d, counter = %v", i, v)
+		}
+	}
+	if len(threads) != 4 {
+		t.Errorf("watchpoint triggered in %d threads, want 4", len(threads))
+	}
+	if _, err := prog.Resume(); err == nil {
+		t.Error("Resume after the last write: process didn't exit")
+	}
+}
+
+// TestWatchpointThreadsTogether checks that a watchpoint triggered by several
+// threads at once is reported for each of them, although only one can stop
+// the program at a time.
+func TestWatchpointThreadsTogether(t *testing.T) {
+	prog, err := local.New(buildTestProgram(t, "together"))
+	if err != nil {
+		t.Fatal("local.New:", err)
+	}
+	defer prog.Kill()
+	if _, err := prog.Run(); err != nil {
+		t.Fatal("Run:", err)
+	}
+	startMain(t, prog)
+	w, err := prog.WatchGlobal("main.counter")
+	if err != nil {
+		t.Fatal("WatchGlobal:", err)
+	}
+	threads := make(map[int]bool)
+	for i := int64(1); i <= 4; i++ {
+		status, err := prog.Resume()
+		if err != nil {
+			t.Fatalf("Resume %d: %v", i, err)
+		}
+		if status.Reason != "watchpoint" || !reflect.DeepEqual(status.Watchpoints, []uint64{w.ID}) {
+			t.Fatalf("Resume %d: stopped for %q, watchpoints %v; want watchpoint %d", i, status.Reason, status.Watchpoints, w.ID)
+		}
+		threads[status.Thread] = true
+		// Other threads may have written too before they were stopped.
+		v, _, err := prog.Evaluate("main.counter")
+		if err != nil {
+			t.Fatal("Evaluate:", err)
+		}
+		if n, ok := v.(int64); !ok || n < i || n > 4 {
+			t.Errorf("after write %d, counter = %v", i, v)
+		}
+	}
+	if len(threads) != 4 {
+		t.Errorf("watchpoint triggered in %d threads, want 4", len(threads))
+	}
+	if _, err := prog.Resume(); err == nil {
+		t.Error("Resume after the last write: process didn't exit")
+	}
+}